@@ -0,0 +1,163 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package asyncwriter persists non-critical files, such as state files,
+// in the background so that slow disks don't delay bootstrapping the agent.
+package asyncwriter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// Writer writes files in the background. Each file is replaced atomically,
+// and when several writes to the same file are queued only the most recent
+// one is written. The parent directories of a batch of writes are synced
+// once for the whole batch.
+type Writer struct {
+	lock    sync.Mutex
+	pending map[string]write
+	err     error
+
+	notify  chan struct{}
+	flushes chan chan error
+}
+
+type write struct {
+	data []byte
+	perm os.FileMode
+}
+
+// New returns a Writer with its background writer started
+func New() *Writer {
+	w := &Writer{
+		pending: make(map[string]write),
+		notify:  make(chan struct{}, 1),
+		flushes: make(chan chan error),
+	}
+	go w.run()
+	return w
+}
+
+// WriteFile queues data to be written to filename. Errors from writing the
+// file are reported by Flush.
+func (w *Writer) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	w.lock.Lock()
+	w.pending[filename] = write{data: data, perm: perm}
+	w.lock.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+		// a batch is already due to be written
+	}
+	return nil
+}
+
+// Flush blocks until all queued writes are persisted and returns the first
+// error encountered since the previous Flush
+func (w *Writer) Flush() error {
+	done := make(chan error)
+	w.flushes <- done
+	return <-done
+}
+
+func (w *Writer) run() {
+	for {
+		select {
+		case <-w.notify:
+			w.writePending()
+		case done := <-w.flushes:
+			w.writePending()
+			w.lock.Lock()
+			err := w.err
+			w.err = nil
+			w.lock.Unlock()
+			done <- err
+		}
+	}
+}
+
+func (w *Writer) writePending() {
+	w.lock.Lock()
+	batch := w.pending
+	w.pending = make(map[string]write)
+	w.lock.Unlock()
+
+	dirs := make(map[string]struct{})
+	for filename, file := range batch {
+		err := writeFileSync(filename, file.data, file.perm)
+		if err != nil {
+			log.Warnf("Failed to write %s: %v", filename, err)
+			w.recordError(err)
+			continue
+		}
+		dirs[filepath.Dir(filename)] = struct{}{}
+	}
+	for dir := range dirs {
+		err := SyncPath(dir)
+		if err != nil {
+			log.Warnf("Failed to sync directory %s: %v", dir, err)
+			w.recordError(err)
+		}
+	}
+}
+
+func (w *Writer) recordError(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// writeFileSync writes data to a temp file next to filename, syncs it and
+// renames it over filename
+func writeFileSync(filename string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(filename)
+	file, err := ioutil.TempFile(dir, base)
+	if err != nil {
+		return errors.Wrapf(err, "could not create temp file for %s", filename)
+	}
+	defer os.Remove(file.Name()) // no-op once renamed
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), perm)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not write temp file for %s", filename)
+	}
+	return os.Rename(file.Name(), filename)
+}
+
+// SyncPath commits the file or directory at path to stable storage
+func SyncPath(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
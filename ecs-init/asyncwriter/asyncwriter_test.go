@@ -0,0 +1,53 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package asyncwriter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileFlush(t *testing.T) {
+	dir := t.TempDir()
+
+	filename := filepath.Join(dir, "state")
+	w := New()
+	w.WriteFile(filename, []byte("2"), 0600)
+	w.WriteFile(filename, []byte("1"), 0600)
+	require.NoError(t, w.Flush())
+
+	data, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(data), "Expect the most recent write to be persisted")
+
+	info, err := os.Stat(filename)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "Expect no temp files to be left behind")
+}
+
+func TestFlushReportsError(t *testing.T) {
+	w := New()
+	w.WriteFile("/nonexistent-dir/state", []byte("1"), 0600)
+	assert.Error(t, w.Flush(), "Expect the write error to be reported")
+	assert.NoError(t, w.Flush(), "Expect the error to be reported once")
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package autoscalingclient is a client for the Amazon EC2 Auto Scaling APIs
+// protecting the instance from scale in while the Agent is upgraded, and
+// completing the launch lifecycle hook of the instance once the Agent is
+// ready
+package autoscalingclient
+
+import (
+	"github.com/aws/amazon-ecs-init/ecs-init/awsquery"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+const (
+	// LifecycleStateInService is the lifecycle state of an instance serving
+	// its Auto Scaling group
+	LifecycleStateInService = "InService"
+	// LifecycleStatePendingWait is the lifecycle state of a launching
+	// instance held by a lifecycle hook
+	LifecycleStatePendingWait = "Pending:Wait"
+	// LifecycleActionContinue lets the lifecycle action of an instance go
+	// on
+	LifecycleActionContinue = "CONTINUE"
+)
+
+var service = awsquery.Service{
+	Name:       "autoscaling",
+	ID:         "Auto Scaling",
+	APIVersion: "2011-01-01",
+}
+
+// Client calls the Amazon EC2 Auto Scaling APIs of a region
+type Client struct {
+	*awsquery.Client
+}
+
+// New creates a Client of the Amazon EC2 Auto Scaling APIs of region
+func New(region string) (*Client, error) {
+	client, err := awsquery.NewForRegion(region, service)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+func newClient(cfg *aws.Config) (*Client, error) {
+	client, err := awsquery.New(cfg, service)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+// Instance is the subset of an Auto Scaling instance used by ecs-init
+type Instance struct {
+	InstanceID           string
+	AutoScalingGroupName string
+	LifecycleState       string
+	ProtectedFromScaleIn bool
+}
+
+type describeAutoScalingInstancesInput struct {
+	InstanceIds []string
+}
+
+type autoScalingInstance struct {
+	InstanceId           *string
+	AutoScalingGroupName *string
+	LifecycleState       *string
+	ProtectedFromScaleIn *bool
+}
+
+type describeAutoScalingInstancesOutput struct {
+	AutoScalingInstances []autoScalingInstance
+}
+
+// DescribeInstance returns the Auto Scaling instance instanceID, or nil if
+// the instance is not in an Auto Scaling group
+func (c *Client) DescribeInstance(instanceID string) (*Instance, error) {
+	output := &describeAutoScalingInstancesOutput{}
+	err := c.Call("DescribeAutoScalingInstances", &describeAutoScalingInstancesInput{
+		InstanceIds: []string{instanceID},
+	}, output)
+	if err != nil {
+		return nil, err
+	}
+	if len(output.AutoScalingInstances) == 0 {
+		return nil, nil
+	}
+	instance := output.AutoScalingInstances[0]
+	return &Instance{
+		InstanceID:           aws.StringValue(instance.InstanceId),
+		AutoScalingGroupName: aws.StringValue(instance.AutoScalingGroupName),
+		LifecycleState:       aws.StringValue(instance.LifecycleState),
+		ProtectedFromScaleIn: aws.BoolValue(instance.ProtectedFromScaleIn),
+	}, nil
+}
+
+type setInstanceProtectionInput struct {
+	AutoScalingGroupName string
+	InstanceIds          []string
+	ProtectedFromScaleIn bool
+}
+
+// SetInstanceProtection sets whether the instance instanceID of the group
+// is protected from scale in
+func (c *Client) SetInstanceProtection(group string, instanceID string, protected bool) error {
+	return c.Call("SetInstanceProtection", &setInstanceProtectionInput{
+		AutoScalingGroupName: group,
+		InstanceIds:          []string{instanceID},
+		ProtectedFromScaleIn: protected,
+	}, &struct{}{})
+}
+
+type completeLifecycleActionInput struct {
+	AutoScalingGroupName  string
+	LifecycleHookName     string
+	InstanceId            string
+	LifecycleActionResult string
+}
+
+// CompleteLifecycleAction completes the lifecycle action of the instance
+// instanceID of the group held by hook with result
+func (c *Client) CompleteLifecycleAction(group string, hook string, instanceID string, result string) error {
+	return c.Call("CompleteLifecycleAction", &completeLifecycleActionInput{
+		AutoScalingGroupName:  group,
+		LifecycleHookName:     hook,
+		InstanceId:            instanceID,
+		LifecycleActionResult: result,
+	}, &struct{}{})
+}
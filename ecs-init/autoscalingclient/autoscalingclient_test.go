@@ -0,0 +1,114 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package autoscalingclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/awstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requestValues(t *testing.T, r *http.Request) url.Values {
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(t, err)
+	values, err := url.ParseQuery(string(body))
+	require.NoError(t, err)
+	return values
+}
+
+func TestDescribeInstance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, url.Values{
+			"Action":               {"DescribeAutoScalingInstances"},
+			"Version":              {"2011-01-01"},
+			"InstanceIds.member.1": {"i-1234"},
+		}, requestValues(t, r))
+		w.Write([]byte(`<DescribeAutoScalingInstancesResponse>
+  <DescribeAutoScalingInstancesResult>
+    <AutoScalingInstances>
+      <member>
+        <InstanceId>i-1234</InstanceId>
+        <AutoScalingGroupName>ecs-asg</AutoScalingGroupName>
+        <LifecycleState>InService</LifecycleState>
+        <ProtectedFromScaleIn>true</ProtectedFromScaleIn>
+      </member>
+    </AutoScalingInstances>
+  </DescribeAutoScalingInstancesResult>
+</DescribeAutoScalingInstancesResponse>`))
+	}))
+	defer server.Close()
+
+	instance, err := awstest.NewClient(t, server, newClient).DescribeInstance("i-1234")
+	require.NoError(t, err)
+	assert.Equal(t, &Instance{
+		InstanceID:           "i-1234",
+		AutoScalingGroupName: "ecs-asg",
+		LifecycleState:       LifecycleStateInService,
+		ProtectedFromScaleIn: true,
+	}, instance)
+}
+
+func TestDescribeInstanceNotInGroup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<DescribeAutoScalingInstancesResponse>
+  <DescribeAutoScalingInstancesResult><AutoScalingInstances/></DescribeAutoScalingInstancesResult>
+</DescribeAutoScalingInstancesResponse>`))
+	}))
+	defer server.Close()
+
+	instance, err := awstest.NewClient(t, server, newClient).DescribeInstance("i-1234")
+	require.NoError(t, err)
+	assert.Nil(t, instance)
+}
+
+func TestSetInstanceProtection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, url.Values{
+			"Action":               {"SetInstanceProtection"},
+			"Version":              {"2011-01-01"},
+			"AutoScalingGroupName": {"ecs-asg"},
+			"InstanceIds.member.1": {"i-1234"},
+			"ProtectedFromScaleIn": {"true"},
+		}, requestValues(t, r))
+		w.Write([]byte(`<SetInstanceProtectionResponse><SetInstanceProtectionResult/></SetInstanceProtectionResponse>`))
+	}))
+	defer server.Close()
+
+	assert.NoError(t, awstest.NewClient(t, server, newClient).SetInstanceProtection("ecs-asg", "i-1234", true))
+}
+
+func TestCompleteLifecycleAction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, url.Values{
+			"Action":                {"CompleteLifecycleAction"},
+			"Version":               {"2011-01-01"},
+			"AutoScalingGroupName":  {"ecs-asg"},
+			"LifecycleHookName":     {"ecs-agent-ready"},
+			"InstanceId":            {"i-1234"},
+			"LifecycleActionResult": {"CONTINUE"},
+		}, requestValues(t, r))
+		w.Write([]byte(`<CompleteLifecycleActionResponse><CompleteLifecycleActionResult/></CompleteLifecycleActionResponse>`))
+	}))
+	defer server.Close()
+
+	assert.NoError(t, awstest.NewClient(t, server, newClient).CompleteLifecycleAction("ecs-asg", "ecs-agent-ready", "i-1234",
+		LifecycleActionContinue))
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package awsjson is a client for AWS APIs of the AWS JSON protocol, built
+// on the core of the AWS SDK for services whose SDK package is not vendored
+package awsjson
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+const jsonVersion = "1.1"
+
+// Service describes the API of an AWS service
+type Service struct {
+	// Name is the endpoint and signing name of the service
+	Name string
+	// SigningName replaces Name when signing requests, unless the endpoint
+	// of the region has its own signing name
+	SigningName  string
+	ID           string
+	APIVersion   string
+	TargetPrefix string
+}
+
+// Client calls the APIs of a service
+type Client struct {
+	*client.Client
+}
+
+// NewForRegion creates a Client of service in region with the default
+// credentials chain
+func NewForRegion(region string, service Service) (*Client, error) {
+	return New(aws.NewConfig().WithRegion(region), service)
+}
+
+// New creates a Client of service with cfg
+func New(cfg *aws.Config, service Service) (*Client, error) {
+	sessionInstance, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := sessionInstance.ClientConfig(service.Name)
+	if service.SigningName != "" && (c.SigningNameDerived || c.SigningName == "") {
+		c.SigningName = service.SigningName
+	}
+	svc := &Client{
+		Client: client.New(
+			*c.Config,
+			metadata.ClientInfo{
+				ServiceName:   service.Name,
+				ServiceID:     service.ID,
+				SigningName:   c.SigningName,
+				SigningRegion: c.SigningRegion,
+				PartitionID:   c.PartitionID,
+				Endpoint:      c.Endpoint,
+				APIVersion:    service.APIVersion,
+				JSONVersion:   jsonVersion,
+				TargetPrefix:  service.TargetPrefix,
+			},
+			c.Handlers,
+		),
+	}
+	svc.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	svc.Handlers.Build.PushBackNamed(request.NamedHandler{Name: "awsjson.Build", Fn: build})
+	svc.Handlers.Unmarshal.PushBackNamed(request.NamedHandler{Name: "awsjson.Unmarshal", Fn: unmarshal})
+	svc.Handlers.UnmarshalMeta.PushBackNamed(request.NamedHandler{Name: "awsjson.UnmarshalMeta", Fn: unmarshalMeta})
+	svc.Handlers.UnmarshalError.PushBackNamed(request.NamedHandler{Name: "awsjson.UnmarshalError", Fn: unmarshalError})
+	return svc, nil
+}
+
+// Call calls the API name with input and decodes its response into output
+func (c *Client) Call(name string, input interface{}, output interface{}) error {
+	op := &request.Operation{
+		Name:       name,
+		HTTPMethod: http.MethodPost,
+		HTTPPath:   "/",
+	}
+	return c.NewRequest(op, input, output).Send()
+}
+
+// build encodes the parameters of the request in the AWS JSON protocol
+func build(r *request.Request) {
+	body, err := json.Marshal(r.Params)
+	if err != nil {
+		r.Error = awserr.New(request.ErrCodeSerialization, "failed to encode request", err)
+		return
+	}
+	r.SetBufferBody(body)
+	r.HTTPRequest.Header.Set("X-Amz-Target", r.ClientInfo.TargetPrefix+"."+r.Operation.Name)
+	r.HTTPRequest.Header.Set("Content-Type", "application/x-amz-json-"+r.ClientInfo.JSONVersion)
+}
+
+func unmarshal(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+	err := json.NewDecoder(r.HTTPResponse.Body).Decode(r.Data)
+	if err != nil && err != io.EOF {
+		r.Error = awserr.New(request.ErrCodeSerialization, "failed to decode response", err)
+	}
+}
+
+func unmarshalMeta(r *request.Request) {
+	r.RequestID = r.HTTPResponse.Header.Get("X-Amzn-Requestid")
+}
+
+func unmarshalError(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+	var body struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	// the status code is reported even if the body cannot be decoded
+	json.NewDecoder(r.HTTPResponse.Body).Decode(&body)
+	code := body.Type[strings.LastIndex(body.Type, "#")+1:]
+	if code == "" {
+		code = http.StatusText(r.HTTPResponse.StatusCode)
+	}
+	r.Error = awserr.NewRequestFailure(awserr.New(code, body.Message, nil), r.HTTPResponse.StatusCode, r.RequestID)
+}
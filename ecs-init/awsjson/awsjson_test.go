@@ -0,0 +1,85 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsjson
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/awstest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testService = Service{
+	Name:         "ecs",
+	ID:           "ECS",
+	APIVersion:   "2014-11-13",
+	TargetPrefix: "AmazonEC2ContainerServiceV20141113",
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) *Client {
+	return awstest.NewClient(t, server, func(cfg *aws.Config) (*Client, error) {
+		return New(cfg, testService)
+	})
+}
+
+func TestCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "AmazonEC2ContainerServiceV20141113.ListClusters", r.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "application/x-amz-json-1.1", r.Header.Get("Content-Type"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-west-2/ecs/aws4_request")
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{"maxResults":1}`, string(body))
+		w.Write([]byte(`{"clusterArns":["arn"]}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	input := struct {
+		MaxResults int `json:"maxResults"`
+	}{1}
+	var output struct {
+		ClusterArns []string `json:"clusterArns"`
+	}
+	err := client.Call("ListClusters", &input, &output)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"arn"}, output.ClusterArns)
+}
+
+func TestErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amzn-Requestid", "request-id")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"com.amazonaws.ecs#AccessDeniedException","message":"not authorized"}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	var output struct{}
+	err := client.Call("CreateCluster", &struct{}{}, &output)
+	require.Error(t, err)
+	requestErr, ok := err.(awserr.RequestFailure)
+	require.True(t, ok)
+	assert.Equal(t, "AccessDeniedException", requestErr.Code())
+	assert.Equal(t, "not authorized", requestErr.Message())
+	assert.Equal(t, http.StatusBadRequest, requestErr.StatusCode())
+	assert.Equal(t, "request-id", requestErr.RequestID())
+}
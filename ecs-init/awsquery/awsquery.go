@@ -0,0 +1,99 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package awsquery is a client for AWS APIs of the AWS Query protocol, built
+// on the core of the AWS SDK for services whose SDK package is not vendored
+package awsquery
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+)
+
+// Service describes the API of an AWS service
+type Service struct {
+	// Name is the endpoint and signing name of the service
+	Name       string
+	ID         string
+	APIVersion string
+	// EC2 selects the flavor of the protocol spoken by Amazon EC2, which
+	// numbers list members without .member, does not wrap results in a
+	// Result element and wraps errors in an Errors element
+	EC2 bool
+}
+
+// Client calls the APIs of a service
+type Client struct {
+	*client.Client
+}
+
+// NewForRegion creates a Client of service in region with the default
+// credentials chain
+func NewForRegion(region string, service Service) (*Client, error) {
+	return New(aws.NewConfig().WithRegion(region), service)
+}
+
+// New creates a Client of service with cfg
+func New(cfg *aws.Config, service Service) (*Client, error) {
+	sessionInstance, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := sessionInstance.ClientConfig(service.Name)
+	svc := &Client{
+		Client: client.New(
+			*c.Config,
+			metadata.ClientInfo{
+				ServiceName:   service.Name,
+				ServiceID:     service.ID,
+				SigningName:   c.SigningName,
+				SigningRegion: c.SigningRegion,
+				PartitionID:   c.PartitionID,
+				Endpoint:      c.Endpoint,
+				APIVersion:    service.APIVersion,
+			},
+			c.Handlers,
+		),
+	}
+	svc.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	svc.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	if service.EC2 {
+		svc.Handlers.Build.PushBackNamed(ec2BuildHandler)
+		svc.Handlers.Unmarshal.PushBackNamed(ec2UnmarshalHandler)
+		svc.Handlers.UnmarshalError.PushBackNamed(ec2UnmarshalErrorHandler)
+		return svc, nil
+	}
+	svc.Handlers.Build.PushBackNamed(query.BuildHandler)
+	svc.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	svc.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+	return svc, nil
+}
+
+// Call calls the API name with input, encoded as form values named after
+// its fields, and decodes the XML result of the response into output, whose
+// fields are pointers as with the structs of the AWS SDK
+func (c *Client) Call(name string, input interface{}, output interface{}) error {
+	op := &request.Operation{
+		Name:       name,
+		HTTPMethod: http.MethodPost,
+		HTTPPath:   "/",
+	}
+	return c.NewRequest(op, input, output).Send()
+}
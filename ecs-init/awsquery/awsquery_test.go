@@ -0,0 +1,157 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsquery
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/awstest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testService = Service{
+	Name:       "autoscaling",
+	ID:         "Auto Scaling",
+	APIVersion: "2011-01-01",
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) *Client {
+	return awstest.NewClient(t, server, func(cfg *aws.Config) (*Client, error) {
+		return New(cfg, testService)
+	})
+}
+
+func TestCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-west-2/autoscaling/aws4_request")
+		body, _ := ioutil.ReadAll(r.Body)
+		values, err := url.ParseQuery(string(body))
+		require.NoError(t, err)
+		assert.Equal(t, url.Values{
+			"Action":                         {"DescribeAutoScalingGroups"},
+			"Version":                        {"2011-01-01"},
+			"AutoScalingGroupNames.member.1": {"asg"},
+		}, values)
+		w.Write([]byte(`<DescribeAutoScalingGroupsResponse>
+  <DescribeAutoScalingGroupsResult>
+    <AutoScalingGroups><member><AutoScalingGroupName>asg</AutoScalingGroupName></member></AutoScalingGroups>
+  </DescribeAutoScalingGroupsResult>
+</DescribeAutoScalingGroupsResponse>`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	input := struct {
+		AutoScalingGroupNames []string
+	}{[]string{"asg"}}
+	var output struct {
+		AutoScalingGroups []struct {
+			AutoScalingGroupName *string
+		}
+	}
+	err := client.Call("DescribeAutoScalingGroups", &input, &output)
+	require.NoError(t, err)
+	require.Len(t, output.AutoScalingGroups, 1)
+	assert.Equal(t, "asg", aws.StringValue(output.AutoScalingGroups[0].AutoScalingGroupName))
+}
+
+func TestErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code>` +
+			`<Message>not authorized</Message></Error><RequestId>request-id</RequestId></ErrorResponse>`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	var output struct{}
+	err := client.Call("SetInstanceProtection", &struct{}{}, &output)
+	require.Error(t, err)
+	requestErr, ok := err.(awserr.RequestFailure)
+	require.True(t, ok)
+	assert.Equal(t, "AccessDenied", requestErr.Code())
+	assert.Equal(t, "not authorized", requestErr.Message())
+	assert.Equal(t, http.StatusBadRequest, requestErr.StatusCode())
+	assert.Equal(t, "request-id", requestErr.RequestID())
+}
+
+func TestCallEC2(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		values, err := url.ParseQuery(string(body))
+		require.NoError(t, err)
+		assert.Equal(t, url.Values{
+			"Action":       {"DescribeTags"},
+			"Version":      {"2016-11-15"},
+			"ResourceId.1": {"i-123"},
+		}, values)
+		w.Write([]byte(`<DescribeTagsResponse>
+  <requestId>request-id</requestId>
+  <tagSet><item><key>team</key></item></tagSet>
+</DescribeTagsResponse>`))
+	}))
+	defer server.Close()
+	client := newTestEC2Client(t, server)
+
+	input := struct {
+		ResourceIds []string `locationName:"ResourceId" type:"list"`
+	}{[]string{"i-123"}}
+	var output struct {
+		Tags []struct {
+			Key *string `locationName:"key" type:"string"`
+		} `locationName:"tagSet" locationNameList:"item" type:"list"`
+	}
+	err := client.Call("DescribeTags", &input, &output)
+	require.NoError(t, err)
+	require.Len(t, output.Tags, 1)
+	assert.Equal(t, "team", aws.StringValue(output.Tags[0].Key))
+}
+
+func TestErrorResponseEC2(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<Response><Errors><Error><Code>UnauthorizedOperation</Code>` +
+			`<Message>not authorized</Message></Error></Errors><RequestID>request-id</RequestID></Response>`))
+	}))
+	defer server.Close()
+	client := newTestEC2Client(t, server)
+
+	err := client.Call("CreateTags", &struct{}{}, nil)
+	require.Error(t, err)
+	requestErr, ok := err.(awserr.RequestFailure)
+	require.True(t, ok)
+	assert.Equal(t, "UnauthorizedOperation", requestErr.Code())
+	assert.Equal(t, "not authorized", requestErr.Message())
+	assert.Equal(t, "request-id", requestErr.RequestID())
+}
+
+func newTestEC2Client(t *testing.T, server *httptest.Server) *Client {
+	return awstest.NewClient(t, server, func(cfg *aws.Config) (*Client, error) {
+		return New(cfg, Service{
+			Name:       "ec2",
+			ID:         "EC2",
+			APIVersion: "2016-11-15",
+			EC2:        true,
+		})
+	})
+}
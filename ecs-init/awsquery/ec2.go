@@ -0,0 +1,93 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsquery
+
+import (
+	"encoding/xml"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol/query/queryutil"
+	"github.com/aws/aws-sdk-go/private/protocol/xml/xmlutil"
+)
+
+var (
+	ec2BuildHandler          = request.NamedHandler{Name: "awsquery.ec2.Build", Fn: ec2Build}
+	ec2UnmarshalHandler      = request.NamedHandler{Name: "awsquery.ec2.Unmarshal", Fn: ec2Unmarshal}
+	ec2UnmarshalErrorHandler = request.NamedHandler{Name: "awsquery.ec2.UnmarshalError", Fn: ec2UnmarshalError}
+)
+
+// ec2Build encodes the input as form values as the query protocol does, with
+// list members named as Amazon EC2 expects
+func ec2Build(r *request.Request) {
+	body := url.Values{
+		"Action":  {r.Operation.Name},
+		"Version": {r.ClientInfo.APIVersion},
+	}
+	err := queryutil.Parse(body, r.Params, true)
+	if err != nil {
+		r.Error = awserr.New(request.ErrCodeSerialization, "failed encoding EC2 Query request", err)
+		return
+	}
+	r.HTTPRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	r.SetBufferBody([]byte(body.Encode()))
+}
+
+// ec2Unmarshal decodes the response, whose fields are the direct children of
+// its root element
+func ec2Unmarshal(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+	if !r.DataFilled() {
+		return
+	}
+	err := xmlutil.UnmarshalXML(r.Data, xml.NewDecoder(r.HTTPResponse.Body), "")
+	if err != nil {
+		r.Error = awserr.NewRequestFailure(
+			awserr.New(request.ErrCodeSerialization, "failed decoding EC2 Query response", err),
+			r.HTTPResponse.StatusCode,
+			r.RequestID,
+		)
+	}
+}
+
+type ec2ErrorResponse struct {
+	Code      string `xml:"Errors>Error>Code"`
+	Message   string `xml:"Errors>Error>Message"`
+	RequestID string `xml:"RequestID"`
+}
+
+// ec2UnmarshalError decodes the first error of an error response
+func ec2UnmarshalError(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+	var resp ec2ErrorResponse
+	err := xmlutil.UnmarshalXMLError(&resp, r.HTTPResponse.Body)
+	if err != nil {
+		r.Error = awserr.NewRequestFailure(
+			awserr.New(request.ErrCodeSerialization, "failed to unmarshal error message", err),
+			r.HTTPResponse.StatusCode,
+			r.RequestID,
+		)
+		return
+	}
+	requestID := resp.RequestID
+	if requestID == "" {
+		requestID = r.RequestID
+	}
+	r.Error = awserr.NewRequestFailure(
+		awserr.New(resp.Code, resp.Message, nil),
+		r.HTTPResponse.StatusCode,
+		requestID,
+	)
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package awstest configures the clients of the AWS APIs called by ecs-init
+// to call a test server instead of the endpoints of a region
+package awstest
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+// Region is the region the test server is called in, which requests are
+// signed for
+const Region = "us-west-2"
+
+// Config returns the config of a client calling the test server at endpoint,
+// with static credentials and without retrying failed calls
+func Config(endpoint string) *aws.Config {
+	return aws.NewConfig().
+		WithRegion(Region).
+		WithEndpoint(endpoint).
+		WithMaxRetries(0).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", ""))
+}
+
+// NewClient creates the client of server with newClient, failing the test
+// when it cannot be created
+func NewClient[C any](t *testing.T, server *httptest.Server, newClient func(*aws.Config) (C, error)) C {
+	client, err := newClient(Config(server.URL))
+	require.NoError(t, err)
+	return client
+}
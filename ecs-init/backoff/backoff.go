@@ -14,6 +14,7 @@
 package backoff
 
 import (
+	"context"
 	"math"
 	"math/rand"
 	"sync"
@@ -72,6 +73,31 @@ func (rb *retryBackoff) ShouldRetry() bool {
 	return rb.count < rb.maxRetries
 }
 
+// deadlineBackoff retries until a deadline, however many retries its
+// backoff allows
+type deadlineBackoff struct {
+	backoff  Backoff
+	deadline time.Time
+}
+
+// UntilDeadline returns a Backoff with the durations of b that retries until
+// deadline, shortening the last duration so that it ends at the deadline
+func UntilDeadline(b Backoff, deadline time.Time) Backoff {
+	return &deadlineBackoff{backoff: b, deadline: deadline}
+}
+
+func (db *deadlineBackoff) Duration() time.Duration {
+	d := db.backoff.Duration()
+	if remaining := time.Until(db.deadline); d > remaining {
+		d = remaining
+	}
+	return d
+}
+
+func (db *deadlineBackoff) ShouldRetry() bool {
+	return time.Now().Before(db.deadline)
+}
+
 // addJitter adds an amount of jitter between 0 and the given jitter to the
 // given duration
 func addJitter(duration time.Duration, jitter time.Duration) time.Duration {
@@ -83,3 +109,91 @@ func addJitter(duration time.Duration, jitter time.Duration) time.Duration {
 	}
 	return time.Duration(duration.Nanoseconds() + randJitter)
 }
+
+// Policy is how an operation is retried
+type Policy struct {
+	// MaxAttempts is how many times the operation is attempted in all
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, multiplied by
+	// Multiplier before each following retry up to MaxDelay
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Multiplier float64
+	// Jitter is the fraction of each delay that is randomly added to it,
+	// e.g. 0.2 for up to 20%
+	Jitter float64
+}
+
+// NewBackoff creates a Backoff following the policy
+func (p Policy) NewBackoff() Backoff {
+	return NewBackoff(p.BaseDelay, p.MaxDelay, p.Jitter, p.Multiplier, p.MaxAttempts-1)
+}
+
+// permanentError is an error that retrying does not resolve
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as an error that Retry does not retry
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// Retry calls fn until it succeeds, fails with a Permanent error, or b allows
+// no more retries, sleeping for the duration of b between attempts. notify,
+// if not nil, is called with the error of each attempt that is retried and
+// the delay before the next one. The error of the last attempt is returned,
+// without its Permanent mark.
+func Retry(b Backoff, sleep func(time.Duration), fn func() error, notify func(error, time.Duration)) error {
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if permanent, ok := err.(permanentError); ok {
+			return permanent.err
+		}
+		if !b.ShouldRetry() {
+			return err
+		}
+		d := b.Duration()
+		if notify != nil {
+			notify(err, d)
+		}
+		sleep(d)
+	}
+}
+
+// RetryContext calls fn like Retry until ctx is done, after which the error of
+// ctx is returned instead of calling fn again
+func RetryContext(ctx context.Context, b Backoff, sleep func(time.Duration), fn func() error, notify func(error, time.Duration)) error {
+	return Retry(b, sleep, func() error {
+		if err := ctx.Err(); err != nil {
+			return Permanent(err)
+		}
+		return fn()
+	}, notify)
+}
+
+// Sleep sleeps for d, returning early with the error of ctx once ctx is done
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
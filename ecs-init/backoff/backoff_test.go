@@ -14,6 +14,8 @@
 package backoff
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -46,3 +48,89 @@ func TestRetryBackoffDuration(t *testing.T) {
 	assert.Equal(t, retryBackoff.Duration(), 3*time.Second, "expect 3rd backoff to be max backoff")
 	assert.False(t, retryBackoff.ShouldRetry(), "expect to not retry when count >= max retries")
 }
+
+func TestUntilDeadline(t *testing.T) {
+	b := UntilDeadline(NewBackoff(time.Minute, time.Minute, 0, 1, 0), time.Now().Add(time.Hour))
+	assert.True(t, b.ShouldRetry(), "Expect retries until the deadline, whatever the max retries")
+	assert.Equal(t, time.Minute, b.Duration())
+
+	b = UntilDeadline(NewBackoff(time.Hour, time.Hour, 0, 1, 5), time.Now().Add(time.Minute))
+	assert.True(t, b.Duration() <= time.Minute, "Expect the duration to end at the deadline")
+
+	b = UntilDeadline(NewBackoff(time.Second, time.Second, 0, 1, 5), time.Now().Add(-time.Second))
+	assert.False(t, b.ShouldRetry(), "Expect no retries past the deadline")
+}
+
+func TestPolicyNewBackoff(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 3 * time.Second, Multiplier: 2}
+	retryBackoff := policy.NewBackoff()
+	assert.Equal(t, time.Second, retryBackoff.Duration())
+	assert.True(t, retryBackoff.ShouldRetry())
+	assert.Equal(t, 2*time.Second, retryBackoff.Duration())
+	assert.False(t, retryBackoff.ShouldRetry(), "expect 2 retries for 3 attempts")
+}
+
+func TestRetry(t *testing.T) {
+	var slept []time.Duration
+	var notified []error
+	attempts := 0
+	err := Retry(NewBackoff(time.Second, time.Minute, 0, 2, 3), func(d time.Duration) {
+		slept = append(slept, d)
+	}, func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	}, func(err error, d time.Duration) {
+		notified = append(notified, err)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, slept)
+	assert.Len(t, notified, 2)
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	attempts := 0
+	err := Retry(NewBackoff(time.Second, time.Minute, 0, 2, 2), func(time.Duration) {}, func() error {
+		attempts++
+		return errors.New("transient")
+	}, nil)
+	assert.EqualError(t, err, "transient")
+	assert.Equal(t, 3, attempts)
+}
+
+func TestRetryPermanent(t *testing.T) {
+	permanent := errors.New("permanent")
+	attempts := 0
+	err := Retry(NewBackoff(time.Second, time.Minute, 0, 2, 2), func(time.Duration) {
+		t.Error("expect no retry of a permanent error")
+	}, func() error {
+		attempts++
+		return Permanent(permanent)
+	}, nil)
+	assert.Equal(t, permanent, err)
+	assert.Equal(t, 1, attempts)
+	assert.NoError(t, Permanent(nil))
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := RetryContext(ctx, NewBackoff(time.Second, time.Minute, 0, 2, 5), func(time.Duration) {
+		cancel()
+	}, func() error {
+		attempts++
+		return errors.New("transient")
+	}, nil)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, attempts, "Expect no attempt once the context is canceled")
+}
+
+func TestSleepCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, Sleep(ctx, time.Hour))
+	assert.NoError(t, Sleep(context.Background(), time.Millisecond))
+}
@@ -0,0 +1,221 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package backup archives the data directory of the Agent, so that its state
+// can be restored after a failed upgrade or moved to another host
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// backupDirPerm only allows root to read backups, as task state may
+	// include credentials
+	backupDirPerm  = 0700
+	backupFilePerm = 0600
+	// restoreSuffix names the directory a backup is extracted to before it
+	// replaces the data directory
+	restoreSuffix = ".restore"
+	// previousSuffix names the data directory while it is being replaced
+	previousSuffix = ".previous"
+)
+
+// Archiver creates and restores backups of a directory as gzipped tarballs
+type Archiver struct{}
+
+// NewArchiver creates a new Archiver object
+func NewArchiver() *Archiver {
+	return &Archiver{}
+}
+
+// Create writes the regular files and directories under dir to the backup
+// file. The file is only replaced once the backup is complete.
+func (a *Archiver) Create(dir string, file string) error {
+	err := os.MkdirAll(filepath.Dir(file), backupDirPerm)
+	if err != nil {
+		return errors.Wrap(err, "could not create backup directory")
+	}
+	tmpFile := file + ".tmp"
+	out, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, backupFilePerm)
+	if err != nil {
+		return errors.Wrap(err, "could not create backup file")
+	}
+	defer os.Remove(tmpFile)
+	err = archive(dir, out)
+	closeErr := out.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return errors.Wrap(closeErr, "could not write backup file")
+	}
+	return os.Rename(tmpFile, file)
+}
+
+func archive(dir string, out io.Writer) error {
+	gzipWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzipWriter)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil || name == "." {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			log.Warnf("Not backing up %s, which is neither a regular file nor a directory", path)
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		err = tarWriter.WriteHeader(header)
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return copyFile(tarWriter, path)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "could not back up %s", dir)
+	}
+	err = tarWriter.Close()
+	if err != nil {
+		return errors.Wrap(err, "could not write backup file")
+	}
+	return errors.Wrap(gzipWriter.Close(), "could not write backup file")
+}
+
+func copyFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// Restore replaces dir with the contents of the backup file. The backup is
+// extracted next to dir first, so that dir is left untouched if the backup
+// cannot be read.
+func (a *Archiver) Restore(file string, dir string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return errors.Wrap(err, "could not open backup file")
+	}
+	defer in.Close()
+
+	staging := dir + restoreSuffix
+	err = os.RemoveAll(staging)
+	if err != nil {
+		return errors.Wrap(err, "could not remove previous restore")
+	}
+	perm := os.FileMode(backupDirPerm)
+	if info, err := os.Stat(dir); err == nil {
+		perm = info.Mode().Perm()
+	}
+	err = os.MkdirAll(staging, perm)
+	if err != nil {
+		return errors.Wrap(err, "could not create restore directory")
+	}
+	err = extract(in, staging)
+	if err != nil {
+		os.RemoveAll(staging)
+		return errors.Wrapf(err, "could not extract %s", file)
+	}
+	return swap(staging, dir)
+}
+
+func extract(in io.Reader, dir string) error {
+	gzipReader, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return errors.Errorf("invalid path %q", header.Name)
+		}
+		target := filepath.Join(dir, name)
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, mode)
+		case tar.TypeReg:
+			err = extractFile(tarReader, target, mode)
+		default:
+			err = errors.Errorf("unsupported entry %q", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(target), backupDirPerm)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// swap replaces dir with staging
+func swap(staging string, dir string) error {
+	previous := dir + previousSuffix
+	err := os.RemoveAll(previous)
+	if err != nil {
+		return errors.Wrap(err, "could not remove previous data directory")
+	}
+	err = os.Rename(dir, previous)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "could not move data directory aside")
+	}
+	err = os.Rename(staging, dir)
+	if err != nil {
+		// put the data directory back
+		os.Rename(previous, dir)
+		return errors.Wrap(err, "could not replace data directory")
+	}
+	return os.RemoveAll(previous)
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func assertNotExist(t *testing.T, path string) {
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "%s should not exist", path)
+}
+
+func TestCreateRestore(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	backupFile := filepath.Join(root, "backups", "data.tar.gz")
+	writeFile(t, filepath.Join(dataDir, "agent.db"), "state")
+	writeFile(t, filepath.Join(dataDir, "eni", "ipam.db"), "addresses")
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, "empty"), 0700))
+
+	archiver := NewArchiver()
+	require.NoError(t, archiver.Create(dataDir, backupFile))
+	info, err := os.Stat(backupFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(backupFilePerm), info.Mode().Perm())
+
+	// the state changes after the backup
+	writeFile(t, filepath.Join(dataDir, "agent.db"), "changed")
+	writeFile(t, filepath.Join(dataDir, "new"), "new")
+
+	require.NoError(t, archiver.Restore(backupFile, dataDir))
+	assert.Equal(t, "state", readFile(t, filepath.Join(dataDir, "agent.db")))
+	assert.Equal(t, "addresses", readFile(t, filepath.Join(dataDir, "eni", "ipam.db")))
+	assert.DirExists(t, filepath.Join(dataDir, "empty"))
+	assertNotExist(t, filepath.Join(dataDir, "new"))
+	assertNotExist(t, dataDir+restoreSuffix)
+	assertNotExist(t, dataDir+previousSuffix)
+}
+
+func TestRestoreMissingDataDirectory(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	backupFile := filepath.Join(root, "data.tar.gz")
+	writeFile(t, filepath.Join(dataDir, "agent.db"), "state")
+
+	archiver := NewArchiver()
+	require.NoError(t, archiver.Create(dataDir, backupFile))
+	require.NoError(t, os.RemoveAll(dataDir))
+
+	require.NoError(t, archiver.Restore(backupFile, dataDir))
+	assert.Equal(t, "state", readFile(t, filepath.Join(dataDir, "agent.db")))
+}
+
+func TestRestoreInvalidBackup(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	backupFile := filepath.Join(root, "data.tar.gz")
+	writeFile(t, filepath.Join(dataDir, "agent.db"), "state")
+	writeFile(t, backupFile, "not a backup")
+
+	err := NewArchiver().Restore(backupFile, dataDir)
+	assert.Error(t, err)
+	// the data directory is untouched
+	assert.Equal(t, "state", readFile(t, filepath.Join(dataDir, "agent.db")))
+	assertNotExist(t, dataDir+restoreSuffix)
+}
+
+func TestRestoreRejectsPathTraversal(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	backupFile := filepath.Join(root, "data.tar.gz")
+	writeFile(t, filepath.Join(dataDir, "agent.db"), "state")
+
+	file, err := os.Create(backupFile)
+	require.NoError(t, err)
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+		Name:     "../escaped",
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+		Size:     1,
+	}))
+	_, err = tarWriter.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	require.NoError(t, file.Close())
+
+	err = NewArchiver().Restore(backupFile, dataDir)
+	assert.Error(t, err)
+	assertNotExist(t, filepath.Join(root, "escaped"))
+	assert.Equal(t, "state", readFile(t, filepath.Join(dataDir, "agent.db")))
+}
+
+func TestRestoreMissingBackup(t *testing.T) {
+	root := t.TempDir()
+
+	err := NewArchiver().Restore(filepath.Join(root, "missing.tar.gz"), filepath.Join(root, "data"))
+	assert.Error(t, err)
+}
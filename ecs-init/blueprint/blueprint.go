@@ -0,0 +1,619 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package blueprint converges the host toward a declarative host blueprint
+// by writing the config files, hooks and mount units that pre-start, the
+// Agent and systemd already act on
+package blueprint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+	"github.com/aws/amazon-ecs-init/ecs-init/hooks"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	filePerm = 0644
+	dirPerm  = 0755
+	// hookPerm lets root run the hooks of the blueprint, which the hooks
+	// runner skips when others can write them
+	hookPerm = 0755
+	// attributesFragment is the instance attributes fragment owned by the
+	// blueprint
+	attributesFragment = "50-blueprint.json"
+	// hookSuffix marks the hooks owned by the blueprint, so that the hooks
+	// dropped in by operators are left alone
+	hookSuffix = ".blueprint"
+	// mountUnitMarker is the first line of the mount units owned by the
+	// blueprint, as their names are set by the path they mount
+	mountUnitMarker = "# Managed by the ecs-init host blueprint"
+	// mountUnitSuffix is the suffix of the systemd mount units
+	mountUnitSuffix      = ".mount"
+	systemctlExecutable  = "systemctl"
+	maxPort              = 65535
+	unitNameSafeSpecials = ":_."
+)
+
+// Blueprint is the desired configuration of the host, read as YAML
+type Blueprint struct {
+	// Agent pins the Agent that is downloaded and started
+	Agent Agent `yaml:"agent"`
+	// Config sets Agent config variables in the instance config file.
+	// Variables missing from the blueprint are left as they are.
+	Config map[string]string `yaml:"config"`
+	// Attributes are the custom attributes of the container instance
+	Attributes map[string]string `yaml:"attributes"`
+	// Sysctls override the kernel parameters of the sysctl profile, which
+	// is enabled when they are set
+	Sysctls map[string]string `yaml:"sysctls"`
+	// Hooks are the scripts run at each stage of the Agent, by stage
+	Hooks map[string][]Hook `yaml:"hooks"`
+	// Mounts are the file systems mounted on the host before Docker starts
+	Mounts []Mount `yaml:"mounts"`
+	// NetRules restrict the network of the Agent and the host
+	NetRules NetRules `yaml:"netrules"`
+}
+
+// Agent describes the Agent of the host
+type Agent struct {
+	// Version is the version of the Agent, such as 1.76.0
+	Version string `yaml:"version"`
+}
+
+// Hook is a script run at a stage of the Agent
+type Hook struct {
+	// Name orders the hook among the other hooks of its stage
+	Name   string `yaml:"name"`
+	Script string `yaml:"script"`
+}
+
+// Mount is a file system mounted by a systemd mount unit
+type Mount struct {
+	Source  string `yaml:"source"`
+	Target  string `yaml:"target"`
+	Type    string `yaml:"type"`
+	Options string `yaml:"options"`
+}
+
+// NetRules are the network rules of the Agent and the host
+type NetRules struct {
+	// Egress is the egress policy of the Agent container, open or
+	// restricted
+	Egress string `yaml:"egress"`
+	// EgressAllow are the host names and CIDR blocks the Agent container
+	// may connect to when its egress is restricted
+	EgressAllow []string `yaml:"egressAllow"`
+	// ReservedPorts are the host ports that must be free when the Agent
+	// starts
+	ReservedPorts []int `yaml:"reservedPorts"`
+}
+
+// Load reads the blueprint in file, rejecting unknown sections
+func Load(file string) (*Blueprint, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		// not wrapped, so that a missing blueprint can be told apart
+		return nil, err
+	}
+	blueprint := &Blueprint{}
+	err = yaml.UnmarshalStrict(data, blueprint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid blueprint %s", file)
+	}
+	err = blueprint.validate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid blueprint %s", file)
+	}
+	return blueprint, nil
+}
+
+func (b *Blueprint) validate() error {
+	if strings.ContainsAny(b.Agent.Version, " \t\n") {
+		return errors.Errorf("invalid agent version %q", b.Agent.Version)
+	}
+	for stage, stageHooks := range b.Hooks {
+		if stage != hooks.PreStart && stage != hooks.PostStart {
+			return errors.Errorf("unknown hook stage %q, expected %q or %q", stage, hooks.PreStart, hooks.PostStart)
+		}
+		names := make(map[string]bool)
+		for _, hook := range stageHooks {
+			if hook.Name == "" || strings.HasPrefix(hook.Name, ".") || strings.Contains(hook.Name, "/") {
+				return errors.Errorf("invalid %s hook name %q", stage, hook.Name)
+			}
+			if names[hook.Name] {
+				return errors.Errorf("duplicate %s hook %s", stage, hook.Name)
+			}
+			names[hook.Name] = true
+			if strings.TrimSpace(hook.Script) == "" {
+				return errors.Errorf("%s hook %s has no script", stage, hook.Name)
+			}
+		}
+	}
+	targets := make(map[string]bool)
+	for _, mount := range b.Mounts {
+		if mount.Source == "" || mount.Type == "" {
+			return errors.Errorf("mount of %s needs a source and a type", mount.Target)
+		}
+		if !filepath.IsAbs(mount.Target) || filepath.Clean(mount.Target) != mount.Target || mount.Target == "/" {
+			return errors.Errorf("invalid mount target %q, expected a clean absolute path", mount.Target)
+		}
+		if targets[mount.Target] {
+			return errors.Errorf("duplicate mount of %s", mount.Target)
+		}
+		targets[mount.Target] = true
+	}
+	switch strings.ToLower(b.NetRules.Egress) {
+	case "", config.AgentEgressOpen, config.AgentEgressRestricted:
+	default:
+		return errors.Errorf("invalid egress %q, expected %q or %q", b.NetRules.Egress,
+			config.AgentEgressOpen, config.AgentEgressRestricted)
+	}
+	for _, port := range b.NetRules.ReservedPorts {
+		if port <= 0 || port > maxPort {
+			return errors.Errorf("invalid reserved port %d", port)
+		}
+	}
+	return nil
+}
+
+// Environment returns the variables ecs-init reads from its environment
+// that the blueprint sets. They are also written to the agent config file,
+// which systemd loads into the environment of ecs-init when it starts.
+func (b *Blueprint) Environment() map[string]string {
+	environment := make(map[string]string)
+	if b.NetRules.Egress != "" {
+		environment[config.AgentEgressEnvVar] = strings.ToLower(b.NetRules.Egress)
+	}
+	if len(b.NetRules.EgressAllow) > 0 {
+		environment[config.AgentEgressAllowEnvVar] = strings.Join(b.NetRules.EgressAllow, ",")
+	}
+	return environment
+}
+
+// Change is a file that differs from what the blueprint describes. Desired
+// is empty when the file should not exist.
+type Change struct {
+	File    string
+	Current string
+	Desired string
+	// Mode is the permissions of the file, filePerm when not set
+	Mode os.FileMode
+	// Unit is the systemd unit the file defines, which is restarted once
+	// the file is written and stopped before it is removed
+	Unit string
+}
+
+// Diff returns the lines removed from and added to the file
+func (c Change) Diff() string {
+	current := lineSet(c.Current)
+	desired := lineSet(c.Desired)
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", c.File, c.File)
+	for _, line := range strings.Split(strings.TrimSuffix(c.Current, "\n"), "\n") {
+		if line != "" && !desired[line] {
+			fmt.Fprintf(&diff, "-%s\n", line)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(c.Desired, "\n"), "\n") {
+		if line != "" && !current[line] {
+			fmt.Fprintf(&diff, "+%s\n", line)
+		}
+	}
+	return diff.String()
+}
+
+func lineSet(content string) map[string]bool {
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(content, "\n") {
+		lines[line] = true
+	}
+	return lines
+}
+
+// Converger computes and applies the changes that converge the host toward
+// a blueprint
+type Converger struct {
+	cmdExec         exec.Exec
+	blueprintFile   string
+	configFile      string
+	environmentFile string
+	attributesFile  string
+	sysctlFile      string
+	hooksDir        string
+	unitDir         string
+}
+
+// NewConverger creates a new Converger object
+func NewConverger(cmdExec exec.Exec) *Converger {
+	return &Converger{
+		cmdExec:         cmdExec,
+		blueprintFile:   config.BlueprintFile(),
+		configFile:      config.InstanceConfigFile(),
+		environmentFile: config.AgentConfigFile(),
+		attributesFile:  filepath.Join(config.InstanceAttributesDirectory(), attributesFragment),
+		sysctlFile:      config.SysctlProfileFile(),
+		hooksDir:        config.HooksDirectory(),
+		unitDir:         config.SystemdUnitDirectory(),
+	}
+}
+
+// Load reads the blueprint of the host. The error satisfies os.IsNotExist
+// when the host has no blueprint.
+func (c *Converger) Load() (*Blueprint, error) {
+	return Load(c.blueprintFile)
+}
+
+// Plan returns the changes needed for the host to match the blueprint
+func (c *Converger) Plan(blueprint *Blueprint) ([]Change, error) {
+	var changes []Change
+	add := func(change Change) error {
+		current, err := readFile(change.File)
+		if err != nil {
+			return err
+		}
+		if current != change.Desired {
+			change.Current = current
+			changes = append(changes, change)
+		}
+		return nil
+	}
+
+	configVariables := make(map[string]string)
+	for key, value := range blueprint.Config {
+		configVariables[key] = value
+	}
+	if blueprint.Agent.Version != "" {
+		configVariables[config.AgentVersionEnvVar] = blueprint.Agent.Version
+	}
+	if len(blueprint.NetRules.ReservedPorts) > 0 {
+		ports := make([]string, 0, len(blueprint.NetRules.ReservedPorts))
+		for _, port := range blueprint.NetRules.ReservedPorts {
+			ports = append(ports, strconv.Itoa(port))
+		}
+		configVariables[config.ReservedPortsEnvVar] = strings.Join(ports, ",")
+	}
+	if len(blueprint.Sysctls) > 0 {
+		configVariables[config.SysctlProfileEnvVar] = "true"
+		err := add(Change{File: c.sysctlFile, Desired: formatSysctls(blueprint.Sysctls)})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, configFile := range []struct {
+		file      string
+		variables map[string]string
+	}{
+		{c.configFile, configVariables},
+		{c.environmentFile, blueprint.Environment()},
+	} {
+		if len(configFile.variables) == 0 {
+			continue
+		}
+		current, err := readFile(configFile.file)
+		if err != nil {
+			return nil, err
+		}
+		err = add(Change{File: configFile.file, Desired: mergeConfig(current, configFile.variables)})
+		if err != nil {
+			return nil, err
+		}
+	}
+	attributes := ""
+	if len(blueprint.Attributes) > 0 {
+		data, err := json.Marshal(blueprint.Attributes)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not encode instance attributes")
+		}
+		attributes = string(data) + "\n"
+	}
+	err := add(Change{File: c.attributesFile, Desired: attributes})
+	if err != nil {
+		return nil, err
+	}
+	hookChanges, err := c.planHooks(blueprint.Hooks)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range hookChanges {
+		err = add(change)
+		if err != nil {
+			return nil, err
+		}
+	}
+	mountChanges, err := c.planMounts(blueprint.Mounts)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range mountChanges {
+		err = add(change)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// planHooks returns the hooks of the blueprint, and the removal of the hooks
+// of the blueprint that it no longer lists
+func (c *Converger) planHooks(stageHooks map[string][]Hook) ([]Change, error) {
+	var changes []Change
+	for _, stage := range []string{hooks.PreStart, hooks.PostStart} {
+		dir := hooks.StageDirectory(c.hooksDir, stage)
+		desired := make(map[string]bool)
+		for _, hook := range stageHooks[stage] {
+			file := filepath.Join(dir, hook.Name+hookSuffix)
+			desired[file] = true
+			changes = append(changes, Change{File: file, Desired: hook.Script, Mode: hookPerm})
+		}
+		owned, err := filepath.Glob(filepath.Join(dir, "*"+hookSuffix))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list the %s hooks", stage)
+		}
+		for _, file := range owned {
+			if !desired[file] {
+				changes = append(changes, Change{File: file})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// planMounts returns the mount units of the blueprint, and the removal of
+// the mount units of the blueprint that it no longer lists. A mount unit
+// the blueprint does not own is never replaced.
+func (c *Converger) planMounts(mounts []Mount) ([]Change, error) {
+	var changes []Change
+	desired := make(map[string]bool)
+	for _, mount := range mounts {
+		unit := unitName(mount.Target) + mountUnitSuffix
+		file := filepath.Join(c.unitDir, unit)
+		owned, err := ownedUnit(file)
+		if err != nil {
+			return nil, err
+		}
+		if !owned {
+			return nil, errors.Errorf("%s is not managed by the host blueprint", file)
+		}
+		desired[file] = true
+		changes = append(changes, Change{File: file, Desired: formatMountUnit(mount), Unit: unit})
+	}
+	units, err := filepath.Glob(filepath.Join(c.unitDir, "*"+mountUnitSuffix))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list the mount units")
+	}
+	for _, file := range units {
+		if desired[file] {
+			continue
+		}
+		owned, err := ownedUnit(file)
+		if err != nil {
+			return nil, err
+		}
+		if owned {
+			changes = append(changes, Change{File: file, Unit: filepath.Base(file)})
+		}
+	}
+	return changes, nil
+}
+
+// ownedUnit returns whether the unit in file is missing or was written by
+// the blueprint
+func ownedUnit(file string) (bool, error) {
+	content, err := readFile(file)
+	if err != nil {
+		return false, err
+	}
+	return content == "" || strings.HasPrefix(content, mountUnitMarker+"\n"), nil
+}
+
+// Apply writes the changed files, or removes them when they should not
+// exist. The systemd units that are removed are stopped first, and the
+// ones that are written are enabled and started, or reloaded when they
+// already run.
+func (c *Converger) Apply(ctx context.Context, changes []Change) error {
+	for _, change := range changes {
+		if change.Unit != "" && change.Desired == "" {
+			err := c.systemctl(ctx, "disable", "--now", change.Unit)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	var units []string
+	reload := false
+	for _, change := range changes {
+		if change.Unit != "" {
+			reload = true
+		}
+		if change.Desired == "" {
+			err := os.Remove(change.File)
+			if err != nil && !os.IsNotExist(err) {
+				return errors.Wrapf(err, "could not remove %s", change.File)
+			}
+			hostmanifest.Record(hostmanifest.KindFile, change.File, hostmanifest.Removed)
+			continue
+		}
+		mode := change.Mode
+		if mode == 0 {
+			mode = filePerm
+		}
+		err := writeFile(change.File, change.Desired, mode)
+		if err != nil {
+			return err
+		}
+		hostmanifest.RecordFile(change.File, []byte(change.Desired))
+		if change.Unit != "" {
+			units = append(units, change.Unit)
+		}
+	}
+	if !reload {
+		return nil
+	}
+	err := c.systemctl(ctx, "daemon-reload")
+	if err != nil {
+		return err
+	}
+	for _, unit := range units {
+		err = c.systemctl(ctx, "enable", unit)
+		if err != nil {
+			return err
+		}
+		err = c.systemctl(ctx, "reload-or-restart", unit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Converger) systemctl(ctx context.Context, arg ...string) error {
+	cmd := c.cmdExec.CommandContext(ctx, systemctlExecutable, arg...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Errorf("Error running systemctl %s %v; raw output: %s", strings.Join(arg, " "), err, out)
+		return errors.Wrapf(err, "systemctl %s failed", strings.Join(arg, " "))
+	}
+	return nil
+}
+
+// readFile returns the content of file, or an empty string if it does not
+// exist
+func readFile(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "could not read %s", file)
+	}
+	return string(data), nil
+}
+
+// writeFile replaces file with content through a temp file, so that readers
+// never see it partially written
+func writeFile(file string, content string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(file), dirPerm)
+	if err != nil {
+		return errors.Wrapf(err, "could not create directory of %s", file)
+	}
+	temp := file + ".tmp"
+	err = ioutil.WriteFile(temp, []byte(content), mode)
+	if err != nil {
+		return errors.Wrapf(err, "could not write %s", file)
+	}
+	// the umask may have masked the mode
+	err = os.Chmod(temp, mode)
+	if err != nil {
+		os.Remove(temp)
+		return errors.Wrapf(err, "could not set the mode of %s", file)
+	}
+	err = os.Rename(temp, file)
+	if err != nil {
+		os.Remove(temp)
+		return errors.Wrapf(err, "could not replace %s", file)
+	}
+	return nil
+}
+
+// mergeConfig sets the variables in the content of a config file, keeping
+// the other lines in place and appending new variables in order
+func mergeConfig(current string, variables map[string]string) string {
+	set := make(map[string]bool)
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(current), "\n") {
+		if line == "" {
+			continue
+		}
+		key := strings.TrimSpace(strings.SplitN(line, "=", 2)[0])
+		if value, ok := variables[key]; ok {
+			if set[key] {
+				continue
+			}
+			line = key + "=" + value
+			set[key] = true
+		}
+		lines = append(lines, line)
+	}
+	for _, key := range sortedKeys(variables) {
+		if !set[key] {
+			lines = append(lines, key+"="+variables[key])
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// formatSysctls formats kernel parameters in the format of sysctl.conf
+func formatSysctls(sysctls map[string]string) string {
+	var content strings.Builder
+	for _, key := range sortedKeys(sysctls) {
+		fmt.Fprintf(&content, "%s = %s\n", key, sysctls[key])
+	}
+	return content.String()
+}
+
+// formatMountUnit formats the systemd mount unit of mount, ordered before
+// Docker so that task containers find it mounted
+func formatMountUnit(mount Mount) string {
+	var content strings.Builder
+	fmt.Fprintf(&content, "%s\n[Unit]\nDescription=Host blueprint mount of %s\nBefore=docker.service\n\n", mountUnitMarker, mount.Target)
+	fmt.Fprintf(&content, "[Mount]\nWhat=%s\nWhere=%s\nType=%s\n", mount.Source, mount.Target, mount.Type)
+	if mount.Options != "" {
+		fmt.Fprintf(&content, "Options=%s\n", mount.Options)
+	}
+	content.WriteString("\n[Install]\nWantedBy=multi-user.target\n")
+	return content.String()
+}
+
+// unitName escapes path the way systemd names the units of paths, so that
+// /mnt/efs-data is mnt-efs\x2ddata
+func unitName(path string) string {
+	var name strings.Builder
+	for i, r := range []byte(strings.Trim(path, "/")) {
+		switch {
+		case r == '/':
+			name.WriteByte('-')
+		case r == '.' && i == 0:
+			fmt.Fprintf(&name, `\x%02x`, r)
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			strings.IndexByte(unitNameSafeSpecials, r) >= 0:
+			name.WriteByte(r)
+		default:
+			fmt.Fprintf(&name, `\x%02x`, r)
+		}
+	}
+	return name.String()
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,279 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package blueprint
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBlueprint = `
+agent:
+  version: 1.76.0
+config:
+  ECS_CLUSTER: prod
+attributes:
+  stack: web
+sysctls:
+  net.core.somaxconn: "8192"
+hooks:
+  pre-start:
+    - name: 10-warm-cache
+      script: |
+        #!/bin/sh
+        echo warm
+mounts:
+  - source: fs-12345678.efs.us-west-2.amazonaws.com:/
+    target: /mnt/efs-data
+    type: nfs4
+    options: nfsvers=4.1,_netdev
+netrules:
+  egress: restricted
+  egressAllow: [10.0.0.0/8, registry.example.com]
+  reservedPorts: [8080, 9090]
+`
+
+func newTestConverger(t *testing.T, cmdExec *MockExec) *Converger {
+	dir := t.TempDir()
+	return &Converger{
+		cmdExec:         cmdExec,
+		configFile:      filepath.Join(dir, "var/lib/ecs/ecs.config"),
+		environmentFile: filepath.Join(dir, "etc/ecs/ecs.config"),
+		attributesFile:  filepath.Join(dir, "etc/ecs/attributes.d", attributesFragment),
+		sysctlFile:      filepath.Join(dir, "etc/ecs/sysctl.conf"),
+		hooksDir:        filepath.Join(dir, "etc/ecs/init-hooks"),
+		unitDir:         filepath.Join(dir, "etc/systemd/system"),
+	}
+}
+
+func expectSystemctl(ctrl *gomock.Controller, mockExec *MockExec, arg ...string) *gomock.Call {
+	mockCmd := NewMockCmd(ctrl)
+	mockCmd.EXPECT().CombinedOutput().Return(nil, nil)
+	return mockExec.EXPECT().CommandContext(gomock.Any(), systemctlExecutable, arg).Return(mockCmd)
+}
+
+func writeTestFile(t *testing.T, file string, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), dirPerm))
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), filePerm))
+}
+
+func readTestFile(t *testing.T, file string) string {
+	data, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "blueprint.yaml")
+	writeTestFile(t, file, testBlueprint)
+	blueprint, err := Load(file)
+	require.NoError(t, err)
+	assert.Equal(t, "1.76.0", blueprint.Agent.Version)
+	assert.Equal(t, "prod", blueprint.Config["ECS_CLUSTER"])
+	assert.Equal(t, "web", blueprint.Attributes["stack"])
+	assert.Equal(t, "8192", blueprint.Sysctls["net.core.somaxconn"])
+	assert.Equal(t, []Hook{{Name: "10-warm-cache", Script: "#!/bin/sh\necho warm\n"}}, blueprint.Hooks["pre-start"])
+	assert.Equal(t, []Mount{{Source: "fs-12345678.efs.us-west-2.amazonaws.com:/", Target: "/mnt/efs-data",
+		Type: "nfs4", Options: "nfsvers=4.1,_netdev"}}, blueprint.Mounts)
+	assert.Equal(t, NetRules{Egress: "restricted", EgressAllow: []string{"10.0.0.0/8", "registry.example.com"},
+		ReservedPorts: []int{8080, 9090}}, blueprint.NetRules)
+	assert.Equal(t, map[string]string{
+		"ECS_INIT_AGENT_EGRESS":       "restricted",
+		"ECS_INIT_AGENT_EGRESS_ALLOW": "10.0.0.0/8,registry.example.com",
+	}, blueprint.Environment())
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		blueprint string
+	}{
+		{"unknown section", "volumes: [/data]\n"},
+		{"unknown field", "agent: {release: 1.76.0}\n"},
+		{"unknown hook stage", "hooks: {post-stop: [{name: a, script: 'true'}]}\n"},
+		{"hook without script", "hooks: {pre-start: [{name: a}]}\n"},
+		{"hook name with path", "hooks: {pre-start: [{name: ../a, script: 'true'}]}\n"},
+		{"duplicate hook", "hooks: {pre-start: [{name: a, script: 'true'}, {name: a, script: 'true'}]}\n"},
+		{"relative mount target", "mounts: [{source: /dev/xvdf, target: data, type: ext4}]\n"},
+		{"mount without type", "mounts: [{source: /dev/xvdf, target: /data}]\n"},
+		{"invalid egress", "netrules: {egress: closed}\n"},
+		{"invalid reserved port", "netrules: {reservedPorts: [70000]}\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "blueprint.yaml")
+			writeTestFile(t, file, test.blueprint)
+			_, err := Load(file)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPlanAndApply(t *testing.T) {
+	converger := newTestConverger(t, nil)
+	writeTestFile(t, converger.configFile, "ECS_CLUSTER=dev\nECS_RESERVED_MEMORY=512\n")
+
+	blueprint := &Blueprint{
+		Config:     map[string]string{"ECS_CLUSTER": "prod", "ECS_ENABLE_TASK_ENI": "true"},
+		Attributes: map[string]string{"stack": "web"},
+		Sysctls:    map[string]string{"net.core.somaxconn": "8192", "fs.file-max": "1000000"},
+	}
+	changes, err := converger.Plan(blueprint)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, converger.sysctlFile, changes[0].File)
+	assert.Equal(t, converger.configFile, changes[1].File)
+	assert.Equal(t, "--- "+converger.configFile+"\n+++ "+converger.configFile+"\n"+
+		"-ECS_CLUSTER=dev\n+ECS_CLUSTER=prod\n+ECS_ENABLE_TASK_ENI=true\n+ECS_INIT_ENABLE_SYSCTL_PROFILE=true\n",
+		changes[1].Diff())
+	assert.Equal(t, converger.attributesFile, changes[2].File)
+
+	require.NoError(t, converger.Apply(context.Background(), changes))
+	assert.Equal(t, "ECS_CLUSTER=prod\nECS_RESERVED_MEMORY=512\nECS_ENABLE_TASK_ENI=true\nECS_INIT_ENABLE_SYSCTL_PROFILE=true\n",
+		readTestFile(t, converger.configFile))
+	assert.Equal(t, "fs.file-max = 1000000\nnet.core.somaxconn = 8192\n", readTestFile(t, converger.sysctlFile))
+	assert.Equal(t, `{"stack":"web"}`+"\n", readTestFile(t, converger.attributesFile))
+
+	changes, err = converger.Plan(blueprint)
+	require.NoError(t, err)
+	assert.Empty(t, changes, "Expect applying the blueprint to be idempotent")
+}
+
+func TestPlanRemovesAttributes(t *testing.T) {
+	converger := newTestConverger(t, nil)
+	writeTestFile(t, converger.attributesFile, `{"stack":"web"}`+"\n")
+
+	changes, err := converger.Plan(&Blueprint{})
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "", changes[0].Desired)
+
+	require.NoError(t, converger.Apply(context.Background(), changes))
+	_, err = os.Stat(converger.attributesFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPlanEmptyBlueprint(t *testing.T) {
+	converger := newTestConverger(t, nil)
+
+	changes, err := converger.Plan(&Blueprint{})
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestPlanAgentAndNetRules(t *testing.T) {
+	converger := newTestConverger(t, nil)
+	writeTestFile(t, converger.environmentFile, "ECS_CLUSTER=prod\n")
+
+	changes, err := converger.Plan(&Blueprint{
+		Agent: Agent{Version: "1.76.0"},
+		NetRules: NetRules{
+			Egress:        "restricted",
+			EgressAllow:   []string{"10.0.0.0/8"},
+			ReservedPorts: []int{8080, 9090},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, converger.configFile, changes[0].File)
+	assert.Equal(t, "ECS_AGENT_VERSION=1.76.0\nECS_INIT_RESERVED_PORTS=8080,9090\n", changes[0].Desired)
+	assert.Equal(t, converger.environmentFile, changes[1].File)
+	assert.Equal(t, "ECS_CLUSTER=prod\nECS_INIT_AGENT_EGRESS=restricted\nECS_INIT_AGENT_EGRESS_ALLOW=10.0.0.0/8\n",
+		changes[1].Desired)
+}
+
+func TestPlanAndApplyHooks(t *testing.T) {
+	converger := newTestConverger(t, nil)
+	stageDir := filepath.Join(converger.hooksDir, "pre-start.d")
+	writeTestFile(t, filepath.Join(stageDir, "05-operator"), "#!/bin/sh\n")
+	writeTestFile(t, filepath.Join(stageDir, "20-removed"+hookSuffix), "#!/bin/sh\n")
+
+	blueprint := &Blueprint{Hooks: map[string][]Hook{
+		"pre-start": {{Name: "10-warm-cache", Script: "#!/bin/sh\necho warm\n"}},
+	}}
+	changes, err := converger.Plan(blueprint)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, filepath.Join(stageDir, "10-warm-cache"+hookSuffix), changes[0].File)
+	assert.Equal(t, os.FileMode(hookPerm), changes[0].Mode)
+	assert.Equal(t, filepath.Join(stageDir, "20-removed"+hookSuffix), changes[1].File)
+	assert.Equal(t, "", changes[1].Desired)
+
+	require.NoError(t, converger.Apply(context.Background(), changes))
+	info, err := os.Stat(filepath.Join(stageDir, "10-warm-cache"+hookSuffix))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(hookPerm), info.Mode().Perm())
+	_, err = os.Stat(filepath.Join(stageDir, "20-removed"+hookSuffix))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, "#!/bin/sh\n", readTestFile(t, filepath.Join(stageDir, "05-operator")),
+		"Expect the hooks of the operator to be left alone")
+
+	changes, err = converger.Plan(blueprint)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestPlanAndApplyMounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	converger := newTestConverger(t, mockExec)
+	removedUnit := filepath.Join(converger.unitDir, "mnt-old.mount")
+	writeTestFile(t, removedUnit, mountUnitMarker+"\n[Mount]\nWhere=/mnt/old\n")
+	writeTestFile(t, filepath.Join(converger.unitDir, "mnt-operator.mount"), "[Mount]\nWhere=/mnt/operator\n")
+
+	blueprint := &Blueprint{Mounts: []Mount{{
+		Source: "/dev/nvme1n1", Target: "/mnt/efs-data", Type: "ext4", Options: "noatime",
+	}}}
+	changes, err := converger.Plan(blueprint)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	unit := `mnt-efs\x2ddata.mount`
+	assert.Equal(t, filepath.Join(converger.unitDir, unit), changes[0].File)
+	assert.Equal(t, unit, changes[0].Unit)
+	assert.Contains(t, changes[0].Desired, "What=/dev/nvme1n1\nWhere=/mnt/efs-data\nType=ext4\nOptions=noatime\n")
+	assert.Equal(t, removedUnit, changes[1].File)
+	assert.Equal(t, "", changes[1].Desired)
+
+	gomock.InOrder(
+		expectSystemctl(ctrl, mockExec, "disable", "--now", "mnt-old.mount"),
+		expectSystemctl(ctrl, mockExec, "daemon-reload"),
+		expectSystemctl(ctrl, mockExec, "enable", unit),
+		expectSystemctl(ctrl, mockExec, "reload-or-restart", unit),
+	)
+	require.NoError(t, converger.Apply(context.Background(), changes))
+	_, err = os.Stat(removedUnit)
+	assert.True(t, os.IsNotExist(err))
+
+	changes, err = converger.Plan(blueprint)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestPlanMountOverOperatorUnit(t *testing.T) {
+	converger := newTestConverger(t, nil)
+	writeTestFile(t, filepath.Join(converger.unitDir, "data.mount"), "[Mount]\nWhere=/data\n")
+
+	_, err := converger.Plan(&Blueprint{Mounts: []Mount{{Source: "/dev/xvdf", Target: "/data", Type: "ext4"}}})
+	assert.Error(t, err, "Expect a mount unit of the operator not to be replaced")
+}
@@ -17,20 +17,33 @@ package cache
 
 import (
 	"bufio"
-	"crypto/md5"
+	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/aws/amazon-ecs-init/ecs-init/asyncwriter"
 	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/hashing"
+	"github.com/aws/amazon-ecs-init/ecs-init/imds"
+	"github.com/aws/amazon-ecs-init/ecs-init/metrics"
 
-	"github.com/aws/aws-sdk-go/aws/ec2metadata"
-	"github.com/aws/aws-sdk-go/aws/session"
 	log "github.com/cihub/seelog"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
 )
 
+// ErrChecksumMismatch is wrapped by errors returned when the downloaded agent
+// does not match its published checksum
+var ErrChecksumMismatch = errors.New("downloaded agent does not match expected checksum")
+
 const (
 	orwPerm              = 0700
 	regionalBucketFormat = "%s-%s"
@@ -63,64 +76,170 @@ const (
 type Downloader struct {
 	s3Downloader s3DownloaderAPI
 	fs           fileSystem
+	stateWriter  stateWriter
 	metadata     instanceMetadata
 	region       string
+	httpClient   *http.Client
+	// agentVersion is the version of the agent that is downloaded and
+	// accepted from the cache
+	agentVersion string
+	// state is the cache state, see currentState
+	state *cacheState
+	// offline caches the pre-seeded agent instead of downloading it, see
+	// verifySeededAgent
+	offline bool
+	// verification names the validators a downloaded agent has to pass,
+	// see newValidationPipeline
+	verification []string
+	// availableSpace returns the bytes available on the file system of a
+	// path, see precheckTarball
+	availableSpace func(path string) (int64, error)
 }
 
 // NewDownloader returns a Downloader with default dependencies
 func NewDownloader() (*Downloader, error) {
 	downloader := &Downloader{
-		fs: &standardFS{},
+		fs:           &standardFS{},
+		stateWriter:  asyncwriter.New(),
+		agentVersion: config.AgentVersion(),
 	}
-
-	// If metadata cannot be initialized the region string is populated with the default value to prevent future
-	// calls to retrieve the region from metadata
-	sessionInstance, err := session.NewSession()
+	verification, err := config.AgentVerification()
 	if err != nil {
-		log.Debugf("Got error when initializing session for metadata client: %v. Use default region: %s",
-			err, config.DefaultRegionName)
-		downloader.region = config.DefaultRegionName
-	} else {
-		// metadata is only used for retrieving the user's region
-		downloader.metadata = ec2metadata.New(sessionInstance)
+		return nil, errors.Wrap(err, "failed to initialize downloader")
+	}
+	err = checkVerificationPolicy(verification)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize downloader")
+	}
+	downloader.verification = verification
+	if config.Offline() {
+		// without metadata, the region is resolved from the override or
+		// the persisted region state
+		log.Info("Offline mode, the agent has to be pre-seeded in the cache")
+		downloader.offline = true
+		return downloader, nil
 	}
 
+	// metadata is only used for retrieving the user's region. If it cannot
+	// be reached the region is resolved from the override or the persisted
+	// region state, and is unavailable otherwise
+	downloader.metadata = imds.Shared()
+
+	retryPolicy, err := config.DownloadRetryPolicy()
+	if err != nil {
+		log.Warnf("Retrying downloads up to %d attempts: %v", retryPolicy.MaxAttempts, err)
+	}
 	s3Downloader := &s3Downloader{
 		bucketDownloaders: make([]*s3BucketDownloader, 0),
 		cacheDir:          config.CacheDirectory(),
 		fs:                downloader.fs,
+		retryPolicy:       retryPolicy,
+	}
+
+	// The same client is used for all buckets so that connections are
+	// reused between the checksum and tarball downloads
+	tlsConfig, err := downloadTLSConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize downloader")
+	}
+	httpClient := newHTTPClient(tlsConfig)
+	downloader.httpClient = httpClient
+
+	options := s3OptionsFromConfig()
+	downloadURL, err := config.AgentDownloadURL()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize downloader")
+	}
+	region, err := downloader.getRegion()
+	if err != nil && (downloadURL == nil || downloadURL.Scheme == "s3") {
+		// the actions that do not download the agent do not need the
+		// region, so it fails the downloads instead of the downloader
+		log.Warnf("The agent cannot be downloaded from S3: %v", err)
+		downloader.s3Downloader = &regionUnavailableDownloader{err: err}
+		return downloader, nil
+	}
+	if downloadURL != nil {
+		fetcher, err := newFetcher(downloadURL.Scheme, region, httpClient, options)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize downloader")
+		}
+		log.Infof("Downloading the agent from %s", downloadURL)
+		downloader.s3Downloader = &fetcherDownloader{
+			baseURL:     downloadURL,
+			fetcher:     fetcher,
+			fs:          downloader.fs,
+			cacheDir:    config.CacheDirectory(),
+			retryPolicy: retryPolicy,
+		}
+		return downloader, nil
+	}
+	if bucket := config.AgentBucketOverride(); bucket != "" {
+		bucketDownloader, err := newS3BucketDownloader(region, bucket, httpClient, options)
+		if err != nil {
+			log.Warnf("Failed to initialize downloader for bucket %s: %v", bucket, err)
+		} else {
+			s3Downloader.addBucketDownloader(bucketDownloader)
+		}
+	} else {
+		downloader.addAgentBucketDownloaders(s3Downloader, region, httpClient, options)
+	}
+
+	if len(s3Downloader.bucketDownloaders) == 0 {
+		log.Error("Failed to initialize s3 downloader for either partition bucket or regional bucket. Downloader initialization fails.")
+		return nil, errors.New("failed to initialize downloader")
 	}
 
-	partitionBucketRegion := downloader.getPartitionBucketRegion()
+	downloader.s3Downloader = s3Downloader
+	return downloader, nil
+}
+
+// addAgentBucketDownloaders adds downloaders for the partition bucket of the
+// agent and the regional bucket of the instance region
+func (d *Downloader) addAgentBucketDownloaders(s3Downloader *s3Downloader, region string, httpClient *http.Client, options s3Options) {
+	partitionBucketRegion := getPartitionBucketRegion(region)
 	partitionBucket := config.AgentPartitionBucketName
-	partitionBucketDownloader, err := newS3BucketDownloader(partitionBucketRegion, partitionBucket)
+	partitionBucketOptions := options
+	if partitionBucketRegion != region {
+		// the endpoint is in the region of the instance and cannot serve
+		// a bucket in another region
+		partitionBucketOptions.endpoint = ""
+	}
+	partitionBucketDownloader, err := newS3BucketDownloader(partitionBucketRegion, partitionBucket, httpClient, partitionBucketOptions)
 	if err != nil {
 		log.Warnf("Failed to initialize partition bucket downloader: %v", err)
 	} else {
 		s3Downloader.addBucketDownloader(partitionBucketDownloader)
 	}
 
-	region := downloader.getRegion()
 	regionalBucket := fmt.Sprintf(regionalBucketFormat, partitionBucket, region)
-	regionalBucketDownloader, err := newS3BucketDownloader(region, regionalBucket)
+	regionalBucketDownloader, err := newS3BucketDownloader(region, regionalBucket, httpClient, options)
 	if err != nil {
 		log.Warnf("Failed to initialize regional bucket downloader: %v", err)
 	} else {
 		s3Downloader.addBucketDownloader(regionalBucketDownloader)
 	}
+}
 
-	if len(s3Downloader.bucketDownloaders) == 0 {
-		log.Error("Failed to initialize s3 downloader for either partition bucket or regional bucket. Downloader initialization fails.")
-		return nil, errors.New("failed to initialize downloader")
-	}
+// PinAgentVersion sets the version of the agent that is downloaded and
+// accepted from the cache, overriding the version pinned in the environment
+func (d *Downloader) PinAgentVersion(version string) {
+	d.agentVersion = config.AgentVersionOrDefault(version)
+	log.Infof("Agent version pinned to %s", d.agentVersion)
+}
 
-	downloader.s3Downloader = s3Downloader
-	return downloader, nil
+// version returns the version of the agent that is downloaded
+func (d *Downloader) version() string {
+	if d.agentVersion == "" {
+		return config.DefaultAgentVersion
+	}
+	return d.agentVersion
 }
 
 // AgentCacheStatus inspects the on-disk cache and returns its
 // status. See `CacheStatus` for possible cache statuses and
-// scenarios.
+// scenarios. A cached agent of another version than the one pinned is
+// reported as uncached, so that the pinned version is downloaded, unless the
+// cached agent was rolled back to from the pinned version.
 func (d *Downloader) AgentCacheStatus() CacheStatus {
 	stateFile := config.CacheState()
 	// State file and tarball must be non-zero to report status on
@@ -128,17 +247,26 @@ func (d *Downloader) AgentCacheStatus() CacheStatus {
 	if uncached {
 		return StatusUncached
 	}
-
-	file, err := d.fs.Open(stateFile)
-	if err != nil {
+	state := d.currentState()
+	if state.Status == StatusUncached {
 		return StatusUncached
 	}
-	var status CacheStatus
-	_, err = fmt.Fscanf(file, "%d", &status)
-	if err != nil {
+	cached := d.CachedAgent()
+	if cached.Arch != "" && cached.Arch != config.AgentArch() {
+		log.Infof("Cached agent %s is for architecture %s, not %s", cached.Version, cached.Arch, config.AgentArch())
 		return StatusUncached
 	}
-	return status
+	cachedVersion := cached.Version
+	if cachedVersion == d.version() {
+		return state.Status
+	}
+	rollback := state.Rollback
+	if rollback != nil && rollback.From == d.version() && rollback.To == cachedVersion {
+		log.Infof("Keeping cached agent %s, which was rolled back to from %s", cachedVersion, d.version())
+		return state.Status
+	}
+	log.Infof("Cached agent version %s is not version %s", cachedVersion, d.version())
+	return StatusUncached
 }
 
 // IsAgentCached returns true if there is a cached copy of the Agent present
@@ -160,49 +288,118 @@ func (d *Downloader) fileNotEmpty(filename string) bool {
 	return fileinfo.Size() > 0
 }
 
-// getRegion finds region from metadata and caches for the life of downloader
-func (d *Downloader) getRegion() string {
-	if d.region != "" {
-		return d.region
+// getPartitionBucketRegion returns a region that contains the agent's bucket
+func getPartitionBucketRegion(region string) string {
+	destination, err := config.GetAgentPartitionBucketRegion(region)
+	if err != nil {
+		log.Warnf("Current region not supported, using the default region (%s) for downloader, err: %v", config.DefaultRegionName, err)
+		return config.DefaultRegionName
 	}
 
-	region, err := d.metadata.Region()
+	return destination
+}
+
+// newAgentDigest returns the SHA-256 digest of a download of the Agent,
+// computed with the configured backend on a worker unless pipelined hashing
+// is disabled
+func newAgentDigest() hash.Hash {
+	backend, err := hashing.SHA256(config.SHA256Backend())
 	if err != nil {
-		log.Warn("Could not retrieve the region from EC2 Instance Metadata. Error: %s", err.Error())
-		region = config.DefaultRegionName
+		log.Warnf("Hashing downloads with the %s backend: %v", backend.Name, err)
+	}
+	log.Debugf("Hashing downloads with the %s backend (hardware accelerated: %t)", backend.Name, backend.Accelerated())
+	digest := backend.New()
+	if config.PipelinedHashing() {
+		digest = hashing.NewPipelined(digest)
 	}
-	d.region = region
+	return digest
+}
 
-	return d.region
+// DownloadAgent downloads a copy of the Agent and verifies the SHA-256 sum
+// and signature of the downloaded image. The download stops once ctx is done,
+// keeping the partial file to resume from.
+func (d *Downloader) DownloadAgent(ctx context.Context) error {
+	if d.offline {
+		return d.verifySeededAgent()
+	}
+	return d.downloadAgent(ctx, newAgentDigest())
 }
 
-// getBucketRegion returns a region that contains the agent's bucket
-func (d *Downloader) getPartitionBucketRegion() string {
-	region := d.getRegion()
+// StreamAgent downloads the Agent like DownloadAgent while streaming the
+// tarball into load, e.g. to load it into Docker without reading it back from
+// the cache. The end of the tarball is held back until it is verified, and
+// the stream fails instead if the download does not verify. The returned
+// error is that of the download; loaded is false when load failed, or when
+// the tarball could not be streamed as its parts were not downloaded in
+// order, in which case the cached tarball has to be loaded instead.
+func (d *Downloader) StreamAgent(ctx context.Context, load func(io.Reader) error) (loaded bool, err error) {
+	if d.offline {
+		return false, d.verifySeededAgent()
+	}
+	reader, writer := io.Pipe()
+	stream := newStreamDigest(newAgentDigest(), writer)
+	loadResult := make(chan error, 1)
+	go func() {
+		err := load(reader)
+		// drain what load left unread so that the download is not blocked
+		io.Copy(ioutil.Discard, reader)
+		loadResult <- err
+	}()
 
-	destination, err := config.GetAgentPartitionBucketRegion(region)
+	err = d.downloadAgent(ctx, stream)
 	if err != nil {
-		log.Warnf("Current region not supported, using the default region (%s) for downloader, err: %v", config.DefaultRegionName, err)
-		return config.DefaultRegionName
+		stream.fail(err)
+	} else if serr := stream.commit(); serr != nil {
+		log.Warnf("Could not stream the Agent while downloading it: %v", serr)
 	}
-
-	return destination
+	loadErr := <-loadResult
+	if err != nil {
+		return false, err
+	}
+	if loadErr != nil {
+		log.Warnf("Could not load the Agent while downloading it: %v", loadErr)
+		return false, nil
+	}
+	return true, nil
 }
 
-// DownloadAgent downloads a copy of the Agent and performs an
-// integrity check of the downloaded image
-func (d *Downloader) DownloadAgent() error {
-	err := d.fs.MkdirAll(config.CacheDirectory(), os.ModeDir|orwPerm)
+// downloadAgent downloads the Agent, computing its SHA-256 sum with
+// sha256hash
+func (d *Downloader) downloadAgent(ctx context.Context, sha256hash hash.Hash) (err error) {
+	metrics.AgentDownloads.Inc()
+	defer func() {
+		if err != nil {
+			metrics.AgentDownloadFailures.Inc()
+		}
+	}()
+	defer d.closeIdleConnections()
+	err = d.fs.MkdirAll(config.CacheDirectory(), os.ModeDir|orwPerm)
 	if err != nil {
 		return err
 	}
 
-	publishedMd5Sum, err := d.getPublishedMd5Sum()
+	agentTarballName, err := config.AgentRemoteTarballKey(d.version())
+	if err != nil {
+		return errors.Wrap(err, "failed to determine download tarball")
+	}
+	pipeline, err := d.newValidationPipeline()
+	if err != nil {
+		return err
+	}
+	err = pipeline.prepare(ctx, &publishedFiles{downloader: d, tarballKey: agentTarballName})
+	if err != nil {
+		return err
+	}
+	err = d.precheckTarball(ctx, agentTarballName, pipeline)
 	if err != nil {
 		return err
 	}
 
-	tempFileName, err := d.getPublishedTarball()
+	// The tarball is hashed while it is written to the partial file, which
+	// avoids reading it back before it is moved into the cache. A partial
+	// file left by a failed download is kept to resume from, while one that
+	// does not match the published checksum is removed.
+	tempFileName, sourceURL, err := d.getPublishedTarball(ctx, sha256hash)
 	if err != nil {
 		return err
 	}
@@ -214,72 +411,126 @@ func (d *Downloader) DownloadAgent() error {
 		}
 	}()
 
-	publishedTarballReader, err := d.fs.Open(tempFileName)
+	calculatedSHA256Sum := sha256hash.Sum(nil)
+	calculatedChecksum := hex.EncodeToString(calculatedSHA256Sum)
+	err = pipeline.validate(ctx, &Artifact{
+		Version:   d.version(),
+		Name:      agentTarballName,
+		File:      tempFileName,
+		SHA256:    calculatedSHA256Sum,
+		SourceURL: sourceURL,
+	})
 	if err != nil {
 		return err
 	}
-	defer publishedTarballReader.Close()
 
-	md5hash := md5.New()
-	_, err = d.fs.Copy(md5hash, publishedTarballReader)
+	d.archiveCachedAgent()
+	log.Debugf("Attempting to rename %s to %s", tempFileName, config.AgentTarball())
+	err = d.fs.Rename(tempFileName, config.AgentTarball())
+	if err != nil {
+		return err
+	}
+	// the downloaded agent takes precedence over the loaded image until it
+	// is loaded and recorded as cached
+	err = d.writeCacheState(&cacheState{
+		Status: StatusReloadNeeded,
+		Agent: &CachedAgent{
+			Version:      d.version(),
+			Arch:         config.AgentArch(),
+			SHA256:       calculatedChecksum,
+			DownloadedAt: time.Now().UTC(),
+			SourceURL:    sourceURL,
+		},
+	})
 	if err != nil {
 		return err
 	}
+	// sync the rename before the cache state can record the tarball as cached
+	return d.fs.Sync(config.CacheDirectory())
+}
 
-	calculatedMd5Sum := md5hash.Sum(nil)
-	calculatedMd5SumString := fmt.Sprintf("%x", calculatedMd5Sum)
-	log.Debugf("Expected MD5 %q", publishedMd5Sum)
-	log.Debugf("Calculated MD5 %q", calculatedMd5SumString)
-	if publishedMd5Sum != calculatedMd5SumString {
-		agentTarballName, err := config.AgentRemoteTarballKey()
-		if err != nil {
-			return errors.New("downloaded agent does not match expected checksum")
-		}
-		return errors.Errorf("downloaded agent %q does not match expected checksum", agentTarballName)
+// closeIdleConnections releases the connections kept alive for reuse between
+// the checksum and tarball downloads, as ecs-init may keep running to
+// supervise the Agent long after the download
+func (d *Downloader) closeIdleConnections() {
+	if d.httpClient != nil {
+		d.httpClient.CloseIdleConnections()
 	}
+}
 
-	log.Debugf("Attempting to rename %s to %s", tempFileName, config.AgentTarball())
-	return d.fs.Rename(tempFileName, config.AgentTarball())
+// loadSigningKey reads the PGP public key that signs the published tarball,
+// which is installed along with ecs-init
+func (d *Downloader) loadSigningKey() (openpgp.EntityList, error) {
+	keyFile, err := d.fs.Open(config.AgentSigningKeyFile())
+	if os.IsNotExist(err) {
+		return nil, errors.Errorf("no agent signing key is installed at %s", config.AgentSigningKeyFile())
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open agent signing key")
+	}
+	defer keyFile.Close()
+	data, err := d.fs.ReadAll(keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read agent signing key")
+	}
+	key, err := parseSigningKey(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid agent signing key %s", config.AgentSigningKeyFile())
+	}
+	return key, nil
 }
 
-func (d *Downloader) getPublishedMd5Sum() (string, error) {
-	objectKey, err := config.AgentRemoteTarballMD5Key()
+func (d *Downloader) getPublishedChecksum(ctx context.Context) (string, error) {
+	objectKey, err := config.AgentRemoteTarballSHA256Key(d.version())
 	if err != nil {
-		return "", errors.Wrap(err, "failed to determine md5 file for download")
+		return "", errors.Wrap(err, "failed to determine checksum file for download")
 	}
-	tempMd5FileName, err := d.s3Downloader.downloadFile(objectKey)
+	body, err := d.getPublishedFile(ctx, objectKey, "checksum")
+	if err != nil {
+		return "", err
+	}
+	return parseChecksum(body)
+}
+
+// getPublishedFile downloads the small file published next to the tarball
+// and returns its contents
+func (d *Downloader) getPublishedFile(ctx context.Context, objectKey string, description string) ([]byte, error) {
+	tempFileName, _, err := d.s3Downloader.downloadFile(ctx, objectKey, nil)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to download md5 file for published tarball")
+		// the error keeps its class, e.g. an unavailable region
+		return nil, fmt.Errorf("failed to download %s file for published tarball: %w", description, err)
 	}
 
-	tempMd5File, err := d.fs.Open(tempMd5FileName)
+	tempFile, err := d.fs.Open(tempFileName)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to open temporary md5 file")
+		return nil, errors.Wrapf(err, "failed to open temporary %s file", description)
 	}
 	defer func() { // clean up temp file
-		log.Debugf("Removing temp file %s", tempMd5FileName)
-		d.fs.Remove(tempMd5FileName)
+		tempFile.Close()
+		log.Debugf("Removing temp file %s", tempFileName)
+		d.fs.Remove(tempFileName)
 	}()
 
-	body, err := d.fs.ReadAll(tempMd5File)
+	body, err := d.fs.ReadAll(tempFile)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to read from temporary md5 file")
+		return nil, errors.Wrapf(err, "failed to read from temporary %s file", description)
 	}
-
-	return strings.TrimSpace(string(body)), nil
+	return body, nil
 }
 
-func (d *Downloader) getPublishedTarball() (string, error) {
-	objectKey, err := config.AgentRemoteTarballKey()
+// getPublishedTarball downloads the tarball and returns the temporary file
+// it was downloaded to and where it was downloaded from
+func (d *Downloader) getPublishedTarball(ctx context.Context, digest hash.Hash) (string, string, error) {
+	objectKey, err := config.AgentRemoteTarballKey(d.version())
 	if err != nil {
-		return "", errors.Wrap(err, "failed to determine download tarball")
+		return "", "", errors.Wrap(err, "failed to determine download tarball")
 	}
-	tempAgentFileName, err := d.s3Downloader.downloadFile(objectKey)
+	tempAgentFileName, sourceURL, err := d.s3Downloader.downloadFile(ctx, objectKey, digest)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to download published tarball")
+		return "", "", fmt.Errorf("failed to download published tarball: %w", err)
 	}
 
-	return tempAgentFileName, nil
+	return tempAgentFileName, sourceURL, nil
 }
 
 // LoadCachedAgent returns an io.ReadCloser of the Agent from the cache
@@ -289,10 +540,26 @@ func (d *Downloader) LoadCachedAgent() (io.ReadCloser, error) {
 
 // RecordCachedAgent writes the StatusCached state to disk to record a newly
 // cached or loaded agent image; this prevents StatusReloadNeeded from
-// being interpreted after the reload.
+// being interpreted after the reload. The cached agent and a rollback of it
+// are kept in the state. The state is written in the background; should it
+// be lost, the cached image is only reloaded again.
 func (d *Downloader) RecordCachedAgent() error {
-	data := []byte(fmt.Sprintf("%d", StatusCached))
-	return d.fs.WriteFile(config.CacheState(), data, orwPerm)
+	previous := d.currentState()
+	d.state = &cacheState{
+		Status:   StatusCached,
+		Agent:    previous.Agent,
+		Rollback: previous.Rollback,
+	}
+	data, err := json.Marshal(d.state)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the cache state")
+	}
+	return d.stateWriter.WriteFile(config.CacheState(), data, orwPerm)
+}
+
+// Flush waits for state written in the background to be persisted
+func (d *Downloader) Flush() error {
+	return d.stateWriter.Flush()
 }
 
 // LoadDesiredAgent returns an io.ReadCloser of the Agent indicated by the desiredImageLocatorFile
@@ -307,17 +574,39 @@ func (d *Downloader) LoadDesiredAgent() (io.ReadCloser, error) {
 	return d.fs.Open(desiredImageFile)
 }
 
+// DesiredAgentFile returns the location on disk of the Agent image indicated by the desiredImageLocatorFile
+func (d *Downloader) DesiredAgentFile() (string, error) {
+	return d.getDesiredImageFile()
+}
+
+// StandbyAgentFile returns the location on disk of the Agent image indicated by the standbyImageLocatorFile
+// (/var/cache/ecs/standby-image). The standbyImageLocatorFile follows the format of the desiredImageLocatorFile and
+// may be written ahead of an upgrade so that the image is loaded into Docker while the current Agent is running.
+func (d *Downloader) StandbyAgentFile() (string, error) {
+	return d.getImageFile(config.StandbyImageLocatorFile())
+}
+
+// LoadAgentFile returns an io.ReadCloser of the Agent image at the location returned by DesiredAgentFile or
+// StandbyAgentFile
+func (d *Downloader) LoadAgentFile(file string) (io.ReadCloser, error) {
+	return d.fs.Open(file)
+}
+
 func (d *Downloader) getDesiredImageFile() (string, error) {
-	file, err := d.fs.Open(config.DesiredImageLocatorFile())
+	return d.getImageFile(config.DesiredImageLocatorFile())
+}
+
+func (d *Downloader) getImageFile(locatorFile string) (string, error) {
+	file, err := d.fs.Open(locatorFile)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 	reader := bufio.NewReader(file)
-	desiredImageString, err := reader.ReadString('\n')
+	imageString, err := reader.ReadString('\n')
 	if err != nil {
 		return "", err
 	}
-	desiredImageFile := strings.TrimSpace(config.CacheDirectory() + "/" + d.fs.Base(desiredImageString))
-	return desiredImageFile, nil
+	imageFile := strings.TrimSpace(config.CacheDirectory() + "/" + d.fs.Base(imageString))
+	return imageFile, nil
 }
@@ -15,33 +15,52 @@ package cache
 
 import (
 	"bytes"
-	"crypto/md5"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
 	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/metrics"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+const tarballContents = "tarball contents"
+
 var (
-	remoteTarballKey    string
-	remoteTarballMD5Key string
+	remoteTarballKey          string
+	remoteTarballSHA256Key    string
+	remoteTarballSignatureKey string
 )
 
 func init() {
 	// Load up the architecture's S3 tarball key for use in this
 	// package's tests; unconfigured architectures will result in
 	// failing tests.
-	agentS3Key, err := config.AgentRemoteTarballKey()
+	agentS3Key, err := config.AgentRemoteTarballKey(config.DefaultAgentVersion)
 	if err == nil {
 		remoteTarballKey = agentS3Key
-		remoteTarballMD5Key, _ = config.AgentRemoteTarballMD5Key()
+		remoteTarballSHA256Key, _ = config.AgentRemoteTarballSHA256Key(config.DefaultAgentVersion)
+		remoteTarballSignatureKey, _ = config.AgentRemoteTarballSignatureKey(config.DefaultAgentVersion)
 	} else {
 		log.Println("Warning: this architecture does not support downloading of agent")
 	}
@@ -124,10 +143,16 @@ func TestAgentCacheStatus(t *testing.T) {
 		{"1", StatusCached},
 		{"2", StatusReloadNeeded},
 		{"1\n", StatusCached},
+		{`{"status": 1}`, StatusCached},
+		{`{"status": 2, "agent": {"version": "` + config.DefaultAgentVersion + `"}}`, StatusReloadNeeded},
+		{`{"status": 1, "agent": {"version": "` + config.DefaultAgentVersion + `", "arch": "` + config.AgentArch() + `"}}`, StatusCached},
+		// Agent downloaded for another architecture:
+		{`{"status": 1, "agent": {"version": "` + config.DefaultAgentVersion + `", "arch": "mips"}}`, StatusUncached},
 		// Invalid states:
 		{"spurious", StatusUncached},
 		{" ", StatusUncached},
 		{"256", StatusUncached},
+		{`{"status": "cached"}`, StatusUncached},
 	}
 
 	for _, testcase := range cases {
@@ -152,9 +177,107 @@ func TestAgentCacheStatus(t *testing.T) {
 	}
 }
 
-func TestGetPartitionBucketRegion(t *testing.T) {
-	d := &Downloader{}
+// expectCachedAgent expects a cached agent with status and the recorded
+// version, if any
+func expectCachedAgent(mockCtrl *gomock.Controller, mockFS *MockfileSystem, status CacheStatus, version string) {
+	mockFSInfo := NewMockfileSizeInfo(mockCtrl)
+	mockFSInfo.EXPECT().Size().Return(int64(1)).AnyTimes()
+	mockFS.EXPECT().Stat(config.CacheState()).Return(mockFSInfo, nil)
+	mockFS.EXPECT().Stat(config.AgentTarball()).Return(mockFSInfo, nil)
+	state := fmt.Sprintf("%d", status)
+	if version != "" {
+		state = fmt.Sprintf(`{"status": %d, "agent": {"version": %q}}`, status, version)
+	}
+	mockFS.EXPECT().Open(config.CacheState()).Return(ioutil.NopCloser(bytes.NewBufferString(state)), nil)
+}
+
+func TestAgentCacheStatusPinnedVersionCached(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	expectCachedAgent(mockCtrl, mockFS, StatusCached, "v1.76.0")
+
+	d := &Downloader{fs: mockFS}
+	d.PinAgentVersion("1.76.0")
+	assert.Equal(t, StatusCached, d.AgentCacheStatus())
+}
+
+func TestAgentCacheStatusPinnedVersionNotCached(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	expectCachedAgent(mockCtrl, mockFS, StatusCached, "")
 
+	d := &Downloader{fs: mockFS}
+	d.PinAgentVersion("1.76.0")
+	assert.Equal(t, StatusUncached, d.AgentCacheStatus(), "Expect the default version to not satisfy the pinned version")
+}
+
+func TestAgentCacheStatusUnpinnedVersion(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	expectCachedAgent(mockCtrl, mockFS, StatusCached, "v1.76.0")
+
+	d := &Downloader{fs: mockFS}
+	assert.Equal(t, StatusUncached, d.AgentCacheStatus(), "Expect a previously pinned version to be replaced by the default")
+}
+
+func TestAgentCacheStatusPackagedAgentReplacesPinnedVersion(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	expectCachedAgent(mockCtrl, mockFS, StatusReloadNeeded, "")
+
+	d := &Downloader{fs: mockFS}
+	d.PinAgentVersion("1.76.0")
+	assert.Equal(t, StatusUncached, d.AgentCacheStatus())
+}
+
+func TestDownloadAgentPinnedVersion(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	pinnedTarballKey, _ := config.AgentRemoteTarballKey("v1.76.0")
+	signingKey, publicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	d.PinAgentVersion("1.76.0")
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, publicKey),
+		expectPublishedFile(mockFS, mockS3Downloader, pinnedTarballKey+".sha256", checksumOf(tarballContents)),
+		expectPublishedFile(mockFS, mockS3Downloader, pinnedTarballKey+".asc", sign(t, signingKey, tarballContents)),
+		expectDescribedTarball(mockFS, mockS3Downloader, pinnedTarballKey),
+		[]*gomock.Call{
+			mockS3Downloader.EXPECT().downloadFile(gomock.Any(), pinnedTarballKey, gomock.Any()).Do(func(ctx context.Context, fileName string, digest hash.Hash) {
+				digest.Write([]byte(tarballContents))
+			}).Return("/tmp/agent", "s3://bucket/"+pinnedTarballKey, nil),
+			expectReadTarball(mockFS, "/tmp/agent", tarballContents),
+			// no agent was cached before
+			mockFS.EXPECT().Stat(config.AgentTarball()).Return(nil, os.ErrNotExist),
+			mockFS.EXPECT().Rename("/tmp/agent", config.AgentTarball()),
+			expectCacheState(t, mockFS, &cacheState{
+				Status: StatusReloadNeeded,
+				Agent: &CachedAgent{
+					Version:   "v1.76.0",
+					Arch:      config.AgentArch(),
+					SHA256:    string(checksumOf(tarballContents)),
+					SourceURL: "s3://bucket/" + pinnedTarballKey,
+				},
+			}),
+			mockFS.EXPECT().Sync(config.CacheDirectory()),
+			mockFS.EXPECT().Stat("/tmp/agent").Return(nil, errors.New("temp file has been renamed")),
+		},
+	)
+
+	assert.NoError(t, d.DownloadAgent(context.Background()))
+}
+
+func TestGetPartitionBucketRegion(t *testing.T) {
 	var cases = []struct {
 		region         string
 		expectedResult string
@@ -166,13 +289,50 @@ func TestGetPartitionBucketRegion(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.region, func(t *testing.T) {
-			d.region = c.region
-			result := d.getPartitionBucketRegion()
+			result := getPartitionBucketRegion(c.region)
 			assert.Equal(t, c.expectedResult, result, "expected getPartitionBucketRegion to give result %s", result)
 		})
 	}
 }
 
+func TestS3OptionsAWSConfig(t *testing.T) {
+	cfg := s3Options{}.awsConfig("us-west-2", nil)
+	assert.Equal(t, credentials.AnonymousCredentials, cfg.Credentials, "Expect anonymous requests by default")
+	assert.Nil(t, cfg.Endpoint)
+
+	endpoint := "https://bucket.vpce-1234.s3.us-west-2.vpce.amazonaws.com"
+	cfg = s3Options{endpoint: endpoint, authenticated: true}.awsConfig("us-west-2", nil)
+	assert.Nil(t, cfg.Credentials, "Expect the default credentials of the instance")
+	assert.Equal(t, endpoint, aws.StringValue(cfg.Endpoint))
+	assert.True(t, aws.BoolValue(cfg.S3ForcePathStyle))
+}
+
+func TestAddAgentBucketDownloaders(t *testing.T) {
+	endpoint := "https://bucket.vpce-1234.s3.us-west-2.vpce.amazonaws.com"
+	d := &Downloader{region: "us-west-2"}
+	s3Downloader := &s3Downloader{}
+	d.addAgentBucketDownloaders(s3Downloader, d.region, nil, s3Options{endpoint: endpoint, concurrency: 4})
+
+	assert.Len(t, s3Downloader.bucketDownloaders, 2)
+	partitionBucket := s3Downloader.bucketDownloaders[0]
+	assert.Equal(t, config.AgentPartitionBucketName, partitionBucket.bucket)
+	assert.Equal(t, config.DefaultRegionName, partitionBucket.region)
+	assert.NotEqual(t, endpoint, s3Endpoint(t, partitionBucket), "Expect the endpoint to only serve the instance region")
+
+	regionalBucket := s3Downloader.bucketDownloaders[1]
+	assert.Equal(t, config.AgentPartitionBucketName+"-us-west-2", regionalBucket.bucket)
+	assert.Equal(t, endpoint, s3Endpoint(t, regionalBucket))
+	assert.Equal(t, 4, regionalBucket.client.(*s3manager.Downloader).Concurrency)
+}
+
+func s3Endpoint(t *testing.T, bucketDownloader *s3BucketDownloader) string {
+	downloader, ok := bucketDownloader.client.(*s3manager.Downloader)
+	require.True(t, ok)
+	client, ok := downloader.S3.(*s3.S3)
+	require.True(t, ok)
+	return client.Endpoint
+}
+
 func TestDownloadAgentMkdirFailure(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -190,229 +350,256 @@ func TestDownloadAgentMkdirFailure(t *testing.T) {
 		region:       config.DefaultRegionName,
 	}
 
-	d.DownloadAgent()
+	downloads, failures := metrics.AgentDownloads.Value(), metrics.AgentDownloadFailures.Value()
+	d.DownloadAgent(context.Background())
+	assert.Equal(t, uint64(1), metrics.AgentDownloads.Value()-downloads)
+	assert.Equal(t, uint64(1), metrics.AgentDownloadFailures.Value()-failures)
 }
 
-func TestDownloadAgentDownloadMD5Failure(t *testing.T) {
-	mockCtrl := gomock.NewController(t)
-	defer mockCtrl.Finish()
-
-	mockFS := NewMockfileSystem(mockCtrl)
-	mockS3Downloader := NewMocks3DownloaderAPI(mockCtrl)
-	mockMetadata := NewMockinstanceMetadata(mockCtrl)
-
-	gomock.InOrder(
-		mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700),
-		mockS3Downloader.EXPECT().downloadFile(remoteTarballMD5Key).Return("", errors.New("test error")),
-	)
+// expectSigningKey expects the agent signing key to be read
+func expectSigningKey(mockFS *MockfileSystem, key []byte) []*gomock.Call {
+	keyFile := ioutil.NopCloser(&bytes.Buffer{})
+	return []*gomock.Call{
+		mockFS.EXPECT().Open(config.AgentSigningKeyFile()).Return(keyFile, nil),
+		mockFS.EXPECT().ReadAll(keyFile).Return(key, nil),
+	}
+}
 
-	d := &Downloader{
-		s3Downloader: mockS3Downloader,
-		fs:           mockFS,
-		metadata:     mockMetadata,
-		region:       config.DefaultRegionName,
+// expectPublishedFile expects the file published next to the tarball under
+// objectKey to be downloaded and read
+func expectPublishedFile(mockFS *MockfileSystem, mockS3Downloader *Mocks3DownloaderAPI, objectKey string, contents []byte) []*gomock.Call {
+	tempFileName := "/tmp/" + objectKey
+	tempFile := ioutil.NopCloser(&bytes.Buffer{})
+	return []*gomock.Call{
+		mockS3Downloader.EXPECT().downloadFile(gomock.Any(), objectKey, nil).Return(tempFileName, "s3://bucket/"+objectKey, nil),
+		mockFS.EXPECT().Open(tempFileName).Return(tempFile, nil),
+		mockFS.EXPECT().ReadAll(tempFile).Return(contents, nil),
+		mockFS.EXPECT().Remove(tempFileName),
 	}
+}
 
-	d.DownloadAgent()
+// expectDescribedTarball expects the tarball of tarballKey to be described
+// and fit in the cache before it is downloaded
+func expectDescribedTarball(mockFS *MockfileSystem, mockS3Downloader *Mocks3DownloaderAPI, tarballKey string) []*gomock.Call {
+	return []*gomock.Call{
+		mockS3Downloader.EXPECT().describeFile(gomock.Any(), tarballKey).Return(publishedObject{Size: int64(len(tarballContents))}, nil),
+		mockFS.EXPECT().Stat(filepath.Join(config.CacheDirectory(), tarballKey+partialFileSuffix)).Return(nil, os.ErrNotExist),
+	}
 }
 
-func TestDownloadAgentReadPublishedMd5Failure(t *testing.T) {
-	mockCtrl := gomock.NewController(t)
-	defer mockCtrl.Finish()
+// expectPublishedTarball expects the tarball to be downloaded with contents
+func expectPublishedTarball(mockS3Downloader *Mocks3DownloaderAPI, tempFileName string, contents string) *gomock.Call {
+	return mockS3Downloader.EXPECT().downloadFile(gomock.Any(), remoteTarballKey, gomock.Any()).Do(func(ctx context.Context, fileName string, digest hash.Hash) {
+		digest.Write([]byte(contents))
+	}).Return(tempFileName, "s3://bucket/"+remoteTarballKey, nil)
+}
 
-	mockFS := NewMockfileSystem(mockCtrl)
-	mockS3Downloader := NewMocks3DownloaderAPI(mockCtrl)
-	mockMetadata := NewMockinstanceMetadata(mockCtrl)
+// expectReadTarball expects the downloaded tarball to be read back with
+// contents, as its signature covers the tarball itself
+func expectReadTarball(mockFS *MockfileSystem, tempFileName string, contents string) *gomock.Call {
+	return mockFS.EXPECT().Open(tempFileName).Return(ioutil.NopCloser(strings.NewReader(contents)), nil)
+}
 
-	tempMD5File, err := ioutil.TempFile("", "md5-test")
-	assert.NoError(t, err, "Expect to successfully create a temporary file")
-	defer tempMD5File.Close()
+// expectCacheState expects the cache state to be written right away as
+// expected, apart from the download time
+func expectCacheState(t *testing.T, mockFS *MockfileSystem, expected *cacheState) *gomock.Call {
+	return mockFS.EXPECT().WriteFile(config.CacheState(), gomock.Any(), os.FileMode(0700)).Do(
+		func(name string, data []byte, perm os.FileMode) {
+			state, err := parseCacheState(data)
+			require.NoError(t, err)
+			if state.Agent != nil && expected.Agent != nil && expected.Agent.SHA256 != "" {
+				assert.WithinDuration(t, time.Now(), state.Agent.DownloadedAt, time.Minute)
+				state.Agent.DownloadedAt = expected.Agent.DownloadedAt
+			}
+			assert.Equal(t, expected, state)
+		})
+}
 
-	gomock.InOrder(
-		mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700),
-		mockS3Downloader.EXPECT().downloadFile(remoteTarballMD5Key).Return(tempMD5File.Name(), nil),
-		mockFS.EXPECT().Open(tempMD5File.Name()).Return(tempMD5File, nil),
-		mockFS.EXPECT().ReadAll(tempMD5File).Return(nil, errors.New("test error")),
-		mockFS.EXPECT().Remove(tempMD5File.Name()),
-	)
+func inOrder(calls ...[]*gomock.Call) {
+	var all []*gomock.Call
+	for _, c := range calls {
+		all = append(all, c...)
+	}
+	gomock.InOrder(all...)
+}
 
-	d := &Downloader{
+func newTestDownloader(mockCtrl *gomock.Controller) (*Downloader, *MockfileSystem, *Mocks3DownloaderAPI) {
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockS3Downloader := NewMocks3DownloaderAPI(mockCtrl)
+	return &Downloader{
 		s3Downloader: mockS3Downloader,
 		fs:           mockFS,
-		metadata:     mockMetadata,
+		metadata:     NewMockinstanceMetadata(mockCtrl),
 		region:       config.DefaultRegionName,
-	}
-
-	d.DownloadAgent()
+		verification: []string{"sha256", "signature"},
+		availableSpace: func(string) (int64, error) {
+			return 1 << 30, nil
+		},
+	}, mockFS, mockS3Downloader
 }
 
-func TestDownloadAgentDownloadTarballFailure(t *testing.T) {
+func TestDownloadAgentSigningKeyMissing(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
-	md5sum := "md5sum"
-
-	mockFS := NewMockfileSystem(mockCtrl)
-	mockS3Downloader := NewMocks3DownloaderAPI(mockCtrl)
-	mockMetadata := NewMockinstanceMetadata(mockCtrl)
-
-	tempMD5File, err := ioutil.TempFile("", "md5-test")
-	assert.NoError(t, err, "Expect to successfully create a temporary file")
-	defer tempMD5File.Close()
-
-	tempAgentFile, err := ioutil.TempFile("", "agent-test")
-	assert.NoError(t, err, "Expect to successfully create a temporary file")
-	defer tempAgentFile.Close()
-
+	d, mockFS, _ := newTestDownloader(mockCtrl)
 	gomock.InOrder(
 		mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700),
-		mockS3Downloader.EXPECT().downloadFile(remoteTarballMD5Key).Return(tempMD5File.Name(), nil),
-		mockFS.EXPECT().Open(tempMD5File.Name()).Return(tempMD5File, nil),
-		mockFS.EXPECT().ReadAll(tempMD5File).Return([]byte(md5sum), nil),
-		mockFS.EXPECT().Remove(tempMD5File.Name()),
-		mockS3Downloader.EXPECT().downloadFile(remoteTarballKey).Return("", errors.New("test error")),
+		mockFS.EXPECT().Open(config.AgentSigningKeyFile()).Return(nil, errors.New("test error")),
 	)
 
-	d := &Downloader{
-		s3Downloader: mockS3Downloader,
-		fs:           mockFS,
-		metadata:     mockMetadata,
-		region:       config.DefaultRegionName,
-	}
-
-	d.DownloadAgent()
+	assert.Error(t, d.DownloadAgent(context.Background()))
 }
 
-func TestDownloadAgentCopyFailure(t *testing.T) {
+func TestLoadSigningKeyNotInstalled(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
-	md5sum := "md5sum"
-
-	mockFS := NewMockfileSystem(mockCtrl)
-	mockS3Downloader := NewMocks3DownloaderAPI(mockCtrl)
-	mockMetadata := NewMockinstanceMetadata(mockCtrl)
-
-	tempMD5File, err := ioutil.TempFile("", "md5-test")
-	assert.NoError(t, err, "Expect to successfully create a temporary file")
-	defer tempMD5File.Close()
+	d, mockFS, _ := newTestDownloader(mockCtrl)
+	mockFS.EXPECT().Open(config.AgentSigningKeyFile()).Return(nil, os.ErrNotExist)
 
-	tempAgentFile, err := ioutil.TempFile("", "agent-test")
-	assert.NoError(t, err, "Expect to successfully create a temporary file")
-	defer tempAgentFile.Close()
+	_, err := d.loadSigningKey()
+	assert.Error(t, err, "Expect a missing key to fail rather than skip the signature")
+}
 
-	tempReader := ioutil.NopCloser(&bytes.Buffer{})
+func TestDownloadAgentDownloadChecksumFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
 
-	gomock.InOrder(
-		mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700),
-		mockS3Downloader.EXPECT().downloadFile(remoteTarballMD5Key).Return(tempMD5File.Name(), nil),
-		mockFS.EXPECT().Open(tempMD5File.Name()).Return(tempMD5File, nil),
-		mockFS.EXPECT().ReadAll(tempMD5File).Return([]byte(md5sum), nil),
-		mockFS.EXPECT().Remove(tempMD5File.Name()),
-		mockS3Downloader.EXPECT().downloadFile(remoteTarballKey).Return(tempAgentFile.Name(), nil),
-		mockFS.EXPECT().Open(tempAgentFile.Name()).Return(tempReader, nil),
-		mockFS.EXPECT().Copy(gomock.Any(), tempReader).Return(int64(0), errors.New("test error")),
-		mockFS.EXPECT().Stat(tempAgentFile.Name()).Return(nil, nil),
-		mockFS.EXPECT().Remove(tempAgentFile.Name()),
+	_, publicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, publicKey),
+		[]*gomock.Call{mockS3Downloader.EXPECT().downloadFile(gomock.Any(), remoteTarballSHA256Key, nil).Return("", "", errors.New("test error"))},
 	)
 
-	d := &Downloader{
-		s3Downloader: mockS3Downloader,
-		fs:           mockFS,
-		metadata:     mockMetadata,
-		region:       config.DefaultRegionName,
-	}
-
-	d.DownloadAgent()
+	assert.Error(t, d.DownloadAgent(context.Background()))
 }
 
-func TestDownloadAgentMD5Mismatch(t *testing.T) {
+func TestDownloadAgentReadPublishedChecksumFailure(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
-	md5sum := "md5sum"
+	_, publicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	tempFile := ioutil.NopCloser(&bytes.Buffer{})
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, publicKey),
+		[]*gomock.Call{
+			mockS3Downloader.EXPECT().downloadFile(gomock.Any(), remoteTarballSHA256Key, nil).Return("/tmp/checksum", "s3://bucket/"+remoteTarballSHA256Key, nil),
+			mockFS.EXPECT().Open("/tmp/checksum").Return(tempFile, nil),
+			mockFS.EXPECT().ReadAll(tempFile).Return(nil, errors.New("test error")),
+			mockFS.EXPECT().Remove("/tmp/checksum"),
+		},
+	)
 
-	mockFS := NewMockfileSystem(mockCtrl)
-	mockS3Downloader := NewMocks3DownloaderAPI(mockCtrl)
-	mockMetadata := NewMockinstanceMetadata(mockCtrl)
+	assert.Error(t, d.DownloadAgent(context.Background()))
+}
 
-	tempMD5File, err := ioutil.TempFile("", "md5-test")
-	assert.NoError(t, err, "Expect to successfully create a temporary file")
-	defer tempMD5File.Close()
+func TestDownloadAgentDownloadTarballFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
 
-	tempAgentFile, err := ioutil.TempFile("", "agent-test")
-	assert.NoError(t, err, "Expect to successfully create a temporary file")
-	defer tempAgentFile.Close()
+	signingKey, publicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, publicKey),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSHA256Key, checksumOf(tarballContents)),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSignatureKey, sign(t, signingKey, tarballContents)),
+		expectDescribedTarball(mockFS, mockS3Downloader, remoteTarballKey),
+		[]*gomock.Call{mockS3Downloader.EXPECT().downloadFile(gomock.Any(), remoteTarballKey, gomock.Any()).Return("", "", errors.New("test error"))},
+	)
 
-	tempReader := ioutil.NopCloser(&bytes.Buffer{})
+	assert.Error(t, d.DownloadAgent(context.Background()))
+}
 
-	gomock.InOrder(
-		mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700),
-		mockS3Downloader.EXPECT().downloadFile(remoteTarballMD5Key).Return(tempMD5File.Name(), nil),
-		mockFS.EXPECT().Open(tempMD5File.Name()).Return(tempMD5File, nil),
-		mockFS.EXPECT().ReadAll(tempMD5File).Return([]byte(md5sum), nil),
-		mockFS.EXPECT().Remove(tempMD5File.Name()),
-		mockS3Downloader.EXPECT().downloadFile(remoteTarballKey).Return(tempAgentFile.Name(), nil),
-		mockFS.EXPECT().Open(tempAgentFile.Name()).Return(tempReader, nil),
-		mockFS.EXPECT().Copy(gomock.Any(), tempReader).Return(int64(0), nil),
-		mockFS.EXPECT().Stat(tempAgentFile.Name()).Return(nil, nil),
-		mockFS.EXPECT().Remove(tempAgentFile.Name()),
-	)
+func TestDownloadAgentChecksumMismatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
 
-	d := &Downloader{
-		s3Downloader: mockS3Downloader,
-		fs:           mockFS,
-		metadata:     mockMetadata,
-		region:       config.DefaultRegionName,
-	}
+	signingKey, publicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, publicKey),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSHA256Key, checksumOf("other contents")),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSignatureKey, sign(t, signingKey, tarballContents)),
+		expectDescribedTarball(mockFS, mockS3Downloader, remoteTarballKey),
+		[]*gomock.Call{
+			expectPublishedTarball(mockS3Downloader, "/tmp/agent", tarballContents),
+			mockFS.EXPECT().Stat("/tmp/agent").Return(nil, nil),
+			mockFS.EXPECT().Remove("/tmp/agent"),
+		},
+	)
 
-	d.DownloadAgent()
+	err := d.DownloadAgent(context.Background())
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "Expect checksum mismatch error, got: %v", err)
 }
 
-func TestDownloadAgentSuccess(t *testing.T) {
+func TestDownloadAgentSignatureInvalid(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
-	tarballContents := "tarball contents"
-	tarballReader := ioutil.NopCloser(bytes.NewBufferString(tarballContents))
-	expectedMd5Sum := fmt.Sprintf("%x\n", md5.Sum([]byte(tarballContents)))
-
-	tempMD5File, err := ioutil.TempFile("", "md5-test")
-	assert.NoError(t, err, "Expect to successfully create a temporary file")
-	defer tempMD5File.Close()
+	signingKey, _ := newTestSigningKey(t)
+	_, otherPublicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, otherPublicKey),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSHA256Key, checksumOf(tarballContents)),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSignatureKey, sign(t, signingKey, tarballContents)),
+		expectDescribedTarball(mockFS, mockS3Downloader, remoteTarballKey),
+		[]*gomock.Call{
+			expectPublishedTarball(mockS3Downloader, "/tmp/agent", tarballContents),
+			expectReadTarball(mockFS, "/tmp/agent", tarballContents),
+			mockFS.EXPECT().Stat("/tmp/agent").Return(nil, nil),
+			mockFS.EXPECT().Remove("/tmp/agent"),
+		},
+	)
 
-	tempAgentFile, err := ioutil.TempFile("", "agent-test")
-	assert.NoError(t, err, "Expect to successfully create a temporary file")
-	defer tempAgentFile.Close()
+	err := d.DownloadAgent(context.Background())
+	assert.True(t, errors.Is(err, ErrSignatureInvalid), "Expect invalid signature error, got: %v", err)
+}
 
-	mockFS := NewMockfileSystem(mockCtrl)
-	mockS3Downloader := NewMocks3DownloaderAPI(mockCtrl)
-	mockMetadata := NewMockinstanceMetadata(mockCtrl)
+func TestDownloadAgentSuccess(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
 
-	gomock.InOrder(
-		mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700),
-		mockS3Downloader.EXPECT().downloadFile(remoteTarballMD5Key).Return(tempMD5File.Name(), nil),
-		mockFS.EXPECT().Open(tempMD5File.Name()).Return(tempMD5File, nil),
-		mockFS.EXPECT().ReadAll(tempMD5File).Return([]byte(expectedMd5Sum), nil),
-		mockFS.EXPECT().Remove(tempMD5File.Name()),
-		mockS3Downloader.EXPECT().downloadFile(remoteTarballKey).Return(tempAgentFile.Name(), nil),
-		mockFS.EXPECT().Open(tempAgentFile.Name()).Return(tarballReader, nil),
-		mockFS.EXPECT().Copy(gomock.Any(), tarballReader).Do(func(writer io.Writer, reader io.Reader) {
-			_, err = io.Copy(writer, reader)
-			assert.NoError(t, err, "Expect to successfully write to file")
-		}),
-		mockFS.EXPECT().Rename(tempAgentFile.Name(), config.AgentTarball()),
-		mockFS.EXPECT().Stat(tempAgentFile.Name()).Return(nil, errors.New("temp file has been renamed")),
+	signingKey, publicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, publicKey),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSHA256Key,
+			[]byte(string(checksumOf(tarballContents))+"  "+remoteTarballKey+"\n")),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSignatureKey, sign(t, signingKey, tarballContents)),
+		expectDescribedTarball(mockFS, mockS3Downloader, remoteTarballKey),
+		[]*gomock.Call{
+			expectPublishedTarball(mockS3Downloader, "/tmp/agent", tarballContents),
+			expectReadTarball(mockFS, "/tmp/agent", tarballContents),
+			// no agent was cached before
+			mockFS.EXPECT().Stat(config.AgentTarball()).Return(nil, os.ErrNotExist),
+			mockFS.EXPECT().Rename("/tmp/agent", config.AgentTarball()),
+			expectCacheState(t, mockFS, &cacheState{
+				Status: StatusReloadNeeded,
+				Agent: &CachedAgent{
+					Version:   config.DefaultAgentVersion,
+					Arch:      config.AgentArch(),
+					SHA256:    string(checksumOf(tarballContents)),
+					SourceURL: "s3://bucket/" + remoteTarballKey,
+				},
+			}),
+			mockFS.EXPECT().Sync(config.CacheDirectory()),
+			mockFS.EXPECT().Stat("/tmp/agent").Return(nil, errors.New("temp file has been renamed")),
+		},
 	)
 
-	d := &Downloader{
-		s3Downloader: mockS3Downloader,
-		fs:           mockFS,
-		metadata:     mockMetadata,
-		region:       config.DefaultRegionName,
-	}
-
-	d.DownloadAgent()
+	failures := metrics.AgentDownloadFailures.Value()
+	assert.NoError(t, d.DownloadAgent(context.Background()))
+	assert.Equal(t, failures, metrics.AgentDownloadFailures.Value())
 }
 
 func TestLoadDesiredAgentFailOpenDesired(t *testing.T) {
@@ -451,12 +638,15 @@ func TestRecordCachedAgent(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
+	mockStateWriter := NewMockstateWriter(mockCtrl)
 	mockFS := NewMockfileSystem(mockCtrl)
 
-	mockFS.EXPECT().WriteFile(config.CacheState(), []byte("1"), os.FileMode(orwPerm))
+	mockFS.EXPECT().Open(config.CacheState()).Return(nil, os.ErrNotExist)
+	mockStateWriter.EXPECT().WriteFile(config.CacheState(), []byte(`{"status":1}`), os.FileMode(orwPerm))
 
 	d := &Downloader{
-		fs: mockFS,
+		fs:          mockFS,
+		stateWriter: mockStateWriter,
 	}
 	d.RecordCachedAgent()
 }
@@ -479,3 +669,212 @@ func TestLoadDesiredAgent(t *testing.T) {
 
 	d.LoadDesiredAgent()
 }
+
+func TestStandbyAgentFile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	standbyImage := "my-next-agent-image"
+
+	mockFS := NewMockfileSystem(mockCtrl)
+
+	mockFS.EXPECT().Open(config.StandbyImageLocatorFile()).Return(ioutil.NopCloser(bytes.NewBufferString(standbyImage+"\n")), nil)
+	mockFS.EXPECT().Base(gomock.Any()).Return(standbyImage + "\n")
+
+	d := &Downloader{
+		fs: mockFS,
+	}
+
+	standbyFile, err := d.StandbyAgentFile()
+	assert.NoError(t, err, "Expect standby image file to be read")
+	assert.Equal(t, config.CacheDirectory()+"/"+standbyImage, standbyFile)
+}
+
+func TestDigestWriterAtSequential(t *testing.T) {
+	file, err := ioutil.TempFile("", "digest-test")
+	assert.NoError(t, err, "Expect to successfully create a temporary file")
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	digest := sha256.New()
+	writer := newDigestWriterAt(file, digest)
+	writer.WriteAt([]byte("tarball "), 0)
+	writer.WriteAt([]byte("contents"), 8)
+
+	assert.True(t, writer.complete(), "Expect digest to cover sequential writes")
+	assert.Equal(t, string(checksumOf(tarballContents)), hex.EncodeToString(digest.Sum(nil)))
+}
+
+func TestDigestWriterAtOutOfOrder(t *testing.T) {
+	file, err := ioutil.TempFile("", "digest-test")
+	assert.NoError(t, err, "Expect to successfully create a temporary file")
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	digest := sha256.New()
+	writer := newDigestWriterAt(file, digest)
+	writer.WriteAt([]byte("contents"), 8)
+	writer.WriteAt([]byte("tarball "), 0)
+	assert.False(t, writer.complete(), "Expect digest to not cover out of order writes")
+
+	err = rehash(file, digest)
+	assert.NoError(t, err, "Expect to successfully rehash the file")
+	assert.Equal(t, string(checksumOf(tarballContents)), hex.EncodeToString(digest.Sum(nil)))
+}
+
+// newTestBucketDownloader returns a bucket downloader for the tarball and the
+// name of its partial file in a new cache directory
+func newTestBucketDownloader(t *testing.T, mockCtrl *gomock.Controller) (*s3BucketDownloader, *Mocks3API, string) {
+	cacheDir, err := ioutil.TempDir("", "download-test")
+	require.NoError(t, err, "Expect to successfully create a cache directory")
+	mockS3 := NewMocks3API(mockCtrl)
+	return &s3BucketDownloader{
+		bucket: "bucket",
+		region: config.DefaultRegionName,
+		client: mockS3,
+	}, mockS3, filepath.Join(cacheDir, remoteTarballKey+partialFileSuffix)
+}
+
+// writeObject writes data at off like s3manager writes a downloaded range
+func writeObject(data string, off int64) func(aws.Context, io.WriterAt, *s3.GetObjectInput, ...func(*s3manager.Downloader)) {
+	return func(ctx aws.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*s3manager.Downloader)) {
+		w.WriteAt([]byte(data), off)
+	}
+}
+
+func TestS3BucketDownloaderDownload(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	bucketDownloader, mockS3, partialFile := newTestBucketDownloader(t, mockCtrl)
+	defer os.RemoveAll(filepath.Dir(partialFile))
+	mockS3.EXPECT().DownloadWithContext(gomock.Any(), gomock.Any(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String(remoteTarballKey),
+	}).Do(writeObject(tarballContents, 0))
+
+	digest := sha256.New()
+	name, err := bucketDownloader.download(context.Background(), remoteTarballKey, filepath.Dir(partialFile), &standardFS{}, digest)
+	require.NoError(t, err)
+	assert.Equal(t, partialFile, name)
+	assert.Equal(t, string(checksumOf(tarballContents)), hex.EncodeToString(digest.Sum(nil)))
+}
+
+func TestS3BucketDownloaderResumesPartialFile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	bucketDownloader, mockS3, partialFile := newTestBucketDownloader(t, mockCtrl)
+	defer os.RemoveAll(filepath.Dir(partialFile))
+	require.NoError(t, ioutil.WriteFile(partialFile, []byte("tarball "), 0600))
+	mockS3.EXPECT().DownloadWithContext(gomock.Any(), gomock.Any(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String(remoteTarballKey),
+		Range:  aws.String("bytes=8-"),
+	}).Do(writeObject("contents", 0))
+
+	digest := sha256.New()
+	_, err := bucketDownloader.download(context.Background(), remoteTarballKey, filepath.Dir(partialFile), &standardFS{}, digest)
+	require.NoError(t, err)
+	contents, _ := ioutil.ReadFile(partialFile)
+	assert.Equal(t, tarballContents, string(contents))
+	assert.Equal(t, string(checksumOf(tarballContents)), hex.EncodeToString(digest.Sum(nil)),
+		"Expect digest to cover the bytes downloaded before resuming")
+}
+
+func TestS3DownloaderRetriesFailedDownload(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	bucketDownloader, mockS3, partialFile := newTestBucketDownloader(t, mockCtrl)
+	defer os.RemoveAll(filepath.Dir(partialFile))
+	gomock.InOrder(
+		mockS3.EXPECT().DownloadWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Do(writeObject("tarball ", 0)).
+			Return(int64(8), errors.New("connection reset")),
+		// the retry resumes the partial file
+		mockS3.EXPECT().DownloadWithContext(gomock.Any(), gomock.Any(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String(remoteTarballKey),
+			Range:  aws.String("bytes=8-"),
+		}).Do(writeObject("contents", 0)),
+	)
+
+	var slept []time.Duration
+	downloader := &s3Downloader{
+		bucketDownloaders: []*s3BucketDownloader{bucketDownloader},
+		fs:                &standardFS{},
+		cacheDir:          filepath.Dir(partialFile),
+		retryPolicy:       backoff.Policy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute, Multiplier: 2},
+		sleep:             func(d time.Duration) { slept = append(slept, d) },
+	}
+	digest := sha256.New()
+	name, _, err := downloader.downloadFile(context.Background(), remoteTarballKey, digest)
+	require.NoError(t, err)
+	assert.Equal(t, partialFile, name)
+	assert.Equal(t, []time.Duration{time.Second}, slept)
+	assert.Equal(t, string(checksumOf(tarballContents)), hex.EncodeToString(digest.Sum(nil)))
+}
+
+func TestS3DownloaderDoesNotRetryMissingFile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	bucketDownloader, mockS3, partialFile := newTestBucketDownloader(t, mockCtrl)
+	defer os.RemoveAll(filepath.Dir(partialFile))
+	mockS3.EXPECT().DownloadWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(0),
+		awserr.NewRequestFailure(awserr.New("NoSuchKey", "The specified key does not exist.", nil), http.StatusNotFound, "id"))
+
+	downloader := &s3Downloader{
+		bucketDownloaders: []*s3BucketDownloader{bucketDownloader},
+		fs:                &standardFS{},
+		cacheDir:          filepath.Dir(partialFile),
+		retryPolicy:       backoff.Policy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute, Multiplier: 2},
+		sleep:             func(time.Duration) { t.Error("Expect a missing file not to be retried") },
+	}
+	_, _, err := downloader.downloadFile(context.Background(), remoteTarballKey, nil)
+	assert.Error(t, err)
+}
+
+func TestS3BucketDownloaderKeepsPrefixOfFailedDownload(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	bucketDownloader, mockS3, partialFile := newTestBucketDownloader(t, mockCtrl)
+	defer os.RemoveAll(filepath.Dir(partialFile))
+	mockS3.EXPECT().DownloadWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Do(
+		func(ctx aws.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*s3manager.Downloader)) {
+			w.WriteAt([]byte("tarball "), 0)
+			// a part after a gap is not kept
+			w.WriteAt([]byte("ents"), 12)
+		}).Return(int64(12), errors.New("connection reset"))
+
+	_, err := bucketDownloader.download(context.Background(), remoteTarballKey, filepath.Dir(partialFile), &standardFS{}, sha256.New())
+	assert.Error(t, err)
+	contents, err := ioutil.ReadFile(partialFile)
+	require.NoError(t, err, "Expect partial file to be kept")
+	assert.Equal(t, "tarball ", string(contents))
+}
+
+func TestS3BucketDownloaderRestartsUnsatisfiableRange(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	bucketDownloader, mockS3, partialFile := newTestBucketDownloader(t, mockCtrl)
+	defer os.RemoveAll(filepath.Dir(partialFile))
+	require.NoError(t, ioutil.WriteFile(partialFile, []byte(tarballContents+" of another version"), 0600))
+	gomock.InOrder(
+		mockS3.EXPECT().DownloadWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(0),
+			awserr.NewRequestFailure(awserr.New("InvalidRange", "range not satisfiable", nil), http.StatusRequestedRangeNotSatisfiable, "")),
+		mockS3.EXPECT().DownloadWithContext(gomock.Any(), gomock.Any(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String(remoteTarballKey),
+		}).Do(writeObject(tarballContents, 0)),
+	)
+
+	digest := sha256.New()
+	_, err := bucketDownloader.download(context.Background(), remoteTarballKey, filepath.Dir(partialFile), &standardFS{}, digest)
+	require.NoError(t, err)
+	contents, _ := ioutil.ReadFile(partialFile)
+	assert.Equal(t, tarballContents, string(contents))
+	assert.Equal(t, string(checksumOf(tarballContents)), hex.EncodeToString(digest.Sum(nil)))
+}
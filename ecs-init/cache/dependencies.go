@@ -21,13 +21,27 @@ package cache
 //go:generate mockgen.sh $GOPACKAGE $GOFILE
 
 import (
+	"context"
+	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/asyncwriter"
+	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/metrics"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -35,9 +49,38 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	// downloadPartSize is the size of the byte ranges requested from s3. The
+	// agent tarball is fetched in a handful of parts of this size.
+	downloadPartSize = 16 * 1024 * 1024
+	// downloadWriteBufferSize is the size of the buffer used to batch writes
+	// of a part to the temp file
+	downloadWriteBufferSize = 1024 * 1024
+	// hashBufferSize is the size of the buffer used when a downloaded file
+	// has to be read back to compute its digest
+	hashBufferSize = 1024 * 1024
+	// partialFileSuffix is appended to the name of a file while it is
+	// downloaded; the partial file is kept to resume an interrupted download
+	partialFileSuffix = ".partial"
+	partialFilePerm   = 0600
+)
+
 // s3API captures the only method used from the s3 package
 type s3API interface {
-	Download(w io.WriterAt, input *s3.GetObjectInput, options ...func(*s3manager.Downloader)) (n int64, err error)
+	DownloadWithContext(ctx aws.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*s3manager.Downloader)) (n int64, err error)
+}
+
+// s3HeadAPI captures the method used to describe an object without
+// downloading it
+type s3HeadAPI interface {
+	HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, options ...request.Option) (*s3.HeadObjectOutput, error)
+}
+
+// s3ObjectAPI captures the methods used to fetch an object as a single
+// stream, see s3Fetcher
+type s3ObjectAPI interface {
+	GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, options ...request.Option) (*s3.GetObjectOutput, error)
+	s3HeadAPI
 }
 
 // s3BucketDownloader wraps a bucket together with a downloader that can download from it
@@ -45,19 +88,66 @@ type s3BucketDownloader struct {
 	bucket string
 	region string
 	client s3API
+	head   s3HeadAPI
 }
 
-func newS3BucketDownloader(region, bucketName string) (*s3BucketDownloader, error) {
-	session, err := session.NewSession(&aws.Config{
-		Credentials: credentials.AnonymousCredentials,
-		Region:      aws.String(region),
-	})
+// s3Options configures how the agent files are downloaded from s3
+type s3Options struct {
+	// endpoint replaces the s3 endpoint of the region, e.g. with the
+	// endpoint of an s3 interface VPC endpoint
+	endpoint string
+	// authenticated signs requests with the credentials of the instance
+	// instead of sending them anonymously
+	authenticated bool
+	// concurrency is how many parts are downloaded in parallel. Parts are
+	// hashed as they are written only when they are downloaded in order.
+	concurrency int
+}
+
+// s3OptionsFromConfig reads the s3 options from the environment
+func s3OptionsFromConfig() s3Options {
+	concurrency, err := config.S3DownloadConcurrency()
+	if err != nil {
+		log.Warnf("Downloading %d parts at a time: %v", concurrency, err)
+	}
+	return s3Options{
+		endpoint:      config.S3Endpoint(),
+		authenticated: config.S3Authenticated(),
+		concurrency:   concurrency,
+	}
+}
+
+// awsConfig returns the configuration of the s3 client for region
+func (o s3Options) awsConfig(region string, httpClient *http.Client) *aws.Config {
+	cfg := &aws.Config{
+		Region:     aws.String(region),
+		HTTPClient: httpClient,
+	}
+	if !o.authenticated {
+		cfg.Credentials = credentials.AnonymousCredentials
+	}
+	if o.endpoint != "" {
+		// the bucket is named in the path, as the endpoint may not have a
+		// subdomain per bucket
+		cfg.Endpoint = aws.String(o.endpoint)
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	return cfg
+}
+
+func newS3BucketDownloader(region, bucketName string, httpClient *http.Client, options s3Options) (*s3BucketDownloader, error) {
+	session, err := session.NewSession(options.awsConfig(region, httpClient))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to initialize downloader in region %s", region)
 	}
 
 	s3BucketDownloader := &s3BucketDownloader{
-		client: s3manager.NewDownloader(session),
+		client: s3manager.NewDownloader(session, func(d *s3manager.Downloader) {
+			d.PartSize = downloadPartSize
+			d.Concurrency = options.concurrency
+			d.BufferProvider = s3manager.NewPooledBufferedWriterReadFromProvider(downloadWriteBufferSize)
+		}),
+		head:   s3.New(session),
 		bucket: bucketName,
 		region: region,
 	}
@@ -65,8 +155,39 @@ func newS3BucketDownloader(region, bucketName string) (*s3BucketDownloader, erro
 	return s3BucketDownloader, nil
 }
 
-func (bd *s3BucketDownloader) download(fileName, cacheDir string, fs fileSystem) (string, error) {
-	file, err := fs.TempFile(cacheDir, fileName)
+// objectURL returns the URL of fileName in the bucket
+func (bd *s3BucketDownloader) objectURL(fileName string) string {
+	return fmt.Sprintf("s3://%s/%s", bd.bucket, fileName)
+}
+
+// describe describes the file in the bucket without downloading it
+func (bd *s3BucketDownloader) describe(ctx context.Context, fileName string) (publishedObject, error) {
+	return headObject(ctx, bd.head, bd.bucket, fileName)
+}
+
+// etag returns the entity tag of the file in the bucket, or an empty string
+// if it cannot be described
+func (bd *s3BucketDownloader) etag(ctx context.Context, fileName string) string {
+	if bd.head == nil {
+		return ""
+	}
+	object, err := bd.describe(ctx, fileName)
+	if err != nil {
+		log.Debugf("Could not describe %s: %v", bd.objectURL(fileName), err)
+		return ""
+	}
+	return object.ETag
+}
+
+// download downloads the file into a partial file in cacheDir. A partial file
+// left behind by an interrupted download is resumed with a byte-range request
+// instead of downloading the file again from the start. If digest is not nil,
+// the downloaded bytes are written to it as they are written to the partial
+// file so that the file does not have to be read again to verify it. The
+// partial file is checkpointed as it is downloaded so that a download
+// interrupted by a reboot resumes from its last checkpoint.
+func (bd *s3BucketDownloader) download(ctx context.Context, fileName, cacheDir string, fs fileSystem, digest hash.Hash) (name string, err error) {
+	file, err := fs.OpenFile(filepath.Join(cacheDir, fileName+partialFileSuffix), os.O_RDWR|os.O_CREATE, partialFilePerm)
 	if err != nil {
 		return "", errors.Wrap(err, "could not create local file during download")
 	}
@@ -78,50 +199,297 @@ func (bd *s3BucketDownloader) download(fileName, cacheDir string, fs fileSystem)
 		}
 	}()
 
-	_, err = bd.client.Download(file, &s3.GetObjectInput{
+	checkpoint, offset, hashed, err := resumePartial(fs, file, bd.objectURL(fileName), bd.etag(ctx, fileName), digest)
+	if err != nil {
+		return "", err
+	}
+	err = bd.downloadFrom(ctx, file, fileName, offset, digest, hashed, checkpoint)
+	if offset > 0 && isRangeNotSatisfiable(err) {
+		// the partial file is at least as long as the published file, so it
+		// cannot be its prefix
+		log.Warnf("Partial download of %s does not match the published file, downloading it again", fileName)
+		checkpoint.remove()
+		err = file.Truncate(0)
+		if err == nil {
+			err = bd.downloadFrom(ctx, file, fileName, 0, digest, false, checkpoint)
+		}
+	}
+	if err == nil {
+		// the contents must be durable before the file is renamed into the cache
+		err = file.Sync()
+	}
+	if err == nil {
+		checkpoint.remove()
+	}
+
+	return file.Name(), err
+}
+
+// downloadFrom downloads the file from offset onwards into file, which
+// already holds the bytes before offset. If hashed is true, digest already
+// covers the bytes before offset.
+func (bd *s3BucketDownloader) downloadFrom(ctx context.Context, file *os.File, fileName string, offset int64, digest hash.Hash, hashed bool, checkpoint *resumeCheckpoint) error {
+	if digest != nil && !hashed {
+		digest.Reset()
+	}
+	writer := newDigestWriterAt(&offsetWriterAt{writer: file, offset: offset}, digest)
+	writer.progress = func(written int64) { checkpoint.advance(offset + written) }
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(bd.bucket),
 		Key:    aws.String(fileName),
-	})
+	}
+	if offset > 0 {
+		log.Infof("Resuming download of %s at byte %d", fileName, offset)
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+		if digest != nil && !hashed {
+			err := hashPrefix(file, digest, offset)
+			if err != nil {
+				return err
+			}
+		}
+	}
 
-	return file.Name(), err
+	_, err := bd.client.DownloadWithContext(ctx, writer, input)
+	if err != nil {
+		// only the bytes written in order are known to be a prefix of the
+		// file; anything written after a gap is downloaded again on resume
+		if terr := file.Truncate(offset + writer.offset); terr != nil {
+			log.Warnf("Could not truncate partial download of %s: %v", fileName, terr)
+		} else {
+			checkpoint.save(offset + writer.offset)
+		}
+		return err
+	}
+	if !writer.complete() {
+		log.Debugf("Parts of %s were not written in order, reading back the file to hash it", fileName)
+		return rehash(file, digest)
+	}
+	return nil
+}
+
+// isRangeNotSatisfiable returns true when s3 rejected the requested byte range
+func isRangeNotSatisfiable(err error) bool {
+	requestErr, ok := err.(awserr.RequestFailure)
+	return ok && requestErr.StatusCode() == http.StatusRequestedRangeNotSatisfiable
+}
+
+// offsetWriterAt shifts the writes of a byte-range download to where the
+// range starts in the file, counting the downloaded bytes
+type offsetWriterAt struct {
+	writer io.WriterAt
+	offset int64
 }
 
+func (w *offsetWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.writer.WriteAt(p, w.offset+off)
+	metrics.DownloadedBytes.Add(uint64(n))
+	return n, err
+}
+
+// countingWriter counts the bytes written to the underlying io.Writer as
+// downloaded
+type countingWriter struct {
+	writer io.Writer
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	metrics.DownloadedBytes.Add(uint64(n))
+	return n, err
+}
+
+// digestWriterAt writes to the underlying io.WriterAt and feeds the written
+// bytes into a digest as long as they are written sequentially
+type digestWriterAt struct {
+	writer io.WriterAt
+	digest hash.Hash
+	// progress, if set, is called with the length of the prefix written in
+	// order each time it grows
+	progress func(int64)
+	lock     sync.Mutex
+	// offset is the length of the prefix that was written in order
+	offset     int64
+	sequential bool
+}
+
+// newDigestWriterAt creates a digestWriterAt adding to the bytes digest
+// already covers
+func newDigestWriterAt(writer io.WriterAt, digest hash.Hash) *digestWriterAt {
+	return &digestWriterAt{
+		writer:     writer,
+		digest:     digest,
+		sequential: true,
+	}
+}
+
+func (w *digestWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.writer.WriteAt(p, off)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.sequential {
+		return n, err
+	}
+	if off != w.offset {
+		w.sequential = false
+		return n, err
+	}
+	if w.digest != nil {
+		w.digest.Write(p[:n])
+	}
+	w.offset += int64(n)
+	if w.progress != nil {
+		w.progress(w.offset)
+	}
+	return n, err
+}
+
+// complete returns true when the digest covers everything that was written
+func (w *digestWriterAt) complete() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.digest == nil || w.sequential
+}
+
+// hashPrefix feeds the first length bytes of the file into the digest
+func hashPrefix(file io.ReadSeeker, digest hash.Hash, length int64) error {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return errors.Wrap(err, "could not rewind partial download")
+	}
+	_, err = io.CopyBuffer(digest, io.LimitReader(file, length), make([]byte, hashBufferSize))
+	return errors.Wrap(err, "could not hash partial download")
+}
+
+// rehash resets the digest and recomputes it from the contents of the file
+func rehash(file io.ReadSeeker, digest hash.Hash) error {
+	digest.Reset()
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return errors.Wrap(err, "could not rewind downloaded file")
+	}
+	_, err = io.CopyBuffer(digest, file, make([]byte, hashBufferSize))
+	return err
+}
+
+// s3DownloaderAPI downloads the files of the agent, from the agent buckets or
+// with the Fetcher of the configured download URL
 type s3DownloaderAPI interface {
-	addBucketDownloader(bucketDownloader *s3BucketDownloader)
-	downloadFile(fileName string) (string, error)
+	// downloadFile downloads fileName and returns the temporary file it was
+	// downloaded to and the URL it was downloaded from
+	downloadFile(ctx context.Context, fileName string, digest hash.Hash) (string, string, error)
+	// fileSize returns the size of fileName without downloading it
+	fileSize(ctx context.Context, fileName string) (int64, error)
+	// describeFile describes fileName without downloading it
+	describeFile(ctx context.Context, fileName string) (publishedObject, error)
+	// sourceURLs returns the URLs fileName is downloaded from, in the order
+	// they are tried
+	sourceURLs(fileName string) []string
 }
 
 type s3Downloader struct {
 	bucketDownloaders []*s3BucketDownloader
 	fs                fileSystem
 	cacheDir          string
+	// retryPolicy is how a file that could not be downloaded from any
+	// bucket is retried
+	retryPolicy backoff.Policy
+	sleep       func(time.Duration)
 }
 
 func (d *s3Downloader) addBucketDownloader(bucketDownloader *s3BucketDownloader) {
 	d.bucketDownloaders = append(d.bucketDownloaders, bucketDownloader)
 }
 
-func (d *s3Downloader) downloadFile(fileName string) (string, error) {
+// downloadFile downloads fileName from the first bucket that has it. A file
+// that cannot be downloaded from any bucket is retried following the retry
+// policy, resuming the partial file, unless every bucket denied access to it
+// or does not have it, or ctx is done.
+func (d *s3Downloader) downloadFile(ctx context.Context, fileName string, digest hash.Hash) (string, string, error) {
+	var tempFileName, sourceURL string
+	sleep := d.sleep
+	if sleep == nil {
+		sleep = func(delay time.Duration) { backoff.Sleep(ctx, delay) }
+	}
+	err := backoff.RetryContext(ctx, d.retryPolicy.NewBackoff(), sleep, func() error {
+		var err error
+		tempFileName, sourceURL, err = d.downloadFileFromBuckets(ctx, fileName, digest)
+		return err
+	}, func(err error, delay time.Duration) {
+		log.Warnf("Could not download file %s, retrying in %s: %v", fileName, delay, err)
+	})
+	return tempFileName, sourceURL, err
+}
+
+func (d *s3Downloader) downloadFileFromBuckets(ctx context.Context, fileName string, digest hash.Hash) (string, string, error) {
+	permanent := true
 	for _, bucketDownloader := range d.bucketDownloaders {
-		fileName, err := bucketDownloader.download(fileName, d.cacheDir, d.fs)
+		tempFileName, err := bucketDownloader.download(ctx, fileName, d.cacheDir, d.fs, digest)
 		if err == nil {
 			log.Debugf("Download file %s from bucket %s in region %s succeeded.",
 				fileName, bucketDownloader.bucket, bucketDownloader.region)
-			return fileName, nil
+			return tempFileName, bucketDownloader.objectURL(fileName), nil
 		} else {
 			log.Errorf("Download file %s from bucket %s in region %s failed with error: %v",
 				fileName, bucketDownloader.bucket, bucketDownloader.region, err)
+			permanent = permanent && isPermanentDownloadError(err)
 		}
 	}
 
 	log.Debugf("Failed to download file %s from s3", fileName)
-	return "", errors.New("failed to download file from s3")
+	err := errors.New("failed to download file from s3")
+	if permanent {
+		return "", "", backoff.Permanent(err)
+	}
+	return "", "", err
+}
+
+// sourceURLs returns the URLs of fileName in the buckets, in the order they
+// are tried
+func (d *s3Downloader) sourceURLs(fileName string) []string {
+	urls := make([]string, 0, len(d.bucketDownloaders))
+	for _, bucketDownloader := range d.bucketDownloaders {
+		urls = append(urls, bucketDownloader.objectURL(fileName))
+	}
+	return urls
+}
+
+// fileSize returns the size of fileName in the first bucket that has it
+func (d *s3Downloader) fileSize(ctx context.Context, fileName string) (int64, error) {
+	object, err := d.describeFile(ctx, fileName)
+	return object.Size, err
+}
+
+// describeFile describes fileName in the first bucket that has it
+func (d *s3Downloader) describeFile(ctx context.Context, fileName string) (publishedObject, error) {
+	for _, bucketDownloader := range d.bucketDownloaders {
+		object, err := bucketDownloader.describe(ctx, fileName)
+		if err == nil {
+			return object, nil
+		}
+		log.Debugf("Could not describe file %s in bucket %s in region %s: %v",
+			fileName, bucketDownloader.bucket, bucketDownloader.region, err)
+	}
+	return publishedObject{}, errors.New("failed to describe file in s3")
+}
+
+// isPermanentDownloadError returns true when s3 answered that the file is
+// missing or access to it is denied, which retrying does not change
+func isPermanentDownloadError(err error) bool {
+	requestErr, ok := errors.Cause(err).(awserr.RequestFailure)
+	if !ok {
+		return false
+	}
+	switch requestErr.StatusCode() {
+	case http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	return false
 }
 
 // fileSystem captures related functions from os, io, and io/ioutil packages
 type fileSystem interface {
 	MkdirAll(path string, perm os.FileMode) error
-	TempFile(dir, prefix string) (f *os.File, err error)
+	OpenFile(name string, flag int, perm os.FileMode) (*os.File, error)
 	Remove(path string)
 	TeeReader(r io.Reader, w io.Writer) io.Reader
 	Copy(dst io.Writer, src io.Reader) (written int64, err error)
@@ -129,8 +497,17 @@ type fileSystem interface {
 	ReadAll(r io.Reader) ([]byte, error)
 	Open(name string) (file io.ReadCloser, err error)
 	Stat(name string) (fileinfo fileSizeInfo, err error)
+	ReadDir(dirname string) ([]os.FileInfo, error)
 	Base(path string) string
 	WriteFile(filename string, data []byte, perm os.FileMode) error
+	Sync(path string) error
+}
+
+// stateWriter captures the writer used for state files that are not needed
+// for the agent to start and are written off the critical path
+type stateWriter interface {
+	WriteFile(filename string, data []byte, perm os.FileMode) error
+	Flush() error
 }
 
 type fileSizeInfo interface {
@@ -138,7 +515,7 @@ type fileSizeInfo interface {
 }
 
 type instanceMetadata interface {
-	Region() (string, error)
+	GetInstanceIdentityDocument() (ec2metadata.EC2InstanceIdentityDocument, error)
 }
 
 // standardFS delegates to the package-level functions
@@ -148,8 +525,8 @@ func (s *standardFS) MkdirAll(path string, perm os.FileMode) error {
 	return os.MkdirAll(path, perm)
 }
 
-func (s *standardFS) TempFile(dir, prefix string) (*os.File, error) {
-	return ioutil.TempFile(dir, prefix)
+func (s *standardFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(name, flag, perm)
 }
 
 func (s *standardFS) Remove(path string) {
@@ -180,6 +557,10 @@ func (s *standardFS) Stat(name string) (fileSizeInfo, error) {
 	return os.Stat(name)
 }
 
+func (s *standardFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dirname)
+}
+
 func (s *standardFS) Base(path string) string {
 	return filepath.Base(path)
 }
@@ -187,3 +568,7 @@ func (s *standardFS) Base(path string) string {
 func (s *standardFS) WriteFile(filename string, data []byte, perm os.FileMode) error {
 	return ioutil.WriteFile(filename, data, perm)
 }
+
+func (s *standardFS) Sync(path string) error {
+	return asyncwriter.SyncPath(path)
+}
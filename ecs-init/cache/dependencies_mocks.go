@@ -18,10 +18,15 @@
 package cache
 
 import (
+	context "context"
+	hash "hash"
 	io "io"
 	os "os"
 	reflect "reflect"
 
+	aws "github.com/aws/aws-sdk-go/aws"
+	ec2metadata "github.com/aws/aws-sdk-go/aws/ec2metadata"
+	request "github.com/aws/aws-sdk-go/aws/request"
 	s3 "github.com/aws/aws-sdk-go/service/s3"
 	s3manager "github.com/aws/aws-sdk-go/service/s3/s3manager"
 	gomock "github.com/golang/mock/gomock"
@@ -50,24 +55,130 @@ func (m *Mocks3API) EXPECT() *Mocks3APIMockRecorder {
 	return m.recorder
 }
 
-// Download mocks base method
-func (m *Mocks3API) Download(w io.WriterAt, input *s3.GetObjectInput, options ...func(*s3manager.Downloader)) (int64, error) {
+// DownloadWithContext mocks base method
+func (m *Mocks3API) DownloadWithContext(ctx aws.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*s3manager.Downloader)) (int64, error) {
 	m.ctrl.T.Helper()
-	varargs := []interface{}{w, input}
+	varargs := []interface{}{ctx, w, input}
 	for _, a := range options {
 		varargs = append(varargs, a)
 	}
-	ret := m.ctrl.Call(m, "Download", varargs...)
+	ret := m.ctrl.Call(m, "DownloadWithContext", varargs...)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// Download indicates an expected call of Download
-func (mr *Mocks3APIMockRecorder) Download(w, input interface{}, options ...interface{}) *gomock.Call {
+// DownloadWithContext indicates an expected call of DownloadWithContext
+func (mr *Mocks3APIMockRecorder) DownloadWithContext(ctx, w, input interface{}, options ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	varargs := append([]interface{}{w, input}, options...)
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*Mocks3API)(nil).Download), varargs...)
+	varargs := append([]interface{}{ctx, w, input}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadWithContext", reflect.TypeOf((*Mocks3API)(nil).DownloadWithContext), varargs...)
+}
+
+// Mocks3HeadAPI is a mock of s3HeadAPI interface
+type Mocks3HeadAPI struct {
+	ctrl     *gomock.Controller
+	recorder *Mocks3HeadAPIMockRecorder
+}
+
+// Mocks3HeadAPIMockRecorder is the mock recorder for Mocks3HeadAPI
+type Mocks3HeadAPIMockRecorder struct {
+	mock *Mocks3HeadAPI
+}
+
+// NewMocks3HeadAPI creates a new mock instance
+func NewMocks3HeadAPI(ctrl *gomock.Controller) *Mocks3HeadAPI {
+	mock := &Mocks3HeadAPI{ctrl: ctrl}
+	mock.recorder = &Mocks3HeadAPIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *Mocks3HeadAPI) EXPECT() *Mocks3HeadAPIMockRecorder {
+	return m.recorder
+}
+
+// HeadObjectWithContext mocks base method
+func (m *Mocks3HeadAPI) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, options ...request.Option) (*s3.HeadObjectOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, input}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "HeadObjectWithContext", varargs...)
+	ret0, _ := ret[0].(*s3.HeadObjectOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HeadObjectWithContext indicates an expected call of HeadObjectWithContext
+func (mr *Mocks3HeadAPIMockRecorder) HeadObjectWithContext(ctx, input interface{}, options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, input}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HeadObjectWithContext", reflect.TypeOf((*Mocks3HeadAPI)(nil).HeadObjectWithContext), varargs...)
+}
+
+// Mocks3ObjectAPI is a mock of s3ObjectAPI interface
+type Mocks3ObjectAPI struct {
+	ctrl     *gomock.Controller
+	recorder *Mocks3ObjectAPIMockRecorder
+}
+
+// Mocks3ObjectAPIMockRecorder is the mock recorder for Mocks3ObjectAPI
+type Mocks3ObjectAPIMockRecorder struct {
+	mock *Mocks3ObjectAPI
+}
+
+// NewMocks3ObjectAPI creates a new mock instance
+func NewMocks3ObjectAPI(ctrl *gomock.Controller) *Mocks3ObjectAPI {
+	mock := &Mocks3ObjectAPI{ctrl: ctrl}
+	mock.recorder = &Mocks3ObjectAPIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *Mocks3ObjectAPI) EXPECT() *Mocks3ObjectAPIMockRecorder {
+	return m.recorder
+}
+
+// GetObjectWithContext mocks base method
+func (m *Mocks3ObjectAPI) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, options ...request.Option) (*s3.GetObjectOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, input}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetObjectWithContext", varargs...)
+	ret0, _ := ret[0].(*s3.GetObjectOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetObjectWithContext indicates an expected call of GetObjectWithContext
+func (mr *Mocks3ObjectAPIMockRecorder) GetObjectWithContext(ctx, input interface{}, options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, input}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetObjectWithContext", reflect.TypeOf((*Mocks3ObjectAPI)(nil).GetObjectWithContext), varargs...)
+}
+
+// HeadObjectWithContext mocks base method
+func (m *Mocks3ObjectAPI) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, options ...request.Option) (*s3.HeadObjectOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, input}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "HeadObjectWithContext", varargs...)
+	ret0, _ := ret[0].(*s3.HeadObjectOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HeadObjectWithContext indicates an expected call of HeadObjectWithContext
+func (mr *Mocks3ObjectAPIMockRecorder) HeadObjectWithContext(ctx, input interface{}, options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, input}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HeadObjectWithContext", reflect.TypeOf((*Mocks3ObjectAPI)(nil).HeadObjectWithContext), varargs...)
 }
 
 // Mocks3DownloaderAPI is a mock of s3DownloaderAPI interface
@@ -93,31 +204,64 @@ func (m *Mocks3DownloaderAPI) EXPECT() *Mocks3DownloaderAPIMockRecorder {
 	return m.recorder
 }
 
-// addBucketDownloader mocks base method
-func (m *Mocks3DownloaderAPI) addBucketDownloader(bucketDownloader *s3BucketDownloader) {
+// downloadFile mocks base method
+func (m *Mocks3DownloaderAPI) downloadFile(ctx context.Context, fileName string, digest hash.Hash) (string, string, error) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "addBucketDownloader", bucketDownloader)
+	ret := m.ctrl.Call(m, "downloadFile", ctx, fileName, digest)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
-// addBucketDownloader indicates an expected call of addBucketDownloader
-func (mr *Mocks3DownloaderAPIMockRecorder) addBucketDownloader(bucketDownloader interface{}) *gomock.Call {
+// downloadFile indicates an expected call of downloadFile
+func (mr *Mocks3DownloaderAPIMockRecorder) downloadFile(ctx, fileName, digest interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "addBucketDownloader", reflect.TypeOf((*Mocks3DownloaderAPI)(nil).addBucketDownloader), bucketDownloader)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "downloadFile", reflect.TypeOf((*Mocks3DownloaderAPI)(nil).downloadFile), ctx, fileName, digest)
 }
 
-// downloadFile mocks base method
-func (m *Mocks3DownloaderAPI) downloadFile(fileName string) (string, error) {
+// fileSize mocks base method
+func (m *Mocks3DownloaderAPI) fileSize(ctx context.Context, fileName string) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "downloadFile", fileName)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "fileSize", ctx, fileName)
+	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// downloadFile indicates an expected call of downloadFile
-func (mr *Mocks3DownloaderAPIMockRecorder) downloadFile(fileName interface{}) *gomock.Call {
+// fileSize indicates an expected call of fileSize
+func (mr *Mocks3DownloaderAPIMockRecorder) fileSize(ctx, fileName interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "downloadFile", reflect.TypeOf((*Mocks3DownloaderAPI)(nil).downloadFile), fileName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "fileSize", reflect.TypeOf((*Mocks3DownloaderAPI)(nil).fileSize), ctx, fileName)
+}
+
+// describeFile mocks base method
+func (m *Mocks3DownloaderAPI) describeFile(ctx context.Context, fileName string) (publishedObject, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "describeFile", ctx, fileName)
+	ret0, _ := ret[0].(publishedObject)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// describeFile indicates an expected call of describeFile
+func (mr *Mocks3DownloaderAPIMockRecorder) describeFile(ctx, fileName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "describeFile", reflect.TypeOf((*Mocks3DownloaderAPI)(nil).describeFile), ctx, fileName)
+}
+
+// sourceURLs mocks base method
+func (m *Mocks3DownloaderAPI) sourceURLs(fileName string) []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "sourceURLs", fileName)
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// sourceURLs indicates an expected call of sourceURLs
+func (mr *Mocks3DownloaderAPIMockRecorder) sourceURLs(fileName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "sourceURLs", reflect.TypeOf((*Mocks3DownloaderAPI)(nil).sourceURLs), fileName)
 }
 
 // MockfileSystem is a mock of fileSystem interface
@@ -157,19 +301,19 @@ func (mr *MockfileSystemMockRecorder) MkdirAll(path, perm interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MkdirAll", reflect.TypeOf((*MockfileSystem)(nil).MkdirAll), path, perm)
 }
 
-// TempFile mocks base method
-func (m *MockfileSystem) TempFile(dir, prefix string) (*os.File, error) {
+// OpenFile mocks base method
+func (m *MockfileSystem) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "TempFile", dir, prefix)
+	ret := m.ctrl.Call(m, "OpenFile", name, flag, perm)
 	ret0, _ := ret[0].(*os.File)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// TempFile indicates an expected call of TempFile
-func (mr *MockfileSystemMockRecorder) TempFile(dir, prefix interface{}) *gomock.Call {
+// OpenFile indicates an expected call of OpenFile
+func (mr *MockfileSystemMockRecorder) OpenFile(name, flag, perm interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TempFile", reflect.TypeOf((*MockfileSystem)(nil).TempFile), dir, prefix)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenFile", reflect.TypeOf((*MockfileSystem)(nil).OpenFile), name, flag, perm)
 }
 
 // Remove mocks base method
@@ -272,6 +416,21 @@ func (mr *MockfileSystemMockRecorder) Stat(name interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockfileSystem)(nil).Stat), name)
 }
 
+// ReadDir mocks base method
+func (m *MockfileSystem) ReadDir(dirname string) ([]os.FileInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadDir", dirname)
+	ret0, _ := ret[0].([]os.FileInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadDir indicates an expected call of ReadDir
+func (mr *MockfileSystemMockRecorder) ReadDir(dirname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadDir", reflect.TypeOf((*MockfileSystem)(nil).ReadDir), dirname)
+}
+
 // Base mocks base method
 func (m *MockfileSystem) Base(path string) string {
 	m.ctrl.T.Helper()
@@ -300,6 +459,71 @@ func (mr *MockfileSystemMockRecorder) WriteFile(filename, data, perm interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteFile", reflect.TypeOf((*MockfileSystem)(nil).WriteFile), filename, data, perm)
 }
 
+// Sync mocks base method
+func (m *MockfileSystem) Sync(path string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Sync", path)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Sync indicates an expected call of Sync
+func (mr *MockfileSystemMockRecorder) Sync(path interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sync", reflect.TypeOf((*MockfileSystem)(nil).Sync), path)
+}
+
+// MockstateWriter is a mock of stateWriter interface
+type MockstateWriter struct {
+	ctrl     *gomock.Controller
+	recorder *MockstateWriterMockRecorder
+}
+
+// MockstateWriterMockRecorder is the mock recorder for MockstateWriter
+type MockstateWriterMockRecorder struct {
+	mock *MockstateWriter
+}
+
+// NewMockstateWriter creates a new mock instance
+func NewMockstateWriter(ctrl *gomock.Controller) *MockstateWriter {
+	mock := &MockstateWriter{ctrl: ctrl}
+	mock.recorder = &MockstateWriterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockstateWriter) EXPECT() *MockstateWriterMockRecorder {
+	return m.recorder
+}
+
+// WriteFile mocks base method
+func (m *MockstateWriter) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteFile", filename, data, perm)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteFile indicates an expected call of WriteFile
+func (mr *MockstateWriterMockRecorder) WriteFile(filename, data, perm interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteFile", reflect.TypeOf((*MockstateWriter)(nil).WriteFile), filename, data, perm)
+}
+
+// Flush mocks base method
+func (m *MockstateWriter) Flush() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Flush indicates an expected call of Flush
+func (mr *MockstateWriterMockRecorder) Flush() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockstateWriter)(nil).Flush))
+}
+
 // MockfileSizeInfo is a mock of fileSizeInfo interface
 type MockfileSizeInfo struct {
 	ctrl     *gomock.Controller
@@ -360,17 +584,17 @@ func (m *MockinstanceMetadata) EXPECT() *MockinstanceMetadataMockRecorder {
 	return m.recorder
 }
 
-// Region mocks base method
-func (m *MockinstanceMetadata) Region() (string, error) {
+// GetInstanceIdentityDocument mocks base method
+func (m *MockinstanceMetadata) GetInstanceIdentityDocument() (ec2metadata.EC2InstanceIdentityDocument, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Region")
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "GetInstanceIdentityDocument")
+	ret0, _ := ret[0].(ec2metadata.EC2InstanceIdentityDocument)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// Region indicates an expected call of Region
-func (mr *MockinstanceMetadataMockRecorder) Region() *gomock.Call {
+// GetInstanceIdentityDocument indicates an expected call of GetInstanceIdentityDocument
+func (mr *MockinstanceMetadataMockRecorder) GetInstanceIdentityDocument() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Region", reflect.TypeOf((*MockinstanceMetadata)(nil).Region))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInstanceIdentityDocument", reflect.TypeOf((*MockinstanceMetadata)(nil).GetInstanceIdentityDocument))
 }
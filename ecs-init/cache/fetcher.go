@@ -0,0 +1,400 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/cihub/seelog"
+)
+
+var (
+	// ErrFileNotFound is wrapped by the errors of fetchers when the file
+	// does not exist or access to it is denied, which retrying does not
+	// change
+	ErrFileNotFound = errors.New("file not found")
+	// ErrRangeNotSatisfiable is wrapped by the errors of fetchers when the
+	// offset to fetch from is not before the end of the file
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// Fetcher fetches the files of the agent from the sources of a URL scheme.
+// The downloader keeps the partial file, resumes it and verifies the
+// download, so that a Fetcher only has to stream the file. A Fetcher stops
+// and returns an error once ctx is done.
+type Fetcher interface {
+	// Fetch writes the file at source to w, starting offset bytes into
+	// the file
+	Fetch(ctx context.Context, source *url.URL, offset int64, w io.Writer) error
+	// Size returns the size of the file at source
+	Size(ctx context.Context, source *url.URL) (int64, error)
+}
+
+var (
+	fetchersLock sync.RWMutex
+	fetchers     = make(map[string]Fetcher)
+)
+
+// RegisterFetcher registers the fetcher of the URLs of scheme, such as
+// artifactory or oci, replacing the built-in fetcher of the scheme if any
+func RegisterFetcher(scheme string, fetcher Fetcher) {
+	fetchersLock.Lock()
+	defer fetchersLock.Unlock()
+	fetchers[strings.ToLower(scheme)] = fetcher
+}
+
+// newFetcher returns the fetcher registered for scheme, or else the built-in
+// fetcher of http, https, s3 and file URLs
+func newFetcher(scheme, region string, httpClient *http.Client, options s3Options) (Fetcher, error) {
+	fetchersLock.RLock()
+	fetcher, ok := fetchers[scheme]
+	fetchersLock.RUnlock()
+	if ok {
+		return fetcher, nil
+	}
+	switch scheme {
+	case "http", "https":
+		return &httpFetcher{client: httpClient}, nil
+	case "s3":
+		session, err := session.NewSession(options.awsConfig(region, httpClient))
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize s3 fetcher in region %s: %w", region, err)
+		}
+		return &s3Fetcher{client: s3.New(session)}, nil
+	case "file":
+		return &fileFetcher{}, nil
+	}
+	return nil, fmt.Errorf("no fetcher for scheme %q", scheme)
+}
+
+// httpFetcher fetches files from http and https URLs
+type httpFetcher struct {
+	client *http.Client
+}
+
+func (f *httpFetcher) Fetch(ctx context.Context, source *url.URL, offset int64, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.String(), nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the server ignored the range, skip what was fetched already
+		_, err = io.CopyN(ioutil.Discard, resp.Body, offset)
+		if err != nil {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		return fmt.Errorf("%w: %s", ErrRangeNotSatisfiable, source)
+	default:
+		return httpStatusError(source, resp.StatusCode)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (f *httpFetcher) Size(ctx context.Context, source *url.URL) (int64, error) {
+	object, err := f.describe(ctx, source)
+	return object.Size, err
+}
+
+func (f *httpFetcher) describe(ctx context.Context, source *url.URL) (publishedObject, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, source.String(), nil)
+	if err != nil {
+		return publishedObject{}, err
+	}
+	// s3 only returns the checksums of objects when asked to
+	req.Header.Set(checksumModeHeader, "ENABLED")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return publishedObject{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return publishedObject{}, httpStatusError(source, resp.StatusCode)
+	}
+	if resp.ContentLength < 0 {
+		return publishedObject{}, fmt.Errorf("no size for %s", source)
+	}
+	return describeResponse(resp), nil
+}
+
+func httpStatusError(source *url.URL, statusCode int) error {
+	switch statusCode {
+	case http.StatusForbidden, http.StatusNotFound:
+		return fmt.Errorf("%w: %s answered %d", ErrFileNotFound, source, statusCode)
+	}
+	return fmt.Errorf("unexpected status %d for %s", statusCode, source)
+}
+
+// s3Fetcher fetches files from s3://bucket/key URLs in a single stream, in
+// the region of the instance
+type s3Fetcher struct {
+	client s3ObjectAPI
+}
+
+func (f *s3Fetcher) Fetch(ctx context.Context, source *url.URL, offset int64, w io.Writer) error {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(source.Host),
+		Key:    aws.String(strings.TrimPrefix(source.Path, "/")),
+	}
+	if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+	output, err := f.client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		return s3FetchError(source, err)
+	}
+	defer output.Body.Close()
+	_, err = io.Copy(w, output.Body)
+	return err
+}
+
+func (f *s3Fetcher) Size(ctx context.Context, source *url.URL) (int64, error) {
+	object, err := f.describe(ctx, source)
+	return object.Size, err
+}
+
+func (f *s3Fetcher) describe(ctx context.Context, source *url.URL) (publishedObject, error) {
+	object, err := headObject(ctx, f.client, source.Host, strings.TrimPrefix(source.Path, "/"))
+	if err != nil {
+		return publishedObject{}, s3FetchError(source, err)
+	}
+	return object, nil
+}
+
+func s3FetchError(source *url.URL, err error) error {
+	switch {
+	case isRangeNotSatisfiable(err):
+		return fmt.Errorf("%w: %s: %v", ErrRangeNotSatisfiable, source, err)
+	case isPermanentDownloadError(err):
+		return fmt.Errorf("%w: %s: %v", ErrFileNotFound, source, err)
+	}
+	return err
+}
+
+// fileFetcher fetches files from file URLs, such as a shared file system
+type fileFetcher struct{}
+
+func (f *fileFetcher) Fetch(ctx context.Context, source *url.URL, offset int64, w io.Writer) error {
+	file, err := os.Open(source.Path)
+	if err != nil {
+		return fileFetchError(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if offset > 0 && offset >= info.Size() {
+		return fmt.Errorf("%w: %s", ErrRangeNotSatisfiable, source)
+	}
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, &contextReader{ctx: ctx, reader: file})
+	return err
+}
+
+// contextReader fails reads once ctx is done, so that copying a large local
+// file can be canceled
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+func (f *fileFetcher) Size(ctx context.Context, source *url.URL) (int64, error) {
+	info, err := os.Stat(source.Path)
+	if err != nil {
+		return 0, fileFetchError(err)
+	}
+	return info.Size(), nil
+}
+
+func fileFetchError(err error) error {
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		return fmt.Errorf("%w: %v", ErrFileNotFound, err)
+	}
+	return err
+}
+
+// fetcherDownloader downloads the files of the agent from the directory at
+// baseURL with the fetcher of its scheme. Like the s3 downloader, it keeps
+// partial files to resume and hashes the files as they are written.
+type fetcherDownloader struct {
+	baseURL     *url.URL
+	fetcher     Fetcher
+	fs          fileSystem
+	cacheDir    string
+	retryPolicy backoff.Policy
+	sleep       func(time.Duration)
+}
+
+// source returns the URL of fileName in the directory
+func (d *fetcherDownloader) source(fileName string) *url.URL {
+	return d.baseURL.ResolveReference(&url.URL{Path: fileName})
+}
+
+// downloadFile downloads fileName, retrying following the retry policy
+// unless the file is not found or ctx is done
+func (d *fetcherDownloader) downloadFile(ctx context.Context, fileName string, digest hash.Hash) (string, string, error) {
+	source := d.source(fileName)
+	var tempFileName string
+	sleep := d.sleep
+	if sleep == nil {
+		sleep = func(delay time.Duration) { backoff.Sleep(ctx, delay) }
+	}
+	err := backoff.RetryContext(ctx, d.retryPolicy.NewBackoff(), sleep, func() error {
+		var err error
+		tempFileName, err = d.download(ctx, fileName, source, digest)
+		if errors.Is(err, ErrFileNotFound) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, func(err error, delay time.Duration) {
+		log.Warnf("Could not download file %s, retrying in %s: %v", source, delay, err)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return tempFileName, source.String(), nil
+}
+
+// download downloads source into the partial file of fileName in cacheDir,
+// resuming the partial file left by an interrupted download from its last
+// checkpoint
+func (d *fetcherDownloader) download(ctx context.Context, fileName string, source *url.URL, digest hash.Hash) (name string, err error) {
+	file, err := d.fs.OpenFile(filepath.Join(d.cacheDir, fileName+partialFileSuffix), os.O_RDWR|os.O_CREATE, partialFilePerm)
+	if err != nil {
+		return "", fmt.Errorf("could not create local file during download: %w", err)
+	}
+	defer func() {
+		cerr := file.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+
+	checkpoint, offset, hashed, err := resumePartial(d.fs, file, source.String(), "", digest)
+	if err != nil {
+		return "", err
+	}
+	err = d.fetchFrom(ctx, file, source, offset, digest, hashed, checkpoint)
+	if offset > 0 && errors.Is(err, ErrRangeNotSatisfiable) {
+		log.Warnf("Partial download of %s does not match the published file, downloading it again", fileName)
+		checkpoint.remove()
+		err = file.Truncate(0)
+		if err == nil {
+			_, err = file.Seek(0, io.SeekStart)
+		}
+		if err == nil {
+			err = d.fetchFrom(ctx, file, source, 0, digest, false, checkpoint)
+		}
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		checkpoint.remove()
+	}
+	return file.Name(), err
+}
+
+// fetchFrom fetches source from offset onwards into file, which already
+// holds the bytes before offset and is positioned at offset. If hashed is
+// true, digest already covers the bytes before offset.
+func (d *fetcherDownloader) fetchFrom(ctx context.Context, file *os.File, source *url.URL, offset int64, digest hash.Hash, hashed bool, checkpoint *resumeCheckpoint) error {
+	if offset > 0 {
+		log.Infof("Resuming download of %s at byte %d", source, offset)
+	}
+	var writer io.Writer = file
+	if digest != nil {
+		if !hashed {
+			digest.Reset()
+		}
+		if offset > 0 && !hashed {
+			err := hashPrefix(file, digest, offset)
+			if err != nil {
+				return err
+			}
+		}
+		writer = io.MultiWriter(file, digest)
+	}
+	written := &checkpointWriter{writer: writer, offset: offset, checkpoint: checkpoint}
+	err := d.fetcher.Fetch(ctx, source, offset, &countingWriter{writer: written})
+	if err != nil {
+		checkpoint.save(written.offset)
+	}
+	return err
+}
+
+// fileSize returns the size of fileName in the directory
+func (d *fetcherDownloader) fileSize(ctx context.Context, fileName string) (int64, error) {
+	return d.fetcher.Size(ctx, d.source(fileName))
+}
+
+// describer is implemented by the built-in fetchers that can tell more of a
+// file than its size
+type describer interface {
+	describe(ctx context.Context, source *url.URL) (publishedObject, error)
+}
+
+// describeFile describes fileName in the directory, only by its size unless
+// the fetcher can describe it
+func (d *fetcherDownloader) describeFile(ctx context.Context, fileName string) (publishedObject, error) {
+	if fetcher, ok := d.fetcher.(describer); ok {
+		return fetcher.describe(ctx, d.source(fileName))
+	}
+	size, err := d.fetcher.Size(ctx, d.source(fileName))
+	return publishedObject{Size: size}, err
+}
+
+// sourceURLs returns the URL of fileName in the directory
+func (d *fetcherDownloader) sourceURLs(fileName string) []string {
+	return []string{d.source(fileName).String()}
+}
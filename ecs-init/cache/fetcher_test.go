@@ -0,0 +1,249 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/metrics"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stringFetcher fetches files from a map of their paths to their contents
+type stringFetcher map[string]string
+
+func (f stringFetcher) Fetch(ctx context.Context, source *url.URL, offset int64, w io.Writer) error {
+	contents, ok := f[source.Path]
+	if !ok {
+		return ErrFileNotFound
+	}
+	if offset > 0 && offset >= int64(len(contents)) {
+		return ErrRangeNotSatisfiable
+	}
+	_, err := io.WriteString(w, contents[offset:])
+	return err
+}
+
+func (f stringFetcher) Size(ctx context.Context, source *url.URL) (int64, error) {
+	contents, ok := f[source.Path]
+	if !ok {
+		return 0, ErrFileNotFound
+	}
+	return int64(len(contents)), nil
+}
+
+func TestNewFetcher(t *testing.T) {
+	custom := stringFetcher{}
+	RegisterFetcher("Artifactory", custom)
+	defer delete(fetchers, "artifactory")
+
+	fetcher, err := newFetcher("artifactory", config.DefaultRegionName, http.DefaultClient, s3Options{})
+	require.NoError(t, err)
+	assert.Equal(t, custom, fetcher)
+	fetcher, err = newFetcher("https", config.DefaultRegionName, http.DefaultClient, s3Options{})
+	require.NoError(t, err)
+	assert.IsType(t, &httpFetcher{}, fetcher)
+	fetcher, err = newFetcher("s3", config.DefaultRegionName, http.DefaultClient, s3Options{})
+	require.NoError(t, err)
+	assert.IsType(t, &s3Fetcher{}, fetcher)
+	fetcher, err = newFetcher("file", config.DefaultRegionName, http.DefaultClient, s3Options{})
+	require.NoError(t, err)
+	assert.IsType(t, &fileFetcher{}, fetcher)
+	_, err = newFetcher("oci", config.DefaultRegionName, http.DefaultClient, s3Options{})
+	assert.Error(t, err)
+}
+
+// newTestFetcherDownloader returns a downloader of the files of fetcher in
+// the directory /agents/ and the name of the partial file of the tarball in a
+// new cache directory
+func newTestFetcherDownloader(t *testing.T, fetcher Fetcher) (*fetcherDownloader, string) {
+	cacheDir := t.TempDir()
+	return &fetcherDownloader{
+		baseURL:     &url.URL{Scheme: "test", Path: "/agents/"},
+		fetcher:     fetcher,
+		fs:          &standardFS{},
+		cacheDir:    cacheDir,
+		retryPolicy: backoff.Policy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute, Multiplier: 2},
+		sleep:       func(time.Duration) {},
+	}, filepath.Join(cacheDir, remoteTarballKey+partialFileSuffix)
+}
+
+func TestFetcherDownloaderDownloadFile(t *testing.T) {
+	downloader, partialFile := newTestFetcherDownloader(t, stringFetcher{"/agents/" + remoteTarballKey: tarballContents})
+
+	digest := sha256.New()
+	name, sourceURL, err := downloader.downloadFile(context.Background(), remoteTarballKey, digest)
+	require.NoError(t, err)
+	assert.Equal(t, partialFile, name)
+	assert.Equal(t, "test:///agents/"+remoteTarballKey, sourceURL)
+	assert.Equal(t, string(checksumOf(tarballContents)), hex.EncodeToString(digest.Sum(nil)))
+	assert.Equal(t, []string{sourceURL}, downloader.sourceURLs(remoteTarballKey))
+}
+
+func TestFetcherDownloaderResumesPartialFile(t *testing.T) {
+	downloader, partialFile := newTestFetcherDownloader(t, stringFetcher{"/agents/" + remoteTarballKey: tarballContents})
+	require.NoError(t, ioutil.WriteFile(partialFile, []byte("tarball "), 0600))
+
+	digest := sha256.New()
+	downloaded := metrics.DownloadedBytes.Value()
+	_, _, err := downloader.downloadFile(context.Background(), remoteTarballKey, digest)
+	require.NoError(t, err)
+	contents, _ := ioutil.ReadFile(partialFile)
+	assert.Equal(t, tarballContents, string(contents))
+	assert.Equal(t, string(checksumOf(tarballContents)), hex.EncodeToString(digest.Sum(nil)),
+		"Expect digest to cover the bytes downloaded before resuming")
+	assert.Equal(t, uint64(len(tarballContents)-len("tarball ")), metrics.DownloadedBytes.Value()-downloaded,
+		"Expect only the bytes downloaded after resuming to be counted")
+}
+
+func TestFetcherDownloaderRestartsUnsatisfiableRange(t *testing.T) {
+	downloader, partialFile := newTestFetcherDownloader(t, stringFetcher{"/agents/" + remoteTarballKey: tarballContents})
+	require.NoError(t, ioutil.WriteFile(partialFile, []byte(tarballContents+" of another version"), 0600))
+
+	digest := sha256.New()
+	_, _, err := downloader.downloadFile(context.Background(), remoteTarballKey, digest)
+	require.NoError(t, err)
+	contents, _ := ioutil.ReadFile(partialFile)
+	assert.Equal(t, tarballContents, string(contents))
+	assert.Equal(t, string(checksumOf(tarballContents)), hex.EncodeToString(digest.Sum(nil)))
+}
+
+func TestFetcherDownloaderDoesNotRetryMissingFile(t *testing.T) {
+	downloader, _ := newTestFetcherDownloader(t, stringFetcher{})
+	downloader.sleep = func(time.Duration) { t.Error("Expect a missing file not to be retried") }
+
+	_, _, err := downloader.downloadFile(context.Background(), remoteTarballKey, nil)
+	assert.True(t, errors.Is(err, ErrFileNotFound))
+	_, err = downloader.fileSize(context.Background(), remoteTarballKey)
+	assert.True(t, errors.Is(err, ErrFileNotFound))
+}
+
+func TestFetcherDownloaderStopsWhenCanceled(t *testing.T) {
+	downloader, _ := newTestFetcherDownloader(t, stringFetcher{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := downloader.downloadFile(ctx, remoteTarballKey, nil)
+	assert.Equal(t, context.Canceled, err, "Expect no download once canceled")
+}
+
+func TestHTTPFetcherCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, tarballContents)
+	}))
+	defer server.Close()
+	source, err := url.Parse(server.URL + "/agent.tar")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	fetcher := &httpFetcher{client: server.Client()}
+	err = fetcher.Fetch(ctx, source, 0, ioutil.Discard)
+	assert.True(t, errors.Is(err, context.Canceled), "Expect the request to be canceled, got: %v", err)
+	_, err = fetcher.Size(ctx, source)
+	assert.True(t, errors.Is(err, context.Canceled), "Expect the request to be canceled, got: %v", err)
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/agent.tar":
+			http.ServeContent(w, r, "agent.tar", time.Time{}, strings.NewReader(tarballContents))
+		case "/no-range/agent.tar":
+			io.WriteString(w, tarballContents)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	fetcher := &httpFetcher{client: server.Client()}
+	source := func(path string) *url.URL {
+		source, _ := url.Parse(server.URL + path)
+		return source
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, fetcher.Fetch(context.Background(), source("/agent.tar"), 8, &buf))
+	assert.Equal(t, "contents", buf.String())
+	buf.Reset()
+	require.NoError(t, fetcher.Fetch(context.Background(), source("/no-range/agent.tar"), 8, &buf))
+	assert.Equal(t, "contents", buf.String(), "Expect the fetched bytes to be skipped when the range is ignored")
+
+	size, err := fetcher.Size(context.Background(), source("/agent.tar"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(tarballContents)), size)
+
+	err = fetcher.Fetch(context.Background(), source("/agent.tar"), int64(len(tarballContents)), ioutil.Discard)
+	assert.True(t, errors.Is(err, ErrRangeNotSatisfiable))
+	err = fetcher.Fetch(context.Background(), source("/missing.tar"), 0, ioutil.Discard)
+	assert.True(t, errors.Is(err, ErrFileNotFound))
+}
+
+func TestS3Fetcher(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockS3 := NewMocks3ObjectAPI(mockCtrl)
+	gomock.InOrder(
+		mockS3.EXPECT().GetObjectWithContext(gomock.Any(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("agents/agent.tar"),
+			Range:  aws.String("bytes=8-"),
+		}).Return(&s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader("contents"))}, nil),
+		mockS3.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(nil,
+			awserr.NewRequestFailure(awserr.New("NoSuchKey", "The specified key does not exist.", nil), http.StatusNotFound, "id")),
+	)
+
+	fetcher := &s3Fetcher{client: mockS3}
+	source, _ := url.Parse("s3://bucket/agents/agent.tar")
+	var buf bytes.Buffer
+	require.NoError(t, fetcher.Fetch(context.Background(), source, 8, &buf))
+	assert.Equal(t, "contents", buf.String())
+	err := fetcher.Fetch(context.Background(), source, 0, ioutil.Discard)
+	assert.True(t, errors.Is(err, ErrFileNotFound))
+}
+
+func TestFileFetcher(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "agent.tar"), []byte(tarballContents), 0600))
+	fetcher := &fileFetcher{}
+
+	var buf bytes.Buffer
+	require.NoError(t, fetcher.Fetch(context.Background(), &url.URL{Scheme: "file", Path: filepath.Join(dir, "agent.tar")}, 8, &buf))
+	assert.Equal(t, "contents", buf.String())
+	err := fetcher.Fetch(context.Background(), &url.URL{Scheme: "file", Path: filepath.Join(dir, "agent.tar")}, 16, ioutil.Discard)
+	assert.True(t, errors.Is(err, ErrRangeNotSatisfiable))
+	_, err = fetcher.Size(context.Background(), &url.URL{Scheme: "file", Path: filepath.Join(dir, "missing.tar")})
+	assert.True(t, errors.Is(err, ErrFileNotFound))
+}
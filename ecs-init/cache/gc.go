@@ -0,0 +1,135 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// orphanedFileAge is how long a temp file or an Agent image that no locator
+// file names is left untouched before it is collected, so that files still
+// being written by another ecs-init process are kept
+const orphanedFileAge = time.Hour
+
+// stateTempFile matches the temp files of the state files written in the
+// cache directory, which are renamed over the state file once written
+var stateTempFile = regexp.MustCompile(`^(` + strings.Join([]string{
+	regexp.QuoteMeta(filepath.Base(config.CacheState())),
+	regexp.QuoteMeta(filepath.Base(config.RegionState())),
+	regexp.QuoteMeta(filepath.Base(config.EngineStatusFile())),
+	regexp.QuoteMeta(filepath.Base(config.BootState())),
+}, "|") + `)[0-9]+$`)
+
+// GarbageReport is what was removed from the cache by CollectGarbage
+type GarbageReport struct {
+	Files          []string
+	ReclaimedBytes int64
+}
+
+func (r *GarbageReport) add(path string, size int64) {
+	r.Files = append(r.Files, path)
+	r.ReclaimedBytes += size
+}
+
+// CollectGarbage removes from the cache directory the temp files left behind
+// by interrupted writes and downloads, the Agent images that no locator file
+// names anymore, and the previous agents beyond the configured number. The
+// partial download of the pinned Agent is kept to resume it. Collecting stops
+// with the error of ctx once ctx is done, returning what was removed so far.
+func (d *Downloader) CollectGarbage(ctx context.Context) (*GarbageReport, error) {
+	report := &GarbageReport{}
+	files, err := d.fs.ReadDir(config.CacheDirectory())
+	if os.IsNotExist(err) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list the cache directory")
+	}
+	keep := d.referencedCacheFiles()
+	cutoff := time.Now().Add(-orphanedFileAge)
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		path := filepath.Join(config.CacheDirectory(), file.Name())
+		if file.IsDir() || keep[path] || !isCacheGarbage(file.Name()) || file.ModTime().After(cutoff) {
+			continue
+		}
+		d.removeGarbage(report, path, file.Size())
+	}
+
+	previous, err := config.PreviousAgents()
+	if err != nil {
+		log.Warnf("Keeping %d previous agents: %v", previous, err)
+	}
+	d.prunePreviousAgents(previous, report)
+	return report, nil
+}
+
+// isCacheGarbage returns true for the names of the files of the cache
+// directory that may be collected
+func isCacheGarbage(name string) bool {
+	return strings.HasSuffix(name, partialFileSuffix) ||
+		strings.HasSuffix(name, partialFileSuffix+resumeManifestSuffix) ||
+		strings.HasSuffix(name, resumeManifestSuffix+resumeManifestTempSuffix) ||
+		stateTempFile.MatchString(name) ||
+		strings.HasSuffix(name, previousAgentSuffix) ||
+		strings.HasSuffix(name, config.ChecksumFile(previousAgentSuffix))
+}
+
+// referencedCacheFiles returns the files of the cache directory that are
+// never collected: the cached Agent, the images named by the locator files,
+// their checksums, and the partial download of the pinned Agent with its
+// resume manifest
+func (d *Downloader) referencedCacheFiles() map[string]bool {
+	images := []string{config.AgentTarball()}
+	for _, locator := range []string{config.DesiredImageLocatorFile(), config.StandbyImageLocatorFile()} {
+		image, err := d.getImageFile(locator)
+		if err == nil {
+			images = append(images, image)
+		}
+	}
+	keep := make(map[string]bool)
+	for _, image := range images {
+		keep[image] = true
+		keep[config.ChecksumFile(image)] = true
+	}
+	if key, err := config.AgentRemoteTarballKey(d.version()); err == nil {
+		partial := filepath.Join(config.CacheDirectory(), key+partialFileSuffix)
+		keep[partial] = true
+		keep[partial+resumeManifestSuffix] = true
+	}
+	return keep
+}
+
+// removeGarbage removes path, adding it to report once it is gone
+func (d *Downloader) removeGarbage(report *GarbageReport, path string, size int64) {
+	log.Infof("Removing %s from the cache", path)
+	d.fs.Remove(path)
+	if _, err := d.fs.Stat(path); err == nil {
+		log.Warnf("Could not remove %s from the cache", path)
+		return
+	}
+	report.add(path, size)
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cacheFileInfo describes a file of the cache directory
+type cacheFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i cacheFileInfo) Name() string       { return i.name }
+func (i cacheFileInfo) Size() int64        { return i.size }
+func (i cacheFileInfo) Mode() os.FileMode  { return 0600 }
+func (i cacheFileInfo) ModTime() time.Time { return i.modTime }
+func (i cacheFileInfo) IsDir() bool        { return i.dir }
+func (i cacheFileInfo) Sys() interface{}   { return nil }
+
+func cachePath(name string) string {
+	return filepath.Join(config.CacheDirectory(), name)
+}
+
+func TestCollectGarbage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Unsetenv(config.PreviousAgentsEnvVar)
+	pinnedKey, err := config.AgentRemoteTarballKey("v1.36.0")
+	require.NoError(t, err)
+	old := time.Now().Add(-2 * orphanedFileAge)
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadDir(config.CacheDirectory()).Return([]os.FileInfo{
+		cacheFileInfo{name: "ecs-agent.tar", size: 100, modTime: old},
+		cacheFileInfo{name: "ecs-agent.tar.sha256", size: 1, modTime: old},
+		cacheFileInfo{name: "state", size: 1, modTime: old},
+		cacheFileInfo{name: "state123456", size: 2, modTime: old},
+		cacheFileInfo{name: "status987", size: 1, modTime: time.Now()},
+		cacheFileInfo{name: "ecs-agent-v1.30.0.tar.partial", size: 50, modTime: old},
+		cacheFileInfo{name: "ecs-agent-v1.30.0.tar.partial.resume", size: 3, modTime: old},
+		cacheFileInfo{name: pinnedKey + ".partial", size: 50, modTime: old},
+		cacheFileInfo{name: pinnedKey + ".partial.resume", size: 3, modTime: old},
+		cacheFileInfo{name: "desired.tar", size: 100, modTime: old},
+		cacheFileInfo{name: "desired.tar.sha256", size: 1, modTime: old},
+		cacheFileInfo{name: "old-image.tar", size: 100, modTime: old},
+		cacheFileInfo{name: "old-image.tar.sha256", size: 1, modTime: old},
+		cacheFileInfo{name: "previous", modTime: old, dir: true},
+	}, nil)
+	mockFS.EXPECT().Open(config.DesiredImageLocatorFile()).Return(ioutil.NopCloser(bytes.NewBufferString("desired.tar\n")), nil)
+	mockFS.EXPECT().Base("desired.tar\n").Return("desired.tar\n")
+	mockFS.EXPECT().Open(config.StandbyImageLocatorFile()).Return(nil, os.ErrNotExist)
+	mockFS.EXPECT().ReadDir(config.PreviousAgentsDirectory()).Return([]os.FileInfo{
+		cacheFileInfo{name: "ecs-agent-v1.35.0.tar", size: 1000, modTime: old},
+		cacheFileInfo{name: "ecs-agent-v1.34.0.tar", size: 1000, modTime: old.Add(-time.Hour)},
+		cacheFileInfo{name: "ecs-agent-v1.33.0.tar", size: 1000, modTime: old.Add(-2 * time.Hour)},
+	}, nil)
+	removed := []string{
+		cachePath("state123456"),
+		cachePath("ecs-agent-v1.30.0.tar.partial"),
+		cachePath("ecs-agent-v1.30.0.tar.partial.resume"),
+		cachePath("old-image.tar"),
+		cachePath("old-image.tar.sha256"),
+		filepath.Join(config.PreviousAgentsDirectory(), "ecs-agent-v1.33.0.tar"),
+	}
+	for _, path := range removed {
+		mockFS.EXPECT().Remove(path)
+		mockFS.EXPECT().Stat(path).Return(nil, os.ErrNotExist)
+	}
+
+	d := &Downloader{fs: mockFS, agentVersion: "v1.36.0"}
+	report, err := d.CollectGarbage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, removed, report.Files)
+	assert.Equal(t, int64(2+50+3+100+1+1000), report.ReclaimedBytes)
+}
+
+func TestCollectGarbageRemoveFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFSInfo := NewMockfileSizeInfo(mockCtrl)
+	mockFS.EXPECT().ReadDir(config.CacheDirectory()).Return([]os.FileInfo{
+		cacheFileInfo{name: "region42", size: 2, modTime: time.Now().Add(-2 * orphanedFileAge)},
+	}, nil)
+	mockFS.EXPECT().Open(gomock.Any()).Return(nil, os.ErrNotExist).Times(2)
+	mockFS.EXPECT().Remove(cachePath("region42"))
+	mockFS.EXPECT().Stat(cachePath("region42")).Return(mockFSInfo, nil)
+	mockFS.EXPECT().ReadDir(config.PreviousAgentsDirectory()).Return(nil, os.ErrNotExist)
+
+	d := &Downloader{fs: mockFS}
+	report, err := d.CollectGarbage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, report.Files)
+	assert.Zero(t, report.ReclaimedBytes)
+}
+
+func TestCollectGarbageNoCache(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadDir(config.CacheDirectory()).Return(nil, os.ErrNotExist)
+
+	d := &Downloader{fs: mockFS}
+	report, err := d.CollectGarbage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, report.Files)
+}
+
+func TestCollectGarbageListError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadDir(config.CacheDirectory()).Return(nil, errors.New("test error"))
+
+	d := &Downloader{fs: mockFS}
+	_, err := d.CollectGarbage(context.Background())
+	assert.Error(t, err)
+}
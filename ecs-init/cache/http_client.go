@@ -0,0 +1,72 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/faults"
+)
+
+const (
+	// httpDialTimeout bounds establishing the TCP connection
+	httpDialTimeout = 10 * time.Second
+	// httpKeepAlive is the interval of TCP keep-alive probes, which detect
+	// connections dropped by middleboxes on high-latency links
+	httpKeepAlive = 30 * time.Second
+	// httpTLSHandshakeTimeout bounds the TLS handshake
+	httpTLSHandshakeTimeout = 10 * time.Second
+	// httpResponseHeaderTimeout bounds the wait for the response headers of
+	// a request. There is no overall request timeout as the time to
+	// download a part depends on the bandwidth of the instance.
+	httpResponseHeaderTimeout = 30 * time.Second
+	// httpExpectContinueTimeout bounds the wait for a 100-continue response
+	httpExpectContinueTimeout = time.Second
+	// httpIdleConnTimeout is how long an idle connection is kept for reuse
+	httpIdleConnTimeout = 90 * time.Second
+	// httpMaxIdleConnsPerHost is the number of idle connections kept per
+	// bucket endpoint
+	httpMaxIdleConnsPerHost = 4
+	// httpReadBufferSize is the size of the buffer used when reading from
+	// the connection
+	httpReadBufferSize = 256 * 1024
+)
+
+// newHTTPClient returns the http.Client shared by all requests made to
+// download the agent. Connections are kept alive and reused across the
+// checksum and tarball downloads, and HTTP/2 is negotiated with endpoints
+// that support it. A nil tlsConfig uses the default TLS config.
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   httpDialTimeout,
+		KeepAlive: httpKeepAlive,
+	}
+	return &http.Client{
+		Transport: faults.DownloadTransport(&http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSClientConfig:       tlsConfig,
+			TLSHandshakeTimeout:   httpTLSHandshakeTimeout,
+			ResponseHeaderTimeout: httpResponseHeaderTimeout,
+			ExpectContinueTimeout: httpExpectContinueTimeout,
+			IdleConnTimeout:       httpIdleConnTimeout,
+			MaxIdleConnsPerHost:   httpMaxIdleConnsPerHost,
+			ReadBufferSize:        httpReadBufferSize,
+		}),
+	}
+}
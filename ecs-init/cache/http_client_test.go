@@ -0,0 +1,35 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	client := newHTTPClient(nil)
+
+	transport, ok := client.Transport.(*http.Transport)
+	require.True(t, ok, "Expect the client to use an http.Transport")
+	assert.True(t, transport.ForceAttemptHTTP2, "Expect HTTP/2 to be attempted")
+	assert.NotNil(t, transport.Proxy, "Expect proxy settings to be honored")
+	assert.Equal(t, httpResponseHeaderTimeout, transport.ResponseHeaderTimeout)
+	assert.Equal(t, httpMaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.Zero(t, client.Timeout, "Expect no overall request timeout")
+	assert.Nil(t, transport.TLSClientConfig)
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// ErrOffline is wrapped by errors returned when the Agent would have to be
+// downloaded in offline mode
+var ErrOffline = errors.New("the agent cannot be downloaded in offline mode")
+
+// verifySeededAgent caches the Agent pre-seeded for offline mode instead of
+// downloading it. The Agent is read from the file named by the desired image
+// locator file, or else from the cached tarball, and is verified against the
+// SHA-256 sum in the checksum file next to it, as there is no signature to
+// download. An Agent read from the desired image is copied into the cache.
+func (d *Downloader) verifySeededAgent() error {
+	source := config.AgentTarball()
+	if desired, err := d.getDesiredImageFile(); err == nil {
+		source = desired
+	}
+	expectedChecksum, err := d.readLocalChecksum(config.ChecksumFile(source))
+	if err != nil {
+		return fmt.Errorf("%w: no checksum to verify the agent pre-seeded at %s: %v", ErrOffline, source, err)
+	}
+	file, err := d.fs.Open(source)
+	if err != nil {
+		return fmt.Errorf("%w: no agent pre-seeded at %s: %v", ErrOffline, source, err)
+	}
+	defer file.Close()
+
+	sha256hash := sha256.New()
+	if source == config.AgentTarball() {
+		_, err = d.fs.Copy(sha256hash, file)
+		if err != nil {
+			return errors.Wrapf(err, "could not read the agent pre-seeded at %s", source)
+		}
+	} else {
+		err = d.copySeededAgent(d.fs.TeeReader(file, sha256hash))
+		if err != nil {
+			return errors.Wrapf(err, "could not cache the agent pre-seeded at %s", source)
+		}
+	}
+	calculatedChecksum := hex.EncodeToString(sha256hash.Sum(nil))
+	if calculatedChecksum != expectedChecksum {
+		if source != config.AgentTarball() {
+			d.fs.Remove(config.AgentTarball() + partialFileSuffix)
+		}
+		return fmt.Errorf("%w: pre-seeded %q", ErrChecksumMismatch, source)
+	}
+	if source != config.AgentTarball() {
+		d.archiveCachedAgent()
+		err = d.fs.Rename(config.AgentTarball()+partialFileSuffix, config.AgentTarball())
+		if err != nil {
+			return err
+		}
+	}
+	log.Infof("Using the agent pre-seeded at %s", source)
+	err = d.writeCacheState(&cacheState{
+		Status: StatusReloadNeeded,
+		Agent: &CachedAgent{
+			Version:      d.version(),
+			Arch:         config.AgentArch(),
+			SHA256:       calculatedChecksum,
+			DownloadedAt: time.Now().UTC(),
+			SourceURL:    "file://" + source,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return d.fs.Sync(config.CacheDirectory())
+}
+
+// copySeededAgent writes the agent read from seeded to a partial file in the
+// cache, to be renamed into place once verified
+func (d *Downloader) copySeededAgent(seeded io.Reader) error {
+	err := d.fs.MkdirAll(config.CacheDirectory(), os.ModeDir|orwPerm)
+	if err != nil {
+		return err
+	}
+	partial, err := d.fs.OpenFile(config.AgentTarball()+partialFileSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, partialFilePerm)
+	if err != nil {
+		return err
+	}
+	_, err = d.fs.Copy(partial, seeded)
+	if err == nil {
+		err = partial.Sync()
+	}
+	if cerr := partial.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readLocalChecksum reads the SHA-256 sum in file
+func (d *Downloader) readLocalChecksum(file string) (string, error) {
+	checksumFile, err := d.fs.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer checksumFile.Close()
+	data, err := d.fs.ReadAll(checksumFile)
+	if err != nil {
+		return "", err
+	}
+	return parseChecksum(data)
+}
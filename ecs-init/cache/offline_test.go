@@ -0,0 +1,143 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestOfflineDownloader(mockCtrl *gomock.Controller) (*Downloader, *MockfileSystem) {
+	mockFS := NewMockfileSystem(mockCtrl)
+	return &Downloader{
+		fs:      mockFS,
+		region:  config.DefaultRegionName,
+		offline: true,
+	}, mockFS
+}
+
+func expectSeededChecksum(mockFS *MockfileSystem, file string, checksum []byte) []*gomock.Call {
+	reader := ioutil.NopCloser(bytes.NewReader(checksum))
+	return []*gomock.Call{
+		mockFS.EXPECT().Open(config.ChecksumFile(file)).Return(reader, nil),
+		mockFS.EXPECT().ReadAll(reader).Return(checksum, nil),
+	}
+}
+
+func expectSeededTarball(mockFS *MockfileSystem, contents string) []*gomock.Call {
+	reader := ioutil.NopCloser(bytes.NewBufferString(contents))
+	return []*gomock.Call{
+		mockFS.EXPECT().Open(config.AgentTarball()).Return(reader, nil),
+		mockFS.EXPECT().Copy(gomock.Any(), reader).DoAndReturn(io.Copy),
+	}
+}
+
+func TestDownloadAgentOffline(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, mockFS := newTestOfflineDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().Open(config.DesiredImageLocatorFile()).Return(nil, os.ErrNotExist)},
+		expectSeededChecksum(mockFS, config.AgentTarball(), checksumOf(tarballContents)),
+		expectSeededTarball(mockFS, tarballContents),
+		[]*gomock.Call{
+			expectCacheState(t, mockFS, &cacheState{
+				Status: StatusReloadNeeded,
+				Agent: &CachedAgent{
+					Version:   config.DefaultAgentVersion,
+					Arch:      config.AgentArch(),
+					SHA256:    string(checksumOf(tarballContents)),
+					SourceURL: "file://" + config.AgentTarball(),
+				},
+			}),
+			mockFS.EXPECT().Sync(config.CacheDirectory()),
+		},
+	)
+
+	assert.NoError(t, d.DownloadAgent(context.Background()))
+}
+
+func TestDownloadAgentOfflineChecksumMissing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, mockFS := newTestOfflineDownloader(mockCtrl)
+	gomock.InOrder(
+		mockFS.EXPECT().Open(config.DesiredImageLocatorFile()).Return(nil, os.ErrNotExist),
+		mockFS.EXPECT().Open(config.ChecksumFile(config.AgentTarball())).Return(nil, os.ErrNotExist),
+	)
+
+	err := d.DownloadAgent(context.Background())
+	assert.True(t, errors.Is(err, ErrOffline), "Expect the offline error, got %v", err)
+}
+
+func TestDownloadAgentOfflineTarballMissing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, mockFS := newTestOfflineDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().Open(config.DesiredImageLocatorFile()).Return(nil, os.ErrNotExist)},
+		expectSeededChecksum(mockFS, config.AgentTarball(), checksumOf(tarballContents)),
+		[]*gomock.Call{mockFS.EXPECT().Open(config.AgentTarball()).Return(nil, os.ErrNotExist)},
+	)
+
+	err := d.DownloadAgent(context.Background())
+	assert.True(t, errors.Is(err, ErrOffline), "Expect the offline error, got %v", err)
+}
+
+func TestDownloadAgentOfflineChecksumMismatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, mockFS := newTestOfflineDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().Open(config.DesiredImageLocatorFile()).Return(nil, os.ErrNotExist)},
+		expectSeededChecksum(mockFS, config.AgentTarball(), checksumOf("other contents")),
+		expectSeededTarball(mockFS, tarballContents),
+	)
+
+	err := d.DownloadAgent(context.Background())
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "Expect a checksum mismatch, got %v", err)
+	assert.False(t, errors.Is(err, ErrOffline))
+}
+
+func TestStreamAgentOffline(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, mockFS := newTestOfflineDownloader(mockCtrl)
+	gomock.InOrder(
+		mockFS.EXPECT().Open(config.DesiredImageLocatorFile()).Return(nil, os.ErrNotExist),
+		mockFS.EXPECT().Open(config.ChecksumFile(config.AgentTarball())).Return(nil, os.ErrNotExist),
+	)
+
+	loaded, err := d.StreamAgent(context.Background(), func(io.Reader) error {
+		t.Error("Expect nothing to be streamed in offline mode")
+		return nil
+	})
+	assert.False(t, loaded)
+	assert.True(t, errors.Is(err, ErrOffline))
+}
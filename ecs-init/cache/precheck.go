@@ -0,0 +1,159 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// checksumModeHeader asks s3 to return the checksums of an object
+	checksumModeHeader = "x-amz-checksum-mode"
+	// checksumSHA256Header is the base64 encoded SHA-256 checksum s3 keeps
+	// for an object uploaded with one
+	checksumSHA256Header = "x-amz-checksum-sha256"
+)
+
+// ErrPrecheckFailed is wrapped by errors returned when the published tarball
+// is not downloaded as it would not be accepted or not fit in the cache
+var ErrPrecheckFailed = errors.New("published agent failed the pre-download check")
+
+// publishedObject is what a HEAD request tells of a published file
+type publishedObject struct {
+	Size int64
+	ETag string
+	// SHA256 is the hex encoded SHA-256 checksum of the whole file, or an
+	// empty string if the source does not publish one
+	SHA256 string
+}
+
+// parseChecksumSHA256 returns the hex encoded SHA-256 checksum of the value
+// of the checksum header, or an empty string when the header is missing or is
+// the composite checksum of a multipart upload, which is not the digest of
+// the file
+func parseChecksumSHA256(header string) string {
+	if header == "" || strings.Contains(header, "-") {
+		return ""
+	}
+	digest, err := base64.StdEncoding.DecodeString(header)
+	if err != nil || len(digest) != 32 {
+		log.Debugf("Ignoring SHA-256 checksum %q", header)
+		return ""
+	}
+	return hex.EncodeToString(digest)
+}
+
+// headObject describes an object of s3, asking for its checksums
+func headObject(ctx context.Context, client s3HeadAPI, bucket, key string) (publishedObject, error) {
+	var checksum string
+	output, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, func(r *request.Request) {
+		r.HTTPRequest.Header.Set(checksumModeHeader, "ENABLED")
+		r.Handlers.Complete.PushBack(func(r *request.Request) {
+			if r.HTTPResponse != nil {
+				checksum = r.HTTPResponse.Header.Get(checksumSHA256Header)
+			}
+		})
+	})
+	if err != nil {
+		return publishedObject{}, err
+	}
+	return publishedObject{
+		Size:   aws.Int64Value(output.ContentLength),
+		ETag:   aws.StringValue(output.ETag),
+		SHA256: parseChecksumSHA256(checksum),
+	}, nil
+}
+
+// describeResponse describes a file from the response to a HEAD request
+func describeResponse(resp *http.Response) publishedObject {
+	return publishedObject{
+		Size:   resp.ContentLength,
+		ETag:   resp.Header.Get("ETag"),
+		SHA256: parseChecksumSHA256(resp.Header.Get(checksumSHA256Header)),
+	}
+}
+
+// availableSpace returns the bytes available to ecs-init on the file system
+// of path
+func availableSpace(path string) (int64, error) {
+	var stat unix.Statfs_t
+	err := unix.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+// precheckTarball describes the published tarball before it is downloaded,
+// failing early when its size or SHA-256 checksum shows that the download
+// would be rejected, or when it does not fit in the cache directory. The
+// check is skipped when the tarball cannot be described, as the download
+// itself is verified.
+func (d *Downloader) precheckTarball(ctx context.Context, tarballKey string, pipeline *validationPipeline) error {
+	object, err := d.s3Downloader.describeFile(ctx, tarballKey)
+	if err != nil {
+		log.Warnf("Could not describe %s before downloading it: %v", tarballKey, err)
+		return nil
+	}
+	if object.Size <= 0 {
+		return fmt.Errorf("%w: %s is empty", ErrPrecheckFailed, tarballKey)
+	}
+	if object.SHA256 != "" {
+		expected := pipeline.expectedSHA256()
+		if expected != "" && expected != object.SHA256 {
+			return fmt.Errorf("%w: the SHA-256 checksum of %s is %s instead of the published %s",
+				ErrPrecheckFailed, tarballKey, object.SHA256, expected)
+		}
+	}
+
+	needed := object.Size
+	if partial, err := d.fs.Stat(filepath.Join(config.CacheDirectory(), tarballKey+partialFileSuffix)); err == nil {
+		needed -= partial.Size()
+	}
+	space := d.availableSpace
+	if space == nil {
+		space = availableSpace
+	}
+	available, err := space(config.CacheDirectory())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not determine the space available in %s: %v", config.CacheDirectory(), err)
+		}
+		return nil
+	}
+	if needed > available {
+		return fmt.Errorf("%w: %s needs %d more bytes but only %d are available in %s",
+			ErrPrecheckFailed, tarballKey, needed, available, config.CacheDirectory())
+	}
+	return nil
+}
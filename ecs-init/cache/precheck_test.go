@@ -0,0 +1,126 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checksumHeaderOf returns the checksum header s3 returns for contents
+func checksumHeaderOf(contents string) string {
+	digest := sha256.Sum256([]byte(contents))
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+func TestParseChecksumSHA256(t *testing.T) {
+	assert.Equal(t, string(checksumOf(tarballContents)), parseChecksumSHA256(checksumHeaderOf(tarballContents)))
+	assert.Empty(t, parseChecksumSHA256(""))
+	assert.Empty(t, parseChecksumSHA256(checksumHeaderOf(tarballContents)+"-3"), "Expect composite checksums to be ignored")
+	assert.Empty(t, parseChecksumSHA256("bm90IGEgZGlnZXN0"))
+}
+
+func TestDownloadAgentPrecheckChecksumMismatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	signingKey, publicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, publicKey),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSHA256Key, checksumOf(tarballContents)),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSignatureKey, sign(t, signingKey, tarballContents)),
+		[]*gomock.Call{mockS3Downloader.EXPECT().describeFile(gomock.Any(), remoteTarballKey).Return(publishedObject{
+			Size:   int64(len(tarballContents)),
+			SHA256: string(checksumOf("other contents")),
+		}, nil)},
+	)
+
+	err := d.DownloadAgent(context.Background())
+	assert.True(t, errors.Is(err, ErrPrecheckFailed), "Expect the download to fail before it starts, got: %v", err)
+}
+
+func TestDownloadAgentPrecheckNoSpace(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	signingKey, publicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	d.availableSpace = func(path string) (int64, error) {
+		assert.Equal(t, config.CacheDirectory(), path)
+		return 1000, nil
+	}
+	partial := NewMockfileSizeInfo(mockCtrl)
+	partial.EXPECT().Size().Return(int64(500))
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, publicKey),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSHA256Key, checksumOf(tarballContents)),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSignatureKey, sign(t, signingKey, tarballContents)),
+		[]*gomock.Call{
+			mockS3Downloader.EXPECT().describeFile(gomock.Any(), remoteTarballKey).Return(publishedObject{Size: 2000}, nil),
+			mockFS.EXPECT().Stat(filepath.Join(config.CacheDirectory(), remoteTarballKey+partialFileSuffix)).Return(partial, nil),
+		},
+	)
+
+	err := d.DownloadAgent(context.Background())
+	assert.True(t, errors.Is(err, ErrPrecheckFailed), "Expect the download to fail before it starts, got: %v", err)
+}
+
+func TestPrecheckTarballSkippedWhenNotDescribed(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, _, mockS3Downloader := newTestDownloader(mockCtrl)
+	mockS3Downloader.EXPECT().describeFile(gomock.Any(), remoteTarballKey).Return(publishedObject{}, errors.New("access denied"))
+	assert.NoError(t, d.precheckTarball(context.Background(), remoteTarballKey, &validationPipeline{}))
+}
+
+func TestHTTPFetcherDescribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		if r.Header.Get(checksumModeHeader) == "ENABLED" {
+			w.Header().Set(checksumSHA256Header, checksumHeaderOf(tarballContents))
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Content-Length", "16")
+	}))
+	defer server.Close()
+	source, err := url.Parse(server.URL + "/agent.tar")
+	require.NoError(t, err)
+
+	downloader := &fetcherDownloader{fetcher: &httpFetcher{client: server.Client()}, baseURL: source}
+	object, err := downloader.describeFile(context.Background(), "agent.tar")
+	require.NoError(t, err)
+	assert.Equal(t, publishedObject{
+		Size:   16,
+		ETag:   `"abc"`,
+		SHA256: string(checksumOf(tarballContents)),
+	}, object)
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// regionState is the on-disk record of the region resolved from the instance
+// identity document. The instance ID ties the record to the instance that
+// resolved it, so that a host launched from a snapshot of this one does not
+// reuse the region without looking it up again.
+type regionState struct {
+	Region     string `json:"region"`
+	InstanceID string `json:"instanceId"`
+}
+
+// Region returns the region of the instance, or an error wrapping
+// config.ErrRegionUnavailable when it cannot be determined
+func (d *Downloader) Region() (string, error) {
+	return d.getRegion()
+}
+
+// getRegion finds the region and caches it for the life of the downloader
+func (d *Downloader) getRegion() (string, error) {
+	if d.region != "" {
+		return d.region, nil
+	}
+	region, err := d.resolveRegion()
+	if err != nil {
+		return "", err
+	}
+	d.region = region
+	return d.region, nil
+}
+
+// resolveRegion determines the region in order of preference from the
+// override, the persisted region state of the current instance, and instance
+// metadata. A persisted region of an unverified instance is only used if
+// instance metadata cannot be reached.
+func (d *Downloader) resolveRegion() (string, error) {
+	if region := config.RegionOverride(); region != "" {
+		log.Debugf("Using region %s from %s", region, config.RegionOverrideEnvVar)
+		return region, nil
+	}
+
+	state, err := d.loadRegionState()
+	if err != nil {
+		log.Debugf("No persisted region available: %v", err)
+	} else if d.isCurrentInstance(state.InstanceID) {
+		log.Debugf("Using region %s persisted for instance %s", state.Region, state.InstanceID)
+		return state.Region, nil
+	}
+
+	metadataErr := errors.New("no instance metadata in offline mode")
+	if d.metadata != nil {
+		document, err := d.metadata.GetInstanceIdentityDocument()
+		if err == nil && document.Region != "" {
+			d.saveRegionState(regionState{
+				Region:     document.Region,
+				InstanceID: document.InstanceID,
+			})
+			return document.Region, nil
+		}
+		if err == nil {
+			err = errors.New("no region in the instance identity document")
+		}
+		log.Warnf("Could not retrieve the region from EC2 Instance Metadata. Error: %v", err)
+		metadataErr = err
+	}
+
+	if state != nil {
+		log.Warnf("Using previously persisted region %s", state.Region)
+		return state.Region, nil
+	}
+	return "", fmt.Errorf("%w: %v", config.ErrRegionUnavailable, metadataErr)
+}
+
+// regionUnavailableDownloader fails the downloads of a downloader created
+// while the region could not be determined, as no bucket can be chosen
+type regionUnavailableDownloader struct {
+	err error
+}
+
+func (r *regionUnavailableDownloader) downloadFile(ctx context.Context, fileName string, digest hash.Hash) (string, string, error) {
+	return "", "", r.err
+}
+
+func (r *regionUnavailableDownloader) fileSize(ctx context.Context, fileName string) (int64, error) {
+	return 0, r.err
+}
+
+func (r *regionUnavailableDownloader) describeFile(ctx context.Context, fileName string) (publishedObject, error) {
+	return publishedObject{}, r.err
+}
+
+func (r *regionUnavailableDownloader) sourceURLs(fileName string) []string {
+	return nil
+}
+
+func (d *Downloader) loadRegionState() (*regionState, error) {
+	file, err := d.fs.Open(config.RegionState())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := d.fs.ReadAll(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read region state")
+	}
+	var state regionState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse region state")
+	}
+	if state.Region == "" {
+		return nil, errors.New("region state does not contain a region")
+	}
+	return &state, nil
+}
+
+// saveRegionState persists the region for reuse on subsequent boots. Failure
+// to persist the region is not fatal as it will be looked up again.
+func (d *Downloader) saveRegionState(state regionState) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Warnf("Could not encode region state: %v", err)
+		return
+	}
+	err = d.fs.MkdirAll(config.CacheDirectory(), os.ModeDir|orwPerm)
+	if err != nil {
+		log.Warnf("Could not create cache directory to persist region: %v", err)
+		return
+	}
+	err = d.stateWriter.WriteFile(config.RegionState(), data, orwPerm)
+	if err != nil {
+		log.Warnf("Could not persist region: %v", err)
+	}
+}
+
+// InstanceID returns the ID of the instance, as recorded by cloud-init or
+// else from instance metadata
+func (d *Downloader) InstanceID() (string, error) {
+	file, err := d.fs.Open(config.InstanceIDFile())
+	if err == nil {
+		defer file.Close()
+		data, err := d.fs.ReadAll(file)
+		if err == nil && strings.TrimSpace(string(data)) != "" {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+	if d.metadata == nil {
+		return "", errors.New("no instance metadata to get the instance ID from")
+	}
+	document, err := d.metadata.GetInstanceIdentityDocument()
+	if err != nil {
+		return "", errors.Wrap(err, "could not get the instance identity document")
+	}
+	return document.InstanceID, nil
+}
+
+// isCurrentInstance compares the instance ID against the one recorded by
+// cloud-init for this boot, which is available without a metadata request
+func (d *Downloader) isCurrentInstance(instanceID string) bool {
+	if instanceID == "" {
+		return false
+	}
+	file, err := d.fs.Open(config.InstanceIDFile())
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	data, err := d.fs.ReadAll(file)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(data)) == instanceID
+}
@@ -0,0 +1,231 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/imds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRegionOverride(t *testing.T) {
+	os.Setenv(config.RegionOverrideEnvVar, "us-west-2")
+	defer os.Unsetenv(config.RegionOverrideEnvVar)
+
+	d := &Downloader{}
+	region, err := d.getRegion()
+	assert.NoError(t, err)
+	assert.Equal(t, "us-west-2", region)
+}
+
+func TestGetRegionPersistedForCurrentInstance(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockMetadata := NewMockinstanceMetadata(mockCtrl)
+
+	state := ioutil.NopCloser(bytes.NewBufferString(`{"region":"eu-west-1","instanceId":"i-1234"}`))
+	instanceID := ioutil.NopCloser(bytes.NewBufferString("i-1234\n"))
+	gomock.InOrder(
+		mockFS.EXPECT().Open(config.RegionState()).Return(state, nil),
+		mockFS.EXPECT().ReadAll(state).Return(ioutil.ReadAll(state)),
+		mockFS.EXPECT().Open(config.InstanceIDFile()).Return(instanceID, nil),
+		mockFS.EXPECT().ReadAll(instanceID).Return(ioutil.ReadAll(instanceID)),
+	)
+	mockMetadata.EXPECT().GetInstanceIdentityDocument().Times(0)
+
+	d := &Downloader{fs: mockFS, metadata: mockMetadata}
+	region, err := d.getRegion()
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", region)
+}
+
+func TestGetRegionPersistedForOtherInstance(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockMetadata := NewMockinstanceMetadata(mockCtrl)
+	mockStateWriter := NewMockstateWriter(mockCtrl)
+
+	state := ioutil.NopCloser(bytes.NewBufferString(`{"region":"eu-west-1","instanceId":"i-1234"}`))
+	instanceID := ioutil.NopCloser(bytes.NewBufferString("i-5678\n"))
+	gomock.InOrder(
+		mockFS.EXPECT().Open(config.RegionState()).Return(state, nil),
+		mockFS.EXPECT().ReadAll(state).Return(ioutil.ReadAll(state)),
+		mockFS.EXPECT().Open(config.InstanceIDFile()).Return(instanceID, nil),
+		mockFS.EXPECT().ReadAll(instanceID).Return(ioutil.ReadAll(instanceID)),
+		mockMetadata.EXPECT().GetInstanceIdentityDocument().Return(ec2metadata.EC2InstanceIdentityDocument{
+			Region:     "ap-south-1",
+			InstanceID: "i-5678",
+		}, nil),
+		mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|orwPerm),
+		mockStateWriter.EXPECT().WriteFile(config.RegionState(),
+			[]byte(`{"region":"ap-south-1","instanceId":"i-5678"}`), os.FileMode(orwPerm)),
+	)
+
+	d := &Downloader{fs: mockFS, stateWriter: mockStateWriter, metadata: mockMetadata}
+	region, err := d.getRegion()
+	assert.NoError(t, err)
+	assert.Equal(t, "ap-south-1", region)
+}
+
+func TestGetRegionPersistedWhenMetadataUnavailable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockMetadata := NewMockinstanceMetadata(mockCtrl)
+
+	state := ioutil.NopCloser(bytes.NewBufferString(`{"region":"eu-west-1","instanceId":"i-1234"}`))
+	gomock.InOrder(
+		mockFS.EXPECT().Open(config.RegionState()).Return(state, nil),
+		mockFS.EXPECT().ReadAll(state).Return(ioutil.ReadAll(state)),
+		mockFS.EXPECT().Open(config.InstanceIDFile()).Return(nil, errors.New("test error")),
+		mockMetadata.EXPECT().GetInstanceIdentityDocument().Return(
+			ec2metadata.EC2InstanceIdentityDocument{}, errors.New("throttled")),
+	)
+
+	d := &Downloader{fs: mockFS, metadata: mockMetadata}
+	region, err := d.getRegion()
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", region)
+}
+
+func TestGetRegionUnavailable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockMetadata := NewMockinstanceMetadata(mockCtrl)
+
+	gomock.InOrder(
+		mockFS.EXPECT().Open(config.RegionState()).Return(nil, errors.New("test error")),
+		mockMetadata.EXPECT().GetInstanceIdentityDocument().Return(
+			ec2metadata.EC2InstanceIdentityDocument{}, errors.New("test error")),
+	)
+
+	d := &Downloader{fs: mockFS, metadata: mockMetadata}
+	_, err := d.getRegion()
+	assert.True(t, errors.Is(err, config.ErrRegionUnavailable))
+	assert.Contains(t, err.Error(), "test error")
+	// the region is looked up again
+	assert.Empty(t, d.region)
+}
+
+func TestGetRegionIMDSv2OnlyWithoutToken(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	// the token is refused, which IMDSv1 would not need
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"region":"eu-west-1","instanceId":"i-1234"}`))
+	}))
+	defer server.Close()
+	os.Setenv(config.IMDSEndpointEnvVar, server.URL)
+	defer os.Unsetenv(config.IMDSEndpointEnvVar)
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().Open(config.RegionState()).Return(nil, errors.New("test error"))
+
+	d := &Downloader{fs: mockFS, metadata: imds.New(true, 0)}
+	_, err := d.getRegion()
+	assert.True(t, errors.Is(err, config.ErrRegionUnavailable))
+	assert.Contains(t, err.Error(), "IMDSv2 session token")
+}
+
+func TestDownloadAgentRegionUnavailable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|orwPerm)
+
+	regionErr := fmt.Errorf("%w: test error", config.ErrRegionUnavailable)
+	d := &Downloader{
+		fs:           mockFS,
+		s3Downloader: &regionUnavailableDownloader{err: regionErr},
+		verification: []string{"sha256"},
+	}
+	err := d.DownloadAgent(context.Background())
+	assert.True(t, errors.Is(err, config.ErrRegionUnavailable))
+}
+
+func TestInstanceIDFromCloudInit(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockMetadata := NewMockinstanceMetadata(mockCtrl)
+
+	instanceID := ioutil.NopCloser(bytes.NewBufferString("i-1234\n"))
+	gomock.InOrder(
+		mockFS.EXPECT().Open(config.InstanceIDFile()).Return(instanceID, nil),
+		mockFS.EXPECT().ReadAll(instanceID).Return(ioutil.ReadAll(instanceID)),
+	)
+	mockMetadata.EXPECT().GetInstanceIdentityDocument().Times(0)
+
+	d := &Downloader{fs: mockFS, metadata: mockMetadata}
+	id, err := d.InstanceID()
+	assert.NoError(t, err)
+	assert.Equal(t, "i-1234", id)
+}
+
+func TestInstanceIDFromMetadata(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockMetadata := NewMockinstanceMetadata(mockCtrl)
+
+	gomock.InOrder(
+		mockFS.EXPECT().Open(config.InstanceIDFile()).Return(nil, os.ErrNotExist),
+		mockMetadata.EXPECT().GetInstanceIdentityDocument().Return(
+			ec2metadata.EC2InstanceIdentityDocument{InstanceID: "i-5678"}, nil),
+	)
+
+	d := &Downloader{fs: mockFS, metadata: mockMetadata}
+	id, err := d.InstanceID()
+	assert.NoError(t, err)
+	assert.Equal(t, "i-5678", id)
+}
+
+func TestInstanceIDUnavailable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().Open(config.InstanceIDFile()).Return(nil, os.ErrNotExist)
+
+	d := &Downloader{fs: mockFS}
+	_, err := d.InstanceID()
+	assert.Error(t, err)
+}
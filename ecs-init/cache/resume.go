@@ -0,0 +1,231 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"encoding"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// resumeManifestSuffix is appended to the name of a partial file for the
+	// manifest recording how much of the partial file is durable
+	resumeManifestSuffix = ".resume"
+	// resumeManifestTempSuffix is appended to the name of a resume manifest
+	// while it is written, before it is renamed over the manifest
+	resumeManifestTempSuffix = ".tmp"
+	// resumeCheckpointInterval is how many bytes are downloaded between two
+	// checkpoints of a partial file. At most this many bytes are downloaded
+	// again when the host reboots in the middle of a download.
+	resumeCheckpointInterval = 4 * downloadPartSize
+)
+
+// resumeManifest records what a partial file is a prefix of and how much of
+// it was synced to disk, so that a download interrupted by a reboot resumes
+// from bytes that are known to have survived it
+type resumeManifest struct {
+	// Source is the URL the partial file is downloaded from
+	Source string `json:"source"`
+	// ETag is the entity tag of the file when the download started, if the
+	// source has one
+	ETag string `json:"etag,omitempty"`
+	// Bytes is the length of the prefix of the partial file that was synced
+	Bytes int64 `json:"bytes"`
+	// HashState is the marshaled state of the digest of the prefix, which
+	// spares reading the prefix back to hash it on resume
+	HashState []byte `json:"hashState,omitempty"`
+}
+
+// resumeCheckpoint checkpoints a partial file as it is downloaded
+type resumeCheckpoint struct {
+	fs       fileSystem
+	file     *os.File
+	digest   hash.Hash
+	manifest resumeManifest
+	next     int64
+}
+
+// resumePartial positions file, a partial download of source, where its
+// download resumes and returns that offset along with the checkpoint of the
+// download. The partial file is cut back to its last checkpoint, as the bytes
+// past it may not have survived a reboot, and is started over when it was
+// checkpointed for another source or another version of the file. When the
+// returned bool is true, digest already covers the bytes before the offset.
+func resumePartial(fs fileSystem, file *os.File, source, etag string, digest hash.Hash) (*resumeCheckpoint, int64, bool, error) {
+	checkpoint := &resumeCheckpoint{
+		fs:       fs,
+		file:     file,
+		digest:   digest,
+		manifest: resumeManifest{Source: source, ETag: etag},
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, false, errors.Wrap(err, "could not determine size of partial download")
+	}
+	manifest, err := checkpoint.read()
+	if err != nil {
+		// a partial file is resumed as is when the download was interrupted
+		// before its first checkpoint
+		if !os.IsNotExist(errors.Cause(err)) {
+			log.Warnf("Ignoring the resume manifest of %s: %v", file.Name(), err)
+		}
+		checkpoint.next = size + resumeCheckpointInterval
+		return checkpoint, size, false, nil
+	}
+
+	offset := manifest.Bytes
+	switch {
+	case manifest.Source != source:
+		log.Warnf("Partial download %s is of %s, downloading %s again", file.Name(), manifest.Source, source)
+		offset = 0
+	case etag != "" && manifest.ETag != "" && manifest.ETag != etag:
+		log.Warnf("%s changed since its download started, downloading it again", source)
+		offset = 0
+	case offset > size:
+		log.Warnf("Partial download %s is shorter than its last checkpoint, downloading it again", file.Name())
+		offset = 0
+	case offset < size:
+		log.Infof("Discarding %d bytes of %s past its last checkpoint", size-offset, file.Name())
+	}
+	if offset != size {
+		err = file.Truncate(offset)
+		if err != nil {
+			return nil, 0, false, errors.Wrap(err, "could not truncate partial download")
+		}
+	}
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, 0, false, errors.Wrap(err, "could not seek in partial download")
+	}
+
+	hashed := false
+	if offset > 0 && digest != nil && len(manifest.HashState) > 0 {
+		if unmarshaler, ok := digest.(encoding.BinaryUnmarshaler); ok {
+			digest.Reset()
+			err = unmarshaler.UnmarshalBinary(manifest.HashState)
+			if err != nil {
+				log.Warnf("Could not restore the digest of %s, hashing it again: %v", file.Name(), err)
+			}
+			hashed = err == nil
+		}
+	}
+	if offset == 0 {
+		checkpoint.remove()
+	}
+	checkpoint.manifest.Bytes = offset
+	checkpoint.next = offset + resumeCheckpointInterval
+	return checkpoint, offset, hashed, nil
+}
+
+// path returns the path of the resume manifest of the partial file
+func (c *resumeCheckpoint) path() string {
+	return c.file.Name() + resumeManifestSuffix
+}
+
+// read reads the resume manifest of the partial file
+func (c *resumeCheckpoint) read() (*resumeManifest, error) {
+	file, err := c.fs.Open(c.path())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := c.fs.ReadAll(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read resume manifest")
+	}
+	manifest := &resumeManifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse resume manifest")
+	}
+	return manifest, nil
+}
+
+// advance checkpoints the partial file once offset, the length of the prefix
+// written in order, is an interval past the last checkpoint
+func (c *resumeCheckpoint) advance(offset int64) {
+	if c == nil || offset < c.next {
+		return
+	}
+	c.save(offset)
+}
+
+// save syncs the first length bytes of the partial file and records them,
+// together with the state of the digest hashing them, in the manifest.
+// Failing to checkpoint only means more is downloaded again on resume.
+func (c *resumeCheckpoint) save(length int64) {
+	if c == nil || length <= 0 {
+		return
+	}
+	c.next = length + resumeCheckpointInterval
+	err := c.file.Sync()
+	if err != nil {
+		log.Warnf("Could not checkpoint partial download %s: %v", c.file.Name(), err)
+		return
+	}
+	manifest := c.manifest
+	manifest.Bytes = length
+	manifest.HashState = nil
+	if marshaler, ok := c.digest.(encoding.BinaryMarshaler); ok {
+		manifest.HashState, err = marshaler.MarshalBinary()
+		if err != nil {
+			log.Debugf("Could not checkpoint the digest of %s: %v", c.file.Name(), err)
+		}
+	}
+	data, err := json.Marshal(manifest)
+	if err == nil {
+		err = c.fs.WriteFile(c.path()+resumeManifestTempSuffix, data, partialFilePerm)
+	}
+	if err == nil {
+		err = c.fs.Rename(c.path()+resumeManifestTempSuffix, c.path())
+	}
+	if err != nil {
+		log.Warnf("Could not checkpoint partial download %s: %v", c.file.Name(), err)
+		return
+	}
+	c.manifest = manifest
+}
+
+// checkpointWriter writes to the partial file from offset onwards,
+// checkpointing it as it grows
+type checkpointWriter struct {
+	writer     io.Writer
+	offset     int64
+	checkpoint *resumeCheckpoint
+}
+
+func (w *checkpointWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.offset += int64(n)
+	w.checkpoint.advance(w.offset)
+	return n, err
+}
+
+// remove removes the resume manifest once the partial file is complete or
+// started over
+func (c *resumeCheckpoint) remove() {
+	if c == nil {
+		return
+	}
+	c.fs.Remove(c.path())
+	c.manifest.Bytes = 0
+	c.manifest.HashState = nil
+	c.next = resumeCheckpointInterval
+}
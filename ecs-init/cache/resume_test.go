@@ -0,0 +1,112 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeResumeManifest writes the resume manifest of partialFile checkpointed
+// after the first length bytes of the tarball
+func writeResumeManifest(t *testing.T, partialFile, source string, length int) {
+	digest := sha256.New()
+	digest.Write([]byte(tarballContents[:length]))
+	state, err := digest.(encoding.BinaryMarshaler).MarshalBinary()
+	require.NoError(t, err)
+	data, err := json.Marshal(resumeManifest{Source: source, Bytes: int64(length), HashState: state})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(partialFile+resumeManifestSuffix, data, 0600))
+}
+
+func TestS3BucketDownloaderResumesFromCheckpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	bucketDownloader, mockS3, partialFile := newTestBucketDownloader(t, mockCtrl)
+	defer os.RemoveAll(filepath.Dir(partialFile))
+	// the bytes past the checkpoint did not survive the reboot
+	require.NoError(t, ioutil.WriteFile(partialFile, []byte("tarball \x00\x00\x00"), 0600))
+	writeResumeManifest(t, partialFile, "s3://bucket/"+remoteTarballKey, 8)
+	mockS3.EXPECT().DownloadWithContext(gomock.Any(), gomock.Any(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String(remoteTarballKey),
+		Range:  aws.String("bytes=8-"),
+	}).Do(writeObject("contents", 0))
+
+	digest := sha256.New()
+	_, err := bucketDownloader.download(context.Background(), remoteTarballKey, filepath.Dir(partialFile), &standardFS{}, digest)
+	require.NoError(t, err)
+	contents, _ := ioutil.ReadFile(partialFile)
+	assert.Equal(t, tarballContents, string(contents))
+	assert.Equal(t, string(checksumOf(tarballContents)), hex.EncodeToString(digest.Sum(nil)),
+		"Expect digest to be restored from the checkpoint")
+	_, err = os.Stat(partialFile + resumeManifestSuffix)
+	assert.True(t, os.IsNotExist(err), "Expect the resume manifest to be removed once the download completes")
+}
+
+func TestS3BucketDownloaderRestartsPartialFileOfAnotherSource(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	bucketDownloader, mockS3, partialFile := newTestBucketDownloader(t, mockCtrl)
+	defer os.RemoveAll(filepath.Dir(partialFile))
+	require.NoError(t, ioutil.WriteFile(partialFile, []byte("other fi"), 0600))
+	writeResumeManifest(t, partialFile, "s3://other-bucket/"+remoteTarballKey, 8)
+	mockS3.EXPECT().DownloadWithContext(gomock.Any(), gomock.Any(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String(remoteTarballKey),
+	}).Do(writeObject(tarballContents, 0))
+
+	digest := sha256.New()
+	_, err := bucketDownloader.download(context.Background(), remoteTarballKey, filepath.Dir(partialFile), &standardFS{}, digest)
+	require.NoError(t, err)
+	contents, _ := ioutil.ReadFile(partialFile)
+	assert.Equal(t, tarballContents, string(contents))
+	assert.Equal(t, string(checksumOf(tarballContents)), hex.EncodeToString(digest.Sum(nil)))
+}
+
+func TestS3BucketDownloaderCheckpointsFailedDownload(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	bucketDownloader, mockS3, partialFile := newTestBucketDownloader(t, mockCtrl)
+	defer os.RemoveAll(filepath.Dir(partialFile))
+	mockS3.EXPECT().DownloadWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Do(writeObject("tarball ", 0)).
+		Return(int64(8), errors.New("connection reset"))
+
+	_, err := bucketDownloader.download(context.Background(), remoteTarballKey, filepath.Dir(partialFile), &standardFS{}, sha256.New())
+	require.Error(t, err)
+	data, err := ioutil.ReadFile(partialFile + resumeManifestSuffix)
+	require.NoError(t, err, "Expect the interrupted download to be checkpointed")
+	manifest := resumeManifest{}
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	assert.Equal(t, "s3://bucket/"+remoteTarballKey, manifest.Source)
+	assert.Equal(t, int64(8), manifest.Bytes)
+	assert.NotEmpty(t, manifest.HashState)
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	previousAgentPrefix = "ecs-agent-"
+	previousAgentSuffix = ".tar"
+)
+
+// cacheRollback records that the cached agent was rolled back from a version
+// that failed to the version of a previously cached agent
+type cacheRollback struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// previousAgentFile returns where the cached agent of version is kept once it
+// is replaced
+func previousAgentFile(version string) string {
+	return filepath.Join(config.PreviousAgentsDirectory(), previousAgentPrefix+version+previousAgentSuffix)
+}
+
+// archiveCachedAgent keeps the cached agent to roll back to before it is
+// replaced by a newly downloaded one, and removes the oldest previous agents
+// beyond the configured number
+func (d *Downloader) archiveCachedAgent() {
+	keep, err := config.PreviousAgents()
+	if err != nil {
+		log.Warnf("Keeping %d previous agents: %v", keep, err)
+	}
+	if keep == 0 || !d.fileNotEmpty(config.AgentTarball()) {
+		return
+	}
+	err = d.fs.MkdirAll(config.PreviousAgentsDirectory(), os.ModeDir|orwPerm)
+	if err != nil {
+		log.Warnf("Could not keep the cached agent to roll back to: %v", err)
+		return
+	}
+	version := d.CachedAgent().Version
+	err = d.fs.Rename(config.AgentTarball(), previousAgentFile(version))
+	if err != nil {
+		log.Warnf("Could not keep the cached agent to roll back to: %v", err)
+		return
+	}
+	log.Infof("Keeping cached agent %s to roll back to", version)
+	d.prunePreviousAgents(keep, &GarbageReport{})
+}
+
+// prunePreviousAgents removes the oldest previous agents beyond keep, adding
+// them to report
+func (d *Downloader) prunePreviousAgents(keep int, report *GarbageReport) {
+	previous, err := d.previousAgentFiles()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not list previous agents: %v", err)
+		}
+		return
+	}
+	for i, file := range previous {
+		if i < keep {
+			continue
+		}
+		log.Infof("Removing previous agent %s", previousAgentVersion(file.Name()))
+		d.removeGarbage(report, filepath.Join(config.PreviousAgentsDirectory(), file.Name()), file.Size())
+	}
+}
+
+// previousAgents returns the versions of the previously cached agents, the
+// most recently downloaded first
+func (d *Downloader) previousAgents() ([]string, error) {
+	files, err := d.previousAgentFiles()
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, file := range files {
+		versions = append(versions, previousAgentVersion(file.Name()))
+	}
+	return versions, nil
+}
+
+// previousAgentFiles returns the files of the previously cached agents, the
+// most recently downloaded first
+func (d *Downloader) previousAgentFiles() ([]os.FileInfo, error) {
+	files, err := d.fs.ReadDir(config.PreviousAgentsDirectory())
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	var previous []os.FileInfo
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, previousAgentPrefix) || !strings.HasSuffix(name, previousAgentSuffix) {
+			continue
+		}
+		previous = append(previous, file)
+	}
+	return previous, nil
+}
+
+// previousAgentVersion returns the version of the previous agent file name
+func previousAgentVersion(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, previousAgentPrefix), previousAgentSuffix)
+}
+
+// RollbackAgent replaces the cached agent, which failed, with the most
+// recently downloaded previous agent of another version and returns its
+// version. The rollback is recorded in the cache state, so that the rolled
+// back agent is kept until another version than the one that failed is
+// wanted.
+func (d *Downloader) RollbackAgent() (string, error) {
+	failed := d.CachedAgent().Version
+	previous, err := d.previousAgents()
+	if err != nil && !os.IsNotExist(err) {
+		return "", errors.Wrap(err, "could not list previous agents")
+	}
+	for _, version := range previous {
+		if version == failed {
+			continue
+		}
+		err = d.fs.Rename(previousAgentFile(version), config.AgentTarball())
+		if err != nil {
+			return "", errors.Wrapf(err, "could not restore previous agent %s", version)
+		}
+		// the restored agent takes precedence over the loaded image of
+		// the agent that failed
+		err = d.writeCacheState(&cacheState{
+			Status:   StatusReloadNeeded,
+			Agent:    &CachedAgent{Version: version, SourceURL: "file://" + previousAgentFile(version)},
+			Rollback: &cacheRollback{From: failed, To: version},
+		})
+		if err != nil {
+			return "", err
+		}
+		log.Warnf("Rolled back the cached agent from %s to %s", failed, version)
+		return version, nil
+	}
+	return "", errors.Errorf("no previous agent to roll back to from %s", failed)
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// previousAgentInfo describes a previous agent tarball downloaded at modTime
+type previousAgentInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (i previousAgentInfo) Name() string       { return i.name }
+func (i previousAgentInfo) Size() int64        { return 1 }
+func (i previousAgentInfo) Mode() os.FileMode  { return 0600 }
+func (i previousAgentInfo) ModTime() time.Time { return i.modTime }
+func (i previousAgentInfo) IsDir() bool        { return false }
+func (i previousAgentInfo) Sys() interface{}   { return nil }
+
+func previousAgentInfos(versions ...string) []os.FileInfo {
+	var infos []os.FileInfo
+	now := time.Now()
+	for i, version := range versions {
+		infos = append(infos, previousAgentInfo{
+			name:    "ecs-agent-" + version + ".tar",
+			modTime: now.Add(-time.Duration(i) * time.Hour),
+		})
+	}
+	return infos
+}
+
+func expectCachedAgentVersion(mockFS *MockfileSystem, version string) []*gomock.Call {
+	state := fmt.Sprintf(`{"status": 1, "agent": {"version": %q}}`, version)
+	return []*gomock.Call{
+		mockFS.EXPECT().Open(config.CacheState()).Return(ioutil.NopCloser(bytes.NewBufferString(state)), nil),
+	}
+}
+
+func TestArchiveCachedAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Unsetenv(config.PreviousAgentsEnvVar)
+	previous := previousAgentInfos("v1.37.0", "v1.36.0", "v1.35.0")
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFSInfo := NewMockfileSizeInfo(mockCtrl)
+	mockFSInfo.EXPECT().Size().Return(int64(1))
+	inOrder(
+		[]*gomock.Call{
+			mockFS.EXPECT().Stat(config.AgentTarball()).Return(mockFSInfo, nil),
+			mockFS.EXPECT().MkdirAll(config.PreviousAgentsDirectory(), os.ModeDir|0700),
+		},
+		expectCachedAgentVersion(mockFS, "v1.37.0"),
+		[]*gomock.Call{
+			mockFS.EXPECT().Rename(config.AgentTarball(), config.PreviousAgentsDirectory()+"/ecs-agent-v1.37.0.tar"),
+			// listed out of order, the oldest beyond the 2 kept is removed
+			mockFS.EXPECT().ReadDir(config.PreviousAgentsDirectory()).Return(
+				[]os.FileInfo{previous[2], previous[0], previous[1]}, nil),
+			mockFS.EXPECT().Remove(config.PreviousAgentsDirectory() + "/ecs-agent-v1.35.0.tar"),
+			mockFS.EXPECT().Stat(config.PreviousAgentsDirectory()+"/ecs-agent-v1.35.0.tar").Return(nil, os.ErrNotExist),
+		},
+	)
+
+	d := &Downloader{fs: mockFS}
+	d.archiveCachedAgent()
+}
+
+func TestArchiveCachedAgentDisabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.PreviousAgentsEnvVar, "0")
+	defer os.Unsetenv(config.PreviousAgentsEnvVar)
+
+	d := &Downloader{fs: NewMockfileSystem(mockCtrl)}
+	d.archiveCachedAgent()
+}
+
+func TestRollbackAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	inOrder(
+		expectCachedAgentVersion(mockFS, "v1.37.0"),
+		[]*gomock.Call{
+			mockFS.EXPECT().ReadDir(config.PreviousAgentsDirectory()).Return(previousAgentInfos("v1.37.0", "v1.36.0"), nil),
+			mockFS.EXPECT().Rename(config.PreviousAgentsDirectory()+"/ecs-agent-v1.36.0.tar", config.AgentTarball()),
+			expectCacheState(t, mockFS, &cacheState{
+				Status:   StatusReloadNeeded,
+				Agent:    &CachedAgent{Version: "v1.36.0", SourceURL: "file://" + config.PreviousAgentsDirectory() + "/ecs-agent-v1.36.0.tar"},
+				Rollback: &cacheRollback{From: "v1.37.0", To: "v1.36.0"},
+			}),
+		},
+	)
+
+	d := &Downloader{fs: mockFS}
+	version, err := d.RollbackAgent()
+	require.NoError(t, err)
+	assert.Equal(t, "v1.36.0", version)
+	assert.Equal(t, &cacheRollback{From: "v1.37.0", To: "v1.36.0"}, d.state.Rollback)
+}
+
+func TestRollbackAgentNoPreviousAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	inOrder(
+		expectCachedAgentVersion(mockFS, "v1.37.0"),
+		[]*gomock.Call{
+			mockFS.EXPECT().ReadDir(config.PreviousAgentsDirectory()).Return(nil, os.ErrNotExist),
+		},
+	)
+
+	d := &Downloader{fs: mockFS}
+	_, err := d.RollbackAgent()
+	assert.Error(t, err)
+	assert.Nil(t, d.state.Rollback)
+}
+
+func TestRecordCachedAgentKeepsRollback(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockStateWriter := NewMockstateWriter(mockCtrl)
+	gomock.InOrder(
+		mockFS.EXPECT().Open(config.CacheState()).Return(
+			ioutil.NopCloser(bytes.NewBufferString(`{"status":1,"rollback":{"from":"v1.37.0","to":"v1.36.0"}}`)), nil),
+		mockStateWriter.EXPECT().WriteFile(config.CacheState(),
+			[]byte(`{"status":1,"rollback":{"from":"v1.37.0","to":"v1.36.0"}}`), os.FileMode(0700)),
+	)
+
+	d := &Downloader{fs: mockFS, stateWriter: mockStateWriter}
+	assert.NoError(t, d.RecordCachedAgent())
+}
+
+func TestAgentCacheStatusKeepsRolledBackAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFSInfo := NewMockfileSizeInfo(mockCtrl)
+	mockFSInfo.EXPECT().Size().Return(int64(1)).AnyTimes()
+	inOrder(
+		[]*gomock.Call{
+			mockFS.EXPECT().Stat(config.CacheState()).Return(mockFSInfo, nil),
+			mockFS.EXPECT().Stat(config.AgentTarball()).Return(mockFSInfo, nil),
+			mockFS.EXPECT().Open(config.CacheState()).Return(ioutil.NopCloser(bytes.NewBufferString(
+				`{"status": 1, "agent": {"version": "v1.36.0"}, "rollback": {"from": "v1.37.0", "to": "v1.36.0"}}`)), nil),
+		},
+	)
+
+	d := &Downloader{fs: mockFS}
+	d.PinAgentVersion("1.37.0")
+	assert.Equal(t, StatusCached, d.AgentCacheStatus(), "Expect the rolled back agent to be kept for the version that failed")
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+)
+
+// ErrSignatureInvalid is wrapped by errors returned when the downloaded agent
+// is not signed by the agent signing key
+var ErrSignatureInvalid = errors.New("downloaded agent signature is invalid")
+
+// parseChecksum parses a published SHA-256 sum, either alone or in the
+// format of sha256sum, which follows the sum with the name of the file
+func parseChecksum(data []byte) (string, error) {
+	return parseHexDigest(data, sha256.Size, "SHA-256")
+}
+
+// parseHexDigest parses a published digest of size bytes, such as a SHA-256
+// or MD5 sum, either alone or followed by the name of the file
+func parseHexDigest(data []byte, size int, algorithm string) (string, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", errors.New("empty checksum")
+	}
+	checksum := strings.ToLower(fields[0])
+	decoded, err := hex.DecodeString(checksum)
+	if err != nil || len(decoded) != size {
+		return "", errors.Errorf("invalid %s checksum %q", algorithm, fields[0])
+	}
+	return checksum, nil
+}
+
+// parseSigningKey parses an ASCII armored PGP public key, as published by
+// AWS for the agent
+func parseSigningKey(data []byte) (openpgp.EntityList, error) {
+	keyRing, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse PGP public key")
+	}
+	return keyRing, nil
+}
+
+// verifySignature verifies the ASCII armored detached PGP signature of the
+// signed contents, as published next to the agent tarball in its .asc file
+func verifySignature(keyRing openpgp.KeyRing, signed io.Reader, signature []byte) error {
+	_, err := openpgp.CheckArmoredDetachedSignature(keyRing, signed, bytes.NewReader(signature))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// newTestSigningKey generates a PGP signing key and returns it together
+// with its ASCII armored public key
+func newTestSigningKey(t *testing.T) (*openpgp.Entity, []byte) {
+	key, err := openpgp.NewEntity("Test Agent Signing Key", "", "test@example.com", nil)
+	require.NoError(t, err)
+	var publicKey bytes.Buffer
+	writer, err := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, key.Serialize(writer))
+	require.NoError(t, writer.Close())
+	return key, publicKey.Bytes()
+}
+
+// sign returns the ASCII armored detached signature of contents
+func sign(t *testing.T, key *openpgp.Entity, contents string) []byte {
+	var signature bytes.Buffer
+	require.NoError(t, openpgp.ArmoredDetachSign(&signature, key, strings.NewReader(contents), nil))
+	return signature.Bytes()
+}
+
+// checksumOf returns the hex encoded SHA-256 sum of contents
+func checksumOf(contents string) []byte {
+	digest := sha256.Sum256([]byte(contents))
+	return []byte(hex.EncodeToString(digest[:]))
+}
+
+func TestParseChecksum(t *testing.T) {
+	checksum := string(checksumOf(tarballContents))
+	cases := []struct {
+		name  string
+		data  string
+		isErr bool
+	}{
+		{"sum only", checksum, false},
+		{"sha256sum format", checksum + "  ecs-agent.tar\n", false},
+		{"upper case", strings.ToUpper(checksum), false},
+		{"empty", "", true},
+		{"md5", "d41d8cd98f00b204e9800998ecf8427e", true},
+		{"not hex", strings.Repeat("z", 64), true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := parseChecksum([]byte(test.data))
+			if test.isErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, checksum, parsed)
+		})
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	_, publicKey := newTestSigningKey(t)
+	keyRing, err := parseSigningKey(publicKey)
+	require.NoError(t, err)
+	assert.Len(t, keyRing, 1)
+
+	_, err = parseSigningKey([]byte("not a key"))
+	assert.Error(t, err, "Expect data that is not an armored key to be rejected")
+}
+
+func TestVerifySignature(t *testing.T) {
+	key, publicKey := newTestSigningKey(t)
+	keyRing, err := parseSigningKey(publicKey)
+	require.NoError(t, err)
+
+	signature := sign(t, key, tarballContents)
+	assert.NoError(t, verifySignature(keyRing, strings.NewReader(tarballContents), signature))
+
+	err = verifySignature(keyRing, strings.NewReader("other contents"), signature)
+	assert.True(t, errors.Is(err, ErrSignatureInvalid), "Expect invalid signature error, got: %v", err)
+
+	otherKey, _ := newTestSigningKey(t)
+	err = verifySignature(keyRing, strings.NewReader(tarballContents), sign(t, otherKey, tarballContents))
+	assert.True(t, errors.Is(err, ErrSignatureInvalid), "Expect signature of another key to be rejected, got: %v", err)
+
+	err = verifySignature(keyRing, strings.NewReader(tarballContents), []byte("not armored"))
+	assert.True(t, errors.Is(err, ErrSignatureInvalid), "Expect invalid signature error, got: %v", err)
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// IsAgentOutdated returns true when the cached agent is not the agent
+// published for the pinned version, e.g. as a newer agent was published
+// under the latest version since it was downloaded. Only the checksum file
+// published next to the tarball is downloaded and compared to the checksum
+// of the cached tarball, so that the engine can download the agent again
+// only when it changed. An agent that is not cached is outdated.
+func (d *Downloader) IsAgentOutdated(ctx context.Context) (bool, error) {
+	if d.offline {
+		return false, ErrOffline
+	}
+	if d.AgentCacheStatus() == StatusUncached {
+		return true, nil
+	}
+	defer d.closeIdleConnections()
+	cachedChecksum, err := d.cachedChecksum()
+	if err != nil {
+		return false, err
+	}
+	publishedChecksum, err := d.getPublishedChecksum(ctx)
+	if err != nil {
+		return false, err
+	}
+	if cachedChecksum == publishedChecksum {
+		log.Debugf("Cached agent %s is the published agent", d.version())
+		return false, nil
+	}
+	log.Infof("Cached agent %s (sha256 %s) is not the published agent (sha256 %s)",
+		d.version(), cachedChecksum, publishedChecksum)
+	return true, nil
+}
+
+// cachedChecksum returns the SHA-256 sum of the cached tarball, which is
+// recorded in the cache state when the tarball was downloaded by ecs-init and
+// is computed from the tarball otherwise, e.g. for the agent distributed with
+// the package
+func (d *Downloader) cachedChecksum() (string, error) {
+	if checksum := d.CachedAgent().SHA256; checksum != "" {
+		return checksum, nil
+	}
+	file, err := d.fs.Open(config.AgentTarball())
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open the cached agent")
+	}
+	defer file.Close()
+	sha256hash := sha256.New()
+	_, err = d.fs.Copy(sha256hash, file)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read the cached agent")
+	}
+	return hex.EncodeToString(sha256hash.Sum(nil)), nil
+}
+
+// PublishedAgentSize returns the size of the tarball published for the
+// pinned version, which is what downloading the agent again would fetch
+func (d *Downloader) PublishedAgentSize(ctx context.Context) (int64, error) {
+	if d.offline {
+		return 0, ErrOffline
+	}
+	defer d.closeIdleConnections()
+	objectKey, err := config.AgentRemoteTarballKey(d.version())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to determine published tarball")
+	}
+	size, err := d.s3Downloader.fileSize(ctx, objectKey)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get the size of the published tarball")
+	}
+	return size, nil
+}
+
+// PublishedAgentURLs returns the URLs downloading the agent fetches the
+// checksum, the signature and the tarball of the pinned version from, without
+// fetching them
+func (d *Downloader) PublishedAgentURLs() ([]string, error) {
+	if d.offline {
+		return nil, ErrOffline
+	}
+	var urls []string
+	for _, objectKey := range []func(string) (string, error){
+		config.AgentRemoteTarballSHA256Key,
+		config.AgentRemoteTarballSignatureKey,
+		config.AgentRemoteTarballKey,
+	} {
+		key, err := objectKey(d.version())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to determine published files")
+		}
+		urls = append(urls, d.s3Downloader.sourceURLs(key)...)
+	}
+	return urls, nil
+}
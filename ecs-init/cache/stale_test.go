@@ -0,0 +1,199 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// expectCachedAgentState expects the cache to hold a tarball described by
+// state
+func expectCachedAgentState(mockCtrl *gomock.Controller, mockFS *MockfileSystem, d *Downloader, state *cacheState) {
+	mockFSInfo := NewMockfileSizeInfo(mockCtrl)
+	mockFSInfo.EXPECT().Size().Return(int64(1)).AnyTimes()
+	mockFS.EXPECT().Stat(config.CacheState()).Return(mockFSInfo, nil)
+	mockFS.EXPECT().Stat(config.AgentTarball()).Return(mockFSInfo, nil)
+	d.state = state
+}
+
+func TestIsAgentOutdated(t *testing.T) {
+	cases := []struct {
+		name      string
+		cached    string
+		published string
+		outdated  bool
+	}{
+		{"same agent", tarballContents, tarballContents, false},
+		{"newer agent published", tarballContents, "newer tarball contents", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+			expectCachedAgentState(mockCtrl, mockFS, d, &cacheState{
+				Status: StatusCached,
+				Agent: &CachedAgent{
+					Version: config.DefaultAgentVersion,
+					SHA256:  string(checksumOf(c.cached)),
+				},
+			})
+			inOrder(expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSHA256Key,
+				[]byte(string(checksumOf(c.published))+"  "+remoteTarballKey+"\n")))
+
+			outdated, err := d.IsAgentOutdated(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, c.outdated, outdated)
+		})
+	}
+}
+
+func TestIsAgentOutdatedHashesPackagedAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	expectCachedAgent(mockCtrl, mockFS, StatusCached, "")
+	tarball := ioutil.NopCloser(bytes.NewBufferString(tarballContents))
+	inOrder(
+		[]*gomock.Call{
+			mockFS.EXPECT().Open(config.AgentTarball()).Return(tarball, nil),
+			mockFS.EXPECT().Copy(gomock.Any(), tarball).DoAndReturn(io.Copy),
+		},
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSHA256Key, checksumOf(tarballContents)),
+	)
+
+	outdated, err := d.IsAgentOutdated(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, outdated)
+}
+
+func TestIsAgentOutdatedUncached(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	mockFS.EXPECT().Stat(config.CacheState()).Return(nil, errors.New("test error"))
+	mockS3Downloader.EXPECT().downloadFile(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	outdated, err := d.IsAgentOutdated(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, outdated)
+}
+
+func TestIsAgentOutdatedChecksumFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	expectCachedAgentState(mockCtrl, mockFS, d, &cacheState{
+		Status: StatusCached,
+		Agent:  &CachedAgent{Version: config.DefaultAgentVersion, SHA256: string(checksumOf(tarballContents))},
+	})
+	mockS3Downloader.EXPECT().downloadFile(gomock.Any(), remoteTarballSHA256Key, nil).Return("", "", errors.New("test error"))
+
+	_, err := d.IsAgentOutdated(context.Background())
+	assert.Error(t, err)
+}
+
+func TestIsAgentOutdatedOffline(t *testing.T) {
+	d := &Downloader{offline: true}
+
+	_, err := d.IsAgentOutdated(context.Background())
+	assert.True(t, errors.Is(err, ErrOffline))
+}
+
+func TestPublishedAgentSize(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, _, mockS3Downloader := newTestDownloader(mockCtrl)
+	mockS3Downloader.EXPECT().fileSize(gomock.Any(), remoteTarballKey).Return(int64(1024), nil)
+
+	size, err := d.PublishedAgentSize(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024), size)
+}
+
+func TestPublishedAgentSizeFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, _, mockS3Downloader := newTestDownloader(mockCtrl)
+	mockS3Downloader.EXPECT().fileSize(gomock.Any(), remoteTarballKey).Return(int64(0), errors.New("test error"))
+
+	_, err := d.PublishedAgentSize(context.Background())
+	assert.Error(t, err)
+}
+
+func TestPublishedAgentURLs(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	d, _, mockS3Downloader := newTestDownloader(mockCtrl)
+	gomock.InOrder(
+		mockS3Downloader.EXPECT().sourceURLs(remoteTarballSHA256Key).Return([]string{"s3://bucket/" + remoteTarballSHA256Key}),
+		mockS3Downloader.EXPECT().sourceURLs(remoteTarballSignatureKey).Return([]string{"s3://bucket/" + remoteTarballSignatureKey}),
+		mockS3Downloader.EXPECT().sourceURLs(remoteTarballKey).Return([]string{"s3://bucket/" + remoteTarballKey}),
+	)
+
+	urls, err := d.PublishedAgentURLs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"s3://bucket/" + remoteTarballSHA256Key,
+		"s3://bucket/" + remoteTarballSignatureKey,
+		"s3://bucket/" + remoteTarballKey,
+	}, urls)
+}
+
+func TestS3DownloaderSourceURLs(t *testing.T) {
+	downloader := &s3Downloader{bucketDownloaders: []*s3BucketDownloader{
+		{bucket: "partition"},
+		{bucket: "regional"},
+	}}
+	assert.Equal(t, []string{"s3://partition/agent.tar", "s3://regional/agent.tar"}, downloader.sourceURLs("agent.tar"))
+}
+
+func TestS3DownloaderFileSizeFromSecondBucket(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	missing := NewMocks3HeadAPI(mockCtrl)
+	found := NewMocks3HeadAPI(mockCtrl)
+	missing.EXPECT().HeadObjectWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("not found"))
+	found.EXPECT().HeadObjectWithContext(gomock.Any(), &s3.HeadObjectInput{
+		Bucket: aws.String("regional"),
+		Key:    aws.String(remoteTarballKey),
+	}, gomock.Any()).Return(&s3.HeadObjectOutput{ContentLength: aws.Int64(2048)}, nil)
+
+	downloader := &s3Downloader{bucketDownloaders: []*s3BucketDownloader{
+		{bucket: "partition", head: missing},
+		{bucket: "regional", head: found},
+	}}
+	size, err := downloader.fileSize(context.Background(), remoteTarballKey)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2048), size)
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// CachedAgent describes the agent in the cache, as recorded in the cache
+// state file
+type CachedAgent struct {
+	// Version is the version of the agent, which is empty when no agent is
+	// cached
+	Version string `json:"version"`
+	// Arch is the architecture the tarball was downloaded for, which is
+	// empty for agents not downloaded by ecs-init
+	Arch string `json:"arch,omitempty"`
+	// SHA256 is the checksum of the downloaded tarball
+	SHA256 string `json:"sha256,omitempty"`
+	// DownloadedAt is when the tarball was downloaded
+	DownloadedAt time.Time `json:"downloadedAt"`
+	// SourceURL is where the tarball was downloaded from
+	SourceURL string `json:"sourceURL,omitempty"`
+}
+
+func (a CachedAgent) String() string {
+	if a.SourceURL == "" {
+		return a.Version
+	}
+	return fmt.Sprintf("%s (sha256 %s, downloaded %s from %s)",
+		a.Version, a.SHA256, a.DownloadedAt.Format(time.RFC3339), a.SourceURL)
+}
+
+// cacheState is the content of the cache state file
+type cacheState struct {
+	Status CacheStatus `json:"status"`
+	// Agent is nil for the agent distributed with the package, which is of
+	// the default version
+	Agent *CachedAgent `json:"agent,omitempty"`
+	// Rollback is set once the cached agent was rolled back
+	Rollback *cacheRollback `json:"rollback,omitempty"`
+}
+
+// parseCacheState parses the cache state file. The state file written by the
+// packaging only holds the status, e.g. "2", and is parsed as a state without
+// an agent.
+func parseCacheState(data []byte) (*cacheState, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		state := &cacheState{}
+		err := json.Unmarshal(data, state)
+		if err != nil {
+			return nil, err
+		}
+		return state, nil
+	}
+	var status CacheStatus
+	_, err := fmt.Sscanf(string(data), "%d", &status)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheState{Status: status}, nil
+}
+
+// currentState returns the cache state, which is read once unless the cached
+// agent was rolled back or downloaded since
+func (d *Downloader) currentState() *cacheState {
+	if d.state == nil {
+		d.state = d.readCacheState()
+	}
+	return d.state
+}
+
+// readCacheState reads the cache state file. A missing or invalid state file
+// is read as StatusUncached.
+func (d *Downloader) readCacheState() *cacheState {
+	file, err := d.fs.Open(config.CacheState())
+	if err != nil {
+		return &cacheState{}
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		log.Warnf("Could not read the cache state: %v", err)
+		return &cacheState{}
+	}
+	state, err := parseCacheState(data)
+	if err != nil {
+		log.Warnf("Could not parse the cache state: %v", err)
+		return &cacheState{}
+	}
+	return state
+}
+
+// writeCacheState records state right away, as the tarball it describes was
+// just replaced
+func (d *Downloader) writeCacheState(state *cacheState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the cache state")
+	}
+	err = d.fs.WriteFile(config.CacheState(), data, orwPerm)
+	if err != nil {
+		return errors.Wrap(err, "failed to record the cache state")
+	}
+	d.state = state
+	return nil
+}
+
+// CachedAgent returns the agent recorded in the cache state. The agent
+// distributed with the package is only known by its version, while the
+// version is empty if no agent is cached.
+func (d *Downloader) CachedAgent() CachedAgent {
+	state := d.currentState()
+	if state.Agent != nil && state.Agent.Version != "" {
+		return *state.Agent
+	}
+	if state.Status == StatusUncached {
+		return CachedAgent{}
+	}
+	return CachedAgent{Version: config.DefaultAgentVersion}
+}
+
+// AgentVersion returns the version of the agent that is downloaded and
+// accepted from the cache
+func (d *Downloader) AgentVersion() string {
+	return d.version()
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCacheState(t *testing.T) {
+	downloadedAt := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	var cases = []struct {
+		name     string
+		data     string
+		expected *cacheState
+	}{
+		{"packaged", "2\n", &cacheState{Status: StatusReloadNeeded}},
+		{"downloaded", `{"status":1,"agent":{"version":"v1.37.0","sha256":"abc","downloadedAt":"2020-06-01T12:00:00Z","sourceURL":"s3://bucket/key"}}`,
+			&cacheState{
+				Status: StatusCached,
+				Agent: &CachedAgent{
+					Version:      "v1.37.0",
+					SHA256:       "abc",
+					DownloadedAt: downloadedAt,
+					SourceURL:    "s3://bucket/key",
+				},
+			}},
+	}
+	for _, testcase := range cases {
+		t.Run(testcase.name, func(t *testing.T) {
+			state, err := parseCacheState([]byte(testcase.data))
+			require.NoError(t, err)
+			assert.Equal(t, testcase.expected, state)
+		})
+	}
+}
+
+func TestParseCacheStateInvalid(t *testing.T) {
+	for _, data := range []string{"", "spurious", `{"status":`} {
+		_, err := parseCacheState([]byte(data))
+		assert.Error(t, err, "Expect %q to be invalid", data)
+	}
+}
+
+func TestCachedAgent(t *testing.T) {
+	var cases = []struct {
+		name     string
+		data     string
+		expected CachedAgent
+	}{
+		{"uncached", "0", CachedAgent{}},
+		{"packaged", "1", CachedAgent{Version: config.DefaultAgentVersion}},
+		{"downloaded", `{"status":1,"agent":{"version":"v1.37.0","sha256":"abc"}}`, CachedAgent{Version: "v1.37.0", SHA256: "abc"}},
+	}
+	for _, testcase := range cases {
+		t.Run(testcase.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockFS := NewMockfileSystem(mockCtrl)
+			mockFS.EXPECT().Open(config.CacheState()).Return(ioutil.NopCloser(bytes.NewBufferString(testcase.data)), nil)
+
+			d := &Downloader{fs: mockFS}
+			assert.Equal(t, testcase.expected, d.CachedAgent())
+			assert.Equal(t, testcase.expected, d.CachedAgent(), "Expect the state to be read once")
+		})
+	}
+}
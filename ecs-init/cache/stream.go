@@ -0,0 +1,97 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"hash"
+	"io"
+)
+
+// streamHoldback is how many bytes at the end of the tarball are held back
+// from the stream until the download is verified. It covers the two zero
+// blocks that end a tar archive, so the reader cannot see a complete archive
+// before the tarball is known to be the published one.
+const streamHoldback = 1024
+
+// errStreamRestarted fails a stream when the digest is reset after bytes
+// were already streamed, e.g. when a download is restarted from the start
+var errStreamRestarted = errors.New("download restarted while streaming")
+
+// streamDigest feeds the bytes written to the digest into a pipe as well, so
+// that a tarball can be consumed while it is downloaded. The stream fails
+// rather than skipping bytes, as only the digest can be computed again from
+// the downloaded file.
+type streamDigest struct {
+	hash.Hash
+	pipe *io.PipeWriter
+	held []byte
+	// streamed is set once bytes were written to the pipe
+	streamed bool
+	err      error
+}
+
+func newStreamDigest(digest hash.Hash, pipe *io.PipeWriter) *streamDigest {
+	return &streamDigest{Hash: digest, pipe: pipe}
+}
+
+func (s *streamDigest) Write(p []byte) (int, error) {
+	s.Hash.Write(p)
+	if s.err != nil {
+		return len(p), nil
+	}
+	s.held = append(s.held, p...)
+	if len(s.held) <= streamHoldback {
+		return len(p), nil
+	}
+	release := len(s.held) - streamHoldback
+	_, err := s.pipe.Write(s.held[:release])
+	if err != nil {
+		s.err = err
+		return len(p), nil
+	}
+	s.streamed = true
+	s.held = append(s.held[:0], s.held[release:]...)
+	return len(p), nil
+}
+
+// Reset resets the digest, failing the stream if bytes were written to it
+func (s *streamDigest) Reset() {
+	s.Hash.Reset()
+	if s.streamed || len(s.held) > 0 {
+		s.fail(errStreamRestarted)
+	}
+}
+
+// commit writes the held back bytes and ends the stream
+func (s *streamDigest) commit() error {
+	if s.err != nil {
+		return s.err
+	}
+	_, err := s.pipe.Write(s.held)
+	if err != nil {
+		s.fail(err)
+		return err
+	}
+	return s.pipe.Close()
+}
+
+// fail ends the stream with err instead of the held back bytes
+func (s *streamDigest) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+	s.held = nil
+	s.pipe.CloseWithError(s.err)
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readStream reads the stream in the background and returns the result
+func readStream(reader io.Reader) <-chan []byte {
+	result := make(chan []byte, 1)
+	go func() {
+		data, _ := ioutil.ReadAll(reader)
+		result <- data
+	}()
+	return result
+}
+
+func TestStreamDigestHoldsBackTail(t *testing.T) {
+	reader, writer := io.Pipe()
+	stream := newStreamDigest(sha256.New(), writer)
+	contents := bytes.Repeat([]byte("a"), 3*streamHoldback)
+
+	streamed := make([]byte, 2*streamHoldback)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(reader, streamed)
+		done <- err
+	}()
+	stream.Write(contents[:streamHoldback])
+	stream.Write(contents[streamHoldback:])
+	require.NoError(t, <-done)
+	assert.Equal(t, contents[:2*streamHoldback], streamed)
+
+	rest := readStream(reader)
+	require.NoError(t, stream.commit())
+	assert.Equal(t, contents[2*streamHoldback:], <-rest)
+	digest := sha256.Sum256(contents)
+	assert.Equal(t, digest[:], stream.Sum(nil))
+}
+
+func TestStreamDigestFail(t *testing.T) {
+	reader, writer := io.Pipe()
+	stream := newStreamDigest(sha256.New(), writer)
+	stream.Write([]byte("contents"))
+
+	testErr := errors.New("test error")
+	stream.fail(testErr)
+	_, err := ioutil.ReadAll(reader)
+	assert.Equal(t, testErr, err, "Expect the held back bytes to be replaced by the error")
+	assert.Equal(t, testErr, stream.commit())
+}
+
+func TestStreamDigestResetAfterWrite(t *testing.T) {
+	reader, writer := io.Pipe()
+	stream := newStreamDigest(sha256.New(), writer)
+	stream.Reset()
+	stream.Write([]byte("contents"))
+	stream.Reset()
+
+	_, err := ioutil.ReadAll(reader)
+	assert.Equal(t, errStreamRestarted, err)
+}
+
+func TestStreamAgentSuccess(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	signingKey, publicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, publicKey),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSHA256Key, checksumOf(tarballContents)),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSignatureKey, sign(t, signingKey, tarballContents)),
+		expectDescribedTarball(mockFS, mockS3Downloader, remoteTarballKey),
+		[]*gomock.Call{
+			expectPublishedTarball(mockS3Downloader, "/tmp/agent", tarballContents),
+			expectReadTarball(mockFS, "/tmp/agent", tarballContents),
+			mockFS.EXPECT().Stat(config.AgentTarball()).Return(nil, os.ErrNotExist),
+			mockFS.EXPECT().Rename("/tmp/agent", config.AgentTarball()),
+			mockFS.EXPECT().WriteFile(config.CacheState(), gomock.Any(), gomock.Any()),
+			mockFS.EXPECT().Sync(config.CacheDirectory()),
+			mockFS.EXPECT().Stat("/tmp/agent").Return(nil, errors.New("temp file has been renamed")),
+		},
+	)
+
+	var loadedContents []byte
+	loaded, err := d.StreamAgent(context.Background(), func(image io.Reader) error {
+		var err error
+		loadedContents, err = ioutil.ReadAll(image)
+		return err
+	})
+	require.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, tarballContents, string(loadedContents))
+}
+
+func TestStreamAgentChecksumMismatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	signingKey, publicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, publicKey),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSHA256Key, checksumOf("other contents")),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSignatureKey, sign(t, signingKey, tarballContents)),
+		expectDescribedTarball(mockFS, mockS3Downloader, remoteTarballKey),
+		[]*gomock.Call{
+			expectPublishedTarball(mockS3Downloader, "/tmp/agent", tarballContents),
+			mockFS.EXPECT().Stat("/tmp/agent").Return(nil, nil),
+			mockFS.EXPECT().Remove("/tmp/agent"),
+		},
+	)
+
+	var loadErr error
+	loaded, err := d.StreamAgent(context.Background(), func(image io.Reader) error {
+		_, loadErr = ioutil.ReadAll(image)
+		return loadErr
+	})
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "Expect checksum mismatch error, got: %v", err)
+	assert.False(t, loaded)
+	assert.Equal(t, err, loadErr, "Expect the load to fail instead of reading the whole tarball")
+}
+
+func TestStreamAgentLoadFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	signingKey, publicKey := newTestSigningKey(t)
+	d, mockFS, mockS3Downloader := newTestDownloader(mockCtrl)
+	inOrder(
+		[]*gomock.Call{mockFS.EXPECT().MkdirAll(config.CacheDirectory(), os.ModeDir|0700)},
+		expectSigningKey(mockFS, publicKey),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSHA256Key, checksumOf(tarballContents)),
+		expectPublishedFile(mockFS, mockS3Downloader, remoteTarballSignatureKey, sign(t, signingKey, tarballContents)),
+		expectDescribedTarball(mockFS, mockS3Downloader, remoteTarballKey),
+		[]*gomock.Call{
+			expectPublishedTarball(mockS3Downloader, "/tmp/agent", tarballContents),
+			expectReadTarball(mockFS, "/tmp/agent", tarballContents),
+			mockFS.EXPECT().Stat(config.AgentTarball()).Return(nil, os.ErrNotExist),
+			mockFS.EXPECT().Rename("/tmp/agent", config.AgentTarball()),
+			mockFS.EXPECT().WriteFile(config.CacheState(), gomock.Any(), gomock.Any()),
+			mockFS.EXPECT().Sync(config.CacheDirectory()),
+			mockFS.EXPECT().Stat("/tmp/agent").Return(nil, errors.New("temp file has been renamed")),
+		},
+	)
+
+	// the load fails without reading the stream, which must not block the
+	// download
+	loaded, err := d.StreamAgent(context.Background(), func(image io.Reader) error {
+		return errors.New("test error")
+	})
+	require.NoError(t, err)
+	assert.False(t, loaded, "Expect the cached tarball to be loaded instead")
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// downloadTLSConfig returns the TLS config of the connections made to
+// download the Agent, or nil to use the defaults. The CA bundle is trusted
+// along with the system certificates, so that a TLS-intercepting proxy can be
+// trusted without losing direct access to S3, and the client certificate is
+// presented to servers that ask for one.
+func downloadTLSConfig() (*tls.Config, error) {
+	caBundle := config.CABundle()
+	certFile, keyFile := config.ClientCertificate()
+	if caBundle == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{}
+	if caBundle != "" {
+		pool, err := loadCABundle(caBundle)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Trusting the CA certificates in %s", caBundle)
+		tlsConfig.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.Errorf("both %s and %s have to be set to present a client certificate",
+				config.ClientCertEnvVar, config.ClientKeyEnvVar)
+		}
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not load the client certificate")
+		}
+		log.Infof("Presenting the client certificate in %s", certFile)
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// loadCABundle returns the system certificate pool with the certificates of
+// the PEM file caBundle added
+func loadCABundle(caBundle string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(caBundle)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read the CA bundle")
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		log.Warnf("Only trusting the CA certificates in %s: %v", caBundle, err)
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("no certificates found in the CA bundle %s", caBundle)
+	}
+	return pool, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key to dir
+// and returns their files
+func writeTestCertificate(t *testing.T, dir string, name string) (certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+// writeServerCA writes the certificate of server to dir as a CA bundle
+func writeServerCA(t *testing.T, dir string, server *httptest.Server) string {
+	caBundle := filepath.Join(dir, "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caBundle, data, 0600))
+	return caBundle
+}
+
+func setTLSEnv(t *testing.T, caBundle, certFile, keyFile string) {
+	t.Setenv(config.CABundleEnvVar, caBundle)
+	t.Setenv(config.ClientCertEnvVar, certFile)
+	t.Setenv(config.ClientKeyEnvVar, keyFile)
+}
+
+func TestDownloadTLSConfigDefault(t *testing.T) {
+	tlsConfig, err := downloadTLSConfig()
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+}
+
+func TestDownloadTLSConfigTrustsCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	dir := t.TempDir()
+	setTLSEnv(t, writeServerCA(t, dir, server), "", "")
+
+	tlsConfig, err := downloadTLSConfig()
+	require.NoError(t, err)
+	response, err := newHTTPClient(tlsConfig).Get(server.URL)
+	require.NoError(t, err)
+	response.Body.Close()
+
+	// the server is not trusted without the CA bundle
+	_, err = newHTTPClient(nil).Get(server.URL)
+	assert.Error(t, err)
+}
+
+func TestDownloadTLSConfigPresentsClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir, "ecs-init")
+	setTLSEnv(t, writeServerCA(t, dir, server), certFile, keyFile)
+
+	tlsConfig, err := downloadTLSConfig()
+	require.NoError(t, err)
+	response, err := newHTTPClient(tlsConfig).Get(server.URL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ecs-init", string(body))
+}
+
+func TestDownloadTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir, "ecs-init")
+	notPEM := filepath.Join(dir, "not-pem")
+	require.NoError(t, ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600))
+
+	cases := []struct {
+		name     string
+		caBundle string
+		certFile string
+		keyFile  string
+	}{
+		{"missing CA bundle", filepath.Join(dir, "missing"), "", ""},
+		{"CA bundle without certificates", notPEM, "", ""},
+		{"certificate without key", "", certFile, ""},
+		{"key without certificate", "", "", keyFile},
+		{"invalid key", "", certFile, notPEM},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			setTLSEnv(t, test.caBundle, test.certFile, test.keyFile)
+			_, err := downloadTLSConfig()
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"golang.org/x/crypto/openpgp"
+)
+
+// ErrValidationFailed is wrapped by errors returned when the downloaded agent
+// is rejected by a validator other than those of its checksum and signature
+var ErrValidationFailed = errors.New("downloaded agent failed validation")
+
+const (
+	// md5Suffix is the suffix of the MD5 sum published next to the tarball
+	md5Suffix = ".md5"
+	// signatureSuffix is the suffix of the detached PGP signature published
+	// next to the tarball
+	signatureSuffix = ".asc"
+	// provenanceSuffix is the suffix of the in-toto provenance statement
+	// published next to the tarball
+	provenanceSuffix = ".provenance.json"
+)
+
+// Validator verifies a downloaded agent before it is accepted into the
+// cache. A Validator is created for each download, so that what Prepare
+// fetches can be kept for Validate. ctx is that of the download.
+type Validator interface {
+	// Prepare fetches what the agent is verified against before the agent
+	// is downloaded, so that the download is not made when it is missing
+	Prepare(ctx context.Context, published PublishedFiles) error
+	// Validate returns an error when the agent is not to be accepted
+	Validate(ctx context.Context, artifact *Artifact) error
+}
+
+// PublishedFiles are the files published next to the tarball of the agent
+type PublishedFiles interface {
+	// Fetch returns the contents of the file published under the name of
+	// the tarball followed by suffix, such as ".sha256"
+	Fetch(ctx context.Context, suffix string) ([]byte, error)
+	// TarballSize returns the size of the published tarball
+	TarballSize(ctx context.Context) (int64, error)
+}
+
+// Artifact is a downloaded agent awaiting validation
+type Artifact struct {
+	// Version is the version of the agent
+	Version string
+	// Name is the name of the tarball
+	Name string
+	// File is the file the tarball was downloaded to
+	File string
+	// SHA256 is the SHA-256 digest of the tarball, computed while it was
+	// downloaded
+	SHA256 []byte
+	// SourceURL is where the tarball was downloaded from
+	SourceURL string
+}
+
+// Open opens the downloaded tarball, e.g. to scan it
+func (a *Artifact) Open() (io.ReadCloser, error) {
+	return os.Open(a.File)
+}
+
+var (
+	validatorsLock sync.RWMutex
+	validators     = make(map[string]func() (Validator, error))
+)
+
+// RegisterValidator registers the validator named name, which the agent
+// verification policy can list, replacing the built-in validator of the name
+// if any. newValidator is called for each download.
+func RegisterValidator(name string, newValidator func() (Validator, error)) {
+	validatorsLock.Lock()
+	defer validatorsLock.Unlock()
+	validators[strings.ToLower(name)] = newValidator
+}
+
+// builtinValidators are the names of the validators of the cache package
+var builtinValidators = map[string]bool{
+	"size":       true,
+	"md5":        true,
+	"sha256":     true,
+	"signature":  true,
+	"provenance": true,
+}
+
+// checkVerificationPolicy returns an error when a validator of the policy is
+// neither registered nor built in, so that a misconfigured policy fails
+// before an agent is downloaded
+func checkVerificationPolicy(policy []string) error {
+	validatorsLock.RLock()
+	defer validatorsLock.RUnlock()
+	for _, name := range policy {
+		if _, ok := validators[name]; !ok && !builtinValidators[name] {
+			return fmt.Errorf("no agent validator named %q", name)
+		}
+	}
+	for _, name := range policy {
+		if name == "signature" {
+			return nil
+		}
+	}
+	log.Warnf("Agent verification policy %s does not verify the signature of the agent", strings.Join(policy, ","))
+	return nil
+}
+
+// newValidator returns the validator registered as name, or else the
+// built-in size, md5, sha256, signature or provenance validator
+func (d *Downloader) newValidator(name string) (Validator, error) {
+	validatorsLock.RLock()
+	newValidator, ok := validators[name]
+	validatorsLock.RUnlock()
+	if ok {
+		return newValidator()
+	}
+	switch name {
+	case "size":
+		return &sizeValidator{fs: d.fs}, nil
+	case "md5":
+		return &md5Validator{fs: d.fs}, nil
+	case "sha256":
+		return &sha256Validator{}, nil
+	case "signature":
+		// the key is loaded first, as nothing can be verified without it
+		keyRing, err := d.loadSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		return &signatureValidator{fs: d.fs, keyRing: keyRing}, nil
+	case "provenance":
+		return &provenanceValidator{}, nil
+	}
+	return nil, fmt.Errorf("no agent validator named %q", name)
+}
+
+// verificationPolicy returns the names of the validators of the policy,
+// which is the default policy unless another one is configured
+func (d *Downloader) verificationPolicy() []string {
+	if len(d.verification) == 0 {
+		policy, _ := config.AgentVerification()
+		return policy
+	}
+	return d.verification
+}
+
+// validationPipeline is the chain of validators a downloaded agent has to
+// pass, in the order of the verification policy
+type validationPipeline struct {
+	names      []string
+	validators []Validator
+}
+
+// newValidationPipeline creates the validators of the verification policy
+func (d *Downloader) newValidationPipeline() (*validationPipeline, error) {
+	pipeline := &validationPipeline{}
+	for _, name := range d.verificationPolicy() {
+		validator, err := d.newValidator(name)
+		if err != nil {
+			return nil, err
+		}
+		pipeline.names = append(pipeline.names, name)
+		pipeline.validators = append(pipeline.validators, validator)
+	}
+	return pipeline, nil
+}
+
+// prepare prepares the validators in order, before the agent is downloaded
+func (p *validationPipeline) prepare(ctx context.Context, published PublishedFiles) error {
+	for i, validator := range p.validators {
+		err := validator.Prepare(ctx, published)
+		if err != nil {
+			return fmt.Errorf("could not prepare agent validator %s: %w", p.names[i], err)
+		}
+	}
+	return nil
+}
+
+// expectedSHA256 returns the published SHA-256 checksum the sha256 validator
+// prepared, or an empty string if the policy does not check it
+func (p *validationPipeline) expectedSHA256() string {
+	for _, validator := range p.validators {
+		if v, ok := validator.(*sha256Validator); ok {
+			return v.checksum
+		}
+	}
+	return ""
+}
+
+// validate runs the validators in order and returns the error of the first
+// one that rejects the agent
+func (p *validationPipeline) validate(ctx context.Context, artifact *Artifact) error {
+	for i, validator := range p.validators {
+		err := validator.Validate(ctx, artifact)
+		if err == nil {
+			log.Debugf("Agent %s passed validator %s", artifact.Name, p.names[i])
+			continue
+		}
+		if !errors.Is(err, ErrChecksumMismatch) && !errors.Is(err, ErrSignatureInvalid) &&
+			!errors.Is(err, ErrValidationFailed) {
+			err = fmt.Errorf("%w: %s: %v", ErrValidationFailed, p.names[i], err)
+		}
+		return fmt.Errorf("%w: %q", err, artifact.Name)
+	}
+	return nil
+}
+
+// publishedFiles fetches the files published next to the tarball of the
+// version of the downloader
+type publishedFiles struct {
+	downloader *Downloader
+	tarballKey string
+}
+
+func (f *publishedFiles) Fetch(ctx context.Context, suffix string) ([]byte, error) {
+	return f.downloader.getPublishedFile(ctx, f.tarballKey+suffix, strings.TrimPrefix(suffix, "."))
+}
+
+func (f *publishedFiles) TarballSize(ctx context.Context) (int64, error) {
+	return f.downloader.s3Downloader.fileSize(ctx, f.tarballKey)
+}
+
+// sizeValidator verifies the size of the tarball against the size of the
+// published tarball
+type sizeValidator struct {
+	fs   fileSystem
+	size int64
+}
+
+func (v *sizeValidator) Prepare(ctx context.Context, published PublishedFiles) error {
+	var err error
+	v.size, err = published.TarballSize(ctx)
+	return err
+}
+
+func (v *sizeValidator) Validate(ctx context.Context, artifact *Artifact) error {
+	info, err := v.fs.Stat(artifact.File)
+	if err != nil {
+		return err
+	}
+	if info.Size() != v.size {
+		return fmt.Errorf("%w: size is %d bytes instead of %d", ErrValidationFailed, info.Size(), v.size)
+	}
+	return nil
+}
+
+// md5Validator verifies the tarball against its published MD5 sum. The
+// tarball is read again, as only its SHA-256 digest is computed while it is
+// downloaded.
+type md5Validator struct {
+	fs       fileSystem
+	checksum string
+}
+
+func (v *md5Validator) Prepare(ctx context.Context, published PublishedFiles) error {
+	data, err := published.Fetch(ctx, md5Suffix)
+	if err != nil {
+		return err
+	}
+	v.checksum, err = parseHexDigest(data, md5.Size, "MD5")
+	return err
+}
+
+func (v *md5Validator) Validate(ctx context.Context, artifact *Artifact) error {
+	file, err := v.fs.Open(artifact.File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	digest := md5.New()
+	_, err = v.fs.Copy(digest, file)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(digest.Sum(nil)) != v.checksum {
+		return fmt.Errorf("%w: MD5", ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// sha256Validator verifies the tarball against its published SHA-256 sum
+type sha256Validator struct {
+	checksum string
+}
+
+func (v *sha256Validator) Prepare(ctx context.Context, published PublishedFiles) error {
+	data, err := published.Fetch(ctx, ".sha256")
+	if err != nil {
+		return err
+	}
+	v.checksum, err = parseChecksum(data)
+	return err
+}
+
+func (v *sha256Validator) Validate(ctx context.Context, artifact *Artifact) error {
+	calculatedChecksum := hex.EncodeToString(artifact.SHA256)
+	log.Debugf("Expected SHA-256 %q", v.checksum)
+	log.Debugf("Calculated SHA-256 %q", calculatedChecksum)
+	if calculatedChecksum != v.checksum {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// signatureValidator verifies the tarball against its published PGP
+// signature with the agent signing key. Like the MD5 sum, the signature
+// covers the tarball itself, which is read again.
+type signatureValidator struct {
+	fs        fileSystem
+	keyRing   openpgp.KeyRing
+	signature []byte
+}
+
+func (v *signatureValidator) Prepare(ctx context.Context, published PublishedFiles) error {
+	var err error
+	v.signature, err = published.Fetch(ctx, signatureSuffix)
+	return err
+}
+
+func (v *signatureValidator) Validate(ctx context.Context, artifact *Artifact) error {
+	file, err := v.fs.Open(artifact.File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return verifySignature(v.keyRing, file, v.signature)
+}
+
+// provenanceStatement is the part of an in-toto statement that names the
+// artifacts it is about
+type provenanceStatement struct {
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+}
+
+// provenanceValidator verifies that the published provenance statement of
+// the tarball, such as a SLSA provenance, is about the downloaded tarball
+type provenanceValidator struct {
+	statement provenanceStatement
+}
+
+func (v *provenanceValidator) Prepare(ctx context.Context, published PublishedFiles) error {
+	data, err := published.Fetch(ctx, provenanceSuffix)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &v.statement)
+	if err != nil {
+		return fmt.Errorf("invalid provenance statement: %w", err)
+	}
+	return nil
+}
+
+func (v *provenanceValidator) Validate(ctx context.Context, artifact *Artifact) error {
+	checksum := hex.EncodeToString(artifact.SHA256)
+	for _, subject := range v.statement.Subject {
+		if path.Base(subject.Name) == path.Base(artifact.Name) && subject.Digest["sha256"] == checksum {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: provenance is not about the downloaded tarball", ErrValidationFailed)
+}
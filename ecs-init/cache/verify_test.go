@@ -0,0 +1,179 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPublishedFiles are published files keyed by their suffix
+type testPublishedFiles struct {
+	files map[string]string
+	size  int64
+}
+
+func (f *testPublishedFiles) Fetch(ctx context.Context, suffix string) ([]byte, error) {
+	contents, ok := f.files[suffix]
+	if !ok {
+		return nil, ErrFileNotFound
+	}
+	return []byte(contents), nil
+}
+
+func (f *testPublishedFiles) TarballSize(ctx context.Context) (int64, error) {
+	return f.size, nil
+}
+
+// scanValidator records the validation of the agent by a custom validator
+type scanValidator struct {
+	prepared bool
+	scanned  *[]string
+	err      error
+}
+
+func (v *scanValidator) Prepare(ctx context.Context, published PublishedFiles) error {
+	v.prepared = true
+	return nil
+}
+
+func (v *scanValidator) Validate(ctx context.Context, artifact *Artifact) error {
+	if !v.prepared {
+		return errors.New("not prepared")
+	}
+	*v.scanned = append(*v.scanned, artifact.Name)
+	return v.err
+}
+
+// newTestArtifact writes contents to a file and returns the artifact of it
+func newTestArtifact(t *testing.T, contents string) *Artifact {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "agent.tar")
+	require.NoError(t, ioutil.WriteFile(file, []byte(contents), 0600))
+	digest := sha256.Sum256([]byte(contents))
+	return &Artifact{Name: "agents/agent.tar", File: file, SHA256: digest[:]}
+}
+
+func TestValidationPipeline(t *testing.T) {
+	var scanned []string
+	RegisterValidator("Scan", func() (Validator, error) {
+		return &scanValidator{scanned: &scanned}, nil
+	})
+	defer delete(validators, "scan")
+
+	artifact := newTestArtifact(t, tarballContents)
+	d := &Downloader{fs: &standardFS{}, verification: []string{"size", "sha256", "scan"}}
+	pipeline, err := d.newValidationPipeline()
+	require.NoError(t, err)
+	require.NoError(t, pipeline.prepare(context.Background(), &testPublishedFiles{
+		files: map[string]string{".sha256": string(checksumOf(tarballContents))},
+		size:  int64(len(tarballContents)),
+	}))
+	assert.NoError(t, pipeline.validate(context.Background(), artifact))
+	assert.Equal(t, []string{artifact.Name}, scanned)
+}
+
+func TestValidationPipelineStopsAtRejection(t *testing.T) {
+	var scanned []string
+	RegisterValidator("scan", func() (Validator, error) {
+		return &scanValidator{scanned: &scanned, err: errors.New("malware found")}, nil
+	})
+	defer delete(validators, "scan")
+
+	artifact := newTestArtifact(t, tarballContents)
+	d := &Downloader{fs: &standardFS{}, verification: []string{"scan", "sha256"}}
+	pipeline, err := d.newValidationPipeline()
+	require.NoError(t, err)
+	require.NoError(t, pipeline.prepare(context.Background(), &testPublishedFiles{
+		files: map[string]string{".sha256": string(checksumOf("other contents"))},
+	}))
+	err = pipeline.validate(context.Background(), artifact)
+	assert.True(t, errors.Is(err, ErrValidationFailed), "Expect validation failure, got: %v", err)
+	assert.False(t, errors.Is(err, ErrChecksumMismatch), "Expect the checksum not to be checked once rejected")
+}
+
+func TestValidationPipelinePrepareFailure(t *testing.T) {
+	d := &Downloader{verification: []string{"provenance"}}
+	pipeline, err := d.newValidationPipeline()
+	require.NoError(t, err)
+	err = pipeline.prepare(context.Background(), &testPublishedFiles{})
+	assert.True(t, errors.Is(err, ErrFileNotFound), "Expect the missing statement to fail, got: %v", err)
+}
+
+func TestCheckVerificationPolicy(t *testing.T) {
+	assert.NoError(t, checkVerificationPolicy([]string{"size", "md5", "sha256", "signature", "provenance"}))
+	assert.Error(t, checkVerificationPolicy([]string{"sha256", "scan"}))
+
+	RegisterValidator("scan", func() (Validator, error) { return &scanValidator{}, nil })
+	defer delete(validators, "scan")
+	assert.NoError(t, checkVerificationPolicy([]string{"sha256", "scan"}))
+}
+
+func TestSizeValidator(t *testing.T) {
+	artifact := newTestArtifact(t, tarballContents)
+
+	validator := &sizeValidator{fs: &standardFS{}}
+	require.NoError(t, validator.Prepare(context.Background(), &testPublishedFiles{size: int64(len(tarballContents))}))
+	assert.NoError(t, validator.Validate(context.Background(), artifact))
+	require.NoError(t, validator.Prepare(context.Background(), &testPublishedFiles{size: 1}))
+	assert.True(t, errors.Is(validator.Validate(context.Background(), artifact), ErrValidationFailed))
+}
+
+func TestMD5Validator(t *testing.T) {
+	artifact := newTestArtifact(t, tarballContents)
+	sum := md5.Sum([]byte(tarballContents))
+
+	validator := &md5Validator{fs: &standardFS{}}
+	require.NoError(t, validator.Prepare(context.Background(), &testPublishedFiles{
+		files: map[string]string{md5Suffix: hex.EncodeToString(sum[:]) + "  agent.tar\n"},
+	}))
+	assert.NoError(t, validator.Validate(context.Background(), artifact))
+
+	sum = md5.Sum([]byte("other contents"))
+	require.NoError(t, validator.Prepare(context.Background(), &testPublishedFiles{
+		files: map[string]string{md5Suffix: hex.EncodeToString(sum[:])},
+	}))
+	assert.True(t, errors.Is(validator.Validate(context.Background(), artifact), ErrChecksumMismatch))
+	assert.Error(t, validator.Prepare(context.Background(), &testPublishedFiles{
+		files: map[string]string{md5Suffix: string(checksumOf(tarballContents))},
+	}), "Expect a SHA-256 sum not to parse as an MD5 sum")
+}
+
+func TestProvenanceValidator(t *testing.T) {
+	artifact := newTestArtifact(t, tarballContents)
+	statement := func(name, checksum string) *testPublishedFiles {
+		return &testPublishedFiles{files: map[string]string{provenanceSuffix: fmt.Sprintf(
+			`{"_type":"https://in-toto.io/Statement/v0.1","subject":[{"name":%q,"digest":{"sha256":%q}}]}`,
+			name, checksum)}}
+	}
+
+	validator := &provenanceValidator{}
+	require.NoError(t, validator.Prepare(context.Background(), statement("agent.tar", string(checksumOf(tarballContents)))))
+	assert.NoError(t, validator.Validate(context.Background(), artifact))
+	require.NoError(t, validator.Prepare(context.Background(), statement("agent.tar", string(checksumOf("other contents")))))
+	assert.True(t, errors.Is(validator.Validate(context.Background(), artifact), ErrValidationFailed))
+	require.NoError(t, validator.Prepare(context.Background(), statement("other.tar", string(checksumOf(tarballContents)))))
+	assert.True(t, errors.Is(validator.Validate(context.Background(), artifact), ErrValidationFailed))
+	assert.Error(t, validator.Prepare(context.Background(), &testPublishedFiles{files: map[string]string{provenanceSuffix: "not json"}}))
+}
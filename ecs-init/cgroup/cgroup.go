@@ -0,0 +1,80 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package cgroup detects the cgroup hierarchy of the host, so that the Agent
+// container can be set up for cgroup v1 or for the unified hierarchy of
+// cgroup v2
+package cgroup
+
+import (
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Hierarchy is the layout of the cgroups mounted on the host
+type Hierarchy string
+
+const (
+	// Legacy is the cgroup v1 hierarchy, with a mount per controller
+	Legacy Hierarchy = "v1"
+	// Hybrid is the cgroup v1 hierarchy with the cgroup v2 hierarchy mounted
+	// next to it without controllers
+	Hybrid Hierarchy = "hybrid"
+	// Unified is the cgroup v2 hierarchy alone, with every controller
+	Unified Hierarchy = "v2"
+)
+
+const (
+	// UnifiedMountpoint is where systemd mounts the cgroup hierarchies
+	UnifiedMountpoint = "/sys/fs/cgroup"
+	// hybridDirectory is where systemd mounts the cgroup v2 hierarchy in
+	// the hybrid layout
+	hybridDirectory = "unified"
+	// cgroup2SuperMagic is the file system type of cgroup v2 mounts
+	cgroup2SuperMagic = 0x63677270
+)
+
+// statfs is replaced by tests
+var statfs = unix.Statfs
+
+// Detect returns the cgroup hierarchy of the host
+func Detect() (Hierarchy, error) {
+	return detect(UnifiedMountpoint)
+}
+
+func detect(mountpoint string) (Hierarchy, error) {
+	unified, err := isCgroup2(mountpoint)
+	if err != nil {
+		return Legacy, errors.Wrapf(err, "could not detect the cgroup hierarchy at %s", mountpoint)
+	}
+	if unified {
+		return Unified, nil
+	}
+	hybrid, err := isCgroup2(filepath.Join(mountpoint, hybridDirectory))
+	if err == nil && hybrid {
+		return Hybrid, nil
+	}
+	return Legacy, nil
+}
+
+// isCgroup2 returns true when path is a cgroup v2 mount
+func isCgroup2(path string) (bool, error) {
+	var stat unix.Statfs_t
+	err := statfs(path, &stat)
+	if err != nil {
+		return false, err
+	}
+	return int64(stat.Type) == cgroup2SuperMagic, nil
+}
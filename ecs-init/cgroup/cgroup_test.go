@@ -0,0 +1,70 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cgroup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	tmpfsMagic   = 0x01021994
+	cgroupMagic  = 0x27e0eb
+	testMountDir = "/sys/fs/cgroup"
+)
+
+// mounts returns a statfs reporting the file system types of paths
+func mounts(types map[string]int64) func(string, *unix.Statfs_t) error {
+	return func(path string, stat *unix.Statfs_t) error {
+		fsType, ok := types[path]
+		if !ok {
+			return unix.ENOENT
+		}
+		stat.Type = fsType
+		return nil
+	}
+}
+
+func TestDetect(t *testing.T) {
+	defer func() { statfs = unix.Statfs }()
+	cases := []struct {
+		name     string
+		types    map[string]int64
+		expected Hierarchy
+	}{
+		{"unified", map[string]int64{testMountDir: cgroup2SuperMagic}, Unified},
+		{"hybrid", map[string]int64{testMountDir: tmpfsMagic, testMountDir + "/unified": cgroup2SuperMagic}, Hybrid},
+		{"legacy", map[string]int64{testMountDir: tmpfsMagic, testMountDir + "/unified": cgroupMagic}, Legacy},
+		{"legacy without unified", map[string]int64{testMountDir: tmpfsMagic}, Legacy},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			statfs = mounts(test.types)
+			hierarchy, err := Detect()
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, hierarchy)
+		})
+	}
+}
+
+func TestDetectError(t *testing.T) {
+	defer func() { statfs = unix.Statfs }()
+	statfs = func(string, *unix.Statfs_t) error { return errors.New("permission denied") }
+	hierarchy, err := Detect()
+	assert.Error(t, err)
+	assert.Equal(t, Legacy, hierarchy)
+}
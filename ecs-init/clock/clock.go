@@ -0,0 +1,104 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clock abstracts the passing of time so that code waiting on timers,
+// tickers and backoffs can be tested without real sleeps.
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and waits for time to pass
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Ticker delivers ticks at intervals, as time.Ticker does
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer calls a function once, as a timer of time.AfterFunc does
+type Timer interface {
+	// Stop prevents the function from being called, returning false if it
+	// already was or the timer was already stopped
+	Stop() bool
+}
+
+// Real is the clock of the time package
+var Real Clock = realClock{}
+
+// OrReal returns clock, or the real clock if clock is nil
+func OrReal(clock Clock) Clock {
+	if clock == nil {
+		return Real
+	}
+	return clock
+}
+
+// SleepContext waits for d to pass on clock, returning early with the error
+// of ctx once ctx is done
+func SleepContext(ctx context.Context, clock Clock, d time.Duration) error {
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
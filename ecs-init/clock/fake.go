@@ -0,0 +1,182 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a clock whose time only passes when it is advanced, for tests
+type Fake struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter is a sleep, timer or ticker waiting for the fake time to pass
+type waiter struct {
+	at time.Time
+	// period is the interval of a ticker, and zero otherwise
+	period time.Duration
+	ch     chan time.Time
+	f      func()
+}
+
+// NewFake returns a fake clock set to now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// Since returns the fake time elapsed since t
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Sleep blocks until the fake time is advanced by d
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// After returns a channel receiving the fake time once advanced by d
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	w := &waiter{ch: make(chan time.Time, 1)}
+	f.add(w, d)
+	return w.ch
+}
+
+// NewTicker returns a ticker ticking each time the fake time is advanced
+// by d. Like time.Ticker, ticks are dropped while one is not received.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	w := &waiter{period: d, ch: make(chan time.Time, 1)}
+	f.add(w, d)
+	return &fakeTicker{clock: f, waiter: w}
+}
+
+// AfterFunc calls fn in its own goroutine once the fake time is advanced
+// by d
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	w := &waiter{f: fn}
+	f.add(w, d)
+	return &fakeTimer{clock: f, waiter: w}
+}
+
+// Advance moves the fake time forward by d, firing the waiters that are due
+// in the order they are due
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	end := f.now.Add(d)
+	for {
+		sort.SliceStable(f.waiters, func(i, j int) bool {
+			return f.waiters[i].at.Before(f.waiters[j].at)
+		})
+		if len(f.waiters) == 0 || f.waiters[0].at.After(end) {
+			break
+		}
+		w := f.waiters[0]
+		f.now = w.at
+		f.waiters = f.waiters[1:]
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+			f.waiters = append(f.waiters, w)
+		}
+		w.fire(f.now)
+	}
+	f.now = end
+	f.lock.Unlock()
+}
+
+// Waiters returns how many sleeps, timers and tickers wait for the fake time
+// to pass, which lets tests wait for goroutines to start waiting
+func (f *Fake) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil waits until at least n sleeps, timers and tickers wait for the
+// fake time to pass
+func (f *Fake) BlockUntil(n int) {
+	for f.Waiters() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (f *Fake) add(w *waiter, d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	w.at = f.now.Add(d)
+	if d <= 0 && w.period == 0 {
+		w.fire(f.now)
+		return
+	}
+	f.waiters = append(f.waiters, w)
+}
+
+// remove removes w, returning false if it was not waiting
+func (f *Fake) remove(w *waiter) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for i, waiting := range f.waiters {
+		if waiting == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (w *waiter) fire(now time.Time) {
+	if w.f != nil {
+		go w.f()
+		return
+	}
+	select {
+	case w.ch <- now:
+	default:
+	}
+}
+
+type fakeTicker struct {
+	clock  *Fake
+	waiter *waiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.waiter.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.remove(t.waiter)
+}
+
+type fakeTimer struct {
+	clock  *Fake
+	waiter *waiter
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.remove(t.waiter)
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestOrReal(t *testing.T) {
+	assert.Equal(t, Real, OrReal(nil))
+	fake := NewFake(epoch)
+	assert.Equal(t, fake, OrReal(fake))
+}
+
+func TestFakeSleep(t *testing.T) {
+	clock := NewFake(epoch)
+	slept := make(chan struct{})
+	go func() {
+		clock.Sleep(time.Minute)
+		close(slept)
+	}()
+	clock.BlockUntil(1)
+
+	clock.Advance(59 * time.Second)
+	select {
+	case <-slept:
+		t.Fatal("Expect the sleep to last a minute")
+	default:
+	}
+	clock.Advance(time.Second)
+	<-slept
+	assert.Equal(t, epoch.Add(time.Minute), clock.Now())
+	assert.Equal(t, time.Minute, clock.Since(epoch))
+}
+
+func TestSleepContext(t *testing.T) {
+	clock := NewFake(epoch)
+	ctx, cancel := context.WithCancel(context.Background())
+	slept := make(chan error)
+	go func() {
+		slept <- SleepContext(ctx, clock, time.Minute)
+	}()
+	clock.BlockUntil(1)
+	cancel()
+	assert.Equal(t, context.Canceled, <-slept)
+
+	go func() {
+		slept <- SleepContext(context.Background(), clock, time.Minute)
+	}()
+	clock.BlockUntil(2)
+	clock.Advance(time.Minute)
+	assert.NoError(t, <-slept)
+}
+
+func TestFakeAfterZero(t *testing.T) {
+	clock := NewFake(epoch)
+	assert.Equal(t, epoch, <-clock.After(0))
+	assert.Equal(t, 0, clock.Waiters())
+}
+
+func TestFakeTicker(t *testing.T) {
+	clock := NewFake(epoch)
+	ticker := clock.NewTicker(time.Second)
+
+	clock.Advance(time.Second)
+	assert.Equal(t, epoch.Add(time.Second), <-ticker.C())
+	clock.Advance(3 * time.Second)
+	assert.Equal(t, epoch.Add(2*time.Second), <-ticker.C(), "Expect ticks to be dropped while one is not received")
+	select {
+	case <-ticker.C():
+		t.Fatal("Expect a single pending tick")
+	default:
+	}
+
+	ticker.Stop()
+	assert.Equal(t, 0, clock.Waiters())
+}
+
+func TestFakeAfterFunc(t *testing.T) {
+	clock := NewFake(epoch)
+	called := make(chan time.Time, 1)
+	clock.AfterFunc(time.Second, func() { called <- clock.Now() })
+	stopped := clock.AfterFunc(time.Second, func() { t.Error("Expect a stopped timer to not fire") })
+
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop(), "Expect a stopped timer to report it was stopped")
+	clock.Advance(2 * time.Second)
+	<-called
+}
+
+func TestFakeAdvanceFiresInOrder(t *testing.T) {
+	clock := NewFake(epoch)
+	later := clock.After(2 * time.Second)
+	sooner := clock.After(time.Second)
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, epoch.Add(time.Second), <-sooner)
+	assert.Equal(t, epoch.Add(2*time.Second), <-later)
+	assert.Equal(t, epoch.Add(time.Hour), clock.Now())
+}
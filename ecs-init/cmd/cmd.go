@@ -15,6 +15,17 @@ package cmd
 
 //go:generate mockgen.sh sysctl $GOFILE ../exec/sysctl
 //go:generate mockgen.sh iptables $GOFILE ../exec/iptables
+//go:generate mockgen.sh reservation $GOFILE ../exec/reservation
+//go:generate mockgen.sh efsutils $GOFILE ../exec/efsutils
+//go:generate mockgen.sh netns $GOFILE ../exec/netns
+//go:generate mockgen.sh dockerd $GOFILE ../exec/dockerd
+//go:generate mockgen.sh apparmor $GOFILE ../exec/apparmor
+//go:generate mockgen.sh containerd $GOFILE ../containerd
+//go:generate mockgen.sh startgate $GOFILE ../exec/startgate
+//go:generate mockgen.sh taskmetadata $GOFILE ../exec/taskmetadata
+//go:generate mockgen.sh egress $GOFILE ../exec/egress
+//go:generate mockgen.sh persistenced $GOFILE ../exec/persistenced
+//go:generate mockgen.sh blueprint $GOFILE ../blueprint
 
 // Cmd defines common methods from exec.Cmd that are used to run external
 // commands
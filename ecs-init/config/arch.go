@@ -0,0 +1,66 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// machineArchs maps the machine hardware names reported by uname to the
+// architectures the Agent is published for
+var machineArchs = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+}
+
+// AgentArch returns the architecture of the Agent artifact to download, which
+// is the architecture of the host unless overridden with AgentArchEnvVar,
+// e.g. to test the artifact of another architecture
+func AgentArch() string {
+	if arch := os.Getenv(AgentArchEnvVar); arch != "" {
+		return normalizeArch(arch)
+	}
+	return goarch
+}
+
+// hostArch returns the architecture of the host, which may differ from the
+// architecture ecs-init was built for when it runs emulated. The architecture
+// ecs-init was built for is returned if the host cannot be queried.
+func hostArch() string {
+	var uname unix.Utsname
+	err := unix.Uname(&uname)
+	if err != nil {
+		return runtime.GOARCH
+	}
+	machine := make([]byte, 0, len(uname.Machine))
+	for _, c := range uname.Machine {
+		if c == 0 {
+			break
+		}
+		machine = append(machine, byte(c))
+	}
+	return normalizeArch(string(machine))
+}
+
+// normalizeArch returns the Go name of arch, which may be a machine hardware
+// name such as aarch64
+func normalizeArch(arch string) string {
+	if goArch, ok := machineArchs[arch]; ok {
+		return goArch
+	}
+	return arch
+}
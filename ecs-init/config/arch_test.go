@@ -0,0 +1,66 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestHostArch(t *testing.T) {
+	// the tests run natively
+	if arch := hostArch(); arch != runtime.GOARCH {
+		t.Errorf("Expected the host architecture %q, got %q", runtime.GOARCH, arch)
+	}
+}
+
+func TestAgentArchOverride(t *testing.T) {
+	testcases := []struct {
+		value    string
+		expected string
+	}{
+		{"", goarch},
+		{"arm64", "arm64"},
+		{"aarch64", "arm64"},
+		{"x86_64", "amd64"},
+		{"ppc64le", "ppc64le"},
+	}
+	defer os.Unsetenv(AgentArchEnvVar)
+	for _, test := range testcases {
+		os.Setenv(AgentArchEnvVar, test.value)
+		if arch := AgentArch(); arch != test.expected {
+			t.Errorf("Expected %q for %q, got %q", test.expected, test.value, arch)
+		}
+	}
+}
+
+func TestAgentRemoteTarballKeyArchOverride(t *testing.T) {
+	os.Setenv(AgentArchEnvVar, "aarch64")
+	defer os.Unsetenv(AgentArchEnvVar)
+
+	key, err := AgentRemoteTarballKey("v1.76.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if key != "ecs-agent-arm64-v1.76.0.tar" {
+		t.Errorf("Expected the arm64 artifact, got %q", key)
+	}
+
+	os.Setenv(AgentArchEnvVar, "ppc64le")
+	_, err = AgentRemoteTarballKey("v1.76.0")
+	if err == nil {
+		t.Error("Expected no artifact for an unknown architecture")
+	}
+}
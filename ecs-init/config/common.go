@@ -15,9 +15,14 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
-	"runtime"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
 
 	"github.com/aws/aws-sdk-go/aws/endpoints"
 	godocker "github.com/fsouza/go-dockerclient"
@@ -28,6 +33,28 @@ const (
 	// AgentImageName is the name of the Docker image containing the Agent
 	AgentImageName = "amazon/amazon-ecs-agent:latest"
 
+	// AgentImageRepository is the repository of the Docker image containing the Agent
+	AgentImageRepository = "amazon/amazon-ecs-agent"
+
+	// AgentImageTag is the tag of the Docker image containing the Agent
+	AgentImageTag = "latest"
+
+	// AgentStandbyImageTag is the tag given to an Agent image preloaded
+	// ahead of an upgrade
+	AgentStandbyImageTag = "standby"
+
+	// PauseImageRepository is the repository of the pause container image
+	// the Agent starts the network namespaces of tasks in
+	PauseImageRepository = "amazon/amazon-ecs-pause"
+
+	// DefaultPauseImageTag is the tag of the pause container image expected
+	// by Agent images that do not name one
+	DefaultPauseImageTag = "0.1.0"
+
+	// PauseImageLabel is the label of the Agent image naming the pause
+	// container image the Agent expects, e.g. amazon/amazon-ecs-pause:0.1.0
+	PauseImageLabel = "com.amazonaws.ecs.pause-image"
+
 	// AgentContainerName is the name of the Agent container started by this program
 	AgentContainerName = "ecs-agent"
 
@@ -44,6 +71,11 @@ const (
 	// 8-character sha, as is downloadable from S3.
 	DefaultAgentVersion = "v1.36.0"
 
+	// AgentVersionEnvVar is the environment variable, also read from the
+	// agent config file, that pins the version of the agent downloaded
+	// instead of DefaultAgentVersion, e.g. 1.76.0
+	AgentVersionEnvVar = "ECS_AGENT_VERSION"
+
 	// AgentPartitionBucketName is the name of the paritional s3 bucket that stores the agent
 	AgentPartitionBucketName = "amazon-ecs-agent"
 
@@ -69,11 +101,660 @@ const (
 	dockerJSONLogMaxFilesEnvVar = "ECS_INIT_DOCKER_LOG_FILE_NUM"
 	// GPUSupportEnvVar indicates that the AMI has support for GPU
 	GPUSupportEnvVar = "ECS_ENABLE_GPU_SUPPORT"
+	// TaskENIEnvVar is the Agent config variable that runs tasks in the
+	// awsvpc network mode, which the Agent sets up from the network
+	// namespace of the host
+	TaskENIEnvVar = "ECS_ENABLE_TASK_ENI"
+	// NeuronSupportEnvVar is the Agent config variable that maps the AWS
+	// Neuron devices of Inferentia and Trainium instances into the Agent
+	// container
+	NeuronSupportEnvVar = "ECS_ENABLE_NEURON_SUPPORT"
+	// EFASupportEnvVar is the Agent config variable that maps the Elastic
+	// Fabric Adapter devices of the instance into the Agent container
+	EFASupportEnvVar = "ECS_ENABLE_EFA_SUPPORT"
 
 	// DockerHostEnvVar is the environment variable that specifies the location of the Docker daemon socket.
 	DockerHostEnvVar = "DOCKER_HOST"
+	// DockerReadyTimeoutEnvVar is the environment variable that sets how
+	// long ecs-init waits for the Docker daemon to respond
+	DockerReadyTimeoutEnvVar = "ECS_INIT_DOCKER_READY_TIMEOUT"
+	// DefaultDockerReadyTimeout is how long ecs-init waits for the Docker
+	// daemon to respond by default
+	DefaultDockerReadyTimeout = 5 * time.Minute
+	// HookTimeoutEnvVar is the environment variable that sets how long each
+	// hook script may run
+	HookTimeoutEnvVar = "ECS_INIT_HOOK_TIMEOUT"
+	// DefaultHookTimeout is how long each hook script may run by default
+	DefaultHookTimeout = time.Minute
+	// DockerTLSVerifyEnvVar is the environment variable that makes the
+	// connection to a Docker daemon listening on TCP use TLS, verifying the
+	// daemon and authenticating with a client certificate
+	DockerTLSVerifyEnvVar = "DOCKER_TLS_VERIFY"
+	// DockerCertPathEnvVar is the environment variable naming the directory
+	// holding ca.pem, cert.pem and key.pem for DockerTLSVerifyEnvVar
+	DockerCertPathEnvVar = "DOCKER_CERT_PATH"
+	// DefaultDockerCertPath is where the Docker CLI of root looks for its
+	// TLS certificates
+	DefaultDockerCertPath = "/root/.docker"
+	// TCPSocketPrefix is the prefix of Docker daemon endpoints listening on
+	// TCP
+	TCPSocketPrefix = "tcp://"
+
+	// RegionOverrideEnvVar is the environment variable that may be used to
+	// bypass region discovery through the EC2 Instance Metadata Service
+	RegionOverrideEnvVar = "ECS_INIT_REGION"
+
+	// S3EndpointEnvVar is the environment variable that replaces the s3
+	// endpoint of the instance region used to download the Agent, e.g. with
+	// the endpoint of an s3 interface VPC endpoint
+	S3EndpointEnvVar = "ECS_INIT_S3_ENDPOINT"
+
+	// S3AuthenticatedEnvVar is the environment variable that makes Agent
+	// downloads signed with the credentials of the instance
+	S3AuthenticatedEnvVar = "ECS_INIT_S3_AUTHENTICATED"
+
+	// S3DownloadConcurrencyEnvVar is the environment variable that sets
+	// how many parts of the Agent are downloaded in parallel
+	S3DownloadConcurrencyEnvVar = "ECS_INIT_S3_DOWNLOAD_CONCURRENCY"
+
+	// SHA256BackendEnvVar is the environment variable that selects the
+	// implementation of the SHA-256 digests verifying downloads
+	SHA256BackendEnvVar = "ECS_INIT_SHA256_BACKEND"
+
+	// PipelinedHashingEnvVar is the environment variable that, when false,
+	// hashes downloads on the goroutine writing them
+	PipelinedHashingEnvVar = "ECS_INIT_PIPELINED_HASHING"
+
+	// DownloadMaxAttemptsEnvVar is the environment variable that sets how
+	// many times each file of the Agent is attempted to be downloaded
+	DownloadMaxAttemptsEnvVar = "ECS_INIT_DOWNLOAD_MAX_ATTEMPTS"
+
+	// DownloadRetryDelayEnvVar is the environment variable that sets the
+	// delay before a failed download is first retried, doubled before each
+	// following retry
+	DownloadRetryDelayEnvVar = "ECS_INIT_DOWNLOAD_RETRY_DELAY"
+
+	// DownloadRetryJitterEnvVar is the environment variable that sets the
+	// fraction of each retry delay that is randomly added to it
+	DownloadRetryJitterEnvVar = "ECS_INIT_DOWNLOAD_RETRY_JITTER"
+
+	// DefaultDownloadMaxAttempts, DefaultDownloadRetryDelay and
+	// DefaultDownloadRetryJitter make up the download retry policy when
+	// its variables are not set
+	DefaultDownloadMaxAttempts = 3
+	DefaultDownloadRetryDelay  = time.Second
+	DefaultDownloadRetryJitter = 0.2
+
+	// downloadRetryMaxDelay bounds the delay between download retries,
+	// unless the base delay is longer
+	downloadRetryMaxDelay = 30 * time.Second
+
+	// OfflineEnvVar is the environment variable that keeps ecs-init from
+	// downloading the Agent or looking up the region over the network
+	OfflineEnvVar = "ECS_OFFLINE"
+
+	// StreamingLoadEnvVar is the environment variable that loads the Agent
+	// into Docker while it is downloaded
+	StreamingLoadEnvVar = "ECS_INIT_STREAMING_LOAD"
+
+	// AgentBucketEnvVar is the environment variable that names the bucket,
+	// in the instance region, to download the Agent from instead of the
+	// Agent buckets
+	AgentBucketEnvVar = "ECS_INIT_AGENT_BUCKET"
+
+	// AgentDownloadURLEnvVar is the environment variable that sets the URL
+	// of the directory to download the Agent from instead of the Agent
+	// buckets, such as https://mirror.example.com/ecs-agent/. The scheme of
+	// the URL selects the fetcher of the files.
+	AgentDownloadURLEnvVar = "ECS_INIT_AGENT_DOWNLOAD_URL"
+
+	// AgentVerificationEnvVar is the environment variable that lists,
+	// separated by commas, the validators a downloaded Agent has to pass in
+	// order before it is cached, e.g. size, md5, sha256, signature and
+	// provenance
+	AgentVerificationEnvVar = "ECS_INIT_AGENT_VERIFICATION"
+	// DefaultAgentVerification is the verification of a downloaded Agent
+	// when none is configured, against the MD5 sum published with every
+	// Agent
+	DefaultAgentVerification = "md5"
+	// SignedAgentVerification is the verification of a downloaded Agent when
+	// none is configured and the Agent signing key is installed at
+	// AgentSigningKeyFile, which adds the published PGP signature
+	SignedAgentVerification = "md5,signature"
+
+	// ContainerRuntimeEnvVar is the environment variable that sets the
+	// container runtime the Agent is run by, ContainerRuntimeDocker or
+	// ContainerRuntimeContainerd
+	ContainerRuntimeEnvVar = "ECS_INIT_CONTAINER_RUNTIME"
+
+	// ContainerRuntimeDocker runs the Agent with the Docker daemon, which is
+	// the default
+	ContainerRuntimeDocker = "docker"
+
+	// ContainerRuntimeContainerd runs the Agent with containerd, for hosts
+	// without the Docker daemon
+	ContainerRuntimeContainerd = "containerd"
+
+	// ContainerdAddressEnvVar is the environment variable that sets the
+	// socket of containerd
+	ContainerdAddressEnvVar = "ECS_INIT_CONTAINERD_ADDRESS"
+
+	// DefaultContainerdAddress is the socket containerd listens on by
+	// default
+	DefaultContainerdAddress = "/run/containerd/containerd.sock"
+
+	// AgentSourceEnvVar is the environment variable that sets where the
+	// Agent image comes from, AgentSourceS3 or AgentSourceRegistry
+	AgentSourceEnvVar = "ECS_INIT_AGENT_SOURCE"
+
+	// AgentSourceS3 downloads the Agent tarball from S3 and loads it into
+	// Docker, which is the default
+	AgentSourceS3 = "s3"
+
+	// AgentSourceRegistry pulls the Agent image from a container registry
+	AgentSourceRegistry = "registry"
+
+	// SELinuxLabelingEnvVar is the environment variable that sets how the
+	// mounts of the Agent container are labeled for SELinux
+	SELinuxLabelingEnvVar = "ECS_INIT_SELINUX_LABELING"
+
+	// SELinuxLabelingAuto relabels the mounts of the Agent container when
+	// SELinux enforces its policy, which is the default
+	SELinuxLabelingAuto = "auto"
+
+	// SELinuxLabelingRelabel always relabels the directories of ecs-init
+	// mounted into the Agent container
+	SELinuxLabelingRelabel = "relabel"
+
+	// SELinuxLabelingDisable runs the Agent container without SELinux
+	// separation
+	SELinuxLabelingDisable = "disable"
+
+	// SELinuxLabelingOff leaves the labels of the mounts alone
+	SELinuxLabelingOff = "off"
+
+	// AppArmorProfileEnvVar is the environment variable that names the
+	// AppArmor profile the Agent container is confined by
+	AppArmorProfileEnvVar = "ECS_INIT_APPARMOR_PROFILE"
+
+	// DefaultAppArmorProfile is the profile ecs-init installs and loads for
+	// the Agent container
+	DefaultAppArmorProfile = "ecs-agent-default"
+
+	// AppArmorProfileUnconfined runs the Agent container without AppArmor
+	// confinement
+	AppArmorProfileUnconfined = "unconfined"
+
+	// AgentNetworkEnvVar is the environment variable that sets the network
+	// of the Agent container, AgentNetworkHost or AgentNetworkBridge
+	AgentNetworkEnvVar = "ECS_INIT_AGENT_NETWORK"
+
+	// AgentNetworkHost runs the Agent container in the network namespace of
+	// the host
+	AgentNetworkHost = "host"
+
+	// AgentNetworkBridge runs the Agent container on a bridge of its own
+	AgentNetworkBridge = "bridge"
+
+	// AgentBridgeNetwork is the Docker network of the bridge of the Agent
+	AgentBridgeNetwork = "ecs-agent"
+
+	// AgentBridgeInterface is the interface of the bridge of the Agent on
+	// the host
+	AgentBridgeInterface = "ecs-agent0"
+
+	// AgentEgressEnvVar is the environment variable that sets the egress
+	// policy of the Agent container, AgentEgressOpen or AgentEgressRestricted
+	AgentEgressEnvVar = "ECS_INIT_AGENT_EGRESS"
+
+	// AgentEgressOpen lets the Agent container connect anywhere
+	AgentEgressOpen = "open"
+
+	// AgentEgressRestricted only lets the Agent container connect to the
+	// endpoints of the services it depends on
+	AgentEgressRestricted = "restricted"
+
+	// AgentEgressAllowEnvVar is the environment variable that lists,
+	// separated by commas, the host names and CIDR blocks the Agent container
+	// may connect to in addition to the endpoints of the services it depends
+	// on when its egress is restricted
+	AgentEgressAllowEnvVar = "ECS_INIT_AGENT_EGRESS_ALLOW"
+
+	// IPRangesURL is where AWS publishes the IP address ranges of its
+	// services, which the Agent container may connect to when its egress is
+	// restricted
+	IPRangesURL = "https://ip-ranges.amazonaws.com/ip-ranges.json"
+
+	// AgentRegistryEnvVar is the environment variable that names the
+	// repository the Agent image is pulled from, such as a mirror
+	AgentRegistryEnvVar = "ECS_INIT_AGENT_REGISTRY"
+
+	// DefaultAgentRegistry is the ECR Public repository of the Agent image
+	DefaultAgentRegistry = "public.ecr.aws/ecs/amazon-ecs-agent"
+
+	// IMDSv2OnlyEnvVar is the environment variable that prevents falling
+	// back to IMDSv1 when no IMDSv2 session token can be obtained
+	IMDSv2OnlyEnvVar = "ECS_INIT_IMDSV2_ONLY"
+
+	// IMDSRetriesEnvVar is the environment variable that sets how many
+	// times a failed request to the EC2 Instance Metadata Service is retried
+	IMDSRetriesEnvVar = "ECS_INIT_IMDS_RETRIES"
+
+	// DefaultIMDSRetries is how many times a failed request to the EC2
+	// Instance Metadata Service is retried when IMDSRetriesEnvVar is not set
+	DefaultIMDSRetries = 3
+
+	// PreviousAgentsEnvVar is the environment variable that sets how many
+	// previously cached Agent images are kept to roll back to
+	PreviousAgentsEnvVar = "ECS_INIT_PREVIOUS_AGENTS"
+
+	// DefaultPreviousAgents is how many previously cached Agent images are
+	// kept when PreviousAgentsEnvVar is not set
+	DefaultPreviousAgents = 2
+
+	// AgentImageRetentionEnvVar is the environment variable that sets how
+	// many previous Agent images are kept in Docker when pruning them
+	AgentImageRetentionEnvVar = "ECS_INIT_AGENT_IMAGE_RETENTION"
+
+	// DefaultAgentImageRetention is how many previous Agent images are kept
+	// in Docker when AgentImageRetentionEnvVar is not set
+	DefaultAgentImageRetention = 1
+
+	// PruneAgentImagesEnvVar is the environment variable that, when true,
+	// prunes the previous Agent images once the Agent is healthy
+	PruneAgentImagesEnvVar = "ECS_INIT_PRUNE_AGENT_IMAGES"
+
+	// InstanceMetadataEndpoint is the endpoint of the EC2 Instance Metadata
+	// Service
+	InstanceMetadataEndpoint = "http://169.254.169.254"
+
+	// AgentArchEnvVar is the environment variable that overrides the
+	// architecture of the host when selecting the Agent artifact
+	AgentArchEnvVar = "ECS_INIT_AGENT_ARCH"
+
+	// IMDSEndpointEnvVar is the environment variable that replaces the
+	// endpoint of the EC2 Instance Metadata Service, e.g. with a mock
+	IMDSEndpointEnvVar = "ECS_INIT_IMDS_ENDPOINT"
+
+	// HTTPProxyEnvVar is the environment variable, in the environment or in
+	// the agent config files, of the proxy of HTTP requests
+	HTTPProxyEnvVar = "HTTP_PROXY"
+
+	// HTTPSProxyEnvVar is the environment variable, in the environment or
+	// in the agent config files, of the proxy of HTTPS requests
+	HTTPSProxyEnvVar = "HTTPS_PROXY"
+
+	// NoProxyEnvVar is the environment variable, in the environment or in
+	// the agent config files, of the hosts requested without a proxy
+	NoProxyEnvVar = "NO_PROXY"
+
+	// DefaultNoProxy keeps the instance metadata and task credentials
+	// endpoints and the Docker socket from being proxied when a proxy is set
+	// without exclusions
+	DefaultNoProxy = "169.254.169.254,169.254.170.2,/var/run/docker.sock"
+
+	// CABundleEnvVar is the environment variable that names a PEM file of
+	// CA certificates trusted along with the system ones when downloading
+	// the Agent, e.g. for a TLS-intercepting proxy
+	CABundleEnvVar = "ECS_INIT_CA_BUNDLE"
+
+	// ClientCertEnvVar is the environment variable that names the PEM file
+	// of the client certificate presented when downloading the Agent
+	ClientCertEnvVar = "ECS_INIT_CLIENT_CERT"
+
+	// ClientKeyEnvVar is the environment variable that names the PEM file of
+	// the private key of the client certificate
+	ClientKeyEnvVar = "ECS_INIT_CLIENT_KEY"
+
+	// ReservedSystemMemoryEnvVar is the Agent config variable that sets
+	// the memory, in MiB, reserved for system daemons
+	ReservedSystemMemoryEnvVar = "ECS_INIT_RESERVED_SYSTEM_MEMORY"
+
+	// SysctlProfileEnvVar is the Agent config variable that enables
+	// applying the sysctl profile at pre-start
+	SysctlProfileEnvVar = "ECS_INIT_ENABLE_SYSCTL_PROFILE"
+
+	// FirelensPrerequisitesEnvVar is the Agent config variable that
+	// enables preparing the host for FireLens at pre-start
+	FirelensPrerequisitesEnvVar = "ECS_INIT_PREPARE_FIRELENS"
+
+	// FirelensImageEnvVar is the Agent config variable that sets the log
+	// router image pulled when preparing the host for FireLens
+	FirelensImageEnvVar = "ECS_INIT_FIRELENS_IMAGE"
+
+	// DefaultFirelensImage is the log router image pulled when preparing
+	// the host for FireLens
+	DefaultFirelensImage = "amazon/aws-for-fluent-bit:latest"
+
+	// ExecPrerequisitesEnvVar is the Agent config variable that enables
+	// staging the SSM agent binaries and certificates ECS Exec needs at
+	// pre-start
+	ExecPrerequisitesEnvVar = "ECS_INIT_PREPARE_EXEC"
+
+	// ExecSSMAgentVersionEnvVar is the Agent config variable that sets the
+	// version of the SSM agent binaries staged for ECS Exec
+	ExecSSMAgentVersionEnvVar = "ECS_INIT_EXEC_SSM_AGENT_VERSION"
+
+	// DefaultExecSSMAgentVersion is the version of the SSM agent binaries
+	// staged for ECS Exec when none is set
+	DefaultExecSSMAgentVersion = "3.1.1446.0"
+
+	// EFSUtilsEnvVar is the Agent config variable that enables checking,
+	// with "check", or installing, with "install", the EFS mount helper at
+	// pre-start
+	EFSUtilsEnvVar = "ECS_INIT_EFS_UTILS"
+
+	// VolumePluginEnvVar is the environment variable that enables running
+	// the volume plugin next to the Agent
+	VolumePluginEnvVar = "ECS_ENABLE_VOLUME_PLUGIN"
+
+	// IntrospectionSocketEnvVar is the environment variable that sets the
+	// unix socket the introspection API of the Agent is served on
+	IntrospectionSocketEnvVar = "ECS_INIT_INTROSPECTION_SOCKET"
+
+	// IntrospectionSocketGroupEnvVar is the environment variable that names
+	// the group allowed to connect to the introspection socket besides root
+	IntrospectionSocketGroupEnvVar = "ECS_INIT_INTROSPECTION_SOCKET_GROUP"
+
+	// IntrospectionTokenFileEnvVar is the environment variable that names a
+	// file holding the bearer token requests to the introspection socket
+	// must present
+	IntrospectionTokenFileEnvVar = "ECS_INIT_INTROSPECTION_TOKEN_FILE"
+
+	// MetricsAddressEnvVar is the environment variable that sets the
+	// loopback address the metrics of ecs-init are served on, e.g.
+	// "127.0.0.1:51681"
+	MetricsAddressEnvVar = "ECS_INIT_METRICS_ADDRESS"
+
+	// EBSTaskAttachEnvVar is the Agent config variable that enables
+	// preparing the host for attaching EBS volumes to tasks
+	EBSTaskAttachEnvVar = "ECS_INIT_EBS_TASK_ATTACH"
+
+	// AgentCPULimitEnvVar is the Agent config variable that limits the CPUs
+	// the Agent container can use, e.g. 0.5 for half a CPU
+	AgentCPULimitEnvVar = "ECS_AGENT_CPU_LIMIT"
+
+	// AgentMemoryLimitEnvVar is the Agent config variable that limits the
+	// memory, in MiB, the Agent container can use
+	AgentMemoryLimitEnvVar = "ECS_AGENT_MEMORY_LIMIT"
+
+	// AgentPidsLimitEnvVar is the Agent config variable that limits the
+	// number of processes and threads of the Agent container
+	AgentPidsLimitEnvVar = "ECS_AGENT_PIDS_LIMIT"
+
+	// ReservedPortsEnvVar is the Agent config variable that lists the host
+	// ports, separated by commas, that must be free when the Agent starts
+	ReservedPortsEnvVar = "ECS_INIT_RESERVED_PORTS"
+
+	// UncleanShutdownCleanupEnvVar is the Agent config variable that makes
+	// pre-start report, or clean, what tasks left on the host when the
+	// Agent did not stop cleanly
+	UncleanShutdownCleanupEnvVar = "ECS_INIT_UNCLEAN_SHUTDOWN_CLEANUP"
+
+	// ClusterEnvVar is the Agent config variable that names the cluster
+	// of the Agent
+	ClusterEnvVar = "ECS_CLUSTER"
+
+	// DefaultClusterName is the cluster of the Agent when ClusterEnvVar
+	// is not set
+	DefaultClusterName = "default"
+
+	// CreateClusterEnvVar is the Agent config variable that enables creating
+	// the cluster of the Agent if it does not exist
+	CreateClusterEnvVar = "ECS_INIT_CREATE_CLUSTER"
+
+	// StandbyPreloadEnvVar is the environment variable that enables
+	// preloading the next Agent image while the current Agent is running
+	StandbyPreloadEnvVar = "ECS_ENABLE_AGENT_STANDBY_PRELOAD"
+
+	// DockerdSupervisionEnvVar is the environment variable that makes the
+	// Docker daemon be monitored while the Agent runs, and either reported
+	// or restarted when it stops responding
+	DockerdSupervisionEnvVar = "ECS_INIT_DOCKERD_SUPERVISION"
+
+	// DockerdSupervisionAlert reports an unresponsive Docker daemon
+	DockerdSupervisionAlert = "alert"
+
+	// DockerdSupervisionRestart restarts an unresponsive Docker daemon
+	DockerdSupervisionRestart = "restart"
+
+	// ConfigWatchEnvVar is the environment variable that sets what happens
+	// when the agent config file changes while the Agent runs
+	ConfigWatchEnvVar = "ECS_INIT_CONFIG_WATCH"
+
+	// ConfigWatchRestart restarts the Agent to apply the changed config
+	ConfigWatchRestart = "restart"
+
+	// ConfigWatchDrift records in the engine status that the Agent runs
+	// with an outdated config until it is restarted
+	ConfigWatchDrift = "drift"
+
+	// ConfigWatchIgnore leaves changes to be applied when the Agent is
+	// next restarted, which is the default
+	ConfigWatchIgnore = "ignore"
+
+	// LogSupervisionEnvVar is the environment variable that makes the logs
+	// of ecs-init and of the Agent, and the volume they are written to, be
+	// monitored while the Agent runs
+	LogSupervisionEnvVar = "ECS_INIT_LOG_SUPERVISION"
+
+	// LogSupervisionAlert reports logs that take more than their maximum
+	// size
+	LogSupervisionAlert = "alert"
+
+	// LogSupervisionTrim removes the oldest rotated logs until the logs take
+	// at most their maximum size
+	LogSupervisionTrim = "trim"
+
+	// LogMaxSizeEnvVar is the environment variable that sets the maximum
+	// size of the logs in MiB
+	LogMaxSizeEnvVar = "ECS_INIT_LOG_MAX_SIZE"
+
+	// DefaultLogMaxSize is the maximum size of the logs in MiB when
+	// LogMaxSizeEnvVar is not set
+	DefaultLogMaxSize = 1024
+
+	// LogVolumeThresholdEnvVar is the environment variable that sets the
+	// percentage of the volume holding the logs that may be in use before
+	// it is reported
+	LogVolumeThresholdEnvVar = "ECS_INIT_LOG_VOLUME_THRESHOLD"
+
+	// DefaultLogVolumeThreshold is the percentage of the volume holding the
+	// logs that may be in use when LogVolumeThresholdEnvVar is not set
+	DefaultLogVolumeThreshold = 90
+
+	// LogLevelEnvVar is the environment variable that sets the lowest level
+	// of the messages ecs-init logs: debug, info, warn, error or crit
+	LogLevelEnvVar = "ECS_INIT_LOGLEVEL"
+
+	// DefaultLogLevel is the lowest level logged when LogLevelEnvVar is not
+	// set
+	DefaultLogLevel = "debug"
+
+	// LogFormatEnvVar is the environment variable that sets the format of
+	// the log of ecs-init
+	LogFormatEnvVar = "ECS_INIT_LOG_FORMAT"
+
+	// LogFormatText logs a line of text per message, which is the default
+	LogFormatText = "text"
+
+	// LogFormatJSON logs a JSON object per line, with the time, level and
+	// message of each message
+	LogFormatJSON = "json"
+
+	// LogOutputEnvVar is the environment variable that sets where the log of
+	// ecs-init is written
+	LogOutputEnvVar = "ECS_INIT_LOG_OUTPUT"
+
+	// LogOutputFile writes the log to the log file only
+	LogOutputFile = "file"
+
+	// LogOutputConsole writes the log to the console only, which systemd
+	// sends to the journal
+	LogOutputConsole = "console"
+
+	// LogOutputAll writes the log to both the log file and the console,
+	// which is the default
+	LogOutputAll = "all"
+
+	// LogOutputJournal sends the log to journald only, with structured
+	// fields, instead of writing the log file
+	LogOutputJournal = "journal"
+
+	// LogRolloverEnvVar is the environment variable that sets when the log
+	// file is rotated
+	LogRolloverEnvVar = "ECS_INIT_LOG_ROLLOVER"
+
+	// LogRolloverHourly rotates the log file every hour, which is the
+	// default
+	LogRolloverHourly = "hourly"
+
+	// LogRolloverSize rotates the log file once it reaches the size set by
+	// LogFileSizeEnvVar
+	LogRolloverSize = "size"
+
+	// LogFileSizeEnvVar is the environment variable that sets the size in
+	// MiB the log file is rotated at when rotated by size
+	LogFileSizeEnvVar = "ECS_INIT_LOG_FILE_SIZE"
+
+	// DefaultLogFileSize is the size in MiB the log file is rotated at when
+	// LogFileSizeEnvVar is not set
+	DefaultLogFileSize = 10
+
+	// LogFileNumEnvVar is the environment variable that sets how many
+	// rotated log files are kept
+	LogFileNumEnvVar = "ECS_INIT_LOG_FILE_NUM"
+
+	// DefaultLogFileNum is how many rotated log files are kept when
+	// LogFileNumEnvVar is not set
+	DefaultLogFileNum = 5
+
+	// LogMaxAgeEnvVar is the environment variable that sets how long
+	// rotated log files are kept
+	LogMaxAgeEnvVar = "ECS_INIT_LOG_MAX_AGE"
+
+	// DownloadJitterEnvVar is the environment variable that delays each
+	// download of the Agent by a random duration up to its value, so that
+	// instances launched together do not download the Agent all at once
+	DownloadJitterEnvVar = "ECS_INIT_DOWNLOAD_JITTER"
+
+	// DownloadGateParameterEnvVar is the environment variable that names
+	// the SSM parameter that has to hold DownloadGateOpen for the Agent to
+	// be downloaded
+	DownloadGateParameterEnvVar = "ECS_INIT_DOWNLOAD_GATE_PARAMETER"
+
+	// DownloadGateOpen is the value of the download gate parameter that lets
+	// instances download the Agent
+	DownloadGateOpen = "go"
+
+	// MaintenanceWindowsEnvVar is the environment variable that restricts
+	// restarting the Agent to upgrade it to maintenance windows
+	MaintenanceWindowsEnvVar = "ECS_INIT_MAINTENANCE_WINDOWS"
+
+	// MaintenanceConcurrencyParameterEnvVar is the environment variable
+	// that names the SSM parameter holding the percentage of instances that
+	// may act at once in a maintenance window
+	MaintenanceConcurrencyParameterEnvVar = "ECS_INIT_MAINTENANCE_CONCURRENCY_PARAMETER"
+
+	// UpgradeScaleInProtectionEnvVar is the environment variable that
+	// protects the instance from scale in by its Auto Scaling group while
+	// the Agent is upgraded
+	UpgradeScaleInProtectionEnvVar = "ECS_INIT_UPGRADE_SCALE_IN_PROTECTION"
+
+	// LaunchLifecycleHookEnvVar is the environment variable that names the
+	// launch lifecycle hook of the Auto Scaling group completed once the
+	// Agent has registered the instance and is healthy
+	LaunchLifecycleHookEnvVar = "ECS_INIT_LAUNCH_LIFECYCLE_HOOK"
+
+	// VerifyRegistrationEnvVar is the environment variable that sets how
+	// long the Agent has to register the instance into its cluster once it
+	// is started. Registration is not verified when it is unset.
+	VerifyRegistrationEnvVar = "ECS_INIT_VERIFY_REGISTRATION_TIMEOUT"
+
+	// BootstrapDeadlineEnvVar is the environment variable that sets how
+	// long downloading, loading and starting the Agent may take in a boot
+	// before ecs-init gives up
+	BootstrapDeadlineEnvVar = "ECS_INIT_BOOTSTRAP_DEADLINE"
+
+	// TaskMetadataCheckEnvVar is the environment variable that makes the
+	// task metadata endpoint be requested from a scratch network namespace
+	// once the Agent is healthy, and the outcome be recorded in the status
+	TaskMetadataCheckEnvVar = "ECS_INIT_TASK_METADATA_CHECK"
+
+	// InventoryIntervalEnvVar is the environment variable that sets how
+	// often the Agent is reported to SSM Inventory while it is supervised.
+	// Nothing is reported when it is unset.
+	InventoryIntervalEnvVar = "ECS_INIT_INVENTORY_INTERVAL"
+
+	// AutoUpdateIntervalEnvVar is the environment variable that sets how
+	// often ecs-init checks for a newer published Agent while it is
+	// supervised, and updates the Agent to it. The Agent is not updated by
+	// ecs-init when it is unset.
+	AutoUpdateIntervalEnvVar = "ECS_INIT_AUTO_UPDATE_INTERVAL"
+
+	// CanaryAgentVersionEnvVar is the environment variable that sets the
+	// version of the Agent run as a canary on a fraction of the instances,
+	// instead of the pinned version
+	CanaryAgentVersionEnvVar = "ECS_INIT_CANARY_AGENT_VERSION"
+
+	// CanaryRolloutParameterEnvVar is the environment variable that names
+	// the SSM parameter holding the percentage of the instances, from 0 to
+	// 100, that run the canary Agent
+	CanaryRolloutParameterEnvVar = "ECS_INIT_CANARY_ROLLOUT_SSM_PARAMETER"
+
+	// StartGateFileEnvVar is the environment variable that names a file
+	// that has to exist before the Agent is started
+	StartGateFileEnvVar = "ECS_INIT_START_GATE_FILE"
+
+	// StartGateCommandEnvVar is the environment variable that sets a shell
+	// command that has to succeed before the Agent is started
+	StartGateCommandEnvVar = "ECS_INIT_START_GATE_COMMAND"
+
+	// StartGateParameterEnvVar is the environment variable that sets an SSM
+	// parameter and the value it has to hold before the Agent is started, as
+	// name=value
+	StartGateParameterEnvVar = "ECS_INIT_START_GATE_SSM_PARAMETER"
+
+	// StartGateTimeoutEnvVar is the environment variable that sets how long
+	// the start gates are waited for before giving up on starting the
+	// Agent. They are waited for indefinitely when it is unset.
+	StartGateTimeoutEnvVar = "ECS_INIT_START_GATE_TIMEOUT"
+
+	// HealthCheckIntervalEnvVar is the environment variable that sets how
+	// often the health of the Agent is checked while it is supervised. The
+	// Agent is restarted when it fails consecutive checks. Its health is not
+	// checked when it is unset.
+	HealthCheckIntervalEnvVar = "ECS_INIT_HEALTH_CHECK_INTERVAL"
+
+	// AgentMaxRestartsEnvVar is the environment variable that sets how many
+	// times in a row the Agent is restarted after failing before ecs-init
+	// gives up and exits. The Agent is restarted indefinitely when it is
+	// unset.
+	AgentMaxRestartsEnvVar = "ECS_INIT_AGENT_MAX_RESTARTS"
+
+	// RegistrationTaggingEnvVar is the environment variable that lists,
+	// separated by commas, the resources tagged once the Agent registered
+	// the instance: RegistrationTaggingEC2Instance and
+	// RegistrationTaggingContainerInstance
+	RegistrationTaggingEnvVar = "ECS_INIT_REGISTRATION_TAGGING"
+	// RegistrationTaggingEC2Instance tags the EC2 instance
+	RegistrationTaggingEC2Instance = "ec2-instance"
+	// RegistrationTaggingContainerInstance tags the ECS container instance
+	RegistrationTaggingContainerInstance = "container-instance"
+
+	// FaultsEnvVar is the environment variable that sets the faults
+	// injected by binaries built with the faultinjection build tag
+	FaultsEnvVar = "ECS_INIT_FAULTS"
+
+	// AgentIntrospectionEndpoint is the endpoint of the introspection API
+	// of the Agent
+	AgentIntrospectionEndpoint = "http://127.0.0.1:51678"
 )
 
+// ErrRegionUnavailable is wrapped by errors returned when the region of the
+// instance cannot be determined or no agent bucket is available for it
+var ErrRegionUnavailable = errors.New("region unavailable")
+
 // partitionBucketRegion provides the "partitional" bucket region
 // suitable for downloading agent from.
 var partitionBucketRegion = map[string]string{
@@ -82,20 +763,20 @@ var partitionBucketRegion = map[string]string{
 	endpoints.AwsUsGovPartitionID: endpoints.UsGovWest1RegionID,
 }
 
-// goarch is an injectable GOARCH runtime string. This controls the
+// goarch is an injectable architecture string, detected from the host. This controls the
 // formatting of configuration for supported architectures.
-var goarch string = runtime.GOARCH
+var goarch string = hostArch()
 
 // GetAgentPartitionBucketRegion returns the s3 bucket region where ECS Agent artifact is located
 func GetAgentPartitionBucketRegion(region string) (string, error) {
 	regionPartition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region)
 	if !ok {
-		return "", errors.Errorf("could not resolve partition ID for region %q", region)
+		return "", fmt.Errorf("%w: could not resolve partition ID for region %q", ErrRegionUnavailable, region)
 	}
 
 	bucketRegion, ok := partitionBucketRegion[regionPartition.ID()]
 	if !ok {
-		return "", errors.Errorf("no bucket available for partition ID %q", regionPartition.ID())
+		return "", fmt.Errorf("%w: no bucket available for partition ID %q", ErrRegionUnavailable, regionPartition.ID())
 	}
 
 	return bucketRegion, nil
@@ -116,12 +797,31 @@ func AgentJSONConfigFile() string {
 	return AgentConfigDirectory() + "/ecs.config.json"
 }
 
+// SysctlProfileFile returns the location of a file of kernel parameters
+// overriding the default sysctl profile
+func SysctlProfileFile() string {
+	return AgentConfigDirectory() + "/sysctl.conf"
+}
+
+// BlueprintFile returns the location of the host blueprint that pre-start
+// converges the host toward
+func BlueprintFile() string {
+	return AgentConfigDirectory() + "/blueprint.yaml"
+}
+
+// InstanceAttributesDirectory returns the location of the directory of JSON
+// fragments merged into the instance attributes of the Agent
+func InstanceAttributesDirectory() string {
+	return AgentConfigDirectory() + "/attributes.d"
+}
+
 // LogDirectory returns the location on disk where logs should be placed
 func LogDirectory() string {
 	return directoryPrefix + "/var/log/ecs"
 }
 
-func initLogFile() string {
+// InitLogFile returns the log file of ecs-init
+func InitLogFile() string {
 	return LogDirectory() + "/ecs-init.log"
 }
 
@@ -130,6 +830,42 @@ func AgentDataDirectory() string {
 	return directoryPrefix + "/var/lib/ecs/data"
 }
 
+// FirelensDataDirectory returns the location on disk where the Agent writes
+// the config and socket directories of FireLens log routers, in a directory
+// per task
+func FirelensDataDirectory() string {
+	return AgentDataDirectory() + "/firelens"
+}
+
+// AgentDataBackupDirectory returns the location on disk where backups of the
+// Agent data directory are written by default
+func AgentDataBackupDirectory() string {
+	return directoryPrefix + "/var/lib/ecs/backups"
+}
+
+// IPAMDatabase returns the location on disk of the IP addresses allocated
+// to awsvpc tasks by the ecs-ipam CNI plugin
+func IPAMDatabase() string {
+	return AgentDataDirectory() + "/eni-ipam.db"
+}
+
+// NetnsDirectory returns the location on disk of named network namespaces
+func NetnsDirectory() string {
+	return directoryPrefix + "/var/run/netns"
+}
+
+// EBSMountDirectory returns the location on disk under which the Agent mounts
+// EBS volumes attached to tasks
+func EBSMountDirectory() string {
+	return directoryPrefix + "/mnt/ecs/ebs"
+}
+
+// EBSUdevRulesFile returns the location of the udev rules that name EBS NVMe
+// devices after their volume
+func EBSUdevRulesFile() string {
+	return directoryPrefix + "/etc/udev/rules.d/70-ec2-nvme-devices.rules"
+}
+
 // CacheDirectory returns the location on disk where Agent images should be cached
 func CacheDirectory() string {
 	return directoryPrefix + "/var/cache/ecs"
@@ -140,27 +876,472 @@ func CacheState() string {
 	return CacheDirectory() + "/state"
 }
 
+// RegionState returns the location on disk where the region discovered from
+// instance metadata is persisted
+func RegionState() string {
+	return CacheDirectory() + "/region"
+}
+
+// BootState returns the location on disk where the boots of the instance
+// seen by ecs-init are recorded
+func BootState() string {
+	return CacheDirectory() + "/boot"
+}
+
+// HostManifest returns the location on disk where the mutations ecs-init
+// made to the host in the current boot are recorded
+func HostManifest() string {
+	return CacheDirectory() + "/host-manifest"
+}
+
+// PreviousHostManifest returns the location on disk where the mutations
+// ecs-init made to the host in the previous boot are kept
+func PreviousHostManifest() string {
+	return HostManifest() + ".previous"
+}
+
+// BootReport returns the location on disk where the milestones of
+// bootstrapping the Agent in the current boot are reported
+func BootReport() string {
+	return CacheDirectory() + "/boot-report"
+}
+
+// PauseImageTarball returns the location on disk of the pause container
+// image loaded by the pause-image action
+func PauseImageTarball() string {
+	return CacheDirectory() + "/amazon-ecs-pause.tar"
+}
+
+// CanaryState returns the location on disk where the last canary Agent
+// that failed is recorded
+func CanaryState() string {
+	return CacheDirectory() + "/canary"
+}
+
+// BootstrapState returns the location on disk where the bootstrap of the
+// Agent in the current boot is recorded
+func BootstrapState() string {
+	return CacheDirectory() + "/bootstrap"
+}
+
+// UpdateAttemptState returns the location on disk where the last attempt to
+// update the Agent is recorded
+func UpdateAttemptState() string {
+	return CacheDirectory() + "/last-update"
+}
+
+// BootIDFile returns the file the kernel exposes the random ID of the current
+// boot in
+func BootIDFile() string {
+	return "/proc/sys/kernel/random/boot_id"
+}
+
+// RegionOverride returns the region configured to be used instead of the
+// region discovered from instance metadata
+func RegionOverride() string {
+	return os.Getenv(RegionOverrideEnvVar)
+}
+
+// S3Endpoint returns the s3 endpoint configured for Agent downloads, or an
+// empty string for the endpoint of the region
+func S3Endpoint() string {
+	return os.Getenv(S3EndpointEnvVar)
+}
+
+// S3Authenticated returns if Agent downloads are signed with the
+// credentials of the instance
+func S3Authenticated() bool {
+	return os.Getenv(S3AuthenticatedEnvVar) == "true"
+}
+
+// S3DownloadConcurrency returns how many parts of the Agent are downloaded
+// in parallel. Parts are downloaded one at a time by default so that they
+// are hashed as they are written.
+func S3DownloadConcurrency() (int, error) {
+	value := os.Getenv(S3DownloadConcurrencyEnvVar)
+	if value == "" {
+		return 1, nil
+	}
+	concurrency, err := strconv.Atoi(value)
+	if err != nil || concurrency < 1 {
+		return 1, errors.Errorf("invalid %s %q, expected a positive number", S3DownloadConcurrencyEnvVar, value)
+	}
+	return concurrency, nil
+}
+
+// SHA256Backend returns the name of the backend computing the SHA-256
+// digests of downloads, which is the fastest available one by default
+func SHA256Backend() string {
+	return os.Getenv(SHA256BackendEnvVar)
+}
+
+// PipelinedHashing returns if downloads are hashed on a worker while they
+// are written, which is the default
+func PipelinedHashing() bool {
+	return os.Getenv(PipelinedHashingEnvVar) != "false"
+}
+
+// DownloadRetryPolicy returns how failed downloads of the files of the Agent
+// are retried. Invalid settings are replaced by their default, and reported
+// in the returned error.
+func DownloadRetryPolicy() (backoff.Policy, error) {
+	policy := backoff.Policy{
+		MaxAttempts: DefaultDownloadMaxAttempts,
+		BaseDelay:   DefaultDownloadRetryDelay,
+		MaxDelay:    downloadRetryMaxDelay,
+		Multiplier:  2,
+		Jitter:      DefaultDownloadRetryJitter,
+	}
+	var invalid []string
+	if value := os.Getenv(DownloadMaxAttemptsEnvVar); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			invalid = append(invalid, fmt.Sprintf("%s %q, expected a positive number", DownloadMaxAttemptsEnvVar, value))
+		} else {
+			policy.MaxAttempts = attempts
+		}
+	}
+	if value := os.Getenv(DownloadRetryDelayEnvVar); value != "" {
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay < 0 {
+			invalid = append(invalid, fmt.Sprintf("%s %q, expected a duration such as 2s", DownloadRetryDelayEnvVar, value))
+		} else {
+			policy.BaseDelay = delay
+		}
+	}
+	if policy.BaseDelay > policy.MaxDelay {
+		policy.MaxDelay = policy.BaseDelay
+	}
+	if value := os.Getenv(DownloadRetryJitterEnvVar); value != "" {
+		jitter, err := strconv.ParseFloat(value, 64)
+		if err != nil || jitter < 0 || jitter > 1 {
+			invalid = append(invalid, fmt.Sprintf("%s %q, expected a fraction between 0 and 1", DownloadRetryJitterEnvVar, value))
+		} else {
+			policy.Jitter = jitter
+		}
+	}
+	if len(invalid) > 0 {
+		return policy, errors.Errorf("invalid %s", strings.Join(invalid, ", invalid "))
+	}
+	return policy, nil
+}
+
+// Offline returns if ecs-init runs without network access, using an Agent
+// pre-seeded in the cache directory
+func Offline() bool {
+	return os.Getenv(OfflineEnvVar) == "true"
+}
+
+// StreamingLoad returns if the Agent is loaded into Docker while it is
+// downloaded instead of once it is cached
+func StreamingLoad() bool {
+	return os.Getenv(StreamingLoadEnvVar) == "true"
+}
+
+// AgentBucketOverride returns the bucket configured to download the Agent
+// from instead of the Agent buckets
+func AgentBucketOverride() string {
+	return os.Getenv(AgentBucketEnvVar)
+}
+
+// AgentDownloadURL returns the URL of the directory configured to download
+// the Agent from instead of the Agent buckets, or nil when it is not set
+func AgentDownloadURL() (*url.URL, error) {
+	value := os.Getenv(AgentDownloadURLEnvVar)
+	if value == "" {
+		return nil, nil
+	}
+	downloadURL, err := url.Parse(value)
+	if err != nil || downloadURL.Scheme == "" {
+		return nil, errors.Errorf("invalid %s %q, expected an absolute URL", AgentDownloadURLEnvVar, value)
+	}
+	if !strings.HasSuffix(downloadURL.Path, "/") {
+		// the files of the Agent are resolved relative to the directory
+		downloadURL.Path += "/"
+	}
+	return downloadURL, nil
+}
+
+// AgentVerification returns the names of the validators a downloaded Agent
+// has to pass, in the order they are run
+func AgentVerification() ([]string, error) {
+	value := os.Getenv(AgentVerificationEnvVar)
+	if value == "" {
+		value = DefaultAgentVerification
+		if _, err := os.Stat(AgentSigningKeyFile()); err == nil {
+			value = SignedAgentVerification
+		}
+	}
+	var validators []string
+	seen := make(map[string]bool)
+	for _, validator := range strings.Split(value, ",") {
+		validator = strings.ToLower(strings.TrimSpace(validator))
+		if validator == "" || seen[validator] {
+			return nil, errors.Errorf("invalid %s %q, expected distinct validator names separated by commas",
+				AgentVerificationEnvVar, value)
+		}
+		seen[validator] = true
+		validators = append(validators, validator)
+	}
+	return validators, nil
+}
+
+// ContainerRuntime returns the container runtime the Agent is run by
+func ContainerRuntime() (string, error) {
+	switch runtime := os.Getenv(ContainerRuntimeEnvVar); runtime {
+	case "", ContainerRuntimeDocker:
+		return ContainerRuntimeDocker, nil
+	case ContainerRuntimeContainerd:
+		return runtime, nil
+	default:
+		return "", errors.Errorf("invalid %s %q, expected %q or %q", ContainerRuntimeEnvVar, runtime,
+			ContainerRuntimeDocker, ContainerRuntimeContainerd)
+	}
+}
+
+// ContainerdAddress returns the socket of containerd
+func ContainerdAddress() string {
+	if address := os.Getenv(ContainerdAddressEnvVar); address != "" {
+		return address
+	}
+	return DefaultContainerdAddress
+}
+
+// ContainerdAgentLogFile returns the file containerd writes the output of
+// the Agent container to
+func ContainerdAgentLogFile() string {
+	return LogDirectory() + "/ecs-agent-container.log"
+}
+
+// AgentRegistry returns the repository the Agent image is pulled from, or
+// an empty string when the Agent is downloaded from S3
+func AgentRegistry() (string, error) {
+	switch source := os.Getenv(AgentSourceEnvVar); source {
+	case "", AgentSourceS3:
+		return "", nil
+	case AgentSourceRegistry:
+		if registry := os.Getenv(AgentRegistryEnvVar); registry != "" {
+			return registry, nil
+		}
+		return DefaultAgentRegistry, nil
+	default:
+		return "", errors.Errorf("invalid %s %q, expected %q or %q", AgentSourceEnvVar, source,
+			AgentSourceS3, AgentSourceRegistry)
+	}
+}
+
+// SELinuxLabeling returns how the mounts of the Agent container are labeled
+// for SELinux. An invalid setting is replaced by SELinuxLabelingAuto and
+// reported in the returned error.
+func SELinuxLabeling() (string, error) {
+	switch labeling := strings.ToLower(os.Getenv(SELinuxLabelingEnvVar)); labeling {
+	case "":
+		return SELinuxLabelingAuto, nil
+	case SELinuxLabelingAuto, SELinuxLabelingRelabel, SELinuxLabelingDisable, SELinuxLabelingOff:
+		return labeling, nil
+	default:
+		return SELinuxLabelingAuto, errors.Errorf("invalid %s %q, expected %q, %q, %q or %q", SELinuxLabelingEnvVar,
+			labeling, SELinuxLabelingAuto, SELinuxLabelingRelabel, SELinuxLabelingDisable, SELinuxLabelingOff)
+	}
+}
+
+// AppArmorProfile returns the AppArmor profile the Agent container is
+// confined by on hosts where AppArmor is enabled. Any profile loaded on the
+// host can be named, and AppArmorProfileUnconfined disables confinement.
+func AppArmorProfile() string {
+	if profile := os.Getenv(AppArmorProfileEnvVar); profile != "" {
+		return profile
+	}
+	return DefaultAppArmorProfile
+}
+
+// AgentNetwork returns the network of the Agent container. An invalid
+// setting is replaced by AgentNetworkHost and reported in the returned error.
+func AgentNetwork() (string, error) {
+	switch network := strings.ToLower(os.Getenv(AgentNetworkEnvVar)); network {
+	case "":
+		return AgentNetworkHost, nil
+	case AgentNetworkHost, AgentNetworkBridge:
+		return network, nil
+	default:
+		return AgentNetworkHost, errors.Errorf("invalid %s %q, expected %q or %q", AgentNetworkEnvVar,
+			network, AgentNetworkHost, AgentNetworkBridge)
+	}
+}
+
+// AgentEgress returns the egress policy of the Agent container. An invalid
+// setting is replaced by AgentEgressRestricted, so that a typo does not open
+// the egress of the Agent, and reported in the returned error.
+func AgentEgress() (string, error) {
+	switch egress := strings.ToLower(os.Getenv(AgentEgressEnvVar)); egress {
+	case "":
+		return AgentEgressOpen, nil
+	case AgentEgressOpen, AgentEgressRestricted:
+		return egress, nil
+	default:
+		return AgentEgressRestricted, errors.Errorf("invalid %s %q, expected %q or %q", AgentEgressEnvVar,
+			egress, AgentEgressOpen, AgentEgressRestricted)
+	}
+}
+
+// AgentEgressAllow returns the host names and CIDR blocks the Agent container
+// may connect to in addition to the endpoints of the services it depends on
+func AgentEgressAllow() []string {
+	var allowed []string
+	for _, destination := range strings.Split(os.Getenv(AgentEgressAllowEnvVar), ",") {
+		if destination = strings.TrimSpace(destination); destination != "" {
+			allowed = append(allowed, destination)
+		}
+	}
+	return allowed
+}
+
+// AgentRegistryImage returns the image of the Agent version to pull from
+// registry, unless the registry names a tag or digest already
+func AgentRegistryImage(registry string, version string) string {
+	name := registry[strings.LastIndex(registry, "/")+1:]
+	if strings.ContainsAny(name, ":@") {
+		return registry
+	}
+	return registry + ":" + version
+}
+
+// IMDSv2Only returns if instance metadata must only be read with an IMDSv2
+// session token
+func IMDSv2Only() bool {
+	return os.Getenv(IMDSv2OnlyEnvVar) == "true"
+}
+
+// CABundle returns the file of CA certificates trusted when downloading the
+// Agent, in addition to the system ones
+func CABundle() string {
+	return os.Getenv(CABundleEnvVar)
+}
+
+// ClientCertificate returns the files of the client certificate and its
+// private key presented when downloading the Agent
+func ClientCertificate() (certFile string, keyFile string) {
+	return os.Getenv(ClientCertEnvVar), os.Getenv(ClientKeyEnvVar)
+}
+
+// IMDSEndpoint returns the endpoint of the EC2 Instance Metadata Service
+func IMDSEndpoint() string {
+	if endpoint := os.Getenv(IMDSEndpointEnvVar); endpoint != "" {
+		return endpoint
+	}
+	return InstanceMetadataEndpoint
+}
+
+// IMDSRetries returns how many times a failed request to the EC2 Instance
+// Metadata Service is retried
+func IMDSRetries() (int, error) {
+	value := os.Getenv(IMDSRetriesEnvVar)
+	if value == "" {
+		return DefaultIMDSRetries, nil
+	}
+	retries, err := strconv.Atoi(value)
+	if err != nil || retries < 0 {
+		return DefaultIMDSRetries, errors.Errorf("invalid %s %q, expected a non-negative number", IMDSRetriesEnvVar, value)
+	}
+	return retries, nil
+}
+
+// PreviousAgents returns how many previously cached Agent images are kept
+// to roll back to when a newly downloaded one fails
+func PreviousAgents() (int, error) {
+	value := os.Getenv(PreviousAgentsEnvVar)
+	if value == "" {
+		return DefaultPreviousAgents, nil
+	}
+	previous, err := strconv.Atoi(value)
+	if err != nil || previous < 0 {
+		return DefaultPreviousAgents, errors.Errorf("invalid %s %q, expected a non-negative number", PreviousAgentsEnvVar, value)
+	}
+	return previous, nil
+}
+
+// SystemdUnitDirectory returns the location on disk of systemd units
+// configured for the host
+func SystemdUnitDirectory() string {
+	return directoryPrefix + "/etc/systemd/system"
+}
+
+// InstanceIDFile returns the location on disk of the instance ID recorded by
+// cloud-init for the current boot
+func InstanceIDFile() string {
+	return directoryPrefix + "/var/lib/cloud/data/instance-id"
+}
+
 // AgentTarball returns the location on disk of the cached Agent image
 func AgentTarball() string {
 	return CacheDirectory() + "/ecs-agent.tar"
 }
 
-// AgentRemoteTarballKey is the remote filename of the Agent image, used for populating the cache
-func AgentRemoteTarballKey() (string, error) {
-	name, err := agentArtifactName(DefaultAgentVersion, goarch)
+// ChecksumFile returns the location of the local file holding the SHA-256 sum
+// of tarball, used to verify an Agent pre-seeded for offline mode
+func ChecksumFile(tarball string) string {
+	return tarball + ".sha256"
+}
+
+// PreviousAgentsDirectory returns the location on disk where previously
+// cached Agent images are kept to roll back to
+func PreviousAgentsDirectory() string {
+	return CacheDirectory() + "/previous"
+}
+
+// AgentVersion returns the version of the Agent pinned in the environment, or
+// DefaultAgentVersion when none is pinned
+func AgentVersion() string {
+	return AgentVersionOrDefault(os.Getenv(AgentVersionEnvVar))
+}
+
+// AgentVersionOrDefault returns version as it appears in the name of the
+// Agent artifacts, where 1.76.0 is published as v1.76.0, or
+// DefaultAgentVersion when version is empty
+func AgentVersionOrDefault(version string) string {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return DefaultAgentVersion
+	}
+	if version[0] >= '0' && version[0] <= '9' && strings.Contains(version, ".") {
+		return "v" + version
+	}
+	return version
+}
+
+// AgentRemoteTarballKey is the remote filename of version of the Agent image, used for populating the cache
+func AgentRemoteTarballKey(version string) (string, error) {
+	name, err := agentArtifactName(version, AgentArch())
 	if err != nil {
 		return "", errors.Wrap(err, "no artifact available")
 	}
 	return fmt.Sprintf("%s.tar", name), nil
 }
 
-// AgentRemoteTarballMD5Key is the remote file of a md5sum used to verify the integrity of the AgentRemoteTarball
-func AgentRemoteTarballMD5Key() (string, error) {
-	tarballKey, err := AgentRemoteTarballKey()
+// AgentRemoteTarballSHA256Key is the remote file of a SHA-256 sum used to verify the integrity of the
+// AgentRemoteTarball
+func AgentRemoteTarballSHA256Key(version string) (string, error) {
+	tarballKey, err := AgentRemoteTarballKey(version)
+	if err != nil {
+		return "", err
+	}
+	return tarballKey + ".sha256", nil
+}
+
+// AgentRemoteTarballSignatureKey is the remote file of the ASCII armored detached PGP signature of the
+// AgentRemoteTarball
+func AgentRemoteTarballSignatureKey(version string) (string, error) {
+	tarballKey, err := AgentRemoteTarballKey(version)
 	if err != nil {
 		return "", err
 	}
-	return tarballKey + ".md5", nil
+	return tarballKey + ".asc", nil
+}
+
+// AgentSigningKeyFile returns the location on disk of the ASCII armored PGP public key of the Amazon ECS Container
+// Agent, which verifies the signature of the AgentRemoteTarball
+func AgentSigningKeyFile() string {
+	return directoryPrefix + "/usr/share/amazon-ecs-init/agent-signing-key.asc"
 }
 
 // DesiredImageLocatorFile returns the location on disk of a well-known file describing an Agent image to load
@@ -168,16 +1349,620 @@ func DesiredImageLocatorFile() string {
 	return CacheDirectory() + "/desired-image"
 }
 
+// PrestartMarkerDirectory returns the location on disk where the pre-start
+// steps that succeeded are marked. It does not survive a reboot.
+func PrestartMarkerDirectory() string {
+	return directoryPrefix + "/var/run/ecs-init/prestart"
+}
+
+// SupervisorLockFile returns the location of the pidfile locked by the
+// ecs-init instance supervising the Agent
+func SupervisorLockFile() string {
+	return directoryPrefix + "/var/run/ecs-init.pid"
+}
+
+// EngineStatusFile returns the location on disk where the state of the engine
+// supervising the Agent is recorded
+func EngineStatusFile() string {
+	return CacheDirectory() + "/status"
+}
+
+// StandbyImageLocatorFile returns the location on disk of a well-known file
+// describing an Agent image to preload ahead of an upgrade
+func StandbyImageLocatorFile() string {
+	return CacheDirectory() + "/standby-image"
+}
+
+// StandbyPreloadEnabled returns if the Agent image described by the
+// standby image locator file should be preloaded while the Agent runs
+func StandbyPreloadEnabled() bool {
+	return os.Getenv(StandbyPreloadEnvVar) == "true"
+}
+
+// MaintenanceWindows returns the maintenance windows outside of which the
+// Agent is not restarted to upgrade it
+func MaintenanceWindows() string {
+	return os.Getenv(MaintenanceWindowsEnvVar)
+}
+
+// MaintenanceConcurrencyParameter returns the name of the SSM parameter
+// holding the percentage of instances that may act at once in a maintenance
+// window
+func MaintenanceConcurrencyParameter() string {
+	return os.Getenv(MaintenanceConcurrencyParameterEnvVar)
+}
+
+// UpgradeScaleInProtection returns if the instance is protected from scale
+// in while the Agent is upgraded
+func UpgradeScaleInProtection() bool {
+	return os.Getenv(UpgradeScaleInProtectionEnvVar) == "true"
+}
+
+// LaunchLifecycleHook returns the name of the launch lifecycle hook completed
+// once the Agent is ready, or an empty string if there is none
+func LaunchLifecycleHook() string {
+	return os.Getenv(LaunchLifecycleHookEnvVar)
+}
+
+// TaskMetadataCheck returns if the task metadata endpoint is checked once the
+// Agent is healthy
+func TaskMetadataCheck() bool {
+	return os.Getenv(TaskMetadataCheckEnvVar) == "true"
+}
+
+// VerifyRegistrationTimeout returns how long the Agent has to register the
+// instance into its cluster, or zero when registration is not verified
+func VerifyRegistrationTimeout() (time.Duration, error) {
+	value := os.Getenv(VerifyRegistrationEnvVar)
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", VerifyRegistrationEnvVar)
+	}
+	if timeout <= 0 {
+		return 0, errors.Errorf("%s must be positive", VerifyRegistrationEnvVar)
+	}
+	return timeout, nil
+}
+
+// DockerReadyTimeout returns how long ecs-init waits for the Docker daemon
+// to respond before failing
+func DockerReadyTimeout() (time.Duration, error) {
+	value := os.Getenv(DockerReadyTimeoutEnvVar)
+	if value == "" {
+		return DefaultDockerReadyTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", DockerReadyTimeoutEnvVar)
+	}
+	if timeout <= 0 {
+		return 0, errors.Errorf("%s must be positive", DockerReadyTimeoutEnvVar)
+	}
+	return timeout, nil
+}
+
+// HookTimeout returns how long each hook script may run before it is killed
+func HookTimeout() (time.Duration, error) {
+	value := os.Getenv(HookTimeoutEnvVar)
+	if value == "" {
+		return DefaultHookTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return DefaultHookTimeout, errors.Wrapf(err, "invalid %s", HookTimeoutEnvVar)
+	}
+	if timeout <= 0 {
+		return DefaultHookTimeout, errors.Errorf("%s must be positive", HookTimeoutEnvVar)
+	}
+	return timeout, nil
+}
+
+// AgentImageRetention returns how many previous Agent images are kept in
+// Docker when pruning them
+func AgentImageRetention() (int, error) {
+	value := os.Getenv(AgentImageRetentionEnvVar)
+	if value == "" {
+		return DefaultAgentImageRetention, nil
+	}
+	retention, err := strconv.Atoi(value)
+	if err != nil || retention < 0 {
+		return DefaultAgentImageRetention, errors.Errorf("invalid %s %q, expected a non-negative number", AgentImageRetentionEnvVar, value)
+	}
+	return retention, nil
+}
+
+// PruneAgentImages returns if the previous Agent images are pruned once the
+// Agent is healthy
+func PruneAgentImages() bool {
+	return os.Getenv(PruneAgentImagesEnvVar) == "true"
+}
+
+// DownloadJitter returns the longest delay of a download of the Agent, or
+// zero when downloads are not delayed
+func DownloadJitter() (time.Duration, error) {
+	value := os.Getenv(DownloadJitterEnvVar)
+	if value == "" {
+		return 0, nil
+	}
+	jitter, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", DownloadJitterEnvVar)
+	}
+	if jitter < 0 {
+		return 0, errors.Errorf("%s must not be negative", DownloadJitterEnvVar)
+	}
+	return jitter, nil
+}
+
+// DownloadGateParameter returns the name of the SSM parameter gating the
+// downloads of the Agent, if any
+func DownloadGateParameter() string {
+	return os.Getenv(DownloadGateParameterEnvVar)
+}
+
+// BootstrapDeadline returns how long the Agent has to be healthy from the
+// first pre-start of a boot, or zero when there is no deadline
+func BootstrapDeadline() (time.Duration, error) {
+	value := os.Getenv(BootstrapDeadlineEnvVar)
+	if value == "" {
+		return 0, nil
+	}
+	deadline, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", BootstrapDeadlineEnvVar)
+	}
+	if deadline <= 0 {
+		return 0, errors.Errorf("%s must be positive", BootstrapDeadlineEnvVar)
+	}
+	return deadline, nil
+}
+
+// minInventoryInterval keeps reports to SSM Inventory from being throttled
+const minInventoryInterval = time.Minute
+
+// InventoryInterval returns how often the Agent is reported to SSM
+// Inventory, or zero when it is not reported
+func InventoryInterval() (time.Duration, error) {
+	value := os.Getenv(InventoryIntervalEnvVar)
+	if value == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", InventoryIntervalEnvVar)
+	}
+	if interval < minInventoryInterval {
+		return 0, errors.Errorf("%s must be at least %s", InventoryIntervalEnvVar, minInventoryInterval)
+	}
+	return interval, nil
+}
+
+// minAutoUpdateInterval keeps the checks for a newer Agent from hammering
+// the agent bucket across a fleet
+const minAutoUpdateInterval = 5 * time.Minute
+
+// AutoUpdateInterval returns how often ecs-init checks for a newer published
+// Agent, or zero when it does not
+func AutoUpdateInterval() (time.Duration, error) {
+	value := os.Getenv(AutoUpdateIntervalEnvVar)
+	if value == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", AutoUpdateIntervalEnvVar)
+	}
+	if interval < minAutoUpdateInterval {
+		return 0, errors.Errorf("%s must be at least %s", AutoUpdateIntervalEnvVar, minAutoUpdateInterval)
+	}
+	return interval, nil
+}
+
+// CanaryAgent returns the version of the canary Agent, as it appears in the
+// name of the Agent artifacts, and the SSM parameter holding its rollout
+// percentage, or an empty version when there is no canary Agent
+func CanaryAgent() (version string, parameter string, err error) {
+	version = strings.TrimSpace(os.Getenv(CanaryAgentVersionEnvVar))
+	parameter = os.Getenv(CanaryRolloutParameterEnvVar)
+	if version == "" && parameter == "" {
+		return "", "", nil
+	}
+	if version == "" || parameter == "" {
+		return "", "", errors.Errorf("%s and %s have to be set together", CanaryAgentVersionEnvVar,
+			CanaryRolloutParameterEnvVar)
+	}
+	return AgentVersionOrDefault(version), parameter, nil
+}
+
+// StartGateFile returns the file that has to exist before the Agent is
+// started, or an empty string when there is none
+func StartGateFile() string {
+	return os.Getenv(StartGateFileEnvVar)
+}
+
+// StartGateCommand returns the shell command that has to succeed before the
+// Agent is started, or an empty string when there is none
+func StartGateCommand() string {
+	return os.Getenv(StartGateCommandEnvVar)
+}
+
+// StartGateParameter returns the name of the SSM parameter that has to hold
+// value before the Agent is started, or an empty name when there is none
+func StartGateParameter() (name string, value string, err error) {
+	gate := os.Getenv(StartGateParameterEnvVar)
+	if gate == "" {
+		return "", "", nil
+	}
+	parts := strings.SplitN(gate, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", errors.Errorf("invalid %s %q, expected name=value", StartGateParameterEnvVar, gate)
+	}
+	return parts[0], parts[1], nil
+}
+
+// StartGateTimeout returns how long the start gates are waited for, or zero
+// when they are waited for indefinitely
+func StartGateTimeout() (time.Duration, error) {
+	value := os.Getenv(StartGateTimeoutEnvVar)
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", StartGateTimeoutEnvVar)
+	}
+	if timeout <= 0 {
+		return 0, errors.Errorf("%s must be positive", StartGateTimeoutEnvVar)
+	}
+	return timeout, nil
+}
+
+// minHealthCheckInterval leaves the Agent time to answer a health check
+// before the next one
+const minHealthCheckInterval = 10 * time.Second
+
+// HealthCheckInterval returns how often the health of the Agent is checked,
+// or zero when it is not
+func HealthCheckInterval() (time.Duration, error) {
+	value := os.Getenv(HealthCheckIntervalEnvVar)
+	if value == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", HealthCheckIntervalEnvVar)
+	}
+	if interval < minHealthCheckInterval {
+		return 0, errors.Errorf("%s must be at least %s", HealthCheckIntervalEnvVar, minHealthCheckInterval)
+	}
+	return interval, nil
+}
+
+// MetricsAddress returns the address the metrics of ecs-init are served on,
+// or an empty string if they are not. Only loopback addresses are allowed,
+// as the metrics are not authenticated.
+func MetricsAddress() (string, error) {
+	value := os.Getenv(MetricsAddressEnvVar)
+	if value == "" {
+		return "", nil
+	}
+	host, _, err := net.SplitHostPort(value)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid %s", MetricsAddressEnvVar)
+	}
+	if host == "localhost" {
+		return value, nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return "", errors.Errorf("%s %q is not a loopback address", MetricsAddressEnvVar, value)
+	}
+	return value, nil
+}
+
+// AgentMaxRestarts returns how many times in a row the Agent is restarted
+// after failing, or zero when it is restarted indefinitely
+func AgentMaxRestarts() (int, error) {
+	value := os.Getenv(AgentMaxRestartsEnvVar)
+	if value == "" {
+		return 0, nil
+	}
+	restarts, err := strconv.Atoi(value)
+	if err != nil || restarts < 1 {
+		return 0, errors.Errorf("invalid %s %q, expected a positive number", AgentMaxRestartsEnvVar, value)
+	}
+	return restarts, nil
+}
+
+// RegistrationTagging returns whether the EC2 instance and the ECS container
+// instance are tagged once the Agent registered the instance
+func RegistrationTagging() (ec2Instance bool, containerInstance bool, err error) {
+	value := os.Getenv(RegistrationTaggingEnvVar)
+	if value == "" {
+		return false, false, nil
+	}
+	for _, resource := range strings.Split(value, ",") {
+		switch strings.TrimSpace(resource) {
+		case RegistrationTaggingEC2Instance:
+			ec2Instance = true
+		case RegistrationTaggingContainerInstance:
+			containerInstance = true
+		default:
+			return false, false, errors.Errorf("invalid %s %q, expected %q or %q", RegistrationTaggingEnvVar, value,
+				RegistrationTaggingEC2Instance, RegistrationTaggingContainerInstance)
+		}
+	}
+	return ec2Instance, containerInstance, nil
+}
+
+// DockerdSupervision returns what to do when the Docker daemon stops
+// responding, or an empty string when it is not supervised
+func DockerdSupervision() (string, error) {
+	mode := os.Getenv(DockerdSupervisionEnvVar)
+	switch mode {
+	case "", DockerdSupervisionAlert, DockerdSupervisionRestart:
+		return mode, nil
+	}
+	return "", errors.Errorf("invalid %s %q, expected %q or %q", DockerdSupervisionEnvVar, mode,
+		DockerdSupervisionAlert, DockerdSupervisionRestart)
+}
+
+// ConfigWatch returns the policy for changes to the agent config file, or
+// ConfigWatchIgnore if none is set
+func ConfigWatch() (string, error) {
+	policy := os.Getenv(ConfigWatchEnvVar)
+	switch policy {
+	case "":
+		return ConfigWatchIgnore, nil
+	case ConfigWatchRestart, ConfigWatchDrift, ConfigWatchIgnore:
+		return policy, nil
+	}
+	return ConfigWatchIgnore, errors.Errorf("invalid %s %q, expected %q, %q or %q", ConfigWatchEnvVar, policy,
+		ConfigWatchRestart, ConfigWatchDrift, ConfigWatchIgnore)
+}
+
+// LogSupervision returns what to do when the logs take more than their
+// maximum size, or an empty string when they are not supervised
+func LogSupervision() (string, error) {
+	policy := os.Getenv(LogSupervisionEnvVar)
+	switch policy {
+	case "", LogSupervisionAlert, LogSupervisionTrim:
+		return policy, nil
+	}
+	return "", errors.Errorf("invalid %s %q, expected %q or %q", LogSupervisionEnvVar, policy,
+		LogSupervisionAlert, LogSupervisionTrim)
+}
+
+// LogMaxSize returns the maximum size of the logs in bytes
+func LogMaxSize() (int64, error) {
+	value := os.Getenv(LogMaxSizeEnvVar)
+	if value == "" {
+		return DefaultLogMaxSize * 1024 * 1024, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 1 {
+		return DefaultLogMaxSize * 1024 * 1024, errors.Errorf("invalid %s %q, expected a positive number of MiB",
+			LogMaxSizeEnvVar, value)
+	}
+	return size * 1024 * 1024, nil
+}
+
+// LogVolumeThreshold returns the fraction of the volume holding the logs
+// that may be in use before it is reported
+func LogVolumeThreshold() (float64, error) {
+	value := os.Getenv(LogVolumeThresholdEnvVar)
+	if value == "" {
+		return DefaultLogVolumeThreshold / 100.0, nil
+	}
+	percent, err := strconv.Atoi(value)
+	if err != nil || percent < 1 || percent > 100 {
+		return DefaultLogVolumeThreshold / 100.0, errors.Errorf("invalid %s %q, expected a percentage from 1 to 100",
+			LogVolumeThresholdEnvVar, value)
+	}
+	return float64(percent) / 100, nil
+}
+
+// LogLevel returns the lowest level of the messages ecs-init logs
+func LogLevel() (string, error) {
+	level := os.Getenv(LogLevelEnvVar)
+	switch level {
+	case "":
+		return DefaultLogLevel, nil
+	case "debug", "info", "warn", "error", "crit":
+		return level, nil
+	}
+	return DefaultLogLevel, errors.Errorf("invalid %s %q, expected debug, info, warn, error or crit", LogLevelEnvVar, level)
+}
+
+// LogFormat returns the format of the log of ecs-init
+func LogFormat() (string, error) {
+	format := os.Getenv(LogFormatEnvVar)
+	switch format {
+	case "":
+		return LogFormatText, nil
+	case LogFormatText, LogFormatJSON:
+		return format, nil
+	}
+	return LogFormatText, errors.Errorf("invalid %s %q, expected %q or %q", LogFormatEnvVar, format,
+		LogFormatText, LogFormatJSON)
+}
+
+// LogOutput returns where the log of ecs-init is written
+func LogOutput() (string, error) {
+	output := os.Getenv(LogOutputEnvVar)
+	switch output {
+	case "":
+		return LogOutputAll, nil
+	case LogOutputFile, LogOutputConsole, LogOutputAll, LogOutputJournal:
+		return output, nil
+	}
+	return LogOutputAll, errors.Errorf("invalid %s %q, expected %q, %q, %q or %q", LogOutputEnvVar, output,
+		LogOutputFile, LogOutputConsole, LogOutputAll, LogOutputJournal)
+}
+
+// LogRollover returns when the log file of ecs-init is rotated
+func LogRollover() (string, error) {
+	rollover := os.Getenv(LogRolloverEnvVar)
+	switch rollover {
+	case "":
+		return LogRolloverHourly, nil
+	case LogRolloverHourly, LogRolloverSize:
+		return rollover, nil
+	}
+	return LogRolloverHourly, errors.Errorf("invalid %s %q, expected %q or %q", LogRolloverEnvVar, rollover,
+		LogRolloverHourly, LogRolloverSize)
+}
+
+// LogFileSize returns the size in bytes the log file of ecs-init is rotated
+// at when it is rotated by size
+func LogFileSize() (int64, error) {
+	value := os.Getenv(LogFileSizeEnvVar)
+	if value == "" {
+		return DefaultLogFileSize * 1024 * 1024, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 1 {
+		return DefaultLogFileSize * 1024 * 1024, errors.Errorf("invalid %s %q, expected a positive number of MiB",
+			LogFileSizeEnvVar, value)
+	}
+	return size * 1024 * 1024, nil
+}
+
+// LogFileNum returns how many rotated log files of ecs-init are kept
+func LogFileNum() (int, error) {
+	value := os.Getenv(LogFileNumEnvVar)
+	if value == "" {
+		return DefaultLogFileNum, nil
+	}
+	num, err := strconv.Atoi(value)
+	if err != nil || num < 1 {
+		return DefaultLogFileNum, errors.Errorf("invalid %s %q, expected a positive number", LogFileNumEnvVar, value)
+	}
+	return num, nil
+}
+
+// LogMaxAge returns how long rotated log files of ecs-init are kept, or zero
+// when they are kept regardless of their age
+func LogMaxAge() (time.Duration, error) {
+	value := os.Getenv(LogMaxAgeEnvVar)
+	if value == "" {
+		return 0, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age <= 0 {
+		return 0, errors.Errorf("invalid %s %q, expected a positive duration", LogMaxAgeEnvVar, value)
+	}
+	return age, nil
+}
+
+// Faults returns the faults to inject, see the faults package
+func Faults() string {
+	return os.Getenv(FaultsEnvVar)
+}
+
+// VolumePluginExecutable returns the location on disk of the volume plugin
+func VolumePluginExecutable() string {
+	return directoryPrefix + "/usr/libexec/amazon-ecs-volume-plugin"
+}
+
+// VolumePluginSocket returns the location of the socket the volume plugin
+// listens on
+func VolumePluginSocket() string {
+	return directoryPrefix + "/run/docker/plugins/amazon-ecs-volume-plugin.sock"
+}
+
+// DockerDaemonConfigFile returns the location of the configuration file of
+// the Docker daemon
+func DockerDaemonConfigFile() string {
+	return directoryPrefix + "/etc/docker/daemon.json"
+}
+
+// VolumePluginSpecFile returns the location of the file registering the
+// volume plugin with Docker
+func VolumePluginSpecFile() string {
+	return directoryPrefix + "/etc/docker/plugins/amazon-ecs-volume-plugin.spec"
+}
+
+// VolumePluginEnabled returns if the volume plugin should be supervised
+// while the Agent runs
+func VolumePluginEnabled() bool {
+	return os.Getenv(VolumePluginEnvVar) == "true"
+}
+
+// IntrospectionSocket returns the unix socket the introspection API of the
+// Agent is served on, or an empty string if it is not
+func IntrospectionSocket() string {
+	return os.Getenv(IntrospectionSocketEnvVar)
+}
+
+// IntrospectionSocketGroup returns the group allowed to connect to the
+// introspection socket besides root, if any
+func IntrospectionSocketGroup() string {
+	return os.Getenv(IntrospectionSocketGroupEnvVar)
+}
+
+// IntrospectionTokenFile returns the file holding the bearer token of the
+// introspection socket, if requests have to be authenticated
+func IntrospectionTokenFile() string {
+	return os.Getenv(IntrospectionTokenFileEnvVar)
+}
+
 // DockerUnixSocket returns the docker socket endpoint and whether it's read from DockerHostEnvVar
 func DockerUnixSocket() (string, bool) {
-	if dockerHost := os.Getenv(DockerHostEnvVar); strings.HasPrefix(dockerHost, UnixSocketPrefix) {
+	dockerHost := os.Getenv(DockerHostEnvVar)
+	if strings.HasPrefix(dockerHost, UnixSocketPrefix) {
 		return strings.TrimPrefix(dockerHost, UnixSocketPrefix), true
 	}
+	if strings.HasPrefix(dockerHost, "/") {
+		return dockerHost, true
+	}
 	// return /var/run instead of /var/run/docker.sock, in case the /var/run/docker.sock is deleted and recreated
 	// outside the container, eg: Docker daemon restart
 	return "/var/run", false
 }
 
+// DockerEndpoint returns the endpoint of the Docker daemon, from
+// DockerHostEnvVar, which is either a unix socket, given as a path or a
+// unix:// URL such as the sockets of Podman and of rootless daemons, or a
+// tcp:// URL. It defaults to /var/run/docker.sock.
+func DockerEndpoint() (string, error) {
+	dockerHost := os.Getenv(DockerHostEnvVar)
+	switch {
+	case dockerHost == "":
+		return UnixSocketPrefix + "/var/run/docker.sock", nil
+	case strings.HasPrefix(dockerHost, "/"):
+		return UnixSocketPrefix + dockerHost, nil
+	case strings.HasPrefix(dockerHost, UnixSocketPrefix):
+		if !strings.HasPrefix(strings.TrimPrefix(dockerHost, UnixSocketPrefix), "/") {
+			return "", errors.Errorf("invalid %s %q, expected an absolute socket path", DockerHostEnvVar, dockerHost)
+		}
+		return dockerHost, nil
+	case strings.HasPrefix(dockerHost, TCPSocketPrefix):
+		_, port, err := net.SplitHostPort(strings.TrimPrefix(dockerHost, TCPSocketPrefix))
+		if err != nil || port == "" {
+			return "", errors.Errorf("invalid %s %q, expected tcp://host:port", DockerHostEnvVar, dockerHost)
+		}
+		return dockerHost, nil
+	}
+	return "", errors.Errorf("invalid %s %q, expected a unix socket or tcp://host:port", DockerHostEnvVar, dockerHost)
+}
+
+// DockerTLSCertPath returns the directory holding the TLS certificates of
+// the connection to the Docker daemon, or an empty string when the
+// connection does not use TLS, as DockerTLSVerifyEnvVar is not set
+func DockerTLSCertPath() string {
+	if os.Getenv(DockerTLSVerifyEnvVar) == "" {
+		return ""
+	}
+	if certPath := os.Getenv(DockerCertPathEnvVar); certPath != "" {
+		return certPath
+	}
+	return DefaultDockerCertPath
+}
+
 // CgroupMountpoint returns the cgroup mountpoint for the system
 func CgroupMountpoint() string {
 	return cgroupMountpoint
@@ -226,6 +2011,24 @@ func InstanceConfigDirectory() string {
 	return directoryPrefix + "/var/lib/ecs"
 }
 
+// FailureReportFile returns the location on disk of the report of the
+// failure that stopped ecs-init from bootstrapping the Agent
+func FailureReportFile() string {
+	return InstanceConfigDirectory() + "/failure.json"
+}
+
+// HooksDirectory returns the directory holding a directory of hook scripts
+// per stage, such as pre-start.d
+func HooksDirectory() string {
+	return AgentConfigDirectory() + "/init-hooks"
+}
+
+// HistoryFile returns the location on disk of the history of the lifecycle
+// events of the Agent
+func HistoryFile() string {
+	return InstanceConfigDirectory() + "/history"
+}
+
 // InstanceConfigFile returns the location of a file of custom environment variables
 func InstanceConfigFile() string {
 	return InstanceConfigDirectory() + "/ecs.config"
@@ -14,9 +14,12 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestDockerUnixSocketWithoutDockerHost(t *testing.T) {
@@ -47,6 +50,51 @@ func TestDockerUnixSocketWithDockerHost(t *testing.T) {
 	}
 }
 
+func TestDockerEndpoint(t *testing.T) {
+	defer os.Unsetenv("DOCKER_HOST")
+	testCases := []struct {
+		dockerHost string
+		endpoint   string
+		valid      bool
+	}{
+		{"", "unix:///var/run/docker.sock", true},
+		{"/run/podman/podman.sock", "unix:///run/podman/podman.sock", true},
+		{"unix:///run/user/1000/docker.sock", "unix:///run/user/1000/docker.sock", true},
+		{"tcp://127.0.0.1:2376", "tcp://127.0.0.1:2376", true},
+		{"unix://docker.sock", "", false},
+		{"tcp://127.0.0.1", "", false},
+		{"ssh://docker@host", "", false},
+	}
+	for _, tc := range testCases {
+		os.Setenv("DOCKER_HOST", tc.dockerHost)
+		endpoint, err := DockerEndpoint()
+		if tc.valid && (err != nil || endpoint != tc.endpoint) {
+			t.Errorf("DockerEndpoint() with %q = %q, %v, expected %q", tc.dockerHost, endpoint, err, tc.endpoint)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("DockerEndpoint() with %q should be invalid", tc.dockerHost)
+		}
+	}
+}
+
+func TestDockerTLSCertPath(t *testing.T) {
+	defer os.Unsetenv("DOCKER_TLS_VERIFY")
+	defer os.Unsetenv("DOCKER_CERT_PATH")
+
+	os.Unsetenv("DOCKER_TLS_VERIFY")
+	if certPath := DockerTLSCertPath(); certPath != "" {
+		t.Errorf("DockerTLSCertPath() without DOCKER_TLS_VERIFY = %q, expected none", certPath)
+	}
+	os.Setenv("DOCKER_TLS_VERIFY", "1")
+	if certPath := DockerTLSCertPath(); certPath != DefaultDockerCertPath {
+		t.Errorf("DockerTLSCertPath() = %q, expected %q", certPath, DefaultDockerCertPath)
+	}
+	os.Setenv("DOCKER_CERT_PATH", "/etc/ecs/docker")
+	if certPath := DockerTLSCertPath(); certPath != "/etc/ecs/docker" {
+		t.Errorf("DockerTLSCertPath() = %q, expected /etc/ecs/docker", certPath)
+	}
+}
+
 func TestGetAgentPartitionBucketRegion(t *testing.T) {
 	testCases := []struct {
 		region      string
@@ -64,7 +112,7 @@ func TestGetAgentPartitionBucketRegion(t *testing.T) {
 			destination: "cn-north-1",
 		}, {
 			region: "invalid",
-			err:    fmt.Errorf("Partition not found"),
+			err:    ErrRegionUnavailable,
 		},
 	}
 
@@ -75,8 +123,8 @@ func TestGetAgentPartitionBucketRegion(t *testing.T) {
 				if region != "" && region != testcase.destination && err != nil {
 					t.Errorf("GetAgentBucketRegion returned unexpected region: %s, err: %v", region, err)
 				}
-				if testcase.err != nil && err == nil {
-					t.Error("GetAgentBucketRegion should return an error if the destination is not found")
+				if testcase.err != nil && !errors.Is(err, testcase.err) {
+					t.Errorf("GetAgentBucketRegion should return %v if the destination is not found, got: %v", testcase.err, err)
 				}
 			})
 	}
@@ -140,17 +188,25 @@ func TestAgentDockerLogDriverConfiguration(t *testing.T) {
 func TestAgentRemoteTarballKey(t *testing.T) {
 	testcases := []struct {
 		arch        string
+		version     string
 		shouldError bool
 		expected    string
 	}{
 		{
 			arch:     "amd64",
+			version:  DefaultAgentVersion,
 			expected: "ecs-agent-" + DefaultAgentVersion + ".tar",
 		},
 		{
 			arch:     "arm64",
+			version:  DefaultAgentVersion,
 			expected: "ecs-agent-arm64-" + DefaultAgentVersion + ".tar",
 		},
+		{
+			arch:     "amd64",
+			version:  "v1.76.0",
+			expected: "ecs-agent-v1.76.0.tar",
+		},
 		{
 			arch:        "unknown",
 			shouldError: true,
@@ -161,10 +217,10 @@ func TestAgentRemoteTarballKey(t *testing.T) {
 	defer func() { goarch = originalGoarch }()
 
 	for _, test := range testcases {
-		t.Run(test.arch, func(t *testing.T) {
+		t.Run(test.arch+"-"+test.version, func(t *testing.T) {
 			goarch = test.arch
 
-			actual, err := AgentRemoteTarballKey()
+			actual, err := AgentRemoteTarballKey(test.version)
 			if err == nil && test.shouldError {
 				t.Fatal("expected error when trying to get tarball key")
 			}
@@ -178,6 +234,29 @@ func TestAgentRemoteTarballKey(t *testing.T) {
 	}
 }
 
+func TestAgentVersion(t *testing.T) {
+	testcases := []struct {
+		version  string
+		expected string
+	}{
+		{"", DefaultAgentVersion},
+		{"1.76.0", "v1.76.0"},
+		{"v1.76.0", "v1.76.0"},
+		{" 1.76.0\n", "v1.76.0"},
+		{"4ee4b4b2", "4ee4b4b2"},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.version, func(t *testing.T) {
+			os.Setenv(AgentVersionEnvVar, test.version)
+			defer os.Unsetenv(AgentVersionEnvVar)
+			if actual := AgentVersion(); actual != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
 func TestAgentPrivileged(t *testing.T) {
 	os.Setenv("ECS_AGENT_RUN_PRIVILEGED", "true")
 	defer os.Unsetenv("ECS_AGENT_RUN_PRIVILEGED")
@@ -204,3 +283,1055 @@ func TestAgentPrivilegedNotConfigured(t *testing.T) {
 		}
 	}
 }
+
+func TestVerifyRegistrationTimeout(t *testing.T) {
+	defer os.Unsetenv(VerifyRegistrationEnvVar)
+	cases := []struct {
+		value    string
+		expected time.Duration
+		isErr    bool
+	}{
+		{"", 0, false},
+		{"5m", 5 * time.Minute, false},
+		{"90s", 90 * time.Second, false},
+		{"0s", 0, true},
+		{"five minutes", 0, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(VerifyRegistrationEnvVar, test.value)
+		timeout, err := VerifyRegistrationTimeout()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if timeout != test.expected {
+			t.Errorf("Expected timeout %s for %q, got %s", test.expected, test.value, timeout)
+		}
+	}
+}
+
+func TestBootstrapDeadline(t *testing.T) {
+	defer os.Unsetenv(BootstrapDeadlineEnvVar)
+	cases := []struct {
+		value    string
+		expected time.Duration
+		isErr    bool
+	}{
+		{"", 0, false},
+		{"15m", 15 * time.Minute, false},
+		{"-1m", 0, true},
+		{"soon", 0, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(BootstrapDeadlineEnvVar, test.value)
+		deadline, err := BootstrapDeadline()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if deadline != test.expected {
+			t.Errorf("Expected deadline %s for %q, got %s", test.expected, test.value, deadline)
+		}
+	}
+}
+
+func TestDockerReadyTimeout(t *testing.T) {
+	defer os.Unsetenv(DockerReadyTimeoutEnvVar)
+	cases := []struct {
+		value    string
+		expected time.Duration
+		isErr    bool
+	}{
+		{"", DefaultDockerReadyTimeout, false},
+		{"10m", 10 * time.Minute, false},
+		{"0", 0, true},
+		{"forever", 0, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(DockerReadyTimeoutEnvVar, test.value)
+		timeout, err := DockerReadyTimeout()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if timeout != test.expected {
+			t.Errorf("Expected timeout %s for %q, got %s", test.expected, test.value, timeout)
+		}
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	defer os.Unsetenv(HookTimeoutEnvVar)
+	cases := []struct {
+		value    string
+		expected time.Duration
+		isErr    bool
+	}{
+		{"", DefaultHookTimeout, false},
+		{"30s", 30 * time.Second, false},
+		{"-1s", DefaultHookTimeout, true},
+		{"never", DefaultHookTimeout, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(HookTimeoutEnvVar, test.value)
+		timeout, err := HookTimeout()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if timeout != test.expected {
+			t.Errorf("Expected timeout %s for %q, got %s", test.expected, test.value, timeout)
+		}
+	}
+}
+
+func TestDownloadJitter(t *testing.T) {
+	defer os.Unsetenv(DownloadJitterEnvVar)
+	cases := []struct {
+		value    string
+		expected time.Duration
+		isErr    bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"5m", 5 * time.Minute, false},
+		{"-1m", 0, true},
+		{"later", 0, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(DownloadJitterEnvVar, test.value)
+		jitter, err := DownloadJitter()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if jitter != test.expected {
+			t.Errorf("Expected jitter %s for %q, got %s", test.expected, test.value, jitter)
+		}
+	}
+}
+
+func TestInventoryInterval(t *testing.T) {
+	defer os.Unsetenv(InventoryIntervalEnvVar)
+	cases := []struct {
+		value    string
+		expected time.Duration
+		isErr    bool
+	}{
+		{"", 0, false},
+		{"1h", time.Hour, false},
+		{"1m", time.Minute, false},
+		{"30s", 0, true},
+		{"hourly", 0, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(InventoryIntervalEnvVar, test.value)
+		interval, err := InventoryInterval()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if interval != test.expected {
+			t.Errorf("Expected interval %s for %q, got %s", test.expected, test.value, interval)
+		}
+	}
+}
+
+func TestAutoUpdateInterval(t *testing.T) {
+	defer os.Unsetenv(AutoUpdateIntervalEnvVar)
+	cases := []struct {
+		value    string
+		expected time.Duration
+		isErr    bool
+	}{
+		{"", 0, false},
+		{"6h", 6 * time.Hour, false},
+		{"5m", 5 * time.Minute, false},
+		{"1m", 0, true},
+		{"daily", 0, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(AutoUpdateIntervalEnvVar, test.value)
+		interval, err := AutoUpdateInterval()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if interval != test.expected {
+			t.Errorf("Expected interval %s for %q, got %s", test.expected, test.value, interval)
+		}
+	}
+}
+
+func TestStartGateParameter(t *testing.T) {
+	defer os.Unsetenv(StartGateParameterEnvVar)
+	cases := []struct {
+		value         string
+		expectedName  string
+		expectedValue string
+		isErr         bool
+	}{
+		{"", "", "", false},
+		{"/provisioning/status=done", "/provisioning/status", "done", false},
+		{"/provisioning/status=", "/provisioning/status", "", false},
+		{"name=a=b", "name", "a=b", false},
+		{"/provisioning/status", "", "", true},
+		{"=done", "", "", true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(StartGateParameterEnvVar, test.value)
+		name, value, err := StartGateParameter()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if name != test.expectedName || value != test.expectedValue {
+			t.Errorf("Expected %q=%q for %q, got %q=%q", test.expectedName, test.expectedValue, test.value, name, value)
+		}
+	}
+}
+
+func TestCanaryAgent(t *testing.T) {
+	defer os.Unsetenv(CanaryAgentVersionEnvVar)
+	defer os.Unsetenv(CanaryRolloutParameterEnvVar)
+	cases := []struct {
+		version           string
+		parameter         string
+		expectedVersion   string
+		expectedParameter string
+		isErr             bool
+	}{
+		{"", "", "", "", false},
+		{"1.76.0", "/ecs/canary", "v1.76.0", "/ecs/canary", false},
+		{"v1.76.0", "/ecs/canary", "v1.76.0", "/ecs/canary", false},
+		{"1.76.0", "", "", "", true},
+		{"", "/ecs/canary", "", "", true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(CanaryAgentVersionEnvVar, test.version)
+		os.Setenv(CanaryRolloutParameterEnvVar, test.parameter)
+		version, parameter, err := CanaryAgent()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q, %q: %v", test.version, test.parameter, err)
+		}
+		if version != test.expectedVersion || parameter != test.expectedParameter {
+			t.Errorf("Expected %q, %q for %q, %q, got %q, %q", test.expectedVersion, test.expectedParameter,
+				test.version, test.parameter, version, parameter)
+		}
+	}
+}
+
+func TestHealthCheckInterval(t *testing.T) {
+	defer os.Unsetenv(HealthCheckIntervalEnvVar)
+	cases := []struct {
+		value    string
+		expected time.Duration
+		isErr    bool
+	}{
+		{"", 0, false},
+		{"30s", 30 * time.Second, false},
+		{"1s", 0, true},
+		{"often", 0, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(HealthCheckIntervalEnvVar, test.value)
+		interval, err := HealthCheckInterval()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if interval != test.expected {
+			t.Errorf("Expected interval %s for %q, got %s", test.expected, test.value, interval)
+		}
+	}
+}
+
+func TestMetricsAddress(t *testing.T) {
+	defer os.Unsetenv(MetricsAddressEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", "", false},
+		{"127.0.0.1:51681", "127.0.0.1:51681", false},
+		{"[::1]:51681", "[::1]:51681", false},
+		{"localhost:51681", "localhost:51681", false},
+		{"0.0.0.0:51681", "", true},
+		{"10.0.0.1:51681", "", true},
+		{"51681", "", true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(MetricsAddressEnvVar, test.value)
+		address, err := MetricsAddress()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if address != test.expected {
+			t.Errorf("Expected address %q for %q, got %q", test.expected, test.value, address)
+		}
+	}
+}
+
+func TestAgentMaxRestarts(t *testing.T) {
+	defer os.Unsetenv(AgentMaxRestartsEnvVar)
+	cases := []struct {
+		value    string
+		expected int
+		isErr    bool
+	}{
+		{"", 0, false},
+		{"10", 10, false},
+		{"0", 0, true},
+		{"ten", 0, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(AgentMaxRestartsEnvVar, test.value)
+		restarts, err := AgentMaxRestarts()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if restarts != test.expected {
+			t.Errorf("Expected %d restarts for %q, got %d", test.expected, test.value, restarts)
+		}
+	}
+}
+
+func TestRegistrationTagging(t *testing.T) {
+	defer os.Unsetenv(RegistrationTaggingEnvVar)
+	cases := []struct {
+		value             string
+		ec2Instance       bool
+		containerInstance bool
+		isErr             bool
+	}{
+		{"", false, false, false},
+		{"ec2-instance", true, false, false},
+		{"container-instance", false, true, false},
+		{"ec2-instance, container-instance", true, true, false},
+		{"ec2-instance,cluster", false, false, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(RegistrationTaggingEnvVar, test.value)
+		ec2Instance, containerInstance, err := RegistrationTagging()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if ec2Instance != test.ec2Instance || containerInstance != test.containerInstance {
+			t.Errorf("Expected %t, %t for %q, got %t, %t", test.ec2Instance, test.containerInstance, test.value,
+				ec2Instance, containerInstance)
+		}
+	}
+}
+
+func TestAgentVerification(t *testing.T) {
+	defer os.Unsetenv(AgentVerificationEnvVar)
+	cases := []struct {
+		value    string
+		expected []string
+		isErr    bool
+	}{
+		{"", []string{"md5"}, false},
+		{"size, MD5,sha256,signature,provenance", []string{"size", "md5", "sha256", "signature", "provenance"}, false},
+		{"sha256,scan", []string{"sha256", "scan"}, false},
+		{"sha256,,signature", nil, true},
+		{"sha256,sha256", nil, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(AgentVerificationEnvVar, test.value)
+		validators, err := AgentVerification()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if !reflect.DeepEqual(validators, test.expected) {
+			t.Errorf("Expected %v for %q, got %v", test.expected, test.value, validators)
+		}
+	}
+}
+
+func TestDockerdSupervision(t *testing.T) {
+	defer os.Unsetenv(DockerdSupervisionEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", "", false},
+		{"alert", DockerdSupervisionAlert, false},
+		{"restart", DockerdSupervisionRestart, false},
+		{"reboot", "", true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(DockerdSupervisionEnvVar, test.value)
+		mode, err := DockerdSupervision()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if mode != test.expected {
+			t.Errorf("Expected mode %q for %q, got %q", test.expected, test.value, mode)
+		}
+	}
+}
+
+func TestPreviousAgents(t *testing.T) {
+	defer os.Unsetenv(PreviousAgentsEnvVar)
+	cases := []struct {
+		value    string
+		expected int
+		isErr    bool
+	}{
+		{"", DefaultPreviousAgents, false},
+		{"0", 0, false},
+		{"5", 5, false},
+		{"-1", DefaultPreviousAgents, true},
+		{"all", DefaultPreviousAgents, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(PreviousAgentsEnvVar, test.value)
+		previous, err := PreviousAgents()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if previous != test.expected {
+			t.Errorf("Expected %d previous agents for %q, got %d", test.expected, test.value, previous)
+		}
+	}
+}
+
+func TestAgentImageRetention(t *testing.T) {
+	defer os.Unsetenv(AgentImageRetentionEnvVar)
+	cases := []struct {
+		value    string
+		expected int
+		isErr    bool
+	}{
+		{"", DefaultAgentImageRetention, false},
+		{"0", 0, false},
+		{"3", 3, false},
+		{"-1", DefaultAgentImageRetention, true},
+		{"some", DefaultAgentImageRetention, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(AgentImageRetentionEnvVar, test.value)
+		retention, err := AgentImageRetention()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if retention != test.expected {
+			t.Errorf("Expected a retention of %d images for %q, got %d", test.expected, test.value, retention)
+		}
+	}
+}
+
+func TestConfigWatch(t *testing.T) {
+	defer os.Unsetenv(ConfigWatchEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", ConfigWatchIgnore, false},
+		{"restart", ConfigWatchRestart, false},
+		{"drift", ConfigWatchDrift, false},
+		{"ignore", ConfigWatchIgnore, false},
+		{"reload", ConfigWatchIgnore, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(ConfigWatchEnvVar, test.value)
+		policy, err := ConfigWatch()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if policy != test.expected {
+			t.Errorf("Expected policy %q for %q, got %q", test.expected, test.value, policy)
+		}
+	}
+}
+
+func TestLogSupervision(t *testing.T) {
+	defer os.Unsetenv(LogSupervisionEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", "", false},
+		{"alert", LogSupervisionAlert, false},
+		{"trim", LogSupervisionTrim, false},
+		{"rotate", "", true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(LogSupervisionEnvVar, test.value)
+		policy, err := LogSupervision()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if policy != test.expected {
+			t.Errorf("Expected policy %q for %q, got %q", test.expected, test.value, policy)
+		}
+	}
+}
+
+func TestLogMaxSize(t *testing.T) {
+	defer os.Unsetenv(LogMaxSizeEnvVar)
+	cases := []struct {
+		value    string
+		expected int64
+		isErr    bool
+	}{
+		{"", 1024 * 1024 * 1024, false},
+		{"512", 512 * 1024 * 1024, false},
+		{"0", 1024 * 1024 * 1024, true},
+		{"1G", 1024 * 1024 * 1024, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(LogMaxSizeEnvVar, test.value)
+		size, err := LogMaxSize()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if size != test.expected {
+			t.Errorf("Expected size %d for %q, got %d", test.expected, test.value, size)
+		}
+	}
+}
+
+func TestLogVolumeThreshold(t *testing.T) {
+	defer os.Unsetenv(LogVolumeThresholdEnvVar)
+	cases := []struct {
+		value    string
+		expected float64
+		isErr    bool
+	}{
+		{"", 0.9, false},
+		{"75", 0.75, false},
+		{"100", 1, false},
+		{"0", 0.9, true},
+		{"101", 0.9, true},
+		{"75%", 0.9, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(LogVolumeThresholdEnvVar, test.value)
+		threshold, err := LogVolumeThreshold()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if threshold != test.expected {
+			t.Errorf("Expected threshold %v for %q, got %v", test.expected, test.value, threshold)
+		}
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	defer os.Unsetenv(LogLevelEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", DefaultLogLevel, false},
+		{"info", "info", false},
+		{"crit", "crit", false},
+		{"critical", DefaultLogLevel, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(LogLevelEnvVar, test.value)
+		level, err := LogLevel()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if level != test.expected {
+			t.Errorf("Expected level %q for %q, got %q", test.expected, test.value, level)
+		}
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	defer os.Unsetenv(LogFormatEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", LogFormatText, false},
+		{"json", LogFormatJSON, false},
+		{"logfmt", LogFormatText, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(LogFormatEnvVar, test.value)
+		format, err := LogFormat()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if format != test.expected {
+			t.Errorf("Expected format %q for %q, got %q", test.expected, test.value, format)
+		}
+	}
+}
+
+func TestLogOutput(t *testing.T) {
+	defer os.Unsetenv(LogOutputEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", LogOutputAll, false},
+		{"file", LogOutputFile, false},
+		{"console", LogOutputConsole, false},
+		{"journal", LogOutputJournal, false},
+		{"syslog", LogOutputAll, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(LogOutputEnvVar, test.value)
+		output, err := LogOutput()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if output != test.expected {
+			t.Errorf("Expected output %q for %q, got %q", test.expected, test.value, output)
+		}
+	}
+}
+
+func TestLogRollover(t *testing.T) {
+	defer os.Unsetenv(LogRolloverEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", LogRolloverHourly, false},
+		{"size", LogRolloverSize, false},
+		{"daily", LogRolloverHourly, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(LogRolloverEnvVar, test.value)
+		rollover, err := LogRollover()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if rollover != test.expected {
+			t.Errorf("Expected rollover %q for %q, got %q", test.expected, test.value, rollover)
+		}
+	}
+}
+
+func TestLogFileSize(t *testing.T) {
+	defer os.Unsetenv(LogFileSizeEnvVar)
+	cases := []struct {
+		value    string
+		expected int64
+		isErr    bool
+	}{
+		{"", 10 * 1024 * 1024, false},
+		{"64", 64 * 1024 * 1024, false},
+		{"-1", 10 * 1024 * 1024, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(LogFileSizeEnvVar, test.value)
+		size, err := LogFileSize()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if size != test.expected {
+			t.Errorf("Expected size %d for %q, got %d", test.expected, test.value, size)
+		}
+	}
+}
+
+func TestLogFileNum(t *testing.T) {
+	defer os.Unsetenv(LogFileNumEnvVar)
+	cases := []struct {
+		value    string
+		expected int
+		isErr    bool
+	}{
+		{"", DefaultLogFileNum, false},
+		{"24", 24, false},
+		{"0", DefaultLogFileNum, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(LogFileNumEnvVar, test.value)
+		num, err := LogFileNum()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if num != test.expected {
+			t.Errorf("Expected %d rotated files for %q, got %d", test.expected, test.value, num)
+		}
+	}
+}
+
+func TestLogMaxAge(t *testing.T) {
+	defer os.Unsetenv(LogMaxAgeEnvVar)
+	cases := []struct {
+		value    string
+		expected time.Duration
+		isErr    bool
+	}{
+		{"", 0, false},
+		{"168h", 168 * time.Hour, false},
+		{"0s", 0, true},
+		{"a week", 0, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(LogMaxAgeEnvVar, test.value)
+		age, err := LogMaxAge()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if age != test.expected {
+			t.Errorf("Expected a maximum age of %s for %q, got %s", test.expected, test.value, age)
+		}
+	}
+}
+
+func TestIMDSEndpoint(t *testing.T) {
+	os.Unsetenv(IMDSEndpointEnvVar)
+	if endpoint := IMDSEndpoint(); endpoint != InstanceMetadataEndpoint {
+		t.Errorf("Expected the default endpoint, got %q", endpoint)
+	}
+	os.Setenv(IMDSEndpointEnvVar, "http://127.0.0.1:8080")
+	defer os.Unsetenv(IMDSEndpointEnvVar)
+	if endpoint := IMDSEndpoint(); endpoint != "http://127.0.0.1:8080" {
+		t.Errorf("Expected the endpoint from the environment, got %q", endpoint)
+	}
+}
+
+func TestIMDSRetries(t *testing.T) {
+	defer os.Unsetenv(IMDSRetriesEnvVar)
+	cases := []struct {
+		value    string
+		expected int
+		isErr    bool
+	}{
+		{"", DefaultIMDSRetries, false},
+		{"0", 0, false},
+		{"5", 5, false},
+		{"-1", DefaultIMDSRetries, true},
+		{"many", DefaultIMDSRetries, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(IMDSRetriesEnvVar, test.value)
+		retries, err := IMDSRetries()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if retries != test.expected {
+			t.Errorf("Expected %d retries for %q, got %d", test.expected, test.value, retries)
+		}
+	}
+}
+
+func TestS3DownloadConcurrency(t *testing.T) {
+	defer os.Unsetenv(S3DownloadConcurrencyEnvVar)
+	cases := []struct {
+		value    string
+		expected int
+		isErr    bool
+	}{
+		{"", 1, false},
+		{"4", 4, false},
+		{"0", 1, true},
+		{"all", 1, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(S3DownloadConcurrencyEnvVar, test.value)
+		concurrency, err := S3DownloadConcurrency()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if concurrency != test.expected {
+			t.Errorf("Expected concurrency %d for %q, got %d", test.expected, test.value, concurrency)
+		}
+	}
+}
+
+func TestPipelinedHashing(t *testing.T) {
+	defer os.Unsetenv(PipelinedHashingEnvVar)
+	os.Unsetenv(PipelinedHashingEnvVar)
+	if !PipelinedHashing() {
+		t.Error("Expected downloads to be hashed on a worker by default")
+	}
+	os.Setenv(PipelinedHashingEnvVar, "false")
+	if PipelinedHashing() {
+		t.Error("Expected downloads to be hashed inline when disabled")
+	}
+}
+
+func TestSELinuxLabeling(t *testing.T) {
+	defer os.Unsetenv(SELinuxLabelingEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", SELinuxLabelingAuto, false},
+		{"relabel", SELinuxLabelingRelabel, false},
+		{"Disable", SELinuxLabelingDisable, false},
+		{"off", SELinuxLabelingOff, false},
+		{"z", SELinuxLabelingAuto, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(SELinuxLabelingEnvVar, test.value)
+		labeling, err := SELinuxLabeling()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if labeling != test.expected {
+			t.Errorf("Expected labeling %q for %q, got %q", test.expected, test.value, labeling)
+		}
+	}
+}
+
+func TestAgentNetwork(t *testing.T) {
+	defer os.Unsetenv(AgentNetworkEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", AgentNetworkHost, false},
+		{"host", AgentNetworkHost, false},
+		{"Bridge", AgentNetworkBridge, false},
+		{"awsvpc", AgentNetworkHost, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(AgentNetworkEnvVar, test.value)
+		network, err := AgentNetwork()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if network != test.expected {
+			t.Errorf("Expected network %q for %q, got %q", test.expected, test.value, network)
+		}
+	}
+}
+
+func TestAgentEgress(t *testing.T) {
+	defer os.Unsetenv(AgentEgressEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", AgentEgressOpen, false},
+		{"open", AgentEgressOpen, false},
+		{"Restricted", AgentEgressRestricted, false},
+		{"restrict", AgentEgressRestricted, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(AgentEgressEnvVar, test.value)
+		egress, err := AgentEgress()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if egress != test.expected {
+			t.Errorf("Expected egress %q for %q, got %q", test.expected, test.value, egress)
+		}
+	}
+}
+
+func TestAgentEgressAllow(t *testing.T) {
+	defer os.Unsetenv(AgentEgressAllowEnvVar)
+	os.Setenv(AgentEgressAllowEnvVar, " ssm.us-west-2.amazonaws.com, ,10.0.0.0/16")
+	allowed := AgentEgressAllow()
+	if len(allowed) != 2 || allowed[0] != "ssm.us-west-2.amazonaws.com" || allowed[1] != "10.0.0.0/16" {
+		t.Errorf("Unexpected allowed destinations %q", allowed)
+	}
+}
+
+func TestAppArmorProfile(t *testing.T) {
+	defer os.Unsetenv(AppArmorProfileEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+	}{
+		{"", DefaultAppArmorProfile},
+		{"unconfined", AppArmorProfileUnconfined},
+		{"docker-default", "docker-default"},
+	}
+
+	for _, test := range cases {
+		os.Setenv(AppArmorProfileEnvVar, test.value)
+		if profile := AppArmorProfile(); profile != test.expected {
+			t.Errorf("Expected profile %q for %q, got %q", test.expected, test.value, profile)
+		}
+	}
+}
+
+func TestDownloadRetryPolicy(t *testing.T) {
+	defer os.Unsetenv(DownloadMaxAttemptsEnvVar)
+	defer os.Unsetenv(DownloadRetryDelayEnvVar)
+	defer os.Unsetenv(DownloadRetryJitterEnvVar)
+	cases := []struct {
+		attempts    string
+		delay       string
+		jitter      string
+		maxAttempts int
+		baseDelay   time.Duration
+		maxDelay    time.Duration
+		jitterValue float64
+		isErr       bool
+	}{
+		{"", "", "", DefaultDownloadMaxAttempts, DefaultDownloadRetryDelay, downloadRetryMaxDelay, DefaultDownloadRetryJitter, false},
+		{"10", "5s", "0.5", 10, 5 * time.Second, downloadRetryMaxDelay, 0.5, false},
+		{"", "1m", "0", DefaultDownloadMaxAttempts, time.Minute, time.Minute, 0, false},
+		{"0", "", "", DefaultDownloadMaxAttempts, DefaultDownloadRetryDelay, downloadRetryMaxDelay, DefaultDownloadRetryJitter, true},
+		{"5", "soon", "2", 5, DefaultDownloadRetryDelay, downloadRetryMaxDelay, DefaultDownloadRetryJitter, true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(DownloadMaxAttemptsEnvVar, test.attempts)
+		os.Setenv(DownloadRetryDelayEnvVar, test.delay)
+		os.Setenv(DownloadRetryJitterEnvVar, test.jitter)
+		policy, err := DownloadRetryPolicy()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q, %q, %q: %v", test.attempts, test.delay, test.jitter, err)
+		}
+		if policy.MaxAttempts != test.maxAttempts || policy.BaseDelay != test.baseDelay ||
+			policy.MaxDelay != test.maxDelay || policy.Jitter != test.jitterValue {
+			t.Errorf("Unexpected policy for %q, %q, %q: %+v", test.attempts, test.delay, test.jitter, policy)
+		}
+	}
+}
+
+func TestAgentDownloadURL(t *testing.T) {
+	defer os.Unsetenv(AgentDownloadURLEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", "", false},
+		{"https://mirror.example.com/ecs-agent/", "https://mirror.example.com/ecs-agent/", false},
+		{"file:///opt/ecs-agent", "file:///opt/ecs-agent/", false},
+		{"s3://bucket", "s3://bucket/", false},
+		{"mirror.example.com/ecs-agent", "", true},
+		{"https://mirror.example.com/%zz", "", true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(AgentDownloadURLEnvVar, test.value)
+		downloadURL, err := AgentDownloadURL()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		actual := ""
+		if downloadURL != nil {
+			actual = downloadURL.String()
+		}
+		if actual != test.expected {
+			t.Errorf("Expected URL %q for %q, got %q", test.expected, test.value, actual)
+		}
+	}
+}
+
+func TestAgentRegistry(t *testing.T) {
+	defer os.Unsetenv(AgentSourceEnvVar)
+	defer os.Unsetenv(AgentRegistryEnvVar)
+	cases := []struct {
+		source   string
+		registry string
+		expected string
+		isErr    bool
+	}{
+		{"", "", "", false},
+		{"s3", "registry.example.com/ecs-agent", "", false},
+		{"registry", "", DefaultAgentRegistry, false},
+		{"registry", "registry.example.com/ecs-agent", "registry.example.com/ecs-agent", false},
+		{"ecr", "", "", true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(AgentSourceEnvVar, test.source)
+		os.Setenv(AgentRegistryEnvVar, test.registry)
+		registry, err := AgentRegistry()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.source, err)
+		}
+		if registry != test.expected {
+			t.Errorf("Expected registry %q for %q, got %q", test.expected, test.source, registry)
+		}
+	}
+}
+
+func TestContainerRuntime(t *testing.T) {
+	defer os.Unsetenv(ContainerRuntimeEnvVar)
+	cases := []struct {
+		value    string
+		expected string
+		isErr    bool
+	}{
+		{"", ContainerRuntimeDocker, false},
+		{"docker", ContainerRuntimeDocker, false},
+		{"containerd", ContainerRuntimeContainerd, false},
+		{"cri-o", "", true},
+	}
+
+	for _, test := range cases {
+		os.Setenv(ContainerRuntimeEnvVar, test.value)
+		runtime, err := ContainerRuntime()
+		if (err != nil) != test.isErr {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if runtime != test.expected {
+			t.Errorf("Expected runtime %q for %q, got %q", test.expected, test.value, runtime)
+		}
+	}
+}
+
+func TestContainerdAddress(t *testing.T) {
+	defer os.Unsetenv(ContainerdAddressEnvVar)
+	if address := ContainerdAddress(); address != DefaultContainerdAddress {
+		t.Errorf("Expected the default address, got %q", address)
+	}
+	os.Setenv(ContainerdAddressEnvVar, "/var/run/containerd.sock")
+	if address := ContainerdAddress(); address != "/var/run/containerd.sock" {
+		t.Errorf("Expected the configured address, got %q", address)
+	}
+}
+
+func TestAgentRegistryImage(t *testing.T) {
+	cases := []struct {
+		registry string
+		expected string
+	}{
+		{DefaultAgentRegistry, DefaultAgentRegistry + ":v1.36.0"},
+		{"localhost:5000/ecs-agent", "localhost:5000/ecs-agent:v1.36.0"},
+		{"localhost:5000/ecs-agent:stable", "localhost:5000/ecs-agent:stable"},
+		{"registry.example.com/ecs-agent@sha256:abc", "registry.example.com/ecs-agent@sha256:abc"},
+	}
+
+	for _, test := range cases {
+		image := AgentRegistryImage(test.registry, "v1.36.0")
+		if image != test.expected {
+			t.Errorf("Expected image %q for %q, got %q", test.expected, test.registry, image)
+		}
+	}
+}
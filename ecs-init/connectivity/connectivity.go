@@ -0,0 +1,124 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package connectivity probes the endpoints that ecs-init and the Agent
+// depend on, the way they reach them
+package connectivity
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// probeTimeout bounds a probe of an endpoint
+	probeTimeout = 5 * time.Second
+	// ntpPacketSize is the size of an SNTP request and response
+	ntpPacketSize = 48
+	// ntpClientRequest is the first byte of an SNTP request: no leap
+	// indicator, version 4 and the client mode
+	ntpClientRequest = 0x23
+	// ntpModeMask masks the mode in the first byte of an SNTP response
+	ntpModeMask   = 0x07
+	ntpModeServer = 4
+
+	// Direct is how endpoints reached without a proxy are reached
+	Direct = "direct"
+)
+
+// Prober probes endpoints
+type Prober struct {
+	httpClient *http.Client
+	// proxy selects the proxy of a request, as the HTTP clients of
+	// ecs-init do
+	proxy func(*http.Request) (*url.URL, error)
+}
+
+// NewProber creates a Prober that reaches endpoints through the proxy set in
+// the environment
+func NewProber() *Prober {
+	return newProber(http.ProxyFromEnvironment)
+}
+
+func newProber(proxy func(*http.Request) (*url.URL, error)) *Prober {
+	return &Prober{
+		httpClient: &http.Client{
+			Timeout: probeTimeout,
+			Transport: &http.Transport{
+				Proxy: proxy,
+			},
+			// the endpoint is reachable if it answers, even with a redirect
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		proxy: proxy,
+	}
+}
+
+// ProbeHTTP sends a HEAD request to endpoint and returns how it was reached,
+// Direct or through a proxy. Any response, whatever its status, shows the
+// endpoint is reachable.
+func (p *Prober) ProbeHTTP(endpoint string) (string, error) {
+	req, err := http.NewRequest(http.MethodHead, endpoint, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid endpoint %s", endpoint)
+	}
+	how := Direct
+	proxyURL, err := p.proxy(req)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid proxy")
+	}
+	if proxyURL != nil {
+		how = "proxy " + proxyURL.Host
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return how, err
+	}
+	resp.Body.Close()
+	return how, nil
+}
+
+// ProbeNTP sends an SNTP request to the NTP server at address and waits for
+// its response. NTP is never proxied.
+func (p *Prober) ProbeNTP(address string) error {
+	conn, err := net.DialTimeout("udp", address, probeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(probeTimeout))
+	if err != nil {
+		return err
+	}
+	request := make([]byte, ntpPacketSize)
+	request[0] = ntpClientRequest
+	_, err = conn.Write(request)
+	if err != nil {
+		return err
+	}
+	response := make([]byte, ntpPacketSize)
+	n, err := conn.Read(response)
+	if err != nil {
+		return err
+	}
+	if n < ntpPacketSize || response[0]&ntpModeMask != ntpModeServer {
+		return errors.New("invalid NTP response")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package connectivity
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noProxy(*http.Request) (*url.URL, error) {
+	return nil, nil
+}
+
+func TestProbeHTTPDirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	how, err := newProber(noProxy).ProbeHTTP(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, Direct, how)
+}
+
+func TestProbeHTTPProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	how, err := newProber(http.ProxyURL(proxyURL)).ProbeHTTP("http://ecs.us-west-2.amazonaws.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "proxy "+proxyURL.Host, how)
+	assert.Equal(t, "http://ecs.us-west-2.amazonaws.com/", proxied)
+}
+
+func TestProbeHTTPUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	how, err := newProber(noProxy).ProbeHTTP(server.URL)
+	assert.Error(t, err)
+	assert.Equal(t, Direct, how)
+}
+
+// serveNTP answers one SNTP request with response
+func serveNTP(t *testing.T, response []byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		defer conn.Close()
+		request := make([]byte, ntpPacketSize)
+		_, addr, err := conn.ReadFrom(request)
+		if err != nil {
+			return
+		}
+		conn.WriteTo(response, addr)
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestProbeNTP(t *testing.T) {
+	response := make([]byte, ntpPacketSize)
+	response[0] = 0x24
+	address := serveNTP(t, response)
+
+	assert.NoError(t, newProber(noProxy).ProbeNTP(address))
+}
+
+func TestProbeNTPInvalidResponse(t *testing.T) {
+	address := serveNTP(t, []byte{0x24})
+
+	assert.Error(t, newProber(noProxy).ProbeNTP(address))
+}
@@ -0,0 +1,293 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package containerd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+
+	log "github.com/cihub/seelog"
+	godocker "github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+)
+
+// networkModeHost is the network mode of the Agent container
+const networkModeHost = "host"
+
+var (
+	// stopTimeout is how long the Agent has to exit once asked to stop
+	stopTimeout = docker.AgentStopTimeout
+	// stopPollInterval is how often the Agent task is checked for once asked
+	// to stop
+	stopPollInterval = 500 * time.Millisecond
+)
+
+// agentConfig builds the agent config and the options of the Agent container
+type agentConfig interface {
+	LoadEnvVars() map[string]string
+	AgentContainerOptions() godocker.CreateContainerOptions
+}
+
+// AgentContainerOptions returns the options the Agent container is created
+// with, as the Docker client would create it
+func (c *Client) AgentContainerOptions() godocker.CreateContainerOptions {
+	return c.agent.AgentContainerOptions()
+}
+
+// RemoveExistingAgentContainer removes the Agent container and its task, if
+// they exist
+func (c *Client) RemoveExistingAgentContainer(ctx context.Context) error {
+	err := c.RemoveContainer(ctx, config.AgentContainerName)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// StartAgent creates the Agent container from the options the Docker client
+// would create it with, starts its task and returns the exit code of the
+// Agent
+func (c *Client) StartAgent(ctx context.Context) (int, error) {
+	args, err := createArgs(c.AgentContainerOptions())
+	if err != nil {
+		return 0, err
+	}
+	_, err = c.ctr(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+	type result struct {
+		exitCode int
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// ctr exits with the exit code of the task once it stops, and is
+		// killed once ctx is done, leaving the task to StopAgent
+		_, err := c.ctr(ctx, "tasks", "start", "--log-uri", "file://"+c.logFile, config.AgentContainerName)
+		exitErr, ok := errors.Cause(err).(interface{ ExitCode() int })
+		if ok && exitErr.ExitCode() > 0 {
+			done <- result{exitCode: exitErr.ExitCode()}
+			return
+		}
+		done <- result{err: err}
+	}()
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case r := <-done:
+		return r.exitCode, r.err
+	}
+}
+
+// createArgs returns the arguments of 'ctr containers create' creating a
+// container with the given options. Options containerd has no equivalent of,
+// such as the log driver, are ignored.
+func createArgs(opts godocker.CreateContainerOptions) ([]string, error) {
+	args := []string{"containers", "create"}
+	hostConfig := opts.HostConfig
+	if hostConfig == nil {
+		hostConfig = &godocker.HostConfig{}
+	}
+	if hostConfig.NetworkMode == networkModeHost {
+		args = append(args, "--net-host")
+	}
+	if hostConfig.Privileged {
+		args = append(args, "--privileged")
+	}
+	for _, capability := range hostConfig.CapAdd {
+		args = append(args, "--cap-add", "CAP_"+strings.TrimPrefix(capability, "CAP_"))
+	}
+	for _, device := range hostConfig.Devices {
+		args = append(args, "--device", device.PathOnHost)
+	}
+	if hostConfig.Memory > 0 {
+		args = append(args, "--memory-limit", strconv.FormatInt(hostConfig.Memory, 10))
+	}
+	if hostConfig.CPUQuota > 0 {
+		args = append(args, "--cpu-quota", strconv.FormatInt(hostConfig.CPUQuota, 10),
+			"--cpu-period", strconv.FormatInt(hostConfig.CPUPeriod, 10))
+	}
+	for _, bind := range hostConfig.Binds {
+		mount, err := bindMount(bind)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--mount", mount)
+	}
+	var env, labels []string
+	if opts.Config != nil {
+		env = append(env, opts.Config.Env...)
+		for key, val := range opts.Config.Labels {
+			labels = append(labels, key+"="+val)
+		}
+	}
+	sort.Strings(env)
+	sort.Strings(labels)
+	for _, val := range env {
+		args = append(args, "--env", val)
+	}
+	for _, val := range labels {
+		args = append(args, "--label", val)
+	}
+	return append(args, normalizeReference(config.AgentImageName), opts.Name), nil
+}
+
+// bindMount returns the mount of a Docker bind, in the format of the --mount
+// flag of ctr. The SELinux relabeling options are left to Docker.
+func bindMount(bind string) (string, error) {
+	parts := strings.Split(bind, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", errors.Errorf("invalid bind %q", bind)
+	}
+	options := []string{"rbind", "rw"}
+	if len(parts) == 3 {
+		for _, option := range strings.Split(parts[2], ",") {
+			switch option {
+			case "ro":
+				options[1] = "ro"
+			case "rshared", "rslave", "rprivate", "shared", "slave", "private":
+				options = append(options, option)
+			}
+		}
+	}
+	return "type=bind,src=" + parts[0] + ",dst=" + parts[1] + ",options=" + strings.Join(options, ":"), nil
+}
+
+// agentTaskStatus returns the status of the Agent task, or an empty string if
+// there is none
+func (c *Client) agentTaskStatus(ctx context.Context) (string, error) {
+	out, err := c.ctr(ctx, "tasks", "ls")
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == config.AgentContainerName {
+			return fields[2], nil
+		}
+	}
+	return "", nil
+}
+
+// StopAgent stops the Agent task if one is running, killing it when it does
+// not exit within the timeout Docker gives it
+func (c *Client) StopAgent(ctx context.Context) error {
+	running, err := c.IsAgentRunning(ctx)
+	if err != nil {
+		return err
+	}
+	if !running {
+		log.Info("No running Agent to stop")
+		return nil
+	}
+	_, err = c.ctr(ctx, "tasks", "kill", "--signal", "SIGTERM", config.AgentContainerName)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(stopTimeout)
+	for time.Now().Before(deadline) {
+		running, err = c.IsAgentRunning(ctx)
+		if err != nil || !running {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(stopPollInterval):
+		}
+	}
+	log.Warnf("Agent did not stop within %s, killing it", stopTimeout)
+	_, err = c.ctr(ctx, "tasks", "kill", "--signal", "SIGKILL", config.AgentContainerName)
+	return err
+}
+
+// IsAgentRunning returns true if the Agent task is running
+func (c *Client) IsAgentRunning(ctx context.Context) (bool, error) {
+	status, err := c.agentTaskStatus(ctx)
+	return status == taskRunning, err
+}
+
+// RunningAgentContainerID returns the ID of the Agent container, which
+// containerd identifies by its name, if its task is running
+func (c *Client) RunningAgentContainerID(ctx context.Context) (string, error) {
+	running, err := c.IsAgentRunning(ctx)
+	if err != nil || !running {
+		return "", err
+	}
+	return config.AgentContainerName, nil
+}
+
+// AgentHealth returns an empty health status if the Agent is running, as
+// containerd does not run health checks, and ErrAgentNotRunning otherwise
+func (c *Client) AgentHealth(ctx context.Context) (string, error) {
+	running, err := c.IsAgentRunning(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !running {
+		return "", docker.ErrAgentNotRunning
+	}
+	return "", nil
+}
+
+// AgentLogPath returns the file the output of the Agent task is written to
+func (c *Client) AgentLogPath(ctx context.Context) (string, error) {
+	return c.logFile, nil
+}
+
+// GetContainerLogTail returns the last logWindowSize lines of the output of
+// the Agent task
+func (c *Client) GetContainerLogTail(ctx context.Context, logWindowSize string) string {
+	lines, err := strconv.Atoi(logWindowSize)
+	if err != nil || lines < 1 {
+		return ""
+	}
+	file, err := os.Open(c.logFile)
+	if err != nil {
+		log.Info("No Agent output to take logs from.")
+		return ""
+	}
+	defer file.Close()
+	var tail []string
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			tail = append(tail, line)
+			if len(tail) > lines {
+				tail = tail[1:]
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Infof("Unable to tail the Agent output: %v", err)
+			break
+		}
+	}
+	return strings.Join(tail, "")
+}
@@ -0,0 +1,329 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package containerd runs the Agent with containerd, for hosts without the
+// Docker daemon. Images and containers are managed with the external 'ctr'
+// command, the client of the containerd API, in a namespace of their own.
+package containerd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	ctrExecutable = "ctr"
+	// Namespace is the containerd namespace of the Agent container and its
+	// images
+	Namespace = "ecs"
+	// taskRunning is the status of a running task in 'ctr tasks ls'
+	taskRunning = "RUNNING"
+	// notFound is in the output of ctr when an image, container or task
+	// does not exist
+	notFound = "not found"
+	// readyMinBackoff and readyMaxBackoff bound the delays between the
+	// attempts to reach containerd while waiting for it
+	readyMinBackoff = time.Second
+	readyMaxBackoff = 10 * time.Second
+)
+
+// Client implements the engine.dockerClient interface with containerd. The
+// agent config and the options of the Agent container are the ones the Docker
+// client builds, so that the Agent is configured alike by both runtimes.
+type Client struct {
+	cmdExec exec.Exec
+	address string
+	agent   agentConfig
+	logFile string
+}
+
+// NewClient creates a new Client, returning an error when 'ctr' is not
+// installed
+func NewClient(cmdExec exec.Exec) (*Client, error) {
+	_, err := cmdExec.LookPath(ctrExecutable)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not find '%s' executable", ctrExecutable)
+	}
+	return &Client{
+		cmdExec: cmdExec,
+		address: config.ContainerdAddress(),
+		agent:   docker.NewConfigClient(),
+		logFile: config.ContainerdAgentLogFile(),
+	}, nil
+}
+
+// ctr runs a ctr command in the namespace of the Agent and returns its
+// output. The command is killed once ctx is done.
+func (c *Client) ctr(ctx context.Context, args ...string) ([]byte, error) {
+	args = append([]string{"--address", c.address, "--namespace", Namespace}, args...)
+	out, err := c.cmdExec.CommandContext(ctx, ctrExecutable, args...).CombinedOutput()
+	if err != nil {
+		return out, errors.Wrapf(err, "ctr %s failed: %s", args[4], strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// isNotFound returns true when ctr failed as what it was run on does not
+// exist
+func isNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), notFound)
+}
+
+// Ping returns an error when containerd does not respond
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.ctr(ctx, "version")
+	return err
+}
+
+// WaitReady waits up to timeout for containerd to respond, as it may still be
+// starting on first boot. Waiting stops with the error of ctx once ctx is
+// done.
+func (c *Client) WaitReady(ctx context.Context, timeout time.Duration) error {
+	pingBackoff := backoff.UntilDeadline(backoff.NewBackoff(readyMinBackoff, readyMaxBackoff, 0.2, 2, 0),
+		time.Now().Add(timeout))
+	return backoff.RetryContext(ctx, pingBackoff, func(d time.Duration) { backoff.Sleep(ctx, d) },
+		func() error { return c.Ping(ctx) },
+		func(err error, d time.Duration) {
+			log.Infof("Error connecting to containerd, backing off for %s, error: %s", d, err)
+		})
+}
+
+// LoadEnvVars returns the agent config
+func (c *Client) LoadEnvVars() map[string]string {
+	return c.agent.LoadEnvVars()
+}
+
+// images returns the references of the images in the namespace of the Agent
+func (c *Client) images(ctx context.Context) (map[string]bool, error) {
+	out, err := c.ctr(ctx, "images", "ls", "--quiet")
+	if err != nil {
+		return nil, err
+	}
+	images := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if ref := strings.TrimSpace(scanner.Text()); ref != "" {
+			images[ref] = true
+		}
+	}
+	return images, nil
+}
+
+// IsAgentImageLoaded returns true if the Agent image is loaded in containerd
+func (c *Client) IsAgentImageLoaded(ctx context.Context) (bool, error) {
+	images, err := c.images(ctx)
+	if err != nil {
+		return false, err
+	}
+	return images[normalizeReference(config.AgentImageName)], nil
+}
+
+// LoadImage imports an image tarball into containerd. ctr imports files, so
+// the image is staged in the cache directory first.
+func (c *Client) LoadImage(ctx context.Context, image io.Reader) error {
+	temp, err := ioutil.TempFile(config.CacheDirectory(), "containerd-image")
+	if err != nil {
+		return errors.Wrap(err, "could not stage the image")
+	}
+	defer os.Remove(temp.Name())
+	_, err = io.Copy(temp, image)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not stage the image")
+	}
+	_, err = c.ctr(ctx, "images", "import", temp.Name())
+	return err
+}
+
+// tag points target at the image of source
+func (c *Client) tag(ctx context.Context, source string, target string) error {
+	_, err := c.ctr(ctx, "images", "tag", "--force", normalizeReference(source), normalizeReference(target))
+	return err
+}
+
+// PreloadImage imports the next Agent image and tags it as the standby
+// image, without replacing the Agent image used when the Agent is restarted
+// before the upgrade
+func (c *Client) PreloadImage(ctx context.Context, image io.Reader) error {
+	images, err := c.images(ctx)
+	if err != nil {
+		return err
+	}
+	standby := config.AgentImageRepository + ":" + config.AgentStandbyImageTag
+	current := images[normalizeReference(config.AgentImageName)]
+	previous := config.AgentImageRepository + ":preload-previous"
+	if current {
+		err = c.tag(ctx, config.AgentImageName, previous)
+		if err != nil {
+			return err
+		}
+		defer c.ctr(ctx, "images", "rm", normalizeReference(previous))
+	}
+	err = c.LoadImage(ctx, image)
+	if err != nil {
+		return err
+	}
+	err = c.tag(ctx, config.AgentImageName, standby)
+	if err != nil {
+		return err
+	}
+	if !current {
+		return nil
+	}
+	// importing the image moved the tag of the Agent image, move it back
+	return c.tag(ctx, previous, config.AgentImageName)
+}
+
+// PromoteStandbyImage tags the standby image preloaded by PreloadImage as the
+// Agent image
+func (c *Client) PromoteStandbyImage(ctx context.Context) error {
+	return c.tag(ctx, config.AgentImageRepository+":"+config.AgentStandbyImageTag, config.AgentImageName)
+}
+
+// PullImage pulls image from its registry unless it is already present
+func (c *Client) PullImage(ctx context.Context, image string) error {
+	images, err := c.images(ctx)
+	if err != nil {
+		return err
+	}
+	if images[normalizeReference(image)] {
+		return nil
+	}
+	_, err = c.ctr(ctx, "images", "pull", normalizeReference(image))
+	return err
+}
+
+// PullAgentImage pulls the Agent image from its registry, even if it is
+// present already so that a moved tag is followed, and tags it as the Agent
+// image in place of the image loaded from a tarball. Registries that need
+// credentials are refused, as ctr only takes them as arguments, which other
+// users of the host can read while the image is pulled.
+func (c *Client) PullAgentImage(ctx context.Context, image string, auth docker.RegistryAuth) error {
+	if auth.Username != "" {
+		return errors.Errorf("cannot pull %s with credentials from containerd, pull the Agent from a public registry instead", image)
+	}
+	_, err := c.ctr(ctx, "images", "pull", normalizeReference(image))
+	if err != nil {
+		return err
+	}
+	return c.tag(ctx, image, config.AgentImageName)
+}
+
+// RemoveImage removes the image with the given name from containerd
+func (c *Client) RemoveImage(ctx context.Context, name string) error {
+	_, err := c.ctr(ctx, "images", "rm", normalizeReference(name))
+	return err
+}
+
+// ExpectedPauseImage returns the default pause container image, as the
+// labels of images are not listed by ctr
+func (c *Client) ExpectedPauseImage(ctx context.Context) (string, error) {
+	return config.PauseImageRepository + ":" + config.DefaultPauseImageTag, nil
+}
+
+// LoadedPauseImages returns the pause container images loaded into
+// containerd, sorted
+func (c *Client) LoadedPauseImages(ctx context.Context) ([]string, error) {
+	images, err := c.images(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var loaded []string
+	for ref := range images {
+		if name := familiarName(ref); strings.HasPrefix(name, config.PauseImageRepository+":") {
+			loaded = append(loaded, name)
+		}
+	}
+	sort.Strings(loaded)
+	return loaded, nil
+}
+
+// AgentImages returns the images of the Agent loaded into containerd, sorted
+// by reference. ctr does not list when images were built, and images lose
+// their content once another image takes their reference, so only tagged
+// images of the Agent are returned.
+func (c *Client) AgentImages(ctx context.Context) ([]docker.AgentImage, error) {
+	images, err := c.images(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var agentImages []docker.AgentImage
+	for ref := range images {
+		if name := familiarName(ref); strings.HasPrefix(name, config.AgentImageRepository+":") {
+			agentImages = append(agentImages, docker.AgentImage{ID: ref, Tags: []string{name}})
+		}
+	}
+	sort.Slice(agentImages, func(i, j int) bool {
+		return agentImages[i].ID < agentImages[j].ID
+	})
+	return agentImages, nil
+}
+
+// ListTaskContainers returns no containers, as the Agent runs the containers
+// of tasks with Docker, never in the namespace of ecs-init
+func (c *Client) ListTaskContainers(ctx context.Context) ([]docker.TaskContainer, error) {
+	return nil, nil
+}
+
+// RemoveContainer removes the container with the given ID, and its task
+func (c *Client) RemoveContainer(ctx context.Context, id string) error {
+	_, err := c.ctr(ctx, "tasks", "delete", "--force", id)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	_, err = c.ctr(ctx, "containers", "delete", id)
+	return err
+}
+
+// normalizeReference returns the fully qualified reference containerd names
+// an image by, e.g. docker.io/amazon/amazon-ecs-agent:latest for
+// amazon/amazon-ecs-agent
+func normalizeReference(name string) string {
+	if !strings.ContainsAny(name[strings.LastIndex(name, "/")+1:], ":@") {
+		name += ":latest"
+	}
+	slash := strings.Index(name, "/")
+	if slash == -1 {
+		return "docker.io/library/" + name
+	}
+	if domain := name[:slash]; !strings.ContainsAny(domain, ".:") && domain != "localhost" {
+		return "docker.io/" + name
+	}
+	return name
+}
+
+// familiarName returns the name Docker shows a fully qualified reference as
+func familiarName(ref string) string {
+	name := strings.TrimPrefix(ref, "docker.io/")
+	if name == ref {
+		return ref
+	}
+	return strings.TrimPrefix(name, "library/")
+}
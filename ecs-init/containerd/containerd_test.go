@@ -0,0 +1,342 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package containerd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+
+	godocker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exitError is the error of a command exiting with a non-zero code
+type exitError int
+
+func (e exitError) Error() string { return "exit status" }
+func (e exitError) ExitCode() int { return int(e) }
+
+// fakeAgentConfig returns fixed options for the Agent container
+type fakeAgentConfig struct {
+	opts godocker.CreateContainerOptions
+}
+
+func (f fakeAgentConfig) LoadEnvVars() map[string]string { return nil }
+func (f fakeAgentConfig) AgentContainerOptions() godocker.CreateContainerOptions {
+	return f.opts
+}
+
+func newTestClient(mockExec *MockExec) *Client {
+	return &Client{
+		cmdExec: mockExec,
+		address: config.DefaultContainerdAddress,
+		agent:   fakeAgentConfig{},
+		logFile: "/var/log/ecs/ecs-agent-container.log",
+	}
+}
+
+// expectCtr expects ctr to be run with args and returns the mock command
+func expectCtr(ctrl *gomock.Controller, mockExec *MockExec, args ...string) *MockCmd {
+	mockCmd := NewMockCmd(ctrl)
+	expected := []interface{}{"--address", config.DefaultContainerdAddress, "--namespace", Namespace}
+	for _, arg := range args {
+		expected = append(expected, arg)
+	}
+	mockExec.EXPECT().CommandContext(gomock.Any(), ctrExecutable, expected...).Return(mockCmd)
+	return mockCmd
+}
+
+func TestNewClientWithoutCtr(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockExec.EXPECT().LookPath(ctrExecutable).Return("", errors.New("not found"))
+	_, err := NewClient(mockExec)
+	assert.Error(t, err)
+}
+
+func TestWaitReady(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	expectCtr(ctrl, mockExec, "version").EXPECT().CombinedOutput().Return([]byte("Version: 1.6.8"), nil)
+	assert.NoError(t, newTestClient(mockExec).WaitReady(context.Background(), time.Minute))
+}
+
+func TestWaitReadyTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	expectCtr(ctrl, mockExec, "version").EXPECT().CombinedOutput().
+		Return([]byte("connection refused"), errors.New("exit status 1"))
+	err := newTestClient(mockExec).WaitReady(context.Background(), 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+}
+
+func TestWaitReadyContextDone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := newTestClient(NewMockExec(ctrl)).WaitReady(ctx, time.Minute)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestNormalizeReference(t *testing.T) {
+	for name, ref := range map[string]string{
+		"amazon/amazon-ecs-agent:latest":        "docker.io/amazon/amazon-ecs-agent:latest",
+		"amazon/amazon-ecs-pause:0.1.0":         "docker.io/amazon/amazon-ecs-pause:0.1.0",
+		"busybox":                               "docker.io/library/busybox:latest",
+		"localhost:5000/agent":                  "localhost:5000/agent:latest",
+		"public.ecr.aws/ecs/amazon-ecs-agent:1": "public.ecr.aws/ecs/amazon-ecs-agent:1",
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, ref, normalizeReference(name))
+		})
+	}
+}
+
+func TestFamiliarName(t *testing.T) {
+	assert.Equal(t, "amazon/amazon-ecs-pause:0.1.0", familiarName("docker.io/amazon/amazon-ecs-pause:0.1.0"))
+	assert.Equal(t, "busybox:latest", familiarName("docker.io/library/busybox:latest"))
+	assert.Equal(t, "public.ecr.aws/ecs/agent:1", familiarName("public.ecr.aws/ecs/agent:1"))
+}
+
+func TestIsAgentImageLoaded(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	client := newTestClient(mockExec)
+	expectCtr(ctrl, mockExec, "images", "ls", "--quiet").EXPECT().CombinedOutput().Return(
+		[]byte("docker.io/library/busybox:latest\ndocker.io/amazon/amazon-ecs-agent:latest\n"), nil)
+
+	loaded, err := client.IsAgentImageLoaded(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, loaded)
+}
+
+func TestLoadedPauseImages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	client := newTestClient(mockExec)
+	expectCtr(ctrl, mockExec, "images", "ls", "--quiet").EXPECT().CombinedOutput().Return(
+		[]byte("docker.io/amazon/amazon-ecs-pause:0.1.0\ndocker.io/amazon/amazon-ecs-agent:latest\n"), nil)
+
+	images, err := client.LoadedPauseImages(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"amazon/amazon-ecs-pause:0.1.0"}, images)
+}
+
+func TestAgentImages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	client := newTestClient(mockExec)
+	expectCtr(ctrl, mockExec, "images", "ls", "--quiet").EXPECT().CombinedOutput().Return(
+		[]byte("docker.io/amazon/amazon-ecs-pause:0.1.0\ndocker.io/amazon/amazon-ecs-agent:latest\ndocker.io/amazon/amazon-ecs-agent:standby\n"), nil)
+
+	images, err := client.AgentImages(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []docker.AgentImage{
+		{ID: "docker.io/amazon/amazon-ecs-agent:latest", Tags: []string{"amazon/amazon-ecs-agent:latest"}},
+		{ID: "docker.io/amazon/amazon-ecs-agent:standby", Tags: []string{"amazon/amazon-ecs-agent:standby"}},
+	}, images)
+}
+
+func TestPullAgentImage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	client := newTestClient(mockExec)
+	image := "public.ecr.aws/ecs/amazon-ecs-agent:latest"
+	gomock.InOrder(
+		expectCtr(ctrl, mockExec, "images", "pull", image).EXPECT().CombinedOutput().Return(nil, nil),
+		expectCtr(ctrl, mockExec, "images", "tag", "--force", image, normalizeReference(config.AgentImageName)).
+			EXPECT().CombinedOutput().Return(nil, nil),
+	)
+
+	assert.NoError(t, client.PullAgentImage(context.TODO(), image, docker.RegistryAuth{}))
+}
+
+func TestPullAgentImageWithCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	client := newTestClient(mockExec)
+	image := "123456789012.dkr.ecr.us-west-2.amazonaws.com/ecs/amazon-ecs-agent:latest"
+
+	assert.Error(t, client.PullAgentImage(context.TODO(), image, docker.RegistryAuth{Username: "AWS", Password: "token"}))
+}
+
+func TestRemoveExistingAgentContainerNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	client := newTestClient(mockExec)
+	gomock.InOrder(
+		expectCtr(ctrl, mockExec, "tasks", "delete", "--force", config.AgentContainerName).
+			EXPECT().CombinedOutput().Return([]byte("ctr: task ecs-agent: not found"), errors.New("exit status 1")),
+		expectCtr(ctrl, mockExec, "containers", "delete", config.AgentContainerName).
+			EXPECT().CombinedOutput().Return([]byte("ctr: container \"ecs-agent\" in namespace \"ecs\": not found"), errors.New("exit status 1")),
+	)
+
+	assert.NoError(t, client.RemoveExistingAgentContainer(context.TODO()))
+}
+
+func TestCreateArgs(t *testing.T) {
+	args, err := createArgs(godocker.CreateContainerOptions{
+		Name: config.AgentContainerName,
+		Config: &godocker.Config{
+			Env:    []string{"ECS_DATADIR=/data", "ECS_CLUSTER=default"},
+			Labels: map[string]string{"team": "ecs"},
+		},
+		HostConfig: &godocker.HostConfig{
+			NetworkMode: "host",
+			CapAdd:      []string{"NET_ADMIN"},
+			Binds:       []string{"/var/lib/ecs/data:/data", "/etc/pki:/etc/pki:ro", "/mnt/ebs:/mnt/ebs:rshared"},
+			Devices:     []godocker.Device{{PathOnHost: "/dev/nvidia0"}},
+			Memory:      512 * 1024 * 1024,
+			CPUPeriod:   100000,
+			CPUQuota:    50000,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"containers", "create",
+		"--net-host",
+		"--cap-add", "CAP_NET_ADMIN",
+		"--device", "/dev/nvidia0",
+		"--memory-limit", "536870912",
+		"--cpu-quota", "50000", "--cpu-period", "100000",
+		"--mount", "type=bind,src=/var/lib/ecs/data,dst=/data,options=rbind:rw",
+		"--mount", "type=bind,src=/etc/pki,dst=/etc/pki,options=rbind:ro",
+		"--mount", "type=bind,src=/mnt/ebs,dst=/mnt/ebs,options=rbind:rw:rshared",
+		"--env", "ECS_CLUSTER=default",
+		"--env", "ECS_DATADIR=/data",
+		"--label", "team=ecs",
+		normalizeReference(config.AgentImageName), config.AgentContainerName,
+	}, args)
+}
+
+func TestCreateArgsInvalidBind(t *testing.T) {
+	_, err := createArgs(godocker.CreateContainerOptions{
+		HostConfig: &godocker.HostConfig{Binds: []string{"/data"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestStartAgentExitCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	client := newTestClient(mockExec)
+	client.agent = fakeAgentConfig{opts: godocker.CreateContainerOptions{Name: config.AgentContainerName}}
+	gomock.InOrder(
+		expectCtr(ctrl, mockExec, "containers", "create", normalizeReference(config.AgentImageName), config.AgentContainerName).
+			EXPECT().CombinedOutput().Return(nil, nil),
+		expectCtr(ctrl, mockExec, "tasks", "start", "--log-uri", "file://"+client.logFile, config.AgentContainerName).
+			EXPECT().CombinedOutput().Return(nil, exitError(5)),
+	)
+
+	exitCode, err := client.StartAgent(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, exitCode)
+}
+
+func TestIsAgentRunning(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	client := newTestClient(mockExec)
+	expectCtr(ctrl, mockExec, "tasks", "ls").EXPECT().CombinedOutput().Return(
+		[]byte("TASK         PID     STATUS\necs-agent    4242    RUNNING\n"), nil)
+
+	running, err := client.IsAgentRunning(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, running)
+}
+
+func TestAgentHealthNotRunning(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	client := newTestClient(mockExec)
+	expectCtr(ctrl, mockExec, "tasks", "ls").EXPECT().CombinedOutput().Return(
+		[]byte("TASK         PID     STATUS\necs-agent    4242    STOPPED\n"), nil)
+
+	_, err := client.AgentHealth(context.TODO())
+	assert.Equal(t, docker.ErrAgentNotRunning, err)
+}
+
+func TestStopAgentKillsAfterTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	defer func(timeout, interval time.Duration) {
+		stopTimeout = timeout
+		stopPollInterval = interval
+	}(stopTimeout, stopPollInterval)
+	stopTimeout = 10 * time.Millisecond
+	stopPollInterval = time.Millisecond
+
+	mockExec := NewMockExec(ctrl)
+	client := newTestClient(mockExec)
+	running := []byte("TASK         PID     STATUS\necs-agent    4242    RUNNING\n")
+	mockTasks := NewMockCmd(ctrl)
+	mockExec.EXPECT().CommandContext(gomock.Any(), ctrExecutable, "--address", config.DefaultContainerdAddress, "--namespace", Namespace,
+		"tasks", "ls").Return(mockTasks).MinTimes(2)
+	mockTasks.EXPECT().CombinedOutput().Return(running, nil).MinTimes(2)
+	gomock.InOrder(
+		expectCtr(ctrl, mockExec, "tasks", "kill", "--signal", "SIGTERM", config.AgentContainerName).
+			EXPECT().CombinedOutput().Return(nil, nil),
+		expectCtr(ctrl, mockExec, "tasks", "kill", "--signal", "SIGKILL", config.AgentContainerName).
+			EXPECT().CombinedOutput().Return(nil, nil),
+	)
+
+	assert.NoError(t, client.StopAgent(context.TODO()))
+}
+
+func TestGetContainerLogTail(t *testing.T) {
+	dir := t.TempDir()
+
+	client := newTestClient(nil)
+	client.logFile = filepath.Join(dir, "ecs-agent-container.log")
+	assert.Equal(t, "", client.GetContainerLogTail(context.TODO(), "2"))
+	require.NoError(t, ioutil.WriteFile(client.logFile, []byte(strings.Join([]string{"one", "two", "three"}, "\n")+"\n"), 0644))
+	assert.Equal(t, "two\nthree\n", client.GetContainerLogTail(context.TODO(), "2"))
+}
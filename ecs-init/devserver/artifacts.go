@@ -0,0 +1,91 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package devserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sha256Suffix is the suffix of the checksums published next to the Agent
+const sha256Suffix = ".sha256"
+
+// artifactHandler serves the files of dir, such as Agent tarballs built
+// locally. Ranges are served so that interrupted downloads are resumed, and
+// the checksum of a tarball is computed when it is not published next to it.
+type artifactHandler struct {
+	dir   string
+	files http.Handler
+}
+
+func newArtifactHandler(dir string) *artifactHandler {
+	return &artifactHandler{dir: dir, files: http.FileServer(http.Dir(dir))}
+}
+
+func (h *artifactHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "artifacts are read-only", http.StatusMethodNotAllowed)
+		return
+	}
+	name := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(name, "/") {
+		// directories are not listed, like in the Agent buckets
+		http.NotFound(w, r)
+		return
+	}
+	file := filepath.Join(h.dir, filepath.FromSlash(name))
+	if _, err := os.Stat(file); os.IsNotExist(err) && strings.HasSuffix(file, sha256Suffix) {
+		h.serveChecksum(w, r, strings.TrimSuffix(file, sha256Suffix))
+		return
+	}
+	h.files.ServeHTTP(w, r)
+}
+
+// serveChecksum serves the hex encoded SHA-256 checksum of file
+func (h *artifactHandler) serveChecksum(w http.ResponseWriter, r *http.Request, file string) {
+	sum, err := checksum(file)
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.WriteString(w, sum)
+}
+
+func checksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package devserver serves a fake EC2 Instance Metadata Service and a
+// directory of Agent artifacts on a local address, so that the pre-start and
+// start of the Agent can be run on a host that is not an EC2 instance. It is
+// meant for development only: nothing it serves is authenticated.
+package devserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// AgentPath is the path the Agent artifacts are served on
+	AgentPath = "/agent/"
+	// DefaultRegion is the region reported by the fake metadata service when
+	// none is configured
+	DefaultRegion = "us-west-2"
+	// shutdownTimeout bounds how long downloads in flight are waited for once
+	// the server is stopped
+	shutdownTimeout = 5 * time.Second
+)
+
+// Server serves the fake metadata service and the Agent artifacts over HTTP
+type Server struct {
+	addr     string
+	agentDir string
+	region   string
+	listener net.Listener
+	server   *http.Server
+	done     chan struct{}
+}
+
+// NewServer creates a Server listening on addr, serving the Agent artifacts
+// in agentDir and reporting region as the region of the instance
+func NewServer(addr, agentDir, region string) *Server {
+	if region == "" {
+		region = DefaultRegion
+	}
+	return &Server{addr: addr, agentDir: agentDir, region: region}
+}
+
+// Start listens on the address and serves requests until Stop is called
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return errors.Wrapf(err, "could not listen on %s", s.addr)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/latest/", newMetadataHandler(s.region))
+	mux.Handle(AgentPath, http.StripPrefix(AgentPath, newArtifactHandler(s.agentDir)))
+	s.listener = listener
+	s.server = &http.Server{Handler: logRequests(mux)}
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		err := s.server.Serve(listener)
+		if err != http.ErrServerClosed {
+			log.Errorf("Development server stopped serving: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on once started
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Stop stops serving
+func (s *Server) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	<-s.done
+	return err
+}
+
+// Serve serves requests until ctx is canceled
+func (s *Server) Serve(ctx context.Context) error {
+	err := s.Start()
+	if err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return s.Stop()
+}
+
+// Environment returns the environment variables pointing ecs-init at the
+// server, as NAME=VALUE pairs. Signatures cannot be made for local builds of
+// the Agent, so downloads are only verified against their checksum.
+func (s *Server) Environment() []string {
+	endpoint := "http://" + s.Addr()
+	return []string{
+		fmt.Sprintf("%s=%s", config.IMDSEndpointEnvVar, endpoint),
+		fmt.Sprintf("%s=%s%s", config.AgentDownloadURLEnvVar, endpoint, AgentPath),
+		fmt.Sprintf("%s=%s", config.AgentVerificationEnvVar, "sha256"),
+		fmt.Sprintf("%s=%s", config.RegionOverrideEnvVar, s.region),
+	}
+}
+
+// logRequests logs the requests served by handler, so that the requests of
+// ecs-init can be followed
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("Development server: %s %s", r.Method, r.URL.Path)
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package devserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/imds"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, agentDir string) *Server {
+	server := NewServer("127.0.0.1:0", agentDir, "eu-west-1")
+	require.NoError(t, server.Start())
+	return server
+}
+
+func get(t *testing.T, url string, header http.Header) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestMetadataWithIMDSClient(t *testing.T) {
+	dir := t.TempDir()
+	server := startServer(t, dir)
+	defer server.Stop()
+
+	os.Setenv(config.IMDSEndpointEnvVar, "http://"+server.Addr())
+	defer os.Unsetenv(config.IMDSEndpointEnvVar)
+	client := imds.New(true, 0)
+	document, err := client.GetInstanceIdentityDocument()
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", document.Region)
+	assert.Equal(t, "eu-west-1a", document.AvailabilityZone)
+	assert.Equal(t, instanceID, document.InstanceID)
+
+	body, err := client.Get("/latest/meta-data/placement/region")
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", string(body))
+}
+
+func TestMetadataRequiresToken(t *testing.T) {
+	dir := t.TempDir()
+	server := startServer(t, dir)
+	defer server.Stop()
+
+	resp, _ := get(t, "http://"+server.Addr()+identityDocumentPath, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, _ = get(t, "http://"+server.Addr()+identityDocumentPath, http.Header{tokenHeader: {"unknown"}})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPut, "http://"+server.Addr()+tokenPath, nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "a token is not granted without a TTL")
+}
+
+func TestArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	tarball := []byte("agent tarball")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ecs-agent-v1.0.0.tar"), tarball, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ecs-agent-v2.0.0.tar"), tarball, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ecs-agent-v2.0.0.tar.sha256"), []byte("published"), 0644))
+	server := startServer(t, dir)
+	defer server.Stop()
+	base := "http://" + server.Addr() + AgentPath
+
+	resp, body := get(t, base+"ecs-agent-v1.0.0.tar", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, string(tarball), body)
+
+	resp, body = get(t, base+"ecs-agent-v1.0.0.tar", http.Header{"Range": {"bytes=6-"}})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "tarball", body)
+
+	sum := sha256.Sum256(tarball)
+	resp, body = get(t, base+"ecs-agent-v1.0.0.tar.sha256", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, hex.EncodeToString(sum[:]), body, "the checksum is computed when it is not published")
+
+	_, body = get(t, base+"ecs-agent-v2.0.0.tar.sha256", nil)
+	assert.Equal(t, "published", body, "a published checksum is served as is")
+
+	for _, name := range []string{"ecs-agent-v3.0.0.tar", "ecs-agent-v3.0.0.tar.sha256", "", "../" + filepath.Base(dir)} {
+		resp, _ = get(t, base+name, nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, name)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	server := startServer(t, dir)
+	defer server.Stop()
+
+	env := strings.Join(server.Environment(), "\n")
+	assert.Contains(t, env, config.IMDSEndpointEnvVar+"=http://"+server.Addr()+"\n")
+	assert.Contains(t, env, config.AgentDownloadURLEnvVar+"=http://"+server.Addr()+AgentPath+"\n")
+	assert.Contains(t, env, config.AgentVerificationEnvVar+"=sha256\n")
+	assert.Contains(t, env, config.RegionOverrideEnvVar+"=eu-west-1")
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	assert.NoError(t, NewServer("127.0.0.1:0", "", "").Stop())
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package devserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+)
+
+const (
+	tokenPath            = "/latest/api/token"
+	identityDocumentPath = "/latest/dynamic/instance-identity/document"
+	metadataPath         = "/latest/meta-data/"
+	tokenHeader          = "X-aws-ec2-metadata-token"
+	tokenTTLHeader       = "X-aws-ec2-metadata-token-ttl-seconds"
+	// maxTokenTTL is the longest session token the metadata service grants
+	maxTokenTTL = 6 * time.Hour
+
+	instanceID   = "i-0123456789abcdef0"
+	instanceType = "m5.large"
+	imageID      = "ami-0123456789abcdef0"
+	accountID    = "123456789012"
+	privateIP    = "10.0.0.10"
+)
+
+// identityDocument is the instance identity document of the fake instance
+type identityDocument struct {
+	AccountID        string    `json:"accountId"`
+	Architecture     string    `json:"architecture"`
+	AvailabilityZone string    `json:"availabilityZone"`
+	ImageID          string    `json:"imageId"`
+	InstanceID       string    `json:"instanceId"`
+	InstanceType     string    `json:"instanceType"`
+	PendingTime      time.Time `json:"pendingTime"`
+	PrivateIP        string    `json:"privateIp"`
+	Region           string    `json:"region"`
+	Version          string    `json:"version"`
+}
+
+// metadataHandler serves the parts of IMDSv2 ecs-init reads for a fake
+// instance in region. Like on an instance requiring IMDSv2, the metadata is
+// only served with a session token.
+type metadataHandler struct {
+	region   string
+	started  time.Time
+	lock     sync.Mutex
+	tokens   map[string]time.Time
+	metadata map[string]string
+}
+
+func newMetadataHandler(region string) *metadataHandler {
+	availabilityZone := region + "a"
+	return &metadataHandler{
+		region:  region,
+		started: time.Now().UTC().Truncate(time.Second),
+		tokens:  make(map[string]time.Time),
+		metadata: map[string]string{
+			"ami-id":                      imageID,
+			"instance-id":                 instanceID,
+			"instance-type":               instanceType,
+			"local-ipv4":                  privateIP,
+			"placement/availability-zone": availabilityZone,
+			"placement/region":            region,
+		},
+	}
+}
+
+func (h *metadataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == tokenPath {
+		h.serveToken(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.validToken(r.Header.Get(tokenHeader)) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path == identityDocumentPath {
+		w.Header().Set("Content-Type", "text/plain")
+		json.NewEncoder(w).Encode(h.identityDocument())
+		return
+	}
+	if len(r.URL.Path) > len(metadataPath) && r.URL.Path[:len(metadataPath)] == metadataPath {
+		value, ok := h.metadata[r.URL.Path[len(metadataPath):]]
+		if ok {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(value))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// serveToken grants a session token for the TTL requested
+func (h *metadataHandler) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	seconds, err := strconv.Atoi(r.Header.Get(tokenTTLHeader))
+	ttl := time.Duration(seconds) * time.Second
+	if err != nil || ttl <= 0 || ttl > maxTokenTTL {
+		http.Error(w, "invalid token TTL", http.StatusBadRequest)
+		return
+	}
+	buf := make([]byte, 16)
+	_, err = rand.Read(buf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(buf)
+	h.lock.Lock()
+	h.tokens[token] = time.Now().Add(ttl)
+	h.lock.Unlock()
+	w.Header().Set(tokenTTLHeader, strconv.Itoa(seconds))
+	w.Write([]byte(token))
+}
+
+// validToken returns if token was granted and has not expired
+func (h *metadataHandler) validToken(token string) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	expiry, ok := h.tokens[token]
+	return ok && time.Now().Before(expiry)
+}
+
+func (h *metadataHandler) identityDocument() identityDocument {
+	return identityDocument{
+		AccountID:        accountID,
+		Architecture:     architecture(),
+		AvailabilityZone: h.metadata["placement/availability-zone"],
+		ImageID:          imageID,
+		InstanceID:       instanceID,
+		InstanceType:     instanceType,
+		PendingTime:      h.started,
+		PrivateIP:        privateIP,
+		Region:           h.region,
+		Version:          "2017-09-30",
+	}
+}
+
+// architecture returns the architecture of the instance as EC2 reports it,
+// which is the architecture of the Agent downloaded
+func architecture() string {
+	if config.AgentArch() == "amd64" {
+		return "x86_64"
+	}
+	return config.AgentArch()
+}
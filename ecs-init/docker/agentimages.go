@@ -0,0 +1,95 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	godocker "github.com/fsouza/go-dockerclient"
+)
+
+// untaggedReference is the tag Docker lists for images without tags
+const untaggedReference = "<none>:<none>"
+
+// AgentImage is an image of the Agent loaded into the container runtime
+type AgentImage struct {
+	// ID identifies the image
+	ID string
+	// Tags are the tags of the image in the repository of the Agent
+	Tags []string
+	// Created is when the image was built, zero when it is not known
+	Created time.Time
+}
+
+// Untagged returns if the image has no tag in the repository of the Agent
+func (i AgentImage) Untagged() bool {
+	return len(i.Tags) == 0
+}
+
+// AgentImages returns the images of the Agent loaded into Docker, newest
+// first. Images tagged or pulled from the repository of the Agent are images
+// of the Agent, as are the untagged images labeled like the Agent image, which
+// are left behind when a newer Agent image takes their tag.
+func (c *Client) AgentImages(ctx context.Context) ([]AgentImage, error) {
+	images, err := c.docker.ListImages(godocker.ListImagesOptions{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+	var agentImages []AgentImage
+	for _, image := range images {
+		if agentImage, ok := toAgentImage(image); ok {
+			agentImages = append(agentImages, agentImage)
+		}
+	}
+	sort.SliceStable(agentImages, func(i, j int) bool {
+		return agentImages[i].Created.After(agentImages[j].Created)
+	})
+	return agentImages, nil
+}
+
+// toAgentImage returns image as an image of the Agent, and false when it is
+// not one
+func toAgentImage(image godocker.APIImages) (AgentImage, bool) {
+	agentImage := AgentImage{ID: image.ID, Created: time.Unix(image.Created, 0)}
+	tagged := false
+	for _, repoTag := range image.RepoTags {
+		if repoTag == untaggedReference {
+			continue
+		}
+		tagged = true
+		if strings.HasPrefix(repoTag, config.AgentImageRepository+":") {
+			agentImage.Tags = append(agentImage.Tags, repoTag)
+		}
+	}
+	if len(agentImage.Tags) > 0 {
+		return agentImage, true
+	}
+	if tagged {
+		// images tagged only in other repositories are not the Agent's,
+		// whatever they were built from
+		return agentImage, false
+	}
+	for _, repoDigest := range image.RepoDigests {
+		if strings.HasPrefix(repoDigest, config.AgentImageRepository+"@") {
+			return agentImage, true
+		}
+	}
+	_, labeled := image.Labels[config.PauseImageLabel]
+	return agentImage, labeled
+}
@@ -0,0 +1,54 @@
+// Copyright 2015-2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	godocker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentImages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().ListImages(godocker.ListImagesOptions{Context: context.Background()}).Return([]godocker.APIImages{
+		{ID: "latest", Created: 300, RepoTags: []string{"amazon/amazon-ecs-agent:latest"}},
+		{ID: "dangling", Created: 100, RepoTags: []string{untaggedReference},
+			Labels: map[string]string{config.PauseImageLabel: "amazon/amazon-ecs-pause:0.1.0"}},
+		{ID: "pulled", Created: 200, RepoDigests: []string{"amazon/amazon-ecs-agent@sha256:0123"}},
+		{ID: "retagged", Created: 400, RepoTags: []string{"amazon/amazon-ecs-agent:v1", "example/agent:v1"}},
+		{ID: "other", Created: 500, RepoTags: []string{"example/app:latest"},
+			Labels: map[string]string{config.PauseImageLabel: "amazon/amazon-ecs-pause:0.1.0"}},
+		{ID: "unlabeled", Created: 600, RepoTags: []string{untaggedReference}},
+	}, nil)
+
+	client := &Client{docker: mockDocker}
+	images, err := client.AgentImages(context.Background())
+	require.NoError(t, err)
+	var ids []string
+	for _, image := range images {
+		ids = append(ids, image.ID)
+	}
+	assert.Equal(t, []string{"retagged", "latest", "pulled", "dangling"}, ids)
+	assert.Equal(t, []string{"amazon/amazon-ecs-agent:v1"}, images[0].Tags, "tags of other repositories are not the Agent's")
+	assert.True(t, images[3].Untagged())
+}
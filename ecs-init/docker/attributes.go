@@ -0,0 +1,122 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	instanceAttributesEnvVar = "ECS_INSTANCE_ATTRIBUTES"
+	// maxInstanceAttributes is the number of custom attributes ECS allows
+	// on a container instance
+	maxInstanceAttributes   = 10
+	maxAttributeNameLength  = 128
+	maxAttributeValueLength = 128
+)
+
+var (
+	attributeNamePattern  = regexp.MustCompile(`^[a-zA-Z0-9_.\-/\\]+$`)
+	attributeValuePattern = regexp.MustCompile(`^[a-zA-Z0-9_.\-@/\\: ]+$`)
+)
+
+var matchAttributeFragments = filepath.Glob
+
+// mergeInstanceAttributes merges the attributes of the JSON fragments in the
+// instance attributes directory into ECS_INSTANCE_ATTRIBUTES, so that several
+// provisioning tools can each contribute attributes. Attributes set in the
+// config files take precedence over the fragments, and fragments are applied
+// in lexical order.
+func (c *Client) mergeInstanceAttributes(envVariables map[string]string) {
+	fragments, err := matchAttributeFragments(filepath.Join(config.InstanceAttributesDirectory(), "*.json"))
+	if err != nil || len(fragments) == 0 {
+		return
+	}
+	attributes := make(map[string]string)
+	sources := make(map[string]string)
+	for _, fragment := range fragments {
+		fromFragment, err := c.readAttributeFragment(fragment)
+		if err != nil {
+			log.Errorf("Ignoring instance attributes in %s: %v", fragment, err)
+			continue
+		}
+		for name, value := range fromFragment {
+			if source, ok := sources[name]; ok && attributes[name] != value {
+				log.Warnf("Instance attribute %s from %s overrides the value from %s", name, fragment, source)
+			}
+			attributes[name] = value
+			sources[name] = fragment
+		}
+	}
+	if configured := envVariables[instanceAttributesEnvVar]; configured != "" {
+		fromConfig := make(map[string]string)
+		err := json.Unmarshal([]byte(configured), &fromConfig)
+		if err != nil {
+			log.Errorf("Ignoring %s: could not decode %s: %v", config.InstanceAttributesDirectory(), instanceAttributesEnvVar, err)
+			return
+		}
+		for name, value := range fromConfig {
+			attributes[name] = value
+		}
+	}
+	if len(attributes) > maxInstanceAttributes {
+		log.Errorf("Ignoring %s: %d instance attributes exceed the limit of %d",
+			config.InstanceAttributesDirectory(), len(attributes), maxInstanceAttributes)
+		return
+	}
+	merged, err := json.Marshal(attributes)
+	if err != nil {
+		log.Errorf("Ignoring %s: could not encode instance attributes: %v", config.InstanceAttributesDirectory(), err)
+		return
+	}
+	envVariables[instanceAttributesEnvVar] = string(merged)
+}
+
+func (c *Client) readAttributeFragment(fragment string) (map[string]string, error) {
+	data, err := c.fs.ReadFile(fragment)
+	if err != nil {
+		return nil, err
+	}
+	attributes := make(map[string]string)
+	err = json.Unmarshal(data, &attributes)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range attributes {
+		err = validateAttribute(name, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return attributes, nil
+}
+
+func validateAttribute(name string, value string) error {
+	if len(name) > maxAttributeNameLength || !attributeNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid attribute name %q", name)
+	}
+	if len(value) > maxAttributeValueLength || !attributeValuePattern.MatchString(value) ||
+		strings.TrimSpace(value) != value {
+		return fmt.Errorf("invalid value %q of attribute %s", value, name)
+	}
+	return nil
+}
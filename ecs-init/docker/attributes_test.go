@@ -0,0 +1,145 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withAttributeFragments(t *testing.T, fragments ...string) {
+	matchAttributeFragments = func(pattern string) ([]string, error) {
+		var matches []string
+		for _, fragment := range fragments {
+			matches = append(matches, filepath.Join(config.InstanceAttributesDirectory(), fragment))
+		}
+		return matches, nil
+	}
+	t.Cleanup(func() { matchAttributeFragments = filepath.Glob })
+}
+
+func expectFragment(mockFS *MockfileSystem, fragment string, content string) {
+	mockFS.EXPECT().ReadFile(filepath.Join(config.InstanceAttributesDirectory(), fragment)).Return([]byte(content), nil)
+}
+
+func decodeAttributes(t *testing.T, envVariables map[string]string) map[string]string {
+	attributes := make(map[string]string)
+	require.NoError(t, json.Unmarshal([]byte(envVariables[instanceAttributesEnvVar]), &attributes))
+	return attributes
+}
+
+func TestMergeInstanceAttributes(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	withAttributeFragments(t, "10-network.json", "20-team.json")
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	expectFragment(mockFS, "10-network.json", `{"subnet-tier": "private", "team": "infra"}`)
+	expectFragment(mockFS, "20-team.json", `{"team": "payments"}`)
+
+	client := &Client{fs: mockFS}
+	envVariables := map[string]string{
+		instanceAttributesEnvVar: `{"stack": "prod"}`,
+	}
+	client.mergeInstanceAttributes(envVariables)
+	assert.Equal(t, map[string]string{
+		"subnet-tier": "private",
+		"team":        "payments",
+		"stack":       "prod",
+	}, decodeAttributes(t, envVariables))
+}
+
+func TestMergeInstanceAttributesConfigTakesPrecedence(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	withAttributeFragments(t, "team.json")
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	expectFragment(mockFS, "team.json", `{"team": "payments"}`)
+
+	client := &Client{fs: mockFS}
+	envVariables := map[string]string{
+		instanceAttributesEnvVar: `{"team": "infra"}`,
+	}
+	client.mergeInstanceAttributes(envVariables)
+	assert.Equal(t, map[string]string{"team": "infra"}, decodeAttributes(t, envVariables))
+}
+
+func TestMergeInstanceAttributesSkipsInvalidFragments(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	withAttributeFragments(t, "bad-json.json", "bad-name.json", "bad-value.json", "missing.json", "good.json")
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	expectFragment(mockFS, "bad-json.json", `{"team": `)
+	expectFragment(mockFS, "bad-name.json", `{"team!": "infra"}`)
+	expectFragment(mockFS, "bad-value.json", `{"team": " infra"}`)
+	mockFS.EXPECT().ReadFile(filepath.Join(config.InstanceAttributesDirectory(), "missing.json")).
+		Return(nil, errors.New("permission denied"))
+	expectFragment(mockFS, "good.json", `{"stack": "prod"}`)
+
+	client := &Client{fs: mockFS}
+	envVariables := map[string]string{}
+	client.mergeInstanceAttributes(envVariables)
+	assert.Equal(t, map[string]string{"stack": "prod"}, decodeAttributes(t, envVariables))
+}
+
+func TestMergeInstanceAttributesTooMany(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	withAttributeFragments(t, "many.json")
+
+	var attributes []string
+	for i := 0; i <= maxInstanceAttributes; i++ {
+		attributes = append(attributes, fmt.Sprintf(`"attribute-%d": "value"`, i))
+	}
+	mockFS := NewMockfileSystem(mockCtrl)
+	expectFragment(mockFS, "many.json", "{"+strings.Join(attributes, ",")+"}")
+
+	client := &Client{fs: mockFS}
+	envVariables := map[string]string{
+		instanceAttributesEnvVar: `{"stack": "prod"}`,
+	}
+	client.mergeInstanceAttributes(envVariables)
+	assert.Equal(t, `{"stack": "prod"}`, envVariables[instanceAttributesEnvVar])
+}
+
+func TestMergeInstanceAttributesNoFragments(t *testing.T) {
+	withAttributeFragments(t)
+
+	client := &Client{}
+	envVariables := map[string]string{}
+	client.mergeInstanceAttributes(envVariables)
+	_, ok := envVariables[instanceAttributesEnvVar]
+	assert.False(t, ok)
+}
+
+func TestValidateAttribute(t *testing.T) {
+	assert.NoError(t, validateAttribute("ecs.os-family/custom", "Amazon Linux 2"))
+	assert.NoError(t, validateAttribute("owner", "team@example.com"))
+	assert.Error(t, validateAttribute(strings.Repeat("a", maxAttributeNameLength+1), "value"))
+	assert.Error(t, validateAttribute("name", strings.Repeat("a", maxAttributeValueLength+1)))
+	assert.Error(t, validateAttribute("name", "value "))
+	assert.Error(t, validateAttribute("name", ""))
+}
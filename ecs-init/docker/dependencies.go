@@ -16,38 +16,81 @@ package docker
 //go:generate mockgen.sh $GOPACKAGE $GOFILE
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
-	"time"
+	"path/filepath"
+	"strings"
 
-	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
+	"github.com/aws/amazon-ecs-init/ecs-init/cgroup"
 	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/faults"
 
 	log "github.com/cihub/seelog"
 	godocker "github.com/fsouza/go-dockerclient"
 )
 
+// ErrDockerUnavailable is wrapped by errors returned when the Docker daemon
+// cannot be reached
+var ErrDockerUnavailable = errors.New("docker daemon unavailable")
+
+// unavailableError is the error of connecting to the Docker daemon, with an
+// optional diagnosis of the endpoint. It is ErrDockerUnavailable to
+// errors.Is and unwraps to the error of the connection.
+type unavailableError struct {
+	diagnosis string
+	err       error
+}
+
+func (e *unavailableError) Error() string {
+	if e.diagnosis != "" {
+		return fmt.Sprintf("%s: %s: %s", ErrDockerUnavailable, e.diagnosis, e.err)
+	}
+	return fmt.Sprintf("%s: %s", ErrDockerUnavailable, e.err)
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.err
+}
+
+func (e *unavailableError) Is(target error) bool {
+	return target == ErrDockerUnavailable
+}
+
+// dockerclient is the part of the Docker client used by ecs-init
 type dockerclient interface {
 	ListImages(opts godocker.ListImagesOptions) ([]godocker.APIImages, error)
 	LoadImage(opts godocker.LoadImageOptions) error
+	InspectImage(name string) (*godocker.Image, error)
+	TagImage(name string, opts godocker.TagImageOptions) error
+	RemoveImageExtended(name string, opts godocker.RemoveImageOptions) error
+	PullImage(opts godocker.PullImageOptions, auth godocker.AuthConfiguration) error
 	Logs(opts godocker.LogsOptions) error
 	ListContainers(opts godocker.ListContainersOptions) ([]godocker.APIContainers, error)
 	RemoveContainer(opts godocker.RemoveContainerOptions) error
 	CreateContainer(opts godocker.CreateContainerOptions) (*godocker.Container, error)
-	StartContainer(id string, hostConfig *godocker.HostConfig) error
-	WaitContainer(id string) (int, error)
-	StopContainer(id string, timeout uint) error
-	Ping() error
+	StartContainerWithContext(id string, hostConfig *godocker.HostConfig, ctx context.Context) error
+	WaitContainerWithContext(id string, ctx context.Context) (int, error)
+	StopContainerWithContext(id string, timeout uint, ctx context.Context) error
+	InspectContainerWithContext(id string, ctx context.Context) (*godocker.Container, error)
+	PingWithContext(ctx context.Context) error
+	NetworkInfo(id string) (*godocker.Network, error)
+	CreateNetwork(opts godocker.CreateNetworkOptions) (*godocker.Network, error)
 }
 
+// _dockerclient calls the Docker daemon, failing the calls the faults package
+// injects failures into
 type _dockerclient struct {
 	docker dockerclient
 }
 
 type dockerClientFactory interface {
 	NewVersionedClient(endpoint string, apiVersionString string) (dockerclient, error)
+	NewVersionedTLSClient(endpoint string, cert, key, ca, apiVersionString string) (dockerclient, error)
 }
 
 type godockerClientFactory struct{}
@@ -56,72 +99,193 @@ func (client godockerClientFactory) NewVersionedClient(endpoint string, apiVersi
 	return godocker.NewVersionedClient(endpoint, apiVersionString)
 }
 
-func newDockerClient(dockerClientFactory dockerClientFactory, pingBackoff backoff.Backoff) (dockerclient, error) {
-	dockerUnixSocketSourcePath, fromEnv := config.DockerUnixSocket()
-	if !fromEnv {
-		dockerUnixSocketSourcePath = "/var/run/docker.sock"
-	}
-	client, err := dockerClientFactory.NewVersionedClient(
-		config.UnixSocketPrefix+dockerUnixSocketSourcePath, dockerClientAPIVersion)
+func (client godockerClientFactory) NewVersionedTLSClient(endpoint string, cert, key, ca, apiVersionString string) (dockerclient, error) {
+	return godocker.NewVersionedTLSClient(endpoint, cert, key, ca, apiVersionString)
+}
+
+// cgroupnsClientAPIVersion is the Docker API version that sets the cgroup
+// namespace of containers. Every Docker release running on the unified cgroup
+// hierarchy supports it.
+const cgroupnsClientAPIVersion = "1.41"
+
+// newDockerClient creates the client of the Docker daemon at the configured
+// endpoint, and returns it along with the endpoint. The daemon is not
+// contacted, see Client.WaitReady.
+func newDockerClient(dockerClientFactory dockerClientFactory) (dockerclient, string, error) {
+	endpoint, err := config.DockerEndpoint()
 	if err != nil {
-		return nil, err
+		return nil, "", &unavailableError{err: err}
 	}
-	for {
-		err = client.Ping()
-		if err == nil {
-			break
+	apiVersion := dockerClientAPIVersion
+	if cgroupHierarchy() == cgroup.Unified {
+		apiVersion = cgroupnsClientAPIVersion
+	}
+	var client dockerclient
+	if certPath := config.DockerTLSCertPath(); certPath != "" && strings.HasPrefix(endpoint, config.TCPSocketPrefix) {
+		client, err = dockerClientFactory.NewVersionedTLSClient(endpoint, filepath.Join(certPath, tlsCertFile),
+			filepath.Join(certPath, tlsKeyFile), filepath.Join(certPath, tlsCAFile), apiVersion)
+		if err != nil {
+			return nil, "", &unavailableError{
+				diagnosis: fmt.Sprintf("could not load the TLS certificates in %s", certPath),
+				err:       err,
+			}
 		}
-		shouldRetry := (isNetworkError(err) || isRetryablePingError(err)) && pingBackoff.ShouldRetry()
-		if !shouldRetry {
-			break
+	} else {
+		client, err = dockerClientFactory.NewVersionedClient(endpoint, apiVersion)
+		if err != nil {
+			return nil, "", err
 		}
-		backoffDuration := pingBackoff.Duration()
-		log.Infof("Error connecting to docker, backing off for %s, error: %s", backoffDuration, err)
-		time.Sleep(backoffDuration)
 	}
 	return &_dockerclient{
 		docker: client,
-	}, err
+	}, endpoint, nil
+}
+
+// unavailable returns err, the error of contacting the Docker daemon at
+// endpoint, as an error classed as ErrDockerUnavailable along with the
+// diagnosis of the endpoint
+func unavailable(endpoint string, err error) error {
+	diagnosis := diagnoseEndpoint(endpoint, err)
+	if diagnosis != "" {
+		log.Errorf("Could not connect to the Docker daemon at %s: %s", endpoint, diagnosis)
+	}
+	return &unavailableError{diagnosis: diagnosis, err: err}
 }
 
 func (d *_dockerclient) ListImages(opts godocker.ListImagesOptions) ([]godocker.APIImages, error) {
+	err := faults.Docker("ListImages")
+	if err != nil {
+		return nil, err
+	}
 	return d.docker.ListImages(opts)
 }
 
 func (d *_dockerclient) LoadImage(opts godocker.LoadImageOptions) error {
+	err := faults.Docker("LoadImage")
+	if err != nil {
+		return err
+	}
 	return d.docker.LoadImage(opts)
 }
 
+func (d *_dockerclient) InspectImage(name string) (*godocker.Image, error) {
+	err := faults.Docker("InspectImage")
+	if err != nil {
+		return nil, err
+	}
+	return d.docker.InspectImage(name)
+}
+
+func (d *_dockerclient) TagImage(name string, opts godocker.TagImageOptions) error {
+	err := faults.Docker("TagImage")
+	if err != nil {
+		return err
+	}
+	return d.docker.TagImage(name, opts)
+}
+
+func (d *_dockerclient) RemoveImageExtended(name string, opts godocker.RemoveImageOptions) error {
+	err := faults.Docker("RemoveImage")
+	if err != nil {
+		return err
+	}
+	return d.docker.RemoveImageExtended(name, opts)
+}
+
+func (d *_dockerclient) PullImage(opts godocker.PullImageOptions, auth godocker.AuthConfiguration) error {
+	err := faults.Docker("PullImage")
+	if err != nil {
+		return err
+	}
+	return d.docker.PullImage(opts, auth)
+}
+
 func (d *_dockerclient) Logs(opts godocker.LogsOptions) error {
+	err := faults.Docker("Logs")
+	if err != nil {
+		return err
+	}
 	return d.docker.Logs(opts)
 }
 
 func (d *_dockerclient) ListContainers(opts godocker.ListContainersOptions) ([]godocker.APIContainers, error) {
+	err := faults.Docker("ListContainers")
+	if err != nil {
+		return nil, err
+	}
 	return d.docker.ListContainers(opts)
 }
 
 func (d *_dockerclient) RemoveContainer(opts godocker.RemoveContainerOptions) error {
+	err := faults.Docker("RemoveContainer")
+	if err != nil {
+		return err
+	}
 	return d.docker.RemoveContainer(opts)
 }
 
 func (d *_dockerclient) CreateContainer(opts godocker.CreateContainerOptions) (*godocker.Container, error) {
+	err := faults.Docker("CreateContainer")
+	if err != nil {
+		return nil, err
+	}
 	return d.docker.CreateContainer(opts)
 }
 
-func (d *_dockerclient) StartContainer(id string, hostConfig *godocker.HostConfig) error {
-	return d.docker.StartContainer(id, hostConfig)
+func (d *_dockerclient) StartContainerWithContext(id string, hostConfig *godocker.HostConfig, ctx context.Context) error {
+	err := faults.Docker("StartContainer")
+	if err != nil {
+		return err
+	}
+	return d.docker.StartContainerWithContext(id, hostConfig, ctx)
 }
 
-func (d *_dockerclient) WaitContainer(id string) (int, error) {
-	return d.docker.WaitContainer(id)
+func (d *_dockerclient) WaitContainerWithContext(id string, ctx context.Context) (int, error) {
+	err := faults.Docker("WaitContainer")
+	if err != nil {
+		return 0, err
+	}
+	return d.docker.WaitContainerWithContext(id, ctx)
 }
 
-func (d *_dockerclient) StopContainer(id string, timeout uint) error {
-	return d.docker.StopContainer(id, timeout)
+func (d *_dockerclient) StopContainerWithContext(id string, timeout uint, ctx context.Context) error {
+	err := faults.Docker("StopContainer")
+	if err != nil {
+		return err
+	}
+	return d.docker.StopContainerWithContext(id, timeout, ctx)
+}
+
+func (d *_dockerclient) InspectContainerWithContext(id string, ctx context.Context) (*godocker.Container, error) {
+	err := faults.Docker("InspectContainer")
+	if err != nil {
+		return nil, err
+	}
+	return d.docker.InspectContainerWithContext(id, ctx)
+}
+
+func (d *_dockerclient) PingWithContext(ctx context.Context) error {
+	err := faults.Docker("Ping")
+	if err != nil {
+		return err
+	}
+	return d.docker.PingWithContext(ctx)
 }
 
-func (d *_dockerclient) Ping() error {
-	return d.docker.Ping()
+func (d *_dockerclient) NetworkInfo(id string) (*godocker.Network, error) {
+	err := faults.Docker("NetworkInfo")
+	if err != nil {
+		return nil, err
+	}
+	return d.docker.NetworkInfo(id)
+}
+
+func (d *_dockerclient) CreateNetwork(opts godocker.CreateNetworkOptions) (*godocker.Network, error) {
+	err := faults.Docker("CreateNetwork")
+	if err != nil {
+		return nil, err
+	}
+	return d.docker.CreateNetwork(opts)
 }
 
 type fileSystem interface {
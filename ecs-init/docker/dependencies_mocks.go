@@ -18,6 +18,7 @@
 package docker
 
 import (
+	context "context"
 	reflect "reflect"
 
 	go_dockerclient "github.com/fsouza/go-dockerclient"
@@ -76,6 +77,63 @@ func (mr *MockdockerclientMockRecorder) LoadImage(opts interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadImage", reflect.TypeOf((*Mockdockerclient)(nil).LoadImage), opts)
 }
 
+// InspectImage mocks base method
+func (m *Mockdockerclient) InspectImage(name string) (*go_dockerclient.Image, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InspectImage", name)
+	ret0, _ := ret[0].(*go_dockerclient.Image)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InspectImage indicates an expected call of InspectImage
+func (mr *MockdockerclientMockRecorder) InspectImage(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InspectImage", reflect.TypeOf((*Mockdockerclient)(nil).InspectImage), name)
+}
+
+// RemoveImageExtended mocks base method
+func (m *Mockdockerclient) RemoveImageExtended(name string, opts go_dockerclient.RemoveImageOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveImageExtended", name, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveImageExtended indicates an expected call of RemoveImageExtended
+func (mr *MockdockerclientMockRecorder) RemoveImageExtended(name, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveImageExtended", reflect.TypeOf((*Mockdockerclient)(nil).RemoveImageExtended), name, opts)
+}
+
+// TagImage mocks base method
+func (m *Mockdockerclient) TagImage(name string, opts go_dockerclient.TagImageOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TagImage", name, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TagImage indicates an expected call of TagImage
+func (mr *MockdockerclientMockRecorder) TagImage(name, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TagImage", reflect.TypeOf((*Mockdockerclient)(nil).TagImage), name, opts)
+}
+
+// PullImage mocks base method
+func (m *Mockdockerclient) PullImage(opts go_dockerclient.PullImageOptions, auth go_dockerclient.AuthConfiguration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PullImage", opts, auth)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PullImage indicates an expected call of PullImage
+func (mr *MockdockerclientMockRecorder) PullImage(opts, auth interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PullImage", reflect.TypeOf((*Mockdockerclient)(nil).PullImage), opts, auth)
+}
+
 // Logs mocks base method
 func (m *Mockdockerclient) Logs(opts go_dockerclient.LogsOptions) error {
 	m.ctrl.T.Helper()
@@ -134,61 +192,106 @@ func (mr *MockdockerclientMockRecorder) CreateContainer(opts interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateContainer", reflect.TypeOf((*Mockdockerclient)(nil).CreateContainer), opts)
 }
 
-// StartContainer mocks base method
-func (m *Mockdockerclient) StartContainer(id string, hostConfig *go_dockerclient.HostConfig) error {
+// StartContainerWithContext mocks base method
+func (m *Mockdockerclient) StartContainerWithContext(id string, hostConfig *go_dockerclient.HostConfig, ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "StartContainer", id, hostConfig)
+	ret := m.ctrl.Call(m, "StartContainerWithContext", id, hostConfig, ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// StartContainer indicates an expected call of StartContainer
-func (mr *MockdockerclientMockRecorder) StartContainer(id, hostConfig interface{}) *gomock.Call {
+// StartContainerWithContext indicates an expected call of StartContainerWithContext
+func (mr *MockdockerclientMockRecorder) StartContainerWithContext(id, hostConfig, ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartContainer", reflect.TypeOf((*Mockdockerclient)(nil).StartContainer), id, hostConfig)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartContainerWithContext", reflect.TypeOf((*Mockdockerclient)(nil).StartContainerWithContext), id, hostConfig, ctx)
 }
 
-// WaitContainer mocks base method
-func (m *Mockdockerclient) WaitContainer(id string) (int, error) {
+// WaitContainerWithContext mocks base method
+func (m *Mockdockerclient) WaitContainerWithContext(id string, ctx context.Context) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "WaitContainer", id)
+	ret := m.ctrl.Call(m, "WaitContainerWithContext", id, ctx)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// WaitContainer indicates an expected call of WaitContainer
-func (mr *MockdockerclientMockRecorder) WaitContainer(id interface{}) *gomock.Call {
+// WaitContainerWithContext indicates an expected call of WaitContainerWithContext
+func (mr *MockdockerclientMockRecorder) WaitContainerWithContext(id, ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitContainer", reflect.TypeOf((*Mockdockerclient)(nil).WaitContainer), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitContainerWithContext", reflect.TypeOf((*Mockdockerclient)(nil).WaitContainerWithContext), id, ctx)
 }
 
-// StopContainer mocks base method
-func (m *Mockdockerclient) StopContainer(id string, timeout uint) error {
+// StopContainerWithContext mocks base method
+func (m *Mockdockerclient) StopContainerWithContext(id string, timeout uint, ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "StopContainer", id, timeout)
+	ret := m.ctrl.Call(m, "StopContainerWithContext", id, timeout, ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// StopContainer indicates an expected call of StopContainer
-func (mr *MockdockerclientMockRecorder) StopContainer(id, timeout interface{}) *gomock.Call {
+// StopContainerWithContext indicates an expected call of StopContainerWithContext
+func (mr *MockdockerclientMockRecorder) StopContainerWithContext(id, timeout, ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopContainerWithContext", reflect.TypeOf((*Mockdockerclient)(nil).StopContainerWithContext), id, timeout, ctx)
+}
+
+// InspectContainerWithContext mocks base method
+func (m *Mockdockerclient) InspectContainerWithContext(id string, ctx context.Context) (*go_dockerclient.Container, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InspectContainerWithContext", id, ctx)
+	ret0, _ := ret[0].(*go_dockerclient.Container)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InspectContainerWithContext indicates an expected call of InspectContainerWithContext
+func (mr *MockdockerclientMockRecorder) InspectContainerWithContext(id, ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopContainer", reflect.TypeOf((*Mockdockerclient)(nil).StopContainer), id, timeout)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InspectContainerWithContext", reflect.TypeOf((*Mockdockerclient)(nil).InspectContainerWithContext), id, ctx)
 }
 
-// Ping mocks base method
-func (m *Mockdockerclient) Ping() error {
+// PingWithContext mocks base method
+func (m *Mockdockerclient) PingWithContext(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Ping")
+	ret := m.ctrl.Call(m, "PingWithContext", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// Ping indicates an expected call of Ping
-func (mr *MockdockerclientMockRecorder) Ping() *gomock.Call {
+// PingWithContext indicates an expected call of PingWithContext
+func (mr *MockdockerclientMockRecorder) PingWithContext(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*Mockdockerclient)(nil).Ping))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PingWithContext", reflect.TypeOf((*Mockdockerclient)(nil).PingWithContext), ctx)
+}
+
+// NetworkInfo mocks base method
+func (m *Mockdockerclient) NetworkInfo(id string) (*go_dockerclient.Network, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NetworkInfo", id)
+	ret0, _ := ret[0].(*go_dockerclient.Network)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NetworkInfo indicates an expected call of NetworkInfo
+func (mr *MockdockerclientMockRecorder) NetworkInfo(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkInfo", reflect.TypeOf((*Mockdockerclient)(nil).NetworkInfo), id)
+}
+
+// CreateNetwork mocks base method
+func (m *Mockdockerclient) CreateNetwork(opts go_dockerclient.CreateNetworkOptions) (*go_dockerclient.Network, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateNetwork", opts)
+	ret0, _ := ret[0].(*go_dockerclient.Network)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateNetwork indicates an expected call of CreateNetwork
+func (mr *MockdockerclientMockRecorder) CreateNetwork(opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateNetwork", reflect.TypeOf((*Mockdockerclient)(nil).CreateNetwork), opts)
 }
 
 // MockdockerClientFactory is a mock of dockerClientFactory interface
@@ -229,6 +332,21 @@ func (mr *MockdockerClientFactoryMockRecorder) NewVersionedClient(endpoint, apiV
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewVersionedClient", reflect.TypeOf((*MockdockerClientFactory)(nil).NewVersionedClient), endpoint, apiVersionString)
 }
 
+// NewVersionedTLSClient mocks base method
+func (m *MockdockerClientFactory) NewVersionedTLSClient(endpoint, cert, key, ca, apiVersionString string) (dockerclient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewVersionedTLSClient", endpoint, cert, key, ca, apiVersionString)
+	ret0, _ := ret[0].(dockerclient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewVersionedTLSClient indicates an expected call of NewVersionedTLSClient
+func (mr *MockdockerClientFactoryMockRecorder) NewVersionedTLSClient(endpoint, cert, key, ca, apiVersionString interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewVersionedTLSClient", reflect.TypeOf((*MockdockerClientFactory)(nil).NewVersionedTLSClient), endpoint, cert, key, ca, apiVersionString)
+}
+
 // MockfileSystem is a mock of fileSystem interface
 type MockfileSystem struct {
 	ctrl     *gomock.Controller
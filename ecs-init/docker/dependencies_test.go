@@ -14,11 +14,14 @@
 package docker
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"testing"
 	"time"
 
@@ -49,89 +52,118 @@ func TestIsRetryablePingErrorReturnsFalse(t *testing.T) {
 	assert.False(t, isRetryablePingError(fmt.Errorf("error")), "Expect RetryablePingError to be true if non-http error passed in")
 }
 
-func TestNewDockerClientRetriesOnPingNetworkError(t *testing.T) {
+func TestNewDockerClientDoesNotPing(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockDockerClient := NewMockdockerclient(ctrl)
 	mockClientFactory := NewMockdockerClientFactory(ctrl)
+	mockClientFactory.EXPECT().NewVersionedClient(gomock.Any(), gomock.Any()).Return(mockDockerClient, nil)
+
+	_, endpoint, err := newDockerClient(mockClientFactory)
+	assert.NoError(t, err, "Expect no error for creating docker client while the daemon is down")
+	assert.Equal(t, "unix:///var/run/docker.sock", endpoint)
+}
+
+func TestWaitReadyRetriesOnPingNetworkError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDockerClient := NewMockdockerclient(ctrl)
 	mockBackoff := NewMockBackoff(ctrl)
 
 	gomock.InOrder(
-		mockClientFactory.EXPECT().NewVersionedClient(gomock.Any(), gomock.Any()).Return(mockDockerClient, nil),
-		mockDockerClient.EXPECT().Ping().Return(netError),
+		mockDockerClient.EXPECT().PingWithContext(gomock.Any()).Return(netError),
 		mockBackoff.EXPECT().ShouldRetry().Return(true),
 		mockBackoff.EXPECT().Duration().Return(immediately),
-		mockDockerClient.EXPECT().Ping().Return(nil),
+		mockDockerClient.EXPECT().PingWithContext(gomock.Any()).Return(nil),
 	)
 
-	_, err := newDockerClient(mockClientFactory, mockBackoff)
-	assert.NoError(t, err, "Expect no error for creating docker client with retry on network error")
+	client := &Client{docker: mockDockerClient}
+	err := client.waitReady(context.TODO(), mockBackoff)
+	assert.NoError(t, err, "Expect no error for waiting for docker with retry on network error")
 }
 
-func TestNewDockerClientRetriesOnHTTPStatusNotOKError(t *testing.T) {
+func TestWaitReadyRetriesOnHTTPStatusNotOKError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockDockerClient := NewMockdockerclient(ctrl)
-	mockClientFactory := NewMockdockerClientFactory(ctrl)
 	mockBackoff := NewMockBackoff(ctrl)
 
 	gomock.InOrder(
-		mockClientFactory.EXPECT().NewVersionedClient(gomock.Any(), gomock.Any()).Return(mockDockerClient, nil),
-		mockDockerClient.EXPECT().Ping().Return(httpError),
+		mockDockerClient.EXPECT().PingWithContext(gomock.Any()).Return(httpError),
 		mockBackoff.EXPECT().ShouldRetry().Return(true),
 		mockBackoff.EXPECT().Duration().Return(immediately),
-		mockDockerClient.EXPECT().Ping().Return(nil),
+		mockDockerClient.EXPECT().PingWithContext(gomock.Any()).Return(nil),
 	)
 
-	_, err := newDockerClient(mockClientFactory, mockBackoff)
-	assert.NoError(t, err, "Expect no error for creating docker client with retry on HTTP status not OK")
+	client := &Client{docker: mockDockerClient}
+	err := client.waitReady(context.TODO(), mockBackoff)
+	assert.NoError(t, err, "Expect no error for waiting for docker with retry on HTTP status not OK")
 }
 
-func TestNewDockerClientDoesnotRetryOnPingNonNetworkError(t *testing.T) {
+func TestWaitReadyDoesnotRetryOnPingNonNetworkError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockDockerClient := NewMockdockerclient(ctrl)
-	mockClientFactory := NewMockdockerClientFactory(ctrl)
 	mockBackoff := NewMockBackoff(ctrl)
 
-	gomock.InOrder(
-		mockClientFactory.EXPECT().NewVersionedClient(gomock.Any(), gomock.Any()).Return(mockDockerClient, nil),
-		mockDockerClient.EXPECT().Ping().Return(fmt.Errorf("error")),
-	)
+	mockDockerClient.EXPECT().PingWithContext(gomock.Any()).Return(fmt.Errorf("error"))
 
-	_, err := newDockerClient(mockClientFactory, mockBackoff)
-	assert.Error(t, err, "Expect error when creating docker client with no retry")
+	client := &Client{docker: mockDockerClient}
+	err := client.waitReady(context.TODO(), mockBackoff)
+	assert.Error(t, err, "Expect error when waiting for docker with no retry")
 }
 
-func TestNewDockerClientGivesUpRetryingOnPingNetworkError(t *testing.T) {
+func TestWaitReadyGivesUpRetryingOnPingNetworkError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockDockerClient := NewMockdockerclient(ctrl)
-	mockClientFactory := NewMockdockerClientFactory(ctrl)
 	mockBackoff := NewMockBackoff(ctrl)
 
 	gomock.InOrder(
-		mockClientFactory.EXPECT().NewVersionedClient(gomock.Any(), gomock.Any()).Return(mockDockerClient, nil),
-		mockDockerClient.EXPECT().Ping().Return(netError),
+		mockDockerClient.EXPECT().PingWithContext(gomock.Any()).Return(netError),
 		mockBackoff.EXPECT().ShouldRetry().Return(true),
 		mockBackoff.EXPECT().Duration().Return(immediately),
-		mockDockerClient.EXPECT().Ping().Return(netError),
+		mockDockerClient.EXPECT().PingWithContext(gomock.Any()).Return(netError),
 		mockBackoff.EXPECT().ShouldRetry().Return(false),
 	)
 
-	_, err := newDockerClient(mockClientFactory, mockBackoff)
-	assert.Error(t, err, "Expect error when creating docker client with no retry")
+	client := &Client{docker: mockDockerClient}
+	err := client.waitReady(context.TODO(), mockBackoff)
+	assert.Error(t, err, "Expect error when waiting for docker with no retry")
+	assert.True(t, errors.Is(err, ErrDockerUnavailable))
 }
 
-func TestNewDockerClientGivesUpRetryingOnUnavailableSocket(t *testing.T) {
+func TestWaitReadyStopsWhenContextIsDone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDockerClient := NewMockdockerclient(ctrl)
+	mockBackoff := NewMockBackoff(ctrl)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	gomock.InOrder(
+		mockDockerClient.EXPECT().PingWithContext(gomock.Any()).Return(netError),
+		mockBackoff.EXPECT().ShouldRetry().Return(true),
+		mockBackoff.EXPECT().Duration().DoAndReturn(func() time.Duration {
+			cancel()
+			return time.Hour
+		}),
+	)
+
+	client := &Client{docker: mockDockerClient}
+	err := client.waitReady(ctx, mockBackoff)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestWaitReadyGivesUpRetryingOnUnavailableSocket(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockClientFactory := NewMockdockerClientFactory(ctrl)
 	mockBackoff := NewMockBackoff(ctrl)
 
 	realDockerClient, dockerClientErr := godockerClientFactory{}.NewVersionedClient("unix:///a/bad/docker.sock", dockerClientAPIVersion)
@@ -139,9 +171,6 @@ func TestNewDockerClientGivesUpRetryingOnUnavailableSocket(t *testing.T) {
 	require.False(t, dockerClientErr != nil, "there should be no errors trying to set up a docker client (intentionally bad with nonexistent socket path")
 
 	gomock.InOrder(
-		// We use the real client to ensure we're classifying errors
-		// correctly as returned by the upstream's error handling.
-		mockClientFactory.EXPECT().NewVersionedClient(gomock.Any(), gomock.Any()).Return(realDockerClient, dockerClientErr),
 		// "bad connection", retries
 		mockBackoff.EXPECT().ShouldRetry().Return(true),
 		mockBackoff.EXPECT().Duration().Return(immediately),
@@ -149,11 +178,63 @@ func TestNewDockerClientGivesUpRetryingOnUnavailableSocket(t *testing.T) {
 		mockBackoff.EXPECT().ShouldRetry().Return(false),
 	)
 
-	_, err := newDockerClient(mockClientFactory, mockBackoff)
-	require.Error(t, err, "expect an error when creating docker client")
+	// We use the real client to ensure we're classifying errors
+	// correctly as returned by the upstream's error handling.
+	client := &Client{docker: realDockerClient, endpoint: "unix:///a/bad/docker.sock"}
+	err := client.waitReady(context.TODO(), mockBackoff)
+	require.Error(t, err, "expect an error when waiting for docker")
 
+	assert.True(t, errors.Is(err, ErrDockerUnavailable), "expect error to be classified as docker unavailable")
 	// We expect that the error will be a net.OpError wrapped by a
 	// url.Error.
-	_, isExpectedError := err.(*url.Error)
-	assert.True(t, isExpectedError, "expect net.OpError wrapped by url.Error")
+	var urlErr *url.Error
+	assert.True(t, errors.As(err, &urlErr), "expect net.OpError wrapped by url.Error")
+}
+
+func TestNewDockerClientWithTLS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	os.Setenv("DOCKER_HOST", "tcp://127.0.0.1:2376")
+	defer os.Unsetenv("DOCKER_HOST")
+	os.Setenv("DOCKER_TLS_VERIFY", "1")
+	defer os.Unsetenv("DOCKER_TLS_VERIFY")
+	os.Setenv("DOCKER_CERT_PATH", "/etc/ecs/docker")
+	defer os.Unsetenv("DOCKER_CERT_PATH")
+
+	mockDockerClient := NewMockdockerclient(ctrl)
+	mockClientFactory := NewMockdockerClientFactory(ctrl)
+
+	mockClientFactory.EXPECT().NewVersionedTLSClient("tcp://127.0.0.1:2376", "/etc/ecs/docker/cert.pem",
+		"/etc/ecs/docker/key.pem", "/etc/ecs/docker/ca.pem", gomock.Any()).Return(mockDockerClient, nil)
+
+	_, _, err := newDockerClient(mockClientFactory)
+	assert.NoError(t, err)
+}
+
+func TestNewDockerClientInvalidEndpoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	os.Setenv("DOCKER_HOST", "ssh://docker@host")
+	defer os.Unsetenv("DOCKER_HOST")
+
+	_, _, err := newDockerClient(NewMockdockerClientFactory(ctrl))
+	assert.True(t, errors.Is(err, ErrDockerUnavailable))
+}
+
+func TestWaitReadyDiagnosesMissingSocket(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDockerClient := NewMockdockerclient(ctrl)
+	mockBackoff := NewMockBackoff(ctrl)
+
+	gomock.InOrder(
+		mockDockerClient.EXPECT().PingWithContext(gomock.Any()).Return(netError),
+		mockBackoff.EXPECT().ShouldRetry().Return(false),
+	)
+
+	client := &Client{docker: mockDockerClient, endpoint: "unix:///a/bad/podman.sock"}
+	err := client.waitReady(context.TODO(), mockBackoff)
+	assert.True(t, errors.Is(err, ErrDockerUnavailable))
+	assert.Contains(t, err.Error(), "socket /a/bad/podman.sock does not exist")
 }
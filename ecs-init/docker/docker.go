@@ -14,16 +14,25 @@
 package docker
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
+	"github.com/aws/amazon-ecs-init/ecs-init/cgroup"
 	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsexec"
+	"github.com/aws/amazon-ecs-init/ecs-init/efa"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/apparmor"
 	"github.com/aws/amazon-ecs-init/ecs-init/gpu"
+	"github.com/aws/amazon-ecs-init/ecs-init/neuron"
+	"github.com/aws/amazon-ecs-init/ecs-init/selinux"
 
 	log "github.com/cihub/seelog"
 	godocker "github.com/fsouza/go-dockerclient"
@@ -37,6 +46,14 @@ const (
 	// readOnly specifies the read-only suffix for mounting host volumes
 	// when creating the Agent container
 	readOnly = ":ro"
+	// sharedPropagation specifies the suffix for mounting host volumes
+	// whose mounts made in the Agent container are seen by the host
+	sharedPropagation = ":shared"
+	// hostDevDir is the directory of the host's device files
+	hostDevDir = "/dev"
+	// deviceCgroupPermissions lets the Agent container read, write and
+	// create the accelerator device files mapped into it
+	deviceCgroupPermissions = "rwm"
 	// hostProcDir binds the host's /proc directory to /host/proc within the
 	// ECS Agent container
 	// The ECS Agent needs access to host's /proc directory when configuring
@@ -48,6 +65,15 @@ const (
 	defaultDockerEndpoint   = "/var/run"
 	defaultDockerSocketPath = "/var/run/docker.sock"
 
+	// containerLogTailMaxSize bounds the size of the logs captured from a
+	// failed Agent container, as the lines being tailed have no size limit
+	containerLogTailMaxSize = 256 * 1024
+
+	// taskArnLabel is the label the Agent gives the containers of a task
+	taskArnLabel = "com.amazonaws.ecs.task-arn"
+	// containerStateRunning is the state of a running container
+	containerStateRunning = "running"
+
 	// networkMode specifies the networkmode to create the agent container
 	networkMode = "host"
 	// usernsMode specifies the userns mode to create the agent container
@@ -64,8 +90,9 @@ const (
 	// backoffMultiple specifies the backoff multiplier coefficient when
 	// pinging the docker socket
 	backoffMultiple = 2
-	// maxRetries specifies the maximum number of retries for ping to return
-	// a successful response from the docker socket
+	// maxRetries specifies the number of retries of the backoff for ping,
+	// which retries until the Docker ready timeout however many retries
+	// that takes
 	maxRetries = 5
 	// CapNetAdmin to start agent with NET_ADMIN capability
 	// For more information on capabilities, please read this manpage:
@@ -77,8 +104,42 @@ const (
 	// For more information on setns, please read this manpage:
 	// http://man7.org/linux/man-pages/man2/setns.2.html
 	CapSysAdmin = "SYS_ADMIN"
+	// CapIPCLock to start agent with IPC_LOCK capability when EFA devices
+	// are mapped into it, as they need memory to be locked
+	CapIPCLock = "IPC_LOCK"
+	// memlockUlimit is the ulimit of the locked memory of the Agent
+	// container, unlimited when EFA devices are mapped into it
+	memlockUlimit = "memlock"
+	// cpuPeriod is the CFS period, in microseconds, the CPU limit of the
+	// Agent container is a quota of, as with 'docker run --cpus'
+	cpuPeriod = 100000
+	// minMemoryLimitMiB is the lowest memory limit Docker accepts
+	minMemoryLimitMiB = 6
 	// DefaultCgroupMountpoint is the default mount point for the cgroup subsystem
 	DefaultCgroupMountpoint = "/sys/fs/cgroup"
+	// cgroupnsModeHost runs the Agent container in the cgroup namespace of
+	// the host, so that it sees the cgroups of the tasks where they are on a
+	// host with the unified hierarchy
+	cgroupnsModeHost = "host"
+	// agentCgroupParent keeps the Agent container with the system daemons
+	// when Docker starts containers in the tasks slice because memory is
+	// reserved for system daemons
+	agentCgroupParent = "system.slice"
+	// selinuxSharedLabel relabels a mount so that it is shared between the
+	// Agent container and the host
+	selinuxSharedLabel = "z"
+	// selinuxPrivateLabel relabels a mount so that only the Agent container
+	// can use it
+	selinuxPrivateLabel = "Z"
+	// selinuxLabelDisable runs the Agent container without SELinux
+	// separation
+	selinuxLabelDisable = "label=disable"
+	// appArmorSecurityOpt prefixes the AppArmor profile the Agent container
+	// is confined by
+	appArmorSecurityOpt = "apparmor="
+	// AgentStopTimeout is how long the Agent has to exit once asked to stop
+	// before it is killed
+	AgentStopTimeout = 10 * time.Second
 	// pluginSocketFilesDir specifies the location of UNIX domain socket files of
 	// Docker plugins
 	pluginSocketFilesDir = "/run/docker/plugins"
@@ -111,29 +172,70 @@ var pluginDirs = []string{
 type Client struct {
 	docker dockerclient
 	fs     fileSystem
+	// endpoint is the endpoint of the Docker daemon, which is diagnosed
+	// when the daemon does not respond
+	endpoint string
 }
 
-// NewClient reutrns a new Client
+// NewClient reutrns a new Client. The Docker daemon is not contacted, so that
+// the actions that do not need it work while it is down, see WaitReady.
 func NewClient() (*Client, error) {
-	// Create a backoff for pinging the docker socker. This should result in 17-19
-	// seconds of delay in the worst-case between different actions that depend on
-	// docker
-	pingBackoff := backoff.NewBackoff(minBackoffDuration, maxBackoffDuration, backoffJitterMultiple,
-		backoffMultiple, maxRetries)
-	client, err := newDockerClient(godockerClientFactory{}, pingBackoff)
+	client, endpoint, err := newDockerClient(godockerClientFactory{})
 	if err != nil {
 		return nil, err
 	}
 	return &Client{
-		docker: client,
-		fs:     standardFS,
+		docker:   client,
+		fs:       standardFS,
+		endpoint: endpoint,
 	}, nil
 }
 
+// WaitReady waits up to timeout for the Docker daemon to respond, as it may
+// still be starting on first boot. Network errors and server errors are
+// retried with a backoff until then, and waiting stops with the error of ctx
+// once ctx is done.
+func (c *Client) WaitReady(ctx context.Context, timeout time.Duration) error {
+	log.Debugf("Waiting up to %s for the Docker daemon to respond", timeout)
+	pingBackoff := backoff.UntilDeadline(backoff.NewBackoff(minBackoffDuration, maxBackoffDuration,
+		backoffJitterMultiple, backoffMultiple, maxRetries), time.Now().Add(timeout))
+	return c.waitReady(ctx, pingBackoff)
+}
+
+func (c *Client) waitReady(ctx context.Context, pingBackoff backoff.Backoff) error {
+	for {
+		err := c.docker.PingWithContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !(isNetworkError(err) || isRetryablePingError(err)) || !pingBackoff.ShouldRetry() {
+			return unavailable(c.endpoint, err)
+		}
+		d := pingBackoff.Duration()
+		log.Infof("Error connecting to docker, backing off for %s, error: %s", d, err)
+		if backoff.Sleep(ctx, d) != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// NewConfigClient returns a Client that only loads the agent config and
+// builds the options of the Agent container, without connecting to Docker,
+// for the other container runtimes to run the Agent with the same options
+func NewConfigClient() *Client {
+	return &Client{
+		fs: standardFS,
+	}
+}
+
 // IsAgentImageLoaded returns true if the Agent image is loaded in Docker
-func (c *Client) IsAgentImageLoaded() (bool, error) {
+func (c *Client) IsAgentImageLoaded(ctx context.Context) (bool, error) {
 	images, err := c.docker.ListImages(godocker.ListImagesOptions{
-		All: true,
+		All:     true,
+		Context: ctx,
 	})
 	if err != nil {
 		return false, err
@@ -149,14 +251,107 @@ func (c *Client) IsAgentImageLoaded() (bool, error) {
 }
 
 // LoadImage loads an io.Reader into Docker
-func (c *Client) LoadImage(image io.Reader) error {
-	return c.docker.LoadImage(godocker.LoadImageOptions{InputStream: image})
+func (c *Client) LoadImage(ctx context.Context, image io.Reader) error {
+	return c.docker.LoadImage(godocker.LoadImageOptions{InputStream: image, Context: ctx})
+}
+
+// PreloadImage loads an io.Reader containing the next Agent image into Docker
+// and tags it as the standby image, without replacing the Agent image used when
+// the Agent is restarted before the upgrade
+func (c *Client) PreloadImage(ctx context.Context, image io.Reader) error {
+	current, err := c.docker.InspectImage(config.AgentImageName)
+	if err != nil && err != godocker.ErrNoSuchImage {
+		return err
+	}
+	err = c.docker.LoadImage(godocker.LoadImageOptions{InputStream: image, Context: ctx})
+	if err != nil {
+		return err
+	}
+	err = c.docker.TagImage(config.AgentImageName, godocker.TagImageOptions{
+		Repo:    config.AgentImageRepository,
+		Tag:     config.AgentStandbyImageTag,
+		Force:   true,
+		Context: ctx,
+	})
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return nil
+	}
+	// loading the image moved the tag of the Agent image, move it back
+	return c.docker.TagImage(current.ID, godocker.TagImageOptions{
+		Repo:    config.AgentImageRepository,
+		Tag:     config.AgentImageTag,
+		Force:   true,
+		Context: ctx,
+	})
+}
+
+// PromoteStandbyImage tags the standby image preloaded by PreloadImage as the
+// Agent image
+func (c *Client) PromoteStandbyImage(ctx context.Context) error {
+	return c.docker.TagImage(config.AgentImageRepository+":"+config.AgentStandbyImageTag, godocker.TagImageOptions{
+		Repo:    config.AgentImageRepository,
+		Tag:     config.AgentImageTag,
+		Force:   true,
+		Context: ctx,
+	})
+}
+
+// PullImage pulls image from its registry unless it is already present
+func (c *Client) PullImage(ctx context.Context, image string) error {
+	_, err := c.docker.InspectImage(image)
+	if err == nil {
+		return nil
+	}
+	if err != godocker.ErrNoSuchImage {
+		return err
+	}
+	repository, tag := godocker.ParseRepositoryTag(image)
+	return c.docker.PullImage(godocker.PullImageOptions{
+		Repository: repository,
+		Tag:        tag,
+		Context:    ctx,
+	}, godocker.AuthConfiguration{})
+}
+
+// RegistryAuth is the user name and password to pull from a registry, which
+// are empty for anonymous pulls
+type RegistryAuth struct {
+	Username      string
+	Password      string
+	ServerAddress string
+}
+
+// PullAgentImage pulls the Agent image from its registry, even if it is
+// present already so that a moved tag is followed, and tags it as the Agent
+// image in place of the image loaded from a tarball
+func (c *Client) PullAgentImage(ctx context.Context, image string, auth RegistryAuth) error {
+	opts := godocker.PullImageOptions{Repository: image, Context: ctx}
+	if !strings.Contains(image, "@") {
+		opts.Repository, opts.Tag = godocker.ParseRepositoryTag(image)
+	}
+	err := c.docker.PullImage(opts, godocker.AuthConfiguration{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		ServerAddress: auth.ServerAddress,
+	})
+	if err != nil {
+		return err
+	}
+	return c.docker.TagImage(image, godocker.TagImageOptions{
+		Repo:    config.AgentImageRepository,
+		Tag:     config.AgentImageTag,
+		Force:   true,
+		Context: ctx,
+	})
 }
 
 // RemoveExistingAgentContainer remvoes any existing container named
 // "ecs-agent" or returns without error if none is found
-func (c *Client) RemoveExistingAgentContainer() error {
-	containerToRemove, err := c.findAgentContainer()
+func (c *Client) RemoveExistingAgentContainer(ctx context.Context) error {
+	containerToRemove, err := c.findAgentContainer(ctx)
 	if err != nil {
 		return err
 	}
@@ -166,19 +361,92 @@ func (c *Client) RemoveExistingAgentContainer() error {
 	}
 	log.Infof("Removing existing agent container ID: %s", containerToRemove)
 	err = c.docker.RemoveContainer(godocker.RemoveContainerOptions{
-		ID:    containerToRemove,
-		Force: true,
+		ID:      containerToRemove,
+		Force:   true,
+		Context: ctx,
 	})
 	return err
 }
 
-func (c *Client) findAgentContainer() (string, error) {
+// IsAgentRunning returns if the Agent container is running
+func (c *Client) IsAgentRunning(ctx context.Context) (bool, error) {
+	container, err := c.runningAgentContainer(ctx)
+	return container != nil, err
+}
+
+// RunningAgentContainerID returns the ID of the running Agent container, or
+// an empty string when the Agent is not running
+func (c *Client) RunningAgentContainerID(ctx context.Context) (string, error) {
+	container, err := c.runningAgentContainer(ctx)
+	if err != nil || container == nil {
+		return "", err
+	}
+	return container.ID, nil
+}
+
+// runningAgentContainer returns the running Agent container, or nil when the
+// Agent is not running
+func (c *Client) runningAgentContainer(ctx context.Context) (*godocker.APIContainers, error) {
+	containers, err := c.docker.ListContainers(godocker.ListContainersOptions{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+	agentContainerName := "/" + config.AgentContainerName
+	for i, container := range containers {
+		for _, name := range container.Names {
+			if name == agentContainerName {
+				return &containers[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// ErrAgentNotRunning is returned when the Agent container exists but is not
+// running
+var ErrAgentNotRunning = errors.New("the Agent container is not running")
+
+// AgentHealth returns the status of the health check of the running Agent
+// container, such as healthy or unhealthy, or an empty string when the Agent
+// container has no health check
+func (c *Client) AgentHealth(ctx context.Context) (string, error) {
+	container, err := c.docker.InspectContainerWithContext(config.AgentContainerName, ctx)
+	if err != nil {
+		return "", err
+	}
+	if !container.State.Running {
+		return "", ErrAgentNotRunning
+	}
+	return container.State.Health.Status, nil
+}
+
+// AgentLogPath returns the file Docker writes the log of the Agent container
+// to, or an empty string when its log driver does not write to a file
+func (c *Client) AgentLogPath(ctx context.Context) (string, error) {
+	container, err := c.docker.InspectContainerWithContext(config.AgentContainerName, ctx)
+	if err != nil {
+		return "", err
+	}
+	return container.LogPath, nil
+}
+
+// Ping returns an error when the Docker daemon does not respond
+func (c *Client) Ping(ctx context.Context) error {
+	err := c.docker.PingWithContext(ctx)
+	if err != nil {
+		return unavailable(c.endpoint, err)
+	}
+	return nil
+}
+
+func (c *Client) findAgentContainer(ctx context.Context) (string, error) {
 	// TODO pagination
 	containers, err := c.docker.ListContainers(godocker.ListContainersOptions{
 		All: true,
 		Filters: map[string][]string{
 			"status": []string{},
 		},
+		Context: ctx,
 	})
 	if err != nil {
 		return "", err
@@ -195,44 +463,107 @@ func (c *Client) findAgentContainer() (string, error) {
 	return "", nil
 }
 
-// StartAgent starts the Agent in Docker and returns the exit code from the container
-func (c *Client) StartAgent() (int, error) {
-	envVarsFromFiles := c.LoadEnvVars()
+// TaskContainer is a container started by the Agent for a task
+type TaskContainer struct {
+	ID      string
+	Name    string
+	TaskArn string
+	Running bool
+}
+
+// ListTaskContainers returns the containers of tasks, whether or not they
+// are running
+func (c *Client) ListTaskContainers(ctx context.Context) ([]TaskContainer, error) {
+	containers, err := c.docker.ListContainers(godocker.ListContainersOptions{
+		All: true,
+		Filters: map[string][]string{
+			"label": []string{taskArnLabel},
+		},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var taskContainers []TaskContainer
+	for _, container := range containers {
+		taskContainer := TaskContainer{
+			ID:      container.ID,
+			TaskArn: container.Labels[taskArnLabel],
+			Running: container.State == containerStateRunning,
+		}
+		if len(container.Names) > 0 {
+			taskContainer.Name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		taskContainers = append(taskContainers, taskContainer)
+	}
+	return taskContainers, nil
+}
 
-	hostConfig := c.getHostConfig(envVarsFromFiles)
+// RemoveContainer removes the container with the given ID and its anonymous
+// volumes
+func (c *Client) RemoveContainer(ctx context.Context, id string) error {
+	return c.docker.RemoveContainer(godocker.RemoveContainerOptions{
+		ID:            id,
+		RemoveVolumes: true,
+		Force:         true,
+		Context:       ctx,
+	})
+}
 
-	container, err := c.docker.CreateContainer(godocker.CreateContainerOptions{
+// AgentContainerOptions returns the options the Agent container is created
+// with, from the agent config as it is now
+func (c *Client) AgentContainerOptions() godocker.CreateContainerOptions {
+	envVarsFromFiles := c.LoadEnvVars()
+	opts := godocker.CreateContainerOptions{
 		Name:       config.AgentContainerName,
 		Config:     c.getContainerConfig(envVarsFromFiles),
-		HostConfig: hostConfig,
-	})
+		HostConfig: c.getHostConfig(envVarsFromFiles),
+	}
+	if agentNetwork() == config.AgentNetworkBridge {
+		setAgentNetwork(opts.Config, opts.HostConfig)
+	}
+	return opts
+}
+
+// StartAgent starts the Agent in Docker and returns the exit code from the container
+func (c *Client) StartAgent(ctx context.Context) (int, error) {
+	opts := c.AgentContainerOptions()
+	opts.Context = ctx
+	if opts.HostConfig.NetworkMode == config.AgentBridgeNetwork {
+		err := c.ensureAgentNetwork(ctx)
+		if err != nil {
+			return 0, err
+		}
+	}
+	container, err := c.docker.CreateContainer(opts)
 	if err != nil {
 		return 0, err
 	}
-	err = c.docker.StartContainer(container.ID, nil)
+	err = c.docker.StartContainerWithContext(container.ID, nil, ctx)
 	if err != nil {
 		return 0, err
 	}
-	return c.docker.WaitContainer(container.ID)
+	return c.docker.WaitContainerWithContext(container.ID, ctx)
 }
 
 // GetContainerLogTail will return the last logWindowSize lines of logs for
 // the Agent Container.
-func (c *Client) GetContainerLogTail(logWindowSize string) string {
-	containerToLog, _ := c.findAgentContainer()
+func (c *Client) GetContainerLogTail(ctx context.Context, logWindowSize string) string {
+	containerToLog, _ := c.findAgentContainer(ctx)
 	if containerToLog == "" {
 		log.Info("No existing container to take logs from.")
                 return ""
 	}
 	// we want to capture some logs from our removed containers in case of failure
-	var containerLogBuf bytes.Buffer
+	containerLogBuf := newTailBuffer(containerLogTailMaxSize)
 	err := c.docker.Logs(godocker.LogsOptions{
 		Container:    containerToLog,
-		OutputStream: &containerLogBuf,
+		OutputStream: containerLogBuf,
 		Stdout:       true,
 		Stderr:       true,
 		Tail:         logWindowSize,
 		Timestamps:   true,
+		Context:      ctx,
 	})
 	// we're ok if grabbing the container's logs fails
 	if err != nil {
@@ -265,10 +596,20 @@ func (c *Client) getContainerConfig(envVarsFromFiles map[string]string) *godocke
 		envVariables[envKey] = envValue
 	}
 
+	for envKey, envValue := range dockerEndpointEnvVars(envVarsFromFiles) {
+		envVariables[envKey] = envValue
+	}
+
 	for key, val := range envVarsFromFiles {
 		envVariables[key] = val
 	}
 
+	// the Agent uses the proxy of ecs-init when none is set in the agent
+	// config files
+	for key, val := range proxyEnvVars(envVarsFromFiles) {
+		envVariables[key] = val
+	}
+
 	var env []string
 	for envKey, envValue := range envVariables {
 		env = append(env, envKey+"="+envValue)
@@ -316,6 +657,9 @@ func (c *Client) LoadEnvVars() map[string]string {
 		}
 		envVariables[envKey] = envValue
 	}
+
+	c.mergeInstanceAttributes(envVariables)
+	expandTemplates(envVariables)
 	return envVariables
 }
 
@@ -356,36 +700,120 @@ func generateLabelMap(jsonBlock string) (map[string]string, error) {
 }
 
 func (c *Client) getHostConfig(envVarsFromFiles map[string]string) *godocker.HostConfig {
-	dockerSocketBind := getDockerSocketBind(envVarsFromFiles)
-
-	binds := []string{
-		dockerSocketBind,
-		config.LogDirectory() + ":" + logDir,
-		config.AgentDataDirectory() + ":" + dataDir,
-		config.AgentConfigDirectory() + ":" + config.AgentConfigDirectory(),
-		config.CacheDirectory() + ":" + config.CacheDirectory(),
-		config.CgroupMountpoint() + ":" + DefaultCgroupMountpoint,
-		// bind mount instance config dir
-		config.InstanceConfigDirectory() + ":" + config.InstanceConfigDirectory(),
+	hierarchy := cgroupHierarchy()
+	cgroupBind := config.CgroupMountpoint() + ":" + DefaultCgroupMountpoint
+	if hierarchy == cgroup.Unified {
+		// there is a single hierarchy where systemd mounts it, whatever the
+		// cgroup v1 mountpoint of the platform
+		cgroupBind = cgroup.UnifiedMountpoint + ":" + DefaultCgroupMountpoint
 	}
 
+	binds := append(getDockerEndpointBinds(envVarsFromFiles),
+		config.LogDirectory()+":"+logDir,
+		config.AgentDataDirectory()+":"+dataDir,
+		config.AgentConfigDirectory()+":"+config.AgentConfigDirectory(),
+		config.CacheDirectory()+":"+config.CacheDirectory(),
+		cgroupBind,
+		// bind mount instance config dir
+		config.InstanceConfigDirectory()+":"+config.InstanceConfigDirectory(),
+	)
+
 	// for al, al2 add host ssl cert directory mounts
 	if pkiDir := config.HostPKIDirPath(); pkiDir != "" {
 		certsPath := pkiDir + ":" + pkiDir + readOnly
 		binds = append(binds, certsPath)
 	}
 
-	for key, val := range c.LoadEnvVars() {
+	var devices, efaDevices []godocker.Device
+	agentEnvVars := c.LoadEnvVars()
+	for key, val := range agentEnvVars {
 		if key == config.GPUSupportEnvVar && val == "true" {
 			if nvidiaGPUDevicesPresent() {
 				// bind mount gpu info dir
 				binds = append(binds, gpu.GPUInfoDirPath+":"+gpu.GPUInfoDirPath)
+				devices = append(devices, nvidiaGPUDeviceMappings()...)
 			}
 		}
+		if key == config.NeuronSupportEnvVar && val == "true" {
+			devices = append(devices, neuronDeviceMappings()...)
+			if NeuronRuntimeSocketPresent() {
+				binds = append(binds, neuron.RuntimeSocketPath+":"+neuron.RuntimeSocketPath)
+			}
+		}
+		if key == config.EFASupportEnvVar && val == "true" {
+			efaDevices = efaDeviceMappings()
+			devices = append(devices, efaDevices...)
+		}
+		if key == config.ExecPrerequisitesEnvVar && val == "true" {
+			binds = append(binds, ecsexec.HostDirectory+":"+ecsexec.ContainerDirectory)
+		}
+		if key == config.EBSTaskAttachEnvVar && val == "true" {
+			// the Agent finds attached devices under /dev and mounts them
+			// where they are visible to task containers
+			binds = append(binds, hostDevDir+":"+hostDevDir,
+				config.EBSMountDirectory()+":"+config.EBSMountDirectory()+sharedPropagation)
+		}
 	}
 
 	binds = append(binds, getDockerPluginDirBinds()...)
-	return createHostConfig(binds)
+	hostConfig := createHostConfig(binds)
+	hostConfig.Devices = devices
+	if hierarchy == cgroup.Unified {
+		hostConfig.CgroupnsMode = cgroupnsModeHost
+	}
+	switch selinuxLabeling() {
+	case config.SELinuxLabelingRelabel:
+		hostConfig.Binds = relabelBinds(hostConfig.Binds)
+	case config.SELinuxLabelingDisable:
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, selinuxLabelDisable)
+	}
+	if AppArmorEnabled() {
+		// without a profile, Docker confines the Agent container with its
+		// docker-default profile, which denies the mounts of task volumes
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, appArmorSecurityOpt+config.AppArmorProfile())
+	}
+	if len(efaDevices) > 0 {
+		hostConfig.CapAdd = append(hostConfig.CapAdd, CapIPCLock)
+		hostConfig.Ulimits = append(hostConfig.Ulimits, godocker.ULimit{Name: memlockUlimit, Soft: -1, Hard: -1})
+	}
+	if _, ok := agentEnvVars[config.ReservedSystemMemoryEnvVar]; ok {
+		hostConfig.CgroupParent = agentCgroupParent
+	}
+	setResourceLimits(hostConfig, agentEnvVars)
+	return hostConfig
+}
+
+// setResourceLimits limits the CPUs, memory and processes of the Agent
+// container as set in the agent config, so that the Agent cannot starve the
+// tasks of small instances. Invalid limits are logged and not applied.
+func setResourceLimits(hostConfig *godocker.HostConfig, envVariables map[string]string) {
+	if val, ok := envVariables[config.AgentCPULimitEnvVar]; ok {
+		cpus, err := strconv.ParseFloat(val, 64)
+		quota := int64(cpus * cpuPeriod)
+		if err != nil || quota < 1 {
+			log.Warnf("Not limiting the CPUs of the Agent container, invalid %s %q", config.AgentCPULimitEnvVar, val)
+		} else {
+			hostConfig.CPUPeriod = cpuPeriod
+			hostConfig.CPUQuota = quota
+		}
+	}
+	if val, ok := envVariables[config.AgentMemoryLimitEnvVar]; ok {
+		memoryMiB, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || memoryMiB < minMemoryLimitMiB {
+			log.Warnf("Not limiting the memory of the Agent container, invalid %s %q, expected at least %d MiB",
+				config.AgentMemoryLimitEnvVar, val, minMemoryLimitMiB)
+		} else {
+			hostConfig.Memory = memoryMiB * 1024 * 1024
+		}
+	}
+	if val, ok := envVariables[config.AgentPidsLimitEnvVar]; ok {
+		pids, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || pids < 1 {
+			log.Warnf("Not limiting the processes of the Agent container, invalid %s %q", config.AgentPidsLimitEnvVar, val)
+		} else {
+			hostConfig.PidsLimit = &pids
+		}
+	}
 }
 
 // getDockerSocketBind returns the bind for Docker socket.
@@ -410,6 +838,39 @@ func getDockerSocketBind(envVarsFromFiles map[string]string) string {
 	return dockerUnixSocketSourcePath + ":" + dockerEndpointAgent
 }
 
+// getDockerEndpointBinds returns the binds giving the Agent access to the
+// Docker daemon: its socket, or the TLS certificates of the connection when
+// the daemon listens on TCP, which the Agent reaches through the host network
+func getDockerEndpointBinds(envVarsFromFiles map[string]string) []string {
+	endpoint, err := config.DockerEndpoint()
+	if err != nil || !strings.HasPrefix(endpoint, config.TCPSocketPrefix) {
+		return []string{getDockerSocketBind(envVarsFromFiles)}
+	}
+	if certPath := config.DockerTLSCertPath(); certPath != "" {
+		return []string{certPath + ":" + certPath + readOnly}
+	}
+	return nil
+}
+
+// dockerEndpointEnvVars returns the environment variables pointing the Agent
+// at a Docker daemon listening on TCP, unless the agent config points it at a
+// daemon itself
+func dockerEndpointEnvVars(envVarsFromFiles map[string]string) map[string]string {
+	endpoint, err := config.DockerEndpoint()
+	if err != nil || !strings.HasPrefix(endpoint, config.TCPSocketPrefix) {
+		return nil
+	}
+	if _, ok := envVarsFromFiles[config.DockerHostEnvVar]; ok {
+		return nil
+	}
+	envVariables := map[string]string{config.DockerHostEnvVar: endpoint}
+	if certPath := config.DockerTLSCertPath(); certPath != "" {
+		envVariables[config.DockerTLSVerifyEnvVar] = "1"
+		envVariables[config.DockerCertPathEnvVar] = certPath
+	}
+	return envVariables
+}
+
 // getDockerPluginDirBinds returns the binds for Docker plugin directories.
 func getDockerPluginDirBinds() []string {
 	var pluginBinds []string
@@ -432,6 +893,146 @@ func nvidiaGPUDevicesPresent() bool {
 	return true
 }
 
+// nvidiaGPUDeviceMappings returns the mappings of the nvidia GPU device files
+// of the instance, such as /dev/nvidia0 and /dev/nvidiactl, into the Agent
+// container. Directories, such as /dev/nvidia-caps, are not devices.
+func nvidiaGPUDeviceMappings() []godocker.Device {
+	matches, err := MatchFilePatternForGPU(gpu.NvidiaGPUDeviceFilePattern)
+	if err != nil {
+		log.Errorf("Detecting Nvidia GPU devices failed")
+		return nil
+	}
+	var devices []godocker.Device
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			continue
+		}
+		devices = append(devices, godocker.Device{
+			PathOnHost:        match,
+			PathInContainer:   match,
+			CgroupPermissions: deviceCgroupPermissions,
+		})
+	}
+	return devices
+}
+
+// neuronDeviceMappings returns the mappings of the Neuron device files of the
+// instance, such as /dev/neuron0, into the Agent container
+func neuronDeviceMappings() []godocker.Device {
+	matches, err := NeuronDevices()
+	if err != nil {
+		log.Errorf("Detecting Neuron devices failed: %v", err)
+		return nil
+	}
+	var devices []godocker.Device
+	for _, match := range matches {
+		devices = append(devices, godocker.Device{
+			PathOnHost:        match,
+			PathInContainer:   match,
+			CgroupPermissions: deviceCgroupPermissions,
+		})
+	}
+	return devices
+}
+
+var NeuronDevices = neuron.Devices
+
+// efaDeviceMappings returns the mappings of the EFA device files of the
+// instance, such as /dev/infiniband/uverbs0, into the Agent container
+func efaDeviceMappings() []godocker.Device {
+	matches, err := EFADevices()
+	if err != nil {
+		log.Errorf("Detecting EFA devices failed: %v", err)
+		return nil
+	}
+	var devices []godocker.Device
+	for _, match := range matches {
+		devices = append(devices, godocker.Device{
+			PathOnHost:        match,
+			PathInContainer:   match,
+			CgroupPermissions: deviceCgroupPermissions,
+		})
+	}
+	return devices
+}
+
+var EFADevices = efa.Devices
+
+// CgroupHierarchy detects the cgroup hierarchy of the host, which decides how
+// the cgroups are mounted into the Agent container and whether it shares the
+// cgroup namespace of the host
+var CgroupHierarchy = cgroup.Detect
+
+var SELinuxMode = selinux.CurrentMode
+
+var AppArmorEnabled = apparmor.Enabled
+
+// selinuxLabeling returns how the mounts of the Agent container are labeled,
+// resolving the automatic labeling from the SELinux mode of the host
+func selinuxLabeling() string {
+	labeling, err := config.SELinuxLabeling()
+	if err != nil {
+		log.Warnf("Labeling the mounts of the Agent container automatically: %v", err)
+	}
+	if labeling != config.SELinuxLabelingAuto {
+		return labeling
+	}
+	mode, err := SELinuxMode()
+	if err != nil {
+		log.Warnf("Not labeling the mounts of the Agent container: %v", err)
+		return config.SELinuxLabelingOff
+	}
+	if mode != selinux.Enforcing {
+		return config.SELinuxLabelingOff
+	}
+	log.Infof("SELinux is enforcing, relabeling the directories mounted into the Agent container")
+	return config.SELinuxLabelingRelabel
+}
+
+// relabelBinds adds the SELinux relabeling option to the binds of the
+// directories of ecs-init, leaving the binds of host paths such as the Docker
+// socket or the cgroups, whose labels are not ecs-init's to change, alone.
+// The state of the Agent is private to its container, while the other
+// directories are read or written on the host as well.
+func relabelBinds(binds []string) []string {
+	labels := map[string]string{
+		config.AgentDataDirectory():      selinuxPrivateLabel,
+		config.LogDirectory():            selinuxSharedLabel,
+		config.AgentConfigDirectory():    selinuxSharedLabel,
+		config.CacheDirectory():          selinuxSharedLabel,
+		config.InstanceConfigDirectory(): selinuxSharedLabel,
+		ecsexec.HostDirectory:            selinuxSharedLabel,
+	}
+	relabeled := make([]string, 0, len(binds))
+	for _, bind := range binds {
+		parts := strings.Split(bind, ":")
+		label, ok := labels[parts[0]]
+		switch {
+		case !ok:
+		case len(parts) == 2:
+			bind += ":" + label
+		case len(parts) == 3:
+			bind += "," + label
+		}
+		relabeled = append(relabeled, bind)
+	}
+	return relabeled
+}
+
+// cgroupHierarchy returns the cgroup hierarchy of the host, assuming cgroup
+// v1 when it cannot be detected
+func cgroupHierarchy() cgroup.Hierarchy {
+	hierarchy, err := CgroupHierarchy()
+	if err != nil {
+		log.Warnf("Assuming cgroup v1: %v", err)
+		return cgroup.Legacy
+	}
+	log.Infof("Detected the %s cgroup hierarchy", hierarchy)
+	return hierarchy
+}
+
+var NeuronRuntimeSocketPresent = neuron.RuntimeSocketPresent
+
 var MatchFilePatternForGPU = FilePatternMatchForGPU
 
 func FilePatternMatchForGPU(pattern string) ([]string, error) {
@@ -439,8 +1040,8 @@ func FilePatternMatchForGPU(pattern string) ([]string, error) {
 }
 
 // StopAgent stops the Agent in docker if one is running
-func (c *Client) StopAgent() error {
-	id, err := c.findAgentContainer()
+func (c *Client) StopAgent(ctx context.Context) error {
+	id, err := c.findAgentContainer(ctx)
 	if err != nil {
 		return err
 	}
@@ -448,8 +1049,7 @@ func (c *Client) StopAgent() error {
 		log.Info("No running Agent to stop")
 		return nil
 	}
-	stopContainerTimeoutSeconds := uint(10)
-	err = c.docker.StopContainer(id, stopContainerTimeoutSeconds)
+	err = c.docker.StopContainerWithContext(id, uint(AgentStopTimeout.Seconds()), ctx)
 	if err != nil {
 		if _, ok := err.(*godocker.ContainerNotRunning); ok {
 			log.Info("Agent is already stopped")
@@ -14,15 +14,22 @@
 package docker
 
 import (
+	"context"
 	"errors"
 	"os"
 	"testing"
 
+	"github.com/aws/amazon-ecs-init/ecs-init/cgroup"
 	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/efa"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/apparmor"
 	"github.com/aws/amazon-ecs-init/ecs-init/gpu"
+	"github.com/aws/amazon-ecs-init/ecs-init/neuron"
+	"github.com/aws/amazon-ecs-init/ecs-init/selinux"
 	godocker "github.com/fsouza/go-dockerclient"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // expectedAgentBinds is the total number of agent host config binds.
@@ -41,12 +48,12 @@ func TestIsAgentImageLoadedListFailure(t *testing.T) {
 
 	mockDocker := NewMockdockerclient(mockCtrl)
 
-	mockDocker.EXPECT().ListImages(godocker.ListImagesOptions{All: true}).Return(nil, errors.New("test error"))
+	mockDocker.EXPECT().ListImages(godocker.ListImagesOptions{All: true, Context: context.Background()}).Return(nil, errors.New("test error"))
 
 	client := &Client{
 		docker: mockDocker,
 	}
-	loaded, err := client.IsAgentImageLoaded()
+	loaded, err := client.IsAgentImageLoaded(context.Background())
 	assert.Error(t, err, "error should be returned when list image fails")
 	assert.False(t, loaded, "IsImageLoaded should return false if list image fails")
 }
@@ -57,7 +64,7 @@ func TestIsAgentImageLoadedNoMatches(t *testing.T) {
 
 	mockDocker := NewMockdockerclient(mockCtrl)
 
-	mockDocker.EXPECT().ListImages(godocker.ListImagesOptions{All: true}).Return(
+	mockDocker.EXPECT().ListImages(godocker.ListImagesOptions{All: true, Context: context.Background()}).Return(
 		append(make([]godocker.APIImages, 0), godocker.APIImages{
 			RepoTags: append(make([]string, 0), ""),
 		}), nil)
@@ -65,7 +72,7 @@ func TestIsAgentImageLoadedNoMatches(t *testing.T) {
 	client := &Client{
 		docker: mockDocker,
 	}
-	loaded, err := client.IsAgentImageLoaded()
+	loaded, err := client.IsAgentImageLoaded(context.Background())
 	assert.NoError(t, err, "error should not be returned when no images match")
 	assert.False(t, loaded, "IsImageLoaded should return false if there are no matches")
 }
@@ -76,7 +83,7 @@ func TestIsImageLoadedMatches(t *testing.T) {
 
 	mockDocker := NewMockdockerclient(mockCtrl)
 
-	mockDocker.EXPECT().ListImages(godocker.ListImagesOptions{All: true}).Return(
+	mockDocker.EXPECT().ListImages(godocker.ListImagesOptions{All: true, Context: context.Background()}).Return(
 		append(make([]godocker.APIImages, 0), godocker.APIImages{
 			RepoTags: append(make([]string, 0), config.AgentImageName),
 		}), nil)
@@ -84,7 +91,7 @@ func TestIsImageLoadedMatches(t *testing.T) {
 	client := &Client{
 		docker: mockDocker,
 	}
-	loaded, err := client.IsAgentImageLoaded()
+	loaded, err := client.IsAgentImageLoaded(context.Background())
 	assert.NoError(t, err, "error should not be returned when image match is found")
 	assert.True(t, loaded, "IsImageLoaded should return true if there is a match")
 }
@@ -95,15 +102,174 @@ func TestLoadImage(t *testing.T) {
 
 	mockDocker := NewMockdockerclient(mockCtrl)
 
-	mockDocker.EXPECT().LoadImage(godocker.LoadImageOptions{})
+	mockDocker.EXPECT().LoadImage(godocker.LoadImageOptions{Context: context.Background()})
 
 	client := &Client{
 		docker: mockDocker,
 	}
-	err := client.LoadImage(nil)
+	err := client.LoadImage(context.Background(), nil)
 	assert.NoError(t, err, "no errors should be returned on load image with nil image")
 }
 
+func TestPullImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+
+	gomock.InOrder(
+		mockDocker.EXPECT().InspectImage(config.DefaultFirelensImage).Return(nil, godocker.ErrNoSuchImage),
+		mockDocker.EXPECT().PullImage(godocker.PullImageOptions{
+			Repository: "amazon/aws-for-fluent-bit",
+			Tag:        "latest",
+			Context:    context.Background(),
+		}, godocker.AuthConfiguration{}),
+	)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	err := client.PullImage(context.Background(), config.DefaultFirelensImage)
+	assert.NoError(t, err, "no errors should be returned on pull image")
+}
+
+func TestPullAgentImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	image := config.DefaultAgentRegistry + ":v1.36.0"
+	gomock.InOrder(
+		mockDocker.EXPECT().PullImage(godocker.PullImageOptions{
+			Repository: config.DefaultAgentRegistry,
+			Tag:        "v1.36.0",
+			Context:    context.Background(),
+		}, godocker.AuthConfiguration{}),
+		mockDocker.EXPECT().TagImage(image, godocker.TagImageOptions{
+			Repo:    config.AgentImageRepository,
+			Tag:     config.AgentImageTag,
+			Force:   true,
+			Context: context.Background(),
+		}),
+	)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	assert.NoError(t, client.PullAgentImage(context.Background(), image, RegistryAuth{}))
+}
+
+func TestPullAgentImageByDigest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	image := "123456789012.dkr.ecr.us-west-2.amazonaws.com/ecs-agent@sha256:abc"
+	auth := RegistryAuth{
+		Username:      "AWS",
+		Password:      "password",
+		ServerAddress: "https://123456789012.dkr.ecr.us-west-2.amazonaws.com",
+	}
+	gomock.InOrder(
+		mockDocker.EXPECT().PullImage(godocker.PullImageOptions{
+			Repository: image,
+			Context:    context.Background(),
+		}, godocker.AuthConfiguration{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ServerAddress: auth.ServerAddress,
+		}),
+		mockDocker.EXPECT().TagImage(image, gomock.Any()),
+	)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	assert.NoError(t, client.PullAgentImage(context.Background(), image, auth))
+}
+
+func TestPullAgentImageError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().PullImage(gomock.Any(), gomock.Any()).Return(errors.New("test error"))
+	mockDocker.EXPECT().TagImage(gomock.Any(), gomock.Any()).Times(0)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	assert.Error(t, client.PullAgentImage(context.Background(), config.DefaultAgentRegistry+":v1.36.0", RegistryAuth{}))
+}
+
+func TestPullImageAlreadyPresent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().InspectImage(config.DefaultFirelensImage).Return(&godocker.Image{ID: "sha256:present"}, nil)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	err := client.PullImage(context.Background(), config.DefaultFirelensImage)
+	assert.NoError(t, err, "no errors should be returned on pull image")
+}
+
+func TestPreloadImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+
+	gomock.InOrder(
+		mockDocker.EXPECT().InspectImage(config.AgentImageName).Return(&godocker.Image{ID: "sha256:current"}, nil),
+		mockDocker.EXPECT().LoadImage(godocker.LoadImageOptions{Context: context.Background()}),
+		mockDocker.EXPECT().TagImage(config.AgentImageName, godocker.TagImageOptions{
+			Repo:    config.AgentImageRepository,
+			Tag:     config.AgentStandbyImageTag,
+			Force:   true,
+			Context: context.Background(),
+		}),
+		mockDocker.EXPECT().TagImage("sha256:current", godocker.TagImageOptions{
+			Repo:    config.AgentImageRepository,
+			Tag:     config.AgentImageTag,
+			Force:   true,
+			Context: context.Background(),
+		}),
+	)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	err := client.PreloadImage(context.Background(), nil)
+	assert.NoError(t, err, "no errors should be returned on preload image")
+}
+
+func TestPreloadImageNoCurrentImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+
+	gomock.InOrder(
+		mockDocker.EXPECT().InspectImage(config.AgentImageName).Return(nil, godocker.ErrNoSuchImage),
+		mockDocker.EXPECT().LoadImage(godocker.LoadImageOptions{Context: context.Background()}),
+		mockDocker.EXPECT().TagImage(config.AgentImageName, godocker.TagImageOptions{
+			Repo:    config.AgentImageRepository,
+			Tag:     config.AgentStandbyImageTag,
+			Force:   true,
+			Context: context.Background(),
+		}),
+	)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	err := client.PreloadImage(context.Background(), nil)
+	assert.NoError(t, err, "no errors should be returned on preload image without a current image")
+}
+
 func TestRemoveExistingAgentContainerListContainersFailure(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -115,12 +281,13 @@ func TestRemoveExistingAgentContainerListContainersFailure(t *testing.T) {
 		Filters: map[string][]string{
 			"status": []string{},
 		},
+		Context: context.Background(),
 	}).Return(nil, errors.New("test error"))
 
 	client := &Client{
 		docker: mockDocker,
 	}
-	err := client.RemoveExistingAgentContainer()
+	err := client.RemoveExistingAgentContainer(context.Background())
 	if err == nil {
 		t.Error("Error should be returned")
 	}
@@ -137,12 +304,13 @@ func TestRemoveExistingAgentContainerNoneFound(t *testing.T) {
 		Filters: map[string][]string{
 			"status": []string{},
 		},
+		Context: context.Background(),
 	})
 
 	client := &Client{
 		docker: mockDocker,
 	}
-	err := client.RemoveExistingAgentContainer()
+	err := client.RemoveExistingAgentContainer(context.Background())
 	if err != nil {
 		t.Error("Error should not be returned")
 	}
@@ -159,6 +327,7 @@ func TestRemoveExistingAgentContainer(t *testing.T) {
 		Filters: map[string][]string{
 			"status": []string{},
 		},
+		Context: context.Background(),
 	}).Return([]godocker.APIContainers{
 		godocker.APIContainers{
 			Names: []string{"/" + config.AgentContainerName},
@@ -166,19 +335,194 @@ func TestRemoveExistingAgentContainer(t *testing.T) {
 		},
 	}, nil)
 	mockDocker.EXPECT().RemoveContainer(godocker.RemoveContainerOptions{
-		ID:    "id",
-		Force: true,
+		ID:      "id",
+		Force:   true,
+		Context: context.Background(),
 	})
 
 	client := &Client{
 		docker: mockDocker,
 	}
-	err := client.RemoveExistingAgentContainer()
+	err := client.RemoveExistingAgentContainer(context.Background())
 	if err != nil {
 		t.Error("Error should not be returned")
 	}
 }
 
+func TestPing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	gomock.InOrder(
+		mockDocker.EXPECT().PingWithContext(context.Background()).Return(nil),
+		mockDocker.EXPECT().PingWithContext(context.Background()).Return(errors.New("test error")),
+	)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	assert.NoError(t, client.Ping(context.Background()))
+	assert.Error(t, client.Ping(context.Background()))
+}
+
+func TestNewClientWithoutDaemon(t *testing.T) {
+	os.Setenv("DOCKER_HOST", "unix:///a/bad/docker.sock")
+	defer os.Unsetenv("DOCKER_HOST")
+
+	client, err := NewClient()
+	require.NoError(t, err, "Expect the client to be created while the daemon is down")
+	err = client.Ping(context.Background())
+	assert.True(t, errors.Is(err, ErrDockerUnavailable))
+	assert.Contains(t, err.Error(), "socket /a/bad/docker.sock does not exist")
+}
+
+func TestIsAgentRunning(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	gomock.InOrder(
+		mockDocker.EXPECT().ListContainers(godocker.ListContainersOptions{Context: context.Background()}).Return([]godocker.APIContainers{
+			{Names: []string{"/ecs-task-1-web"}},
+			{Names: []string{"/" + config.AgentContainerName}},
+		}, nil),
+		mockDocker.EXPECT().ListContainers(godocker.ListContainersOptions{Context: context.Background()}).Return([]godocker.APIContainers{
+			{Names: []string{"/ecs-task-1-web"}},
+		}, nil),
+	)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	running, err := client.IsAgentRunning(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, running)
+	running, err = client.IsAgentRunning(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, running)
+}
+
+func TestRunningAgentContainerID(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().ListContainers(godocker.ListContainersOptions{Context: context.Background()}).Return([]godocker.APIContainers{
+		{ID: "web", Names: []string{"/ecs-task-1-web"}},
+		{ID: "agent", Names: []string{"/" + config.AgentContainerName}},
+	}, nil)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	id, err := client.RunningAgentContainerID(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "agent", id)
+}
+
+func TestAgentHealth(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	gomock.InOrder(
+		mockDocker.EXPECT().InspectContainerWithContext(config.AgentContainerName, context.Background()).Return(&godocker.Container{
+			State: godocker.State{Running: true, Health: godocker.Health{Status: "unhealthy"}},
+		}, nil),
+		mockDocker.EXPECT().InspectContainerWithContext(config.AgentContainerName, context.Background()).Return(&godocker.Container{
+			State: godocker.State{Running: false},
+		}, nil),
+	)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	status, err := client.AgentHealth(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "unhealthy", status)
+	_, err = client.AgentHealth(context.Background())
+	assert.Equal(t, ErrAgentNotRunning, err)
+}
+
+func TestAgentLogPath(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	gomock.InOrder(
+		mockDocker.EXPECT().InspectContainerWithContext(config.AgentContainerName, context.Background()).Return(&godocker.Container{
+			LogPath: "/var/lib/docker/containers/id/id-json.log",
+		}, nil),
+		mockDocker.EXPECT().InspectContainerWithContext(config.AgentContainerName, context.Background()).Return(nil, errors.New("test error")),
+	)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	path, err := client.AgentLogPath(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/lib/docker/containers/id/id-json.log", path)
+	_, err = client.AgentLogPath(context.Background())
+	assert.Error(t, err)
+}
+
+func TestListTaskContainers(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+
+	mockDocker.EXPECT().ListContainers(godocker.ListContainersOptions{
+		All: true,
+		Filters: map[string][]string{
+			"label": []string{taskArnLabel},
+		},
+		Context: context.Background(),
+	}).Return([]godocker.APIContainers{
+		{
+			ID:     "running",
+			Names:  []string{"/ecs-task-1-web"},
+			State:  "running",
+			Labels: map[string]string{taskArnLabel: "task-1"},
+		},
+		{
+			ID:     "exited",
+			Names:  []string{"/ecs-task-2-web"},
+			State:  "exited",
+			Labels: map[string]string{taskArnLabel: "task-2"},
+		},
+	}, nil)
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	containers, err := client.ListTaskContainers(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []TaskContainer{
+		{ID: "running", Name: "ecs-task-1-web", TaskArn: "task-1", Running: true},
+		{ID: "exited", Name: "ecs-task-2-web", TaskArn: "task-2"},
+	}, containers)
+}
+
+func TestRemoveContainer(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().RemoveContainer(godocker.RemoveContainerOptions{
+		ID:            "id",
+		RemoveVolumes: true,
+		Force:         true,
+		Context:       context.Background(),
+	})
+
+	client := &Client{
+		docker: mockDocker,
+	}
+	assert.NoError(t, client.RemoveContainer(context.Background(), "id"))
+}
+
 func TestStartAgentNoEnvFile(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -195,15 +539,15 @@ func TestStartAgentNoEnvFile(t *testing.T) {
 	}).Return(&godocker.Container{
 		ID: containerID,
 	}, nil)
-	mockDocker.EXPECT().StartContainer(containerID, nil)
-	mockDocker.EXPECT().WaitContainer(containerID)
+	mockDocker.EXPECT().StartContainerWithContext(containerID, nil, context.Background())
+	mockDocker.EXPECT().WaitContainerWithContext(containerID, context.Background())
 
 	client := &Client{
 		docker: mockDocker,
 		fs:     mockFS,
 	}
 
-	_, err := client.StartAgent()
+	_, err := client.StartAgent(context.Background())
 	if err != nil {
 		t.Error("Error should not be returned")
 	}
@@ -332,15 +676,15 @@ func TestStartAgentEnvFile(t *testing.T) {
 	}).Return(&godocker.Container{
 		ID: containerID,
 	}, nil)
-	mockDocker.EXPECT().StartContainer(containerID, nil)
-	mockDocker.EXPECT().WaitContainer(containerID)
+	mockDocker.EXPECT().StartContainerWithContext(containerID, nil, context.Background())
+	mockDocker.EXPECT().WaitContainerWithContext(containerID, context.Background())
 
 	client := &Client{
 		docker: mockDocker,
 		fs:     mockFS,
 	}
 
-	_, err := client.StartAgent()
+	_, err := client.StartAgent(context.Background())
 	if err != nil {
 		t.Error("Error should not be returned")
 	}
@@ -376,6 +720,10 @@ func TestStartAgentWithGPUConfig(t *testing.T) {
 			}
 		}
 		assert.True(t, found)
+		assert.Equal(t, []godocker.Device{
+			{PathOnHost: "/dev/nvidia0", PathInContainer: "/dev/nvidia0", CgroupPermissions: "rwm"},
+			{PathOnHost: "/dev/nvidia1", PathInContainer: "/dev/nvidia1", CgroupPermissions: "rwm"},
+		}, opts.HostConfig.Devices)
 
 		cfg := opts.Config
 
@@ -386,15 +734,15 @@ func TestStartAgentWithGPUConfig(t *testing.T) {
 	}).Return(&godocker.Container{
 		ID: containerID,
 	}, nil)
-	mockDocker.EXPECT().StartContainer(containerID, nil)
-	mockDocker.EXPECT().WaitContainer(containerID)
+	mockDocker.EXPECT().StartContainerWithContext(containerID, nil, context.Background())
+	mockDocker.EXPECT().WaitContainerWithContext(containerID, context.Background())
 
 	client := &Client{
 		docker: mockDocker,
 		fs:     mockFS,
 	}
 
-	_, err := client.StartAgent()
+	_, err := client.StartAgent(context.Background())
 	assert.NoError(t, err)
 }
 
@@ -420,6 +768,7 @@ func TestStartAgentWithGPUConfigNoDevices(t *testing.T) {
 	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return(nil, errors.New("not found")).AnyTimes()
 	mockDocker.EXPECT().CreateContainer(gomock.Any()).Do(func(opts godocker.CreateContainerOptions) {
 		validateCommonCreateContainerOptions(opts, t)
+		assert.Empty(t, opts.HostConfig.Devices)
 		cfg := opts.Config
 
 		envVariables := make(map[string]struct{})
@@ -429,15 +778,15 @@ func TestStartAgentWithGPUConfigNoDevices(t *testing.T) {
 	}).Return(&godocker.Container{
 		ID: containerID,
 	}, nil)
-	mockDocker.EXPECT().StartContainer(containerID, nil)
-	mockDocker.EXPECT().WaitContainer(containerID)
+	mockDocker.EXPECT().StartContainerWithContext(containerID, nil, context.Background())
+	mockDocker.EXPECT().WaitContainerWithContext(containerID, context.Background())
 
 	client := &Client{
 		docker: mockDocker,
 		fs:     mockFS,
 	}
 
-	_, err := client.StartAgent()
+	_, err := client.StartAgent(context.Background())
 	assert.NoError(t, err)
 }
 
@@ -607,6 +956,7 @@ func TestStopAgent(t *testing.T) {
 				Filters: map[string][]string{
 					"status": {},
 				},
+				Context: context.Background(),
 			}
 			if tc.listEmpty || tc.listFailed {
 				listOutput = []godocker.APIContainers{{}}
@@ -633,13 +983,13 @@ func TestStopAgent(t *testing.T) {
 			}
 
 			if !tc.listEmpty && !tc.listFailed {
-				mockDocker.EXPECT().StopContainer("id", uint(10)).Return(stopErr)
+				mockDocker.EXPECT().StopContainerWithContext("id", uint(10), context.Background()).Return(stopErr)
 			}
 
 			if tc.listFailed || tc.stopFailedOther {
-				assert.Error(t, client.StopAgent())
+				assert.Error(t, client.StopAgent(context.Background()))
 			} else {
-				assert.NoError(t, client.StopAgent())
+				assert.NoError(t, client.StopAgent(context.Background()))
 			}
 		})
 	}
@@ -700,6 +1050,273 @@ func TestContainerLabelsBadData(t *testing.T) {
 	}
 }
 
+func TestGetHostConfigWithEBSTaskAttach(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found"))
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return([]byte("ECS_INIT_EBS_TASK_ATTACH=true\n"), nil)
+
+	client := &Client{
+		fs: mockFS,
+	}
+	hostConfig := client.getHostConfig(nil)
+	assert.Contains(t, hostConfig.Binds, "/dev:/dev")
+	assert.Contains(t, hostConfig.Binds, config.EBSMountDirectory()+":"+config.EBSMountDirectory()+":shared")
+}
+
+func TestGetHostConfigWithNeuronSupport(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	defer func() {
+		NeuronDevices = neuron.Devices
+		NeuronRuntimeSocketPresent = neuron.RuntimeSocketPresent
+	}()
+	NeuronDevices = func() ([]string, error) {
+		return []string{"/dev/neuron0", "/dev/neuron1"}, nil
+	}
+	NeuronRuntimeSocketPresent = func() bool {
+		return true
+	}
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found"))
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return([]byte("ECS_ENABLE_NEURON_SUPPORT=true\n"), nil)
+
+	client := &Client{
+		fs: mockFS,
+	}
+	hostConfig := client.getHostConfig(nil)
+	assert.Contains(t, hostConfig.Binds, "/run/neuron.sock:/run/neuron.sock")
+	assert.Equal(t, []godocker.Device{
+		{PathOnHost: "/dev/neuron0", PathInContainer: "/dev/neuron0", CgroupPermissions: "rwm"},
+		{PathOnHost: "/dev/neuron1", PathInContainer: "/dev/neuron1", CgroupPermissions: "rwm"},
+	}, hostConfig.Devices)
+}
+
+func TestGetHostConfigWithEFASupport(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	defer func() {
+		EFADevices = efa.Devices
+	}()
+	EFADevices = func() ([]string, error) {
+		return []string{"/dev/infiniband/uverbs0"}, nil
+	}
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found"))
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return([]byte("ECS_ENABLE_EFA_SUPPORT=true\n"), nil)
+
+	client := &Client{
+		fs: mockFS,
+	}
+	hostConfig := client.getHostConfig(nil)
+	assert.Equal(t, []godocker.Device{
+		{PathOnHost: "/dev/infiniband/uverbs0", PathInContainer: "/dev/infiniband/uverbs0", CgroupPermissions: "rwm"},
+	}, hostConfig.Devices)
+	assert.Contains(t, hostConfig.CapAdd, "IPC_LOCK")
+	assert.Equal(t, []godocker.ULimit{{Name: "memlock", Soft: -1, Hard: -1}}, hostConfig.Ulimits)
+}
+
+func TestGetHostConfigUnifiedCgroupHierarchy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	defer func() {
+		CgroupHierarchy = cgroup.Detect
+	}()
+	CgroupHierarchy = func() (cgroup.Hierarchy, error) {
+		return cgroup.Unified, nil
+	}
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found"))
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return(nil, errors.New("not found"))
+
+	client := &Client{
+		fs: mockFS,
+	}
+	hostConfig := client.getHostConfig(nil)
+	assert.Contains(t, hostConfig.Binds, "/sys/fs/cgroup:/sys/fs/cgroup")
+	assert.Equal(t, "host", hostConfig.CgroupnsMode)
+}
+
+func TestGetHostConfigLegacyCgroupHierarchy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	defer func() {
+		CgroupHierarchy = cgroup.Detect
+	}()
+	CgroupHierarchy = func() (cgroup.Hierarchy, error) {
+		return cgroup.Legacy, errors.New("permission denied")
+	}
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found"))
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return(nil, errors.New("not found"))
+
+	client := &Client{
+		fs: mockFS,
+	}
+	hostConfig := client.getHostConfig(nil)
+	assert.Contains(t, hostConfig.Binds, config.CgroupMountpoint()+":/sys/fs/cgroup")
+	assert.Empty(t, hostConfig.CgroupnsMode)
+}
+
+func TestGetHostConfigSELinuxEnforcing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	defer func() {
+		SELinuxMode = selinux.CurrentMode
+	}()
+	SELinuxMode = func() (selinux.Mode, error) {
+		return selinux.Enforcing, nil
+	}
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found"))
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return(nil, errors.New("not found"))
+
+	client := &Client{
+		fs: mockFS,
+	}
+	hostConfig := client.getHostConfig(nil)
+	assert.Contains(t, hostConfig.Binds, config.AgentDataDirectory()+":/data:Z")
+	assert.Contains(t, hostConfig.Binds, config.LogDirectory()+":/log:z")
+	assert.Contains(t, hostConfig.Binds, config.CacheDirectory()+":"+config.CacheDirectory()+":z")
+	assert.Contains(t, hostConfig.Binds, "/var/run:/var/run", "Expect the Docker socket not to be relabeled")
+	assert.Empty(t, hostConfig.SecurityOpt)
+}
+
+func TestGetHostConfigSELinuxLabelDisable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.SELinuxLabelingEnvVar, "disable")
+	defer os.Unsetenv(config.SELinuxLabelingEnvVar)
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found"))
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return(nil, errors.New("not found"))
+
+	client := &Client{
+		fs: mockFS,
+	}
+	hostConfig := client.getHostConfig(nil)
+	assert.Equal(t, []string{"label=disable"}, hostConfig.SecurityOpt)
+	assert.Contains(t, hostConfig.Binds, config.AgentDataDirectory()+":/data")
+}
+
+func TestGetHostConfigAppArmor(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	defer func() {
+		AppArmorEnabled = apparmor.Enabled
+	}()
+	AppArmorEnabled = func() bool {
+		return true
+	}
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found")).Times(2)
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return(nil, errors.New("not found")).Times(2)
+
+	client := &Client{
+		fs: mockFS,
+	}
+	hostConfig := client.getHostConfig(nil)
+	assert.Equal(t, []string{"apparmor=ecs-agent-default"}, hostConfig.SecurityOpt)
+
+	os.Setenv(config.AppArmorProfileEnvVar, "unconfined")
+	defer os.Unsetenv(config.AppArmorProfileEnvVar)
+	hostConfig = client.getHostConfig(nil)
+	assert.Equal(t, []string{"apparmor=unconfined"}, hostConfig.SecurityOpt)
+}
+
+func TestGetHostConfigResourceLimits(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found"))
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return([]byte(
+		"ECS_AGENT_CPU_LIMIT=0.5\nECS_AGENT_MEMORY_LIMIT=256\nECS_AGENT_PIDS_LIMIT=1024\n"), nil)
+
+	client := &Client{
+		fs: mockFS,
+	}
+	hostConfig := client.getHostConfig(nil)
+	assert.Equal(t, int64(100000), hostConfig.CPUPeriod)
+	assert.Equal(t, int64(50000), hostConfig.CPUQuota)
+	assert.Equal(t, int64(256*1024*1024), hostConfig.Memory)
+	pidsLimit := int64(1024)
+	assert.Equal(t, &pidsLimit, hostConfig.PidsLimit)
+}
+
+func TestGetHostConfigReservedSystemMemory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found"))
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return([]byte(
+		config.ReservedSystemMemoryEnvVar+"=512\n"), nil)
+
+	client := &Client{
+		fs: mockFS,
+	}
+	hostConfig := client.getHostConfig(nil)
+	assert.Equal(t, "system.slice", hostConfig.CgroupParent)
+}
+
+func TestSetResourceLimitsInvalid(t *testing.T) {
+	for _, envVariables := range []map[string]string{
+		{config.AgentCPULimitEnvVar: "half"},
+		{config.AgentCPULimitEnvVar: "0"},
+		{config.AgentMemoryLimitEnvVar: "256MiB"},
+		{config.AgentMemoryLimitEnvVar: "4"},
+		{config.AgentPidsLimitEnvVar: "-1"},
+	} {
+		hostConfig := &godocker.HostConfig{}
+		setResourceLimits(hostConfig, envVariables)
+		assert.Equal(t, &godocker.HostConfig{}, hostConfig, "Expect %v not to be applied", envVariables)
+	}
+}
+
+func TestRelabelBinds(t *testing.T) {
+	assert.Equal(t, []string{
+		config.AgentDataDirectory() + ":/data:Z",
+		config.InstanceConfigDirectory() + ":" + config.InstanceConfigDirectory() + ":ro,z",
+		"/etc/pki:/etc/pki:ro",
+	}, relabelBinds([]string{
+		config.AgentDataDirectory() + ":/data",
+		config.InstanceConfigDirectory() + ":" + config.InstanceConfigDirectory() + ":ro",
+		"/etc/pki:/etc/pki:ro",
+	}))
+}
+
+func TestGetHostConfigWithExecPrerequisites(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found"))
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return([]byte("ECS_INIT_PREPARE_EXEC=true\n"), nil)
+
+	client := &Client{
+		fs: mockFS,
+	}
+	hostConfig := client.getHostConfig(nil)
+	assert.Contains(t, hostConfig.Binds, "/var/lib/ecs/deps/execute-command:/managed-agents/execute-command")
+}
+
 func TestGetDockerSocketBind(t *testing.T) {
 	testCases := []struct {
 		name                     string
@@ -0,0 +1,83 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	godocker "github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// tlsCAFile, tlsCertFile and tlsKeyFile are the files of the TLS
+	// certificates in the certificate directory, named as the Docker CLI
+	// names them
+	tlsCAFile   = "ca.pem"
+	tlsCertFile = "cert.pem"
+	tlsKeyFile  = "key.pem"
+)
+
+// diagnoseEndpoint explains why the Docker daemon at endpoint could not be
+// reached, given the error of the last attempt, or returns an empty string
+// when the cause is not known
+func diagnoseEndpoint(endpoint string, err error) string {
+	if strings.HasPrefix(endpoint, config.UnixSocketPrefix) {
+		socket := strings.TrimPrefix(endpoint, config.UnixSocketPrefix)
+		info, statErr := os.Stat(socket)
+		switch {
+		case os.IsNotExist(statErr):
+			return fmt.Sprintf("socket %s does not exist, check that the daemon is running and that %s names its socket",
+				socket, config.DockerHostEnvVar)
+		case statErr == nil && info.Mode()&os.ModeSocket == 0:
+			return fmt.Sprintf("%s is not a socket", socket)
+		}
+	}
+	var apiErr *godocker.Error
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordHeaderErr tls.RecordHeaderError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.EACCES):
+		return fmt.Sprintf("permission denied connecting to %s, the socket of a rootless daemon must be accessible to root",
+			endpoint)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Sprintf("connection to %s refused, the daemon is not running or listens elsewhere", endpoint)
+	case errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr):
+		return fmt.Sprintf("the certificate of the daemon could not be verified with %s in %s",
+			tlsCAFile, config.DockerTLSCertPath())
+	case errors.As(err, &recordHeaderErr):
+		return fmt.Sprintf("the daemon does not use TLS, unset %s", config.DockerTLSVerifyEnvVar)
+	case errors.As(err, &apiErr):
+		if apiErr.Status == http.StatusBadRequest && strings.HasPrefix(endpoint, config.TCPSocketPrefix) &&
+			config.DockerTLSCertPath() == "" {
+			// the daemon answers plain HTTP requests with a bad request
+			return fmt.Sprintf("the daemon expects TLS, set %s and %s", config.DockerTLSVerifyEnvVar, config.DockerCertPathEnvVar)
+		}
+		return fmt.Sprintf("the daemon answered with status %d, check that it provides the Docker API", apiErr.Status)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Sprintf("%s did not answer in time, check the address and the firewall", endpoint)
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	godocker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnoseEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	notSocket := filepath.Join(dir, "docker.sock")
+	require.NoError(t, ioutil.WriteFile(notSocket, nil, 0644))
+
+	dialErr := func(errno syscall.Errno) error {
+		return &url.Error{Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)}}
+	}
+	testCases := []struct {
+		name      string
+		endpoint  string
+		err       error
+		diagnosis string
+	}{
+		{"missing socket", "unix://" + filepath.Join(dir, "missing.sock"), errors.New("dial"), "does not exist"},
+		{"not a socket", "unix://" + notSocket, errors.New("dial"), "is not a socket"},
+		{"permission denied", "tcp://127.0.0.1:2375", dialErr(syscall.EACCES), "permission denied"},
+		{"refused", "tcp://127.0.0.1:2375", dialErr(syscall.ECONNREFUSED), "refused"},
+		{"plain HTTP to TLS", "tcp://127.0.0.1:2376", &godocker.Error{Status: http.StatusBadRequest}, "expects TLS"},
+		{"TLS to plain HTTP", "tcp://127.0.0.1:2375", &url.Error{Err: tls.RecordHeaderError{}}, "does not use TLS"},
+		{"API error", "tcp://127.0.0.1:2375", &godocker.Error{Status: http.StatusNotFound}, "status 404"},
+		{"unknown", "tcp://127.0.0.1:2375", errors.New("unknown"), ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			diagnosis := diagnoseEndpoint(tc.endpoint, tc.err)
+			if tc.diagnosis == "" {
+				assert.Empty(t, diagnosis)
+			} else {
+				assert.Contains(t, diagnosis, tc.diagnosis)
+			}
+		})
+	}
+}
+
+func TestDockerEndpointOverTCP(t *testing.T) {
+	os.Setenv("DOCKER_HOST", "tcp://127.0.0.1:2376")
+	defer os.Unsetenv("DOCKER_HOST")
+	os.Setenv("DOCKER_TLS_VERIFY", "1")
+	defer os.Unsetenv("DOCKER_TLS_VERIFY")
+	os.Setenv("DOCKER_CERT_PATH", "/etc/ecs/docker")
+	defer os.Unsetenv("DOCKER_CERT_PATH")
+
+	assert.Equal(t, []string{"/etc/ecs/docker:/etc/ecs/docker:ro"}, getDockerEndpointBinds(nil))
+	assert.Equal(t, map[string]string{
+		"DOCKER_HOST":       "tcp://127.0.0.1:2376",
+		"DOCKER_TLS_VERIFY": "1",
+		"DOCKER_CERT_PATH":  "/etc/ecs/docker",
+	}, dockerEndpointEnvVars(nil))
+	assert.Empty(t, dockerEndpointEnvVars(map[string]string{"DOCKER_HOST": "tcp://10.0.0.1:2376"}))
+}
+
+func TestDockerEndpointOverUnixSocket(t *testing.T) {
+	os.Setenv("DOCKER_HOST", "/run/podman/podman.sock")
+	defer os.Unsetenv("DOCKER_HOST")
+
+	assert.Equal(t, []string{"/run/podman/podman.sock:/var/run/docker.sock"}, getDockerEndpointBinds(nil))
+	assert.Empty(t, dockerEndpointEnvVars(nil))
+}
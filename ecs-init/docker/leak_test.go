@@ -0,0 +1,92 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const daemonRestarts = 20
+
+// startTestDaemon serves the Docker API calls of the supervision loop on
+// socket: version checks, pings, and waits on the Agent container that last
+// until the daemon stops. waiting receives a value once a wait is blocked.
+func startTestDaemon(t *testing.T, socket string, waiting chan<- struct{}) *httptest.Server {
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_ping"):
+			w.Write([]byte("OK"))
+		case strings.HasSuffix(r.URL.Path, "/version"):
+			w.Write([]byte(`{"ApiVersion":"` + cgroupnsClientAPIVersion + `"}`))
+		case strings.HasSuffix(r.URL.Path, "/wait"):
+			waiting <- struct{}{}
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	server.Listener = listener
+	server.Start()
+	return server
+}
+
+func TestDaemonRestartsDoNotLeakGoroutines(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	godockerClient, err := godockerClientFactory{}.NewVersionedClient("unix://"+socket, dockerClientAPIVersion)
+	require.NoError(t, err)
+	client := &_dockerclient{docker: godockerClient}
+
+	// the daemon restarts while the Agent runs, and the engine keeps using
+	// the same client against the new daemon
+	restartDaemon := func() {
+		waiting := make(chan struct{})
+		server := startTestDaemon(t, socket, waiting)
+		require.NoError(t, client.PingWithContext(context.Background()))
+		exited := make(chan error)
+		go func() {
+			_, err := client.WaitContainerWithContext("ecs-agent", context.Background())
+			exited <- err
+		}()
+		<-waiting
+		server.CloseClientConnections()
+		server.Close()
+		assert.Error(t, <-exited, "Expect the wait to fail when the daemon stops")
+	}
+
+	restartDaemon()
+	before := runtime.NumGoroutine()
+	for i := 0; i < daemonRestarts; i++ {
+		restartDaemon()
+	}
+	// allow the goroutines of closed connections to exit
+	after := runtime.NumGoroutine()
+	for retries := 0; after > before && retries < 10; retries++ {
+		time.Sleep(10 * time.Millisecond)
+		after = runtime.NumGoroutine()
+	}
+	assert.True(t, after <= before, "Expect no goroutines to leak across daemon restarts, had %d, now %d", before, after)
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"context"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	godocker "github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// bridgeDriver is the Docker network driver of the bridge of the Agent
+	bridgeDriver = "bridge"
+	// bridgeNameOption names the interface of a bridge network on the host
+	bridgeNameOption = "com.docker.network.bridge.name"
+	// loopbackAddress is the address of the host the ports of the Agent are
+	// published on, so that they are only reachable from the host, as they
+	// are when the Agent runs on the network of the host
+	loopbackAddress = "127.0.0.1"
+)
+
+// agentPorts are the ports of the introspection and credentials endpoints
+// of the Agent, which ecs-init and the netfilter rules of the credentials
+// endpoint reach on the loopback address of the host
+var agentPorts = []godocker.Port{"51678/tcp", "51679/tcp"}
+
+// agentNetwork returns the network the Agent container runs on, logging an
+// invalid setting
+func agentNetwork() string {
+	network, err := config.AgentNetwork()
+	if err != nil {
+		log.Warnf("Running the Agent on the %s network: %v", network, err)
+	}
+	return network
+}
+
+// TaskENIEnabled returns if the Agent configured with envVarsFromFiles runs
+// tasks in the awsvpc network mode, as set in the agent config or by default
+// on the platform
+func TaskENIEnabled(envVarsFromFiles map[string]string) bool {
+	enabled, ok := envVarsFromFiles[config.TaskENIEnvVar]
+	if !ok {
+		enabled = getPlatformSpecificEnvVariables()[config.TaskENIEnvVar]
+	}
+	return enabled == "true"
+}
+
+// setAgentNetwork runs the Agent container on its bridge instead of the
+// network of the host, publishing the ports of the Agent on the loopback
+// address of the host
+func setAgentNetwork(cfg *godocker.Config, hostConfig *godocker.HostConfig) {
+	cfg.ExposedPorts = make(map[godocker.Port]struct{})
+	hostConfig.NetworkMode = config.AgentBridgeNetwork
+	hostConfig.PortBindings = make(map[godocker.Port][]godocker.PortBinding)
+	for _, port := range agentPorts {
+		cfg.ExposedPorts[port] = struct{}{}
+		hostConfig.PortBindings[port] = []godocker.PortBinding{{HostIP: loopbackAddress, HostPort: port.Port()}}
+	}
+}
+
+// ensureAgentNetwork creates the bridge of the Agent unless it exists
+func (c *Client) ensureAgentNetwork(ctx context.Context) error {
+	_, err := c.docker.NetworkInfo(config.AgentBridgeNetwork)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*godocker.NoSuchNetwork); !ok {
+		return err
+	}
+	log.Infof("Creating the %s network of the Agent on bridge %s", config.AgentBridgeNetwork, config.AgentBridgeInterface)
+	_, err = c.docker.CreateNetwork(godocker.CreateNetworkOptions{
+		Name:           config.AgentBridgeNetwork,
+		Driver:         bridgeDriver,
+		Options:        map[string]interface{}{bridgeNameOption: config.AgentBridgeInterface},
+		CheckDuplicate: true,
+		Context:        ctx,
+	})
+	if err == godocker.ErrNetworkAlreadyExists {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	godocker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetAgentNetwork(t *testing.T) {
+	cfg := &godocker.Config{}
+	hostConfig := &godocker.HostConfig{NetworkMode: networkMode}
+	setAgentNetwork(cfg, hostConfig)
+
+	assert.Equal(t, config.AgentBridgeNetwork, hostConfig.NetworkMode)
+	assert.Contains(t, cfg.ExposedPorts, godocker.Port("51679/tcp"))
+	assert.Equal(t, []godocker.PortBinding{{HostIP: "127.0.0.1", HostPort: "51678"}},
+		hostConfig.PortBindings["51678/tcp"])
+}
+
+func TestTaskENIEnabled(t *testing.T) {
+	assert.Equal(t, getPlatformSpecificEnvVariables()[config.TaskENIEnvVar] == "true",
+		TaskENIEnabled(map[string]string{}))
+	assert.True(t, TaskENIEnabled(map[string]string{config.TaskENIEnvVar: "true"}))
+	assert.False(t, TaskENIEnabled(map[string]string{config.TaskENIEnvVar: "false"}))
+}
+
+func TestEnsureAgentNetworkExists(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().NetworkInfo(config.AgentBridgeNetwork).Return(&godocker.Network{}, nil)
+
+	client := &Client{docker: mockDocker}
+	assert.NoError(t, client.ensureAgentNetwork(context.Background()))
+}
+
+func TestEnsureAgentNetworkCreates(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	gomock.InOrder(
+		mockDocker.EXPECT().NetworkInfo(config.AgentBridgeNetwork).Return(nil, &godocker.NoSuchNetwork{ID: config.AgentBridgeNetwork}),
+		mockDocker.EXPECT().CreateNetwork(gomock.Any()).Do(func(opts godocker.CreateNetworkOptions) {
+			assert.Equal(t, config.AgentBridgeNetwork, opts.Name)
+			assert.Equal(t, config.AgentBridgeInterface, opts.Options[bridgeNameOption])
+		}).Return(&godocker.Network{}, nil),
+	)
+
+	client := &Client{docker: mockDocker}
+	assert.NoError(t, client.ensureAgentNetwork(context.Background()))
+}
+
+func TestEnsureAgentNetworkError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().NetworkInfo(config.AgentBridgeNetwork).Return(nil, errors.New("test error"))
+
+	client := &Client{docker: mockDocker}
+	assert.Error(t, client.ensureAgentNetwork(context.Background()))
+}
@@ -0,0 +1,68 @@
+// Copyright 2015-2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	godocker "github.com/fsouza/go-dockerclient"
+)
+
+// ExpectedPauseImage returns the pause container image the Agent image
+// loaded into Docker expects, as named by its label, or the default pause
+// container image when the Agent image does not name one
+func (c *Client) ExpectedPauseImage(ctx context.Context) (string, error) {
+	image, err := c.docker.InspectImage(config.AgentImageName)
+	if err != nil {
+		return "", err
+	}
+	if image.Config != nil {
+		if name := image.Config.Labels[config.PauseImageLabel]; name != "" {
+			return name, nil
+		}
+	}
+	return config.PauseImageRepository + ":" + config.DefaultPauseImageTag, nil
+}
+
+// LoadedPauseImages returns the pause container images loaded into Docker,
+// sorted
+func (c *Client) LoadedPauseImages(ctx context.Context) ([]string, error) {
+	images, err := c.docker.ListImages(godocker.ListImagesOptions{
+		Filters: map[string][]string{"reference": {config.PauseImageRepository}},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var loaded []string
+	for _, image := range images {
+		for _, repoTag := range image.RepoTags {
+			if strings.HasPrefix(repoTag, config.PauseImageRepository+":") {
+				loaded = append(loaded, repoTag)
+			}
+		}
+	}
+	sort.Strings(loaded)
+	return loaded, nil
+}
+
+// RemoveImage removes the image with the given name from Docker, unless
+// containers use it
+func (c *Client) RemoveImage(ctx context.Context, name string) error {
+	return c.docker.RemoveImageExtended(name, godocker.RemoveImageOptions{Context: ctx})
+}
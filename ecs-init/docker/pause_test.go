@@ -0,0 +1,96 @@
+// Copyright 2015-2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	godocker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectedPauseImageFromLabel(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().InspectImage(config.AgentImageName).Return(&godocker.Image{
+		Config: &godocker.Config{Labels: map[string]string{
+			config.PauseImageLabel: "amazon/amazon-ecs-pause:0.2.0",
+		}},
+	}, nil)
+
+	client := &Client{docker: mockDocker}
+	expected, err := client.ExpectedPauseImage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "amazon/amazon-ecs-pause:0.2.0", expected)
+}
+
+func TestExpectedPauseImageDefault(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().InspectImage(config.AgentImageName).Return(&godocker.Image{Config: &godocker.Config{}}, nil)
+
+	client := &Client{docker: mockDocker}
+	expected, err := client.ExpectedPauseImage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "amazon/amazon-ecs-pause:0.1.0", expected)
+}
+
+func TestExpectedPauseImageNoAgentImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().InspectImage(config.AgentImageName).Return(nil, godocker.ErrNoSuchImage)
+
+	client := &Client{docker: mockDocker}
+	_, err := client.ExpectedPauseImage(context.Background())
+	assert.Equal(t, godocker.ErrNoSuchImage, err)
+}
+
+func TestLoadedPauseImages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().ListImages(gomock.Any()).Return([]godocker.APIImages{
+		{RepoTags: []string{"amazon/amazon-ecs-pause:0.2.0"}},
+		{RepoTags: []string{"amazon/amazon-ecs-pause:0.1.0", "amazon/amazon-ecs-pause-extra:1"}},
+	}, nil)
+
+	client := &Client{docker: mockDocker}
+	loaded, err := client.LoadedPauseImages(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"amazon/amazon-ecs-pause:0.1.0", "amazon/amazon-ecs-pause:0.2.0"}, loaded)
+}
+
+func TestRemoveImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerclient(mockCtrl)
+	mockDocker.EXPECT().RemoveImageExtended("amazon/amazon-ecs-pause:0.1.0", gomock.Any()).Return(errors.New("in use"))
+
+	client := &Client{docker: mockDocker}
+	assert.Error(t, client.RemoveImage(context.Background(), "amazon/amazon-ecs-pause:0.1.0"))
+}
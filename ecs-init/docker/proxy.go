@@ -0,0 +1,77 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+// proxyEnvVarNames are the proxy settings shared by ecs-init and the Agent
+var proxyEnvVarNames = []string{config.HTTPProxyEnvVar, config.HTTPSProxyEnvVar, config.NoProxyEnvVar}
+
+// ApplyProxyConfig sets the proxy settings of the agent config files in the
+// environment of ecs-init, so that the Agent is downloaded through the proxy
+// the Agent uses. It has to be called before any request is made, as the
+// proxy settings of the environment are only read once.
+func ApplyProxyConfig() {
+	c := &Client{fs: standardFS}
+	fromFiles := c.loadCustomInstanceEnvVars()
+	for key, value := range c.loadUsrEnvVars() {
+		fromFiles[key] = value
+	}
+	for key, value := range proxyEnvVars(fromFiles) {
+		if os.Getenv(key) != value {
+			log.Infof("Using %s=%s", key, value)
+			os.Setenv(key, value)
+		}
+	}
+}
+
+// proxyEnvVars returns the proxy settings of the agent config files, which
+// take precedence over the settings of the environment of ecs-init. The
+// instance metadata endpoints and the Docker socket are not proxied unless
+// exclusions are set.
+func proxyEnvVars(fromFiles map[string]string) map[string]string {
+	proxy := make(map[string]string)
+	for _, name := range proxyEnvVarNames {
+		if value, ok := fromFiles[name]; ok {
+			proxy[name] = value
+		} else if value := getenvAnyCase(name); value != "" {
+			proxy[name] = value
+		}
+	}
+	if proxy[config.NoProxyEnvVar] == "" && (proxy[config.HTTPProxyEnvVar] != "" || proxy[config.HTTPSProxyEnvVar] != "") {
+		proxy[config.NoProxyEnvVar] = config.DefaultNoProxy
+	}
+	for name, value := range proxy {
+		if value == "" {
+			delete(proxy, name)
+		}
+	}
+	return proxy
+}
+
+// getenvAnyCase returns the environment variable name, or else its lower
+// case variant as honored by Go and curl
+func getenvAnyCase(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return os.Getenv(strings.ToLower(name))
+}
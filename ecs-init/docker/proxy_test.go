@@ -0,0 +1,96 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setProxyEnv sets the proxy settings of the environment, clearing the
+// others, and returns a function restoring the environment
+func setProxyEnv(t *testing.T, env map[string]string) {
+	for _, name := range proxyEnvVarNames {
+		for _, variant := range []string{name, strings.ToLower(name)} {
+			// t.Setenv restores the variable after the test, unset it for this one
+			t.Setenv(variant, "")
+			os.Unsetenv(variant)
+		}
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+}
+
+func TestProxyEnvVars(t *testing.T) {
+	cases := []struct {
+		name      string
+		env       map[string]string
+		fromFiles map[string]string
+		expected  map[string]string
+	}{
+		{
+			name:     "no proxy",
+			expected: map[string]string{},
+		},
+		{
+			name:      "agent config files",
+			fromFiles: map[string]string{"HTTPS_PROXY": "http://proxy:3128", "NO_PROXY": "169.254.169.254"},
+			expected:  map[string]string{"HTTPS_PROXY": "http://proxy:3128", "NO_PROXY": "169.254.169.254"},
+		},
+		{
+			name:      "agent config files take precedence",
+			env:       map[string]string{"HTTP_PROXY": "http://env:3128", "NO_PROXY": "example.com"},
+			fromFiles: map[string]string{"HTTP_PROXY": "http://proxy:3128"},
+			expected:  map[string]string{"HTTP_PROXY": "http://proxy:3128", "NO_PROXY": "example.com"},
+		},
+		{
+			name:     "lower case environment",
+			env:      map[string]string{"https_proxy": "http://env:3128"},
+			expected: map[string]string{"HTTPS_PROXY": "http://env:3128", "NO_PROXY": config.DefaultNoProxy},
+		},
+		{
+			name:      "proxy unset in the agent config files",
+			env:       map[string]string{"HTTP_PROXY": "http://env:3128"},
+			fromFiles: map[string]string{"HTTP_PROXY": ""},
+			expected:  map[string]string{},
+		},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			setProxyEnv(t, test.env)
+			assert.Equal(t, test.expected, proxyEnvVars(test.fromFiles))
+		})
+	}
+}
+
+func TestGetContainerConfigWithProxyFromEnvironment(t *testing.T) {
+	setProxyEnv(t, map[string]string{"HTTP_PROXY": "http://env:3128"})
+
+	client := &Client{}
+	cfg := client.getContainerConfig(map[string]string{"HTTPS_PROXY": "http://proxy:3128"})
+
+	envVariables := make(map[string]struct{})
+	for _, envVar := range cfg.Env {
+		envVariables[envVar] = struct{}{}
+	}
+	expectKey("HTTP_PROXY=http://env:3128", envVariables, t)
+	expectKey("HTTPS_PROXY=http://proxy:3128", envVariables, t)
+	expectKey("NO_PROXY="+config.DefaultNoProxy, envVariables, t)
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+// tailBuffer is an io.Writer that keeps only the last maxSize bytes written
+// to it
+type tailBuffer struct {
+	maxSize int
+	buf     []byte
+}
+
+func newTailBuffer(maxSize int) *tailBuffer {
+	return &tailBuffer{maxSize: maxSize}
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if n >= b.maxSize {
+		b.buf = append(b.buf[:0], p[n-b.maxSize:]...)
+		return n, nil
+	}
+	if overflow := len(b.buf) + n - b.maxSize; overflow > 0 {
+		b.buf = append(b.buf[:0], b.buf[overflow:]...)
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.buf)
+}
@@ -0,0 +1,45 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTailBuffer(t *testing.T) {
+	testcases := []struct {
+		name     string
+		writes   []string
+		expected string
+	}{
+		{name: "under limit", writes: []string{"ab", "cd"}, expected: "abcd"},
+		{name: "at limit", writes: []string{"abc", "def"}, expected: "abcdef"},
+		{name: "over limit", writes: []string{"abcd", "efgh"}, expected: "cdefgh"},
+		{name: "single write over limit", writes: []string{"abcdefghij"}, expected: "efghij"},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			buf := newTailBuffer(6)
+			for _, write := range test.writes {
+				n, err := buf.Write([]byte(write))
+				assert.NoError(t, err)
+				assert.Equal(t, len(write), n)
+			}
+			assert.Equal(t, test.expected, buf.String())
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/imds"
+
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	log "github.com/cihub/seelog"
+)
+
+// templatePattern matches the placeholders of instance facts in the values
+// of the agent config, e.g. {{instance_id}}
+var templatePattern = regexp.MustCompile(`\{\{\s*([a-z_]+)\s*\}\}`)
+
+var instanceIdentityDocument = func() (ec2metadata.EC2InstanceIdentityDocument, error) {
+	return imds.Shared().GetInstanceIdentityDocument()
+}
+
+// instanceFacts returns the facts of the instance placeholders are replaced
+// with, by name
+func instanceFacts(document ec2metadata.EC2InstanceIdentityDocument) map[string]string {
+	return map[string]string{
+		"instance_id":       document.InstanceID,
+		"instance_type":     document.InstanceType,
+		"availability_zone": document.AvailabilityZone,
+		"region":            document.Region,
+		"account_id":        document.AccountID,
+		"private_ip":        document.PrivateIP,
+		"image_id":          document.ImageID,
+	}
+}
+
+// expandTemplates replaces the placeholders of instance facts in the values
+// of envVariables, so that e.g. cluster names and instance attributes can
+// name the instance without user data scripts. The instance metadata service
+// is only queried when a value holds a placeholder. Unknown placeholders, and
+// every placeholder when the facts cannot be read, are left as they are.
+func expandTemplates(envVariables map[string]string) {
+	var templated []string
+	for key, value := range envVariables {
+		if templatePattern.MatchString(value) {
+			templated = append(templated, key)
+		}
+	}
+	if len(templated) == 0 {
+		return
+	}
+	document, err := instanceIdentityDocument()
+	if err != nil {
+		log.Errorf("Not expanding the instance facts in %s: %v", strings.Join(templated, ", "), err)
+		return
+	}
+	facts := instanceFacts(document)
+	for _, key := range templated {
+		envVariables[key] = templatePattern.ReplaceAllStringFunc(envVariables[key], func(placeholder string) string {
+			name := templatePattern.FindStringSubmatch(placeholder)[1]
+			fact, ok := facts[name]
+			if !ok {
+				log.Warnf("Unknown instance fact %s in %s", name, key)
+				return placeholder
+			}
+			return fact
+		})
+	}
+}
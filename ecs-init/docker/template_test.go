@@ -0,0 +1,99 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package docker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+var testIdentityDocument = ec2metadata.EC2InstanceIdentityDocument{
+	InstanceID:       "i-0123456789abcdef0",
+	InstanceType:     "c5.large",
+	AvailabilityZone: "us-west-2a",
+	Region:           "us-west-2",
+}
+
+// withIdentityDocument makes the instance metadata service return document
+// and err, counting the requests in requests
+func withIdentityDocument(t *testing.T, document ec2metadata.EC2InstanceIdentityDocument, err error, requests *int) {
+	instanceIdentityDocument = func() (ec2metadata.EC2InstanceIdentityDocument, error) {
+		*requests++
+		return document, err
+	}
+	t.Cleanup(func() { instanceIdentityDocument = defaultInstanceIdentityDocument })
+}
+
+var defaultInstanceIdentityDocument = instanceIdentityDocument
+
+func TestExpandTemplates(t *testing.T) {
+	requests := 0
+	withIdentityDocument(t, testIdentityDocument, nil, &requests)
+
+	envVariables := map[string]string{
+		"ECS_CLUSTER":             "web-{{availability_zone}}",
+		"ECS_INSTANCE_ATTRIBUTES": `{"host": "{{ instance_id }}", "size": "{{instance_type}}"}`,
+		"ECS_LOGLEVEL":            "info",
+		"ECS_AGENT_LABELS":        `{"node": "{{hostname}}"}`,
+	}
+	expandTemplates(envVariables)
+	assert.Equal(t, map[string]string{
+		"ECS_CLUSTER":             "web-us-west-2a",
+		"ECS_INSTANCE_ATTRIBUTES": `{"host": "i-0123456789abcdef0", "size": "c5.large"}`,
+		"ECS_LOGLEVEL":            "info",
+		"ECS_AGENT_LABELS":        `{"node": "{{hostname}}"}`,
+	}, envVariables, "Expect unknown facts to be left alone")
+	assert.Equal(t, 1, requests)
+}
+
+func TestExpandTemplatesWithoutPlaceholders(t *testing.T) {
+	requests := 0
+	withIdentityDocument(t, testIdentityDocument, nil, &requests)
+
+	envVariables := map[string]string{"ECS_CLUSTER": "web"}
+	expandTemplates(envVariables)
+	assert.Equal(t, "web", envVariables["ECS_CLUSTER"])
+	assert.Zero(t, requests, "Expect the instance metadata service not to be queried")
+}
+
+func TestExpandTemplatesMetadataUnavailable(t *testing.T) {
+	requests := 0
+	withIdentityDocument(t, testIdentityDocument, errors.New("timeout"), &requests)
+
+	envVariables := map[string]string{"ECS_CLUSTER": "web-{{region}}"}
+	expandTemplates(envVariables)
+	assert.Equal(t, "web-{{region}}", envVariables["ECS_CLUSTER"])
+}
+
+func TestLoadEnvVarsExpandsTemplates(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	requests := 0
+	withIdentityDocument(t, testIdentityDocument, nil, &requests)
+
+	mockFS := NewMockfileSystem(mockCtrl)
+	mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(nil, errors.New("not found"))
+	mockFS.EXPECT().ReadFile(config.AgentConfigFile()).Return([]byte("ECS_CLUSTER=batch-{{region}}\n"), nil)
+
+	client := &Client{
+		fs: mockFS,
+	}
+	assert.Equal(t, "batch-us-west-2", client.LoadEnvVars()["ECS_CLUSTER"])
+}
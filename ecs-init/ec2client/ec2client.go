@@ -0,0 +1,78 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package ec2client is a client for the Amazon EC2 API tagging the instance
+// once the Agent registered it
+package ec2client
+
+import (
+	"sort"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/awsquery"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+var service = awsquery.Service{
+	Name:       "ec2",
+	ID:         "EC2",
+	APIVersion: "2016-11-15",
+	EC2:        true,
+}
+
+// Client calls the Amazon EC2 API of a region
+type Client struct {
+	*awsquery.Client
+}
+
+// New creates a Client of the Amazon EC2 tagging APIs of region
+func New(region string) (*Client, error) {
+	client, err := awsquery.NewForRegion(region, service)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+func newClient(cfg *aws.Config) (*Client, error) {
+	client, err := awsquery.New(cfg, service)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+type tag struct {
+	Key   string
+	Value string
+}
+
+type createTagsInput struct {
+	ResourceIds []string `locationName:"ResourceId" type:"list"`
+	Tags        []tag    `locationName:"Tag" type:"list"`
+}
+
+// CreateTags adds tags to the resource resourceID, such as an instance,
+// overwriting the values of the tags it already has
+func (c *Client) CreateTags(resourceID string, tags map[string]string) error {
+	input := &createTagsInput{
+		ResourceIds: []string{resourceID},
+	}
+	for key, value := range tags {
+		input.Tags = append(input.Tags, tag{Key: key, Value: value})
+	}
+	sort.Slice(input.Tags, func(i, j int) bool {
+		return input.Tags[i].Key < input.Tags[j].Key
+	})
+	return c.Call("CreateTags", input, nil)
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ec2client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/awstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-west-2/ec2/aws4_request")
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		values, err := url.ParseQuery(string(body))
+		require.NoError(t, err)
+		assert.Equal(t, url.Values{
+			"Action":       {"CreateTags"},
+			"Version":      {"2016-11-15"},
+			"ResourceId.1": {"i-1234"},
+			"Tag.1.Key":    {"ecs-init:agent-version"},
+			"Tag.1.Value":  {"v1.40.0"},
+			"Tag.2.Key":    {"ecs-init:version"},
+			"Tag.2.Value":  {"1.40.0-1"},
+		}, values)
+		w.Write([]byte(`<CreateTagsResponse><requestId>request-id</requestId><return>true</return></CreateTagsResponse>`))
+	}))
+	defer server.Close()
+
+	err := awstest.NewClient(t, server, newClient).CreateTags("i-1234", map[string]string{
+		"ecs-init:version":       "1.40.0-1",
+		"ecs-init:agent-version": "v1.40.0",
+	})
+	assert.NoError(t, err)
+}
+
+func TestCreateTagsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<Response><Errors><Error><Code>UnauthorizedOperation</Code>` +
+			`<Message>not authorized</Message></Error></Errors><RequestID>request-id</RequestID></Response>`))
+	}))
+	defer server.Close()
+
+	err := awstest.NewClient(t, server, newClient).CreateTags("i-1234", map[string]string{"team": "payments"})
+	assert.Error(t, err)
+}
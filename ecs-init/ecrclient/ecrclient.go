@@ -0,0 +1,119 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package ecrclient is a client for the Amazon ECR API authorizing Docker
+// to pull the Agent from private registries
+package ecrclient
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/awsjson"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pkg/errors"
+)
+
+var service = awsjson.Service{
+	Name:         "api.ecr",
+	SigningName:  "ecr",
+	ID:           "ECR",
+	APIVersion:   "2015-09-21",
+	TargetPrefix: "AmazonEC2ContainerRegistry_V20150921",
+}
+
+// registryPattern matches the host names of Amazon ECR private registries,
+// capturing the registry ID and region
+var registryPattern = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// ParseRegistry returns the registry ID and region of an Amazon ECR private
+// registry host, and false for other registries
+func ParseRegistry(host string) (registryID string, region string, ok bool) {
+	match := registryPattern.FindStringSubmatch(host)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// Client calls the Amazon ECR APIs of a region
+type Client struct {
+	*awsjson.Client
+}
+
+// New creates a Client of the Amazon ECR authorization API of region
+func New(region string) (*Client, error) {
+	client, err := awsjson.NewForRegion(region, service)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+func newClient(cfg *aws.Config) (*Client, error) {
+	client, err := awsjson.New(cfg, service)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+// Authorization is the user name and password to log in to a registry
+type Authorization struct {
+	Username string
+	Password string
+	// Endpoint is the address of the registry
+	Endpoint string
+}
+
+type getAuthorizationTokenInput struct {
+	RegistryIds []string `json:"registryIds"`
+}
+
+type authorizationData struct {
+	AuthorizationToken string `json:"authorizationToken"`
+	ProxyEndpoint      string `json:"proxyEndpoint"`
+}
+
+type getAuthorizationTokenOutput struct {
+	AuthorizationData []authorizationData `json:"authorizationData"`
+}
+
+// GetAuthorization returns the authorization to pull from the registry
+// registryID, which is valid for 12 hours
+func (c *Client) GetAuthorization(registryID string) (Authorization, error) {
+	output := &getAuthorizationTokenOutput{}
+	err := c.Call("GetAuthorizationToken", &getAuthorizationTokenInput{RegistryIds: []string{registryID}}, output)
+	if err != nil {
+		return Authorization{}, err
+	}
+	if len(output.AuthorizationData) == 0 {
+		return Authorization{}, errors.Errorf("no authorization returned for registry %s", registryID)
+	}
+	data := output.AuthorizationData[0]
+	token, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil {
+		return Authorization{}, errors.Wrap(err, "invalid authorization token")
+	}
+	parts := strings.SplitN(string(token), ":", 2)
+	if len(parts) != 2 {
+		return Authorization{}, errors.New("invalid authorization token: expected user name and password")
+	}
+	return Authorization{
+		Username: parts[0],
+		Password: parts[1],
+		Endpoint: data.ProxyEndpoint,
+	}, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecrclient
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/awstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRegistry(t *testing.T) {
+	cases := []struct {
+		host       string
+		registryID string
+		region     string
+		ok         bool
+	}{
+		{"123456789012.dkr.ecr.us-west-2.amazonaws.com", "123456789012", "us-west-2", true},
+		{"123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com", "123456789012", "us-gov-west-1", true},
+		{"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn", "123456789012", "cn-north-1", true},
+		{"public.ecr.aws", "", "", false},
+		{"registry.example.com", "", "", false},
+	}
+	for _, test := range cases {
+		t.Run(test.host, func(t *testing.T) {
+			registryID, region, ok := ParseRegistry(test.host)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.registryID, registryID)
+			assert.Equal(t, test.region, region)
+		})
+	}
+}
+
+func TestGetAuthorization(t *testing.T) {
+	token := base64.StdEncoding.EncodeToString([]byte("AWS:password"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken", r.Header.Get("X-Amz-Target"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-west-2/ecr/aws4_request")
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{"registryIds":["123456789012"]}`, string(body))
+		w.Write([]byte(`{"authorizationData":[{"authorizationToken":"` + token +
+			`","proxyEndpoint":"https://123456789012.dkr.ecr.us-west-2.amazonaws.com","expiresAt":1.5E9}]}`))
+	}))
+	defer server.Close()
+
+	auth, err := awstest.NewClient(t, server, newClient).GetAuthorization("123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, Authorization{
+		Username: "AWS",
+		Password: "password",
+		Endpoint: "https://123456789012.dkr.ecr.us-west-2.amazonaws.com",
+	}, auth)
+}
+
+func TestGetAuthorizationInvalidToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"authorizationData":[{"authorizationToken":"bm90LWEtdG9rZW4="}]}`))
+	}))
+	defer server.Close()
+
+	_, err := awstest.NewClient(t, server, newClient).GetAuthorization("123456789012")
+	assert.Error(t, err)
+}
+
+func TestGetAuthorizationDenied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"AccessDeniedException","message":""}`))
+	}))
+	defer server.Close()
+
+	_, err := awstest.NewClient(t, server, newClient).GetAuthorization("123456789012")
+	assert.Error(t, err)
+}
@@ -14,12 +14,30 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
 	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/devserver"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
 	"github.com/aws/amazon-ecs-init/ecs-init/engine"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/iptables"
+	"github.com/aws/amazon-ecs-init/ecs-init/failurereport"
+	"github.com/aws/amazon-ecs-init/ecs-init/faults"
+	"github.com/aws/amazon-ecs-init/ecs-init/history"
+	"github.com/aws/amazon-ecs-init/ecs-init/logger"
+	"github.com/aws/amazon-ecs-init/ecs-init/profiling"
+	"github.com/aws/amazon-ecs-init/ecs-init/selftest"
+	"github.com/aws/amazon-ecs-init/ecs-init/singleton"
 	"github.com/aws/amazon-ecs-init/ecs-init/version"
 
 	log "github.com/cihub/seelog"
@@ -27,15 +45,96 @@ import (
 
 // all supported commands
 const (
-	VERSION  = "version"
-	PRESTART = "pre-start"
-	START    = "start"
-	PRESTOP  = "pre-stop"
-	STOP     = "stop"
-	POSTSTOP = "post-stop"
-	RECACHE  = "reload-cache"
+	VERSION     = "version"
+	PRESTART    = "pre-start"
+	START       = "start"
+	PRESTOP     = "pre-stop"
+	STOP        = "stop"
+	POSTSTOP    = "post-stop"
+	RECACHE     = "reload-cache"
+	VERIFYREG   = "verify-registration"
+	GCNETWORK   = "gc-network"
+	GCCACHE     = "gc-cache"
+	BACKUPDATA  = "backup-data"
+	RESTOREDATA = "restore-data"
+	BLUEPRINT   = "apply-blueprint"
+	SELFTEST    = "selftest"
+	STATUS      = "status"
+	UPDATEAGENT = "update-agent"
+	DIFF        = "diff"
+	PAUSEIMAGE  = "pause-image"
+	HISTORY     = "history"
+	DEVSERVER   = "dev-server"
+	PRUNEIMAGES = "prune-images"
 )
 
+var (
+	profileDir = flag.String("profile", "", "Write cpu and heap profiles of the action to the given directory")
+	pprofAddr  = flag.String("pprof", "", "Serve pprof endpoints on the given localhost address, e.g. 127.0.0.1:6060")
+	dryRun     = flag.Bool("dry-run", false, "Log the actions pre-start, start and stop would take without taking them")
+
+	startFlags    = flag.NewFlagSet(START, flag.ExitOnError)
+	startTakeover = startFlags.Bool("takeover", false, "Stop the ecs-init instance already supervising the Agent and replace it")
+
+	gcNetworkFlags  = flag.NewFlagSet(GCNETWORK, flag.ExitOnError)
+	gcNetworkDryRun = gcNetworkFlags.Bool("dry-run", false, "List the leaked task networking without deleting it")
+
+	backupDataFlags  = flag.NewFlagSet(BACKUPDATA, flag.ExitOnError)
+	restoreDataFlags = flag.NewFlagSet(RESTOREDATA, flag.ExitOnError)
+
+	blueprintFlags    = flag.NewFlagSet(BLUEPRINT, flag.ExitOnError)
+	blueprintDiffOnly = blueprintFlags.Bool("diff", false, "Report how the host differs from the blueprint without changing it")
+
+	statusFlags = flag.NewFlagSet(STATUS, flag.ExitOnError)
+	statusJSON  = statusFlags.Bool("json", false, "Write the status as JSON")
+
+	updateAgentFlags = flag.NewFlagSet(UPDATEAGENT, flag.ExitOnError)
+	updateAgentPlan  = updateAgentFlags.Bool("plan", false, "Report what updating the Agent would do without changing anything")
+
+	pauseImageFlags = flag.NewFlagSet(PAUSEIMAGE, flag.ExitOnError)
+	pauseImageLoad  = pauseImageFlags.Bool("load", false, "Load the pause container image from the cache directory first")
+	pauseImageClean = pauseImageFlags.Bool("clean", false, "Remove the pause container images the Agent does not expect first")
+
+	historyFlags = flag.NewFlagSet(HISTORY, flag.ExitOnError)
+	historySince = historyFlags.Duration("since", 7*24*time.Hour, "Show the events of this long ago onward")
+	historyKinds = historyFlags.String("kind", "", "Show only the events of these comma-separated kinds, e.g. start,failure")
+	historyJSON  = historyFlags.Bool("json", false, "Write the events as JSON")
+
+	devServerFlags    = flag.NewFlagSet(DEVSERVER, flag.ExitOnError)
+	devServerAddr     = devServerFlags.String("addr", "127.0.0.1:51680", "Address to serve the fake metadata service and the Agent artifacts on")
+	devServerAgentDir = devServerFlags.String("agent-dir", ".", "Directory of the Agent tarballs to serve, e.g. the output of a local Agent build")
+	devServerRegion   = devServerFlags.String("region", devserver.DefaultRegion, "Region of the fake instance")
+
+	selftestFlags        = flag.NewFlagSet(SELFTEST, flag.ExitOnError)
+	selftestAgentTarball = selftestFlags.String("agent-tarball", "", "Agent tarball to test with, next to its .md5 and .asc files")
+	selftestDockerHost   = selftestFlags.String("docker-host", "", "Socket of the disposable Docker daemon, e.g. unix:///var/run/dind/docker.sock")
+	selftestStartTimeout = selftestFlags.Duration("start-timeout", 2*time.Minute, "How long the Agent has to be running once started")
+)
+
+// profiler is set while the running action is being profiled
+var profiler *profiling.Profiler
+
+// runningAction is the action ecs-init runs, once known
+var runningAction string
+
+// bootstrapActions are the actions whose failures are reported in the
+// failure report
+var bootstrapActions = map[string]bool{
+	PRESTART: true,
+	START:    true,
+}
+
+// lifecycleActions are the actions whose failures are recorded in the
+// history
+var lifecycleActions = map[string]bool{
+	PRESTART:    true,
+	START:       true,
+	PRESTOP:     true,
+	STOP:        true,
+	RECACHE:     true,
+	UPDATEAGENT: true,
+}
+
 func main() {
 	defer log.Flush()
 	flag.Parse()
@@ -46,11 +145,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	logger, err := log.LoggerFromConfigAsString(config.Logger())
+	runningAction = args[0]
+	err := logger.Init(args[0])
 	if err != nil {
 		die(err)
 	}
-	log.ReplaceLogger(logger)
 
 	if args[0] == VERSION {
 		err := version.PrintVersion()
@@ -60,10 +159,65 @@ func main() {
 		return
 	}
 
+	if *pprofAddr != "" {
+		err = profiling.ServeDebug(*pprofAddr)
+		if err != nil {
+			die(err)
+		}
+	}
+	if *profileDir != "" {
+		profiler, err = profiling.Start(*profileDir, args[0])
+		if err != nil {
+			die(err)
+		}
+		defer stopProfiling()
+	}
+
+	// the action is canceled on SIGINT or SIGTERM, so that it stops waiting
+	// on Docker, downloads and retries
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// the self-test creates its own engine, connected to a disposable
+	// Docker daemon instead of the Docker daemon of the host
+	if args[0] == SELFTEST {
+		selftestFlags.Parse(args[1:])
+		err = runSelftest(ctx)
+		if err != nil {
+			die(err)
+		}
+		return
+	}
+
+	// the history is read without the engine, so that it can be queried
+	// when Docker is not running
+	if args[0] == HISTORY {
+		historyFlags.Parse(args[1:])
+		err = showHistory(os.Stdout)
+		if err != nil {
+			die(err)
+		}
+		return
+	}
+
+	// the development server stands in for the metadata service and the
+	// Agent buckets of hosts that are not EC2 instances, it needs no engine
+	if args[0] == DEVSERVER {
+		devServerFlags.Parse(args[1:])
+		err = runDevServer(ctx, os.Stdout)
+		if err != nil {
+			die(err)
+		}
+		return
+	}
+
 	init, err := engine.New()
 	if err != nil {
 		die(err)
 	}
+	if *dryRun {
+		init.DryRun()
+	}
 	log.Info(args[0])
 	actions := actions(init)
 	action, ok := actions[args[0]]
@@ -71,15 +225,33 @@ func main() {
 		usage(actions)
 		os.Exit(1)
 	}
-	err = action.function()
+	if action.flags != nil {
+		action.flags.Parse(args[1:])
+	}
+	err = action.function(ctx)
+	// state files are written in the background and must be persisted
+	// before exiting, whether or not the action succeeded
+	if flushErr := init.Flush(); flushErr != nil {
+		log.Warnf("Failed to persist state: %v", flushErr)
+	}
 	if err != nil {
 		die(err)
 	}
+	if args[0] == PRESTART && !*dryRun {
+		// the failure of a previous bootstrap is fixed once pre-start
+		// succeeds, a failing start reports its own
+		err = failurereport.Remove(config.FailureReportFile())
+		if err != nil {
+			log.Warnf("Could not remove the failure report: %v", err)
+		}
+	}
 }
 
 type action struct {
-	function    func() error
+	function    func(ctx context.Context) error
 	description string
+	// flags are the arguments of the action, if it takes any
+	flags *flag.FlagSet
 }
 
 func actions(engine *engine.Engine) map[string]action {
@@ -89,8 +261,30 @@ func actions(engine *engine.Engine) map[string]action {
 			description: "Prepare the ECS Agent for starting",
 		},
 		START: action{
-			function:    engine.StartSupervised,
-			description: "Start the ECS Agent and wait for it to stop",
+			function: func(ctx context.Context) error {
+				// a dry run does not take over supervising the Agent
+				if !*dryRun {
+					lock, err := lockSupervisor(*startTakeover)
+					if err != nil {
+						return err
+					}
+					defer lock.Release()
+				}
+				err := engine.WaitForStartGates(ctx)
+				if err != nil {
+					return err
+				}
+				err = engine.StartSupervised(ctx)
+				if errors.Is(err, context.Canceled) {
+					// the Agent is stopped by the stop action that
+					// follows the signal
+					log.Info("Stopped supervising the Agent")
+					return nil
+				}
+				return err
+			},
+			description: "Start the ECS Agent and wait for it to stop [--takeover]",
+			flags:       startFlags,
 		},
 		// This is a deprecated command for stopping the agent
 		// when using upstart jobs
@@ -106,25 +300,325 @@ func actions(engine *engine.Engine) map[string]action {
 			function:    engine.ReloadCache,
 			description: "Reload the cached image of the ECS Agent into Docker",
 		},
+		VERIFYREG: action{
+			function:    engine.VerifyRegistration,
+			description: "Wait for the ECS Agent to register the instance into its cluster",
+		},
+		GCNETWORK: action{
+			function: func(ctx context.Context) error {
+				return engine.GCNetwork(ctx, *gcNetworkDryRun)
+			},
+			description: "Delete the network namespaces, veth interfaces and routing rules leaked by tasks [--dry-run]",
+			flags:       gcNetworkFlags,
+		},
+		GCCACHE: action{
+			function: func(ctx context.Context) error {
+				return engine.GCCache(ctx)
+			},
+			description: "Delete orphaned temp files, unused Agent images and previous agents beyond the retention count from the cache",
+		},
+		BACKUPDATA: action{
+			function: func(ctx context.Context) error {
+				return engine.BackupData(ctx, backupDataFlags.Arg(0))
+			},
+			description: "Back up the data directory of the ECS Agent to [FILE]",
+			flags:       backupDataFlags,
+		},
+		RESTOREDATA: action{
+			function: func(ctx context.Context) error {
+				return engine.RestoreData(ctx, restoreDataFlags.Arg(0))
+			},
+			description: "Restore the data directory of the stopped ECS Agent from FILE",
+			flags:       restoreDataFlags,
+		},
+		BLUEPRINT: action{
+			function: func(ctx context.Context) error {
+				return engine.ApplyBlueprint(ctx, *blueprintDiffOnly)
+			},
+			description: "Converge the host toward the host blueprint [--diff]",
+			flags:       blueprintFlags,
+		},
+		SELFTEST: action{
+			function:    runSelftest,
+			description: "Download, load, start and stop the ECS Agent against a disposable Docker daemon [--agent-tarball FILE] [--docker-host SOCKET]",
+			flags:       selftestFlags,
+		},
+		STATUS: action{
+			function: func(ctx context.Context) error {
+				return engine.Status(ctx, os.Stdout, *statusJSON)
+			},
+			description: "Show the state of the ECS Agent, Docker and the connectivity of the endpoints they depend on [--json]",
+			flags:       statusFlags,
+		},
+		UPDATEAGENT: action{
+			function: func(ctx context.Context) error {
+				if *updateAgentPlan {
+					return engine.PlanAgentUpdate(ctx, os.Stdout)
+				}
+				return engine.UpdateAgent(ctx)
+			},
+			description: "Update the stopped ECS Agent to the published ECS Agent [--plan]",
+			flags:       updateAgentFlags,
+		},
 		POSTSTOP: action{
-			function:    engine.PostStop,
+			function: func(ctx context.Context) error {
+				return engine.PostStop(ctx)
+			},
 			description: "Cleanup procedure for the ECS Agent",
 		},
+		PAUSEIMAGE: action{
+			function: func(ctx context.Context) error {
+				if *pauseImageLoad {
+					err := engine.LoadPauseImage(ctx)
+					if err != nil {
+						return err
+					}
+				}
+				if *pauseImageClean {
+					err := engine.CleanPauseImages(ctx)
+					if err != nil {
+						return err
+					}
+				}
+				return engine.VerifyPauseImage(ctx, os.Stdout)
+			},
+			description: "Verify the pause container image expected by the Agent is loaded [--load] [--clean]",
+			flags:       pauseImageFlags,
+		},
+		PRUNEIMAGES: action{
+			function: func(ctx context.Context) error {
+				return engine.PruneAgentImages(ctx)
+			},
+			description: "Remove the previous ECS Agent images beyond the retention of ECS_INIT_AGENT_IMAGE_RETENTION",
+		},
+		HISTORY: action{
+			function: func(context.Context) error {
+				return showHistory(os.Stdout)
+			},
+			description: "Show the starts, stops, upgrades and failures of the ECS Agent recorded on this host [--since DURATION] [--kind KINDS] [--json]",
+			flags:       historyFlags,
+		},
+		DEVSERVER: action{
+			function: func(ctx context.Context) error {
+				return runDevServer(ctx, os.Stdout)
+			},
+			description: "Serve a fake instance metadata service and the Agent tarballs of a directory for development off EC2 [--addr ADDRESS] [--agent-dir DIR] [--region REGION]",
+			flags:       devServerFlags,
+		},
+		DIFF: action{
+			function: func(ctx context.Context) error {
+				return engine.DiffHostManifest(ctx, os.Stdout)
+			},
+			description: "Compare the changes made to the host in this boot with those of the previous boot",
+		},
 	}
 }
 
+// showHistory writes the lifecycle events recorded in the history that match
+// the flags of the history action
+func showHistory(w io.Writer) error {
+	events, err := history.Read(config.HistoryFile())
+	if err != nil {
+		return err
+	}
+	var kinds []string
+	if *historyKinds != "" {
+		kinds = strings.Split(*historyKinds, ",")
+	}
+	events = history.Filter(events, time.Now().Add(-*historySince), kinds...)
+	return history.Write(w, events, *historyJSON)
+}
+
+// runDevServer serves the development server until ctx is canceled, after
+// writing the environment pointing ecs-init at it to w
+func runDevServer(ctx context.Context, w io.Writer) error {
+	server := devserver.NewServer(*devServerAddr, *devServerAgentDir, *devServerRegion)
+	err := server.Start()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "# Serving %s on %s, run ecs-init with:\n", *devServerAgentDir, server.Addr())
+	for _, variable := range server.Environment() {
+		fmt.Fprintf(w, "export %s\n", variable)
+	}
+	<-ctx.Done()
+	return server.Stop()
+}
+
+func runSelftest(ctx context.Context) error {
+	return selftest.Run(ctx, selftest.Options{
+		AgentTarball: *selftestAgentTarball,
+		DockerHost:   *selftestDockerHost,
+		StartTimeout: *selftestStartTimeout,
+	})
+}
+
+// supervisorTakeoverTimeout is how long start --takeover waits for the
+// running instance to stop
+const supervisorTakeoverTimeout = 30 * time.Second
+
+// lockSupervisor ensures no other ecs-init instance supervises the Agent
+func lockSupervisor(takeover bool) (*singleton.Lock, error) {
+	if takeover {
+		return singleton.Takeover(config.SupervisorLockFile(), supervisorTakeoverTimeout)
+	}
+	lock, err := singleton.Acquire(config.SupervisorLockFile())
+	if errors.Is(err, singleton.ErrLocked) {
+		return nil, fmt.Errorf("%w; stop it or replace it with '%s --takeover'", err, START)
+	}
+	return lock, err
+}
+
 func usage(actions map[string]action) {
-	fmt.Printf("Usage: %s ACTION\n", os.Args[0])
+	fmt.Printf("Usage: %s [OPTIONS] ACTION\n", os.Args[0])
 	fmt.Println("")
 	fmt.Println(" Available actions:")
 	for command, action := range actions {
 		fmt.Printf("  %-15s  %s\n", command, action.description)
 	}
 	fmt.Println("")
+	fmt.Println(" Available options:")
+	flag.PrintDefaults()
+	fmt.Println("")
+}
+
+func stopProfiling() {
+	if profiler == nil {
+		return
+	}
+	err := profiler.Stop()
+	if err != nil {
+		log.Warnf("Failed to write profiles: %v", err)
+	}
+	profiler = nil
+}
+
+// notRegisteredExitCode tells a failed registration apart from other
+// failures of verify-registration
+const notRegisteredExitCode = 3
+
+// bootstrapDeadlineExitCode tells an Agent that could not be bootstrapped in
+// time apart from other failures, so that the instance can be replaced
+const bootstrapDeadlineExitCode = 4
+
+// failure classes reported when an action fails
+const (
+	failureChecksumMismatch  = "checksum-mismatch"
+	failureSignatureInvalid  = "signature-invalid"
+	failureValidationFailed  = "validation-failed"
+	failureDockerUnavailable = "docker-unavailable"
+	failureRegionUnavailable = "region-unavailable"
+	failureIptablesFailed    = "iptables-failed"
+	failureNotRegistered     = "not-registered"
+	failureBootstrapDeadline = "bootstrap-deadline"
+	failurePauseImage        = "pause-image-mismatch"
+	failureAlreadyRunning    = "already-running"
+	failureInjected          = "injected-fault"
+	failureOffline           = "offline"
+	failureUnknown           = "unknown"
+)
+
+// failureRemediations are the hints at how the failures of each class can be
+// fixed, written to the failure report
+var failureRemediations = map[string]string{
+	failureChecksumMismatch:  "The downloaded Agent does not match its published checksum. Check the proxies between the instance and S3, then restart ecs to download it again.",
+	failureSignatureInvalid:  "The signature of the Agent could not be verified. Check the source the Agent is downloaded from, then restart ecs to download it again.",
+	failureValidationFailed:  "The Agent failed validation. Restart ecs to download it again, or preload a valid Agent in /var/cache/ecs.",
+	failureDockerUnavailable: "Docker did not respond. Check 'systemctl status docker' and the endpoint in DOCKER_HOST, as diagnosed in the error, then restart ecs.",
+	failureRegionUnavailable: "The region of the instance could not be determined. Set ECS_INIT_REGION or check access to the instance metadata service.",
+	failureIptablesFailed:    "The netfilter rules of the credentials endpoint could not be changed. Check that iptables is installed and not locked by another process, or that firewalld accepts direct rules.",
+	failureNotRegistered:     "The Agent did not register the instance. Check ECS_CLUSTER, the instance role and access to the ECS endpoint.",
+	failureBootstrapDeadline: "The Agent was not bootstrapped within ECS_INIT_BOOTSTRAP_DEADLINE. Replace the instance.",
+	failurePauseImage:        "The pause container image expected by the Agent is not loaded. Run 'ecs-init pause-image --load'.",
+	failureAlreadyRunning:    "Another ecs-init instance supervises the Agent. Stop it, or replace it with 'ecs-init start --takeover'.",
+	failureInjected:          "A fault was injected with ECS_INIT_FAULTS. Unset it and restart ecs.",
+	failureOffline:           "ecs-init runs with ECS_OFFLINE and a step needs network access. Preload the Agent in /var/cache/ecs or allow network access.",
+	failureUnknown:           "Check the log lines of the report and /var/log/ecs/ecs-init.log.",
+}
+
+// failureClass classifies err so that the failure can be told apart in the
+// logs without parsing the error message
+func failureClass(err error) string {
+	switch {
+	case errors.Is(err, cache.ErrChecksumMismatch):
+		return failureChecksumMismatch
+	case errors.Is(err, cache.ErrSignatureInvalid):
+		return failureSignatureInvalid
+	case errors.Is(err, cache.ErrValidationFailed):
+		return failureValidationFailed
+	case errors.Is(err, docker.ErrDockerUnavailable):
+		return failureDockerUnavailable
+	case errors.Is(err, config.ErrRegionUnavailable):
+		return failureRegionUnavailable
+	case errors.Is(err, iptables.ErrIptablesFailed):
+		return failureIptablesFailed
+	case errors.Is(err, engine.ErrNotRegistered):
+		return failureNotRegistered
+	case errors.Is(err, engine.ErrBootstrapDeadline):
+		return failureBootstrapDeadline
+	case errors.Is(err, engine.ErrPauseImageMismatch):
+		return failurePauseImage
+	case errors.Is(err, singleton.ErrLocked):
+		return failureAlreadyRunning
+	case errors.Is(err, faults.ErrInjected):
+		return failureInjected
+	case errors.Is(err, cache.ErrOffline):
+		return failureOffline
+	}
+	return failureUnknown
+}
+
+// writeFailureReport writes the failure report of err, failing the action,
+// once the messages logged before it are flushed
+func writeFailureReport(action string, err error) {
+	class := failureClass(err)
+	phase := action
+	var stepErr *engine.StepError
+	if errors.As(err, &stepErr) {
+		phase = stepErr.Step
+	}
+	writeErr := failurereport.Write(config.FailureReportFile(), failurereport.Report{
+		Time:        time.Now().UTC(),
+		Version:     version.Version,
+		Action:      action,
+		Phase:       phase,
+		Class:       class,
+		Error:       err.Error(),
+		Remediation: failureRemediations[class],
+		LogLines:    logger.Tail(),
+	})
+	if writeErr != nil {
+		fmt.Fprintf(os.Stderr, "Could not write the failure report: %v\n", writeErr)
+	}
+}
+
+// recordFailure records the failure of action in the history
+func recordFailure(action string, err error) {
+	appendErr := history.NewLog(config.HistoryFile()).Append(history.Event{
+		Time:   time.Now().UTC(),
+		Kind:   history.KindFailure,
+		Detail: fmt.Sprintf("%s failed (%s): %v", action, failureClass(err), err),
+	})
+	if appendErr != nil {
+		fmt.Fprintf(os.Stderr, "Could not record the failure in the history: %v\n", appendErr)
+	}
 }
 
 func die(err error) {
-	log.Error(err.Error())
+	log.Errorf("%s (failure class: %s)", err.Error(), failureClass(err))
+	stopProfiling()
 	log.Flush()
+	if bootstrapActions[runningAction] && !*dryRun {
+		writeFailureReport(runningAction, err)
+	}
+	if lifecycleActions[runningAction] && !*dryRun {
+		recordFailure(runningAction, err)
+	}
+	if errors.Is(err, engine.ErrNotRegistered) {
+		os.Exit(notRegisteredExitCode)
+	}
+	if errors.Is(err, engine.ErrBootstrapDeadline) {
+		os.Exit(bootstrapDeadlineExitCode)
+	}
 	os.Exit(-1)
 }
@@ -0,0 +1,120 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecsclient
+
+const (
+	// ClusterStatusActive is the status of a cluster that instances can join
+	ClusterStatusActive = "ACTIVE"
+	// ContainerInstanceStatusActive is the status of a container instance
+	// that tasks can be placed on
+	ContainerInstanceStatusActive = "ACTIVE"
+)
+
+// Cluster is the subset of an Amazon ECS cluster used by ecs-init
+type Cluster struct {
+	ClusterArn  string `json:"clusterArn,omitempty"`
+	ClusterName string `json:"clusterName,omitempty"`
+	Status      string `json:"status,omitempty"`
+}
+
+// Failure is a resource that an API could not act on
+type Failure struct {
+	Arn    string `json:"arn,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// DescribeClustersInput is the input of DescribeClusters
+type DescribeClustersInput struct {
+	Clusters []string `json:"clusters"`
+}
+
+// DescribeClustersOutput is the output of DescribeClusters
+type DescribeClustersOutput struct {
+	Clusters []Cluster `json:"clusters"`
+	Failures []Failure `json:"failures"`
+}
+
+// DescribeClusters describes the clusters of the input
+func (c *Client) DescribeClusters(input *DescribeClustersInput) (*DescribeClustersOutput, error) {
+	output := &DescribeClustersOutput{}
+	return output, c.Call("DescribeClusters", input, output)
+}
+
+// CreateClusterInput is the input of CreateCluster
+type CreateClusterInput struct {
+	ClusterName string `json:"clusterName"`
+}
+
+// CreateClusterOutput is the output of CreateCluster
+type CreateClusterOutput struct {
+	Cluster Cluster `json:"cluster"`
+}
+
+// CreateCluster creates a cluster, or returns the active cluster of the same
+// name
+func (c *Client) CreateCluster(input *CreateClusterInput) (*CreateClusterOutput, error) {
+	output := &CreateClusterOutput{}
+	return output, c.Call("CreateCluster", input, output)
+}
+
+// ContainerInstance is the subset of an Amazon ECS container instance used by
+// ecs-init
+type ContainerInstance struct {
+	AgentConnected       bool   `json:"agentConnected"`
+	ContainerInstanceArn string `json:"containerInstanceArn,omitempty"`
+	Ec2InstanceID        string `json:"ec2InstanceId,omitempty"`
+	Status               string `json:"status,omitempty"`
+}
+
+// DescribeContainerInstancesInput is the input of DescribeContainerInstances
+type DescribeContainerInstancesInput struct {
+	Cluster            string   `json:"cluster,omitempty"`
+	ContainerInstances []string `json:"containerInstances"`
+}
+
+// DescribeContainerInstancesOutput is the output of DescribeContainerInstances
+type DescribeContainerInstancesOutput struct {
+	ContainerInstances []ContainerInstance `json:"containerInstances"`
+	Failures           []Failure           `json:"failures"`
+}
+
+// DescribeContainerInstances describes the container instances of the input
+// in its cluster
+func (c *Client) DescribeContainerInstances(input *DescribeContainerInstancesInput) (*DescribeContainerInstancesOutput, error) {
+	output := &DescribeContainerInstancesOutput{}
+	return output, c.Call("DescribeContainerInstances", input, output)
+}
+
+// Tag is a tag of an Amazon ECS resource
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// TagResourceInput is the input of TagResource
+type TagResourceInput struct {
+	ResourceArn string `json:"resourceArn"`
+	Tags        []Tag  `json:"tags"`
+}
+
+// TagResourceOutput is the output of TagResource
+type TagResourceOutput struct{}
+
+// TagResource adds tags to a resource, such as a container instance,
+// overwriting the values of the tags it already has. Container instances
+// registered with the short ARN format cannot be tagged.
+func (c *Client) TagResource(input *TagResourceInput) (*TagResourceOutput, error) {
+	output := &TagResourceOutput{}
+	return output, c.Call("TagResource", input, output)
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package ecsclient is a client for the few Amazon ECS APIs called while
+// bootstrapping the Agent
+package ecsclient
+
+import (
+	"github.com/aws/amazon-ecs-init/ecs-init/awsjson"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+var service = awsjson.Service{
+	Name:         "ecs",
+	ID:           "ECS",
+	APIVersion:   "2014-11-13",
+	TargetPrefix: "AmazonEC2ContainerServiceV20141113",
+}
+
+// Client calls the Amazon ECS APIs of a region
+type Client struct {
+	*awsjson.Client
+}
+
+// New creates a Client of the Amazon ECS control plane APIs of region
+func New(region string) (*Client, error) {
+	client, err := awsjson.NewForRegion(region, service)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+func newClient(cfg *aws.Config) (*Client, error) {
+	client, err := awsjson.New(cfg, service)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecsclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/awstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribeClusters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "AmazonEC2ContainerServiceV20141113.DescribeClusters", r.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "application/x-amz-json-1.1", r.Header.Get("Content-Type"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-west-2/ecs/aws4_request")
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{"clusters":["test"]}`, string(body))
+		w.Write([]byte(`{"clusters":[{"clusterName":"test","status":"ACTIVE"}],"failures":[]}`))
+	}))
+	defer server.Close()
+	client := awstest.NewClient(t, server, newClient)
+
+	output, err := client.DescribeClusters(&DescribeClustersInput{Clusters: []string{"test"}})
+	require.NoError(t, err)
+	require.Len(t, output.Clusters, 1)
+	assert.Equal(t, "test", output.Clusters[0].ClusterName)
+	assert.Equal(t, ClusterStatusActive, output.Clusters[0].Status)
+}
+
+func TestCreateCluster(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AmazonEC2ContainerServiceV20141113.CreateCluster", r.Header.Get("X-Amz-Target"))
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{"clusterName":"test"}`, string(body))
+		w.Write([]byte(`{"cluster":{"clusterName":"test","status":"ACTIVE"}}`))
+	}))
+	defer server.Close()
+	client := awstest.NewClient(t, server, newClient)
+
+	output, err := client.CreateCluster(&CreateClusterInput{ClusterName: "test"})
+	require.NoError(t, err)
+	assert.Equal(t, "test", output.Cluster.ClusterName)
+}
+
+func TestDescribeContainerInstances(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AmazonEC2ContainerServiceV20141113.DescribeContainerInstances", r.Header.Get("X-Amz-Target"))
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{"cluster":"test","containerInstances":["arn"]}`, string(body))
+		w.Write([]byte(`{"containerInstances":[{"containerInstanceArn":"arn","agentConnected":true,"status":"ACTIVE"}]}`))
+	}))
+	defer server.Close()
+	client := awstest.NewClient(t, server, newClient)
+
+	output, err := client.DescribeContainerInstances(&DescribeContainerInstancesInput{
+		Cluster:            "test",
+		ContainerInstances: []string{"arn"},
+	})
+	require.NoError(t, err)
+	require.Len(t, output.ContainerInstances, 1)
+	assert.True(t, output.ContainerInstances[0].AgentConnected)
+	assert.Equal(t, ContainerInstanceStatusActive, output.ContainerInstances[0].Status)
+}
+
+func TestTagResource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AmazonEC2ContainerServiceV20141113.TagResource", r.Header.Get("X-Amz-Target"))
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{"resourceArn":"arn","tags":[{"key":"team","value":"payments"}]}`, string(body))
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	client := awstest.NewClient(t, server, newClient)
+
+	_, err := client.TagResource(&TagResourceInput{
+		ResourceArn: "arn",
+		Tags:        []Tag{{Key: "team", Value: "payments"}},
+	})
+	assert.NoError(t, err)
+}
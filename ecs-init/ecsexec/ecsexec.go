@@ -0,0 +1,350 @@
+// Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package ecsexec stages the SSM agent binaries and the certificates ECS Exec
+// runs in task containers on the host, where the Agent mounts them from
+package ecsexec
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// HostDirectory is the directory of the host the ECS Exec prerequisites
+	// are staged in
+	HostDirectory = "/var/lib/ecs/deps/execute-command"
+	// ContainerDirectory is the directory of the Agent container the Agent
+	// looks for the ECS Exec prerequisites in
+	ContainerDirectory = "/managed-agents/execute-command"
+
+	// binariesArchive is the name of the archive of the SSM agent binaries
+	// published for each version and architecture
+	binariesArchive = "amazon-ssm-agent-binaries.tar.gz"
+	// certificateFile is the name the CA bundle is staged under
+	certificateFile = "tls-ca-bundle.pem"
+
+	directoryPerm   = 0755
+	binaryPerm      = 0755
+	certificatePerm = 0644
+)
+
+// binaries are the SSM agent binaries ECS Exec runs in task containers
+var binaries = []string{"amazon-ssm-agent", "ssm-agent-worker", "ssm-session-worker"}
+
+// caBundles are the CA bundles of the supported distributions, the first one
+// found is staged
+var caBundles = []string{
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/certs/ca-certificates.crt",
+}
+
+// Stager implements the engine.execPrerequisites interface by downloading
+// the SSM agent binaries into the cache directory and staging them with the
+// CA bundle of the host
+type Stager struct {
+	hostDirectory  string
+	cacheDirectory string
+	caBundles      []string
+	httpClient     *http.Client
+	// archiveURL returns the URL of the binaries of version for region
+	archiveURL func(region, version string) string
+}
+
+// NewStager creates a new Stager
+func NewStager() *Stager {
+	return &Stager{
+		hostDirectory:  HostDirectory,
+		cacheDirectory: config.CacheDirectory() + "/execute-command",
+		caBundles:      caBundles,
+		httpClient:     http.DefaultClient,
+		archiveURL:     archiveURL,
+	}
+}
+
+// archiveURL returns the URL the SSM agent binaries of version are published
+// at in the bucket of region
+func archiveURL(region, version string) string {
+	return fmt.Sprintf("https://s3.%s.amazonaws.com/amazon-ssm-%s/%s/linux_%s/%s",
+		region, region, version, config.AgentArch(), binariesArchive)
+}
+
+// Prepare stages the SSM agent binaries of version, downloading them from
+// region unless they are cached, and the CA bundle of the host. Cached
+// binaries of other versions are removed once the version is staged, while
+// staged binaries of other versions are kept for the tasks still using them.
+// Only cached binaries are staged when offline.
+func (s *Stager) Prepare(ctx context.Context, region, version string, offline bool) error {
+	binDirectory := filepath.Join(s.hostDirectory, "bin", version)
+	if !staged(binDirectory) {
+		archive, err := s.cachedArchive(ctx, region, version, offline)
+		if err != nil {
+			return err
+		}
+		err = s.stageBinaries(archive, binDirectory)
+		if err != nil {
+			return err
+		}
+		log.Infof("Staged the SSM agent %s binaries for ECS Exec in %s", version, binDirectory)
+	}
+	s.removeCachedArchives(version)
+	err := s.stageCertificates()
+	if err != nil {
+		return err
+	}
+	configDirectory := filepath.Join(s.hostDirectory, "config")
+	err = os.MkdirAll(configDirectory, directoryPerm)
+	if err != nil {
+		return errors.Wrapf(err, "could not create %s", configDirectory)
+	}
+	hostmanifest.Record(hostmanifest.KindFile, configDirectory, hostmanifest.Directory)
+	return nil
+}
+
+// staged returns whether all the binaries are staged in directory
+func staged(directory string) bool {
+	for _, binary := range binaries {
+		info, err := os.Stat(filepath.Join(directory, binary))
+		if err != nil || info.Size() == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// cachedArchive returns the cached archive of the binaries of version,
+// downloading it first when it is not cached
+func (s *Stager) cachedArchive(ctx context.Context, region, version string, offline bool) (string, error) {
+	archive := filepath.Join(s.cacheDirectory, "amazon-ssm-agent-"+version+".tar.gz")
+	if info, err := os.Stat(archive); err == nil && info.Size() > 0 {
+		return archive, nil
+	}
+	if offline {
+		return "", errors.Errorf("the SSM agent %s binaries are not cached in %s", version, s.cacheDirectory)
+	}
+	err := os.MkdirAll(s.cacheDirectory, directoryPerm)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not create %s", s.cacheDirectory)
+	}
+	source := s.archiveURL(region, version)
+	log.Infof("Downloading the SSM agent %s binaries for ECS Exec from %s", version, source)
+	err = s.download(ctx, source, archive)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not download the SSM agent %s binaries", version)
+	}
+	return archive, nil
+}
+
+// download writes the file at source to file, which is only replaced once
+// the download completes
+func (s *Stager) download(ctx context.Context, source, file string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected HTTP status %d", resp.StatusCode)
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = io.Copy(temp, resp.Body)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), file)
+}
+
+// stageBinaries extracts the binaries from archive into directory, which is
+// only created once all of them are extracted
+func (s *Stager) stageBinaries(archive, directory string) error {
+	err := os.MkdirAll(filepath.Dir(directory), directoryPerm)
+	if err != nil {
+		return errors.Wrapf(err, "could not create %s", filepath.Dir(directory))
+	}
+	temp, err := ioutil.TempDir(filepath.Dir(directory), "."+filepath.Base(directory))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(temp)
+	err = extractBinaries(archive, temp)
+	if err != nil {
+		// a corrupt archive is downloaded again
+		os.Remove(archive)
+		return err
+	}
+	err = os.Chmod(temp, directoryPerm)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(directory)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(temp, directory)
+	if err != nil {
+		return err
+	}
+	for _, binary := range binaries {
+		recordFile(filepath.Join(directory, binary))
+	}
+	return nil
+}
+
+// extractBinaries extracts the binaries from the gzipped tar archive into
+// directory
+func extractBinaries(archive, directory string) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return errors.Wrapf(err, "could not read %s", archive)
+	}
+	wanted := make(map[string]bool)
+	for _, binary := range binaries {
+		wanted[binary] = true
+	}
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "could not read %s", archive)
+		}
+		name := filepath.Base(header.Name)
+		if header.Typeflag != tar.TypeReg || !wanted[name] {
+			continue
+		}
+		err = writeFile(filepath.Join(directory, name), reader, binaryPerm)
+		if err != nil {
+			return err
+		}
+		delete(wanted, name)
+	}
+	if len(wanted) > 0 {
+		var missing []string
+		for _, binary := range binaries {
+			if wanted[binary] {
+				missing = append(missing, binary)
+			}
+		}
+		return errors.Errorf("%s is missing %s", archive, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// stageCertificates copies the CA bundle of the host, which task containers
+// may not have, next to the binaries
+func (s *Stager) stageCertificates() error {
+	for _, bundle := range s.caBundles {
+		source, err := os.Open(bundle)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		directory := filepath.Join(s.hostDirectory, "certs")
+		err = os.MkdirAll(directory, directoryPerm)
+		if err != nil {
+			return errors.Wrapf(err, "could not create %s", directory)
+		}
+		file := filepath.Join(directory, certificateFile)
+		err = writeFile(file, source, certificatePerm)
+		if err != nil {
+			return errors.Wrap(err, "could not stage the CA bundle")
+		}
+		recordFile(file)
+		return nil
+	}
+	return errors.Errorf("no CA bundle found in %s", strings.Join(s.caBundles, ", "))
+}
+
+// removeCachedArchives removes the cached archives of the binaries of other
+// versions than version
+func (s *Stager) removeCachedArchives(version string) {
+	archives, err := filepath.Glob(filepath.Join(s.cacheDirectory, "amazon-ssm-agent-*.tar.gz"))
+	if err != nil {
+		return
+	}
+	for _, archive := range archives {
+		if filepath.Base(archive) == "amazon-ssm-agent-"+version+".tar.gz" {
+			continue
+		}
+		log.Infof("Removing the cached SSM agent binaries %s", archive)
+		err := os.Remove(archive)
+		if err != nil {
+			log.Warnf("Could not remove %s: %v", archive, err)
+		}
+	}
+}
+
+// writeFile writes the content of r to file through a temporary file
+func writeFile(file string, r io.Reader, perm os.FileMode) error {
+	temp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = io.Copy(temp, r)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(temp.Name(), perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), file)
+}
+
+// recordFile records the staged file in the host manifest
+func recordFile(file string) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	hostmanifest.RecordFile(file, data)
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecsexec
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// binariesArchiveOf returns a gzipped tar archive holding the files
+func binariesArchiveOf(t *testing.T, files ...string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		content := []byte("#!/bin/sh\n# " + file + "\n")
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     "amazon-ssm-agent-binaries/" + file,
+			Mode:     0755,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func newTestStager(t *testing.T, server *httptest.Server) *Stager {
+	dir := t.TempDir()
+	caBundle := filepath.Join(dir, "ca-bundle.crt")
+	require.NoError(t, ioutil.WriteFile(caBundle, []byte("certificates"), 0644))
+	stager := &Stager{
+		hostDirectory:  filepath.Join(dir, "execute-command"),
+		cacheDirectory: filepath.Join(dir, "cache"),
+		caBundles:      []string{filepath.Join(dir, "missing.crt"), caBundle},
+		httpClient:     http.DefaultClient,
+		archiveURL: func(region, version string) string {
+			return server.URL + "/" + region + "/" + version
+		},
+	}
+	return stager
+}
+
+func TestPrepare(t *testing.T) {
+	archive := binariesArchiveOf(t, "amazon-ssm-agent", "ssm-agent-worker", "ssm-session-worker", "README")
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/us-west-2/3.1.1446.0", r.URL.Path)
+		downloads++
+		w.Write(archive)
+	}))
+	defer server.Close()
+	stager := newTestStager(t, server)
+	staleArchive := filepath.Join(stager.cacheDirectory, "amazon-ssm-agent-3.0.0.0.tar.gz")
+	require.NoError(t, os.MkdirAll(stager.cacheDirectory, 0755))
+	require.NoError(t, ioutil.WriteFile(staleArchive, []byte("stale"), 0644))
+
+	err := stager.Prepare(context.Background(), "us-west-2", "3.1.1446.0", false)
+	require.NoError(t, err)
+
+	for _, binary := range binaries {
+		info, err := os.Stat(filepath.Join(stager.hostDirectory, "bin", "3.1.1446.0", binary))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	}
+	_, err = os.Stat(filepath.Join(stager.hostDirectory, "bin", "3.1.1446.0", "README"))
+	assert.True(t, os.IsNotExist(err))
+	certificates, err := ioutil.ReadFile(filepath.Join(stager.hostDirectory, "certs", "tls-ca-bundle.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, "certificates", string(certificates))
+	_, err = os.Stat(filepath.Join(stager.hostDirectory, "config"))
+	assert.NoError(t, err)
+	_, err = os.Stat(staleArchive)
+	assert.True(t, os.IsNotExist(err))
+
+	// staged binaries are not downloaded again
+	err = stager.Prepare(context.Background(), "us-west-2", "3.1.1446.0", false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, downloads)
+}
+
+func TestPrepareMissingBinary(t *testing.T) {
+	archive := binariesArchiveOf(t, "amazon-ssm-agent", "ssm-agent-worker")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+	stager := newTestStager(t, server)
+
+	err := stager.Prepare(context.Background(), "us-west-2", "3.1.1446.0", false)
+	assert.Error(t, err)
+	assert.False(t, staged(filepath.Join(stager.hostDirectory, "bin", "3.1.1446.0")))
+	// the archive is downloaded again by the next attempt
+	_, err = os.Stat(filepath.Join(stager.cacheDirectory, "amazon-ssm-agent-3.1.1446.0.tar.gz"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPrepareDownloadError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	stager := newTestStager(t, server)
+
+	err := stager.Prepare(context.Background(), "us-west-2", "3.1.1446.0", false)
+	assert.Error(t, err)
+}
+
+func TestPrepareOfflineNotCached(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Unexpected download in offline mode")
+	}))
+	defer server.Close()
+	stager := newTestStager(t, server)
+
+	err := stager.Prepare(context.Background(), "us-west-2", "3.1.1446.0", true)
+	assert.Error(t, err)
+}
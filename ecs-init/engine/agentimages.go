@@ -0,0 +1,91 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+
+	log "github.com/cihub/seelog"
+)
+
+// PruneAgentImages removes the previous images of the Agent, keeping the
+// newest ones up to the configured retention. The Agent image and the
+// standby image are always kept, images other than the Agent's are never
+// removed, and images still used by containers are kept by the container
+// runtime.
+func (e *Engine) PruneAgentImages(ctx context.Context) error {
+	retention, err := config.AgentImageRetention()
+	if err != nil {
+		log.Warnf("Keeping %d previous Agent images: %v", retention, err)
+	}
+	images, err := e.docker.AgentImages(ctx)
+	if err != nil {
+		return engineError("could not list the Agent images", err)
+	}
+	kept := 0
+	for _, image := range images {
+		if isActiveAgentImage(image) {
+			continue
+		}
+		if kept < retention {
+			kept++
+			continue
+		}
+		e.removeAgentImage(ctx, image)
+	}
+	return nil
+}
+
+// pruneAgentImagesAfterStart prunes the previous images of the Agent once it
+// is healthy, when configured to
+func (e *Engine) pruneAgentImagesAfterStart(ctx context.Context) {
+	if !config.PruneAgentImages() {
+		return
+	}
+	err := e.PruneAgentImages(ctx)
+	if err != nil {
+		log.Warnf("Could not prune the previous Agent images: %v", err)
+	}
+}
+
+// isActiveAgentImage returns if image is the Agent image or the standby image
+func isActiveAgentImage(image docker.AgentImage) bool {
+	for _, tag := range image.Tags {
+		if tag == config.AgentImageName || tag == config.AgentImageRepository+":"+config.AgentStandbyImageTag {
+			return true
+		}
+	}
+	return false
+}
+
+// removeAgentImage removes the tags of image in the repository of the Agent,
+// which removes the image unless it has tags in other repositories, or the
+// image itself when it is untagged
+func (e *Engine) removeAgentImage(ctx context.Context, image docker.AgentImage) {
+	names := image.Tags
+	if image.Untagged() {
+		names = []string{image.ID}
+	}
+	for _, name := range names {
+		err := e.docker.RemoveImage(ctx, name)
+		if err != nil {
+			log.Warnf("Could not remove the Agent image %s: %v", name, err)
+			return
+		}
+		log.Infof("Removed the Agent image %s", name)
+	}
+}
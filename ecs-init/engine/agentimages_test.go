@@ -0,0 +1,79 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneAgentImages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().AgentImages(gomock.Any()).Return([]docker.AgentImage{
+		{ID: "standby", Tags: []string{"amazon/amazon-ecs-agent:standby"}},
+		{ID: "latest", Tags: []string{"amazon/amazon-ecs-agent:latest"}},
+		{ID: "previous"},
+		{ID: "older", Tags: []string{"amazon/amazon-ecs-agent:v2", "amazon/amazon-ecs-agent:v2.1"}},
+		{ID: "in-use"},
+		{ID: "oldest", Tags: []string{"amazon/amazon-ecs-agent:v1"}},
+	}, nil)
+	gomock.InOrder(
+		mockDocker.EXPECT().RemoveImage(gomock.Any(), "amazon/amazon-ecs-agent:v2").Return(nil),
+		mockDocker.EXPECT().RemoveImage(gomock.Any(), "amazon/amazon-ecs-agent:v2.1").Return(nil),
+		mockDocker.EXPECT().RemoveImage(gomock.Any(), "in-use").Return(errors.New("in use")),
+		mockDocker.EXPECT().RemoveImage(gomock.Any(), "amazon/amazon-ecs-agent:v1").Return(nil),
+	)
+
+	engine := &Engine{docker: mockDocker}
+	assert.NoError(t, engine.PruneAgentImages(context.Background()))
+}
+
+func TestPruneAgentImagesRetention(t *testing.T) {
+	os.Setenv(config.AgentImageRetentionEnvVar, "0")
+	defer os.Unsetenv(config.AgentImageRetentionEnvVar)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().AgentImages(gomock.Any()).Return([]docker.AgentImage{
+		{ID: "latest", Tags: []string{"amazon/amazon-ecs-agent:latest"}},
+		{ID: "previous"},
+	}, nil)
+	mockDocker.EXPECT().RemoveImage(gomock.Any(), "previous").Return(nil)
+
+	engine := &Engine{docker: mockDocker}
+	assert.NoError(t, engine.PruneAgentImages(context.Background()))
+}
+
+func TestPruneAgentImagesListError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().AgentImages(gomock.Any()).Return(nil, errors.New("test error"))
+
+	engine := &Engine{docker: mockDocker}
+	assert.Error(t, engine.PruneAgentImages(context.Background()))
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/history"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// updateUpToDate is the outcome of an update attempt that found the
+	// cached Agent to be the published Agent
+	updateUpToDate = "up-to-date"
+	// updateDownloaded is the outcome of an update attempt that downloaded
+	// the published Agent
+	updateDownloaded = "downloaded"
+	// updateFailed is the outcome of an update attempt that failed
+	updateFailed = "failed"
+
+	updateAttemptStatePerm = 0644
+)
+
+// updateAttempt is the last attempt to update the Agent, as recorded in the
+// update attempt state
+type updateAttempt struct {
+	At time.Time `json:"at"`
+	// Version is the version of the Agent that was updated to
+	Version string `json:"version"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// startAutoUpdate checks for a newer published Agent periodically while the
+// Agent runs, and stops the Agent once a newer Agent is downloaded so that
+// it is restarted with it. Updates only happen in maintenance windows. The
+// returned function stops the checks and waits for one in progress.
+func (e *Engine) startAutoUpdate(ctx context.Context) func() {
+	interval, err := config.AutoUpdateInterval()
+	if err != nil {
+		log.Warnf("Not updating the Agent: %v", err)
+		return func() {}
+	}
+	if interval == 0 {
+		return func() {}
+	}
+	if e.offline {
+		log.Warnf("Not updating the Agent in offline mode")
+		return func() {}
+	}
+	if e.agentRegistry != "" {
+		log.Warnf("Not updating the Agent pulled from a registry, change its pinned version instead")
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := e.clk().NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				if e.checkForUpdate(ctx) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// checkForUpdate downloads the published Agent when it differs from the
+// cached Agent and a maintenance window is open, and stops the running
+// Agent to update it. It returns true once the Agent was stopped.
+func (e *Engine) checkForUpdate(ctx context.Context) bool {
+	if !e.maintenanceWindowOpen(e.clk().Now()) {
+		log.Debugf("Not checking for a newer Agent outside of the maintenance windows")
+		return false
+	}
+	outdated, err := e.downloader.IsAgentOutdated(ctx)
+	if err != nil {
+		log.Warnf("Could not check for a newer Agent: %v", err)
+		e.recordUpdateAttempt(updateFailed, err)
+		return false
+	}
+	if !outdated {
+		e.recordUpdateAttempt(updateUpToDate, nil)
+		return false
+	}
+	if !e.protectUpgradeFromScaleIn() {
+		return false
+	}
+	log.Infof("Downloading the published Amazon Elastic Container Service Agent %s to update to",
+		e.downloader.AgentVersion())
+	err = e.downloader.DownloadAgent(ctx)
+	if err != nil {
+		log.Warnf("Could not download the Agent to update to: %v", err)
+		e.recordUpdateAttempt(updateFailed, err)
+		e.releaseScaleInProtection()
+		return false
+	}
+	e.recordUpdateAttempt(updateDownloaded, nil)
+	log.Info("Stopping the Agent to update it")
+	atomic.StoreInt32(&e.autoUpdateDue, 1)
+	err = e.docker.StopAgent(ctx)
+	if err != nil {
+		log.Warnf("Could not stop the Agent to update it: %v", err)
+		atomic.StoreInt32(&e.autoUpdateDue, 0)
+		e.releaseScaleInProtection()
+		return false
+	}
+	return true
+}
+
+// takeDueAutoUpdate returns true once after the Agent was stopped to update
+// it to the downloaded Agent
+func (e *Engine) takeDueAutoUpdate() bool {
+	return atomic.CompareAndSwapInt32(&e.autoUpdateDue, 1, 0)
+}
+
+// applyAutoUpdate loads the downloaded Agent into Docker, rolling back to the
+// previously cached Agent when it cannot be loaded
+func (e *Engine) applyAutoUpdate(ctx context.Context) error {
+	e.transition(StateUpgrading)
+	log.Info("Loading updated Amazon Elastic Container Service Agent into Docker")
+	err := e.load(ctx, e.downloader.LoadCachedAgent)
+	if err != nil {
+		return e.rollbackAgent(ctx, err)
+	}
+	e.recordAgentEvent(history.KindUpgrade)
+	return nil
+}
+
+// recordUpdateAttempt records the outcome of an attempt to update the Agent
+// to the version it is pinned to, so that it is reported by status
+func (e *Engine) recordUpdateAttempt(outcome string, err error) {
+	if e.statusWriter == nil {
+		return
+	}
+	attempt := updateAttempt{
+		At:      e.clk().Now().UTC(),
+		Version: e.downloader.AgentVersion(),
+		Outcome: outcome,
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	data, err := json.Marshal(attempt)
+	if err != nil {
+		log.Warnf("Could not encode the update attempt: %v", err)
+		return
+	}
+	err = e.statusWriter.WriteFile(config.UpdateAttemptState(), data, updateAttemptStatePerm)
+	if err != nil {
+		log.Warnf("Could not record the update attempt: %v", err)
+	}
+}
+
+func readUpdateAttempt() (*updateAttempt, error) {
+	data, err := ioutil.ReadFile(config.UpdateAttemptState())
+	if err != nil {
+		return nil, err
+	}
+	attempt := &updateAttempt{}
+	err = json.Unmarshal(data, attempt)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode the update attempt state")
+	}
+	return attempt, nil
+}
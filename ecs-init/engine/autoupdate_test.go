@@ -0,0 +1,201 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartAutoUpdateDisabled(t *testing.T) {
+	os.Unsetenv(config.AutoUpdateIntervalEnvVar)
+	engine := &Engine{}
+	engine.startAutoUpdate(context.Background())()
+}
+
+func TestStartAutoUpdateOffline(t *testing.T) {
+	os.Setenv(config.AutoUpdateIntervalEnvVar, "1h")
+	defer os.Unsetenv(config.AutoUpdateIntervalEnvVar)
+
+	engine := &Engine{offline: true}
+	engine.startAutoUpdate(context.Background())()
+}
+
+func TestCheckForUpdateOutsideMaintenanceWindow(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.MaintenanceWindowsEnvVar, neverOpenWindow)
+	defer os.Unsetenv(config.MaintenanceWindowsEnvVar)
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().IsAgentOutdated(gomock.Any()).Times(0)
+
+	engine := &Engine{downloader: mockDownloader}
+	assert.False(t, engine.checkForUpdate(context.Background()))
+}
+
+func TestCheckForUpdateUpToDate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader.EXPECT().IsAgentOutdated(gomock.Any()).Return(false, nil)
+	mockDownloader.EXPECT().DownloadAgent(gomock.Any()).Times(0)
+	mockDocker.EXPECT().StopAgent(gomock.Any()).Times(0)
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker}
+	assert.False(t, engine.checkForUpdate(context.Background()))
+}
+
+func TestCheckForUpdateDownloadFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader.EXPECT().IsAgentOutdated(gomock.Any()).Return(true, nil)
+	mockDownloader.EXPECT().AgentVersion().Return("latest")
+	mockDownloader.EXPECT().DownloadAgent(gomock.Any()).Return(errors.New("test error"))
+	mockDocker.EXPECT().StopAgent(gomock.Any()).Times(0)
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker}
+	assert.False(t, engine.checkForUpdate(context.Background()))
+	assert.False(t, engine.takeDueAutoUpdate())
+}
+
+func TestCheckForUpdateStopsAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	gomock.InOrder(
+		mockDownloader.EXPECT().IsAgentOutdated(gomock.Any()).Return(true, nil),
+		mockDownloader.EXPECT().AgentVersion().Return("latest"),
+		mockDownloader.EXPECT().DownloadAgent(gomock.Any()).Return(nil),
+		mockDocker.EXPECT().StopAgent(gomock.Any()).Return(nil),
+	)
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker}
+	assert.True(t, engine.checkForUpdate(context.Background()))
+	assert.True(t, engine.takeDueAutoUpdate())
+	assert.False(t, engine.takeDueAutoUpdate(), "Expect the update to be taken once")
+}
+
+func TestCheckForUpdateStopFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader.EXPECT().IsAgentOutdated(gomock.Any()).Return(true, nil)
+	mockDownloader.EXPECT().AgentVersion().Return("latest")
+	mockDownloader.EXPECT().DownloadAgent(gomock.Any()).Return(nil)
+	mockDocker.EXPECT().StopAgent(gomock.Any()).Return(errors.New("test error"))
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker}
+	assert.False(t, engine.checkForUpdate(context.Background()))
+	assert.False(t, engine.takeDueAutoUpdate())
+}
+
+func TestStartAutoUpdate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.AutoUpdateIntervalEnvVar, "1h")
+	defer os.Unsetenv(config.AutoUpdateIntervalEnvVar)
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	stopped := make(chan struct{})
+	mockDownloader.EXPECT().IsAgentOutdated(gomock.Any()).Return(true, nil)
+	mockDownloader.EXPECT().AgentVersion().Return("latest")
+	mockDownloader.EXPECT().DownloadAgent(gomock.Any()).Return(nil)
+	mockDocker.EXPECT().StopAgent(gomock.Any()).Do(func(context.Context) { close(stopped) }).Return(nil)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{
+		downloader: mockDownloader,
+		docker:     mockDocker,
+		clock:      fakeClock,
+	}
+	stop := engine.startAutoUpdate(context.Background())
+	// nothing is checked until the interval elapsed
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Hour)
+	<-stopped
+	stop()
+	assert.True(t, engine.takeDueAutoUpdate())
+}
+
+func TestApplyAutoUpdateRollsBack(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	gomock.InOrder(
+		mockDownloader.EXPECT().LoadCachedAgent().Return(ioutil.NopCloser(strings.NewReader("new")), nil),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any()).Return(errors.New("test error")),
+		mockDownloader.EXPECT().RollbackAgent().Return("v1.40.0", nil),
+		mockDownloader.EXPECT().LoadCachedAgent().Return(ioutil.NopCloser(strings.NewReader("previous")), nil),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any()).Return(nil),
+		mockDownloader.EXPECT().RecordCachedAgent().Return(nil),
+	)
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker}
+	engine.transition(StateStarting)
+	assert.NoError(t, engine.applyAutoUpdate(context.Background()))
+}
+
+func TestRecordUpdateAttempt(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockStatusWriter := NewMockstatusWriter(mockCtrl)
+	mockDownloader.EXPECT().AgentVersion().Return("v1.41.0")
+	var written updateAttempt
+	mockStatusWriter.EXPECT().WriteFile(config.UpdateAttemptState(), gomock.Any(), os.FileMode(updateAttemptStatePerm)).Do(
+		func(filename string, data []byte, perm os.FileMode) {
+			assert.NoError(t, json.Unmarshal(data, &written))
+		}).Return(nil)
+
+	engine := &Engine{
+		downloader:   mockDownloader,
+		statusWriter: mockStatusWriter,
+		clock:        clock.NewFake(time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)),
+	}
+	engine.recordUpdateAttempt(updateFailed, errors.New("test error"))
+	assert.Equal(t, updateAttempt{
+		At:      time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC),
+		Version: "v1.41.0",
+		Outcome: updateFailed,
+		Error:   "test error",
+	}, written)
+}
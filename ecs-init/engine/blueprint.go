@@ -0,0 +1,84 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// ApplyBlueprint converges the host toward the host blueprint. With diffOnly
+// the differences are only logged.
+func (e *Engine) ApplyBlueprint(ctx context.Context, diffOnly bool) error {
+	_, err := e.hostBlueprint.Load()
+	if os.IsNotExist(err) {
+		return errors.Errorf("no host blueprint at %s", config.BlueprintFile())
+	}
+	err = e.convergeBlueprint(ctx, diffOnly)
+	if err != nil {
+		return engineError("could not apply the host blueprint", err)
+	}
+	return nil
+}
+
+// convergeBlueprint logs the files that differ from the host blueprint and
+// writes them unless diffOnly is set, then sets the environment variables of
+// the blueprint for the rest of the action. Hosts without a blueprint are
+// left as they are.
+func (e *Engine) convergeBlueprint(ctx context.Context, diffOnly bool) error {
+	if e.hostBlueprint == nil {
+		return nil
+	}
+	hostBlueprint, err := e.hostBlueprint.Load()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	changes, err := e.hostBlueprint.Plan(hostBlueprint)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		log.Info("Host matches the host blueprint")
+	}
+	for _, change := range changes {
+		log.Infof("Host differs from the host blueprint:\n%s", change.Diff())
+	}
+	if diffOnly {
+		return nil
+	}
+	if len(changes) > 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = e.hostBlueprint.Apply(ctx, changes)
+		if err != nil {
+			return err
+		}
+		log.Infof("Applied the host blueprint to %d files", len(changes))
+	}
+	// systemd only loads the agent config file into the environment when
+	// ecs-init starts
+	for key, value := range hostBlueprint.Environment() {
+		os.Setenv(key, value)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/blueprint"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+var testChanges = []blueprint.Change{
+	{File: "/var/lib/ecs/ecs.config", Current: "ECS_CLUSTER=dev\n", Desired: "ECS_CLUSTER=prod\n"},
+}
+
+func TestConvergeBlueprintWithoutBlueprint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockBlueprint := NewMockhostBlueprint(mockCtrl)
+	mockBlueprint.EXPECT().Load().Return(nil, os.ErrNotExist)
+
+	engine := &Engine{hostBlueprint: mockBlueprint}
+	assert.NoError(t, engine.convergeBlueprint(context.Background(), false))
+}
+
+func TestConvergeBlueprint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	hostBlueprint := &blueprint.Blueprint{Config: map[string]string{"ECS_CLUSTER": "prod"}}
+	mockBlueprint := NewMockhostBlueprint(mockCtrl)
+	gomock.InOrder(
+		mockBlueprint.EXPECT().Load().Return(hostBlueprint, nil),
+		mockBlueprint.EXPECT().Plan(hostBlueprint).Return(testChanges, nil),
+		mockBlueprint.EXPECT().Apply(gomock.Any(), testChanges),
+	)
+
+	engine := &Engine{hostBlueprint: mockBlueprint}
+	assert.NoError(t, engine.convergeBlueprint(context.Background(), false))
+}
+
+func TestConvergeBlueprintDiffOnly(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	hostBlueprint := &blueprint.Blueprint{}
+	mockBlueprint := NewMockhostBlueprint(mockCtrl)
+	gomock.InOrder(
+		mockBlueprint.EXPECT().Load().Return(hostBlueprint, nil),
+		mockBlueprint.EXPECT().Plan(hostBlueprint).Return(testChanges, nil),
+	)
+	mockBlueprint.EXPECT().Apply(gomock.Any(), gomock.Any()).Times(0)
+
+	engine := &Engine{hostBlueprint: mockBlueprint}
+	assert.NoError(t, engine.convergeBlueprint(context.Background(), true))
+}
+
+func TestConvergeBlueprintSetsEnvironment(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	t.Setenv(config.AgentEgressEnvVar, config.AgentEgressOpen)
+	hostBlueprint := &blueprint.Blueprint{NetRules: blueprint.NetRules{Egress: config.AgentEgressRestricted}}
+	mockBlueprint := NewMockhostBlueprint(mockCtrl)
+	gomock.InOrder(
+		mockBlueprint.EXPECT().Load().Return(hostBlueprint, nil),
+		mockBlueprint.EXPECT().Plan(hostBlueprint).Return(nil, nil),
+	)
+
+	engine := &Engine{hostBlueprint: mockBlueprint}
+	assert.NoError(t, engine.convergeBlueprint(context.Background(), false))
+	assert.Equal(t, config.AgentEgressRestricted, os.Getenv(config.AgentEgressEnvVar))
+}
+
+func TestConvergeBlueprintInvalid(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockBlueprint := NewMockhostBlueprint(mockCtrl)
+	mockBlueprint.EXPECT().Load().Return(nil, errors.New("test error"))
+
+	engine := &Engine{hostBlueprint: mockBlueprint}
+	assert.Error(t, engine.convergeBlueprint(context.Background(), false))
+}
+
+func TestApplyBlueprintWithoutBlueprint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockBlueprint := NewMockhostBlueprint(mockCtrl)
+	mockBlueprint.EXPECT().Load().Return(nil, os.ErrNotExist)
+
+	engine := &Engine{hostBlueprint: mockBlueprint}
+	assert.Error(t, engine.ApplyBlueprint(context.Background(), false))
+}
+
+func TestPreStartBlueprintFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockBlueprint := NewMockhostBlueprint(mockCtrl)
+	mockBlueprint.EXPECT().Load().Return(nil, errors.New("test error"))
+
+	engine := &Engine{hostBlueprint: mockBlueprint}
+	assert.Error(t, engine.PreStart(context.Background()))
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// bootKind tells how the current boot relates to the previous one seen by
+// ecs-init
+type bootKind string
+
+const (
+	// bootFirst is the first boot of an instance seen by ecs-init
+	bootFirst bootKind = "first-boot"
+	// bootReboot is a boot of the instance that ecs-init saw boot before
+	bootReboot bootKind = "reboot"
+	// bootRestart is a run of ecs-init in a boot it already saw, e.g. once
+	// the service is restarted
+	bootRestart bootKind = "restart"
+	// bootClone is the first boot of an instance launched from an image of
+	// another instance that ecs-init ran on
+	bootClone bootKind = "clone"
+
+	bootStatePerm = 0644
+)
+
+// bootRecord is the last boot seen by ecs-init, as recorded in the boot state
+type bootRecord struct {
+	BootID     string   `json:"bootId"`
+	InstanceID string   `json:"instanceId,omitempty"`
+	Kind       bootKind `json:"kind"`
+	// Boots is the sequence number of the boot among the boots of the
+	// instance seen by ecs-init, starting at 1
+	Boots int `json:"boots"`
+	// ClonedFrom is the instance the image of the instance was taken from,
+	// when Kind is bootClone
+	ClonedFrom string `json:"clonedFrom,omitempty"`
+}
+
+// trackBoot classifies the current boot against the recorded one and records
+// it. The instance ID tells an instance launched from an image of a
+// registered host apart from a reboot of that host, and the registration of
+// such a clone is verified once the Agent is started, see cloneBoot.
+func (e *Engine) trackBoot() error {
+	bootID, err := readBootID(e.bootIDFile)
+	if err != nil {
+		return err
+	}
+	instanceID, err := e.downloader.InstanceID()
+	if err != nil {
+		log.Warnf("Cannot tell a reboot from a clone of another instance: %v", err)
+	}
+	previous, err := readBootRecord()
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("Could not read the previous boot, treating this boot as the first: %v", err)
+	}
+	current := classifyBoot(previous, bootID, instanceID)
+	switch current.Kind {
+	case bootClone:
+		log.Warnf("Instance %s was launched from an image of instance %s, its registration will be verified",
+			instanceID, current.ClonedFrom)
+	case bootRestart:
+		log.Debugf("Boot %d of the instance was already seen", current.Boots)
+	default:
+		log.Infof("Boot %d of the instance is a %s", current.Boots, current.Kind)
+	}
+	data, err := json.Marshal(current)
+	if err != nil {
+		return errors.Wrap(err, "could not encode the boot state")
+	}
+	return e.statusWriter.WriteFile(config.BootState(), data, bootStatePerm)
+}
+
+// classifyBoot returns the record of the boot bootID of instanceID following
+// previous, which is nil before the first boot. An unknown instance ID is
+// assumed to be unchanged.
+func classifyBoot(previous *bootRecord, bootID, instanceID string) *bootRecord {
+	current := &bootRecord{
+		BootID:     bootID,
+		InstanceID: instanceID,
+		Kind:       bootFirst,
+		Boots:      1,
+	}
+	if previous == nil {
+		return current
+	}
+	if instanceID == "" {
+		current.InstanceID = previous.InstanceID
+	}
+	switch {
+	case previous.InstanceID != "" && current.InstanceID != previous.InstanceID:
+		current.Kind = bootClone
+		current.ClonedFrom = previous.InstanceID
+	case previous.BootID == bootID:
+		// the first boot of a clone stays a clone across restarts, so that
+		// its registration is verified whenever the Agent is started
+		current.Kind = bootRestart
+		current.Boots = previous.Boots
+		if previous.Kind == bootClone {
+			current.Kind = bootClone
+			current.ClonedFrom = previous.ClonedFrom
+		}
+	default:
+		current.Kind = bootReboot
+		current.Boots = previous.Boots + 1
+	}
+	return current
+}
+
+// cloneBoot returns true when the current boot is the first boot of a clone
+// of another instance, whose registration has to be verified
+func (e *Engine) cloneBoot() bool {
+	if e.bootIDFile == "" {
+		return false
+	}
+	bootID, err := readBootID(e.bootIDFile)
+	if err != nil {
+		return false
+	}
+	record, err := readBootRecord()
+	if err != nil {
+		return false
+	}
+	return record.BootID == bootID && record.Kind == bootClone
+}
+
+func readBootID(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", errors.Wrap(err, "could not read the boot ID")
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func readBootRecord() (*bootRecord, error) {
+	data, err := ioutil.ReadFile(config.BootState())
+	if err != nil {
+		return nil, err
+	}
+	record := &bootRecord{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode the boot state")
+	}
+	return record, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyBoot(t *testing.T) {
+	cases := []struct {
+		name       string
+		previous   *bootRecord
+		instanceID string
+		expected   *bootRecord
+	}{
+		{
+			name:       "first boot",
+			instanceID: "i-1",
+			expected:   &bootRecord{BootID: "b", InstanceID: "i-1", Kind: bootFirst, Boots: 1},
+		},
+		{
+			name:       "reboot",
+			previous:   &bootRecord{BootID: "a", InstanceID: "i-1", Kind: bootFirst, Boots: 1},
+			instanceID: "i-1",
+			expected:   &bootRecord{BootID: "b", InstanceID: "i-1", Kind: bootReboot, Boots: 2},
+		},
+		{
+			name:       "restart",
+			previous:   &bootRecord{BootID: "b", InstanceID: "i-1", Kind: bootReboot, Boots: 2},
+			instanceID: "i-1",
+			expected:   &bootRecord{BootID: "b", InstanceID: "i-1", Kind: bootRestart, Boots: 2},
+		},
+		{
+			name:       "clone",
+			previous:   &bootRecord{BootID: "a", InstanceID: "i-1", Kind: bootReboot, Boots: 5},
+			instanceID: "i-2",
+			expected:   &bootRecord{BootID: "b", InstanceID: "i-2", Kind: bootClone, Boots: 1, ClonedFrom: "i-1"},
+		},
+		{
+			name:       "restart of a clone",
+			previous:   &bootRecord{BootID: "b", InstanceID: "i-2", Kind: bootClone, Boots: 1, ClonedFrom: "i-1"},
+			instanceID: "i-2",
+			expected:   &bootRecord{BootID: "b", InstanceID: "i-2", Kind: bootClone, Boots: 1, ClonedFrom: "i-1"},
+		},
+		{
+			name:     "unknown instance",
+			previous: &bootRecord{BootID: "a", InstanceID: "i-1", Kind: bootFirst, Boots: 1},
+			expected: &bootRecord{BootID: "b", InstanceID: "i-1", Kind: bootReboot, Boots: 2},
+		},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, classifyBoot(test.previous, "b", test.instanceID))
+		})
+	}
+}
+
+func TestTrackBoot(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dir := t.TempDir()
+	bootIDFile := filepath.Join(dir, "boot_id")
+	require.NoError(t, ioutil.WriteFile(bootIDFile, []byte("2ae3c7a4-5c4b-4b4e-9d0b-7a8c1f0e6d21\n"), 0644))
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().InstanceID().Return("i-1", nil)
+	mockStatusWriter := NewMockstatusWriter(mockCtrl)
+	mockStatusWriter.EXPECT().WriteFile(config.BootState(), gomock.Any(), os.FileMode(bootStatePerm)).Do(
+		func(filename string, data []byte, perm os.FileMode) {
+			var record bootRecord
+			assert.NoError(t, json.Unmarshal(data, &record))
+			assert.Equal(t, "2ae3c7a4-5c4b-4b4e-9d0b-7a8c1f0e6d21", record.BootID)
+			assert.Equal(t, "i-1", record.InstanceID)
+		}).Return(nil)
+
+	engine := &Engine{
+		downloader:   mockDownloader,
+		statusWriter: mockStatusWriter,
+		bootIDFile:   bootIDFile,
+	}
+	assert.NoError(t, engine.trackBoot())
+}
+
+func TestTrackBootWithoutBootID(t *testing.T) {
+	engine := &Engine{bootIDFile: "/nonexistent/boot_id"}
+	assert.Error(t, engine.trackBoot())
+}
+
+func TestCloneBootNotTracked(t *testing.T) {
+	engine := &Engine{}
+	assert.False(t, engine.cloneBoot())
+}
@@ -0,0 +1,216 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"golang.org/x/sys/unix"
+)
+
+// milestones of bootstrapping the Agent in a boot, in the order they are
+// reached
+const (
+	milestoneCacheChecked    = "cache-checked"
+	milestoneDownloadStarted = "download-started"
+	milestoneDownloaded      = "downloaded"
+	milestoneImageLoaded     = "image-loaded"
+	milestoneContainerStart  = "container-start"
+	milestoneAgentConnected  = "agent-connected"
+
+	bootReportPerm = 0644
+)
+
+// uptime returns how long ago the instance booted
+var uptime = func() (time.Duration, error) {
+	var info unix.Sysinfo_t
+	err := unix.Sysinfo(&info)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(info.Uptime) * time.Second, nil
+}
+
+// bootReport is when the milestones of bootstrapping the Agent were reached
+// in a boot, as written to the boot report. The report is complete once the
+// Agent connected, later milestones, e.g. of upgrades, are not reported.
+type bootReport struct {
+	BootID string `json:"bootId"`
+	// Booted is when the instance booted, to the second
+	Booted     time.Time       `json:"booted"`
+	Milestones []bootMilestone `json:"milestones"`
+	Complete   bool            `json:"complete,omitempty"`
+}
+
+// bootMilestone is a milestone of the boot report
+type bootMilestone struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+	// SinceBoot is the number of seconds from the boot to the milestone
+	SinceBoot float64 `json:"sinceBoot"`
+	// SincePrevious is the number of seconds from the previous milestone,
+	// or from the boot for the first one
+	SincePrevious float64 `json:"sincePrevious"`
+}
+
+// addMilestone returns report with the milestone name reached at now in the
+// boot bootID, which booted at booted. A report of another boot is replaced.
+// It returns false when the milestone is not reported because it was
+// reported already or the report is complete.
+func addMilestone(report *bootReport, bootID string, booted time.Time, name string, now time.Time) (*bootReport, bool) {
+	if report == nil || report.BootID != bootID {
+		report = &bootReport{BootID: bootID, Booted: booted}
+	}
+	if report.Complete {
+		return report, false
+	}
+	previous := report.Booted
+	for _, milestone := range report.Milestones {
+		if milestone.Name == name {
+			return report, false
+		}
+		previous = milestone.Time
+	}
+	report.Milestones = append(report.Milestones, bootMilestone{
+		Name:          name,
+		Time:          now,
+		SinceBoot:     now.Sub(report.Booted).Seconds(),
+		SincePrevious: now.Sub(previous).Seconds(),
+	})
+	report.Complete = name == milestoneAgentConnected
+	return report, true
+}
+
+// summary returns a line summarizing the durations of the report
+func (report *bootReport) summary() string {
+	durations := make([]string, 0, len(report.Milestones))
+	for _, milestone := range report.Milestones {
+		durations = append(durations, fmt.Sprintf("%s at %.1fs (+%.1fs)",
+			milestone.Name, milestone.SinceBoot, milestone.SincePrevious))
+	}
+	return strings.Join(durations, ", ")
+}
+
+// recordMilestone reports that the milestone name of bootstrapping the Agent
+// was reached, in the boot report of the current boot. The summary of the
+// report is logged once it is complete. Milestones are reported on a best
+// effort basis.
+func (e *Engine) recordMilestone(name string) {
+	if e.bootIDFile == "" {
+		return
+	}
+	bootID, err := readBootID(e.bootIDFile)
+	if err != nil {
+		log.Debugf("Not reporting milestone %s: %v", name, err)
+		return
+	}
+	previous, err := readBootReport()
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("Could not read the boot report, starting over: %v", err)
+	}
+	now := e.clk().Now()
+	var booted time.Time
+	if previous == nil || previous.BootID != bootID {
+		up, err := uptime()
+		if err != nil {
+			log.Warnf("Not reporting milestone %s: could not read the uptime: %v", name, err)
+			return
+		}
+		booted = now.Add(-up).Truncate(time.Second)
+	}
+	report, added := addMilestone(previous, bootID, booted, name, now)
+	if !added {
+		return
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		log.Warnf("Could not encode the boot report: %v", err)
+		return
+	}
+	err = e.statusWriter.WriteFile(config.BootReport(), data, bootReportPerm)
+	if err != nil {
+		log.Warnf("Could not write the boot report: %v", err)
+	}
+	if report.Complete {
+		log.Infof("Boot report: %s", report.summary())
+	}
+}
+
+// bootReportComplete returns true when the Agent connected in the current
+// boot already
+func (e *Engine) bootReportComplete() bool {
+	bootID, err := readBootID(e.bootIDFile)
+	if err != nil {
+		return false
+	}
+	report, err := readBootReport()
+	if err != nil {
+		return false
+	}
+	return report.BootID == bootID && report.Complete
+}
+
+// startConnectionReport waits in the background for the Agent to register
+// the instance and reports that it connected, completing the boot report.
+// The returned function stops waiting.
+func (e *Engine) startConnectionReport(ctx context.Context) func() {
+	if e.bootIDFile == "" || e.bootReportComplete() {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := e.clk().NewTicker(registrationPollInterval)
+		defer ticker.Stop()
+		for {
+			metadata, err := e.agentMetadata.Metadata()
+			if err == nil && metadata.ContainerInstanceArn != "" {
+				e.recordMilestone(milestoneAgentConnected)
+				return
+			}
+			select {
+			case <-ticker.C():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func readBootReport() (*bootReport, error) {
+	data, err := ioutil.ReadFile(config.BootReport())
+	if err != nil {
+		return nil, err
+	}
+	report := &bootReport{}
+	err = json.Unmarshal(data, report)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the boot report: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddMilestone(t *testing.T) {
+	booted := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	report, added := addMilestone(nil, "b", booted, milestoneCacheChecked, booted.Add(20*time.Second))
+	assert.True(t, added)
+	report, added = addMilestone(report, "b", time.Time{}, milestoneDownloadStarted, booted.Add(21*time.Second))
+	assert.True(t, added)
+	// a milestone is reported once
+	report, added = addMilestone(report, "b", time.Time{}, milestoneCacheChecked, booted.Add(30*time.Second))
+	assert.False(t, added)
+	report, added = addMilestone(report, "b", time.Time{}, milestoneAgentConnected, booted.Add(45*time.Second))
+	assert.True(t, added)
+
+	assert.Equal(t, &bootReport{
+		BootID: "b",
+		Booted: booted,
+		Milestones: []bootMilestone{
+			{Name: milestoneCacheChecked, Time: booted.Add(20 * time.Second), SinceBoot: 20, SincePrevious: 20},
+			{Name: milestoneDownloadStarted, Time: booted.Add(21 * time.Second), SinceBoot: 21, SincePrevious: 1},
+			{Name: milestoneAgentConnected, Time: booted.Add(45 * time.Second), SinceBoot: 45, SincePrevious: 24},
+		},
+		Complete: true,
+	}, report)
+	assert.Equal(t, "cache-checked at 20.0s (+20.0s), download-started at 21.0s (+1.0s), agent-connected at 45.0s (+24.0s)",
+		report.summary())
+
+	// the milestones of upgrades after the Agent connected are not reported
+	_, added = addMilestone(report, "b", time.Time{}, milestoneDownloadStarted, booted.Add(time.Hour))
+	assert.False(t, added)
+}
+
+func TestAddMilestoneNewBoot(t *testing.T) {
+	booted := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	previous := &bootReport{
+		BootID:     "a",
+		Booted:     booted.Add(-24 * time.Hour),
+		Milestones: []bootMilestone{{Name: milestoneAgentConnected}},
+		Complete:   true,
+	}
+	report, added := addMilestone(previous, "b", booted, milestoneCacheChecked, booted.Add(10*time.Second))
+	assert.True(t, added)
+	assert.Equal(t, "b", report.BootID)
+	assert.False(t, report.Complete)
+	assert.Len(t, report.Milestones, 1)
+}
+
+func TestRecordMilestone(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	bootIDFile := writeBootID(t)
+	defer func(f func() (time.Duration, error)) { uptime = f }(uptime)
+	uptime = func() (time.Duration, error) { return 90 * time.Second, nil }
+	now := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	mockStatusWriter := NewMockstatusWriter(mockCtrl)
+	mockStatusWriter.EXPECT().WriteFile(config.BootReport(), gomock.Any(), os.FileMode(bootReportPerm)).Do(
+		func(filename string, data []byte, perm os.FileMode) {
+			var report bootReport
+			require.NoError(t, json.Unmarshal(data, &report))
+			assert.Equal(t, "2ae3c7a4-5c4b-4b4e-9d0b-7a8c1f0e6d21", report.BootID)
+			assert.True(t, now.Add(-90*time.Second).Equal(report.Booted))
+			require.Len(t, report.Milestones, 1)
+			assert.Equal(t, milestoneCacheChecked, report.Milestones[0].Name)
+			assert.Equal(t, float64(90), report.Milestones[0].SinceBoot)
+		}).Return(nil)
+
+	engine := &Engine{
+		statusWriter: mockStatusWriter,
+		bootIDFile:   bootIDFile,
+		clock:        clock.NewFake(now),
+	}
+	engine.recordMilestone(milestoneCacheChecked)
+}
+
+func TestRecordMilestoneNotTracked(t *testing.T) {
+	// the boot report is not written without a boot ID
+	engine := &Engine{}
+	engine.recordMilestone(milestoneCacheChecked)
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+const bootstrapStatePerm = 0644
+
+// ErrBootstrapDeadline is wrapped by errors returned when the Agent was not
+// healthy within the bootstrap deadline, see config.BootstrapDeadline
+var ErrBootstrapDeadline = errors.New("bootstrap deadline exceeded")
+
+// bootstrapRecord is the bootstrap of the Agent in a boot, as recorded in the
+// bootstrap state
+type bootstrapRecord struct {
+	BootID string `json:"bootId"`
+	// Started is when the bootstrap started, by the first pre-start or
+	// start of the boot
+	Started time.Time `json:"started"`
+	// Completed is set once the Agent was healthy in the boot
+	Completed bool `json:"completed,omitempty"`
+}
+
+// nextBootstrap returns the bootstrap in the boot bootID following previous,
+// which is nil when no bootstrap was recorded. The bootstrap of a new boot
+// starts at now.
+func nextBootstrap(previous *bootstrapRecord, bootID string, now time.Time) *bootstrapRecord {
+	if previous != nil && previous.BootID == bootID {
+		return previous
+	}
+	return &bootstrapRecord{BootID: bootID, Started: now}
+}
+
+// bootstrapDeadline returns when the bootstrap of the Agent in the current
+// boot runs out. It returns false when there is no deadline, the boot is not
+// tracked or the Agent was healthy in the boot already.
+func (e *Engine) bootstrapDeadline() (time.Time, bool) {
+	budget, err := config.BootstrapDeadline()
+	if err != nil {
+		log.Warnf("Not enforcing a bootstrap deadline: %v", err)
+		return time.Time{}, false
+	}
+	if budget == 0 || e.bootIDFile == "" {
+		return time.Time{}, false
+	}
+	record, err := e.currentBootstrap()
+	if err != nil {
+		log.Warnf("Not enforcing a bootstrap deadline: %v", err)
+		return time.Time{}, false
+	}
+	if record.Completed {
+		return time.Time{}, false
+	}
+	return record.Started.Add(budget), true
+}
+
+// withBootstrapDeadline returns a copy of ctx that is done once the
+// bootstrap deadline passes, if there is one
+func (e *Engine) withBootstrapDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := e.bootstrapDeadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	log.Debugf("Bootstrapping the Agent until %s", deadline.Format(time.RFC3339))
+	return context.WithDeadline(ctx, deadline)
+}
+
+// bootstrapError wraps err in ErrBootstrapDeadline when it was returned
+// because ctx passed its deadline
+func bootstrapError(ctx context.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrBootstrapDeadline, err)
+	}
+	return err
+}
+
+// completeBootstrap records that the Agent was healthy in the current boot,
+// which lifts the bootstrap deadline until the next boot
+func (e *Engine) completeBootstrap() {
+	budget, err := config.BootstrapDeadline()
+	if err != nil || budget == 0 || e.bootIDFile == "" {
+		return
+	}
+	record, err := e.currentBootstrap()
+	if err != nil {
+		log.Warnf("Could not record the bootstrap of the Agent: %v", err)
+		return
+	}
+	if record.Completed {
+		return
+	}
+	record.Completed = true
+	err = e.writeBootstrapRecord(record)
+	if err != nil {
+		log.Warnf("Could not record the bootstrap of the Agent: %v", err)
+	}
+}
+
+// currentBootstrap returns the bootstrap of the current boot, recording it
+// when the boot has not started one yet
+func (e *Engine) currentBootstrap() (*bootstrapRecord, error) {
+	bootID, err := readBootID(e.bootIDFile)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := readBootstrapRecord()
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("Could not read the previous bootstrap, starting over: %v", err)
+	}
+	current := nextBootstrap(previous, bootID, e.clk().Now())
+	if current == previous {
+		return current, nil
+	}
+	return current, e.writeBootstrapRecord(current)
+}
+
+func (e *Engine) writeBootstrapRecord(record *bootstrapRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("could not encode the bootstrap state: %w", err)
+	}
+	return e.statusWriter.WriteFile(config.BootstrapState(), data, bootstrapStatePerm)
+}
+
+func readBootstrapRecord() (*bootstrapRecord, error) {
+	data, err := ioutil.ReadFile(config.BootstrapState())
+	if err != nil {
+		return nil, err
+	}
+	record := &bootstrapRecord{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the bootstrap state: %w", err)
+	}
+	return record, nil
+}
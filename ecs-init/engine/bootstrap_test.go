@@ -0,0 +1,134 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextBootstrap(t *testing.T) {
+	now := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+	cases := []struct {
+		name     string
+		previous *bootstrapRecord
+		expected *bootstrapRecord
+	}{
+		{
+			name:     "first bootstrap",
+			expected: &bootstrapRecord{BootID: "b", Started: now},
+		},
+		{
+			name:     "same boot",
+			previous: &bootstrapRecord{BootID: "b", Started: earlier},
+			expected: &bootstrapRecord{BootID: "b", Started: earlier},
+		},
+		{
+			name:     "completed in the same boot",
+			previous: &bootstrapRecord{BootID: "b", Started: earlier, Completed: true},
+			expected: &bootstrapRecord{BootID: "b", Started: earlier, Completed: true},
+		},
+		{
+			name:     "new boot",
+			previous: &bootstrapRecord{BootID: "a", Started: earlier, Completed: true},
+			expected: &bootstrapRecord{BootID: "b", Started: now},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, nextBootstrap(test.previous, "b", now))
+		})
+	}
+}
+
+func writeBootID(t *testing.T) string {
+	bootIDFile := filepath.Join(t.TempDir(), "boot_id")
+	require.NoError(t, ioutil.WriteFile(bootIDFile, []byte("2ae3c7a4-5c4b-4b4e-9d0b-7a8c1f0e6d21\n"), 0644))
+	return bootIDFile
+}
+
+func TestBootstrapDeadline(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.BootstrapDeadlineEnvVar, "15m")
+	defer os.Unsetenv(config.BootstrapDeadlineEnvVar)
+	bootIDFile := writeBootID(t)
+	now := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	mockStatusWriter := NewMockstatusWriter(mockCtrl)
+	mockStatusWriter.EXPECT().WriteFile(config.BootstrapState(), gomock.Any(), os.FileMode(bootstrapStatePerm)).Do(
+		func(filename string, data []byte, perm os.FileMode) {
+			var record bootstrapRecord
+			assert.NoError(t, json.Unmarshal(data, &record))
+			assert.Equal(t, "2ae3c7a4-5c4b-4b4e-9d0b-7a8c1f0e6d21", record.BootID)
+			assert.True(t, now.Equal(record.Started))
+			assert.False(t, record.Completed)
+		}).Return(nil)
+
+	engine := &Engine{
+		statusWriter: mockStatusWriter,
+		bootIDFile:   bootIDFile,
+		clock:        clock.NewFake(now),
+	}
+	deadline, ok := engine.bootstrapDeadline()
+	assert.True(t, ok)
+	assert.True(t, now.Add(15*time.Minute).Equal(deadline))
+}
+
+func TestBootstrapDeadlineDisabled(t *testing.T) {
+	os.Unsetenv(config.BootstrapDeadlineEnvVar)
+	bootIDFile := writeBootID(t)
+
+	engine := &Engine{bootIDFile: bootIDFile}
+	_, ok := engine.bootstrapDeadline()
+	assert.False(t, ok)
+}
+
+func TestBootstrapDeadlineWithoutBootID(t *testing.T) {
+	os.Setenv(config.BootstrapDeadlineEnvVar, "15m")
+	defer os.Unsetenv(config.BootstrapDeadlineEnvVar)
+
+	engine := &Engine{bootIDFile: "/nonexistent/boot_id"}
+	_, ok := engine.bootstrapDeadline()
+	assert.False(t, ok)
+}
+
+func TestBootstrapError(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	<-ctx.Done()
+	err := bootstrapError(ctx, errors.New("download failed"))
+	assert.True(t, errors.Is(err, ErrBootstrapDeadline), "Expect the bootstrap deadline, got: %v", err)
+	assert.NoError(t, bootstrapError(ctx, nil))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = bootstrapError(ctx, context.Canceled)
+	assert.False(t, errors.Is(err, ErrBootstrapDeadline))
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	log "github.com/cihub/seelog"
+)
+
+// GCCache removes the files of the cache that are no longer needed and
+// reports the space reclaimed
+func (e *Engine) GCCache(ctx context.Context) error {
+	report, err := e.downloader.CollectGarbage(ctx)
+	if err != nil {
+		return engineError("could not collect the garbage of the cache", err)
+	}
+	log.Infof("Removed %d files from the cache, reclaiming %d bytes", len(report.Files), report.ReclaimedBytes)
+	return nil
+}
+
+// collectCacheGarbage collects the garbage of the cache once the Agent is
+// stopped. Failures are only logged, as the cache is still usable.
+func (e *Engine) collectCacheGarbage(ctx context.Context) {
+	if e.downloader == nil {
+		return
+	}
+	report, err := e.downloader.CollectGarbage(ctx)
+	if err != nil {
+		log.Warnf("Could not collect the garbage of the cache: %v", err)
+		return
+	}
+	if len(report.Files) > 0 {
+		log.Infof("Removed %d files from the cache, reclaiming %d bytes", len(report.Files), report.ReclaimedBytes)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGCCache(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().CollectGarbage(gomock.Any()).Return(&cache.GarbageReport{
+		Files:          []string{"/var/cache/ecs/state123"},
+		ReclaimedBytes: 10,
+	}, nil)
+
+	engine := &Engine{downloader: mockDownloader}
+	assert.NoError(t, engine.GCCache(context.Background()))
+}
+
+func TestGCCacheError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().CollectGarbage(gomock.Any()).Return(nil, errors.New("test error"))
+
+	engine := &Engine{downloader: mockDownloader}
+	assert.Error(t, engine.GCCache(context.Background()))
+}
+
+func TestPostStopCollectsCacheGarbage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
+	mockLoopbackRouting.EXPECT().RestoreDefault().Return(nil)
+	mockRoute := NewMockcredentialsProxyRoute(mockCtrl)
+	mockRoute.EXPECT().Remove().Return(nil)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	// a failure to collect the garbage does not fail post-stop
+	mockDownloader.EXPECT().CollectGarbage(gomock.Any()).Return(nil, errors.New("test error"))
+
+	engine := &Engine{
+		loopbackRouting:       mockLoopbackRouting,
+		credentialsProxyRoute: mockRoute,
+		downloader:            mockDownloader,
+	}
+	assert.NoError(t, engine.PostStop(context.Background()))
+}
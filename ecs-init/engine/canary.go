@@ -0,0 +1,196 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const canaryStatePerm = 0644
+
+// canaryFailure is the last canary Agent that failed, as recorded in the
+// canary state. The instance runs the stable Agent instead of that version.
+type canaryFailure struct {
+	Version  string    `json:"version"`
+	FailedAt time.Time `json:"failedAt"`
+	Error    string    `json:"error"`
+}
+
+// canaryBucket places the instance in a bucket from 0 to 100, with a
+// hundredth of a percent of resolution. The bucket only depends on the
+// instance ID, so that raising the rollout percentage only adds instances to
+// the canary.
+func canaryBucket(instanceID string) float64 {
+	hash := fnv.New32a()
+	hash.Write([]byte(instanceID))
+	return float64(hash.Sum32()%10000) / 100
+}
+
+// parseRolloutPercentage parses the percentage of the instances that run the
+// canary Agent, e.g. "5" or "12.5%"
+func parseRolloutPercentage(value string) (float64, error) {
+	value = strings.TrimSuffix(strings.TrimSpace(value), "%")
+	percentage, err := strconv.ParseFloat(value, 64)
+	if err != nil || percentage < 0 || percentage > 100 {
+		return 0, errors.Errorf("invalid rollout percentage %q, expected a number from 0 to 100", value)
+	}
+	return percentage, nil
+}
+
+// pinCanaryAgent pins the version of the canary Agent instead of the pinned
+// version when the instance is in the rollout of the canary Agent. Instances
+// whose canary Agent failed keep running the stable Agent until another
+// canary Agent is rolled out.
+func (e *Engine) pinCanaryAgent() {
+	version, parameter, err := config.CanaryAgent()
+	if err != nil {
+		log.Warnf("Not running a canary Agent: %v", err)
+		return
+	}
+	if version == "" {
+		return
+	}
+	stable := e.downloader.AgentVersion()
+	if version == stable {
+		return
+	}
+	if e.offline {
+		log.Warnf("Not running the canary Agent %s in offline mode", version)
+		return
+	}
+	failure, err := readCanaryFailure()
+	if err == nil && failure.Version == version {
+		log.Infof("Running the stable Agent %s, the canary Agent %s failed: %s", stable, version, failure.Error)
+		return
+	}
+	instanceID, err := e.downloader.InstanceID()
+	if err != nil {
+		log.Warnf("Not running the canary Agent %s: could not get the instance ID: %v", version, err)
+		return
+	}
+	value, err := e.parameterValue(parameter)
+	if err != nil {
+		log.Warnf("Not running the canary Agent %s: %v", version, err)
+		return
+	}
+	percentage, err := parseRolloutPercentage(value)
+	if err != nil {
+		log.Warnf("Not running the canary Agent %s: %v", version, err)
+		return
+	}
+	if canaryBucket(instanceID) >= percentage {
+		log.Debugf("The instance is not in the %v%% rollout of the canary Agent %s", percentage, version)
+		return
+	}
+	log.Infof("Running the canary Agent %s instead of %s, the instance is in its %v%% rollout",
+		version, stable, percentage)
+	e.stableAgentVersion = stable
+	e.downloader.PinAgentVersion(version)
+}
+
+// resumeCanary pins the canary Agent again in the supervisor when pre-start
+// cached it, so that the supervised Agent falls back to the stable Agent when
+// it fails
+func (e *Engine) resumeCanary() {
+	if e.stableAgentVersion != "" {
+		return
+	}
+	version, _, err := config.CanaryAgent()
+	if err != nil || version == "" {
+		return
+	}
+	if e.downloader.CachedAgent().Version != version {
+		return
+	}
+	e.pinAgentVersion(e.docker.LoadEnvVars())
+	stable := e.downloader.AgentVersion()
+	if stable == version {
+		return
+	}
+	e.stableAgentVersion = stable
+	e.downloader.PinAgentVersion(version)
+}
+
+// abandonCanary records that the canary Agent failed with cause and pins the
+// stable Agent back. It returns false when the canary Agent is not running.
+func (e *Engine) abandonCanary(cause error) bool {
+	if e.stableAgentVersion == "" {
+		return false
+	}
+	canary := e.downloader.AgentVersion()
+	log.Warnf("Falling back from the canary Agent %s to the stable Agent %s: %v", canary, e.stableAgentVersion, cause)
+	e.recordCanaryFailure(canary, cause)
+	e.downloader.PinAgentVersion(e.stableAgentVersion)
+	e.stableAgentVersion = ""
+	return true
+}
+
+// fallBackFromCanary abandons the canary Agent after it failed with cause and
+// loads the stable Agent into Docker, downloading it if it is not cached.
+// cause is returned if the canary Agent is not running.
+func (e *Engine) fallBackFromCanary(ctx context.Context, cause error) error {
+	if !e.abandonCanary(cause) {
+		return cause
+	}
+	if e.downloader.AgentCacheStatus() == cache.StatusUncached {
+		return e.downloadAndLoadCache(ctx)
+	}
+	return e.load(ctx, e.downloader.LoadCachedAgent)
+}
+
+// recordCanaryFailure records the canary Agent that failed, so that later
+// boots run the stable Agent
+func (e *Engine) recordCanaryFailure(version string, cause error) {
+	if e.statusWriter == nil {
+		return
+	}
+	data, err := json.Marshal(canaryFailure{
+		Version:  version,
+		FailedAt: e.clk().Now().UTC(),
+		Error:    cause.Error(),
+	})
+	if err != nil {
+		log.Warnf("Could not encode the canary state: %v", err)
+		return
+	}
+	err = e.statusWriter.WriteFile(config.CanaryState(), data, canaryStatePerm)
+	if err != nil {
+		log.Warnf("Could not record the failure of the canary Agent: %v", err)
+	}
+}
+
+func readCanaryFailure() (*canaryFailure, error) {
+	data, err := ioutil.ReadFile(config.CanaryState())
+	if err != nil {
+		return nil, err
+	}
+	failure := &canaryFailure{}
+	err = json.Unmarshal(data, failure)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode the canary state")
+	}
+	return failure, nil
+}
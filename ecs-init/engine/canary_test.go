@@ -0,0 +1,191 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setCanaryAgent(t *testing.T) {
+	t.Setenv(config.CanaryAgentVersionEnvVar, "1.77.0")
+	t.Setenv(config.CanaryRolloutParameterEnvVar, "/ecs/canary-rollout")
+}
+
+func TestCanaryBucket(t *testing.T) {
+	bucket := canaryBucket("i-0123456789abcdef0")
+	assert.Equal(t, bucket, canaryBucket("i-0123456789abcdef0"))
+	assert.True(t, bucket >= 0 && bucket < 100)
+	assert.NotEqual(t, bucket, canaryBucket("i-0fedcba9876543210"))
+}
+
+func TestParseRolloutPercentage(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected float64
+		isErr    bool
+	}{
+		{"0", 0, false},
+		{"5", 5, false},
+		{" 12.5% ", 12.5, false},
+		{"100", 100, false},
+		{"101", 0, true},
+		{"-1", 0, true},
+		{"half", 0, true},
+	}
+	for _, test := range cases {
+		percentage, err := parseRolloutPercentage(test.value)
+		if test.isErr {
+			assert.Error(t, err, test.value)
+			continue
+		}
+		assert.NoError(t, err, test.value)
+		assert.Equal(t, test.expected, percentage, test.value)
+	}
+}
+
+func TestPinCanaryAgentInRollout(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	setCanaryAgent(t)
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockParameterStore := NewMockparameterStore(mockCtrl)
+	mockDownloader.EXPECT().AgentVersion().Return("v1.76.0")
+	mockDownloader.EXPECT().InstanceID().Return("i-0123456789abcdef0", nil)
+	mockParameterStore.EXPECT().GetParameterValue("/ecs/canary-rollout").Return("100", nil)
+	mockDownloader.EXPECT().PinAgentVersion("v1.77.0")
+
+	engine := &Engine{
+		downloader:     mockDownloader,
+		parameterStore: mockParameterStore,
+	}
+	engine.pinCanaryAgent()
+	assert.Equal(t, "v1.76.0", engine.stableAgentVersion)
+}
+
+func TestPinCanaryAgentOutOfRollout(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	setCanaryAgent(t)
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockParameterStore := NewMockparameterStore(mockCtrl)
+	mockDownloader.EXPECT().AgentVersion().Return("v1.76.0")
+	mockDownloader.EXPECT().InstanceID().Return("i-0123456789abcdef0", nil)
+	mockParameterStore.EXPECT().GetParameterValue("/ecs/canary-rollout").Return("0", nil)
+
+	engine := &Engine{
+		downloader:     mockDownloader,
+		parameterStore: mockParameterStore,
+	}
+	engine.pinCanaryAgent()
+	assert.Empty(t, engine.stableAgentVersion)
+}
+
+func TestPinCanaryAgentParameterError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	setCanaryAgent(t)
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockParameterStore := NewMockparameterStore(mockCtrl)
+	mockDownloader.EXPECT().AgentVersion().Return("v1.76.0")
+	mockDownloader.EXPECT().InstanceID().Return("i-0123456789abcdef0", nil)
+	mockParameterStore.EXPECT().GetParameterValue("/ecs/canary-rollout").Return("", errors.New("throttled"))
+
+	engine := &Engine{
+		downloader:     mockDownloader,
+		parameterStore: mockParameterStore,
+	}
+	engine.pinCanaryAgent()
+	assert.Empty(t, engine.stableAgentVersion)
+}
+
+func TestResumeCanary(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	setCanaryAgent(t)
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	gomock.InOrder(
+		mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{Version: "v1.77.0"}),
+		mockDocker.EXPECT().LoadEnvVars().Return(nil),
+		mockDownloader.EXPECT().AgentVersion().Return("v1.76.0"),
+		mockDownloader.EXPECT().PinAgentVersion("v1.77.0"),
+	)
+
+	engine := &Engine{
+		docker:     mockDocker,
+		downloader: mockDownloader,
+	}
+	engine.resumeCanary()
+	assert.Equal(t, "v1.76.0", engine.stableAgentVersion)
+}
+
+func TestFallBackFromCanary(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockStatusWriter := NewMockstatusWriter(mockCtrl)
+	// the transitions of the engine are written to the status
+	mockStatusWriter.EXPECT().WriteFile(gomock.Not(config.CanaryState()), gomock.Any(), gomock.Any()).AnyTimes()
+	gomock.InOrder(
+		mockDownloader.EXPECT().AgentVersion().Return("v1.77.0"),
+		mockStatusWriter.EXPECT().WriteFile(config.CanaryState(), gomock.Any(), os.FileMode(canaryStatePerm)).Do(
+			func(filename string, data []byte, perm os.FileMode) {
+				var failure canaryFailure
+				require.NoError(t, json.Unmarshal(data, &failure))
+				assert.Equal(t, "v1.77.0", failure.Version)
+				assert.Equal(t, "crash loop", failure.Error)
+			}).Return(nil),
+		mockDownloader.EXPECT().PinAgentVersion("v1.76.0"),
+		mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusUncached),
+		mockDownloader.EXPECT().DownloadAgent(gomock.Any()),
+		mockDownloader.EXPECT().LoadCachedAgent().Return(ioutil.NopCloser(&bytes.Buffer{}), nil),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any()),
+		mockDownloader.EXPECT().RecordCachedAgent(),
+	)
+
+	engine := &Engine{
+		docker:             mockDocker,
+		downloader:         mockDownloader,
+		statusWriter:       mockStatusWriter,
+		stableAgentVersion: "v1.76.0",
+	}
+	err := engine.fallBackFromCanary(context.Background(), errors.New("crash loop"))
+	assert.NoError(t, err)
+	assert.Empty(t, engine.stableAgentVersion)
+}
+
+func TestFallBackFromCanaryNotRunning(t *testing.T) {
+	cause := errors.New("crash loop")
+	engine := &Engine{}
+	assert.Equal(t, cause, engine.fallBackFromCanary(context.Background(), cause))
+}
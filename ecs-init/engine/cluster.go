@@ -0,0 +1,75 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsclient"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// ensureCluster creates the cluster of the Agent unless it is active.
+// CreateCluster is idempotent, so instances racing to create the same
+// cluster all succeed.
+func (e *Engine) ensureCluster(name string) error {
+	if name == "" {
+		name = config.DefaultClusterName
+	}
+	ecsAPI, err := e.ecsClient()
+	if err != nil {
+		return err
+	}
+
+	output, err := ecsAPI.DescribeClusters(&ecsclient.DescribeClustersInput{
+		Clusters: []string{name},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "could not describe cluster %s", name)
+	}
+	for _, cluster := range output.Clusters {
+		if cluster.Status == ecsclient.ClusterStatusActive {
+			log.Debugf("Cluster %s is active", name)
+			return nil
+		}
+	}
+
+	log.Infof("Creating cluster %s", name)
+	_, err = ecsAPI.CreateCluster(&ecsclient.CreateClusterInput{
+		ClusterName: name,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "could not create cluster %s", name)
+	}
+	return nil
+}
+
+// ecsClient returns the client of the Amazon ECS API, creating it for the
+// region of the instance on first use
+func (e *Engine) ecsClient() (ecsAPI, error) {
+	if e.ecsAPI == nil {
+		region, err := e.downloader.Region()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create ECS client")
+		}
+		client, err := ecsclient.New(region)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create ECS client")
+		}
+		e.ecsAPI = client
+		e.dryRunAWSClients()
+	}
+	return e.ecsAPI, nil
+}
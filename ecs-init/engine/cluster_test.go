@@ -0,0 +1,96 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsclient"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnsureClusterActive(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockECSAPI := NewMockecsAPI(mockCtrl)
+	mockECSAPI.EXPECT().DescribeClusters(&ecsclient.DescribeClustersInput{Clusters: []string{"test"}}).Return(
+		&ecsclient.DescribeClustersOutput{
+			Clusters: []ecsclient.Cluster{{ClusterName: "test", Status: ecsclient.ClusterStatusActive}},
+		}, nil)
+
+	engine := &Engine{ecsAPI: mockECSAPI}
+	assert.NoError(t, engine.ensureCluster("test"))
+}
+
+func TestEnsureClusterCreatesMissingCluster(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockECSAPI := NewMockecsAPI(mockCtrl)
+	gomock.InOrder(
+		mockECSAPI.EXPECT().DescribeClusters(gomock.Any()).Return(
+			&ecsclient.DescribeClustersOutput{
+				Failures: []ecsclient.Failure{{Reason: "MISSING"}},
+			}, nil),
+		mockECSAPI.EXPECT().CreateCluster(&ecsclient.CreateClusterInput{ClusterName: config.DefaultClusterName}).Return(
+			&ecsclient.CreateClusterOutput{}, nil),
+	)
+
+	engine := &Engine{ecsAPI: mockECSAPI}
+	assert.NoError(t, engine.ensureCluster(""))
+}
+
+func TestEnsureClusterRecreatesInactiveCluster(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockECSAPI := NewMockecsAPI(mockCtrl)
+	mockECSAPI.EXPECT().DescribeClusters(gomock.Any()).Return(
+		&ecsclient.DescribeClustersOutput{
+			Clusters: []ecsclient.Cluster{{ClusterName: "test", Status: "INACTIVE"}},
+		}, nil)
+	mockECSAPI.EXPECT().CreateCluster(&ecsclient.CreateClusterInput{ClusterName: "test"}).Return(
+		&ecsclient.CreateClusterOutput{}, nil)
+
+	engine := &Engine{ecsAPI: mockECSAPI}
+	assert.NoError(t, engine.ensureCluster("test"))
+}
+
+func TestEnsureClusterCreateError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockECSAPI := NewMockecsAPI(mockCtrl)
+	mockECSAPI.EXPECT().DescribeClusters(gomock.Any()).Return(&ecsclient.DescribeClustersOutput{}, nil)
+	mockECSAPI.EXPECT().CreateCluster(gomock.Any()).Return(nil, errors.New("test error"))
+
+	engine := &Engine{ecsAPI: mockECSAPI}
+	assert.Error(t, engine.ensureCluster("test"))
+}
+
+func TestEnsureClusterDescribeError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockECSAPI := NewMockecsAPI(mockCtrl)
+	mockECSAPI.EXPECT().DescribeClusters(gomock.Any()).Return(nil, errors.New("test error"))
+
+	engine := &Engine{ecsAPI: mockECSAPI}
+	assert.Error(t, engine.ensureCluster("test"))
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+// agentConfigSettleTime is how long the agent config file has to stay
+// unchanged before a change is acted on, as configuration management may
+// write it several times in a row
+const agentConfigSettleTime = 5 * time.Second
+
+// agentConfigWatch holds the agent config the running Agent was started with
+type agentConfigWatch struct {
+	policy  string
+	lock    sync.Mutex
+	applied map[string]string
+}
+
+// startConfigWatch watches the agent config file while the Agent is
+// supervised and, depending on the policy, restarts the Agent or records the
+// config drift in the engine status when the config changes. The returned
+// function stops watching.
+func (e *Engine) startConfigWatch(ctx context.Context) func() {
+	policy, err := config.ConfigWatch()
+	if err != nil {
+		log.Warnf("Not watching the agent config file: %v", err)
+		return func() {}
+	}
+	if policy == config.ConfigWatchIgnore || e.configWatcher == nil {
+		return func() {}
+	}
+	changes, err := e.configWatcher.Watch(config.AgentConfigFile())
+	if err != nil {
+		log.Warnf("Not watching the agent config file: %v", err)
+		return func() {}
+	}
+	log.Infof("Watching %s for changes (%s)", config.AgentConfigFile(), policy)
+	e.agentConfig = &agentConfigWatch{policy: policy}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var settled <-chan time.Time
+		for {
+			select {
+			case _, ok := <-changes:
+				if !ok {
+					return
+				}
+				settled = e.clk().After(agentConfigSettleTime)
+			case <-settled:
+				settled = nil
+				e.agentConfigChanged(ctx)
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		e.configWatcher.Close()
+	}
+}
+
+// recordAgentConfig records the config the Agent is started with, which
+// resolves any config drift
+func (e *Engine) recordAgentConfig() {
+	if e.agentConfig == nil {
+		return
+	}
+	applied := e.docker.LoadEnvVars()
+	e.agentConfig.lock.Lock()
+	e.agentConfig.applied = applied
+	e.agentConfig.lock.Unlock()
+	if e.state.setConfigDrift(false) {
+		e.writeStatus()
+	}
+}
+
+// agentConfigChanged acts on a change of the agent config file according
+// to the policy. Writes that leave the config as the Agent was started with
+// are ignored.
+func (e *Engine) agentConfigChanged(ctx context.Context) {
+	current := e.docker.LoadEnvVars()
+	e.agentConfig.lock.Lock()
+	changed := !reflect.DeepEqual(current, e.agentConfig.applied)
+	e.agentConfig.lock.Unlock()
+	if !changed {
+		log.Debugf("%s was written without changing the agent config", config.AgentConfigFile())
+		return
+	}
+	switch e.agentConfig.policy {
+	case config.ConfigWatchRestart:
+		log.Infof("%s changed, restarting the Agent to apply it", config.AgentConfigFile())
+		atomic.StoreInt32(&e.configRestartDue, 1)
+		err := e.docker.StopAgent(ctx)
+		if err != nil {
+			log.Warnf("Could not stop the Agent to apply the changed config: %v", err)
+			atomic.StoreInt32(&e.configRestartDue, 0)
+		}
+	case config.ConfigWatchDrift:
+		log.Warnf("%s changed, the Agent runs with the previous config until it is restarted", config.AgentConfigFile())
+		if e.state.setConfigDrift(true) {
+			e.writeStatus()
+		}
+	}
+}
+
+// takeConfigRestart returns true once after the Agent was stopped to apply
+// the changed agent config
+func (e *Engine) takeConfigRestart() bool {
+	return atomic.CompareAndSwapInt32(&e.configRestartDue, 1, 0)
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+var appliedAgentConfig = map[string]string{config.ClusterEnvVar: "default"}
+
+func newTestConfigWatchEngine(mockCtrl *gomock.Controller, policy string) (*Engine, *MockdockerClient) {
+	mockDocker := NewMockdockerClient(mockCtrl)
+	return &Engine{
+		docker:      mockDocker,
+		agentConfig: &agentConfigWatch{policy: policy, applied: appliedAgentConfig},
+	}, mockDocker
+}
+
+func TestAgentConfigChangedRestartsAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	engine, mockDocker := newTestConfigWatchEngine(mockCtrl, config.ConfigWatchRestart)
+	gomock.InOrder(
+		mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{config.ClusterEnvVar: "prod"}),
+		mockDocker.EXPECT().StopAgent(gomock.Any()),
+	)
+
+	engine.agentConfigChanged(context.Background())
+	assert.True(t, engine.takeConfigRestart(), "Expect the Agent exit to be a config restart")
+	assert.False(t, engine.takeConfigRestart(), "Expect the config restart to be taken once")
+}
+
+func TestAgentConfigChangedRestartStopFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	engine, mockDocker := newTestConfigWatchEngine(mockCtrl, config.ConfigWatchRestart)
+	gomock.InOrder(
+		mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{config.ClusterEnvVar: "prod"}),
+		mockDocker.EXPECT().StopAgent(gomock.Any()).Return(errors.New("test error")),
+	)
+
+	engine.agentConfigChanged(context.Background())
+	assert.False(t, engine.takeConfigRestart())
+}
+
+func TestAgentConfigChangedUnchanged(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	engine, mockDocker := newTestConfigWatchEngine(mockCtrl, config.ConfigWatchRestart)
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{config.ClusterEnvVar: "default"})
+
+	engine.agentConfigChanged(context.Background())
+	assert.False(t, engine.takeConfigRestart())
+}
+
+func TestAgentConfigChangedDrift(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	engine, mockDocker := newTestConfigWatchEngine(mockCtrl, config.ConfigWatchDrift)
+	mockStatusWriter := NewMockstatusWriter(mockCtrl)
+	engine.statusWriter = mockStatusWriter
+	changedConfig := map[string]string{config.ClusterEnvVar: "prod"}
+	gomock.InOrder(
+		mockDocker.EXPECT().LoadEnvVars().Return(changedConfig),
+		mockStatusWriter.EXPECT().WriteFile(config.EngineStatusFile(), gomock.Any(), gomock.Any()),
+		// the drift is resolved when the Agent is restarted
+		mockDocker.EXPECT().LoadEnvVars().Return(changedConfig),
+		mockStatusWriter.EXPECT().WriteFile(config.EngineStatusFile(), gomock.Any(), gomock.Any()),
+	)
+
+	engine.agentConfigChanged(context.Background())
+	assert.True(t, engine.state.current().ConfigDriftPendingRestart)
+	assert.False(t, engine.takeConfigRestart(), "Expect the Agent to not be restarted")
+
+	engine.recordAgentConfig()
+	assert.False(t, engine.state.current().ConfigDriftPendingRestart)
+	assert.Equal(t, changedConfig, engine.agentConfig.applied)
+}
+
+func TestStartConfigWatchIgnore(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Unsetenv(config.ConfigWatchEnvVar)
+	engine := &Engine{configWatcher: NewMockfileWatcher(mockCtrl)}
+	engine.startConfigWatch(context.Background())()
+	assert.Nil(t, engine.agentConfig)
+}
+
+func TestStartConfigWatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.ConfigWatchEnvVar, config.ConfigWatchDrift)
+	defer os.Unsetenv(config.ConfigWatchEnvVar)
+	changes := make(chan struct{})
+	mockWatcher := NewMockfileWatcher(mockCtrl)
+	gomock.InOrder(
+		mockWatcher.EXPECT().Watch(config.AgentConfigFile()).Return((<-chan struct{})(changes), nil),
+		mockWatcher.EXPECT().Close(),
+	)
+
+	engine := &Engine{configWatcher: mockWatcher}
+	stopConfigWatch := engine.startConfigWatch(context.Background())
+	assert.Equal(t, config.ConfigWatchDrift, engine.agentConfig.policy)
+	stopConfigWatch()
+}
+
+func TestStartSupervisedRestartsAgentForChangedConfig(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Unsetenv(config.MaintenanceWindowsEnvVar)
+	engine, mockDocker := newTestConfigWatchEngine(mockCtrl, config.ConfigWatchRestart)
+	changedConfig := map[string]string{config.ClusterEnvVar: "prod"}
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	gomock.InOrder(
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().LoadEnvVars().Return(appliedAgentConfig),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Do(func(context.Context) {
+			// the config changed while the Agent was running
+			engine.agentConfigChanged(context.Background())
+		}).Return(terminalSuccessAgentExitCode, nil),
+		mockDocker.EXPECT().LoadEnvVars().Return(changedConfig),
+		mockDocker.EXPECT().StopAgent(gomock.Any()),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().LoadEnvVars().Return(changedConfig),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(terminalSuccessAgentExitCode, nil),
+	)
+
+	assert.NoError(t, engine.StartSupervised(context.Background()))
+	assert.Equal(t, changedConfig, engine.agentConfig.applied)
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+// backupTimeFormat names default backups after the time they were taken, in
+// an order that sorts lexically
+const backupTimeFormat = "20060102T150405Z"
+
+// BackupData writes a backup of the Agent data directory to file, or to a
+// file named after the current time in the backup directory if file is empty
+func (e *Engine) BackupData(ctx context.Context, file string) error {
+	if file == "" {
+		file = filepath.Join(config.AgentDataBackupDirectory(),
+			fmt.Sprintf("data-%s.tar.gz", e.clk().Now().UTC().Format(backupTimeFormat)))
+	}
+	running, err := e.docker.IsAgentRunning(ctx)
+	if err != nil {
+		return engineError("could not check if the Agent is running", err)
+	}
+	if running {
+		// the Agent may write its state while it is being archived
+		log.Warn("Backing up the data directory of a running Agent, the backup may be inconsistent")
+	}
+	log.Infof("Backing up %s to %s", config.AgentDataDirectory(), file)
+	err = e.dataArchiver.Create(config.AgentDataDirectory(), file)
+	if err != nil {
+		return engineError("could not back up the Agent data directory", err)
+	}
+	return nil
+}
+
+// RestoreData replaces the Agent data directory with the backup in file. The
+// Agent must be stopped, as it would overwrite the restored state with its
+// own.
+func (e *Engine) RestoreData(ctx context.Context, file string) error {
+	if file == "" {
+		return errors.New("the backup file to restore is required")
+	}
+	running, err := e.docker.IsAgentRunning(ctx)
+	if err != nil {
+		return engineError("could not check if the Agent is running", err)
+	}
+	if running {
+		return errors.New("the Agent must be stopped to restore its data directory")
+	}
+	log.Infof("Restoring %s from %s", config.AgentDataDirectory(), file)
+	err = e.dataArchiver.Restore(file, config.AgentDataDirectory())
+	if err != nil {
+		return engineError("could not restore the Agent data directory", err)
+	}
+	return nil
+}
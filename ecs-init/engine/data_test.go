@@ -0,0 +1,109 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupData(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockArchiver := NewMockdataArchiver(mockCtrl)
+	mockDocker.EXPECT().IsAgentRunning(gomock.Any()).Return(true, nil)
+	mockArchiver.EXPECT().Create(config.AgentDataDirectory(), "/tmp/data.tar.gz")
+
+	engine := &Engine{
+		docker:       mockDocker,
+		dataArchiver: mockArchiver,
+	}
+	assert.NoError(t, engine.BackupData(context.Background(), "/tmp/data.tar.gz"))
+}
+
+func TestBackupDataDefaultFile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockArchiver := NewMockdataArchiver(mockCtrl)
+	mockDocker.EXPECT().IsAgentRunning(gomock.Any()).Return(false, nil)
+	mockArchiver.EXPECT().Create(config.AgentDataDirectory(), gomock.Any()).Do(func(dir string, file string) {
+		assert.True(t, strings.HasPrefix(file, config.AgentDataBackupDirectory()+"/data-"), file)
+		assert.True(t, strings.HasSuffix(file, ".tar.gz"), file)
+	})
+
+	engine := &Engine{
+		docker:       mockDocker,
+		dataArchiver: mockArchiver,
+	}
+	assert.NoError(t, engine.BackupData(context.Background(), ""))
+}
+
+func TestBackupDataError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockArchiver := NewMockdataArchiver(mockCtrl)
+	mockDocker.EXPECT().IsAgentRunning(gomock.Any()).Return(false, nil)
+	mockArchiver.EXPECT().Create(gomock.Any(), gomock.Any()).Return(errors.New("test error"))
+
+	engine := &Engine{
+		docker:       mockDocker,
+		dataArchiver: mockArchiver,
+	}
+	assert.Error(t, engine.BackupData(context.Background(), "/tmp/data.tar.gz"))
+}
+
+func TestRestoreData(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockArchiver := NewMockdataArchiver(mockCtrl)
+	mockDocker.EXPECT().IsAgentRunning(gomock.Any()).Return(false, nil)
+	mockArchiver.EXPECT().Restore("/tmp/data.tar.gz", config.AgentDataDirectory())
+
+	engine := &Engine{
+		docker:       mockDocker,
+		dataArchiver: mockArchiver,
+	}
+	assert.NoError(t, engine.RestoreData(context.Background(), "/tmp/data.tar.gz"))
+}
+
+func TestRestoreDataAgentRunning(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().IsAgentRunning(gomock.Any()).Return(true, nil)
+
+	engine := &Engine{docker: mockDocker}
+	assert.Error(t, engine.RestoreData(context.Background(), "/tmp/data.tar.gz"))
+}
+
+func TestRestoreDataNoFile(t *testing.T) {
+	engine := &Engine{}
+	assert.Error(t, engine.RestoreData(context.Background(), ""))
+}
@@ -14,30 +14,230 @@
 package engine
 
 import (
+	"context"
 	"io"
+	"os"
+	"time"
 
+	"github.com/aws/amazon-ecs-init/ecs-init/autoscalingclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/blueprint"
 	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecrclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/netns"
+	"github.com/aws/amazon-ecs-init/ecs-init/history"
+	"github.com/aws/amazon-ecs-init/ecs-init/introspection"
+	"github.com/aws/amazon-ecs-init/ecs-init/logvolume"
+	"github.com/aws/amazon-ecs-init/ecs-init/ports"
+	"github.com/aws/amazon-ecs-init/ecs-init/ssmclient"
+
+	godocker "github.com/fsouza/go-dockerclient"
 )
 
 //go:generate mockgen.sh $GOPACKAGE $GOFILE
 
 type downloader interface {
 	IsAgentCached() bool
-	DownloadAgent() error
+	IsAgentOutdated(ctx context.Context) (bool, error)
+	PublishedAgentSize(ctx context.Context) (int64, error)
+	PublishedAgentURLs() ([]string, error)
+	DownloadAgent(ctx context.Context) error
+	StreamAgent(ctx context.Context, load func(io.Reader) error) (bool, error)
 	LoadCachedAgent() (io.ReadCloser, error)
 	LoadDesiredAgent() (io.ReadCloser, error)
 	RecordCachedAgent() error
 	AgentCacheStatus() cache.CacheStatus
+	CachedAgent() cache.CachedAgent
+	AgentVersion() string
+	PinAgentVersion(version string)
+	RollbackAgent() (string, error)
+	Flush() error
+	DesiredAgentFile() (string, error)
+	StandbyAgentFile() (string, error)
+	LoadAgentFile(file string) (io.ReadCloser, error)
+	Region() (string, error)
+	InstanceID() (string, error)
+	CollectGarbage(ctx context.Context) (*cache.GarbageReport, error)
 }
 
+// dockerClient is the container runtime the Agent runs in, implemented by the
+// Docker and the containerd clients
 type dockerClient interface {
-	GetContainerLogTail(logWindowSize string) string
-	IsAgentImageLoaded() (bool, error)
-	LoadImage(image io.Reader) error
-	RemoveExistingAgentContainer() error
-	StartAgent() (int, error)
-	StopAgent() error
+	GetContainerLogTail(ctx context.Context, logWindowSize string) string
+	IsAgentImageLoaded(ctx context.Context) (bool, error)
+	LoadImage(ctx context.Context, image io.Reader) error
+	PreloadImage(ctx context.Context, image io.Reader) error
+	PromoteStandbyImage(ctx context.Context) error
+	PullImage(ctx context.Context, image string) error
+	PullAgentImage(ctx context.Context, image string, auth docker.RegistryAuth) error
+	RemoveExistingAgentContainer(ctx context.Context) error
+	AgentContainerOptions() godocker.CreateContainerOptions
+	StartAgent(ctx context.Context) (int, error)
+	StopAgent(ctx context.Context) error
 	LoadEnvVars() map[string]string
+	ListTaskContainers(ctx context.Context) ([]docker.TaskContainer, error)
+	RemoveContainer(ctx context.Context, id string) error
+	ExpectedPauseImage(ctx context.Context) (string, error)
+	LoadedPauseImages(ctx context.Context) ([]string, error)
+	AgentImages(ctx context.Context) ([]docker.AgentImage, error)
+	RemoveImage(ctx context.Context, name string) error
+	IsAgentRunning(ctx context.Context) (bool, error)
+	RunningAgentContainerID(ctx context.Context) (string, error)
+	AgentHealth(ctx context.Context) (string, error)
+	AgentLogPath(ctx context.Context) (string, error)
+	Ping(ctx context.Context) error
+	WaitReady(ctx context.Context, timeout time.Duration) error
+}
+
+type dockerDaemon interface {
+	UnitState() (string, error)
+	Restart() error
+}
+
+// persistenceDaemon keeps the GPUs initialized, and has to run before they
+// are detected
+type persistenceDaemon interface {
+	Ensure() error
+}
+
+type fileWatcher interface {
+	Watch(file string) (<-chan struct{}, error)
+	Close() error
+}
+
+type hostBlueprint interface {
+	Load() (*blueprint.Blueprint, error)
+	Plan(hostBlueprint *blueprint.Blueprint) ([]blueprint.Change, error)
+	Apply(ctx context.Context, changes []blueprint.Change) error
+}
+
+type dataArchiver interface {
+	Create(dir string, file string) error
+	Restore(file string, dir string) error
+}
+
+type hostNetwork interface {
+	LeakedNamespaces() ([]string, error)
+	DeleteNamespace(name string) error
+	LeakedVeths() ([]string, error)
+	DeleteVeth(name string) error
+	LeakedRules() ([]netns.Rule, error)
+	DeleteRule(rule netns.Rule) error
+}
+
+// statusWriter writes the status file in the background
+type statusWriter interface {
+	WriteFile(filename string, data []byte, perm os.FileMode) error
+	Flush() error
+}
+
+// historyLog records the lifecycle events of the Agent
+type historyLog interface {
+	Append(event history.Event) error
+}
+
+type ecsAPI interface {
+	DescribeClusters(input *ecsclient.DescribeClustersInput) (*ecsclient.DescribeClustersOutput, error)
+	CreateCluster(input *ecsclient.CreateClusterInput) (*ecsclient.CreateClusterOutput, error)
+	DescribeContainerInstances(input *ecsclient.DescribeContainerInstancesInput) (*ecsclient.DescribeContainerInstancesOutput, error)
+	TagResource(input *ecsclient.TagResourceInput) (*ecsclient.TagResourceOutput, error)
+}
+
+type parameterStore interface {
+	GetParameterValue(name string) (string, error)
+}
+
+type registryAuthorizer interface {
+	GetAuthorization(registryID string) (ecrclient.Authorization, error)
+}
+
+type ec2API interface {
+	CreateTags(resourceID string, tags map[string]string) error
+}
+
+type autoScalingAPI interface {
+	DescribeInstance(instanceID string) (*autoscalingclient.Instance, error)
+	SetInstanceProtection(group string, instanceID string, protected bool) error
+	CompleteLifecycleAction(group string, hook string, instanceID string, result string) error
+}
+
+type inventoryAPI interface {
+	PutInventory(instanceID string, items ...ssmclient.InventoryItem) error
+}
+
+type endpointProber interface {
+	ProbeHTTP(endpoint string) (string, error)
+	ProbeNTP(address string) error
+}
+
+type introspectionSocket interface {
+	Start() error
+	Stop() error
+}
+
+type metricsServer interface {
+	Start() error
+	Stop() error
+}
+
+type logVolume interface {
+	Usage(agentLog string) (logvolume.Usage, error)
+	Excess(agentLog string, maxBytes int64) ([]string, error)
+	Remove(file string) error
+}
+
+type taskMetadataProbe interface {
+	Probe() (int, error)
+}
+
+type agentMetadata interface {
+	Metadata() (*introspection.Metadata, error)
+}
+
+type portChecker interface {
+	Check(reserved []uint16) ([]ports.Conflict, error)
+}
+
+type ebsTaskAttach interface {
+	Prepare() error
+}
+
+type appArmorProfile interface {
+	Load() error
+}
+
+type execPrerequisites interface {
+	Prepare(ctx context.Context, region, version string, offline bool) error
+}
+
+type volumePlugin interface {
+	Start() error
+	Stop() error
+	RestartIfUpdated() error
+}
+
+type efsUtils interface {
+	Check() error
+	Install() error
+}
+
+type serviceNotifier interface {
+	Notify(state string) error
+	WatchdogInterval() time.Duration
+}
+
+type startGate interface {
+	FileExists(path string) error
+	CommandSucceeds(command string) error
+}
+
+type sysctlProfile interface {
+	Apply() error
+}
+
+type hostReservation interface {
+	Reserve(memoryMiB int64) error
 }
 
 type loopbackRouting interface {
@@ -49,3 +249,15 @@ type credentialsProxyRoute interface {
 	Create() error
 	Remove() error
 }
+
+// agentEgressPolicy restricts the connections the Agent container makes from
+// its bridge
+type agentEgressPolicy interface {
+	Apply(iface string, destinations []string) error
+	Remove(iface string) error
+}
+
+// hookRunner runs the hook scripts operators provide for a stage of the Agent
+type hookRunner interface {
+	Run(ctx context.Context, stage string) error
+}
@@ -18,10 +18,25 @@
 package engine
 
 import (
+	context "context"
 	io "io"
+	os "os"
 	reflect "reflect"
+	time "time"
 
+	autoscalingclient "github.com/aws/amazon-ecs-init/ecs-init/autoscalingclient"
+	blueprint "github.com/aws/amazon-ecs-init/ecs-init/blueprint"
 	cache "github.com/aws/amazon-ecs-init/ecs-init/cache"
+	docker "github.com/aws/amazon-ecs-init/ecs-init/docker"
+	ecrclient "github.com/aws/amazon-ecs-init/ecs-init/ecrclient"
+	ecsclient "github.com/aws/amazon-ecs-init/ecs-init/ecsclient"
+	netns "github.com/aws/amazon-ecs-init/ecs-init/exec/netns"
+	history "github.com/aws/amazon-ecs-init/ecs-init/history"
+	introspection "github.com/aws/amazon-ecs-init/ecs-init/introspection"
+	logvolume "github.com/aws/amazon-ecs-init/ecs-init/logvolume"
+	ports "github.com/aws/amazon-ecs-init/ecs-init/ports"
+	ssmclient "github.com/aws/amazon-ecs-init/ecs-init/ssmclient"
+	go_dockerclient "github.com/fsouza/go-dockerclient"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -62,18 +77,78 @@ func (mr *MockdownloaderMockRecorder) IsAgentCached() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAgentCached", reflect.TypeOf((*Mockdownloader)(nil).IsAgentCached))
 }
 
+// IsAgentOutdated mocks base method
+func (m *Mockdownloader) IsAgentOutdated(ctx context.Context) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsAgentOutdated", ctx)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsAgentOutdated indicates an expected call of IsAgentOutdated
+func (mr *MockdownloaderMockRecorder) IsAgentOutdated(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAgentOutdated", reflect.TypeOf((*Mockdownloader)(nil).IsAgentOutdated), ctx)
+}
+
+// PublishedAgentSize mocks base method
+func (m *Mockdownloader) PublishedAgentSize(ctx context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishedAgentSize", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PublishedAgentSize indicates an expected call of PublishedAgentSize
+func (mr *MockdownloaderMockRecorder) PublishedAgentSize(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishedAgentSize", reflect.TypeOf((*Mockdownloader)(nil).PublishedAgentSize), ctx)
+}
+
+// PublishedAgentURLs mocks base method
+func (m *Mockdownloader) PublishedAgentURLs() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishedAgentURLs")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PublishedAgentURLs indicates an expected call of PublishedAgentURLs
+func (mr *MockdownloaderMockRecorder) PublishedAgentURLs() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishedAgentURLs", reflect.TypeOf((*Mockdownloader)(nil).PublishedAgentURLs))
+}
+
 // DownloadAgent mocks base method
-func (m *Mockdownloader) DownloadAgent() error {
+func (m *Mockdownloader) DownloadAgent(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DownloadAgent")
+	ret := m.ctrl.Call(m, "DownloadAgent", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DownloadAgent indicates an expected call of DownloadAgent
-func (mr *MockdownloaderMockRecorder) DownloadAgent() *gomock.Call {
+func (mr *MockdownloaderMockRecorder) DownloadAgent(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadAgent", reflect.TypeOf((*Mockdownloader)(nil).DownloadAgent), ctx)
+}
+
+// StreamAgent mocks base method
+func (m *Mockdownloader) StreamAgent(ctx context.Context, load func(io.Reader) error) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamAgent", ctx, load)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StreamAgent indicates an expected call of StreamAgent
+func (mr *MockdownloaderMockRecorder) StreamAgent(ctx, load interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadAgent", reflect.TypeOf((*Mockdownloader)(nil).DownloadAgent))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamAgent", reflect.TypeOf((*Mockdownloader)(nil).StreamAgent), ctx, load)
 }
 
 // LoadCachedAgent mocks base method
@@ -134,6 +209,165 @@ func (mr *MockdownloaderMockRecorder) AgentCacheStatus() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AgentCacheStatus", reflect.TypeOf((*Mockdownloader)(nil).AgentCacheStatus))
 }
 
+// CachedAgent mocks base method
+func (m *Mockdownloader) CachedAgent() cache.CachedAgent {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CachedAgent")
+	ret0, _ := ret[0].(cache.CachedAgent)
+	return ret0
+}
+
+// CachedAgent indicates an expected call of CachedAgent
+func (mr *MockdownloaderMockRecorder) CachedAgent() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CachedAgent", reflect.TypeOf((*Mockdownloader)(nil).CachedAgent))
+}
+
+// AgentVersion mocks base method
+func (m *Mockdownloader) AgentVersion() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AgentVersion")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// AgentVersion indicates an expected call of AgentVersion
+func (mr *MockdownloaderMockRecorder) AgentVersion() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AgentVersion", reflect.TypeOf((*Mockdownloader)(nil).AgentVersion))
+}
+
+// PinAgentVersion mocks base method
+func (m *Mockdownloader) PinAgentVersion(version string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "PinAgentVersion", version)
+}
+
+// PinAgentVersion indicates an expected call of PinAgentVersion
+func (mr *MockdownloaderMockRecorder) PinAgentVersion(version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PinAgentVersion", reflect.TypeOf((*Mockdownloader)(nil).PinAgentVersion), version)
+}
+
+// RollbackAgent mocks base method
+func (m *Mockdownloader) RollbackAgent() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RollbackAgent")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RollbackAgent indicates an expected call of RollbackAgent
+func (mr *MockdownloaderMockRecorder) RollbackAgent() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RollbackAgent", reflect.TypeOf((*Mockdownloader)(nil).RollbackAgent))
+}
+
+// Flush mocks base method
+func (m *Mockdownloader) Flush() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Flush indicates an expected call of Flush
+func (mr *MockdownloaderMockRecorder) Flush() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*Mockdownloader)(nil).Flush))
+}
+
+// DesiredAgentFile mocks base method
+func (m *Mockdownloader) DesiredAgentFile() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DesiredAgentFile")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DesiredAgentFile indicates an expected call of DesiredAgentFile
+func (mr *MockdownloaderMockRecorder) DesiredAgentFile() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DesiredAgentFile", reflect.TypeOf((*Mockdownloader)(nil).DesiredAgentFile))
+}
+
+// StandbyAgentFile mocks base method
+func (m *Mockdownloader) StandbyAgentFile() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StandbyAgentFile")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StandbyAgentFile indicates an expected call of StandbyAgentFile
+func (mr *MockdownloaderMockRecorder) StandbyAgentFile() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StandbyAgentFile", reflect.TypeOf((*Mockdownloader)(nil).StandbyAgentFile))
+}
+
+// LoadAgentFile mocks base method
+func (m *Mockdownloader) LoadAgentFile(file string) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoadAgentFile", file)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoadAgentFile indicates an expected call of LoadAgentFile
+func (mr *MockdownloaderMockRecorder) LoadAgentFile(file interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadAgentFile", reflect.TypeOf((*Mockdownloader)(nil).LoadAgentFile), file)
+}
+
+// Region mocks base method
+func (m *Mockdownloader) Region() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Region")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Region indicates an expected call of Region
+func (mr *MockdownloaderMockRecorder) Region() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Region", reflect.TypeOf((*Mockdownloader)(nil).Region))
+}
+
+// InstanceID mocks base method
+func (m *Mockdownloader) InstanceID() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InstanceID")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InstanceID indicates an expected call of InstanceID
+func (mr *MockdownloaderMockRecorder) InstanceID() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstanceID", reflect.TypeOf((*Mockdownloader)(nil).InstanceID))
+}
+
+// CollectGarbage mocks base method
+func (m *Mockdownloader) CollectGarbage(ctx context.Context) (*cache.GarbageReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CollectGarbage", ctx)
+	ret0, _ := ret[0].(*cache.GarbageReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CollectGarbage indicates an expected call of CollectGarbage
+func (mr *MockdownloaderMockRecorder) CollectGarbage(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectGarbage", reflect.TypeOf((*Mockdownloader)(nil).CollectGarbage), ctx)
+}
+
 // MockdockerClient is a mock of dockerClient interface
 type MockdockerClient struct {
 	ctrl     *gomock.Controller
@@ -158,89 +392,159 @@ func (m *MockdockerClient) EXPECT() *MockdockerClientMockRecorder {
 }
 
 // GetContainerLogTail mocks base method
-func (m *MockdockerClient) GetContainerLogTail(logWindowSize string) string {
+func (m *MockdockerClient) GetContainerLogTail(ctx context.Context, logWindowSize string) string {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetContainerLogTail", logWindowSize)
+	ret := m.ctrl.Call(m, "GetContainerLogTail", ctx, logWindowSize)
 	ret0, _ := ret[0].(string)
 	return ret0
 }
 
 // GetContainerLogTail indicates an expected call of GetContainerLogTail
-func (mr *MockdockerClientMockRecorder) GetContainerLogTail(logWindowSize interface{}) *gomock.Call {
+func (mr *MockdockerClientMockRecorder) GetContainerLogTail(ctx, logWindowSize interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContainerLogTail", reflect.TypeOf((*MockdockerClient)(nil).GetContainerLogTail), logWindowSize)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContainerLogTail", reflect.TypeOf((*MockdockerClient)(nil).GetContainerLogTail), ctx, logWindowSize)
 }
 
 // IsAgentImageLoaded mocks base method
-func (m *MockdockerClient) IsAgentImageLoaded() (bool, error) {
+func (m *MockdockerClient) IsAgentImageLoaded(ctx context.Context) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IsAgentImageLoaded")
+	ret := m.ctrl.Call(m, "IsAgentImageLoaded", ctx)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // IsAgentImageLoaded indicates an expected call of IsAgentImageLoaded
-func (mr *MockdockerClientMockRecorder) IsAgentImageLoaded() *gomock.Call {
+func (mr *MockdockerClientMockRecorder) IsAgentImageLoaded(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAgentImageLoaded", reflect.TypeOf((*MockdockerClient)(nil).IsAgentImageLoaded))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAgentImageLoaded", reflect.TypeOf((*MockdockerClient)(nil).IsAgentImageLoaded), ctx)
 }
 
 // LoadImage mocks base method
-func (m *MockdockerClient) LoadImage(image io.Reader) error {
+func (m *MockdockerClient) LoadImage(ctx context.Context, image io.Reader) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "LoadImage", image)
+	ret := m.ctrl.Call(m, "LoadImage", ctx, image)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // LoadImage indicates an expected call of LoadImage
-func (mr *MockdockerClientMockRecorder) LoadImage(image interface{}) *gomock.Call {
+func (mr *MockdockerClientMockRecorder) LoadImage(ctx, image interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadImage", reflect.TypeOf((*MockdockerClient)(nil).LoadImage), ctx, image)
+}
+
+// PreloadImage mocks base method
+func (m *MockdockerClient) PreloadImage(ctx context.Context, image io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PreloadImage", ctx, image)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PreloadImage indicates an expected call of PreloadImage
+func (mr *MockdockerClientMockRecorder) PreloadImage(ctx, image interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreloadImage", reflect.TypeOf((*MockdockerClient)(nil).PreloadImage), ctx, image)
+}
+
+// PromoteStandbyImage mocks base method
+func (m *MockdockerClient) PromoteStandbyImage(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PromoteStandbyImage", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PromoteStandbyImage indicates an expected call of PromoteStandbyImage
+func (mr *MockdockerClientMockRecorder) PromoteStandbyImage(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PromoteStandbyImage", reflect.TypeOf((*MockdockerClient)(nil).PromoteStandbyImage), ctx)
+}
+
+// PullImage mocks base method
+func (m *MockdockerClient) PullImage(ctx context.Context, image string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PullImage", ctx, image)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PullImage indicates an expected call of PullImage
+func (mr *MockdockerClientMockRecorder) PullImage(ctx, image interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PullImage", reflect.TypeOf((*MockdockerClient)(nil).PullImage), ctx, image)
+}
+
+// PullAgentImage mocks base method
+func (m *MockdockerClient) PullAgentImage(ctx context.Context, image string, auth docker.RegistryAuth) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PullAgentImage", ctx, image, auth)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PullAgentImage indicates an expected call of PullAgentImage
+func (mr *MockdockerClientMockRecorder) PullAgentImage(ctx, image, auth interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadImage", reflect.TypeOf((*MockdockerClient)(nil).LoadImage), image)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PullAgentImage", reflect.TypeOf((*MockdockerClient)(nil).PullAgentImage), ctx, image, auth)
 }
 
 // RemoveExistingAgentContainer mocks base method
-func (m *MockdockerClient) RemoveExistingAgentContainer() error {
+func (m *MockdockerClient) RemoveExistingAgentContainer(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RemoveExistingAgentContainer")
+	ret := m.ctrl.Call(m, "RemoveExistingAgentContainer", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // RemoveExistingAgentContainer indicates an expected call of RemoveExistingAgentContainer
-func (mr *MockdockerClientMockRecorder) RemoveExistingAgentContainer() *gomock.Call {
+func (mr *MockdockerClientMockRecorder) RemoveExistingAgentContainer(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveExistingAgentContainer", reflect.TypeOf((*MockdockerClient)(nil).RemoveExistingAgentContainer), ctx)
+}
+
+// AgentContainerOptions mocks base method
+func (m *MockdockerClient) AgentContainerOptions() go_dockerclient.CreateContainerOptions {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AgentContainerOptions")
+	ret0, _ := ret[0].(go_dockerclient.CreateContainerOptions)
+	return ret0
+}
+
+// AgentContainerOptions indicates an expected call of AgentContainerOptions
+func (mr *MockdockerClientMockRecorder) AgentContainerOptions() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveExistingAgentContainer", reflect.TypeOf((*MockdockerClient)(nil).RemoveExistingAgentContainer))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AgentContainerOptions", reflect.TypeOf((*MockdockerClient)(nil).AgentContainerOptions))
 }
 
 // StartAgent mocks base method
-func (m *MockdockerClient) StartAgent() (int, error) {
+func (m *MockdockerClient) StartAgent(ctx context.Context) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "StartAgent")
+	ret := m.ctrl.Call(m, "StartAgent", ctx)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // StartAgent indicates an expected call of StartAgent
-func (mr *MockdockerClientMockRecorder) StartAgent() *gomock.Call {
+func (mr *MockdockerClientMockRecorder) StartAgent(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartAgent", reflect.TypeOf((*MockdockerClient)(nil).StartAgent))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartAgent", reflect.TypeOf((*MockdockerClient)(nil).StartAgent), ctx)
 }
 
 // StopAgent mocks base method
-func (m *MockdockerClient) StopAgent() error {
+func (m *MockdockerClient) StopAgent(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "StopAgent")
+	ret := m.ctrl.Call(m, "StopAgent", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // StopAgent indicates an expected call of StopAgent
-func (mr *MockdockerClientMockRecorder) StopAgent() *gomock.Call {
+func (mr *MockdockerClientMockRecorder) StopAgent(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopAgent", reflect.TypeOf((*MockdockerClient)(nil).StopAgent))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopAgent", reflect.TypeOf((*MockdockerClient)(nil).StopAgent), ctx)
 }
 
 // LoadEnvVars mocks base method
@@ -257,104 +561,1867 @@ func (mr *MockdockerClientMockRecorder) LoadEnvVars() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadEnvVars", reflect.TypeOf((*MockdockerClient)(nil).LoadEnvVars))
 }
 
-// MockloopbackRouting is a mock of loopbackRouting interface
-type MockloopbackRouting struct {
-	ctrl     *gomock.Controller
-	recorder *MockloopbackRoutingMockRecorder
-}
-
-// MockloopbackRoutingMockRecorder is the mock recorder for MockloopbackRouting
-type MockloopbackRoutingMockRecorder struct {
-	mock *MockloopbackRouting
-}
-
-// NewMockloopbackRouting creates a new mock instance
-func NewMockloopbackRouting(ctrl *gomock.Controller) *MockloopbackRouting {
-	mock := &MockloopbackRouting{ctrl: ctrl}
-	mock.recorder = &MockloopbackRoutingMockRecorder{mock}
-	return mock
+// ListTaskContainers mocks base method
+func (m *MockdockerClient) ListTaskContainers(ctx context.Context) ([]docker.TaskContainer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTaskContainers", ctx)
+	ret0, _ := ret[0].([]docker.TaskContainer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// EXPECT returns an object that allows the caller to indicate expected use
-func (m *MockloopbackRouting) EXPECT() *MockloopbackRoutingMockRecorder {
-	return m.recorder
+// ListTaskContainers indicates an expected call of ListTaskContainers
+func (mr *MockdockerClientMockRecorder) ListTaskContainers(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTaskContainers", reflect.TypeOf((*MockdockerClient)(nil).ListTaskContainers), ctx)
 }
 
-// Enable mocks base method
-func (m *MockloopbackRouting) Enable() error {
+// RemoveContainer mocks base method
+func (m *MockdockerClient) RemoveContainer(ctx context.Context, id string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Enable")
+	ret := m.ctrl.Call(m, "RemoveContainer", ctx, id)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// Enable indicates an expected call of Enable
-func (mr *MockloopbackRoutingMockRecorder) Enable() *gomock.Call {
+// RemoveContainer indicates an expected call of RemoveContainer
+func (mr *MockdockerClientMockRecorder) RemoveContainer(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enable", reflect.TypeOf((*MockloopbackRouting)(nil).Enable))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveContainer", reflect.TypeOf((*MockdockerClient)(nil).RemoveContainer), ctx, id)
 }
 
-// RestoreDefault mocks base method
-func (m *MockloopbackRouting) RestoreDefault() error {
+// ExpectedPauseImage mocks base method
+func (m *MockdockerClient) ExpectedPauseImage(ctx context.Context) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RestoreDefault")
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "ExpectedPauseImage", ctx)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// RestoreDefault indicates an expected call of RestoreDefault
-func (mr *MockloopbackRoutingMockRecorder) RestoreDefault() *gomock.Call {
+// ExpectedPauseImage indicates an expected call of ExpectedPauseImage
+func (mr *MockdockerClientMockRecorder) ExpectedPauseImage(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreDefault", reflect.TypeOf((*MockloopbackRouting)(nil).RestoreDefault))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpectedPauseImage", reflect.TypeOf((*MockdockerClient)(nil).ExpectedPauseImage), ctx)
 }
 
-// MockcredentialsProxyRoute is a mock of credentialsProxyRoute interface
-type MockcredentialsProxyRoute struct {
-	ctrl     *gomock.Controller
-	recorder *MockcredentialsProxyRouteMockRecorder
+// LoadedPauseImages mocks base method
+func (m *MockdockerClient) LoadedPauseImages(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoadedPauseImages", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// MockcredentialsProxyRouteMockRecorder is the mock recorder for MockcredentialsProxyRoute
-type MockcredentialsProxyRouteMockRecorder struct {
-	mock *MockcredentialsProxyRoute
+// LoadedPauseImages indicates an expected call of LoadedPauseImages
+func (mr *MockdockerClientMockRecorder) LoadedPauseImages(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadedPauseImages", reflect.TypeOf((*MockdockerClient)(nil).LoadedPauseImages), ctx)
 }
 
-// NewMockcredentialsProxyRoute creates a new mock instance
-func NewMockcredentialsProxyRoute(ctrl *gomock.Controller) *MockcredentialsProxyRoute {
-	mock := &MockcredentialsProxyRoute{ctrl: ctrl}
-	mock.recorder = &MockcredentialsProxyRouteMockRecorder{mock}
-	return mock
+// AgentImages mocks base method
+func (m *MockdockerClient) AgentImages(ctx context.Context) ([]docker.AgentImage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AgentImages", ctx)
+	ret0, _ := ret[0].([]docker.AgentImage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// EXPECT returns an object that allows the caller to indicate expected use
-func (m *MockcredentialsProxyRoute) EXPECT() *MockcredentialsProxyRouteMockRecorder {
-	return m.recorder
+// AgentImages indicates an expected call of AgentImages
+func (mr *MockdockerClientMockRecorder) AgentImages(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AgentImages", reflect.TypeOf((*MockdockerClient)(nil).AgentImages), ctx)
 }
 
-// Create mocks base method
-func (m *MockcredentialsProxyRoute) Create() error {
+// RemoveImage mocks base method
+func (m *MockdockerClient) RemoveImage(ctx context.Context, name string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create")
+	ret := m.ctrl.Call(m, "RemoveImage", ctx, name)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// Create indicates an expected call of Create
-func (mr *MockcredentialsProxyRouteMockRecorder) Create() *gomock.Call {
+// RemoveImage indicates an expected call of RemoveImage
+func (mr *MockdockerClientMockRecorder) RemoveImage(ctx, name interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockcredentialsProxyRoute)(nil).Create))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveImage", reflect.TypeOf((*MockdockerClient)(nil).RemoveImage), ctx, name)
 }
 
-// Remove mocks base method
-func (m *MockcredentialsProxyRoute) Remove() error {
+// IsAgentRunning mocks base method
+func (m *MockdockerClient) IsAgentRunning(ctx context.Context) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Remove")
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "IsAgentRunning", ctx)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// Remove indicates an expected call of Remove
-func (mr *MockcredentialsProxyRouteMockRecorder) Remove() *gomock.Call {
+// IsAgentRunning indicates an expected call of IsAgentRunning
+func (mr *MockdockerClientMockRecorder) IsAgentRunning(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockcredentialsProxyRoute)(nil).Remove))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAgentRunning", reflect.TypeOf((*MockdockerClient)(nil).IsAgentRunning), ctx)
+}
+
+// RunningAgentContainerID mocks base method
+func (m *MockdockerClient) RunningAgentContainerID(ctx context.Context) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunningAgentContainerID", ctx)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RunningAgentContainerID indicates an expected call of RunningAgentContainerID
+func (mr *MockdockerClientMockRecorder) RunningAgentContainerID(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunningAgentContainerID", reflect.TypeOf((*MockdockerClient)(nil).RunningAgentContainerID), ctx)
+}
+
+// AgentHealth mocks base method
+func (m *MockdockerClient) AgentHealth(ctx context.Context) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AgentHealth", ctx)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AgentHealth indicates an expected call of AgentHealth
+func (mr *MockdockerClientMockRecorder) AgentHealth(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AgentHealth", reflect.TypeOf((*MockdockerClient)(nil).AgentHealth), ctx)
+}
+
+// AgentLogPath mocks base method
+func (m *MockdockerClient) AgentLogPath(ctx context.Context) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AgentLogPath", ctx)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AgentLogPath indicates an expected call of AgentLogPath
+func (mr *MockdockerClientMockRecorder) AgentLogPath(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AgentLogPath", reflect.TypeOf((*MockdockerClient)(nil).AgentLogPath), ctx)
+}
+
+// Ping mocks base method
+func (m *MockdockerClient) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping
+func (mr *MockdockerClientMockRecorder) Ping(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockdockerClient)(nil).Ping), ctx)
+}
+
+// WaitReady mocks base method
+func (m *MockdockerClient) WaitReady(ctx context.Context, timeout time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitReady", ctx, timeout)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WaitReady indicates an expected call of WaitReady
+func (mr *MockdockerClientMockRecorder) WaitReady(ctx, timeout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitReady", reflect.TypeOf((*MockdockerClient)(nil).WaitReady), ctx, timeout)
+}
+
+// MockdockerDaemon is a mock of dockerDaemon interface
+type MockdockerDaemon struct {
+	ctrl     *gomock.Controller
+	recorder *MockdockerDaemonMockRecorder
+}
+
+// MockdockerDaemonMockRecorder is the mock recorder for MockdockerDaemon
+type MockdockerDaemonMockRecorder struct {
+	mock *MockdockerDaemon
+}
+
+// NewMockdockerDaemon creates a new mock instance
+func NewMockdockerDaemon(ctrl *gomock.Controller) *MockdockerDaemon {
+	mock := &MockdockerDaemon{ctrl: ctrl}
+	mock.recorder = &MockdockerDaemonMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockdockerDaemon) EXPECT() *MockdockerDaemonMockRecorder {
+	return m.recorder
+}
+
+// UnitState mocks base method
+func (m *MockdockerDaemon) UnitState() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnitState")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UnitState indicates an expected call of UnitState
+func (mr *MockdockerDaemonMockRecorder) UnitState() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnitState", reflect.TypeOf((*MockdockerDaemon)(nil).UnitState))
+}
+
+// Restart mocks base method
+func (m *MockdockerDaemon) Restart() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restart")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Restart indicates an expected call of Restart
+func (mr *MockdockerDaemonMockRecorder) Restart() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restart", reflect.TypeOf((*MockdockerDaemon)(nil).Restart))
+}
+
+// MockfileWatcher is a mock of fileWatcher interface
+type MockfileWatcher struct {
+	ctrl     *gomock.Controller
+	recorder *MockfileWatcherMockRecorder
+}
+
+// MockfileWatcherMockRecorder is the mock recorder for MockfileWatcher
+type MockfileWatcherMockRecorder struct {
+	mock *MockfileWatcher
+}
+
+// NewMockfileWatcher creates a new mock instance
+func NewMockfileWatcher(ctrl *gomock.Controller) *MockfileWatcher {
+	mock := &MockfileWatcher{ctrl: ctrl}
+	mock.recorder = &MockfileWatcherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockfileWatcher) EXPECT() *MockfileWatcherMockRecorder {
+	return m.recorder
+}
+
+// Watch mocks base method
+func (m *MockfileWatcher) Watch(file string) (<-chan struct{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Watch", file)
+	ret0, _ := ret[0].(<-chan struct{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Watch indicates an expected call of Watch
+func (mr *MockfileWatcherMockRecorder) Watch(file interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Watch", reflect.TypeOf((*MockfileWatcher)(nil).Watch), file)
+}
+
+// Close mocks base method
+func (m *MockfileWatcher) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close
+func (mr *MockfileWatcherMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockfileWatcher)(nil).Close))
+}
+
+// MockhostBlueprint is a mock of hostBlueprint interface
+type MockhostBlueprint struct {
+	ctrl     *gomock.Controller
+	recorder *MockhostBlueprintMockRecorder
+}
+
+// MockhostBlueprintMockRecorder is the mock recorder for MockhostBlueprint
+type MockhostBlueprintMockRecorder struct {
+	mock *MockhostBlueprint
+}
+
+// NewMockhostBlueprint creates a new mock instance
+func NewMockhostBlueprint(ctrl *gomock.Controller) *MockhostBlueprint {
+	mock := &MockhostBlueprint{ctrl: ctrl}
+	mock.recorder = &MockhostBlueprintMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockhostBlueprint) EXPECT() *MockhostBlueprintMockRecorder {
+	return m.recorder
+}
+
+// Load mocks base method
+func (m *MockhostBlueprint) Load() (*blueprint.Blueprint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Load")
+	ret0, _ := ret[0].(*blueprint.Blueprint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Load indicates an expected call of Load
+func (mr *MockhostBlueprintMockRecorder) Load() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Load", reflect.TypeOf((*MockhostBlueprint)(nil).Load))
+}
+
+// Plan mocks base method
+func (m *MockhostBlueprint) Plan(hostBlueprint *blueprint.Blueprint) ([]blueprint.Change, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Plan", hostBlueprint)
+	ret0, _ := ret[0].([]blueprint.Change)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Plan indicates an expected call of Plan
+func (mr *MockhostBlueprintMockRecorder) Plan(hostBlueprint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Plan", reflect.TypeOf((*MockhostBlueprint)(nil).Plan), hostBlueprint)
+}
+
+// Apply mocks base method
+func (m *MockhostBlueprint) Apply(ctx context.Context, changes []blueprint.Change) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Apply", ctx, changes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Apply indicates an expected call of Apply
+func (mr *MockhostBlueprintMockRecorder) Apply(ctx, changes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Apply", reflect.TypeOf((*MockhostBlueprint)(nil).Apply), ctx, changes)
+}
+
+// MockdataArchiver is a mock of dataArchiver interface
+type MockdataArchiver struct {
+	ctrl     *gomock.Controller
+	recorder *MockdataArchiverMockRecorder
+}
+
+// MockdataArchiverMockRecorder is the mock recorder for MockdataArchiver
+type MockdataArchiverMockRecorder struct {
+	mock *MockdataArchiver
+}
+
+// NewMockdataArchiver creates a new mock instance
+func NewMockdataArchiver(ctrl *gomock.Controller) *MockdataArchiver {
+	mock := &MockdataArchiver{ctrl: ctrl}
+	mock.recorder = &MockdataArchiverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockdataArchiver) EXPECT() *MockdataArchiverMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method
+func (m *MockdataArchiver) Create(dir, file string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", dir, file)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create
+func (mr *MockdataArchiverMockRecorder) Create(dir, file interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockdataArchiver)(nil).Create), dir, file)
+}
+
+// Restore mocks base method
+func (m *MockdataArchiver) Restore(file, dir string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", file, dir)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Restore indicates an expected call of Restore
+func (mr *MockdataArchiverMockRecorder) Restore(file, dir interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockdataArchiver)(nil).Restore), file, dir)
+}
+
+// MockhostNetwork is a mock of hostNetwork interface
+type MockhostNetwork struct {
+	ctrl     *gomock.Controller
+	recorder *MockhostNetworkMockRecorder
+}
+
+// MockhostNetworkMockRecorder is the mock recorder for MockhostNetwork
+type MockhostNetworkMockRecorder struct {
+	mock *MockhostNetwork
+}
+
+// NewMockhostNetwork creates a new mock instance
+func NewMockhostNetwork(ctrl *gomock.Controller) *MockhostNetwork {
+	mock := &MockhostNetwork{ctrl: ctrl}
+	mock.recorder = &MockhostNetworkMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockhostNetwork) EXPECT() *MockhostNetworkMockRecorder {
+	return m.recorder
+}
+
+// LeakedNamespaces mocks base method
+func (m *MockhostNetwork) LeakedNamespaces() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeakedNamespaces")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeakedNamespaces indicates an expected call of LeakedNamespaces
+func (mr *MockhostNetworkMockRecorder) LeakedNamespaces() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeakedNamespaces", reflect.TypeOf((*MockhostNetwork)(nil).LeakedNamespaces))
+}
+
+// DeleteNamespace mocks base method
+func (m *MockhostNetwork) DeleteNamespace(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteNamespace", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteNamespace indicates an expected call of DeleteNamespace
+func (mr *MockhostNetworkMockRecorder) DeleteNamespace(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteNamespace", reflect.TypeOf((*MockhostNetwork)(nil).DeleteNamespace), name)
+}
+
+// LeakedVeths mocks base method
+func (m *MockhostNetwork) LeakedVeths() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeakedVeths")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeakedVeths indicates an expected call of LeakedVeths
+func (mr *MockhostNetworkMockRecorder) LeakedVeths() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeakedVeths", reflect.TypeOf((*MockhostNetwork)(nil).LeakedVeths))
+}
+
+// DeleteVeth mocks base method
+func (m *MockhostNetwork) DeleteVeth(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteVeth", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteVeth indicates an expected call of DeleteVeth
+func (mr *MockhostNetworkMockRecorder) DeleteVeth(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteVeth", reflect.TypeOf((*MockhostNetwork)(nil).DeleteVeth), name)
+}
+
+// LeakedRules mocks base method
+func (m *MockhostNetwork) LeakedRules() ([]netns.Rule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeakedRules")
+	ret0, _ := ret[0].([]netns.Rule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeakedRules indicates an expected call of LeakedRules
+func (mr *MockhostNetworkMockRecorder) LeakedRules() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeakedRules", reflect.TypeOf((*MockhostNetwork)(nil).LeakedRules))
+}
+
+// DeleteRule mocks base method
+func (m *MockhostNetwork) DeleteRule(rule netns.Rule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRule", rule)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteRule indicates an expected call of DeleteRule
+func (mr *MockhostNetworkMockRecorder) DeleteRule(rule interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRule", reflect.TypeOf((*MockhostNetwork)(nil).DeleteRule), rule)
+}
+
+// MockstatusWriter is a mock of statusWriter interface
+type MockstatusWriter struct {
+	ctrl     *gomock.Controller
+	recorder *MockstatusWriterMockRecorder
+}
+
+// MockstatusWriterMockRecorder is the mock recorder for MockstatusWriter
+type MockstatusWriterMockRecorder struct {
+	mock *MockstatusWriter
+}
+
+// NewMockstatusWriter creates a new mock instance
+func NewMockstatusWriter(ctrl *gomock.Controller) *MockstatusWriter {
+	mock := &MockstatusWriter{ctrl: ctrl}
+	mock.recorder = &MockstatusWriterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockstatusWriter) EXPECT() *MockstatusWriterMockRecorder {
+	return m.recorder
+}
+
+// WriteFile mocks base method
+func (m *MockstatusWriter) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteFile", filename, data, perm)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteFile indicates an expected call of WriteFile
+func (mr *MockstatusWriterMockRecorder) WriteFile(filename, data, perm interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteFile", reflect.TypeOf((*MockstatusWriter)(nil).WriteFile), filename, data, perm)
+}
+
+// Flush mocks base method
+func (m *MockstatusWriter) Flush() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Flush indicates an expected call of Flush
+func (mr *MockstatusWriterMockRecorder) Flush() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockstatusWriter)(nil).Flush))
+}
+
+// MockecsAPI is a mock of ecsAPI interface
+type MockecsAPI struct {
+	ctrl     *gomock.Controller
+	recorder *MockecsAPIMockRecorder
+}
+
+// MockecsAPIMockRecorder is the mock recorder for MockecsAPI
+type MockecsAPIMockRecorder struct {
+	mock *MockecsAPI
+}
+
+// NewMockecsAPI creates a new mock instance
+func NewMockecsAPI(ctrl *gomock.Controller) *MockecsAPI {
+	mock := &MockecsAPI{ctrl: ctrl}
+	mock.recorder = &MockecsAPIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockecsAPI) EXPECT() *MockecsAPIMockRecorder {
+	return m.recorder
+}
+
+// DescribeClusters mocks base method
+func (m *MockecsAPI) DescribeClusters(input *ecsclient.DescribeClustersInput) (*ecsclient.DescribeClustersOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeClusters", input)
+	ret0, _ := ret[0].(*ecsclient.DescribeClustersOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeClusters indicates an expected call of DescribeClusters
+func (mr *MockecsAPIMockRecorder) DescribeClusters(input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeClusters", reflect.TypeOf((*MockecsAPI)(nil).DescribeClusters), input)
+}
+
+// CreateCluster mocks base method
+func (m *MockecsAPI) CreateCluster(input *ecsclient.CreateClusterInput) (*ecsclient.CreateClusterOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCluster", input)
+	ret0, _ := ret[0].(*ecsclient.CreateClusterOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateCluster indicates an expected call of CreateCluster
+func (mr *MockecsAPIMockRecorder) CreateCluster(input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCluster", reflect.TypeOf((*MockecsAPI)(nil).CreateCluster), input)
+}
+
+// DescribeContainerInstances mocks base method
+func (m *MockecsAPI) DescribeContainerInstances(input *ecsclient.DescribeContainerInstancesInput) (*ecsclient.DescribeContainerInstancesOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeContainerInstances", input)
+	ret0, _ := ret[0].(*ecsclient.DescribeContainerInstancesOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeContainerInstances indicates an expected call of DescribeContainerInstances
+func (mr *MockecsAPIMockRecorder) DescribeContainerInstances(input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeContainerInstances", reflect.TypeOf((*MockecsAPI)(nil).DescribeContainerInstances), input)
+}
+
+// TagResource mocks base method
+func (m *MockecsAPI) TagResource(input *ecsclient.TagResourceInput) (*ecsclient.TagResourceOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TagResource", input)
+	ret0, _ := ret[0].(*ecsclient.TagResourceOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TagResource indicates an expected call of TagResource
+func (mr *MockecsAPIMockRecorder) TagResource(input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TagResource", reflect.TypeOf((*MockecsAPI)(nil).TagResource), input)
+}
+
+// MockparameterStore is a mock of parameterStore interface
+type MockparameterStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockparameterStoreMockRecorder
+}
+
+// MockparameterStoreMockRecorder is the mock recorder for MockparameterStore
+type MockparameterStoreMockRecorder struct {
+	mock *MockparameterStore
+}
+
+// NewMockparameterStore creates a new mock instance
+func NewMockparameterStore(ctrl *gomock.Controller) *MockparameterStore {
+	mock := &MockparameterStore{ctrl: ctrl}
+	mock.recorder = &MockparameterStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockparameterStore) EXPECT() *MockparameterStoreMockRecorder {
+	return m.recorder
+}
+
+// GetParameterValue mocks base method
+func (m *MockparameterStore) GetParameterValue(name string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetParameterValue", name)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetParameterValue indicates an expected call of GetParameterValue
+func (mr *MockparameterStoreMockRecorder) GetParameterValue(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetParameterValue", reflect.TypeOf((*MockparameterStore)(nil).GetParameterValue), name)
+}
+
+// MockregistryAuthorizer is a mock of registryAuthorizer interface
+type MockregistryAuthorizer struct {
+	ctrl     *gomock.Controller
+	recorder *MockregistryAuthorizerMockRecorder
+}
+
+// MockregistryAuthorizerMockRecorder is the mock recorder for MockregistryAuthorizer
+type MockregistryAuthorizerMockRecorder struct {
+	mock *MockregistryAuthorizer
+}
+
+// NewMockregistryAuthorizer creates a new mock instance
+func NewMockregistryAuthorizer(ctrl *gomock.Controller) *MockregistryAuthorizer {
+	mock := &MockregistryAuthorizer{ctrl: ctrl}
+	mock.recorder = &MockregistryAuthorizerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockregistryAuthorizer) EXPECT() *MockregistryAuthorizerMockRecorder {
+	return m.recorder
+}
+
+// GetAuthorization mocks base method
+func (m *MockregistryAuthorizer) GetAuthorization(registryID string) (ecrclient.Authorization, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuthorization", registryID)
+	ret0, _ := ret[0].(ecrclient.Authorization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuthorization indicates an expected call of GetAuthorization
+func (mr *MockregistryAuthorizerMockRecorder) GetAuthorization(registryID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuthorization", reflect.TypeOf((*MockregistryAuthorizer)(nil).GetAuthorization), registryID)
+}
+
+// Mockec2API is a mock of ec2API interface
+type Mockec2API struct {
+	ctrl     *gomock.Controller
+	recorder *Mockec2APIMockRecorder
+}
+
+// Mockec2APIMockRecorder is the mock recorder for Mockec2API
+type Mockec2APIMockRecorder struct {
+	mock *Mockec2API
+}
+
+// NewMockec2API creates a new mock instance
+func NewMockec2API(ctrl *gomock.Controller) *Mockec2API {
+	mock := &Mockec2API{ctrl: ctrl}
+	mock.recorder = &Mockec2APIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *Mockec2API) EXPECT() *Mockec2APIMockRecorder {
+	return m.recorder
+}
+
+// CreateTags mocks base method
+func (m *Mockec2API) CreateTags(resourceID string, tags map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTags", resourceID, tags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateTags indicates an expected call of CreateTags
+func (mr *Mockec2APIMockRecorder) CreateTags(resourceID, tags interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTags", reflect.TypeOf((*Mockec2API)(nil).CreateTags), resourceID, tags)
+}
+
+// MockautoScalingAPI is a mock of autoScalingAPI interface
+type MockautoScalingAPI struct {
+	ctrl     *gomock.Controller
+	recorder *MockautoScalingAPIMockRecorder
+}
+
+// MockautoScalingAPIMockRecorder is the mock recorder for MockautoScalingAPI
+type MockautoScalingAPIMockRecorder struct {
+	mock *MockautoScalingAPI
+}
+
+// NewMockautoScalingAPI creates a new mock instance
+func NewMockautoScalingAPI(ctrl *gomock.Controller) *MockautoScalingAPI {
+	mock := &MockautoScalingAPI{ctrl: ctrl}
+	mock.recorder = &MockautoScalingAPIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockautoScalingAPI) EXPECT() *MockautoScalingAPIMockRecorder {
+	return m.recorder
+}
+
+// DescribeInstance mocks base method
+func (m *MockautoScalingAPI) DescribeInstance(instanceID string) (*autoscalingclient.Instance, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeInstance", instanceID)
+	ret0, _ := ret[0].(*autoscalingclient.Instance)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeInstance indicates an expected call of DescribeInstance
+func (mr *MockautoScalingAPIMockRecorder) DescribeInstance(instanceID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeInstance", reflect.TypeOf((*MockautoScalingAPI)(nil).DescribeInstance), instanceID)
+}
+
+// SetInstanceProtection mocks base method
+func (m *MockautoScalingAPI) SetInstanceProtection(group, instanceID string, protected bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetInstanceProtection", group, instanceID, protected)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetInstanceProtection indicates an expected call of SetInstanceProtection
+func (mr *MockautoScalingAPIMockRecorder) SetInstanceProtection(group, instanceID, protected interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetInstanceProtection", reflect.TypeOf((*MockautoScalingAPI)(nil).SetInstanceProtection), group, instanceID, protected)
+}
+
+// CompleteLifecycleAction mocks base method
+func (m *MockautoScalingAPI) CompleteLifecycleAction(group, hook, instanceID, result string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteLifecycleAction", group, hook, instanceID, result)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompleteLifecycleAction indicates an expected call of CompleteLifecycleAction
+func (mr *MockautoScalingAPIMockRecorder) CompleteLifecycleAction(group, hook, instanceID, result interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteLifecycleAction", reflect.TypeOf((*MockautoScalingAPI)(nil).CompleteLifecycleAction), group, hook, instanceID, result)
+}
+
+// MockinventoryAPI is a mock of inventoryAPI interface
+type MockinventoryAPI struct {
+	ctrl     *gomock.Controller
+	recorder *MockinventoryAPIMockRecorder
+}
+
+// MockinventoryAPIMockRecorder is the mock recorder for MockinventoryAPI
+type MockinventoryAPIMockRecorder struct {
+	mock *MockinventoryAPI
+}
+
+// NewMockinventoryAPI creates a new mock instance
+func NewMockinventoryAPI(ctrl *gomock.Controller) *MockinventoryAPI {
+	mock := &MockinventoryAPI{ctrl: ctrl}
+	mock.recorder = &MockinventoryAPIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockinventoryAPI) EXPECT() *MockinventoryAPIMockRecorder {
+	return m.recorder
+}
+
+// PutInventory mocks base method
+func (m *MockinventoryAPI) PutInventory(instanceID string, items ...ssmclient.InventoryItem) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{instanceID}
+	for _, a := range items {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "PutInventory", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutInventory indicates an expected call of PutInventory
+func (mr *MockinventoryAPIMockRecorder) PutInventory(instanceID interface{}, items ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{instanceID}, items...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutInventory", reflect.TypeOf((*MockinventoryAPI)(nil).PutInventory), varargs...)
+}
+
+// MockendpointProber is a mock of endpointProber interface
+type MockendpointProber struct {
+	ctrl     *gomock.Controller
+	recorder *MockendpointProberMockRecorder
+}
+
+// MockendpointProberMockRecorder is the mock recorder for MockendpointProber
+type MockendpointProberMockRecorder struct {
+	mock *MockendpointProber
+}
+
+// NewMockendpointProber creates a new mock instance
+func NewMockendpointProber(ctrl *gomock.Controller) *MockendpointProber {
+	mock := &MockendpointProber{ctrl: ctrl}
+	mock.recorder = &MockendpointProberMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockendpointProber) EXPECT() *MockendpointProberMockRecorder {
+	return m.recorder
+}
+
+// ProbeHTTP mocks base method
+func (m *MockendpointProber) ProbeHTTP(endpoint string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProbeHTTP", endpoint)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ProbeHTTP indicates an expected call of ProbeHTTP
+func (mr *MockendpointProberMockRecorder) ProbeHTTP(endpoint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProbeHTTP", reflect.TypeOf((*MockendpointProber)(nil).ProbeHTTP), endpoint)
+}
+
+// ProbeNTP mocks base method
+func (m *MockendpointProber) ProbeNTP(address string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProbeNTP", address)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ProbeNTP indicates an expected call of ProbeNTP
+func (mr *MockendpointProberMockRecorder) ProbeNTP(address interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProbeNTP", reflect.TypeOf((*MockendpointProber)(nil).ProbeNTP), address)
+}
+
+// MockintrospectionSocket is a mock of introspectionSocket interface
+type MockintrospectionSocket struct {
+	ctrl     *gomock.Controller
+	recorder *MockintrospectionSocketMockRecorder
+}
+
+// MockintrospectionSocketMockRecorder is the mock recorder for MockintrospectionSocket
+type MockintrospectionSocketMockRecorder struct {
+	mock *MockintrospectionSocket
+}
+
+// NewMockintrospectionSocket creates a new mock instance
+func NewMockintrospectionSocket(ctrl *gomock.Controller) *MockintrospectionSocket {
+	mock := &MockintrospectionSocket{ctrl: ctrl}
+	mock.recorder = &MockintrospectionSocketMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockintrospectionSocket) EXPECT() *MockintrospectionSocketMockRecorder {
+	return m.recorder
+}
+
+// Start mocks base method
+func (m *MockintrospectionSocket) Start() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Start indicates an expected call of Start
+func (mr *MockintrospectionSocketMockRecorder) Start() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockintrospectionSocket)(nil).Start))
+}
+
+// Stop mocks base method
+func (m *MockintrospectionSocket) Stop() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stop")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Stop indicates an expected call of Stop
+func (mr *MockintrospectionSocketMockRecorder) Stop() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockintrospectionSocket)(nil).Stop))
+}
+
+// MockmetricsServer is a mock of metricsServer interface
+type MockmetricsServer struct {
+	ctrl     *gomock.Controller
+	recorder *MockmetricsServerMockRecorder
+}
+
+// MockmetricsServerMockRecorder is the mock recorder for MockmetricsServer
+type MockmetricsServerMockRecorder struct {
+	mock *MockmetricsServer
+}
+
+// NewMockmetricsServer creates a new mock instance
+func NewMockmetricsServer(ctrl *gomock.Controller) *MockmetricsServer {
+	mock := &MockmetricsServer{ctrl: ctrl}
+	mock.recorder = &MockmetricsServerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockmetricsServer) EXPECT() *MockmetricsServerMockRecorder {
+	return m.recorder
+}
+
+// Start mocks base method
+func (m *MockmetricsServer) Start() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Start indicates an expected call of Start
+func (mr *MockmetricsServerMockRecorder) Start() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockmetricsServer)(nil).Start))
+}
+
+// Stop mocks base method
+func (m *MockmetricsServer) Stop() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stop")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Stop indicates an expected call of Stop
+func (mr *MockmetricsServerMockRecorder) Stop() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockmetricsServer)(nil).Stop))
+}
+
+// MocklogVolume is a mock of logVolume interface
+type MocklogVolume struct {
+	ctrl     *gomock.Controller
+	recorder *MocklogVolumeMockRecorder
+}
+
+// MocklogVolumeMockRecorder is the mock recorder for MocklogVolume
+type MocklogVolumeMockRecorder struct {
+	mock *MocklogVolume
+}
+
+// NewMocklogVolume creates a new mock instance
+func NewMocklogVolume(ctrl *gomock.Controller) *MocklogVolume {
+	mock := &MocklogVolume{ctrl: ctrl}
+	mock.recorder = &MocklogVolumeMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MocklogVolume) EXPECT() *MocklogVolumeMockRecorder {
+	return m.recorder
+}
+
+// Usage mocks base method
+func (m *MocklogVolume) Usage(agentLog string) (logvolume.Usage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Usage", agentLog)
+	ret0, _ := ret[0].(logvolume.Usage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Usage indicates an expected call of Usage
+func (mr *MocklogVolumeMockRecorder) Usage(agentLog interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Usage", reflect.TypeOf((*MocklogVolume)(nil).Usage), agentLog)
+}
+
+// Excess mocks base method
+func (m *MocklogVolume) Excess(agentLog string, maxBytes int64) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Excess", agentLog, maxBytes)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Excess indicates an expected call of Excess
+func (mr *MocklogVolumeMockRecorder) Excess(agentLog, maxBytes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Excess", reflect.TypeOf((*MocklogVolume)(nil).Excess), agentLog, maxBytes)
+}
+
+// Remove mocks base method
+func (m *MocklogVolume) Remove(file string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Remove", file)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Remove indicates an expected call of Remove
+func (mr *MocklogVolumeMockRecorder) Remove(file interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MocklogVolume)(nil).Remove), file)
+}
+
+// MocktaskMetadataProbe is a mock of taskMetadataProbe interface
+type MocktaskMetadataProbe struct {
+	ctrl     *gomock.Controller
+	recorder *MocktaskMetadataProbeMockRecorder
+}
+
+// MocktaskMetadataProbeMockRecorder is the mock recorder for MocktaskMetadataProbe
+type MocktaskMetadataProbeMockRecorder struct {
+	mock *MocktaskMetadataProbe
+}
+
+// NewMocktaskMetadataProbe creates a new mock instance
+func NewMocktaskMetadataProbe(ctrl *gomock.Controller) *MocktaskMetadataProbe {
+	mock := &MocktaskMetadataProbe{ctrl: ctrl}
+	mock.recorder = &MocktaskMetadataProbeMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MocktaskMetadataProbe) EXPECT() *MocktaskMetadataProbeMockRecorder {
+	return m.recorder
+}
+
+// Probe mocks base method
+func (m *MocktaskMetadataProbe) Probe() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Probe")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Probe indicates an expected call of Probe
+func (mr *MocktaskMetadataProbeMockRecorder) Probe() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Probe", reflect.TypeOf((*MocktaskMetadataProbe)(nil).Probe))
+}
+
+// MockagentMetadata is a mock of agentMetadata interface
+type MockagentMetadata struct {
+	ctrl     *gomock.Controller
+	recorder *MockagentMetadataMockRecorder
+}
+
+// MockagentMetadataMockRecorder is the mock recorder for MockagentMetadata
+type MockagentMetadataMockRecorder struct {
+	mock *MockagentMetadata
+}
+
+// NewMockagentMetadata creates a new mock instance
+func NewMockagentMetadata(ctrl *gomock.Controller) *MockagentMetadata {
+	mock := &MockagentMetadata{ctrl: ctrl}
+	mock.recorder = &MockagentMetadataMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockagentMetadata) EXPECT() *MockagentMetadataMockRecorder {
+	return m.recorder
+}
+
+// Metadata mocks base method
+func (m *MockagentMetadata) Metadata() (*introspection.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Metadata")
+	ret0, _ := ret[0].(*introspection.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Metadata indicates an expected call of Metadata
+func (mr *MockagentMetadataMockRecorder) Metadata() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Metadata", reflect.TypeOf((*MockagentMetadata)(nil).Metadata))
+}
+
+// MockportChecker is a mock of portChecker interface
+type MockportChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockportCheckerMockRecorder
+}
+
+// MockportCheckerMockRecorder is the mock recorder for MockportChecker
+type MockportCheckerMockRecorder struct {
+	mock *MockportChecker
+}
+
+// NewMockportChecker creates a new mock instance
+func NewMockportChecker(ctrl *gomock.Controller) *MockportChecker {
+	mock := &MockportChecker{ctrl: ctrl}
+	mock.recorder = &MockportCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockportChecker) EXPECT() *MockportCheckerMockRecorder {
+	return m.recorder
+}
+
+// Check mocks base method
+func (m *MockportChecker) Check(reserved []uint16) ([]ports.Conflict, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Check", reserved)
+	ret0, _ := ret[0].([]ports.Conflict)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Check indicates an expected call of Check
+func (mr *MockportCheckerMockRecorder) Check(reserved interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Check", reflect.TypeOf((*MockportChecker)(nil).Check), reserved)
+}
+
+// MockexecPrerequisites is a mock of execPrerequisites interface
+type MockexecPrerequisites struct {
+	ctrl     *gomock.Controller
+	recorder *MockexecPrerequisitesMockRecorder
+}
+
+// MockexecPrerequisitesMockRecorder is the mock recorder for MockexecPrerequisites
+type MockexecPrerequisitesMockRecorder struct {
+	mock *MockexecPrerequisites
+}
+
+// NewMockexecPrerequisites creates a new mock instance
+func NewMockexecPrerequisites(ctrl *gomock.Controller) *MockexecPrerequisites {
+	mock := &MockexecPrerequisites{ctrl: ctrl}
+	mock.recorder = &MockexecPrerequisitesMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockexecPrerequisites) EXPECT() *MockexecPrerequisitesMockRecorder {
+	return m.recorder
+}
+
+// Prepare mocks base method
+func (m *MockexecPrerequisites) Prepare(ctx context.Context, region, version string, offline bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prepare", ctx, region, version, offline)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Prepare indicates an expected call of Prepare
+func (mr *MockexecPrerequisitesMockRecorder) Prepare(ctx, region, version, offline interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prepare", reflect.TypeOf((*MockexecPrerequisites)(nil).Prepare), ctx, region, version, offline)
+}
+
+// MockebsTaskAttach is a mock of ebsTaskAttach interface
+type MockebsTaskAttach struct {
+	ctrl     *gomock.Controller
+	recorder *MockebsTaskAttachMockRecorder
+}
+
+// MockebsTaskAttachMockRecorder is the mock recorder for MockebsTaskAttach
+type MockebsTaskAttachMockRecorder struct {
+	mock *MockebsTaskAttach
+}
+
+// NewMockebsTaskAttach creates a new mock instance
+func NewMockebsTaskAttach(ctrl *gomock.Controller) *MockebsTaskAttach {
+	mock := &MockebsTaskAttach{ctrl: ctrl}
+	mock.recorder = &MockebsTaskAttachMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockebsTaskAttach) EXPECT() *MockebsTaskAttachMockRecorder {
+	return m.recorder
+}
+
+// Prepare mocks base method
+func (m *MockebsTaskAttach) Prepare() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prepare")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Prepare indicates an expected call of Prepare
+func (mr *MockebsTaskAttachMockRecorder) Prepare() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prepare", reflect.TypeOf((*MockebsTaskAttach)(nil).Prepare))
+}
+
+// MockappArmorProfile is a mock of appArmorProfile interface
+type MockappArmorProfile struct {
+	ctrl     *gomock.Controller
+	recorder *MockappArmorProfileMockRecorder
+}
+
+// MockappArmorProfileMockRecorder is the mock recorder for MockappArmorProfile
+type MockappArmorProfileMockRecorder struct {
+	mock *MockappArmorProfile
+}
+
+// NewMockappArmorProfile creates a new mock instance
+func NewMockappArmorProfile(ctrl *gomock.Controller) *MockappArmorProfile {
+	mock := &MockappArmorProfile{ctrl: ctrl}
+	mock.recorder = &MockappArmorProfileMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockappArmorProfile) EXPECT() *MockappArmorProfileMockRecorder {
+	return m.recorder
+}
+
+// Load mocks base method
+func (m *MockappArmorProfile) Load() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Load")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Load indicates an expected call of Load
+func (mr *MockappArmorProfileMockRecorder) Load() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Load", reflect.TypeOf((*MockappArmorProfile)(nil).Load))
+}
+
+// MockvolumePlugin is a mock of volumePlugin interface
+type MockvolumePlugin struct {
+	ctrl     *gomock.Controller
+	recorder *MockvolumePluginMockRecorder
+}
+
+// MockvolumePluginMockRecorder is the mock recorder for MockvolumePlugin
+type MockvolumePluginMockRecorder struct {
+	mock *MockvolumePlugin
+}
+
+// NewMockvolumePlugin creates a new mock instance
+func NewMockvolumePlugin(ctrl *gomock.Controller) *MockvolumePlugin {
+	mock := &MockvolumePlugin{ctrl: ctrl}
+	mock.recorder = &MockvolumePluginMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockvolumePlugin) EXPECT() *MockvolumePluginMockRecorder {
+	return m.recorder
+}
+
+// Start mocks base method
+func (m *MockvolumePlugin) Start() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Start indicates an expected call of Start
+func (mr *MockvolumePluginMockRecorder) Start() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockvolumePlugin)(nil).Start))
+}
+
+// Stop mocks base method
+func (m *MockvolumePlugin) Stop() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stop")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Stop indicates an expected call of Stop
+func (mr *MockvolumePluginMockRecorder) Stop() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockvolumePlugin)(nil).Stop))
+}
+
+// RestartIfUpdated mocks base method
+func (m *MockvolumePlugin) RestartIfUpdated() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestartIfUpdated")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestartIfUpdated indicates an expected call of RestartIfUpdated
+func (mr *MockvolumePluginMockRecorder) RestartIfUpdated() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestartIfUpdated", reflect.TypeOf((*MockvolumePlugin)(nil).RestartIfUpdated))
+}
+
+// MockefsUtils is a mock of efsUtils interface
+type MockefsUtils struct {
+	ctrl     *gomock.Controller
+	recorder *MockefsUtilsMockRecorder
+}
+
+// MockefsUtilsMockRecorder is the mock recorder for MockefsUtils
+type MockefsUtilsMockRecorder struct {
+	mock *MockefsUtils
+}
+
+// NewMockefsUtils creates a new mock instance
+func NewMockefsUtils(ctrl *gomock.Controller) *MockefsUtils {
+	mock := &MockefsUtils{ctrl: ctrl}
+	mock.recorder = &MockefsUtilsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockefsUtils) EXPECT() *MockefsUtilsMockRecorder {
+	return m.recorder
+}
+
+// Check mocks base method
+func (m *MockefsUtils) Check() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Check")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Check indicates an expected call of Check
+func (mr *MockefsUtilsMockRecorder) Check() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Check", reflect.TypeOf((*MockefsUtils)(nil).Check))
+}
+
+// Install mocks base method
+func (m *MockefsUtils) Install() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Install")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Install indicates an expected call of Install
+func (mr *MockefsUtilsMockRecorder) Install() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Install", reflect.TypeOf((*MockefsUtils)(nil).Install))
+}
+
+// MockserviceNotifier is a mock of serviceNotifier interface
+type MockserviceNotifier struct {
+	ctrl     *gomock.Controller
+	recorder *MockserviceNotifierMockRecorder
+}
+
+// MockserviceNotifierMockRecorder is the mock recorder for MockserviceNotifier
+type MockserviceNotifierMockRecorder struct {
+	mock *MockserviceNotifier
+}
+
+// NewMockserviceNotifier creates a new mock instance
+func NewMockserviceNotifier(ctrl *gomock.Controller) *MockserviceNotifier {
+	mock := &MockserviceNotifier{ctrl: ctrl}
+	mock.recorder = &MockserviceNotifierMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockserviceNotifier) EXPECT() *MockserviceNotifierMockRecorder {
+	return m.recorder
+}
+
+// Notify mocks base method
+func (m *MockserviceNotifier) Notify(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Notify", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Notify indicates an expected call of Notify
+func (mr *MockserviceNotifierMockRecorder) Notify(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Notify", reflect.TypeOf((*MockserviceNotifier)(nil).Notify), arg0)
+}
+
+// WatchdogInterval mocks base method
+func (m *MockserviceNotifier) WatchdogInterval() time.Duration {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WatchdogInterval")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+// WatchdogInterval indicates an expected call of WatchdogInterval
+func (mr *MockserviceNotifierMockRecorder) WatchdogInterval() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WatchdogInterval", reflect.TypeOf((*MockserviceNotifier)(nil).WatchdogInterval))
+}
+
+// MockstartGate is a mock of startGate interface
+type MockstartGate struct {
+	ctrl     *gomock.Controller
+	recorder *MockstartGateMockRecorder
+}
+
+// MockstartGateMockRecorder is the mock recorder for MockstartGate
+type MockstartGateMockRecorder struct {
+	mock *MockstartGate
+}
+
+// NewMockstartGate creates a new mock instance
+func NewMockstartGate(ctrl *gomock.Controller) *MockstartGate {
+	mock := &MockstartGate{ctrl: ctrl}
+	mock.recorder = &MockstartGateMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockstartGate) EXPECT() *MockstartGateMockRecorder {
+	return m.recorder
+}
+
+// FileExists mocks base method
+func (m *MockstartGate) FileExists(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FileExists", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FileExists indicates an expected call of FileExists
+func (mr *MockstartGateMockRecorder) FileExists(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FileExists", reflect.TypeOf((*MockstartGate)(nil).FileExists), arg0)
+}
+
+// CommandSucceeds mocks base method
+func (m *MockstartGate) CommandSucceeds(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CommandSucceeds", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CommandSucceeds indicates an expected call of CommandSucceeds
+func (mr *MockstartGateMockRecorder) CommandSucceeds(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommandSucceeds", reflect.TypeOf((*MockstartGate)(nil).CommandSucceeds), arg0)
+}
+
+// MocksysctlProfile is a mock of sysctlProfile interface
+type MocksysctlProfile struct {
+	ctrl     *gomock.Controller
+	recorder *MocksysctlProfileMockRecorder
+}
+
+// MocksysctlProfileMockRecorder is the mock recorder for MocksysctlProfile
+type MocksysctlProfileMockRecorder struct {
+	mock *MocksysctlProfile
+}
+
+// NewMocksysctlProfile creates a new mock instance
+func NewMocksysctlProfile(ctrl *gomock.Controller) *MocksysctlProfile {
+	mock := &MocksysctlProfile{ctrl: ctrl}
+	mock.recorder = &MocksysctlProfileMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MocksysctlProfile) EXPECT() *MocksysctlProfileMockRecorder {
+	return m.recorder
+}
+
+// Apply mocks base method
+func (m *MocksysctlProfile) Apply() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Apply")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Apply indicates an expected call of Apply
+func (mr *MocksysctlProfileMockRecorder) Apply() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Apply", reflect.TypeOf((*MocksysctlProfile)(nil).Apply))
+}
+
+// MockhostReservation is a mock of hostReservation interface
+type MockhostReservation struct {
+	ctrl     *gomock.Controller
+	recorder *MockhostReservationMockRecorder
+}
+
+// MockhostReservationMockRecorder is the mock recorder for MockhostReservation
+type MockhostReservationMockRecorder struct {
+	mock *MockhostReservation
+}
+
+// NewMockhostReservation creates a new mock instance
+func NewMockhostReservation(ctrl *gomock.Controller) *MockhostReservation {
+	mock := &MockhostReservation{ctrl: ctrl}
+	mock.recorder = &MockhostReservationMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockhostReservation) EXPECT() *MockhostReservationMockRecorder {
+	return m.recorder
+}
+
+// Reserve mocks base method
+func (m *MockhostReservation) Reserve(memoryMiB int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reserve", memoryMiB)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reserve indicates an expected call of Reserve
+func (mr *MockhostReservationMockRecorder) Reserve(memoryMiB interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reserve", reflect.TypeOf((*MockhostReservation)(nil).Reserve), memoryMiB)
+}
+
+// MockloopbackRouting is a mock of loopbackRouting interface
+type MockloopbackRouting struct {
+	ctrl     *gomock.Controller
+	recorder *MockloopbackRoutingMockRecorder
+}
+
+// MockloopbackRoutingMockRecorder is the mock recorder for MockloopbackRouting
+type MockloopbackRoutingMockRecorder struct {
+	mock *MockloopbackRouting
+}
+
+// NewMockloopbackRouting creates a new mock instance
+func NewMockloopbackRouting(ctrl *gomock.Controller) *MockloopbackRouting {
+	mock := &MockloopbackRouting{ctrl: ctrl}
+	mock.recorder = &MockloopbackRoutingMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockloopbackRouting) EXPECT() *MockloopbackRoutingMockRecorder {
+	return m.recorder
+}
+
+// Enable mocks base method
+func (m *MockloopbackRouting) Enable() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Enable")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Enable indicates an expected call of Enable
+func (mr *MockloopbackRoutingMockRecorder) Enable() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enable", reflect.TypeOf((*MockloopbackRouting)(nil).Enable))
+}
+
+// RestoreDefault mocks base method
+func (m *MockloopbackRouting) RestoreDefault() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreDefault")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreDefault indicates an expected call of RestoreDefault
+func (mr *MockloopbackRoutingMockRecorder) RestoreDefault() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreDefault", reflect.TypeOf((*MockloopbackRouting)(nil).RestoreDefault))
+}
+
+// MockcredentialsProxyRoute is a mock of credentialsProxyRoute interface
+type MockcredentialsProxyRoute struct {
+	ctrl     *gomock.Controller
+	recorder *MockcredentialsProxyRouteMockRecorder
+}
+
+// MockcredentialsProxyRouteMockRecorder is the mock recorder for MockcredentialsProxyRoute
+type MockcredentialsProxyRouteMockRecorder struct {
+	mock *MockcredentialsProxyRoute
+}
+
+// NewMockcredentialsProxyRoute creates a new mock instance
+func NewMockcredentialsProxyRoute(ctrl *gomock.Controller) *MockcredentialsProxyRoute {
+	mock := &MockcredentialsProxyRoute{ctrl: ctrl}
+	mock.recorder = &MockcredentialsProxyRouteMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockcredentialsProxyRoute) EXPECT() *MockcredentialsProxyRouteMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method
+func (m *MockcredentialsProxyRoute) Create() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create
+func (mr *MockcredentialsProxyRouteMockRecorder) Create() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockcredentialsProxyRoute)(nil).Create))
+}
+
+// Remove mocks base method
+func (m *MockcredentialsProxyRoute) Remove() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Remove")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Remove indicates an expected call of Remove
+func (mr *MockcredentialsProxyRouteMockRecorder) Remove() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockcredentialsProxyRoute)(nil).Remove))
+}
+
+// MockagentEgressPolicy is a mock of agentEgressPolicy interface
+type MockagentEgressPolicy struct {
+	ctrl     *gomock.Controller
+	recorder *MockagentEgressPolicyMockRecorder
+}
+
+// MockagentEgressPolicyMockRecorder is the mock recorder for MockagentEgressPolicy
+type MockagentEgressPolicyMockRecorder struct {
+	mock *MockagentEgressPolicy
+}
+
+// NewMockagentEgressPolicy creates a new mock instance
+func NewMockagentEgressPolicy(ctrl *gomock.Controller) *MockagentEgressPolicy {
+	mock := &MockagentEgressPolicy{ctrl: ctrl}
+	mock.recorder = &MockagentEgressPolicyMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockagentEgressPolicy) EXPECT() *MockagentEgressPolicyMockRecorder {
+	return m.recorder
+}
+
+// Apply mocks base method
+func (m *MockagentEgressPolicy) Apply(iface string, destinations []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Apply", iface, destinations)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Apply indicates an expected call of Apply
+func (mr *MockagentEgressPolicyMockRecorder) Apply(iface, destinations interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Apply", reflect.TypeOf((*MockagentEgressPolicy)(nil).Apply), iface, destinations)
+}
+
+// Remove mocks base method
+func (m *MockagentEgressPolicy) Remove(iface string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Remove", iface)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Remove indicates an expected call of Remove
+func (mr *MockagentEgressPolicyMockRecorder) Remove(iface interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockagentEgressPolicy)(nil).Remove), iface)
+}
+
+// MockpersistenceDaemon is a mock of persistenceDaemon interface
+type MockpersistenceDaemon struct {
+	ctrl     *gomock.Controller
+	recorder *MockpersistenceDaemonMockRecorder
+}
+
+// MockpersistenceDaemonMockRecorder is the mock recorder for MockpersistenceDaemon
+type MockpersistenceDaemonMockRecorder struct {
+	mock *MockpersistenceDaemon
+}
+
+// NewMockpersistenceDaemon creates a new mock instance
+func NewMockpersistenceDaemon(ctrl *gomock.Controller) *MockpersistenceDaemon {
+	mock := &MockpersistenceDaemon{ctrl: ctrl}
+	mock.recorder = &MockpersistenceDaemonMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockpersistenceDaemon) EXPECT() *MockpersistenceDaemonMockRecorder {
+	return m.recorder
+}
+
+// Ensure mocks base method
+func (m *MockpersistenceDaemon) Ensure() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ensure")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ensure indicates an expected call of Ensure
+func (mr *MockpersistenceDaemonMockRecorder) Ensure() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ensure", reflect.TypeOf((*MockpersistenceDaemon)(nil).Ensure))
+}
+
+// MockhookRunner is a mock of hookRunner interface
+type MockhookRunner struct {
+	ctrl     *gomock.Controller
+	recorder *MockhookRunnerMockRecorder
+}
+
+// MockhookRunnerMockRecorder is the mock recorder for MockhookRunner
+type MockhookRunnerMockRecorder struct {
+	mock *MockhookRunner
+}
+
+// NewMockhookRunner creates a new mock instance
+func NewMockhookRunner(ctrl *gomock.Controller) *MockhookRunner {
+	mock := &MockhookRunner{ctrl: ctrl}
+	mock.recorder = &MockhookRunnerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockhookRunner) EXPECT() *MockhookRunnerMockRecorder {
+	return m.recorder
+}
+
+// Run mocks base method
+func (m *MockhookRunner) Run(ctx context.Context, stage string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Run", ctx, stage)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Run indicates an expected call of Run
+func (mr *MockhookRunnerMockRecorder) Run(ctx, stage interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Run", reflect.TypeOf((*MockhookRunner)(nil).Run), ctx, stage)
+}
+
+// MockhistoryLog is a mock of historyLog interface
+type MockhistoryLog struct {
+	ctrl     *gomock.Controller
+	recorder *MockhistoryLogMockRecorder
+}
+
+// MockhistoryLogMockRecorder is the mock recorder for MockhistoryLog
+type MockhistoryLogMockRecorder struct {
+	mock *MockhistoryLog
+}
+
+// NewMockhistoryLog creates a new mock instance
+func NewMockhistoryLog(ctrl *gomock.Controller) *MockhistoryLog {
+	mock := &MockhistoryLog{ctrl: ctrl}
+	mock.recorder = &MockhistoryLogMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockhistoryLog) EXPECT() *MockhistoryLogMockRecorder {
+	return m.recorder
+}
+
+// Append mocks base method
+func (m *MockhistoryLog) Append(event history.Event) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Append", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Append indicates an expected call of Append
+func (mr *MockhistoryLogMockRecorder) Append(event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Append", reflect.TypeOf((*MockhistoryLog)(nil).Append), event)
 }
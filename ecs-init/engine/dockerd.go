@@ -0,0 +1,136 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/dockerd"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// dockerdCheckInterval is how often the Docker daemon is pinged while
+	// it is supervised
+	dockerdCheckInterval = 30 * time.Second
+	// dockerdUnresponsiveChecks is how many pings in a row the Docker
+	// daemon has to miss to be considered wedged
+	dockerdUnresponsiveChecks = 3
+	// dockerdRestartCooldown is how long the Docker daemon is given to
+	// recover after it was restarted before it is restarted again
+	dockerdRestartCooldown = 10 * time.Minute
+	// unitStateActivating is the state of a unit that systemd is starting
+	unitStateActivating = "activating"
+)
+
+// dockerdSupervisor tracks the health of the Docker daemon across checks
+type dockerdSupervisor struct {
+	docker      dockerClient
+	daemon      dockerDaemon
+	clock       clock.Clock
+	mode        string
+	failures    int
+	lastRestart time.Time
+}
+
+// startDockerdSupervision pings the Docker daemon in the background while
+// the Agent is supervised, and reports or restarts the daemon once it stops
+// responding, since the Agent cannot run without it. The returned function
+// stops the supervision.
+func (e *Engine) startDockerdSupervision(ctx context.Context) func() {
+	mode, err := config.DockerdSupervision()
+	if err != nil {
+		log.Warnf("Not supervising the Docker daemon: %v", err)
+		return func() {}
+	}
+	if mode == "" || e.dockerDaemon == nil {
+		return func() {}
+	}
+	log.Infof("Supervising the Docker daemon (%s when it stops responding)", mode)
+	supervisor := &dockerdSupervisor{
+		docker: e.docker,
+		daemon: e.dockerDaemon,
+		clock:  e.clk(),
+		mode:   mode,
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := supervisor.clock.NewTicker(dockerdCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				supervisor.check(ctx)
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// check pings the Docker daemon and acts on it once it has missed
+// dockerdUnresponsiveChecks pings in a row
+func (s *dockerdSupervisor) check(ctx context.Context) {
+	err := s.docker.Ping(ctx)
+	if err == nil {
+		if s.failures >= dockerdUnresponsiveChecks {
+			log.Infof("Docker daemon is responding again")
+		}
+		s.failures = 0
+		return
+	}
+	s.failures++
+	log.Warnf("Docker daemon did not respond to ping (%d/%d): %v", s.failures, dockerdUnresponsiveChecks, err)
+	if s.failures < dockerdUnresponsiveChecks {
+		return
+	}
+	state, err := s.daemon.UnitState()
+	if err != nil {
+		log.Warnf("Could not read the state of the Docker daemon: %v", err)
+		state = "unknown"
+	}
+	if s.failures == dockerdUnresponsiveChecks {
+		log.Errorf("Docker daemon is not responding and %s is %s, the Agent cannot run", dockerd.Unit, state)
+	}
+	if s.mode != config.DockerdSupervisionRestart {
+		return
+	}
+	if state == unitStateActivating {
+		log.Infof("Not restarting %s, it is being started", dockerd.Unit)
+		return
+	}
+	if !s.lastRestart.IsZero() && s.clock.Since(s.lastRestart) < dockerdRestartCooldown {
+		return
+	}
+	log.Warnf("Restarting unresponsive %s", dockerd.Unit)
+	s.lastRestart = s.clock.Now()
+	err = s.daemon.Restart()
+	if err != nil {
+		log.Errorf("Could not restart the Docker daemon: %v", err)
+		return
+	}
+	s.failures = 0
+}
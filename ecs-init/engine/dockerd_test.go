@@ -0,0 +1,152 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDockerdSupervisor(mockCtrl *gomock.Controller, mode string) (*dockerdSupervisor, *MockdockerClient, *MockdockerDaemon) {
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDaemon := NewMockdockerDaemon(mockCtrl)
+	return &dockerdSupervisor{
+		docker: mockDocker,
+		daemon: mockDaemon,
+		clock:  clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+		mode:   mode,
+	}, mockDocker, mockDaemon
+}
+
+func TestDockerdSupervisorAlert(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	supervisor, mockDocker, mockDaemon := newTestDockerdSupervisor(mockCtrl, config.DockerdSupervisionAlert)
+	gomock.InOrder(
+		mockDocker.EXPECT().Ping(gomock.Any()).Return(errors.New("test error")).Times(dockerdUnresponsiveChecks-1),
+		mockDocker.EXPECT().Ping(gomock.Any()).Return(errors.New("test error")),
+		mockDaemon.EXPECT().UnitState().Return("active", nil),
+		mockDocker.EXPECT().Ping(gomock.Any()).Return(nil),
+	)
+
+	for i := 0; i <= dockerdUnresponsiveChecks; i++ {
+		supervisor.check(context.Background())
+	}
+	assert.Equal(t, 0, supervisor.failures)
+}
+
+func TestDockerdSupervisorRestart(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	supervisor, mockDocker, mockDaemon := newTestDockerdSupervisor(mockCtrl, config.DockerdSupervisionRestart)
+	gomock.InOrder(
+		mockDocker.EXPECT().Ping(gomock.Any()).Return(errors.New("test error")).Times(dockerdUnresponsiveChecks),
+		mockDaemon.EXPECT().UnitState().Return("active", nil),
+		mockDaemon.EXPECT().Restart(),
+	)
+
+	for i := 0; i < dockerdUnresponsiveChecks; i++ {
+		supervisor.check(context.Background())
+	}
+	assert.Equal(t, 0, supervisor.failures)
+	assert.False(t, supervisor.lastRestart.IsZero())
+}
+
+func TestDockerdSupervisorRestartCooldown(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	supervisor, mockDocker, mockDaemon := newTestDockerdSupervisor(mockCtrl, config.DockerdSupervisionRestart)
+	supervisor.failures = dockerdUnresponsiveChecks
+	supervisor.lastRestart = supervisor.clock.Now()
+	gomock.InOrder(
+		mockDocker.EXPECT().Ping(gomock.Any()).Return(errors.New("test error")),
+		mockDaemon.EXPECT().UnitState().Return("failed", nil),
+	)
+
+	supervisor.check(context.Background())
+	assert.Equal(t, dockerdUnresponsiveChecks+1, supervisor.failures)
+}
+
+func TestDockerdSupervisorRestartAfterCooldown(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	supervisor, mockDocker, mockDaemon := newTestDockerdSupervisor(mockCtrl, config.DockerdSupervisionRestart)
+	supervisor.failures = dockerdUnresponsiveChecks
+	supervisor.lastRestart = supervisor.clock.Now()
+	supervisor.clock.(*clock.Fake).Advance(dockerdRestartCooldown)
+	gomock.InOrder(
+		mockDocker.EXPECT().Ping(gomock.Any()).Return(errors.New("test error")),
+		mockDaemon.EXPECT().UnitState().Return("failed", nil),
+		mockDaemon.EXPECT().Restart(),
+	)
+
+	supervisor.check(context.Background())
+	assert.Equal(t, 0, supervisor.failures)
+	assert.Equal(t, supervisor.clock.Now(), supervisor.lastRestart)
+}
+
+func TestDockerdSupervisorNoRestartWhileActivating(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	supervisor, mockDocker, mockDaemon := newTestDockerdSupervisor(mockCtrl, config.DockerdSupervisionRestart)
+	supervisor.failures = dockerdUnresponsiveChecks - 1
+	gomock.InOrder(
+		mockDocker.EXPECT().Ping(gomock.Any()).Return(errors.New("test error")),
+		mockDaemon.EXPECT().UnitState().Return(unitStateActivating, nil),
+	)
+
+	supervisor.check(context.Background())
+	assert.True(t, supervisor.lastRestart.IsZero())
+}
+
+func TestDockerdSupervisorRestartFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	supervisor, mockDocker, mockDaemon := newTestDockerdSupervisor(mockCtrl, config.DockerdSupervisionRestart)
+	supervisor.failures = dockerdUnresponsiveChecks - 1
+	gomock.InOrder(
+		mockDocker.EXPECT().Ping(gomock.Any()).Return(errors.New("test error")),
+		mockDaemon.EXPECT().UnitState().Return("", errors.New("test error")),
+		mockDaemon.EXPECT().Restart().Return(errors.New("test error")),
+	)
+
+	supervisor.check(context.Background())
+	assert.Equal(t, dockerdUnresponsiveChecks, supervisor.failures)
+}
+
+func TestStartDockerdSupervisionDisabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	engine := &Engine{
+		docker:       NewMockdockerClient(mockCtrl),
+		dockerDaemon: NewMockdockerDaemon(mockCtrl),
+	}
+	stop := engine.startDockerdSupervision(context.Background())
+	stop()
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// downloadGateInterval is how often the download gate parameter is read
+	// while the gate is closed
+	downloadGateInterval = 30 * time.Second
+	// downloadGateMaxErrors is how many reads of the download gate
+	// parameter in a row may fail before the gate is ignored, so that a
+	// missing permission does not hold the Agent back indefinitely
+	downloadGateMaxErrors = 5
+)
+
+// downloadJitterFraction returns the fraction of the download jitter a
+// download is delayed by
+var downloadJitterFraction = rand.Float64
+
+// awaitDownloadSlot holds a download of the Agent back for a random part of
+// the download jitter, then until the download gate is open, so that a fleet
+// scaling out or upgrading at once spreads its downloads
+func (e *Engine) awaitDownloadSlot(ctx context.Context) error {
+	jitter, err := config.DownloadJitter()
+	if err != nil {
+		log.Warnf("Not delaying the download of the Agent: %v", err)
+	} else if jitter > 0 {
+		delay := time.Duration(downloadJitterFraction() * float64(jitter))
+		if e.dryRun {
+			log.Infof("Dry run: would delay the download of the Agent by %s", delay)
+		} else {
+			log.Infof("Delaying the download of the Agent by %s", delay)
+			err = clock.SleepContext(ctx, e.clk(), delay)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return e.awaitDownloadGate(ctx)
+}
+
+// awaitDownloadGate waits until the SSM parameter gating downloads holds
+// config.DownloadGateOpen, if a gate is set
+func (e *Engine) awaitDownloadGate(ctx context.Context) error {
+	name := config.DownloadGateParameter()
+	if name == "" || e.offline {
+		return nil
+	}
+	failures := 0
+	for {
+		value, err := e.parameterValue(name)
+		switch {
+		case err != nil:
+			failures++
+			if failures >= downloadGateMaxErrors {
+				log.Warnf("Ignoring the download gate: %v", err)
+				return nil
+			}
+			log.Warnf("Could not check the download gate: %v", err)
+		case strings.TrimSpace(value) == config.DownloadGateOpen:
+			return nil
+		default:
+			failures = 0
+			log.Infof("Holding the download of the Agent back until %s is %q, it is %q",
+				name, config.DownloadGateOpen, strings.TrimSpace(value))
+		}
+		if e.dryRun {
+			log.Info("Dry run: would wait for the download gate to open")
+			return nil
+		}
+		err = clock.SleepContext(ctx, e.clk(), downloadGateInterval)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDownloadGateParameter = "/fleet/agent-download"
+
+func TestAwaitDownloadSlotJitter(t *testing.T) {
+	os.Setenv(config.DownloadJitterEnvVar, "10m")
+	defer os.Unsetenv(config.DownloadJitterEnvVar)
+	defer func() { downloadJitterFraction = rand.Float64 }()
+	downloadJitterFraction = func() float64 { return 0.5 }
+
+	start := time.Now()
+	fakeClock := clock.NewFake(start)
+	engine := &Engine{clock: fakeClock}
+	done := make(chan error)
+	go func() {
+		done <- engine.awaitDownloadSlot(context.Background())
+	}()
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(5 * time.Minute)
+	assert.NoError(t, <-done)
+	assert.Equal(t, 5*time.Minute, fakeClock.Since(start))
+}
+
+func TestAwaitDownloadSlotJitterCanceled(t *testing.T) {
+	os.Setenv(config.DownloadJitterEnvVar, "10m")
+	defer os.Unsetenv(config.DownloadJitterEnvVar)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	engine := &Engine{clock: clock.NewFake(time.Now())}
+	assert.Equal(t, context.Canceled, engine.awaitDownloadSlot(ctx))
+}
+
+func TestAwaitDownloadGate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	os.Setenv(config.DownloadGateParameterEnvVar, testDownloadGateParameter)
+	defer os.Unsetenv(config.DownloadGateParameterEnvVar)
+
+	mockParameterStore := NewMockparameterStore(mockCtrl)
+	gomock.InOrder(
+		mockParameterStore.EXPECT().GetParameterValue(testDownloadGateParameter).Return("no-go", nil),
+		mockParameterStore.EXPECT().GetParameterValue(testDownloadGateParameter).Return("", errors.New("throttled")),
+		mockParameterStore.EXPECT().GetParameterValue(testDownloadGateParameter).Return("go\n", nil),
+	)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{parameterStore: mockParameterStore, clock: fakeClock}
+	done := make(chan error)
+	go func() {
+		done <- engine.awaitDownloadSlot(context.Background())
+	}()
+	for i := 0; i < 2; i++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(downloadGateInterval)
+	}
+	assert.NoError(t, <-done)
+}
+
+func TestAwaitDownloadGateIgnoredAfterErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	os.Setenv(config.DownloadGateParameterEnvVar, testDownloadGateParameter)
+	defer os.Unsetenv(config.DownloadGateParameterEnvVar)
+
+	mockParameterStore := NewMockparameterStore(mockCtrl)
+	mockParameterStore.EXPECT().GetParameterValue(testDownloadGateParameter).
+		Return("", errors.New("access denied")).Times(downloadGateMaxErrors)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{parameterStore: mockParameterStore, clock: fakeClock}
+	done := make(chan error)
+	go func() {
+		done <- engine.awaitDownloadGate(context.Background())
+	}()
+	for i := 0; i < downloadGateMaxErrors-1; i++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(downloadGateInterval)
+	}
+	assert.NoError(t, <-done)
+}
+
+func TestAwaitDownloadGateOffline(t *testing.T) {
+	os.Setenv(config.DownloadGateParameterEnvVar, testDownloadGateParameter)
+	defer os.Unsetenv(config.DownloadGateParameterEnvVar)
+
+	engine := &Engine{offline: true}
+	assert.NoError(t, engine.awaitDownloadGate(context.Background()))
+}
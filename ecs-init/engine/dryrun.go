@@ -0,0 +1,525 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/blueprint"
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsexec"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/apparmor"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/netns"
+	"github.com/aws/amazon-ecs-init/ecs-init/gpu"
+	"github.com/aws/amazon-ecs-init/ecs-init/history"
+	"github.com/aws/amazon-ecs-init/ecs-init/ssmclient"
+
+	log "github.com/cihub/seelog"
+)
+
+// redactedEnvVarMarkers are the parts of the names of the agent config
+// variables whose values are not logged by a dry run
+var redactedEnvVarMarkers = []string{"AUTH", "SECRET", "PASSWORD", "TOKEN"}
+
+// DryRun makes the engine log the actions it would take instead of taking
+// them: the directories and files it would write, the URLs it would fetch
+// from, the calls it would make to Docker and AWS and the container the Agent
+// would be started in. Checks that only read the state of the host and the
+// configuration are still made, so that a dry run validates the
+// configuration. The Agent is not started, so that start returns as if it
+// exited successfully.
+func (e *Engine) DryRun() {
+	log.Info("Dry run: actions are logged instead of taken")
+	e.dryRun = true
+	e.downloader = &dryRunDownloader{downloader: e.downloader}
+	e.docker = &dryRunDocker{dockerClient: e.docker}
+	e.loopbackRouting = &dryRunLoopbackRouting{loopbackRouting: e.loopbackRouting}
+	e.credentialsProxyRoute = &dryRunCredentialsProxyRoute{credentialsProxyRoute: e.credentialsProxyRoute}
+	e.nvidiaGPUManager = &dryRunGPUManager{GPUManager: e.nvidiaGPUManager}
+	e.hostReservation = &dryRunHostReservation{}
+	e.sysctlProfile = &dryRunSysctlProfile{}
+	e.efsUtils = &dryRunEFSUtils{efsUtils: e.efsUtils}
+	e.volumePlugin = &dryRunVolumePlugin{}
+	e.ebsTaskAttach = &dryRunEBSTaskAttach{}
+	e.appArmorProfile = &dryRunAppArmorProfile{}
+	e.execPrerequisites = &dryRunExecPrerequisites{}
+	if e.introspectionSocket != nil {
+		e.introspectionSocket = &dryRunIntrospectionSocket{}
+	}
+	e.hostNetwork = &dryRunHostNetwork{hostNetwork: e.hostNetwork}
+	if e.agentEgress != nil {
+		e.agentEgress = &dryRunAgentEgressPolicy{}
+	}
+	if e.hooks != nil {
+		e.hooks = &dryRunHookRunner{}
+	}
+	if e.taskMetadataProbe != nil {
+		e.taskMetadataProbe = &dryRunTaskMetadataProbe{}
+	}
+	if e.logVolume != nil {
+		e.logVolume = &dryRunLogVolume{logVolume: e.logVolume}
+	}
+	e.dataArchiver = &dryRunDataArchiver{}
+	e.hostBlueprint = &dryRunHostBlueprint{hostBlueprint: e.hostBlueprint}
+	e.dockerDaemon = &dryRunDockerDaemon{dockerDaemon: e.dockerDaemon}
+	if e.nvidiaPersistence != nil {
+		e.nvidiaPersistence = &dryRunPersistenceDaemon{}
+	}
+	e.statusWriter = &dryRunStatusWriter{}
+	e.history = &dryRunHistoryLog{}
+	if e.prestartMarkers != nil {
+		e.prestartMarkers.dryRun = true
+	}
+	// the AWS clients are created on first use, see dryRunAWSClients
+	e.dryRunAWSClients()
+}
+
+// dryRunAWSClients wraps the AWS clients that are already created, and is
+// called again as the clients are created on first use
+func (e *Engine) dryRunAWSClients() {
+	if !e.dryRun {
+		return
+	}
+	if e.ecsAPI != nil {
+		if _, ok := e.ecsAPI.(*dryRunECS); !ok {
+			e.ecsAPI = &dryRunECS{ecsAPI: e.ecsAPI}
+		}
+	}
+	if e.ec2API != nil {
+		e.ec2API = &dryRunEC2{}
+	}
+	if e.autoScaling != nil {
+		if _, ok := e.autoScaling.(*dryRunAutoScaling); !ok {
+			e.autoScaling = &dryRunAutoScaling{autoScalingAPI: e.autoScaling}
+		}
+	}
+	if e.inventory != nil {
+		e.inventory = &dryRunInventory{}
+	}
+}
+
+// dryRunDownloader logs the downloads of the Agent and the writes of the
+// cache state instead of making them
+type dryRunDownloader struct {
+	downloader
+}
+
+func (d *dryRunDownloader) DownloadAgent(ctx context.Context) error {
+	urls, err := d.PublishedAgentURLs()
+	if err != nil {
+		log.Infof("Dry run: would cache agent %s, could not determine its URLs: %v", d.AgentVersion(), err)
+		return nil
+	}
+	log.Infof("Dry run: would create directory %s", config.CacheDirectory())
+	for _, url := range urls {
+		log.Infof("Dry run: would fetch %s", url)
+	}
+	log.Infof("Dry run: would cache agent %s as %s", d.AgentVersion(), config.AgentTarball())
+	return nil
+}
+
+func (d *dryRunDownloader) StreamAgent(ctx context.Context, load func(io.Reader) error) (bool, error) {
+	err := d.DownloadAgent(ctx)
+	if err != nil {
+		return false, err
+	}
+	return true, load(strings.NewReader(""))
+}
+
+func (d *dryRunDownloader) LoadCachedAgent() (io.ReadCloser, error) {
+	log.Infof("Dry run: would read the cached agent from %s", config.AgentTarball())
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (d *dryRunDownloader) RecordCachedAgent() error {
+	log.Infof("Dry run: would record agent %s as cached in %s", d.AgentVersion(), config.CacheState())
+	return nil
+}
+
+func (d *dryRunDownloader) RollbackAgent() (string, error) {
+	log.Info("Dry run: would roll back to the previously cached agent")
+	return "", nil
+}
+
+func (d *dryRunDownloader) CollectGarbage(ctx context.Context) (*cache.GarbageReport, error) {
+	log.Infof("Dry run: would remove unreferenced files from %s", config.CacheDirectory())
+	return &cache.GarbageReport{}, nil
+}
+
+// dryRunDocker logs the calls that change the images and containers in Docker
+// instead of making them. Starting the Agent logs the container it would be
+// started in and returns as if it exited successfully.
+type dryRunDocker struct {
+	dockerClient
+}
+
+func (d *dryRunDocker) LoadImage(ctx context.Context, image io.Reader) error {
+	log.Info("Dry run: would load the Agent image into Docker")
+	return nil
+}
+
+func (d *dryRunDocker) PreloadImage(ctx context.Context, image io.Reader) error {
+	log.Info("Dry run: would preload the Agent image into Docker as the standby image")
+	return nil
+}
+
+func (d *dryRunDocker) PromoteStandbyImage(ctx context.Context) error {
+	log.Info("Dry run: would tag the standby Agent image as the Agent image")
+	return nil
+}
+
+func (d *dryRunDocker) PullImage(ctx context.Context, image string) error {
+	log.Infof("Dry run: would pull image %s", image)
+	return nil
+}
+
+func (d *dryRunDocker) PullAgentImage(ctx context.Context, image string, auth docker.RegistryAuth) error {
+	log.Infof("Dry run: would pull Agent image %s", image)
+	return nil
+}
+
+func (d *dryRunDocker) RemoveExistingAgentContainer(ctx context.Context) error {
+	log.Info("Dry run: would remove the existing Agent container")
+	return nil
+}
+
+func (d *dryRunDocker) StartAgent(ctx context.Context) (int, error) {
+	options := d.AgentContainerOptions()
+	log.Infof("Dry run: would create container %s", options.Name)
+	if options.Config != nil {
+		log.Infof("Dry run:   image: %s", options.Config.Image)
+		for _, env := range redactEnv(options.Config.Env) {
+			log.Infof("Dry run:   env: %s", env)
+		}
+	}
+	if options.HostConfig != nil {
+		log.Infof("Dry run:   network mode: %s", options.HostConfig.NetworkMode)
+		for _, bind := range options.HostConfig.Binds {
+			log.Infof("Dry run:   mount: %s", bind)
+		}
+		for _, device := range options.HostConfig.Devices {
+			log.Infof("Dry run:   device: %s", device.PathOnHost)
+		}
+	}
+	log.Infof("Dry run: would start container %s and wait for it to exit", options.Name)
+	return terminalSuccessAgentExitCode, nil
+}
+
+func (d *dryRunDocker) StopAgent(ctx context.Context) error {
+	log.Info("Dry run: would stop the Agent container")
+	return nil
+}
+
+func (d *dryRunDocker) RemoveContainer(ctx context.Context, id string) error {
+	log.Infof("Dry run: would remove container %s", id)
+	return nil
+}
+
+func (d *dryRunDocker) RemoveImage(ctx context.Context, name string) error {
+	log.Infof("Dry run: would remove image %s", name)
+	return nil
+}
+
+// redactEnv returns the sorted variables of env with the values of the
+// variables that may hold credentials redacted
+func redactEnv(env []string) []string {
+	redacted := make([]string, 0, len(env))
+	for _, variable := range env {
+		name := strings.SplitN(variable, "=", 2)[0]
+		for _, marker := range redactedEnvVarMarkers {
+			if strings.Contains(strings.ToUpper(name), marker) {
+				variable = name + "=<redacted>"
+				break
+			}
+		}
+		redacted = append(redacted, variable)
+	}
+	sort.Strings(redacted)
+	return redacted
+}
+
+type dryRunLoopbackRouting struct {
+	loopbackRouting
+}
+
+func (r *dryRunLoopbackRouting) Enable() error {
+	log.Info("Dry run: would enable routing of the loopback addresses")
+	return nil
+}
+
+func (r *dryRunLoopbackRouting) RestoreDefault() error {
+	log.Info("Dry run: would restore the default routing of the loopback addresses")
+	return nil
+}
+
+type dryRunCredentialsProxyRoute struct {
+	credentialsProxyRoute
+}
+
+func (r *dryRunCredentialsProxyRoute) Create() error {
+	log.Info("Dry run: would create the route of the credentials endpoint to the Agent")
+	return nil
+}
+
+func (r *dryRunCredentialsProxyRoute) Remove() error {
+	log.Info("Dry run: would remove the route of the credentials endpoint to the Agent")
+	return nil
+}
+
+type dryRunAgentEgressPolicy struct {
+	agentEgressPolicy
+}
+
+func (p *dryRunAgentEgressPolicy) Apply(iface string, destinations []string) error {
+	log.Infof("Dry run: would restrict the connections from %s to %s", iface, strings.Join(destinations, ", "))
+	return nil
+}
+
+func (p *dryRunAgentEgressPolicy) Remove(iface string) error {
+	log.Infof("Dry run: would remove the restrictions of the connections from %s", iface)
+	return nil
+}
+
+type dryRunHookRunner struct{}
+
+func (r *dryRunHookRunner) Run(ctx context.Context, stage string) error {
+	log.Infof("Dry run: would run the %s hooks", stage)
+	return nil
+}
+
+type dryRunGPUManager struct {
+	gpu.GPUManager
+}
+
+func (m *dryRunGPUManager) Setup() error {
+	log.Infof("Dry run: would detect the GPUs and save them to %s", gpu.NvidiaGPUInfoFilePath)
+	return nil
+}
+
+type dryRunHostReservation struct{}
+
+func (r *dryRunHostReservation) Reserve(memoryMiB int64) error {
+	log.Infof("Dry run: would reserve %d MiB of memory for the host", memoryMiB)
+	return nil
+}
+
+type dryRunSysctlProfile struct{}
+
+func (p *dryRunSysctlProfile) Apply() error {
+	log.Info("Dry run: would apply the sysctl profile")
+	return nil
+}
+
+type dryRunEFSUtils struct {
+	efsUtils
+}
+
+func (u *dryRunEFSUtils) Install() error {
+	log.Info("Dry run: would install the EFS utilities")
+	return nil
+}
+
+type dryRunVolumePlugin struct{}
+
+func (p *dryRunVolumePlugin) Start() error {
+	log.Info("Dry run: would start the ECS volume plugin")
+	return nil
+}
+
+func (p *dryRunVolumePlugin) Stop() error {
+	log.Info("Dry run: would stop the ECS volume plugin")
+	return nil
+}
+
+func (p *dryRunVolumePlugin) RestartIfUpdated() error {
+	log.Info("Dry run: would restart the ECS volume plugin if it was updated")
+	return nil
+}
+
+type dryRunEBSTaskAttach struct{}
+
+func (a *dryRunEBSTaskAttach) Prepare() error {
+	log.Info("Dry run: would prepare the host for EBS task attach")
+	return nil
+}
+
+type dryRunAppArmorProfile struct{}
+
+func (p *dryRunAppArmorProfile) Load() error {
+	log.Infof("Dry run: would install the AppArmor profile %s in %s and load it", config.DefaultAppArmorProfile, apparmor.ProfileFile)
+	return nil
+}
+
+type dryRunExecPrerequisites struct{}
+
+func (p *dryRunExecPrerequisites) Prepare(ctx context.Context, region, version string, offline bool) error {
+	log.Infof("Dry run: would stage the SSM agent %s binaries for ECS Exec in %s", version, ecsexec.HostDirectory)
+	return nil
+}
+
+type dryRunIntrospectionSocket struct{}
+
+func (s *dryRunIntrospectionSocket) Start() error {
+	log.Infof("Dry run: would serve the introspection API on %s", config.IntrospectionSocket())
+	return nil
+}
+
+func (s *dryRunIntrospectionSocket) Stop() error {
+	log.Infof("Dry run: would stop serving the introspection API on %s", config.IntrospectionSocket())
+	return nil
+}
+
+type dryRunHostNetwork struct {
+	hostNetwork
+}
+
+func (n *dryRunHostNetwork) DeleteNamespace(name string) error {
+	log.Infof("Dry run: would delete network namespace %s", name)
+	return nil
+}
+
+func (n *dryRunHostNetwork) DeleteVeth(name string) error {
+	log.Infof("Dry run: would delete veth %s", name)
+	return nil
+}
+
+func (n *dryRunHostNetwork) DeleteRule(rule netns.Rule) error {
+	log.Infof("Dry run: would delete rule %v", rule)
+	return nil
+}
+
+type dryRunTaskMetadataProbe struct{}
+
+func (p *dryRunTaskMetadataProbe) Probe() (int, error) {
+	log.Info("Dry run: would request the task metadata endpoint from a scratch network namespace")
+	return 0, nil
+}
+
+type dryRunLogVolume struct {
+	logVolume
+}
+
+func (v *dryRunLogVolume) Remove(file string) error {
+	log.Infof("Dry run: would remove rotated log %s", file)
+	return nil
+}
+
+type dryRunDataArchiver struct{}
+
+func (a *dryRunDataArchiver) Create(dir string, file string) error {
+	log.Infof("Dry run: would archive %s to %s", dir, file)
+	return nil
+}
+
+func (a *dryRunDataArchiver) Restore(file string, dir string) error {
+	log.Infof("Dry run: would restore %s from %s", dir, file)
+	return nil
+}
+
+type dryRunHostBlueprint struct {
+	hostBlueprint
+}
+
+func (b *dryRunHostBlueprint) Apply(ctx context.Context, changes []blueprint.Change) error {
+	for _, change := range changes {
+		log.Infof("Dry run: would apply %v", change)
+	}
+	return nil
+}
+
+type dryRunDockerDaemon struct {
+	dockerDaemon
+}
+
+func (d *dryRunDockerDaemon) Restart() error {
+	log.Info("Dry run: would restart the Docker daemon")
+	return nil
+}
+
+type dryRunPersistenceDaemon struct{}
+
+func (d *dryRunPersistenceDaemon) Ensure() error {
+	log.Info("Dry run: would start the NVIDIA persistence daemon if it is not running")
+	return nil
+}
+
+type dryRunStatusWriter struct{}
+
+func (w *dryRunStatusWriter) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	log.Debugf("Dry run: would write %s", filename)
+	return nil
+}
+
+func (w *dryRunStatusWriter) Flush() error {
+	return nil
+}
+
+type dryRunHistoryLog struct{}
+
+func (h *dryRunHistoryLog) Append(event history.Event) error {
+	log.Debugf("Dry run: would record the %s event in the history", event.Kind)
+	return nil
+}
+
+type dryRunECS struct {
+	ecsAPI
+}
+
+func (c *dryRunECS) CreateCluster(input *ecsclient.CreateClusterInput) (*ecsclient.CreateClusterOutput, error) {
+	log.Infof("Dry run: would create cluster %s", input.ClusterName)
+	return &ecsclient.CreateClusterOutput{}, nil
+}
+
+func (c *dryRunECS) TagResource(input *ecsclient.TagResourceInput) (*ecsclient.TagResourceOutput, error) {
+	log.Infof("Dry run: would tag %s with %v", input.ResourceArn, input.Tags)
+	return &ecsclient.TagResourceOutput{}, nil
+}
+
+type dryRunEC2 struct{}
+
+func (c *dryRunEC2) CreateTags(resourceID string, tags map[string]string) error {
+	log.Infof("Dry run: would tag %s with %v", resourceID, tags)
+	return nil
+}
+
+type dryRunAutoScaling struct {
+	autoScalingAPI
+}
+
+func (c *dryRunAutoScaling) SetInstanceProtection(group string, instanceID string, protected bool) error {
+	log.Infof("Dry run: would set the scale in protection of %s in %s to %t", instanceID, group, protected)
+	return nil
+}
+
+func (c *dryRunAutoScaling) CompleteLifecycleAction(group string, hook string, instanceID string, result string) error {
+	log.Infof("Dry run: would complete lifecycle hook %s of %s in %s with %s", hook, instanceID, group, result)
+	return nil
+}
+
+type dryRunInventory struct{}
+
+func (c *dryRunInventory) PutInventory(instanceID string, items ...ssmclient.InventoryItem) error {
+	for _, item := range items {
+		log.Infof("Dry run: would put inventory item %s of %s", item.TypeName, instanceID)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsclient"
+
+	godocker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunStartAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().AgentContainerOptions().Return(godocker.CreateContainerOptions{
+		Name: config.AgentContainerName,
+		Config: &godocker.Config{
+			Image: config.AgentImageName,
+			Env:   []string{"ECS_CLUSTER=default", "ECS_ENGINE_AUTH_DATA={}"},
+		},
+		HostConfig: &godocker.HostConfig{Binds: []string{"/var/log/ecs:/log"}, NetworkMode: "host"},
+	})
+
+	engine := &Engine{docker: mockDocker}
+	engine.DryRun()
+	exitCode, err := engine.docker.StartAgent(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, terminalSuccessAgentExitCode, exitCode)
+	assert.NoError(t, engine.docker.StopAgent(context.Background()))
+	assert.NoError(t, engine.docker.RemoveContainer(context.Background(), "task"))
+}
+
+func TestDryRunDownloadAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().PublishedAgentURLs().Return([]string{"s3://bucket/agent.tar"}, nil).Times(2)
+	mockDownloader.EXPECT().AgentVersion().Return("v1.40.0").AnyTimes()
+
+	engine := &Engine{downloader: mockDownloader}
+	engine.DryRun()
+	assert.NoError(t, engine.downloader.DownloadAgent(context.Background()))
+	loaded, err := engine.downloader.StreamAgent(context.Background(), func(image io.Reader) error {
+		return engine.docker.LoadImage(context.Background(), image)
+	})
+	assert.NoError(t, err)
+	assert.True(t, loaded)
+	assert.NoError(t, engine.downloader.RecordCachedAgent())
+	report, err := engine.downloader.CollectGarbage(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, &cache.GarbageReport{}, report)
+}
+
+func TestDryRunAWSClients(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockECS := NewMockecsAPI(mockCtrl)
+	mockECS.EXPECT().DescribeClusters(gomock.Any()).Return(&ecsclient.DescribeClustersOutput{}, nil)
+	mockAutoScaling := NewMockautoScalingAPI(mockCtrl)
+
+	engine := &Engine{ecsAPI: mockECS}
+	engine.DryRun()
+	_, err := engine.ecsAPI.DescribeClusters(&ecsclient.DescribeClustersInput{Clusters: []string{"default"}})
+	assert.NoError(t, err, "Expect reads to be made")
+	_, err = engine.ecsAPI.CreateCluster(&ecsclient.CreateClusterInput{ClusterName: "default"})
+	assert.NoError(t, err)
+
+	// clients created on first use are wrapped as they are created
+	engine.autoScaling = mockAutoScaling
+	engine.dryRunAWSClients()
+	engine.dryRunAWSClients()
+	assert.Equal(t, &dryRunAutoScaling{autoScalingAPI: mockAutoScaling}, engine.autoScaling)
+	assert.NoError(t, engine.autoScaling.SetInstanceProtection("asg", "i-1234", true))
+}
+
+func TestDryRunStepMarkers(t *testing.T) {
+	dir := t.TempDir()
+	markers := newStepMarkers(filepath.Join(dir, "prestart"))
+
+	engine := &Engine{prestartMarkers: markers}
+	engine.DryRun()
+	markers.mark("load", "fingerprint")
+	_, err := os.Stat(filepath.Join(dir, "prestart"))
+	assert.True(t, os.IsNotExist(err), "Expect no marks to be written")
+}
+
+func TestRedactEnv(t *testing.T) {
+	assert.Equal(t, []string{
+		"ECS_CLUSTER=default",
+		"ECS_ENGINE_AUTH_DATA=<redacted>",
+		"ECS_ENGINE_AUTH_TYPE=<redacted>",
+		"HTTPS_PROXY=http://proxy:3128",
+	}, redactEnv([]string{
+		"HTTPS_PROXY=http://proxy:3128",
+		"ECS_ENGINE_AUTH_TYPE=dockercfg",
+		"ECS_CLUSTER=default",
+		"ECS_ENGINE_AUTH_DATA={\"registry\":{\"auth\":\"secret\"}}",
+	}))
+}
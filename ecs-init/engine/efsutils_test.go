@@ -0,0 +1,86 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrepareEFSUtilsCheckOnlyWarns(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockEFSUtils := NewMockefsUtils(mockCtrl)
+	mockEFSUtils.EXPECT().Check().Return(errors.New("stunnel not found"))
+
+	engine := &Engine{
+		efsUtils: mockEFSUtils,
+	}
+	assert.NoError(t, engine.prepareEFSUtils(efsUtilsCheck))
+}
+
+func TestPrepareEFSUtilsInstall(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockEFSUtils := NewMockefsUtils(mockCtrl)
+	gomock.InOrder(
+		mockEFSUtils.EXPECT().Check().Return(errors.New("mount.efs not found")),
+		mockEFSUtils.EXPECT().Install(),
+		mockEFSUtils.EXPECT().Check(),
+	)
+
+	engine := &Engine{
+		efsUtils: mockEFSUtils,
+	}
+	assert.NoError(t, engine.prepareEFSUtils(efsUtilsInstall))
+}
+
+func TestPrepareEFSUtilsInstallFails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockEFSUtils := NewMockefsUtils(mockCtrl)
+	gomock.InOrder(
+		mockEFSUtils.EXPECT().Check().Return(errors.New("mount.efs not found")),
+		mockEFSUtils.EXPECT().Install().Return(errors.New("no repository")),
+	)
+
+	engine := &Engine{
+		efsUtils: mockEFSUtils,
+	}
+	assert.Error(t, engine.prepareEFSUtils(efsUtilsInstall))
+}
+
+func TestPrepareEFSUtilsAlreadyInstalled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockEFSUtils := NewMockefsUtils(mockCtrl)
+	mockEFSUtils.EXPECT().Check()
+
+	engine := &Engine{
+		efsUtils: mockEFSUtils,
+	}
+	assert.NoError(t, engine.prepareEFSUtils(efsUtilsInstall))
+}
+
+func TestPrepareEFSUtilsUnknownMode(t *testing.T) {
+	engine := &Engine{}
+	assert.Error(t, engine.prepareEFSUtils("true"))
+}
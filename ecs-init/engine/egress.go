@@ -0,0 +1,231 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+// agentEgressRefreshInterval is how often the destinations the Agent may
+// connect to are read again while it is supervised
+const agentEgressRefreshInterval = 5 * time.Minute
+
+// lookupHost resolves the addresses of a host
+var lookupHost = net.LookupHost
+
+// agentEgressRestricted returns if the egress of the Agent is restricted,
+// logging an invalid setting
+func agentEgressRestricted() bool {
+	egress, err := config.AgentEgress()
+	if err != nil {
+		log.Warnf("Applying the %s egress policy to the Agent: %v", egress, err)
+	}
+	return egress == config.AgentEgressRestricted
+}
+
+// applyAgentEgress restricts the connections of the Agent container to the
+// address ranges of the AWS services in its region. The ranges are read again
+// on every pre-start and while the Agent is supervised.
+func (e *Engine) applyAgentEgress(ctx context.Context) error {
+	network, err := config.AgentNetwork()
+	if err != nil || network != config.AgentNetworkBridge {
+		return fmt.Errorf("the egress of the Agent can only be restricted when %s=%s",
+			config.AgentNetworkEnvVar, config.AgentNetworkBridge)
+	}
+	region, err := e.downloader.Region()
+	if err != nil {
+		return err
+	}
+	destinations, err := e.agentEgressDestinations(ctx, region)
+	if err != nil {
+		return err
+	}
+	err = e.agentEgress.Apply(config.AgentBridgeInterface, destinations)
+	if err != nil {
+		return err
+	}
+	e.appliedEgress = destinations
+	log.Infof("Restricted the connections of the Agent to %d destinations", len(destinations))
+	return nil
+}
+
+// startAgentEgressRefresh reads the destinations the Agent may connect to
+// again every agentEgressRefreshInterval while it is supervised, so that the
+// Agent keeps reaching services whose ranges changed since pre-start. The
+// returned function stops the refresh.
+func (e *Engine) startAgentEgressRefresh(ctx context.Context) func() {
+	if !agentEgressRestricted() || e.agentEgress == nil || e.offline {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := e.clk().NewTicker(agentEgressRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				e.refreshAgentEgress(ctx)
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// refreshAgentEgress restricts the connections of the Agent to the
+// destinations read now when they changed. The restrictions are kept as they
+// are when the destinations cannot be read. The Agent is stopped, and not
+// restarted, when the restrictions cannot be updated.
+func (e *Engine) refreshAgentEgress(ctx context.Context) {
+	region, err := e.downloader.Region()
+	if err != nil {
+		log.Warnf("Keeping the egress restrictions of the Agent: %v", err)
+		return
+	}
+	destinations, err := e.agentEgressDestinations(ctx, region)
+	if err != nil {
+		log.Warnf("Keeping the egress restrictions of the Agent: %v", err)
+		return
+	}
+	if sameDestinations(e.appliedEgress, destinations) {
+		return
+	}
+	err = e.agentEgress.Apply(config.AgentBridgeInterface, destinations)
+	if err != nil {
+		log.Errorf("Stopping the Agent, its egress restrictions could not be updated: %v", err)
+		e.agentEgressErr = err
+		atomic.StoreInt32(&e.agentEgressFailed, 1)
+		err = e.docker.StopAgent(ctx)
+		if err != nil {
+			log.Warnf("Could not stop the Agent: %v", err)
+		}
+		return
+	}
+	e.appliedEgress = destinations
+	log.Infof("Restricted the connections of the Agent to %d destinations", len(destinations))
+}
+
+// takeAgentEgressFailure returns once why the egress restrictions of the
+// Agent could not be updated, if they could not
+func (e *Engine) takeAgentEgressFailure() error {
+	if !atomic.CompareAndSwapInt32(&e.agentEgressFailed, 1, 0) {
+		return nil
+	}
+	return e.agentEgressErr
+}
+
+// sameDestinations returns if a and b hold the same destinations, in any
+// order
+func sameDestinations(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// removeAgentEgress removes the restrictions of the connections of the Agent
+// container, if any
+func (e *Engine) removeAgentEgress() {
+	if e.agentEgress == nil {
+		return
+	}
+	err := e.agentEgress.Remove(config.AgentBridgeInterface)
+	if err != nil {
+		log.Debugf("No egress restrictions of the Agent to remove: %v", err)
+		return
+	}
+	log.Info("Removed the egress restrictions of the Agent")
+}
+
+// agentEgressDestinations returns the IPv4 addresses and CIDR blocks the
+// Agent may connect to in region: the destinations allowed by the
+// configuration, and the address ranges AWS publishes for its services in
+// region, as the endpoints of ECS, ECR, S3 and CloudWatch rotate through
+// large pools of addresses that one lookup of their names does not cover
+func (e *Engine) agentEgressDestinations(ctx context.Context, region string) ([]string, error) {
+	seen := make(map[string]bool)
+	var destinations []string
+	add := func(destination string) {
+		if !seen[destination] {
+			seen[destination] = true
+			destinations = append(destinations, destination)
+		}
+	}
+	for _, destination := range config.AgentEgressAllow() {
+		if _, _, err := net.ParseCIDR(destination); err == nil || net.ParseIP(destination) != nil {
+			add(destination)
+			continue
+		}
+		addresses, err := lookupIPv4(destination)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			add(address)
+		}
+	}
+	prefixes, err := e.ipRanges.ServicePrefixes(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	for _, prefix := range prefixes {
+		add(prefix)
+	}
+	return destinations, nil
+}
+
+// lookupIPv4 returns the IPv4 addresses of host, which are those the rules of
+// the egress policy filter
+func lookupIPv4(host string) ([]string, error) {
+	addresses, err := lookupHost(host)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s: %w", host, err)
+	}
+	var ipv4 []string
+	for _, address := range addresses {
+		if ip := net.ParseIP(address); ip != nil && ip.To4() != nil {
+			ipv4 = append(ipv4, address)
+		}
+	}
+	if len(ipv4) == 0 {
+		return nil, fmt.Errorf("%s has no IPv4 address", host)
+	}
+	return ipv4, nil
+}
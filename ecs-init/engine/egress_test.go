@@ -0,0 +1,257 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/ipranges"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubLookupHost resolves the hosts of addresses, and no other host
+func stubLookupHost(t *testing.T, addresses map[string][]string) {
+	previous := lookupHost
+	lookupHost = func(host string) ([]string, error) {
+		if resolved, ok := addresses[host]; ok {
+			return resolved, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	t.Cleanup(func() { lookupHost = previous })
+}
+
+// serveIPRanges serves prefixes as the address ranges of the AWS services in
+// us-west-2, and the ranges of EC2 instances
+func serveIPRanges(t *testing.T, prefixes *[]string) *ipranges.Source {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries := []string{
+			`{"ip_prefix": "54.68.0.0/14", "region": "us-west-2", "service": "AMAZON"}`,
+			`{"ip_prefix": "54.68.0.0/14", "region": "us-west-2", "service": "EC2"}`,
+		}
+		for _, prefix := range *prefixes {
+			entries = append(entries, fmt.Sprintf(`{"ip_prefix": %q, "region": "us-west-2", "service": "AMAZON"}`, prefix))
+		}
+		fmt.Fprintf(w, `{"prefixes": [%s]}`, strings.Join(entries, ","))
+	}))
+	t.Cleanup(server.Close)
+	return ipranges.NewSource(server.URL)
+}
+
+func TestAgentEgressDestinations(t *testing.T) {
+	stubLookupHost(t, map[string][]string{
+		"ssm.us-west-2.amazonaws.com": {"52.94.0.6", "2600:1f14::1"},
+	})
+	os.Setenv(config.AgentEgressAllowEnvVar, "10.0.0.0/16,ssm.us-west-2.amazonaws.com,192.0.2.1")
+	defer os.Unsetenv(config.AgentEgressAllowEnvVar)
+	engine := &Engine{ipRanges: serveIPRanges(t, &[]string{"52.94.0.0/22", "52.218.128.0/17"})}
+
+	destinations, err := engine.agentEgressDestinations(context.Background(), "us-west-2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"10.0.0.0/16", "52.94.0.6", "192.0.2.1",
+		"52.218.128.0/17", "52.94.0.0/22",
+	}, destinations)
+}
+
+func TestAgentEgressDestinationsUnresolved(t *testing.T) {
+	stubLookupHost(t, map[string][]string{})
+	os.Setenv(config.AgentEgressAllowEnvVar, "ssm.us-west-2.amazonaws.com")
+	defer os.Unsetenv(config.AgentEgressAllowEnvVar)
+	engine := &Engine{ipRanges: serveIPRanges(t, &[]string{"52.94.0.0/22"})}
+
+	_, err := engine.agentEgressDestinations(context.Background(), "us-west-2")
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "ssm.us-west-2.amazonaws.com"))
+}
+
+func TestAgentEgressDestinationsNoRanges(t *testing.T) {
+	engine := &Engine{ipRanges: serveIPRanges(t, &[]string{"52.94.0.0/22"})}
+
+	_, err := engine.agentEgressDestinations(context.Background(), "eu-west-3")
+	assert.Error(t, err)
+}
+
+func TestApplyAgentEgressRequiresBridge(t *testing.T) {
+	engine := &Engine{}
+	assert.Error(t, engine.applyAgentEgress(context.Background()))
+}
+
+func TestApplyAgentEgress(t *testing.T) {
+	os.Setenv(config.AgentNetworkEnvVar, config.AgentNetworkBridge)
+	defer os.Unsetenv(config.AgentNetworkEnvVar)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil)
+	mockEgress := NewMockagentEgressPolicy(mockCtrl)
+	mockEgress.EXPECT().Apply(config.AgentBridgeInterface, []string{"52.94.0.0/22"}).Return(nil)
+
+	engine := &Engine{
+		downloader:  mockDownloader,
+		agentEgress: mockEgress,
+		ipRanges:    serveIPRanges(t, &[]string{"52.94.0.0/22"}),
+	}
+	assert.NoError(t, engine.applyAgentEgress(context.Background()))
+}
+
+func TestRefreshAgentEgress(t *testing.T) {
+	prefixes := []string{"52.94.0.0/22"}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil).Times(3)
+	mockEgress := NewMockagentEgressPolicy(mockCtrl)
+	mockEgress.EXPECT().Apply(config.AgentBridgeInterface, []string{"52.218.128.0/17", "52.94.0.0/22"}).Return(nil)
+
+	engine := &Engine{
+		downloader:    mockDownloader,
+		agentEgress:   mockEgress,
+		ipRanges:      serveIPRanges(t, &prefixes),
+		appliedEgress: []string{"52.94.0.0/22"},
+	}
+	// the ranges did not change
+	engine.refreshAgentEgress(context.Background())
+	prefixes = append(prefixes, "52.218.128.0/17")
+	engine.refreshAgentEgress(context.Background())
+	assert.Equal(t, []string{"52.218.128.0/17", "52.94.0.0/22"}, engine.appliedEgress)
+	// the ranges cannot be read, the restrictions are kept
+	prefixes = nil
+	engine.refreshAgentEgress(context.Background())
+	assert.Equal(t, []string{"52.218.128.0/17", "52.94.0.0/22"}, engine.appliedEgress)
+}
+
+func TestRefreshAgentEgressFailureStopsAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil)
+	mockEgress := NewMockagentEgressPolicy(mockCtrl)
+	mockEgress.EXPECT().Apply(config.AgentBridgeInterface, []string{"52.94.0.0/22"}).Return(errors.New("iptables-restore failed"))
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().StopAgent(gomock.Any()).Return(nil)
+
+	engine := &Engine{
+		downloader:    mockDownloader,
+		agentEgress:   mockEgress,
+		docker:        mockDocker,
+		ipRanges:      serveIPRanges(t, &[]string{"52.94.0.0/22"}),
+		appliedEgress: []string{"52.94.4.0/24"},
+	}
+	engine.refreshAgentEgress(context.Background())
+	assert.Equal(t, []string{"52.94.4.0/24"}, engine.appliedEgress)
+	err := engine.takeAgentEgressFailure()
+	assert.EqualError(t, err, "iptables-restore failed")
+	assert.NoError(t, engine.takeAgentEgressFailure(), "Expect the failure to be taken once")
+}
+
+func TestStartAgentEgressRefresh(t *testing.T) {
+	os.Setenv(config.AgentEgressEnvVar, config.AgentEgressRestricted)
+	defer os.Unsetenv(config.AgentEgressEnvVar)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	applied := make(chan struct{})
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil)
+	mockEgress := NewMockagentEgressPolicy(mockCtrl)
+	mockEgress.EXPECT().Apply(config.AgentBridgeInterface, []string{"52.94.0.0/22"}).
+		Do(func(string, []string) { close(applied) }).Return(nil)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{
+		downloader:  mockDownloader,
+		agentEgress: mockEgress,
+		ipRanges:    serveIPRanges(t, &[]string{"52.94.0.0/22"}),
+		clock:       fakeClock,
+	}
+	stop := engine.startAgentEgressRefresh(context.Background())
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(agentEgressRefreshInterval)
+	<-applied
+	stop()
+}
+
+func TestPrestartStepsAgentEgress(t *testing.T) {
+	steps := (&Engine{}).prestartSteps(context.Background(), map[string]string{})
+	for _, step := range steps {
+		assert.NotEqual(t, "agent-egress", step.name)
+	}
+
+	os.Setenv(config.AgentEgressEnvVar, config.AgentEgressRestricted)
+	defer os.Unsetenv(config.AgentEgressEnvVar)
+	steps = (&Engine{}).prestartSteps(context.Background(), map[string]string{})
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.name)
+	}
+	assert.Contains(t, names, "agent-egress")
+}
+
+func TestPrestartStepsAgentNetwork(t *testing.T) {
+	findStep := func(envVariables map[string]string) *prestartStep {
+		for _, step := range (&Engine{}).prestartSteps(context.Background(), envVariables) {
+			if step.name == "agent-network" {
+				step := step
+				return &step
+			}
+		}
+		return nil
+	}
+	assert.Nil(t, findStep(map[string]string{}))
+
+	os.Setenv(config.AgentNetworkEnvVar, config.AgentNetworkBridge)
+	defer os.Unsetenv(config.AgentNetworkEnvVar)
+	step := findStep(map[string]string{config.TaskENIEnvVar: "true"})
+	require.NotNil(t, step)
+	assert.Error(t, step.run())
+	step = findStep(map[string]string{config.TaskENIEnvVar: "false"})
+	require.NotNil(t, step)
+	assert.NoError(t, step.run())
+}
+
+func TestPostStopRemovesAgentEgress(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
+	mockLoopbackRouting.EXPECT().RestoreDefault().Return(nil)
+	mockRoute := NewMockcredentialsProxyRoute(mockCtrl)
+	mockRoute.EXPECT().Remove().Return(nil)
+	mockEgress := NewMockagentEgressPolicy(mockCtrl)
+	mockEgress.EXPECT().Remove(config.AgentBridgeInterface).Return(errors.New("no chain"))
+
+	engine := &Engine{
+		loopbackRouting:       mockLoopbackRouting,
+		credentialsProxyRoute: mockRoute,
+		agentEgress:           mockEgress,
+	}
+	assert.NoError(t, engine.PostStop(context.Background()))
+}
@@ -14,20 +14,50 @@
 package engine
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/aws/amazon-ecs-init/ecs-init/asyncwriter"
 	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
+	"github.com/aws/amazon-ecs-init/ecs-init/backup"
+	"github.com/aws/amazon-ecs-init/ecs-init/blueprint"
 	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
 	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/connectivity"
+	"github.com/aws/amazon-ecs-init/ecs-init/containerd"
 	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsexec"
 	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/apparmor"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/dockerd"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/ebs"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/efsutils"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/egress"
 	"github.com/aws/amazon-ecs-init/ecs-init/exec/iptables"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/netns"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/persistenced"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/reservation"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/startgate"
 	"github.com/aws/amazon-ecs-init/ecs-init/exec/sysctl"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/taskmetadata"
+	"github.com/aws/amazon-ecs-init/ecs-init/filewatch"
 	"github.com/aws/amazon-ecs-init/ecs-init/gpu"
+	"github.com/aws/amazon-ecs-init/ecs-init/history"
+	"github.com/aws/amazon-ecs-init/ecs-init/hooks"
+	"github.com/aws/amazon-ecs-init/ecs-init/introspection"
+	"github.com/aws/amazon-ecs-init/ecs-init/ipranges"
+	"github.com/aws/amazon-ecs-init/ecs-init/logvolume"
+	"github.com/aws/amazon-ecs-init/ecs-init/metrics"
+	"github.com/aws/amazon-ecs-init/ecs-init/ports"
+	"github.com/aws/amazon-ecs-init/ecs-init/sdnotify"
+	"github.com/aws/amazon-ecs-init/ecs-init/volumeplugin"
 
 	log "github.com/cihub/seelog"
 )
@@ -43,6 +73,9 @@ const (
 	serviceStartRetryMultiplier   = 2.0
 	serviceStartMaxRetries        = math.MaxInt64 // essentially retry forever
 	failedContainerLogWindowSize  = "200"         // as string for log config
+	agentCrashLoopStarts          = 5             // starts that fail before the Agent is healthy to roll it back
+	efsUtilsCheck                 = "check"
+	efsUtilsInstall               = "install"
 )
 
 // Engine contains methods invoked when ecs-init is run
@@ -51,200 +84,685 @@ type Engine struct {
 	docker                dockerClient
 	loopbackRouting       loopbackRouting
 	credentialsProxyRoute credentialsProxyRoute
+	agentEgress           agentEgressPolicy
+	ipRanges              *ipranges.Source
+	hooks                 hookRunner
 	nvidiaGPUManager      gpu.GPUManager
+	nvidiaPersistence     persistenceDaemon
+	hostReservation       hostReservation
+	sysctlProfile         sysctlProfile
+	efsUtils              efsUtils
+	startGate             startGate
+	volumePlugin          volumePlugin
+	ebsTaskAttach         ebsTaskAttach
+	appArmorProfile       appArmorProfile
+	execPrerequisites     execPrerequisites
+	portChecker           portChecker
+	ecsAPI                ecsAPI
+	ec2API                ec2API
+	parameterStore        parameterStore
+	inventory             inventoryAPI
+	registryAuthorizer    registryAuthorizer
+	autoScaling           autoScalingAPI
+	agentMetadata         agentMetadata
+	taskMetadataProbe     taskMetadataProbe
+	introspectionSocket   introspectionSocket
+	metricsServer         metricsServer
+	logVolume             logVolume
+	prober                endpointProber
+	hostNetwork           hostNetwork
+	dataArchiver          dataArchiver
+	hostBlueprint         hostBlueprint
+	dockerDaemon          dockerDaemon
+	configWatcher         fileWatcher
+	statusWriter          statusWriter
+	history               historyLog
+	notifier              serviceNotifier
+	state                 stateMachine
+	// standbyImage is the Agent image file preloaded into Docker ahead
+	// of an upgrade
+	standbyImage string
+	// upgradePending is set while an upgrade requested by the Agent
+	// outside of the maintenance windows waits for the next window
+	upgradePending bool
+	// upgradeDue is set atomically once the Agent is stopped to apply the
+	// pending upgrade
+	upgradeDue int32
+	// autoUpdateDue is set atomically once the Agent is stopped to update it
+	// to the Agent downloaded by the auto update checks
+	autoUpdateDue int32
+	// healthRestartDue is set atomically once the Agent is stopped for
+	// failing its health checks
+	healthRestartDue int32
+	// scaleInProtection is the protection from scale in set while the
+	// Agent is upgraded, until the upgraded Agent is healthy
+	scaleInProtection scaleInProtection
+	// stableAgentVersion is the version of the Agent replaced by the canary
+	// Agent, set while the canary Agent runs
+	stableAgentVersion string
+	// launchHookCompleted is set once the launch lifecycle hook of the
+	// instance no longer holds it
+	launchHookCompleted bool
+	// agentConfig is the agent config the running Agent was started with,
+	// set while the agent config file is watched
+	agentConfig *agentConfigWatch
+	// configRestartDue is set atomically once the Agent is stopped to apply
+	// a changed agent config
+	configRestartDue int32
+	// prestartMarkers records the pre-start steps that succeeded while
+	// pre-start has not succeeded as a whole
+	prestartMarkers *stepMarkers
+	// streamingLoad loads the Agent into Docker while it is downloaded
+	streamingLoad bool
+	// appliedEgress are the destinations the egress of the Agent was last
+	// restricted to, see refreshAgentEgress
+	appliedEgress []string
+	// agentEgressFailed is set atomically once the Agent is stopped as its
+	// egress restrictions could not be updated, for agentEgressErr
+	agentEgressFailed int32
+	agentEgressErr    error
+	// supervisedAt is when supervision of the Agent started
+	supervisedAt time.Time
+	// readyOnce records how long the Agent took to become healthy once
+	readyOnce sync.Once
+	// postStart tracks the work started once the Agent is healthy, see
+	// startPostStart
+	postStart sync.WaitGroup
+	// clock tells the time and waits for it to pass, see clk
+	clock clock.Clock
+	// offline keeps pre-start from running steps that need network access
+	offline bool
+	// agentRegistry is the repository the Agent image is pulled from instead
+	// of downloading it from S3, see agentPullSteps
+	agentRegistry string
+	// bootIDFile is the file holding the ID of the current boot, set to
+	// track the boots of the instance, see trackBoot
+	bootIDFile string
+	// dryRun is set once the engine logs the actions it would take instead
+	// of taking them, see DryRun
+	dryRun bool
 }
 
 // New creates an instance of Engine
 func New() (*Engine, error) {
+	return NewWithClock(clock.Real)
+}
+
+// NewWithClock creates an instance of Engine whose timers, tickers and
+// backoffs wait on clock
+func NewWithClock(clock clock.Clock) (*Engine, error) {
+	docker.ApplyProxyConfig()
 	downloader, err := cache.NewDownloader()
 	if err != nil {
 		return nil, err
 	}
-	docker, err := docker.NewClient()
+	cmdExec := exec.NewExec()
+	docker, err := newContainerRuntime(cmdExec)
 	if err != nil {
 		return nil, err
 	}
-	cmdExec := exec.NewExec()
 	loopbackRouting, err := sysctl.NewIpv4RouteLocalNet(cmdExec)
 	if err != nil {
 		return nil, err
 	}
-	credentialsProxyRoute, err := iptables.NewNetfilterRoute(cmdExec)
+	credentialsProxyRoute, err := newCredentialsProxyRoute(cmdExec)
 	if err != nil {
 		return nil, err
 	}
+	agentRegistry, err := config.AgentRegistry()
+	if err != nil {
+		return nil, err
+	}
+	var introspectionSocket introspectionSocket
+	if config.IntrospectionSocket() != "" {
+		introspectionSocket, err = introspection.NewSocketProxy()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var metricsServer metricsServer
+	if address, err := config.MetricsAddress(); err != nil {
+		log.Warnf("Not serving metrics: %v", err)
+	} else if address != "" {
+		metricsServer = metrics.NewServer(address)
+	}
+	hookTimeout, err := config.HookTimeout()
+	if err != nil {
+		log.Warnf("Running the hooks with a timeout of %s: %v", hookTimeout, err)
+	}
 	return &Engine{
 		downloader:            downloader,
 		docker:                docker,
 		loopbackRouting:       loopbackRouting,
 		credentialsProxyRoute: credentialsProxyRoute,
+		agentEgress:           egress.NewPolicy(cmdExec),
+		ipRanges:              ipranges.NewSource(config.IPRangesURL),
+		hooks:                 hooks.NewRunner(config.HooksDirectory(), hookTimeout),
 		nvidiaGPUManager:      gpu.NewNvidiaGPUManager(),
+		nvidiaPersistence:     persistenced.NewDaemon(cmdExec),
+		hostReservation:       reservation.NewReserver(cmdExec),
+		sysctlProfile:         sysctl.NewProfileManager(cmdExec),
+		efsUtils:              efsutils.NewChecker(cmdExec),
+		startGate:             startgate.NewChecker(cmdExec),
+		volumePlugin:          volumeplugin.NewSupervisor(),
+		ebsTaskAttach:         ebs.NewTaskAttach(cmdExec),
+		appArmorProfile:       apparmor.NewProfileLoader(cmdExec),
+		execPrerequisites:     ecsexec.NewStager(),
+		portChecker:           ports.NewChecker(),
+		agentMetadata:         introspection.NewClient(),
+		taskMetadataProbe:     taskmetadata.NewProber(cmdExec),
+		introspectionSocket:   introspectionSocket,
+		metricsServer:         metricsServer,
+		logVolume:             logvolume.New(config.LogDirectory()),
+		prober:                connectivity.NewProber(),
+		hostNetwork:           netns.NewNetwork(cmdExec),
+		dataArchiver:          backup.NewArchiver(),
+		hostBlueprint:         blueprint.NewConverger(cmdExec),
+		dockerDaemon:          dockerd.NewDaemon(cmdExec),
+		configWatcher:         filewatch.NewWatcher(),
+		statusWriter:          asyncwriter.New(),
+		history:               history.NewLog(config.HistoryFile()),
+		notifier:              sdnotify.NewNotifier(),
+		prestartMarkers:       newStepMarkers(config.PrestartMarkerDirectory()),
+		streamingLoad:         config.StreamingLoad(),
+		clock:                 clock,
+		offline:               config.Offline(),
+		agentRegistry:         agentRegistry,
+		bootIDFile:            config.BootIDFile(),
 	}, nil
 }
 
-// PreStart prepares the ECS Agent for starting. It also configures the instance
-// to handle credentials requests from containers by rerouting these requests to
-// to the ECS Agent's credentials endpoint
-func (e *Engine) PreStart() error {
-	envVariables := e.docker.LoadEnvVars()
-	if val, ok := envVariables[config.GPUSupportEnvVar]; ok {
-		if val == "true" {
-			err := e.nvidiaGPUManager.Setup()
-			if err != nil {
-				log.Errorf("Nvidia GPU Manager: %v", err)
-				return engineError("Nvidia GPU Manager", err)
-			}
-		}
-	}
-	// Enable use of loopback addresses for local routing purposes
-	err := e.loopbackRouting.Enable()
+// newContainerRuntime returns the client of the container runtime the Agent
+// runs in, which is Docker unless containerd is configured
+func newContainerRuntime(cmdExec exec.Exec) (dockerClient, error) {
+	runtime, err := config.ContainerRuntime()
 	if err != nil {
-		return engineError("could not enable loopback routing", err)
+		return nil, err
 	}
-	// Add the rerouting netfilter rule for credentials endpoint
-	err = e.credentialsProxyRoute.Create()
+	if runtime == config.ContainerRuntimeContainerd {
+		log.Info("Running the Agent with containerd")
+		client, err := containerd.NewClient(cmdExec)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+	client, err := docker.NewClient()
 	if err != nil {
-		return engineError("could not create route to the credentials proxy", err)
+		return nil, err
 	}
+	return client, nil
+}
 
-	imageLoaded, err := e.docker.IsAgentImageLoaded()
+// newCredentialsProxyRoute returns the route of the credentials endpoint,
+// made of firewalld direct rules when firewalld manages the netfilter tables,
+// as its reloads would otherwise wipe the rules added with iptables
+func newCredentialsProxyRoute(cmdExec exec.Exec) (credentialsProxyRoute, error) {
+	if iptables.FirewalldRunning(cmdExec) {
+		log.Info("firewalld is running, routing the credentials endpoint with firewalld direct rules")
+		return iptables.NewFirewalldRoute(cmdExec), nil
+	}
+	route, err := iptables.NewNetfilterRoute(cmdExec)
 	if err != nil {
-		return engineError("could not check Docker for Agent image presence", err)
+		return nil, err
 	}
+	return route, nil
+}
 
-	switch e.downloader.AgentCacheStatus() {
-	// Uncached, go get the Agent.
-	case cache.StatusUncached:
-		return e.downloadAndLoadCache()
-
-	// The Agent is cached, and mandates a reload regardless of the
-	// already loaded image.
-	case cache.StatusReloadNeeded:
-		return e.load(e.downloader.LoadCachedAgent())
-
-	// Agent is cached, respect the already loaded Agent.
-	case cache.StatusCached:
-		if imageLoaded {
-			return nil
-		}
-		return e.load(e.downloader.LoadCachedAgent())
+// clk returns the clock of the engine, which is the real clock unless the
+// engine was created with another one
+func (e *Engine) clk() clock.Clock {
+	return clock.OrReal(e.clock)
+}
 
-	// There shouldn't be unhandled cache states.
-	default:
-		return errors.New("could not handle cache state")
+// PreStart prepares the ECS Agent for starting. It also configures the instance
+// to handle credentials requests from containers by rerouting these requests to
+// to the ECS Agent's credentials endpoint. The preparation is run as a graph of
+// steps, see prestartSteps. Pre-start stops between steps once ctx is done or
+// the bootstrap deadline passes.
+func (e *Engine) PreStart(ctx context.Context) error {
+	ctx, cancel := e.withBootstrapDeadline(ctx)
+	defer cancel()
+	// the blueprint writes the config files read by the following steps
+	err := e.convergeBlueprint(ctx, false)
+	if err != nil {
+		return engineError("could not apply the host blueprint", err)
+	}
+	err = e.waitForContainerRuntime(ctx)
+	if err != nil {
+		return bootstrapError(ctx, err)
+	}
+	envVariables := e.docker.LoadEnvVars()
+	err = e.runPrestartSteps(ctx, e.prestartSteps(ctx, envVariables), configFingerprint(envVariables))
+	if err != nil {
+		return bootstrapError(ctx, err)
+	}
+	err = e.runHooks(ctx, hooks.PreStart)
+	if err != nil {
+		return engineError("pre-start hook failed", err)
 	}
+	e.recordEvent(history.KindPrestart, "")
+	return nil
 }
 
-// ReloadCache reloads the cached image of the ECS Agent into Docker
-func (e *Engine) ReloadCache() error {
+// ReloadCache reloads the cached image of the ECS Agent into Docker, or pulls it
+// again when it comes from a registry
+func (e *Engine) ReloadCache(ctx context.Context) error {
+	e.pinAgentVersion(e.docker.LoadEnvVars())
+	if e.agentRegistry != "" {
+		return e.pullAgent(ctx)
+	}
 	cached := e.downloader.IsAgentCached()
 	if !cached {
-		return e.downloadAndLoadCache()
+		return e.downloadAndLoadCache(ctx)
 	}
-	return e.load(e.downloader.LoadCachedAgent())
+	return e.load(ctx, e.downloader.LoadCachedAgent)
 }
 
-func (e *Engine) downloadAndLoadCache() error {
-	err := e.downloadAgent()
+// pinAgentVersion pins the agent version set in the agent config file, which
+// takes precedence over the version set in the environment
+func (e *Engine) pinAgentVersion(envVariables map[string]string) {
+	if version, ok := envVariables[config.AgentVersionEnvVar]; ok {
+		e.downloader.PinAgentVersion(version)
+	}
+}
+
+func (e *Engine) downloadAndLoadCache(ctx context.Context) error {
+	err := e.downloadAgent(ctx)
 	if err != nil {
 		return err
 	}
 
 	log.Info("Loading Amazon Elastic Container Service Agent into Docker")
-	return e.load(e.downloader.LoadCachedAgent())
+	err = e.load(ctx, e.downloader.LoadCachedAgent)
+	if err != nil {
+		return e.rollbackAgent(ctx, err)
+	}
+	return nil
 }
 
-func (e *Engine) downloadAgent() error {
+// newServiceStartBackoff returns the backoff between restarts of the failed
+// Agent
+func newServiceStartBackoff() backoff.Backoff {
+	return backoff.NewBackoff(serviceStartMinRetryTime, serviceStartMaxRetryTime,
+		serviceStartRetryJitter, serviceStartRetryMultiplier, serviceStartMaxRetries)
+}
+
+// crashLoopDetector tracks the Agent failing before it becomes healthy. The
+// cached Agent is rolled back once when it keeps failing that way.
+type crashLoopDetector struct {
+	crashes    int
+	rolledBack bool
+}
+
+// failed records a failure of the Agent and returns true when the Agent has
+// to be rolled back
+func (c *crashLoopDetector) failed(beforeHealthy bool) bool {
+	if !beforeHealthy {
+		c.crashes = 0
+		return false
+	}
+	c.crashes++
+	if c.crashes < agentCrashLoopStarts || c.rolledBack {
+		return false
+	}
+	c.crashes = 0
+	c.rolledBack = true
+	return true
+}
+
+// rollbackAgent loads the previously cached Agent after the cached Agent
+// failed with cause. cause is returned if there is no Agent to roll back to.
+func (e *Engine) rollbackAgent(ctx context.Context, cause error) error {
+	version, err := e.downloader.RollbackAgent()
+	if err != nil {
+		log.Warnf("Could not roll back the Agent: %v", err)
+		return cause
+	}
+	log.Warnf("Rolling back the Agent to %s: %v", version, cause)
+	return e.load(ctx, e.downloader.LoadCachedAgent)
+}
+
+func (e *Engine) downloadAgent(ctx context.Context) error {
+	e.transition(StateDownloading)
+	err := e.awaitDownloadSlot(ctx)
+	if err != nil {
+		return engineError("could not download Amazon Elastic Container Service Agent", err)
+	}
 	log.Info("Downloading Amazon Elastic Container Service Agent")
-	err := e.downloader.DownloadAgent()
+	e.recordMilestone(milestoneDownloadStarted)
+	err = e.downloader.DownloadAgent(ctx)
 	if err != nil {
 		return engineError("could not download Amazon Elastic Container Service Agent", err)
 	}
+	e.recordMilestone(milestoneDownloaded)
 	return nil
 }
 
-func (e *Engine) load(image io.ReadCloser, err error) error {
+// streamAgent downloads the Agent while loading it into Docker, and returns
+// whether it was loaded
+func (e *Engine) streamAgent(ctx context.Context) (bool, error) {
+	e.transition(StateDownloading)
+	err := e.awaitDownloadSlot(ctx)
+	if err != nil {
+		return false, engineError("could not download Amazon Elastic Container Service Agent", err)
+	}
+	log.Info("Downloading Amazon Elastic Container Service Agent and loading it into Docker")
+	e.recordMilestone(milestoneDownloadStarted)
+	loaded, err := e.downloader.StreamAgent(ctx, func(image io.Reader) error {
+		return e.docker.LoadImage(ctx, image)
+	})
+	if err != nil {
+		return false, engineError("could not download Amazon Elastic Container Service Agent", err)
+	}
+	e.recordMilestone(milestoneDownloaded)
+	if loaded {
+		e.recordMilestone(milestoneImageLoaded)
+	}
+	return loaded, nil
+}
+
+// load loads the agent image opened by open into Docker
+func (e *Engine) load(ctx context.Context, open func() (io.ReadCloser, error)) error {
+	e.transition(StateLoading)
+	image, err := open()
 	if err != nil {
 		return engineError("could not load Amazon Elastic Container Service Agent from cache", err)
 	}
 	defer image.Close()
-	err = e.docker.LoadImage(image)
+	err = e.docker.LoadImage(ctx, image)
 	if err != nil {
 		return engineError("could not load Amazon Elastic Container Service Agent into Docker", err)
 	}
+	e.recordMilestone(milestoneImageLoaded)
 	return e.downloader.RecordCachedAgent()
 }
 
-// StartSupervised starts the ECS Agent and ensures it stays running, except for terminal errors (indicated by an agent exit code of 5)
-func (e *Engine) StartSupervised() error {
+// StartSupervised starts the ECS Agent and ensures it stays running, except for terminal errors (indicated by an agent exit code of 5).
+// Supervision stops with the error of ctx once ctx is done, leaving the Agent container to be stopped by PreStop.
+func (e *Engine) StartSupervised(ctx context.Context) error {
 	agentExitCode := -1
-	retryBackoff := backoff.NewBackoff(serviceStartMinRetryTime, serviceStartMaxRetryTime,
-		serviceStartRetryJitter, serviceStartRetryMultiplier, serviceStartMaxRetries)
+	retryBackoff := newServiceStartBackoff()
+	maxRestarts, err := config.AgentMaxRestarts()
+	if err != nil {
+		log.Warnf("Restarting the Agent indefinitely: %v", err)
+	}
+	restarts := 0
+	started := false
+	err = e.waitForContainerRuntime(ctx)
+	if err != nil {
+		return err
+	}
+	e.supervisedAt = e.clk().Now()
+	e.resumeCanary()
+	defer e.notify(sdnotify.Stopping)
+	defer e.postStart.Wait()
+	stopWatchdog := e.startWatchdog()
+	defer stopWatchdog()
+	stopMemoryReport := startMemoryReport(e.clk())
+	defer stopMemoryReport()
+	stopVolumePlugin := e.startVolumePlugin()
+	defer stopVolumePlugin()
+	stopIntrospectionSocket := e.startIntrospectionSocket()
+	defer stopIntrospectionSocket()
+	stopMetrics := e.startMetrics()
+	defer stopMetrics()
+	stopDockerdSupervision := e.startDockerdSupervision(ctx)
+	defer stopDockerdSupervision()
+	stopLogSupervision := e.startLogSupervision(ctx)
+	defer stopLogSupervision()
+	stopConfigWatch := e.startConfigWatch(ctx)
+	defer stopConfigWatch()
+	stopInventoryReport := e.startInventoryReport()
+	defer stopInventoryReport()
+	stopAgentEgressRefresh := e.startAgentEgressRefresh(ctx)
+	defer stopAgentEgressRefresh()
+	defer e.releaseScaleInProtection()
+	var crashLoop crashLoopDetector
 	for {
-		err := e.docker.RemoveExistingAgentContainer()
+		if ctx.Err() != nil {
+			e.transition(StateStopping)
+			return ctx.Err()
+		}
+		if egressErr := e.takeAgentEgressFailure(); egressErr != nil {
+			e.transition(StateStopping)
+			return engineError("could not restrict the egress of the Agent", egressErr)
+		}
+		err := e.docker.RemoveExistingAgentContainer(ctx)
 		if err != nil {
 			return engineError("could not remove existing Agent container", err)
 		}
 
 		log.Info("Starting Amazon Elastic Container Service Agent")
-		agentExitCode, err = e.docker.StartAgent()
+		if started {
+			metrics.AgentRestarts.Inc()
+		}
+		started = true
+		e.transition(StateStarting)
+		e.recordAgentConfig()
+		stopStandbyPreload := e.startStandbyPreload(ctx)
+		cancelHealthy := e.markHealthyAfter(ctx)
+		// tagging creates the ECS client shared with the registration check
+		// before the check starts
+		stopRegistrationTagging := e.startRegistrationTagging(ctx)
+		stopRegistrationCheck := e.startRegistrationCheck(ctx)
+		stopTaskMetadataCheck := e.startTaskMetadataCheck(ctx)
+		stopConnectionReport := e.startConnectionReport(ctx)
+		stopDeferredUpgrade := e.startDeferredUpgrade(ctx)
+		stopAutoUpdate := e.startAutoUpdate(ctx)
+		stopHealthCheck := e.startHealthCheck(ctx)
+		startedAt := e.clk().Now()
+		e.recordMilestone(milestoneContainerStart)
+		e.recordAgentEvent(history.KindStart)
+		agentExitCode, err = e.docker.StartAgent(ctx)
+		exitedBeforeHealthy := e.State() != StateHealthy
+		stopHealthCheck()
+		stopAutoUpdate()
+		stopDeferredUpgrade()
+		stopConnectionReport()
+		stopTaskMetadataCheck()
+		stopRegistrationCheck()
+		stopRegistrationTagging()
+		cancelHealthy()
+		stopStandbyPreload()
 		if err != nil {
+			e.transition(StateStopping)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			return engineError("could not start Agent", err)
 		}
 		log.Infof("Agent exited with code %d", agentExitCode)
+		e.recordEvent(history.KindExit, fmt.Sprintf("exit code %d", agentExitCode))
+		if egressErr := e.takeAgentEgressFailure(); egressErr != nil {
+			e.transition(StateStopping)
+			return engineError("could not restrict the egress of the Agent", egressErr)
+		}
+		if e.clk().Since(startedAt) >= agentStableAfter {
+			// an Agent failing after running for long is not crash looping
+			restarts = 0
+			retryBackoff = newServiceStartBackoff()
+		}
+		configRestart := e.takeConfigRestart()
+		if e.takeHealthRestart() {
+			// an Agent stopped for failing its health checks is
+			// restarted as a failed Agent
+			agentExitCode = containerFailureAgentExitCode
+		}
+		if e.takeDueAutoUpdate() {
+			err = e.applyAutoUpdate(ctx)
+			if err != nil {
+				log.Errorf("could not update agent: %v", err)
+			}
+			// the Agent stopped to be updated is restarted right away,
+			// updated or not
+			continue
+		}
+		if e.takeDueUpgrade() {
+			agentExitCode = upgradeAgentExitCode
+		} else if configRestart {
+			// the Agent was stopped to apply the changed agent config
+			continue
+		}
 
 		switch agentExitCode {
 		case upgradeAgentExitCode:
-			err = e.upgradeAgent()
+			e.transition(StateUpgrading)
+			if e.deferUpgrade() {
+				continue
+			}
+			if !e.protectUpgradeFromScaleIn() {
+				// the instance is leaving its group, keep the current Agent
+				continue
+			}
+			err = e.upgradeAgent(ctx)
 			if err != nil {
 				log.Error("could not upgrade agent", err)
 			} else {
+				e.recordAgentEvent(history.KindUpgrade)
+				e.restartUpdatedVolumePlugin()
 				// continuing here because a successful upgrade doesn't need to backoff retries
 				continue
 			}
 		case containerFailureAgentExitCode:
 			// capture the tail of the failed agent container
 			log.Infof("Captured the last %s lines of the agent container logs====>\n", failedContainerLogWindowSize)
-			log.Info(e.docker.GetContainerLogTail(failedContainerLogWindowSize))
+			log.Info(e.docker.GetContainerLogTail(ctx, failedContainerLogWindowSize))
 			log.Infof("<====end %s lines of the failed agent container logs\n", failedContainerLogWindowSize)
 		case terminalFailureAgentExitCode:
+			e.transition(StateStopping)
 			return errors.New("agent exited with terminal exit code")
 		case terminalSuccessAgentExitCode:
+			e.transition(StateStopping)
 			return nil
 		}
+		e.transition(StateDegraded)
+		restarts++
+		if maxRestarts > 0 && restarts > maxRestarts {
+			e.transition(StateStopping)
+			return fmt.Errorf("agent failed %d times in a row, giving up after %d restarts", restarts, maxRestarts)
+		}
+		if deadline, ok := e.bootstrapDeadline(); ok && !e.clk().Now().Before(deadline) {
+			e.transition(StateStopping)
+			return fmt.Errorf("%w: agent was not healthy by %s", ErrBootstrapDeadline, deadline.Format(time.RFC3339))
+		}
+		if crashLoop.failed(exitedBeforeHealthy) {
+			cause := fmt.Errorf("agent failed %d times in a row before it was healthy", agentCrashLoopStarts)
+			if e.stableAgentVersion != "" {
+				// the stable Agent can still be rolled back
+				crashLoop = crashLoopDetector{}
+				err = e.fallBackFromCanary(ctx, cause)
+			} else {
+				err = e.rollbackAgent(ctx, cause)
+			}
+			if err == nil {
+				continue
+			}
+		}
 		d := retryBackoff.Duration()
 		log.Warnf("ECS Agent failed to start, retrying in %s", d)
-		time.Sleep(d)
+		err = clock.SleepContext(ctx, e.clk(), d)
+		if err != nil {
+			e.transition(StateStopping)
+			return err
+		}
+	}
+}
+
+// checkReservedPorts returns an error naming the processes listening on the
+// host ports reserved for the Agent, which would fail to bind them otherwise
+func (e *Engine) checkReservedPorts(value string) error {
+	reserved, err := ports.ParsePorts(value)
+	if err != nil {
+		return err
+	}
+	conflicts, err := e.portChecker.Check(reserved)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	var messages []string
+	for _, conflict := range conflicts {
+		log.Errorf("Reserved %s", conflict)
+		messages = append(messages, conflict.String())
+	}
+	return errors.New(strings.Join(messages, ", "))
+}
+
+// prepareEFSUtils checks that EFS task volumes can be mounted. Missing
+// prerequisites are installed in the "install" mode and only reported in the
+// "check" mode.
+func (e *Engine) prepareEFSUtils(mode string) error {
+	switch mode {
+	case efsUtilsCheck, efsUtilsInstall:
+	default:
+		return fmt.Errorf("unknown mode %q, expected %q or %q", mode, efsUtilsCheck, efsUtilsInstall)
+	}
+	err := e.efsUtils.Check()
+	if err == nil {
+		return nil
+	}
+	if mode == efsUtilsCheck {
+		log.Warnf("EFS task volumes will fail to mount: %v", err)
+		return nil
 	}
+	log.Infof("Installing the EFS mount helper: %v", err)
+	err = e.efsUtils.Install()
+	if err != nil {
+		return err
+	}
+	return e.efsUtils.Check()
 }
 
-func (e *Engine) upgradeAgent() error {
+func (e *Engine) upgradeAgent(ctx context.Context) error {
+	if e.promoteStandbyAgent(ctx) {
+		return nil
+	}
 	log.Info("Loading new desired Amazon Elastic Container Service Agent into Docker")
-	return e.load(e.downloader.LoadDesiredAgent())
+	return e.load(ctx, e.downloader.LoadDesiredAgent)
 }
 
 // PreStop sends commands to Docker to stop the ECS Agent
-func (e *Engine) PreStop() error {
+func (e *Engine) PreStop(ctx context.Context) error {
+	e.transition(StateStopping)
 	log.Info("Stopping Amazon Elastic Container Service Agent")
-	err := e.docker.StopAgent()
+	err := e.docker.StopAgent(ctx)
 	if err != nil {
 		return engineError("could not stop Amazon Elastic Container Service Agent", err)
 	}
+	e.recordEvent(history.KindStop, "")
 	return nil
 }
 
 // PostStop cleans up the credentials endpoint setup by disabling loopback
-// routing and removing the rerouting rule from the netfilter table
-func (e *Engine) PostStop() error {
+// routing and removing the rerouting rule from the netfilter table, and
+// collects the garbage of the cache
+func (e *Engine) PostStop(ctx context.Context) error {
 	log.Info("Cleaning up the credentials endpoint setup for Amazon Elastic Container Service Agent")
 	err := e.loopbackRouting.RestoreDefault()
 
 	// Ignore error from Remove() as the netfilter might never have been
 	// addred in the first place
 	e.credentialsProxyRoute.Remove()
+	e.removeAgentEgress()
+	e.collectCacheGarbage(ctx)
 	return err
 }
 
+// Flush waits for state files written in the background during an action
+// to be persisted
+func (e *Engine) Flush() error {
+	e.recordHostManifest()
+	if e.statusWriter != nil {
+		if err := e.statusWriter.Flush(); err != nil {
+			return err
+		}
+	}
+	return e.downloader.Flush()
+}
+
 type _engineError struct {
 	err     error
 	message string
@@ -254,6 +772,25 @@ func (e _engineError) Error() string {
 	return fmt.Sprintf("%s: %s", e.message, e.err.Error())
 }
 
+// Unwrap returns the underlying error so that callers can check its class
+func (e _engineError) Unwrap() error {
+	return e.err
+}
+
+// waitForContainerRuntime waits for the Docker daemon, or containerd, to
+// respond before it is used, as it may still be starting on first boot
+func (e *Engine) waitForContainerRuntime(ctx context.Context) error {
+	timeout, err := config.DockerReadyTimeout()
+	if err != nil {
+		return engineError("could not wait for the container runtime", err)
+	}
+	err = e.docker.WaitReady(ctx, timeout)
+	if err != nil {
+		return engineError("the container runtime did not respond", err)
+	}
+	return nil
+}
+
 func engineError(message string, err error) _engineError {
 	return _engineError{
 		message: message,
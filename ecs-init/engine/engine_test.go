@@ -15,15 +15,26 @@ package engine
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+	"github.com/aws/amazon-ecs-init/ecs-init/efa"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/apparmor"
 	"github.com/aws/amazon-ecs-init/ecs-init/gpu"
+	"github.com/aws/amazon-ecs-init/ecs-init/neuron"
+	"github.com/aws/amazon-ecs-init/ecs-init/ports"
 	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestPreStartImageAlreadyCachedAndLoaded(t *testing.T) {
@@ -31,11 +42,12 @@ func TestPreStartImageAlreadyCachedAndLoaded(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 	mockDownloader := NewMockdownloader(mockCtrl)
 
 	mockDocker.EXPECT().LoadEnvVars().Return(nil)
 	// Docker reports image is loaded.
-	mockDocker.EXPECT().IsAgentImageLoaded().Return(true, nil)
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(true, nil)
 	// Agent tarball and state is present
 	mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusCached)
 
@@ -50,12 +62,27 @@ func TestPreStartImageAlreadyCachedAndLoaded(t *testing.T) {
 		loopbackRouting:       mockLoopbackRouting,
 		credentialsProxyRoute: mockRoute,
 	}
-	err := engine.PreStart()
+	err := engine.PreStart(context.Background())
 	if err != nil {
 		t.Errorf("engine pre-start error: %v", err)
 	}
 }
 
+func TestPreStartContainerRuntimeUnavailable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), config.DefaultDockerReadyTimeout).
+		Return(fmt.Errorf("%w: connection refused", docker.ErrDockerUnavailable))
+
+	engine := &Engine{
+		docker: mockDocker,
+	}
+	err := engine.PreStart(context.Background())
+	assert.True(t, errors.Is(err, docker.ErrDockerUnavailable))
+}
+
 func TestPreStartReloadNeeded(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -63,15 +90,16 @@ func TestPreStartReloadNeeded(t *testing.T) {
 	cachedAgentBuffer := ioutil.NopCloser(&bytes.Buffer{})
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 	mockDownloader := NewMockdownloader(mockCtrl)
 
 	mockDocker.EXPECT().LoadEnvVars().Return(nil)
 	// Docker reports image is loaded.
-	mockDocker.EXPECT().IsAgentImageLoaded().Return(true, nil)
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(true, nil)
 	// Agent tarball and state is present, but requires a reload off of disk
 	mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusReloadNeeded)
 	mockDownloader.EXPECT().LoadCachedAgent().Return(cachedAgentBuffer, nil)
-	mockDocker.EXPECT().LoadImage(cachedAgentBuffer)
+	mockDocker.EXPECT().LoadImage(gomock.Any(), cachedAgentBuffer)
 	mockDownloader.EXPECT().RecordCachedAgent()
 
 	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
@@ -85,7 +113,7 @@ func TestPreStartReloadNeeded(t *testing.T) {
 		loopbackRouting:       mockLoopbackRouting,
 		credentialsProxyRoute: mockRoute,
 	}
-	err := engine.PreStart()
+	err := engine.PreStart(context.Background())
 	if err != nil {
 		t.Errorf("engine pre-start error: %v", err)
 	}
@@ -98,6 +126,7 @@ func TestPreStartImageNotLoadedCached(t *testing.T) {
 	cachedAgentBuffer := ioutil.NopCloser(&bytes.Buffer{})
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 	mockDownloader := NewMockdownloader(mockCtrl)
 	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
 	mockRoute := NewMockcredentialsProxyRoute(mockCtrl)
@@ -105,10 +134,10 @@ func TestPreStartImageNotLoadedCached(t *testing.T) {
 	mockDocker.EXPECT().LoadEnvVars().Return(nil)
 	mockRoute.EXPECT().Create().Return(nil)
 	mockLoopbackRouting.EXPECT().Enable().Return(nil)
-	mockDocker.EXPECT().IsAgentImageLoaded().Return(false, nil)
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(false, nil)
 	mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusCached)
 	mockDownloader.EXPECT().LoadCachedAgent().Return(cachedAgentBuffer, nil)
-	mockDocker.EXPECT().LoadImage(cachedAgentBuffer)
+	mockDocker.EXPECT().LoadImage(gomock.Any(), cachedAgentBuffer)
 	mockDownloader.EXPECT().RecordCachedAgent()
 
 	engine := &Engine{
@@ -117,7 +146,7 @@ func TestPreStartImageNotLoadedCached(t *testing.T) {
 		loopbackRouting:       mockLoopbackRouting,
 		credentialsProxyRoute: mockRoute,
 	}
-	err := engine.PreStart()
+	err := engine.PreStart(context.Background())
 	if err != nil {
 		t.Errorf("engine pre-start error: %v", err)
 	}
@@ -130,14 +159,17 @@ func TestPreStartImageNotCached(t *testing.T) {
 	cachedAgentBuffer := ioutil.NopCloser(&bytes.Buffer{})
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 	mockDownloader := NewMockdownloader(mockCtrl)
 
 	mockDocker.EXPECT().LoadEnvVars().Return(nil)
-	mockDocker.EXPECT().IsAgentImageLoaded().Return(false, nil)
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(false, nil)
 	mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusUncached)
-	mockDownloader.EXPECT().DownloadAgent()
+	// no agent is cached
+	mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{})
+	mockDownloader.EXPECT().DownloadAgent(gomock.Any())
 	mockDownloader.EXPECT().LoadCachedAgent().Return(cachedAgentBuffer, nil)
-	mockDocker.EXPECT().LoadImage(cachedAgentBuffer)
+	mockDocker.EXPECT().LoadImage(gomock.Any(), cachedAgentBuffer)
 	mockDownloader.EXPECT().RecordCachedAgent()
 
 	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
@@ -151,17 +183,86 @@ func TestPreStartImageNotCached(t *testing.T) {
 		loopbackRouting:       mockLoopbackRouting,
 		credentialsProxyRoute: mockRoute,
 	}
-	err := engine.PreStart()
+	err := engine.PreStart(context.Background())
 	if err != nil {
 		t.Errorf("engine pre-start error: %v", err)
 	}
 }
 
+func TestPreStartImageNotCachedStreamingLoad(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	mockDocker.EXPECT().LoadEnvVars().Return(nil)
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(false, nil)
+	mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusUncached)
+	mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{})
+	mockDownloader.EXPECT().StreamAgent(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, load func(io.Reader) error) (bool, error) {
+		return true, load(&bytes.Buffer{})
+	})
+	mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any())
+	mockDownloader.EXPECT().RecordCachedAgent()
+
+	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
+	mockLoopbackRouting.EXPECT().Enable().Return(nil)
+	mockRoute := NewMockcredentialsProxyRoute(mockCtrl)
+	mockRoute.EXPECT().Create().Return(nil)
+
+	engine := &Engine{
+		docker:                mockDocker,
+		downloader:            mockDownloader,
+		loopbackRouting:       mockLoopbackRouting,
+		credentialsProxyRoute: mockRoute,
+		streamingLoad:         true,
+	}
+	assert.NoError(t, engine.PreStart(context.Background()))
+}
+
+func TestPreStartImageNotCachedStreamingLoadFallback(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cachedAgentBuffer := ioutil.NopCloser(&bytes.Buffer{})
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	mockDocker.EXPECT().LoadEnvVars().Return(nil)
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(false, nil)
+	mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusUncached)
+	mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{})
+	// the tarball could not be loaded while it was downloaded
+	mockDownloader.EXPECT().StreamAgent(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockDownloader.EXPECT().LoadCachedAgent().Return(cachedAgentBuffer, nil)
+	mockDocker.EXPECT().LoadImage(gomock.Any(), cachedAgentBuffer)
+	mockDownloader.EXPECT().RecordCachedAgent()
+
+	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
+	mockLoopbackRouting.EXPECT().Enable().Return(nil)
+	mockRoute := NewMockcredentialsProxyRoute(mockCtrl)
+	mockRoute.EXPECT().Create().Return(nil)
+
+	engine := &Engine{
+		docker:                mockDocker,
+		downloader:            mockDownloader,
+		loopbackRouting:       mockLoopbackRouting,
+		credentialsProxyRoute: mockRoute,
+		streamingLoad:         true,
+	}
+	assert.NoError(t, engine.PreStart(context.Background()))
+}
+
 func TestPreStartGPUSetupSuccessful(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 	mockDownloader := NewMockdownloader(mockCtrl)
 	mockGPUManager := gpu.NewMockGPUManager(mockCtrl)
 
@@ -170,7 +271,7 @@ func TestPreStartGPUSetupSuccessful(t *testing.T) {
 	})
 	mockGPUManager.EXPECT().Setup().Return(nil)
 	// Docker reports image is loaded.
-	mockDocker.EXPECT().IsAgentImageLoaded().Return(true, nil)
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(true, nil)
 	// Agent tarball and state is present
 	mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusCached)
 
@@ -186,93 +287,511 @@ func TestPreStartGPUSetupSuccessful(t *testing.T) {
 		credentialsProxyRoute: mockRoute,
 		nvidiaGPUManager:      mockGPUManager,
 	}
-	err := engine.PreStart()
+	err := engine.PreStart(context.Background())
 	if err != nil {
 		t.Errorf("engine pre-start error: %v", err)
 	}
 }
 
+func TestPreStartPinsAgentVersion(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cachedAgentBuffer := ioutil.NopCloser(&bytes.Buffer{})
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
+		config.AgentVersionEnvVar: "1.76.0",
+	})
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(true, nil)
+	gomock.InOrder(
+		mockDownloader.EXPECT().PinAgentVersion("1.76.0"),
+		// the cached agent is another version
+		mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusUncached),
+		mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{Version: config.DefaultAgentVersion}),
+		mockDownloader.EXPECT().AgentVersion().Return("v1.76.0").AnyTimes(),
+		mockDownloader.EXPECT().DownloadAgent(gomock.Any()),
+		mockDownloader.EXPECT().LoadCachedAgent().Return(cachedAgentBuffer, nil),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), cachedAgentBuffer),
+		mockDownloader.EXPECT().RecordCachedAgent(),
+	)
+
+	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
+	mockLoopbackRouting.EXPECT().Enable().Return(nil)
+	mockRoute := NewMockcredentialsProxyRoute(mockCtrl)
+	mockRoute.EXPECT().Create().Return(nil)
+
+	engine := &Engine{
+		docker:                mockDocker,
+		downloader:            mockDownloader,
+		loopbackRouting:       mockLoopbackRouting,
+		credentialsProxyRoute: mockRoute,
+	}
+	err := engine.PreStart(context.Background())
+	assert.NoError(t, err)
+}
+
 func TestPreStartGPUSetupError(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 	mockGPUManager := gpu.NewMockGPUManager(mockCtrl)
 
 	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
 		"ECS_ENABLE_GPU_SUPPORT": "true",
 	})
-	mockGPUManager.EXPECT().Setup().Return(errors.New("gpu setup failed"))
+	// the setup is retried as the driver can still be loading
+	mockGPUManager.EXPECT().Setup().Return(errors.New("gpu setup failed")).Times(prestartNetworkRetries + 1)
 	engine := &Engine{
 		docker:           mockDocker,
 		nvidiaGPUManager: mockGPUManager,
 	}
-	err := engine.PreStart()
+	err := engine.PreStart(context.Background())
+	if err == nil {
+		t.Error("Expected error to be returned but was nil")
+	}
+}
+
+func TestPreStartGPUStartsPersistenceDaemonFirst(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockGPUManager := gpu.NewMockGPUManager(mockCtrl)
+	mockPersistence := NewMockpersistenceDaemon(mockCtrl)
+
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
+		"ECS_ENABLE_GPU_SUPPORT": "true",
+	})
+	gomock.InOrder(
+		mockPersistence.EXPECT().Ensure().Return(nil),
+		mockGPUManager.EXPECT().Setup().Return(nil),
+	)
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(true, nil)
+	mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusCached)
+
+	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
+	mockLoopbackRouting.EXPECT().Enable().Return(nil)
+	mockRoute := NewMockcredentialsProxyRoute(mockCtrl)
+	mockRoute.EXPECT().Create().Return(nil)
+
+	engine := &Engine{
+		docker:                mockDocker,
+		downloader:            mockDownloader,
+		loopbackRouting:       mockLoopbackRouting,
+		credentialsProxyRoute: mockRoute,
+		nvidiaGPUManager:      mockGPUManager,
+		nvidiaPersistence:     mockPersistence,
+	}
+	err := engine.PreStart(context.Background())
+	if err != nil {
+		t.Errorf("engine pre-start error: %v", err)
+	}
+}
+
+func TestPreStartPersistenceDaemonError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockGPUManager := gpu.NewMockGPUManager(mockCtrl)
+	mockPersistence := NewMockpersistenceDaemon(mockCtrl)
+
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
+		"ECS_ENABLE_GPU_SUPPORT": "true",
+	})
+	mockPersistence.EXPECT().Ensure().Return(errors.New("start failed")).Times(prestartPersistenceRetries + 1)
+	// the GPUs are not set up without the daemon
+	mockGPUManager.EXPECT().Setup().Times(0)
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{
+		docker:            mockDocker,
+		nvidiaGPUManager:  mockGPUManager,
+		nvidiaPersistence: mockPersistence,
+		clock:             fakeClock,
+	}
+	done := make(chan error)
+	go func() {
+		done <- engine.PreStart(context.Background())
+	}()
+	for i := 0; i < prestartPersistenceRetries; i++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(prestartRetryMaxDelay)
+	}
+	err := <-done
 	if err == nil {
 		t.Error("Expected error to be returned but was nil")
 	}
 }
 
+func TestPreStartNeuronDevicesNotFound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	defer func() {
+		neuronDevices = neuron.Devices
+	}()
+	detections := 0
+	neuronDevices = func() ([]string, error) {
+		detections++
+		return nil, neuron.ErrNoDeviceFound
+	}
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
+		"ECS_ENABLE_NEURON_SUPPORT": "true",
+	})
+	engine := &Engine{
+		docker: mockDocker,
+	}
+	err := engine.PreStart(context.Background())
+	assert.Error(t, err)
+	// the detection is retried as the driver can still be loading
+	assert.Equal(t, prestartNetworkRetries+1, detections)
+}
+
+func TestPreStartLoadsAppArmorProfile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	defer func() {
+		appArmorEnabled = apparmor.Enabled
+	}()
+	appArmorEnabled = func() bool {
+		return true
+	}
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{})
+	mockAppArmor := NewMockappArmorProfile(mockCtrl)
+	mockAppArmor.EXPECT().Load().Return(errors.New("apparmor_parser failed"))
+	engine := &Engine{
+		docker:          mockDocker,
+		appArmorProfile: mockAppArmor,
+	}
+	err := engine.PreStart(context.Background())
+	assert.Error(t, err)
+}
+
+func TestPreStartSkipsAppArmorProfileWhenUnconfined(t *testing.T) {
+	defer func() {
+		appArmorEnabled = apparmor.Enabled
+	}()
+	appArmorEnabled = func() bool {
+		return true
+	}
+	os.Setenv(config.AppArmorProfileEnvVar, config.AppArmorProfileUnconfined)
+	defer os.Unsetenv(config.AppArmorProfileEnvVar)
+
+	steps := (&Engine{}).prestartSteps(context.Background(), map[string]string{})
+	for _, step := range steps {
+		assert.NotEqual(t, "apparmor", step.name)
+	}
+}
+
+func TestPreStartEFADevicesNotFound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	defer func() {
+		efaDevices = efa.Devices
+	}()
+	efaDevices = func() ([]string, error) {
+		return nil, efa.ErrNoDeviceFound
+	}
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
+		"ECS_ENABLE_EFA_SUPPORT": "true",
+	})
+	engine := &Engine{
+		docker: mockDocker,
+	}
+	err := engine.PreStart(context.Background())
+	assert.Error(t, err)
+}
+
+func TestPreStartExecPrerequisitesError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockExecPrerequisites := NewMockexecPrerequisites(mockCtrl)
+
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
+		"ECS_INIT_PREPARE_EXEC":           "true",
+		"ECS_INIT_EXEC_SSM_AGENT_VERSION": "3.2.0.0",
+	})
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil).AnyTimes()
+	// the download is retried
+	mockExecPrerequisites.EXPECT().Prepare(gomock.Any(), "us-west-2", "3.2.0.0", false).Return(
+		errors.New("could not download")).Times(prestartNetworkRetries + 1)
+	engine := &Engine{
+		docker:            mockDocker,
+		downloader:        mockDownloader,
+		execPrerequisites: mockExecPrerequisites,
+	}
+	err := engine.PreStart(context.Background())
+	assert.Error(t, err)
+}
+
+func TestPreStartReserveSystemMemory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockReservation := NewMockhostReservation(mockCtrl)
+
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
+		"ECS_INIT_RESERVED_SYSTEM_MEMORY": "512",
+	})
+	mockReservation.EXPECT().Reserve(int64(512)).Return(nil)
+	// Docker reports image is loaded.
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(true, nil)
+	// Agent tarball and state is present
+	mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusCached)
+
+	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
+	mockLoopbackRouting.EXPECT().Enable().Return(nil)
+	mockRoute := NewMockcredentialsProxyRoute(mockCtrl)
+	mockRoute.EXPECT().Create().Return(nil)
+
+	engine := &Engine{
+		docker:                mockDocker,
+		downloader:            mockDownloader,
+		loopbackRouting:       mockLoopbackRouting,
+		credentialsProxyRoute: mockRoute,
+		hostReservation:       mockReservation,
+	}
+	err := engine.PreStart(context.Background())
+	if err != nil {
+		t.Errorf("engine pre-start error: %v", err)
+	}
+}
+
+func TestPreStartReserveSystemMemoryInvalid(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
+		"ECS_INIT_RESERVED_SYSTEM_MEMORY": "half",
+	})
+	engine := &Engine{
+		docker:          mockDocker,
+		hostReservation: NewMockhostReservation(mockCtrl),
+	}
+	err := engine.PreStart(context.Background())
+	if err == nil {
+		t.Error("Expected error to be returned but was nil")
+	}
+}
+
+func TestPreStartReserveSystemMemoryError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockReservation := NewMockhostReservation(mockCtrl)
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
+		"ECS_INIT_RESERVED_SYSTEM_MEMORY": "512",
+	})
+	mockReservation.EXPECT().Reserve(int64(512)).Return(errors.New("no systemctl"))
+	engine := &Engine{
+		docker:          mockDocker,
+		hostReservation: mockReservation,
+	}
+	err := engine.PreStart(context.Background())
+	if err == nil {
+		t.Error("Expected error to be returned but was nil")
+	}
+}
+
+func TestPreStartSysctlProfileError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockSysctlProfile := NewMocksysctlProfile(mockCtrl)
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
+		"ECS_INIT_ENABLE_SYSCTL_PROFILE": "true",
+	})
+	mockSysctlProfile.EXPECT().Apply().Return(errors.New("drift"))
+	engine := &Engine{
+		docker:        mockDocker,
+		sysctlProfile: mockSysctlProfile,
+	}
+	err := engine.PreStart(context.Background())
+	if err == nil {
+		t.Error("Expected error to be returned but was nil")
+	}
+}
+
+func TestPreStartReservedPortsInUse(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockPortChecker := NewMockportChecker(mockCtrl)
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{
+		"ECS_INIT_RESERVED_PORTS": "51678,51679",
+	})
+	mockPortChecker.EXPECT().Check([]uint16{51678, 51679}).Return([]ports.Conflict{
+		{Port: 51678, PID: 42, Command: "nginx"},
+	}, nil)
+	engine := &Engine{
+		docker:      mockDocker,
+		portChecker: mockPortChecker,
+	}
+	err := engine.PreStart(context.Background())
+	if err == nil {
+		t.Fatal("Expected error to be returned but was nil")
+	}
+	assert.Contains(t, err.Error(), "port 51678 is in use by nginx (pid 42)")
+}
+
+func TestCheckReservedPortsFree(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockPortChecker := NewMockportChecker(mockCtrl)
+	mockPortChecker.EXPECT().Check([]uint16{51678}).Return(nil, nil)
+	engine := &Engine{
+		portChecker: mockPortChecker,
+	}
+	assert.NoError(t, engine.checkReservedPorts("51678"))
+}
+
+func TestCheckReservedPortsInvalid(t *testing.T) {
+	engine := &Engine{}
+	assert.Error(t, engine.checkReservedPorts("agent"))
+}
+
 func TestStartSupervisedCannotStart(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 
-	mockDocker.EXPECT().RemoveExistingAgentContainer()
-	mockDocker.EXPECT().StartAgent().Return(0, errors.New("test error"))
+	mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any())
+	mockDocker.EXPECT().StartAgent(gomock.Any()).Return(0, errors.New("test error"))
 
 	engine := &Engine{
 		docker: mockDocker,
 	}
-	err := engine.StartSupervised()
+	err := engine.StartSupervised(context.Background())
 	if err == nil {
 		t.Error("Expected error to be returned but was nil")
 	}
 }
 
+func TestStartSupervisedCanceled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	gomock.InOrder(
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		// waiting for the Agent fails once the context is canceled
+		mockDocker.EXPECT().StartAgent(gomock.Any()).DoAndReturn(func(ctx context.Context) (int, error) {
+			cancel()
+			return 0, ctx.Err()
+		}),
+	)
+
+	engine := &Engine{
+		docker: mockDocker,
+	}
+	err := engine.StartSupervised(ctx)
+	assert.True(t, errors.Is(err, context.Canceled), "Expect the cancellation, got: %v", err)
+	assert.Equal(t, StateStopping, engine.State())
+}
+
 func TestStartSupervisedExitsWhenTerminalFailure(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 
 	gomock.InOrder(
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(1, nil),
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(1, nil),
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(1, nil),
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(terminalFailureAgentExitCode, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(1, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(1, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(1, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(terminalFailureAgentExitCode, nil),
 	)
 
 	engine := &Engine{
 		docker: mockDocker,
 	}
-	err := engine.StartSupervised()
+	err := engine.StartSupervised(context.Background())
 	if err == nil {
 		t.Error("Expected error to be returned but was nil")
 	}
 }
 
+func TestStartSupervisedGivesUpAfterMaxRestarts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.AgentMaxRestartsEnvVar, "2")
+	defer os.Unsetenv(config.AgentMaxRestartsEnvVar)
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()).Times(3)
+	mockDocker.EXPECT().StartAgent(gomock.Any()).Return(1, nil).Times(3)
+
+	engine := &Engine{
+		docker: mockDocker,
+	}
+	assert.Error(t, engine.StartSupervised(context.Background()))
+	assert.Equal(t, StateStopping, engine.State())
+}
+
 func TestLogContainerFailureAgentExitCodeFailure(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 
-	mockDocker.EXPECT().RemoveExistingAgentContainer()
-	mockDocker.EXPECT().StartAgent().Return(2, nil)
-	mockDocker.EXPECT().GetContainerLogTail(gomock.Any())
-	mockDocker.EXPECT().RemoveExistingAgentContainer()
-	mockDocker.EXPECT().StartAgent().Return(0, errors.New("test error"))
+	mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any())
+	mockDocker.EXPECT().StartAgent(gomock.Any()).Return(2, nil)
+	mockDocker.EXPECT().GetContainerLogTail(gomock.Any(), gomock.Any())
+	mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any())
+	mockDocker.EXPECT().StartAgent(gomock.Any()).Return(0, errors.New("test error"))
 
 	engine := &Engine{
 		docker: mockDocker,
 	}
-	err := engine.StartSupervised()
+	err := engine.StartSupervised(context.Background())
 	if err == nil {
 		t.Error("Expected error to be returned but was nil")
 	}
@@ -283,22 +802,23 @@ func TestStartSupervisedExitsWhenTerminalSuccess(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 
 	gomock.InOrder(
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(1, nil),
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(1, nil),
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(1, nil),
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(terminalSuccessAgentExitCode, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(1, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(1, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(1, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(terminalSuccessAgentExitCode, nil),
 	)
 
 	engine := &Engine{
 		docker: mockDocker,
 	}
-	err := engine.StartSupervised()
+	err := engine.StartSupervised(context.Background())
 	if err != nil {
 		t.Error("Expected error to be nil but was returned")
 	}
@@ -309,21 +829,22 @@ func TestStartSupervisedUpgradeOpenFailure(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 	mockDownloader := NewMockdownloader(mockCtrl)
 
 	gomock.InOrder(
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(upgradeAgentExitCode, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(upgradeAgentExitCode, nil),
 		mockDownloader.EXPECT().LoadDesiredAgent().Return(nil, errors.New("test error")),
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(terminalSuccessAgentExitCode, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(terminalSuccessAgentExitCode, nil),
 	)
 
 	engine := &Engine{
 		downloader: mockDownloader,
 		docker:     mockDocker,
 	}
-	err := engine.StartSupervised()
+	err := engine.StartSupervised(context.Background())
 	if err != nil {
 		t.Error("Expected error to be nil but was returned")
 	}
@@ -334,22 +855,23 @@ func TestStartSupervisedUpgradeLoadFailure(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 	mockDownloader := NewMockdownloader(mockCtrl)
 
 	gomock.InOrder(
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(upgradeAgentExitCode, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(upgradeAgentExitCode, nil),
 		mockDownloader.EXPECT().LoadDesiredAgent().Return(&os.File{}, nil),
-		mockDocker.EXPECT().LoadImage(gomock.Any()).Return(errors.New("test error")),
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(terminalSuccessAgentExitCode, nil),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any()).Return(errors.New("test error")),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(terminalSuccessAgentExitCode, nil),
 	)
 
 	engine := &Engine{
 		downloader: mockDownloader,
 		docker:     mockDocker,
 	}
-	err := engine.StartSupervised()
+	err := engine.StartSupervised(context.Background())
 	if err != nil {
 		t.Error("Expected error to be nil but was returned")
 	}
@@ -360,23 +882,24 @@ func TestStartSupervisedUpgrade(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 	mockDownloader := NewMockdownloader(mockCtrl)
 
 	gomock.InOrder(
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(upgradeAgentExitCode, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(upgradeAgentExitCode, nil),
 		mockDownloader.EXPECT().LoadDesiredAgent().Return(&os.File{}, nil),
-		mockDocker.EXPECT().LoadImage(gomock.Any()),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any()),
 		mockDownloader.EXPECT().RecordCachedAgent(),
-		mockDocker.EXPECT().RemoveExistingAgentContainer(),
-		mockDocker.EXPECT().StartAgent().Return(terminalSuccessAgentExitCode, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(terminalSuccessAgentExitCode, nil),
 	)
 
 	engine := &Engine{
 		downloader: mockDownloader,
 		docker:     mockDocker,
 	}
-	err := engine.StartSupervised()
+	err := engine.StartSupervised(context.Background())
 	if err != nil {
 		t.Error("Expected error to be nil but was returned")
 	}
@@ -388,12 +911,12 @@ func TestPreStop(t *testing.T) {
 
 	mockDocker := NewMockdockerClient(mockCtrl)
 
-	mockDocker.EXPECT().StopAgent()
+	mockDocker.EXPECT().StopAgent(gomock.Any())
 
 	engine := &Engine{
 		docker: mockDocker,
 	}
-	err := engine.PreStop()
+	err := engine.PreStop(context.Background())
 	if err != nil {
 		t.Errorf("engine pre-stop error: %v", err)
 	}
@@ -408,17 +931,18 @@ func TestReloadCacheNotCached(t *testing.T) {
 	mockDocker := NewMockdockerClient(mockCtrl)
 	mockDownloader := NewMockdownloader(mockCtrl)
 
+	mockDocker.EXPECT().LoadEnvVars().Return(nil)
 	mockDownloader.EXPECT().IsAgentCached().Return(false)
-	mockDownloader.EXPECT().DownloadAgent()
+	mockDownloader.EXPECT().DownloadAgent(gomock.Any())
 	mockDownloader.EXPECT().LoadCachedAgent().Return(cachedAgentBuffer, nil)
-	mockDocker.EXPECT().LoadImage(cachedAgentBuffer)
+	mockDocker.EXPECT().LoadImage(gomock.Any(), cachedAgentBuffer)
 	mockDownloader.EXPECT().RecordCachedAgent()
 
 	engine := &Engine{
 		docker:     mockDocker,
 		downloader: mockDownloader,
 	}
-	err := engine.ReloadCache()
+	err := engine.ReloadCache(context.Background())
 	if err != nil {
 		t.Errorf("engine reload-cache error: %v", err)
 	}
@@ -433,16 +957,17 @@ func TestReloadCacheCached(t *testing.T) {
 	mockDocker := NewMockdockerClient(mockCtrl)
 	mockDownloader := NewMockdownloader(mockCtrl)
 
+	mockDocker.EXPECT().LoadEnvVars().Return(nil)
 	mockDownloader.EXPECT().IsAgentCached().Return(true)
 	mockDownloader.EXPECT().LoadCachedAgent().Return(cachedAgentBuffer, nil)
-	mockDocker.EXPECT().LoadImage(cachedAgentBuffer)
+	mockDocker.EXPECT().LoadImage(gomock.Any(), cachedAgentBuffer)
 	mockDownloader.EXPECT().RecordCachedAgent()
 
 	engine := &Engine{
 		docker:     mockDocker,
 		downloader: mockDownloader,
 	}
-	err := engine.ReloadCache()
+	err := engine.ReloadCache(context.Background())
 	if err != nil {
 		t.Errorf("engine reload-cache error: %v", err)
 	}
@@ -453,6 +978,7 @@ func TestPrestartLoopbackRoutingNotEnabled(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 	mockDownloader := NewMockdownloader(mockCtrl)
 	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
 
@@ -466,7 +992,7 @@ func TestPrestartLoopbackRoutingNotEnabled(t *testing.T) {
 		loopbackRouting:       mockLoopbackRouting,
 		credentialsProxyRoute: mockRoute,
 	}
-	err := engine.PreStart()
+	err := engine.PreStart(context.Background())
 	if err == nil {
 		t.Error("Expected pre-start error when loopback routing not enabled")
 	}
@@ -477,6 +1003,7 @@ func TestPrestartCredentialsProxyRouteNotCreated(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
 	mockDownloader := NewMockdownloader(mockCtrl)
 	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
 
@@ -491,7 +1018,7 @@ func TestPrestartCredentialsProxyRouteNotCreated(t *testing.T) {
 		loopbackRouting:       mockLoopbackRouting,
 		credentialsProxyRoute: mockRoute,
 	}
-	err := engine.PreStart()
+	err := engine.PreStart(context.Background())
 	if err == nil {
 		t.Error("Expected pre-start error when the credentials proxy route cannot be created")
 	}
@@ -510,7 +1037,7 @@ func TestPostStop(t *testing.T) {
 		loopbackRouting:       mockLoopbackRouting,
 		credentialsProxyRoute: mockRoute,
 	}
-	err := engine.PostStop()
+	err := engine.PostStop(context.Background())
 	if err != nil {
 		t.Errorf("engine post-stop error: %v", err)
 	}
@@ -529,7 +1056,7 @@ func TestPostStopLoopbackRoutingError(t *testing.T) {
 		loopbackRouting:       mockLoopbackRouting,
 		credentialsProxyRoute: mockRoute,
 	}
-	err := engine.PostStop()
+	err := engine.PostStop(context.Background())
 	if err == nil {
 		t.Error("Expected error during engine post-stop")
 	}
@@ -548,8 +1075,76 @@ func TestPostStopCredentialsProxyRouteRemoveError(t *testing.T) {
 		loopbackRouting:       mockLoopbackRouting,
 		credentialsProxyRoute: mockRoute,
 	}
-	err := engine.PostStop()
+	err := engine.PostStop(context.Background())
 	if err != nil {
 		t.Errorf("engine post-stop error: %v", err)
 	}
 }
+
+func TestReloadCacheRollsBackAgentThatFailsToLoad(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	gomock.InOrder(
+		mockDocker.EXPECT().LoadEnvVars().Return(nil),
+		mockDownloader.EXPECT().IsAgentCached().Return(false),
+		mockDownloader.EXPECT().DownloadAgent(gomock.Any()),
+		mockDownloader.EXPECT().LoadCachedAgent().Return(ioutil.NopCloser(&bytes.Buffer{}), nil),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any()).Return(errors.New("test error")),
+		mockDownloader.EXPECT().RollbackAgent().Return("v1.36.0", nil),
+		mockDownloader.EXPECT().LoadCachedAgent().Return(ioutil.NopCloser(&bytes.Buffer{}), nil),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any()),
+		mockDownloader.EXPECT().RecordCachedAgent(),
+	)
+
+	engine := &Engine{
+		docker:     mockDocker,
+		downloader: mockDownloader,
+	}
+	assert.NoError(t, engine.ReloadCache(context.Background()))
+	assert.Equal(t, StateLoading, engine.State())
+}
+
+func TestReloadCacheNoAgentToRollBackTo(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	gomock.InOrder(
+		mockDocker.EXPECT().LoadEnvVars().Return(nil),
+		mockDownloader.EXPECT().IsAgentCached().Return(false),
+		mockDownloader.EXPECT().DownloadAgent(gomock.Any()),
+		mockDownloader.EXPECT().LoadCachedAgent().Return(ioutil.NopCloser(&bytes.Buffer{}), nil),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any()).Return(errors.New("test error")),
+		mockDownloader.EXPECT().RollbackAgent().Return("", errors.New("no previous agent")),
+	)
+
+	engine := &Engine{
+		docker:     mockDocker,
+		downloader: mockDownloader,
+	}
+	err := engine.ReloadCache(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "test error")
+}
+
+func TestCrashLoopDetector(t *testing.T) {
+	var crashLoop crashLoopDetector
+	for i := 1; i < agentCrashLoopStarts; i++ {
+		assert.False(t, crashLoop.failed(true))
+	}
+	// a healthy run resets the count
+	assert.False(t, crashLoop.failed(false))
+	for i := 1; i < agentCrashLoopStarts; i++ {
+		assert.False(t, crashLoop.failed(true))
+	}
+	assert.True(t, crashLoop.failed(true), "Expect the Agent to be rolled back")
+	for i := 0; i < agentCrashLoopStarts; i++ {
+		assert.False(t, crashLoop.failed(true), "Expect the Agent to be rolled back once")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
+	log "github.com/cihub/seelog"
+)
+
+// firelensDirectoryPerm is the mode of the FireLens directories, which must
+// not be writable by users other than root
+const firelensDirectoryPerm = 0755
+
+// prepareFirelens creates the parent directory of the FireLens directories and
+// pulls the log router image, so that the first FireLens task started on the
+// instance does not have to. The config and socket directories of a log router
+// are created by the Agent under the directory of its task, so they cannot be
+// created ahead of the tasks.
+func (e *Engine) prepareFirelens(ctx context.Context, envVariables map[string]string) error {
+	if e.dryRun {
+		log.Infof("Dry run: would create directory %s with mode %s", config.FirelensDataDirectory(), firelensDirectoryPerm)
+	} else {
+		err := prepareDirectory(config.FirelensDataDirectory(), firelensDirectoryPerm)
+		if err != nil {
+			return err
+		}
+	}
+	image := envVariables[config.FirelensImageEnvVar]
+	if image == "" {
+		image = config.DefaultFirelensImage
+	}
+	log.Infof("Pulling FireLens log router image %s", image)
+	err := e.docker.PullImage(ctx, image)
+	if err != nil {
+		// the Agent pulls the image when a FireLens task is started
+		log.Warnf("Could not pull FireLens log router image %s: %v", image, err)
+	}
+	return nil
+}
+
+// prepareDirectory creates the directory path if it is missing and removes
+// the write permission of group and other users from it
+func prepareDirectory(path string, perm os.FileMode) error {
+	err := os.MkdirAll(path, perm)
+	if err != nil {
+		return err
+	}
+	hostmanifest.Record(hostmanifest.KindFile, path, hostmanifest.Directory)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	if info.Mode().Perm()&0022 == 0 {
+		return nil
+	}
+	log.Warnf("Removing group and other write permission from %s, its mode was %s", path, info.Mode().Perm())
+	return os.Chmod(path, info.Mode().Perm()&^0022)
+}
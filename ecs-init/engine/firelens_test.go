@@ -0,0 +1,56 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareDirectoryCreates(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "data", "firelens")
+	err := prepareDirectory(path, firelensDirectoryPerm)
+	assert.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+}
+
+func TestPrepareDirectoryFixesPermissions(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.Chmod(dir, 0777))
+	err := prepareDirectory(dir, firelensDirectoryPerm)
+	assert.NoError(t, err)
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+}
+
+func TestPrepareDirectoryNotADirectory(t *testing.T) {
+	file, err := ioutil.TempFile("", "firelens")
+	require.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	err = prepareDirectory(file.Name(), firelensDirectoryPerm)
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// agentHealthCheckFailures is how many health checks in a row the Agent
+	// fails before it is restarted
+	agentHealthCheckFailures = 3
+	// agentStableAfter is how long the Agent runs before its failures are no
+	// longer counted as restarts in a row
+	agentStableAfter = 10 * time.Minute
+	// dockerUnhealthy is the status of a container failing its health check
+	dockerUnhealthy = "unhealthy"
+)
+
+// startHealthCheck checks the health of the healthy Agent periodically, and
+// stops the Agent once it failed agentHealthCheckFailures checks in a row so
+// that it is restarted. The returned function stops the checks and waits for
+// one in progress.
+func (e *Engine) startHealthCheck(ctx context.Context) func() {
+	interval, err := config.HealthCheckInterval()
+	if err != nil {
+		log.Warnf("Not checking the health of the Agent: %v", err)
+		return func() {}
+	}
+	if interval == 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := e.clk().NewTicker(interval)
+		defer ticker.Stop()
+		failures := 0
+		for {
+			select {
+			case <-ticker.C():
+				// the Agent is given agentHealthyAfter to start serving
+				if e.State() != StateHealthy {
+					continue
+				}
+				err := e.checkAgentHealth(ctx)
+				if err == nil {
+					failures = 0
+					continue
+				}
+				failures++
+				log.Warnf("Agent failed health check %d of %d: %v", failures, agentHealthCheckFailures, err)
+				if failures >= agentHealthCheckFailures && e.restartUnhealthyAgent(ctx) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// checkAgentHealth returns an error when Docker reports the Agent container
+// as unhealthy or the introspection API of the Agent does not answer
+func (e *Engine) checkAgentHealth(ctx context.Context) error {
+	status, err := e.docker.AgentHealth(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not inspect the Agent container")
+	}
+	if status == dockerUnhealthy {
+		return errors.Errorf("docker reports the Agent container as %s", status)
+	}
+	_, err = e.agentMetadata.Metadata()
+	return err
+}
+
+// restartUnhealthyAgent stops the Agent so that it is restarted as a failed
+// Agent. It returns true once the Agent was stopped.
+func (e *Engine) restartUnhealthyAgent(ctx context.Context) bool {
+	log.Errorf("Stopping the Agent after %d failed health checks", agentHealthCheckFailures)
+	atomic.StoreInt32(&e.healthRestartDue, 1)
+	err := e.docker.StopAgent(ctx)
+	if err != nil {
+		log.Warnf("Could not stop the unhealthy Agent: %v", err)
+		atomic.StoreInt32(&e.healthRestartDue, 0)
+		return false
+	}
+	return true
+}
+
+// takeHealthRestart returns true once after the Agent was stopped for failing
+// its health checks
+func (e *Engine) takeHealthRestart() bool {
+	return atomic.CompareAndSwapInt32(&e.healthRestartDue, 1, 0)
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/introspection"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckAgentHealth(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockMetadata := NewMockagentMetadata(mockCtrl)
+	gomock.InOrder(
+		mockDocker.EXPECT().AgentHealth(gomock.Any()).Return("healthy", nil),
+		mockMetadata.EXPECT().Metadata().Return(&introspection.Metadata{}, nil),
+		mockDocker.EXPECT().AgentHealth(gomock.Any()).Return("", nil),
+		mockMetadata.EXPECT().Metadata().Return(nil, errors.New("test error")),
+		mockDocker.EXPECT().AgentHealth(gomock.Any()).Return(dockerUnhealthy, nil),
+		mockDocker.EXPECT().AgentHealth(gomock.Any()).Return("", errors.New("test error")),
+	)
+
+	engine := &Engine{docker: mockDocker, agentMetadata: mockMetadata}
+	assert.NoError(t, engine.checkAgentHealth(context.Background()))
+	assert.Error(t, engine.checkAgentHealth(context.Background()), "Expect an Agent that does not answer to be unhealthy")
+	assert.Error(t, engine.checkAgentHealth(context.Background()), "Expect an Agent reported unhealthy by Docker to be unhealthy")
+	assert.Error(t, engine.checkAgentHealth(context.Background()))
+}
+
+func TestStartHealthCheckDisabled(t *testing.T) {
+	os.Unsetenv(config.HealthCheckIntervalEnvVar)
+	engine := &Engine{}
+	engine.startHealthCheck(context.Background())()
+}
+
+func TestStartHealthCheckRestartsAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.HealthCheckIntervalEnvVar, "30s")
+	defer os.Unsetenv(config.HealthCheckIntervalEnvVar)
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockMetadata := NewMockagentMetadata(mockCtrl)
+	checked := make(chan struct{}, 1)
+	check := func(context.Context) { checked <- struct{}{} }
+	stopped := make(chan struct{})
+	gomock.InOrder(
+		mockDocker.EXPECT().AgentHealth(gomock.Any()).Do(check).Return(dockerUnhealthy, nil),
+		// a passing check resets the failures
+		mockDocker.EXPECT().AgentHealth(gomock.Any()).Do(check).Return("healthy", nil),
+		mockMetadata.EXPECT().Metadata().Return(&introspection.Metadata{}, nil),
+		mockDocker.EXPECT().AgentHealth(gomock.Any()).Do(check).Return(dockerUnhealthy, nil).Times(agentHealthCheckFailures),
+		mockDocker.EXPECT().StopAgent(gomock.Any()).Do(func(context.Context) { close(stopped) }).Return(nil),
+	)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{docker: mockDocker, agentMetadata: mockMetadata, clock: fakeClock}
+	engine.transition(StateStarting)
+	engine.transition(StateHealthy)
+	stop := engine.startHealthCheck(context.Background())
+	fakeClock.BlockUntil(1)
+	for i := 0; i < agentHealthCheckFailures+2; i++ {
+		fakeClock.Advance(30 * time.Second)
+		<-checked
+	}
+	<-stopped
+	stop()
+	assert.True(t, engine.takeHealthRestart())
+	assert.False(t, engine.takeHealthRestart(), "Expect the restart to be taken once")
+}
+
+func TestStartHealthCheckWaitsForHealthy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.HealthCheckIntervalEnvVar, "30s")
+	defer os.Unsetenv(config.HealthCheckIntervalEnvVar)
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().AgentHealth(gomock.Any()).Times(0)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{docker: mockDocker, clock: fakeClock}
+	engine.transition(StateStarting)
+	stop := engine.startHealthCheck(context.Background())
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(30 * time.Second)
+	stop()
+}
+
+func TestRestartUnhealthyAgentStopFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().StopAgent(gomock.Any()).Return(errors.New("test error"))
+
+	engine := &Engine{docker: mockDocker}
+	assert.False(t, engine.restartUnhealthyAgent(context.Background()))
+	assert.False(t, engine.takeHealthRestart())
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/history"
+
+	log "github.com/cihub/seelog"
+)
+
+// recordEvent records a lifecycle event of the Agent in the history. The
+// history is best effort, failing to record an event does not fail the
+// action.
+func (e *Engine) recordEvent(kind, detail string) {
+	if e.history == nil {
+		return
+	}
+	err := e.history.Append(history.Event{
+		Time:   e.clk().Now().UTC(),
+		Kind:   kind,
+		Detail: detail,
+	})
+	if err != nil {
+		log.Warnf("Could not record the %s event in the history: %v", kind, err)
+	}
+}
+
+// recordAgentEvent records a lifecycle event of the Agent, detailed with the
+// version of the cached Agent
+func (e *Engine) recordAgentEvent(kind string) {
+	if e.history == nil {
+		return
+	}
+	e.recordEvent(kind, fmt.Sprintf("Agent %s", e.downloader.AgentVersion()))
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/history"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreStopRecordsStop(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockHistory := NewMockhistoryLog(mockCtrl)
+	gomock.InOrder(
+		mockDocker.EXPECT().StopAgent(gomock.Any()),
+		mockHistory.EXPECT().Append(gomock.Any()).Do(func(event history.Event) {
+			assert.Equal(t, history.KindStop, event.Kind)
+			assert.False(t, event.Time.IsZero())
+		}),
+	)
+
+	engine := &Engine{
+		docker:  mockDocker,
+		history: mockHistory,
+	}
+	assert.NoError(t, engine.PreStop(context.Background()))
+}
+
+func TestPreStopFailureNotRecordedAsStop(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockHistory := NewMockhistoryLog(mockCtrl)
+	mockDocker.EXPECT().StopAgent(gomock.Any()).Return(errors.New("docker unavailable"))
+
+	engine := &Engine{
+		docker:  mockDocker,
+		history: mockHistory,
+	}
+	assert.Error(t, engine.PreStop(context.Background()))
+}
+
+func TestRecordAgentEvent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockHistory := NewMockhistoryLog(mockCtrl)
+	mockDownloader.EXPECT().AgentVersion().Return("1.42.0")
+	mockHistory.EXPECT().Append(gomock.Any()).Do(func(event history.Event) {
+		assert.Equal(t, history.KindUpgrade, event.Kind)
+		assert.Equal(t, "Agent 1.42.0", event.Detail)
+	}).Return(errors.New("read-only file system"))
+
+	engine := &Engine{
+		downloader: mockDownloader,
+		history:    mockHistory,
+	}
+	// failing to record the event is only logged
+	engine.recordAgentEvent(history.KindUpgrade)
+}
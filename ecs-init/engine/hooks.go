@@ -0,0 +1,52 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/hooks"
+
+	log "github.com/cihub/seelog"
+)
+
+// runHooks runs the hooks operators provide for stage
+func (e *Engine) runHooks(ctx context.Context, stage string) error {
+	if e.hooks == nil {
+		return nil
+	}
+	return e.hooks.Run(ctx, stage)
+}
+
+// startPostStart prunes the previous images of the Agent and runs the
+// post-start hooks in the background, so that neither holds back the
+// supervision of the Agent. Both are stopped once ctx is done, and
+// StartSupervised waits for them before it returns.
+func (e *Engine) startPostStart(ctx context.Context) {
+	e.postStart.Add(1)
+	go func() {
+		defer e.postStart.Done()
+		e.pruneAgentImagesAfterStart(ctx)
+		e.runPostStartHooks(ctx)
+	}()
+}
+
+// runPostStartHooks runs the post-start hooks once the Agent is healthy. The
+// Agent keeps running when a hook fails.
+func (e *Engine) runPostStartHooks(ctx context.Context) {
+	err := e.runHooks(ctx, hooks.PostStart)
+	if err != nil {
+		log.Warnf("Post-start hook failed: %v", err)
+	}
+}
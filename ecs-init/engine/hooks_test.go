@@ -0,0 +1,125 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/hooks"
+	"github.com/aws/amazon-ecs-init/ecs-init/sdnotify"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestPreStartEngine returns an engine whose pre-start steps succeed with
+// the Agent image cached and loaded
+func newTestPreStartEngine(mockCtrl *gomock.Controller, hookRunner hookRunner) *Engine {
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDocker.EXPECT().LoadEnvVars().Return(nil)
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(true, nil)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().AgentCacheStatus().Return(cache.StatusCached)
+	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
+	mockLoopbackRouting.EXPECT().Enable().Return(nil)
+	mockRoute := NewMockcredentialsProxyRoute(mockCtrl)
+	mockRoute.EXPECT().Create().Return(nil)
+
+	return &Engine{
+		docker:                mockDocker,
+		downloader:            mockDownloader,
+		loopbackRouting:       mockLoopbackRouting,
+		credentialsProxyRoute: mockRoute,
+		hooks:                 hookRunner,
+	}
+}
+
+func TestPreStartRunsHooks(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockHooks := NewMockhookRunner(mockCtrl)
+	mockHooks.EXPECT().Run(gomock.Any(), hooks.PreStart).Return(nil)
+
+	engine := newTestPreStartEngine(mockCtrl, mockHooks)
+	assert.NoError(t, engine.PreStart(context.Background()))
+}
+
+func TestPreStartHookFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockHooks := NewMockhookRunner(mockCtrl)
+	mockHooks.EXPECT().Run(gomock.Any(), hooks.PreStart).Return(errors.New("exit status 1"))
+
+	engine := newTestPreStartEngine(mockCtrl, mockHooks)
+	err := engine.PreStart(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "pre-start hook failed")
+}
+
+func TestMarkHealthyAfterRunsPostStartHooks(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ran := make(chan struct{})
+	mockHooks := NewMockhookRunner(mockCtrl)
+	// a failed post-start hook leaves the Agent running
+	mockHooks.EXPECT().Run(gomock.Any(), hooks.PostStart).Do(func(context.Context, string) {
+		close(ran)
+	}).Return(errors.New("exit status 1"))
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{clock: fakeClock, hooks: mockHooks}
+	engine.transition(StateStarting)
+	cancel := engine.markHealthyAfter(context.Background())
+	defer cancel()
+	fakeClock.Advance(agentHealthyAfter)
+	<-ran
+	assert.Equal(t, StateHealthy, engine.State())
+}
+
+func TestMarkHealthyAfterRunsPostStartHooksOnceReady(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ran := make(chan struct{})
+	mockNotifier := NewMockserviceNotifier(mockCtrl)
+	mockHooks := NewMockhookRunner(mockCtrl)
+	gomock.InOrder(
+		mockNotifier.EXPECT().Notify(sdnotify.Ready).Return(nil),
+		mockHooks.EXPECT().Run(gomock.Any(), hooks.PostStart).Do(func(ctx context.Context, stage string) {
+			// the hooks run under the context of the supervision
+			<-ctx.Done()
+			close(ran)
+		}).Return(context.Canceled),
+	)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{clock: fakeClock, hooks: mockHooks, notifier: mockNotifier}
+	engine.transition(StateStarting)
+	ctx, cancelSupervision := context.WithCancel(context.Background())
+	cancel := engine.markHealthyAfter(ctx)
+	defer cancel()
+	fakeClock.Advance(agentHealthyAfter)
+	cancelSupervision()
+	<-ran
+	engine.postStart.Wait()
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
+	log "github.com/cihub/seelog"
+)
+
+const hostManifestPerm = 0644
+
+// recordHostManifest adds the mutations made to the host by the action to
+// the manifest of the current boot. The manifest of the previous boot is kept
+// once the first mutation of a new boot is recorded. Mutations are recorded
+// on a best effort basis.
+func (e *Engine) recordHostManifest() {
+	mutations := hostmanifest.Take()
+	if len(mutations) == 0 || e.bootIDFile == "" || e.statusWriter == nil {
+		return
+	}
+	bootID, err := readBootID(e.bootIDFile)
+	if err != nil {
+		log.Debugf("Not recording the host mutations: %v", err)
+		return
+	}
+	manifest, err := readHostManifest(config.HostManifest())
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("Could not read the host manifest, starting over: %v", err)
+	}
+	if manifest == nil || manifest.BootID != bootID {
+		if manifest != nil {
+			err = e.writeHostManifest(config.PreviousHostManifest(), manifest)
+			if err != nil {
+				log.Warnf("Could not keep the host manifest of the previous boot: %v", err)
+			}
+		}
+		manifest = &hostmanifest.Manifest{BootID: bootID}
+	}
+	manifest.Add(mutations)
+	err = e.writeHostManifest(config.HostManifest(), manifest)
+	if err != nil {
+		log.Warnf("Could not record the host mutations: %v", err)
+	}
+}
+
+// DiffHostManifest writes the mutations made to the host in the current boot
+// that differ from those made in the previous boot
+func (e *Engine) DiffHostManifest(ctx context.Context, w io.Writer) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	current, err := readHostManifest(config.HostManifest())
+	if os.IsNotExist(err) {
+		fmt.Fprintf(w, "No host mutations recorded in %s\n", config.HostManifest())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	previous, err := readHostManifest(config.PreviousHostManifest())
+	if os.IsNotExist(err) {
+		fmt.Fprintf(w, "No host mutations recorded for a boot before boot %s\n", current.BootID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	writeHostManifestDiff(w, previous, current)
+	return nil
+}
+
+// writeHostManifestDiff writes the changes from the previous manifest to the
+// current one, one per line: '+' for targets only changed in the current
+// boot, '-' for targets only changed in the previous boot and '~' for
+// targets changed to another value
+func writeHostManifestDiff(w io.Writer, previous, current *hostmanifest.Manifest) {
+	changes := hostmanifest.Diff(previous, current)
+	fmt.Fprintf(w, "Host mutations of boot %s compared to boot %s:\n", current.BootID, previous.BootID)
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "  no difference")
+		return
+	}
+	for _, change := range changes {
+		switch {
+		case change.Previous == "":
+			fmt.Fprintf(w, "+ %s %s: %s\n", change.Kind, change.Target, change.Current)
+		case change.Current == "":
+			fmt.Fprintf(w, "- %s %s: %s\n", change.Kind, change.Target, change.Previous)
+		default:
+			fmt.Fprintf(w, "~ %s %s: %s -> %s\n", change.Kind, change.Target, change.Previous, change.Current)
+		}
+	}
+}
+
+func (e *Engine) writeHostManifest(file string, manifest *hostmanifest.Manifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("could not encode the host manifest: %w", err)
+	}
+	return e.statusWriter.WriteFile(file, data, hostManifestPerm)
+}
+
+func readHostManifest(file string) (*hostmanifest.Manifest, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &hostmanifest.Manifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the host manifest %s: %w", file, err)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordHostManifest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	bootIDFile := writeBootID(t)
+	hostmanifest.Take()
+	hostmanifest.Record(hostmanifest.KindSysctl, "net.ipv4.conf.all.route_localnet", "1")
+	mockStatusWriter := NewMockstatusWriter(mockCtrl)
+	mockStatusWriter.EXPECT().WriteFile(config.HostManifest(), gomock.Any(), os.FileMode(hostManifestPerm)).Do(
+		func(filename string, data []byte, perm os.FileMode) {
+			var manifest hostmanifest.Manifest
+			require.NoError(t, json.Unmarshal(data, &manifest))
+			assert.Equal(t, "2ae3c7a4-5c4b-4b4e-9d0b-7a8c1f0e6d21", manifest.BootID)
+			if assert.Len(t, manifest.Mutations, 1) {
+				assert.Equal(t, "net.ipv4.conf.all.route_localnet", manifest.Mutations[0].Target)
+			}
+		}).Return(nil)
+
+	engine := &Engine{
+		statusWriter: mockStatusWriter,
+		bootIDFile:   bootIDFile,
+	}
+	engine.recordHostManifest()
+	// nothing is written without new mutations
+	engine.recordHostManifest()
+}
+
+func TestRecordHostManifestNotTracked(t *testing.T) {
+	hostmanifest.Record(hostmanifest.KindSysctl, "net.ipv4.conf.all.route_localnet", "1")
+	engine := &Engine{}
+	engine.recordHostManifest()
+	assert.Empty(t, hostmanifest.Take())
+}
+
+func TestWriteHostManifestDiff(t *testing.T) {
+	previous := &hostmanifest.Manifest{BootID: "a", Mutations: []hostmanifest.Mutation{
+		{Kind: hostmanifest.KindSysctl, Target: "net.core.somaxconn", Value: "4096"},
+		{Kind: hostmanifest.KindFile, Target: "/etc/systemd/system/ecs-reserved.slice", Value: "sha256:aa"},
+	}}
+	current := &hostmanifest.Manifest{BootID: "b", Mutations: []hostmanifest.Mutation{
+		{Kind: hostmanifest.KindSysctl, Target: "net.core.somaxconn", Value: "8192"},
+		{Kind: hostmanifest.KindRule, Target: "-t nat OUTPUT", Value: hostmanifest.Added},
+	}}
+
+	var out bytes.Buffer
+	writeHostManifestDiff(&out, previous, current)
+	assert.Equal(t, `Host mutations of boot b compared to boot a:
+- file /etc/systemd/system/ecs-reserved.slice: sha256:aa
++ rule -t nat OUTPUT: added
+~ sysctl net.core.somaxconn: 4096 -> 8192
+`, out.String())
+
+	out.Reset()
+	writeHostManifestDiff(&out, current, current)
+	assert.Equal(t, "Host mutations of boot b compared to boot b:\n  no difference\n", out.String())
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+// startIntrospectionSocket serves the introspection API of the Agent on a
+// unix socket for as long as the Agent is supervised, if the socket is
+// configured. The returned function stops serving it.
+func (e *Engine) startIntrospectionSocket() func() {
+	if e.introspectionSocket == nil {
+		return func() {}
+	}
+	err := e.introspectionSocket.Start()
+	if err != nil {
+		// host tooling can still reach the Agent on its TCP port
+		log.Errorf("Could not serve the introspection API on %s: %v", config.IntrospectionSocket(), err)
+		return func() {}
+	}
+	log.Infof("Serving the introspection API of the Agent on %s", config.IntrospectionSocket())
+	return func() {
+		err := e.introspectionSocket.Stop()
+		if err != nil {
+			log.Warnf("Could not stop serving the introspection API: %v", err)
+		}
+	}
+}
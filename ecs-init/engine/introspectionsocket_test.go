@@ -0,0 +1,54 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestStartIntrospectionSocket(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockSocket := NewMockintrospectionSocket(mockCtrl)
+	gomock.InOrder(
+		mockSocket.EXPECT().Start().Return(nil),
+		mockSocket.EXPECT().Stop().Return(nil),
+	)
+
+	engine := &Engine{introspectionSocket: mockSocket}
+	stop := engine.startIntrospectionSocket()
+	stop()
+}
+
+func TestStartIntrospectionSocketError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockSocket := NewMockintrospectionSocket(mockCtrl)
+	mockSocket.EXPECT().Start().Return(errors.New("test error"))
+
+	engine := &Engine{introspectionSocket: mockSocket}
+	stop := engine.startIntrospectionSocket()
+	// nothing to stop when the socket could not be served
+	stop()
+}
+
+func TestStartIntrospectionSocketNotConfigured(t *testing.T) {
+	engine := &Engine{}
+	engine.startIntrospectionSocket()()
+}
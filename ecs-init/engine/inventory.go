@@ -0,0 +1,121 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/ssmclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/version"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// inventoryTypeName is the custom SSM Inventory type the Agent is
+	// reported as
+	inventoryTypeName = "Custom:AmazonECSAgent"
+	// inventorySchemaVersion is the version of the content reported as
+	// inventoryTypeName
+	inventorySchemaVersion = "1.0"
+)
+
+// startInventoryReport reports the Agent to SSM Inventory periodically
+// while it is supervised, so that the Agent versions of a fleet can be
+// queried in Systems Manager. The returned function stops the reporting.
+func (e *Engine) startInventoryReport() func() {
+	interval, err := config.InventoryInterval()
+	if err != nil {
+		log.Warnf("Not reporting the Agent to SSM Inventory: %v", err)
+		return func() {}
+	}
+	if interval == 0 {
+		return func() {}
+	}
+	if e.offline {
+		log.Warnf("Not reporting the Agent to SSM Inventory in offline mode")
+		return func() {}
+	}
+	log.Infof("Reporting the Agent to SSM Inventory every %s", interval)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := e.clk().NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := e.reportInventory()
+			if err != nil {
+				log.Warnf("Could not report the Agent to SSM Inventory: %v", err)
+			}
+			select {
+			case <-ticker.C():
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// reportInventory puts the inventory item of the Agent, creating the client
+// for the region of the instance on first use
+func (e *Engine) reportInventory() error {
+	if e.inventory == nil {
+		region, err := e.downloader.Region()
+		if err != nil {
+			return errors.Wrap(err, "could not create SSM client")
+		}
+		client, err := ssmclient.New(region)
+		if err != nil {
+			return errors.Wrap(err, "could not create SSM client")
+		}
+		e.inventory = client
+		e.dryRunAWSClients()
+	}
+	instanceID, err := e.downloader.InstanceID()
+	if err != nil {
+		return err
+	}
+	return e.inventory.PutInventory(instanceID, e.inventoryItem())
+}
+
+// inventoryItem returns the versions of the Agent and of ecs-init along with
+// the status of the engine
+func (e *Engine) inventoryItem() ssmclient.InventoryItem {
+	current := e.state.current()
+	content := map[string]string{
+		"AgentVersion":              e.downloader.CachedAgent().Version,
+		"EcsInitVersion":            version.Version,
+		"EcsInitGitHash":            version.GitShortHash,
+		"State":                     current.State.String(),
+		"Since":                     current.Since.UTC().Format(time.RFC3339),
+		"ConfigDriftPendingRestart": strconv.FormatBool(current.ConfigDriftPendingRestart),
+	}
+	if current.Registration != "" {
+		content["Registration"] = current.Registration
+	}
+	return ssmclient.InventoryItem{
+		TypeName:      inventoryTypeName,
+		SchemaVersion: inventorySchemaVersion,
+		CaptureTime:   e.clk().Now().UTC().Format(ssmclient.InventoryTimeFormat),
+		Content:       []map[string]string{content},
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/ssmclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/version"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportInventory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockInventory := NewMockinventoryAPI(mockCtrl)
+	mockDownloader.EXPECT().InstanceID().Return("i-1234", nil)
+	mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{Version: "v1.40.0"})
+	mockInventory.EXPECT().PutInventory("i-1234", gomock.Any()).Do(
+		func(instanceID string, items ...ssmclient.InventoryItem) {
+			assert.Equal(t, []ssmclient.InventoryItem{{
+				TypeName:      inventoryTypeName,
+				SchemaVersion: inventorySchemaVersion,
+				CaptureTime:   "2020-01-02T03:04:05Z",
+				Content: []map[string]string{{
+					"AgentVersion":              "v1.40.0",
+					"EcsInitVersion":            version.Version,
+					"EcsInitGitHash":            version.GitShortHash,
+					"State":                     "Starting",
+					"Since":                     "2020-01-02T03:04:05Z",
+					"ConfigDriftPendingRestart": "false",
+				}},
+			}}, items)
+		}).Return(nil)
+
+	engine := &Engine{
+		downloader: mockDownloader,
+		inventory:  mockInventory,
+		clock:      clock.NewFake(now),
+	}
+	engine.transition(StateStarting)
+	assert.NoError(t, engine.reportInventory())
+}
+
+func TestReportInventoryNoInstanceID(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockInventory := NewMockinventoryAPI(mockCtrl)
+	mockDownloader.EXPECT().InstanceID().Return("", errors.New("test error"))
+	mockInventory.EXPECT().PutInventory(gomock.Any(), gomock.Any()).Times(0)
+
+	engine := &Engine{
+		downloader: mockDownloader,
+		inventory:  mockInventory,
+	}
+	assert.Error(t, engine.reportInventory())
+}
+
+func TestStartInventoryReportDisabled(t *testing.T) {
+	os.Unsetenv(config.InventoryIntervalEnvVar)
+	engine := &Engine{}
+	engine.startInventoryReport()()
+}
+
+func TestStartInventoryReportOffline(t *testing.T) {
+	os.Setenv(config.InventoryIntervalEnvVar, "1h")
+	defer os.Unsetenv(config.InventoryIntervalEnvVar)
+
+	engine := &Engine{offline: true}
+	engine.startInventoryReport()()
+}
+
+func TestStartInventoryReport(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.InventoryIntervalEnvVar, "1h")
+	defer os.Unsetenv(config.InventoryIntervalEnvVar)
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockInventory := NewMockinventoryAPI(mockCtrl)
+	mockDownloader.EXPECT().InstanceID().Return("i-1234", nil).Times(2)
+	mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{Version: "v1.40.0"}).Times(2)
+	reported := make(chan struct{}, 2)
+	mockInventory.EXPECT().PutInventory("i-1234", gomock.Any()).Do(
+		func(instanceID string, items ...ssmclient.InventoryItem) {
+			reported <- struct{}{}
+		}).Return(nil).Times(2)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{
+		downloader: mockDownloader,
+		inventory:  mockInventory,
+		clock:      fakeClock,
+	}
+	stop := engine.startInventoryReport()
+	// reported once when started, and again after the interval
+	<-reported
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Hour)
+	<-reported
+	stop()
+}
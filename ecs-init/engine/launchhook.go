@@ -0,0 +1,70 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/autoscalingclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+// completeLaunchHook completes the launch lifecycle hook holding the instance
+// in its Auto Scaling group once the Agent is healthy, so that the group does
+// not count the instance as InService capacity while the Agent bootstraps.
+// It is called once the registration of the instance is verified. The hook is
+// left to time out with its default result when the Agent never gets there.
+func (e *Engine) completeLaunchHook(ctx context.Context) {
+	hook := config.LaunchLifecycleHook()
+	if hook == "" || e.launchHookCompleted || e.offline {
+		return
+	}
+	ticker := e.clk().NewTicker(registrationPollInterval)
+	defer ticker.Stop()
+	for e.State() != StateHealthy {
+		select {
+		case <-ticker.C():
+		case <-ctx.Done():
+			return
+		}
+	}
+	instanceID, err := e.downloader.InstanceID()
+	if err != nil {
+		log.Errorf("Could not complete launch lifecycle hook %s: %v", hook, err)
+		return
+	}
+	instance, err := e.describeAutoScalingInstance(instanceID)
+	if err != nil {
+		log.Errorf("Could not complete launch lifecycle hook %s: %v", hook, err)
+		return
+	}
+	if instance == nil || instance.LifecycleState != autoscalingclient.LifecycleStatePendingWait {
+		// the instance is not held by the hook, e.g. the Agent was
+		// restarted once the instance was InService
+		log.Debugf("Instance %s is not waiting for launch lifecycle hook %s", instanceID, hook)
+		e.launchHookCompleted = true
+		return
+	}
+	err = e.autoScaling.CompleteLifecycleAction(instance.AutoScalingGroupName, hook, instanceID,
+		autoscalingclient.LifecycleActionContinue)
+	if err != nil {
+		log.Errorf("Could not complete launch lifecycle hook %s: %v", hook, err)
+		return
+	}
+	log.Infof("Completed launch lifecycle hook %s of Auto Scaling group %s, the Agent is ready",
+		hook, instance.AutoScalingGroupName)
+	e.launchHookCompleted = true
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/autoscalingclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func setLaunchLifecycleHook(t *testing.T) {
+	t.Setenv(config.LaunchLifecycleHookEnvVar, "ecs-agent-ready")
+}
+
+func newLaunchHookTestEngine(mockCtrl *gomock.Controller) (*Engine, *MockautoScalingAPI) {
+	engine, mockAutoScaling := newScaleInTestEngine(mockCtrl)
+	engine.state.transition(StateStarting, time.Now())
+	engine.state.transition(StateHealthy, time.Now())
+	return engine, mockAutoScaling
+}
+
+func TestCompleteLaunchHook(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setLaunchLifecycleHook(t)
+	engine, mockAutoScaling := newLaunchHookTestEngine(mockCtrl)
+	gomock.InOrder(
+		mockAutoScaling.EXPECT().DescribeInstance("i-1234").Return(&autoscalingclient.Instance{
+			InstanceID:           "i-1234",
+			AutoScalingGroupName: "ecs-asg",
+			LifecycleState:       autoscalingclient.LifecycleStatePendingWait,
+		}, nil),
+		mockAutoScaling.EXPECT().CompleteLifecycleAction("ecs-asg", "ecs-agent-ready", "i-1234",
+			autoscalingclient.LifecycleActionContinue),
+	)
+
+	engine.completeLaunchHook(context.Background())
+	assert.True(t, engine.launchHookCompleted)
+	// the hook is completed once
+	engine.completeLaunchHook(context.Background())
+}
+
+func TestCompleteLaunchHookDisabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Unsetenv(config.LaunchLifecycleHookEnvVar)
+	engine, mockAutoScaling := newLaunchHookTestEngine(mockCtrl)
+	mockAutoScaling.EXPECT().DescribeInstance(gomock.Any()).Times(0)
+
+	engine.completeLaunchHook(context.Background())
+	assert.False(t, engine.launchHookCompleted)
+}
+
+func TestCompleteLaunchHookNotWaiting(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setLaunchLifecycleHook(t)
+	engine, mockAutoScaling := newLaunchHookTestEngine(mockCtrl)
+	mockAutoScaling.EXPECT().DescribeInstance("i-1234").Return(&autoscalingclient.Instance{
+		InstanceID:           "i-1234",
+		AutoScalingGroupName: "ecs-asg",
+		LifecycleState:       autoscalingclient.LifecycleStateInService,
+	}, nil)
+	mockAutoScaling.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	engine.completeLaunchHook(context.Background())
+	assert.True(t, engine.launchHookCompleted)
+}
+
+func TestCompleteLaunchHookFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setLaunchLifecycleHook(t)
+	engine, mockAutoScaling := newLaunchHookTestEngine(mockCtrl)
+	mockAutoScaling.EXPECT().DescribeInstance("i-1234").Return(&autoscalingclient.Instance{
+		InstanceID:           "i-1234",
+		AutoScalingGroupName: "ecs-asg",
+		LifecycleState:       autoscalingclient.LifecycleStatePendingWait,
+	}, nil)
+	mockAutoScaling.EXPECT().CompleteLifecycleAction("ecs-asg", "ecs-agent-ready", "i-1234",
+		autoscalingclient.LifecycleActionContinue).Return(errors.New("throttled"))
+
+	engine.completeLaunchHook(context.Background())
+	// the hook is completed after the next start of the Agent
+	assert.False(t, engine.launchHookCompleted)
+}
+
+func TestCompleteLaunchHookWaitsForHealthy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setLaunchLifecycleHook(t)
+	engine, mockAutoScaling := newScaleInTestEngine(mockCtrl)
+	mockAutoScaling.EXPECT().DescribeInstance(gomock.Any()).Times(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	defer func(interval time.Duration) { registrationPollInterval = interval }(registrationPollInterval)
+	registrationPollInterval = time.Millisecond
+	engine.completeLaunchHook(ctx)
+	assert.False(t, engine.launchHookCompleted)
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const leakCheckIterations = 100
+
+// assertNoGoroutineLeak runs fn repeatedly, as the supervision loop would over
+// the life of an instance, and fails if goroutines accumulate
+func assertNoGoroutineLeak(t *testing.T, fn func()) {
+	fn()
+	before := runtime.NumGoroutine()
+	for i := 0; i < leakCheckIterations; i++ {
+		fn()
+	}
+	// allow goroutines that are exiting to be scheduled
+	after := runtime.NumGoroutine()
+	for retries := 0; after > before && retries < 10; retries++ {
+		time.Sleep(10 * time.Millisecond)
+		after = runtime.NumGoroutine()
+	}
+	assert.True(t, after <= before, "Expect no goroutines to leak, had %d, now %d", before, after)
+}
+
+func TestStandbyPreloadDoesNotLeakGoroutines(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.StandbyPreloadEnvVar, "true")
+	defer os.Unsetenv(config.StandbyPreloadEnvVar)
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().StandbyAgentFile().Return("", os.ErrNotExist).AnyTimes()
+
+	engine := &Engine{
+		downloader: mockDownloader,
+	}
+	assertNoGoroutineLeak(t, func() {
+		engine.startStandbyPreload(context.Background())()
+	})
+}
+
+func TestMemoryReportDoesNotLeakGoroutines(t *testing.T) {
+	assertNoGoroutineLeak(t, func() {
+		startMemoryReport(clock.Real)()
+	})
+}
+
+func TestResidentSetSize(t *testing.T) {
+	rss, err := residentSetSize()
+	assert.NoError(t, err)
+	assert.NotZero(t, rss)
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/metrics"
+
+	log "github.com/cihub/seelog"
+)
+
+// logCheckInterval is how often the logs are measured while they are
+// supervised
+const logCheckInterval = 5 * time.Minute
+
+// logSupervisor tracks the size of the logs and the usage of their volume
+// across checks
+type logSupervisor struct {
+	docker     dockerClient
+	volume     logVolume
+	clock      clock.Clock
+	policy     string
+	maxBytes   int64
+	threshold  float64
+	oversized  bool
+	volumeFull bool
+}
+
+// startLogSupervision measures the logs of ecs-init and of the Agent
+// container in the background while the Agent is supervised, and reports or
+// trims them once they take more than their maximum size, so that they
+// cannot fill the root volume. Crossing the usage threshold of the volume
+// holding the logs is reported as well. The returned function stops the
+// supervision.
+func (e *Engine) startLogSupervision(ctx context.Context) func() {
+	policy, err := config.LogSupervision()
+	if err != nil {
+		log.Warnf("Not supervising the logs: %v", err)
+		return func() {}
+	}
+	if policy == "" || e.logVolume == nil {
+		return func() {}
+	}
+	maxBytes, err := config.LogMaxSize()
+	if err != nil {
+		log.Warnf("Not supervising the logs: %v", err)
+		return func() {}
+	}
+	threshold, err := config.LogVolumeThreshold()
+	if err != nil {
+		log.Warnf("Not supervising the logs: %v", err)
+		return func() {}
+	}
+	log.Infof("Supervising the logs (%s over %d MiB, reporting volume usage over %.0f%%)",
+		policy, maxBytes/1024/1024, threshold*100)
+	supervisor := &logSupervisor{
+		docker:    e.docker,
+		volume:    e.logVolume,
+		clock:     e.clk(),
+		policy:    policy,
+		maxBytes:  maxBytes,
+		threshold: threshold,
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := supervisor.clock.NewTicker(logCheckInterval)
+		defer ticker.Stop()
+		for {
+			supervisor.check(ctx)
+			select {
+			case <-ticker.C():
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// check measures the logs, trims them when the policy allows it and reports
+// the logs and the volume when they cross their limits
+func (s *logSupervisor) check(ctx context.Context) {
+	agentLog, err := s.docker.AgentLogPath(ctx)
+	if err != nil {
+		// the Agent container may be between restarts
+		log.Debugf("Could not find the log file of the Agent container: %v", err)
+	}
+	usage, err := s.volume.Usage(agentLog)
+	if err != nil {
+		log.Warnf("Could not measure the logs: %v", err)
+		return
+	}
+	if usage.LogBytes > s.maxBytes && s.policy == config.LogSupervisionTrim {
+		s.trim(agentLog)
+		usage, err = s.volume.Usage(agentLog)
+		if err != nil {
+			log.Warnf("Could not measure the trimmed logs: %v", err)
+			return
+		}
+	}
+	metrics.LogBytes.Set(float64(usage.LogBytes))
+	metrics.LogVolumeUsage.Set(usage.VolumeUsed)
+
+	oversized := usage.LogBytes > s.maxBytes
+	if oversized && !s.oversized {
+		log.Warnf("Logs take %d MiB, more than their maximum of %d MiB", usage.LogBytes/1024/1024, s.maxBytes/1024/1024)
+	} else if !oversized && s.oversized {
+		log.Infof("Logs take %d MiB again, within their maximum of %d MiB", usage.LogBytes/1024/1024, s.maxBytes/1024/1024)
+	}
+	s.oversized = oversized
+
+	volumeFull := usage.VolumeUsed >= s.threshold
+	if volumeFull && !s.volumeFull {
+		log.Errorf("The volume holding the logs is %.0f%% used, over the threshold of %.0f%%",
+			usage.VolumeUsed*100, s.threshold*100)
+		metrics.LogVolumeAlerts.Inc()
+	} else if !volumeFull && s.volumeFull {
+		log.Infof("The volume holding the logs is %.0f%% used again, under the threshold of %.0f%%",
+			usage.VolumeUsed*100, s.threshold*100)
+	}
+	s.volumeFull = volumeFull
+}
+
+// trim removes the oldest rotated logs until the logs take at most their
+// maximum size
+func (s *logSupervisor) trim(agentLog string) {
+	excess, err := s.volume.Excess(agentLog, s.maxBytes)
+	if err != nil {
+		log.Warnf("Could not find the logs to trim: %v", err)
+		return
+	}
+	for _, file := range excess {
+		err := s.volume.Remove(file)
+		if err != nil {
+			log.Warnf("Could not remove log %s: %v", file, err)
+			continue
+		}
+		log.Infof("Removed rotated log %s to keep the logs under %d MiB", file, s.maxBytes/1024/1024)
+		metrics.LogFilesRemoved.Inc()
+	}
+}
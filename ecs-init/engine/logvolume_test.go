@@ -0,0 +1,181 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/logvolume"
+	"github.com/aws/amazon-ecs-init/ecs-init/metrics"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAgentLog = "/var/lib/docker/containers/id/id-json.log"
+
+func newTestLogSupervisor(mockCtrl *gomock.Controller, policy string) (*logSupervisor, *MockdockerClient, *MocklogVolume) {
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockVolume := NewMocklogVolume(mockCtrl)
+	return &logSupervisor{
+		docker:    mockDocker,
+		volume:    mockVolume,
+		clock:     clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+		policy:    policy,
+		maxBytes:  100,
+		threshold: 0.9,
+	}, mockDocker, mockVolume
+}
+
+func TestLogSupervisorAlert(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	supervisor, mockDocker, mockVolume := newTestLogSupervisor(mockCtrl, config.LogSupervisionAlert)
+	gomock.InOrder(
+		mockDocker.EXPECT().AgentLogPath(gomock.Any()).Return(testAgentLog, nil),
+		mockVolume.EXPECT().Usage(testAgentLog).Return(logvolume.Usage{LogBytes: 150, VolumeUsed: 0.5}, nil),
+		mockDocker.EXPECT().AgentLogPath(gomock.Any()).Return(testAgentLog, nil),
+		mockVolume.EXPECT().Usage(testAgentLog).Return(logvolume.Usage{LogBytes: 50, VolumeUsed: 0.5}, nil),
+	)
+
+	supervisor.check(context.Background())
+	assert.True(t, supervisor.oversized)
+	assert.Equal(t, float64(150), metrics.LogBytes.Value())
+	supervisor.check(context.Background())
+	assert.False(t, supervisor.oversized)
+	assert.Equal(t, float64(50), metrics.LogBytes.Value())
+}
+
+func TestLogSupervisorTrim(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	supervisor, mockDocker, mockVolume := newTestLogSupervisor(mockCtrl, config.LogSupervisionTrim)
+	removed := metrics.LogFilesRemoved.Value()
+	gomock.InOrder(
+		mockDocker.EXPECT().AgentLogPath(gomock.Any()).Return(testAgentLog, nil),
+		mockVolume.EXPECT().Usage(testAgentLog).Return(logvolume.Usage{LogBytes: 150, VolumeUsed: 0.5}, nil),
+		mockVolume.EXPECT().Excess(testAgentLog, int64(100)).Return([]string{testAgentLog + ".1", "/var/log/ecs/ecs-agent.log.2020-01-01-00"}, nil),
+		mockVolume.EXPECT().Remove(testAgentLog+".1").Return(errors.New("test error")),
+		mockVolume.EXPECT().Remove("/var/log/ecs/ecs-agent.log.2020-01-01-00").Return(nil),
+		mockVolume.EXPECT().Usage(testAgentLog).Return(logvolume.Usage{LogBytes: 80, VolumeUsed: 0.4}, nil),
+	)
+
+	supervisor.check(context.Background())
+	assert.False(t, supervisor.oversized)
+	assert.Equal(t, removed+1, metrics.LogFilesRemoved.Value())
+	assert.Equal(t, float64(80), metrics.LogBytes.Value())
+}
+
+func TestLogSupervisorVolumeThreshold(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	supervisor, mockDocker, mockVolume := newTestLogSupervisor(mockCtrl, config.LogSupervisionAlert)
+	alerts := metrics.LogVolumeAlerts.Value()
+	mockDocker.EXPECT().AgentLogPath(gomock.Any()).Return("", errors.New("test error")).Times(4)
+	gomock.InOrder(
+		mockVolume.EXPECT().Usage("").Return(logvolume.Usage{LogBytes: 50, VolumeUsed: 0.95}, nil),
+		mockVolume.EXPECT().Usage("").Return(logvolume.Usage{LogBytes: 50, VolumeUsed: 0.96}, nil),
+		mockVolume.EXPECT().Usage("").Return(logvolume.Usage{LogBytes: 50, VolumeUsed: 0.5}, nil),
+		mockVolume.EXPECT().Usage("").Return(logvolume.Usage{LogBytes: 50, VolumeUsed: 0.9}, nil),
+	)
+
+	supervisor.check(context.Background())
+	assert.Equal(t, 0.95, metrics.LogVolumeUsage.Value())
+	// only crossing the threshold is reported
+	supervisor.check(context.Background())
+	assert.Equal(t, alerts+1, metrics.LogVolumeAlerts.Value())
+	supervisor.check(context.Background())
+	assert.False(t, supervisor.volumeFull)
+	supervisor.check(context.Background())
+	assert.Equal(t, alerts+2, metrics.LogVolumeAlerts.Value())
+}
+
+func TestLogSupervisorUsageError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	supervisor, mockDocker, mockVolume := newTestLogSupervisor(mockCtrl, config.LogSupervisionTrim)
+	gomock.InOrder(
+		mockDocker.EXPECT().AgentLogPath(gomock.Any()).Return(testAgentLog, nil),
+		mockVolume.EXPECT().Usage(testAgentLog).Return(logvolume.Usage{}, errors.New("test error")),
+	)
+
+	supervisor.check(context.Background())
+	assert.False(t, supervisor.oversized)
+}
+
+func TestStartLogSupervisionDisabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	engine := &Engine{
+		docker:    NewMockdockerClient(mockCtrl),
+		logVolume: NewMocklogVolume(mockCtrl),
+	}
+	stop := engine.startLogSupervision(context.Background())
+	stop()
+}
+
+func TestStartLogSupervisionInvalidMaxSize(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.LogSupervisionEnvVar, config.LogSupervisionTrim)
+	defer os.Unsetenv(config.LogSupervisionEnvVar)
+	os.Setenv(config.LogMaxSizeEnvVar, "lots")
+	defer os.Unsetenv(config.LogMaxSizeEnvVar)
+
+	engine := &Engine{
+		docker:    NewMockdockerClient(mockCtrl),
+		logVolume: NewMocklogVolume(mockCtrl),
+	}
+	stop := engine.startLogSupervision(context.Background())
+	stop()
+}
+
+func TestStartLogSupervision(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.LogSupervisionEnvVar, config.LogSupervisionAlert)
+	defer os.Unsetenv(config.LogSupervisionEnvVar)
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockVolume := NewMocklogVolume(mockCtrl)
+	checked := make(chan struct{})
+	gomock.InOrder(
+		mockDocker.EXPECT().AgentLogPath(gomock.Any()).Return(testAgentLog, nil),
+		mockVolume.EXPECT().Usage(testAgentLog).Do(func(string) {
+			close(checked)
+		}).Return(logvolume.Usage{}, nil),
+	)
+
+	engine := &Engine{
+		docker:    mockDocker,
+		logVolume: mockVolume,
+		clock:     clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	stop := engine.startLogSupervision(context.Background())
+	<-checked
+	stop()
+}
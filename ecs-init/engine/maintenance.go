@@ -0,0 +1,182 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/maintenance"
+	"github.com/aws/amazon-ecs-init/ecs-init/ssmclient"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maintenanceCheckInterval is how often a pending upgrade checks if a
+	// maintenance window opened
+	maintenanceCheckInterval = time.Minute
+	// allInstances lets every instance act as soon as a window opens
+	allInstances = 100
+)
+
+// maintenanceWindowOpen returns if the Agent may be restarted to upgrade it
+// at now. Invalid windows are ignored rather than holding upgrades back
+// indefinitely.
+func (e *Engine) maintenanceWindowOpen(now time.Time) bool {
+	schedule, err := maintenance.ParseSchedule(config.MaintenanceWindows())
+	if err != nil {
+		log.Warnf("Ignoring maintenance windows: %v", err)
+		return true
+	}
+	if len(schedule) == 0 {
+		return true
+	}
+	return schedule.OpenFor(now, maintenanceKey(), e.maintenanceConcurrency())
+}
+
+// maintenanceConcurrency returns the percentage of instances that may act
+// at once in a maintenance window, as read from the SSM parameter
+func (e *Engine) maintenanceConcurrency() int {
+	name := config.MaintenanceConcurrencyParameter()
+	if name == "" {
+		return allInstances
+	}
+	value, err := e.parameterValue(name)
+	if err != nil {
+		log.Warnf("Not staggering maintenance across instances: %v", err)
+		return allInstances
+	}
+	percent, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || percent < 1 || percent > allInstances {
+		log.Warnf("Not staggering maintenance across instances: invalid percentage %q in %s", value, name)
+		return allInstances
+	}
+	return percent
+}
+
+// maintenanceKey identifies the instance among the instances sharing the
+// maintenance windows
+func maintenanceKey() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Debugf("Could not get host name: %v", err)
+	}
+	return hostname
+}
+
+// parameterValue returns the value of an SSM parameter, creating the client
+// for the region of the instance on first use
+func (e *Engine) parameterValue(name string) (string, error) {
+	if e.parameterStore == nil {
+		region, err := e.downloader.Region()
+		if err != nil {
+			return "", errors.Wrap(err, "could not create SSM client")
+		}
+		client, err := ssmclient.New(region)
+		if err != nil {
+			return "", errors.Wrap(err, "could not create SSM client")
+		}
+		e.parameterStore = client
+	}
+	value, err := e.parameterStore.GetParameterValue(name)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not get SSM parameter %s", name)
+	}
+	return value, nil
+}
+
+// deferUpgrade returns true when the upgrade requested by the Agent has to
+// wait for the next maintenance window. The current Agent is restarted in
+// the meantime and stopped again once the window opens.
+func (e *Engine) deferUpgrade() bool {
+	now := e.clk().Now()
+	if e.maintenanceWindowOpen(now) {
+		e.upgradePending = false
+		return false
+	}
+	e.upgradePending = true
+	schedule, _ := maintenance.ParseSchedule(config.MaintenanceWindows())
+	if next, ok := schedule.Next(now); ok {
+		log.Infof("Deferring the Agent upgrade to the maintenance window starting at %s", next.Format(time.RFC3339))
+	} else {
+		log.Infof("Deferring the Agent upgrade to the next maintenance window")
+	}
+	return true
+}
+
+// startDeferredUpgrade stops the Agent once a maintenance window opens
+// while an upgrade is pending, so that the upgrade is applied when it
+// exits. The returned function stops waiting for the window.
+func (e *Engine) startDeferredUpgrade(ctx context.Context) func() {
+	if !e.upgradePending {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := e.clk().NewTicker(maintenanceCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				if e.applyPendingUpgrade(ctx) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// applyPendingUpgrade stops the Agent to upgrade it if a maintenance window
+// is open
+func (e *Engine) applyPendingUpgrade(ctx context.Context) bool {
+	if !e.maintenanceWindowOpen(e.clk().Now()) {
+		return false
+	}
+	if !e.protectUpgradeFromScaleIn() {
+		return false
+	}
+	log.Info("Maintenance window is open, stopping the Agent to apply the pending upgrade")
+	atomic.StoreInt32(&e.upgradeDue, 1)
+	err := e.docker.StopAgent(ctx)
+	if err != nil {
+		log.Warnf("Could not stop the Agent to upgrade it: %v", err)
+		atomic.StoreInt32(&e.upgradeDue, 0)
+		e.releaseScaleInProtection()
+		return false
+	}
+	return true
+}
+
+// takeDueUpgrade returns true once after the Agent was stopped to apply the
+// pending upgrade
+func (e *Engine) takeDueUpgrade() bool {
+	return atomic.CompareAndSwapInt32(&e.upgradeDue, 1, 0)
+}
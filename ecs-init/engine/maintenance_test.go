@@ -0,0 +1,159 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// neverOpenWindow is a valid window that never starts
+const neverOpenWindow = "0 0 30 2 * 1h"
+
+const testConcurrencyParameter = "/ecs/maintenance-concurrency"
+
+func TestMaintenanceWindowOpenWithoutWindows(t *testing.T) {
+	os.Unsetenv(config.MaintenanceWindowsEnvVar)
+	engine := &Engine{}
+	assert.True(t, engine.maintenanceWindowOpen(time.Now()))
+}
+
+func TestMaintenanceWindowOpenIgnoresInvalidWindows(t *testing.T) {
+	os.Setenv(config.MaintenanceWindowsEnvVar, "every sunday")
+	defer os.Unsetenv(config.MaintenanceWindowsEnvVar)
+
+	engine := &Engine{}
+	assert.True(t, engine.maintenanceWindowOpen(time.Now()))
+}
+
+func TestMaintenanceWindowClosed(t *testing.T) {
+	os.Setenv(config.MaintenanceWindowsEnvVar, neverOpenWindow)
+	defer os.Unsetenv(config.MaintenanceWindowsEnvVar)
+
+	engine := &Engine{}
+	assert.False(t, engine.maintenanceWindowOpen(time.Now()))
+}
+
+func TestMaintenanceConcurrency(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.MaintenanceConcurrencyParameterEnvVar, testConcurrencyParameter)
+	defer os.Unsetenv(config.MaintenanceConcurrencyParameterEnvVar)
+
+	mockParameterStore := NewMockparameterStore(mockCtrl)
+	gomock.InOrder(
+		mockParameterStore.EXPECT().GetParameterValue(testConcurrencyParameter).Return("25\n", nil),
+		mockParameterStore.EXPECT().GetParameterValue(testConcurrencyParameter).Return("0", nil),
+		mockParameterStore.EXPECT().GetParameterValue(testConcurrencyParameter).Return("", errors.New("test error")),
+	)
+
+	engine := &Engine{parameterStore: mockParameterStore}
+	assert.Equal(t, 25, engine.maintenanceConcurrency())
+	assert.Equal(t, allInstances, engine.maintenanceConcurrency(), "Expect invalid percentages to be ignored")
+	assert.Equal(t, allInstances, engine.maintenanceConcurrency(), "Expect errors to be ignored")
+}
+
+func TestMaintenanceConcurrencyWithoutParameter(t *testing.T) {
+	os.Unsetenv(config.MaintenanceConcurrencyParameterEnvVar)
+	engine := &Engine{}
+	assert.Equal(t, allInstances, engine.maintenanceConcurrency())
+}
+
+func TestApplyPendingUpgrade(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Unsetenv(config.MaintenanceWindowsEnvVar)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	gomock.InOrder(
+		mockDocker.EXPECT().StopAgent(gomock.Any()).Return(errors.New("test error")),
+		mockDocker.EXPECT().StopAgent(gomock.Any()),
+	)
+
+	engine := &Engine{docker: mockDocker, upgradePending: true}
+	assert.False(t, engine.applyPendingUpgrade(context.Background()))
+	assert.False(t, engine.takeDueUpgrade(), "Expect no upgrade when the Agent was not stopped")
+	assert.True(t, engine.applyPendingUpgrade(context.Background()))
+	assert.True(t, engine.takeDueUpgrade())
+	assert.False(t, engine.takeDueUpgrade(), "Expect the upgrade to be taken once")
+}
+
+func TestStartSupervisedUpgradeOutsideMaintenanceWindow(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.MaintenanceWindowsEnvVar, neverOpenWindow)
+	defer os.Unsetenv(config.MaintenanceWindowsEnvVar)
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	engine := &Engine{
+		downloader: mockDownloader,
+		docker:     mockDocker,
+	}
+	gomock.InOrder(
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(upgradeAgentExitCode, nil),
+		// the current Agent is restarted without loading the desired image
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Do(func(context.Context) {
+			assert.True(t, engine.upgradePending)
+		}).Return(terminalSuccessAgentExitCode, nil),
+	)
+
+	assert.NoError(t, engine.StartSupervised(context.Background()))
+}
+
+func TestStartSupervisedAppliesPendingUpgrade(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Unsetenv(config.MaintenanceWindowsEnvVar)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	engine := &Engine{
+		downloader:     mockDownloader,
+		docker:         mockDocker,
+		upgradePending: true,
+	}
+	gomock.InOrder(
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Do(func(context.Context) {
+			// the window opened while the Agent was running
+			engine.applyPendingUpgrade(context.Background())
+		}).Return(terminalSuccessAgentExitCode, nil),
+		mockDocker.EXPECT().StopAgent(gomock.Any()),
+		mockDownloader.EXPECT().LoadDesiredAgent().Return(&os.File{}, nil),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any()),
+		mockDownloader.EXPECT().RecordCachedAgent(),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+		mockDocker.EXPECT().StartAgent(gomock.Any()).Return(terminalSuccessAgentExitCode, nil),
+	)
+
+	assert.NoError(t, engine.StartSupervised(context.Background()))
+	assert.False(t, engine.upgradePending)
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// memoryReportInterval is how often the memory used by ecs-init is
+	// logged while it supervises the Agent
+	memoryReportInterval = time.Hour
+	// statmFile reports the memory used by the process in pages
+	statmFile = "/proc/self/statm"
+)
+
+// startMemoryReport logs the memory used by ecs-init periodically, so that
+// growth over the life of the instance can be spotted in its logs. The
+// returned function stops the reporting.
+func startMemoryReport(clock clock.Clock) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := clock.NewTicker(memoryReportInterval)
+		defer ticker.Stop()
+		for {
+			logMemoryUsage()
+			select {
+			case <-ticker.C():
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+func logMemoryUsage() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	rss, err := residentSetSize()
+	if err != nil {
+		log.Debugf("Could not read resident set size: %v", err)
+	}
+	log.Infof("Memory usage: %dKiB resident, %dKiB of heap, %dKiB obtained from the system, %d goroutines",
+		rss/1024, stats.HeapAlloc/1024, stats.Sys/1024, runtime.NumGoroutine())
+}
+
+// residentSetSize returns the resident set size of ecs-init in bytes
+func residentSetSize() (uint64, error) {
+	data, err := ioutil.ReadFile(statmFile)
+	if err != nil {
+		return 0, err
+	}
+	var size, resident uint64
+	_, err = fmt.Sscanf(string(data), "%d %d", &size, &resident)
+	if err != nil {
+		return 0, err
+	}
+	return resident * uint64(os.Getpagesize()), nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/metrics"
+
+	log "github.com/cihub/seelog"
+)
+
+// startMetrics serves the metrics of ecs-init for as long as the Agent is
+// supervised, if a metrics address is configured. The returned function
+// stops serving them.
+func (e *Engine) startMetrics() func() {
+	if e.metricsServer == nil {
+		return func() {}
+	}
+	address, _ := config.MetricsAddress()
+	err := e.metricsServer.Start()
+	if err != nil {
+		// metrics are only observability, so the Agent is supervised without
+		log.Errorf("Could not serve metrics on %s: %v", address, err)
+		return func() {}
+	}
+	log.Infof("Serving metrics on http://%s%s", address, metrics.Path)
+	return func() {
+		err := e.metricsServer.Stop()
+		if err != nil {
+			log.Warnf("Could not stop serving metrics: %v", err)
+		}
+	}
+}
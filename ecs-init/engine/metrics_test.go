@@ -0,0 +1,62 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/metrics"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartMetrics(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockServer := NewMockmetricsServer(mockCtrl)
+	gomock.InOrder(
+		mockServer.EXPECT().Start().Return(nil),
+		mockServer.EXPECT().Stop().Return(nil),
+	)
+
+	engine := &Engine{metricsServer: mockServer}
+	stop := engine.startMetrics()
+	stop()
+}
+
+func TestStartMetricsError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockServer := NewMockmetricsServer(mockCtrl)
+	mockServer.EXPECT().Start().Return(errors.New("test error"))
+
+	engine := &Engine{metricsServer: mockServer}
+	stop := engine.startMetrics()
+	// nothing to stop when the metrics could not be served
+	stop()
+}
+
+func TestStartMetricsNotConfigured(t *testing.T) {
+	engine := &Engine{}
+	engine.startMetrics()()
+}
+
+func TestTransitionSetsSupervisionState(t *testing.T) {
+	engine := &Engine{}
+	engine.transition(StateStarting)
+	assert.Equal(t, StateStarting.String(), metrics.SupervisionState.Current())
+}
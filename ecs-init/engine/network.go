@@ -0,0 +1,101 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// GCNetwork deletes the network namespaces, veth interfaces and routing rules
+// left behind by tasks. With dryRun they are only logged.
+func (e *Engine) GCNetwork(ctx context.Context, dryRun bool) error {
+	failed, err := e.collectNetworkGarbage(ctx, !dryRun)
+	if err != nil {
+		return engineError("could not find leaked task networking", err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not clean up %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// collectNetworkGarbage finds the networking of tasks that is no longer
+// used, and deletes it when remove is set. Namespaces are deleted first, as
+// that also deletes the veth interfaces with a peer inside, and routing
+// rules last, once the routes of the deleted interfaces are gone. It
+// returns what could not be deleted. Deleting stops with the error of ctx
+// once ctx is done.
+func (e *Engine) collectNetworkGarbage(ctx context.Context, remove bool) ([]string, error) {
+	var failed []string
+	namespaces, err := e.hostNetwork.LeakedNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range namespaces {
+		if ctx.Err() != nil {
+			return failed, ctx.Err()
+		}
+		name := name
+		failed = deleteLeaked("network namespace", name, remove, failed, func() error {
+			return e.hostNetwork.DeleteNamespace(name)
+		})
+	}
+	veths, err := e.hostNetwork.LeakedVeths()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range veths {
+		if ctx.Err() != nil {
+			return failed, ctx.Err()
+		}
+		name := name
+		failed = deleteLeaked("veth interface", name, remove, failed, func() error {
+			return e.hostNetwork.DeleteVeth(name)
+		})
+	}
+	rules, err := e.hostNetwork.LeakedRules()
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if ctx.Err() != nil {
+			return failed, ctx.Err()
+		}
+		rule := rule
+		failed = deleteLeaked("routing rule", rule.String(), remove, failed, func() error {
+			return e.hostNetwork.DeleteRule(rule)
+		})
+	}
+	return failed, nil
+}
+
+// deleteLeaked logs the leaked resource and deletes it when remove is set,
+// appending it to failed if it could not be deleted
+func deleteLeaked(kind, name string, remove bool, failed []string, delete func() error) []string {
+	if !remove {
+		log.Warnf("Found leaked %s %s", kind, name)
+		return failed
+	}
+	log.Infof("Deleting leaked %s %s", kind, name)
+	err := delete()
+	if err != nil {
+		log.Errorf("Could not delete %s %s: %v", kind, name, err)
+		return append(failed, kind+" "+name)
+	}
+	return failed
+}
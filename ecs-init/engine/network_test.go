@@ -0,0 +1,106 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/netns"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+var leakedRule = netns.Rule{Priority: 100, Selector: "from 10.0.1.5", Table: 101}
+
+func expectLeakedNetwork(mockNetwork *MockhostNetwork) {
+	mockNetwork.EXPECT().LeakedNamespaces().Return([]string{"task-1"}, nil)
+	mockNetwork.EXPECT().LeakedVeths().Return([]string{"veth1"}, nil)
+	mockNetwork.EXPECT().LeakedRules().Return([]netns.Rule{leakedRule}, nil)
+}
+
+func TestGCNetworkDryRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockNetwork := NewMockhostNetwork(mockCtrl)
+	expectLeakedNetwork(mockNetwork)
+
+	engine := &Engine{hostNetwork: mockNetwork}
+	assert.NoError(t, engine.GCNetwork(context.Background(), true))
+}
+
+func TestGCNetwork(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockNetwork := NewMockhostNetwork(mockCtrl)
+	gomock.InOrder(
+		mockNetwork.EXPECT().LeakedNamespaces().Return([]string{"task-1"}, nil),
+		mockNetwork.EXPECT().DeleteNamespace("task-1"),
+		mockNetwork.EXPECT().LeakedVeths().Return([]string{"veth1"}, nil),
+		mockNetwork.EXPECT().DeleteVeth("veth1"),
+		mockNetwork.EXPECT().LeakedRules().Return([]netns.Rule{leakedRule}, nil),
+		mockNetwork.EXPECT().DeleteRule(leakedRule),
+	)
+
+	engine := &Engine{hostNetwork: mockNetwork}
+	assert.NoError(t, engine.GCNetwork(context.Background(), false))
+}
+
+func TestGCNetworkCanceled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mockNetwork := NewMockhostNetwork(mockCtrl)
+	gomock.InOrder(
+		mockNetwork.EXPECT().LeakedNamespaces().Return([]string{"task-1", "task-2"}, nil),
+		mockNetwork.EXPECT().DeleteNamespace("task-1").Do(func(string) { cancel() }),
+	)
+
+	engine := &Engine{hostNetwork: mockNetwork}
+	err := engine.GCNetwork(ctx, false)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestGCNetworkDeleteErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockNetwork := NewMockhostNetwork(mockCtrl)
+	expectLeakedNetwork(mockNetwork)
+	mockNetwork.EXPECT().DeleteNamespace("task-1")
+	mockNetwork.EXPECT().DeleteVeth("veth1").Return(errors.New("test error"))
+	mockNetwork.EXPECT().DeleteRule(leakedRule).Return(errors.New("test error"))
+
+	engine := &Engine{hostNetwork: mockNetwork}
+	err := engine.GCNetwork(context.Background(), false)
+	assert.EqualError(t, err,
+		"could not clean up veth interface veth1, routing rule 100: from 10.0.1.5 lookup 101")
+}
+
+func TestGCNetworkListError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockNetwork := NewMockhostNetwork(mockCtrl)
+	mockNetwork.EXPECT().LeakedNamespaces().Return(nil, nil)
+	mockNetwork.EXPECT().LeakedVeths().Return(nil, errors.New("test error"))
+
+	engine := &Engine{hostNetwork: mockNetwork}
+	assert.Error(t, engine.GCNetwork(context.Background(), false))
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+// ErrPauseImageMismatch is returned when the pause container image the Agent
+// expects is not loaded into Docker
+var ErrPauseImageMismatch = errors.New("the pause container image expected by the Agent is not loaded")
+
+// pauseImages are the pause container image the Agent expects and the pause
+// container images loaded into Docker
+type pauseImages struct {
+	expected string
+	loaded   []string
+}
+
+// matched returns whether the pause container image the Agent expects is
+// loaded
+func (p *pauseImages) matched() bool {
+	for _, image := range p.loaded {
+		if image == p.expected {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) pauseImages(ctx context.Context) (*pauseImages, error) {
+	expected, err := e.docker.ExpectedPauseImage(ctx)
+	if err != nil {
+		return nil, engineError("could not get the pause container image expected by the Agent", err)
+	}
+	loaded, err := e.docker.LoadedPauseImages(ctx)
+	if err != nil {
+		return nil, engineError("could not list the pause container images", err)
+	}
+	return &pauseImages{expected: expected, loaded: loaded}, nil
+}
+
+// VerifyPauseImage writes the pause container image the Agent expects and
+// the pause container images loaded into Docker, and returns
+// ErrPauseImageMismatch when the expected image is not loaded
+func (e *Engine) VerifyPauseImage(ctx context.Context, w io.Writer) error {
+	images, err := e.pauseImages(ctx)
+	if err != nil {
+		return err
+	}
+	loaded := "none"
+	if len(images.loaded) > 0 {
+		loaded = strings.Join(images.loaded, ", ")
+	}
+	fmt.Fprintf(w, "Expected pause image: %s\n", images.expected)
+	fmt.Fprintf(w, "Loaded pause images: %s\n", loaded)
+	if !images.matched() {
+		return fmt.Errorf("%w: %s", ErrPauseImageMismatch, images.expected)
+	}
+	return nil
+}
+
+// LoadPauseImage loads the pause container image tarball into Docker
+func (e *Engine) LoadPauseImage(ctx context.Context) error {
+	tarball := config.PauseImageTarball()
+	if e.dryRun {
+		log.Infof("Dry run: would load the pause container image %s into Docker", tarball)
+		return nil
+	}
+	image, err := os.Open(tarball)
+	if err != nil {
+		return engineError("could not open the pause container image", err)
+	}
+	defer image.Close()
+	log.Infof("Loading the pause container image %s into Docker", tarball)
+	err = e.docker.LoadImage(ctx, image)
+	if err != nil {
+		return engineError("could not load the pause container image into Docker", err)
+	}
+	return nil
+}
+
+// CleanPauseImages removes the pause container images loaded into Docker
+// other than the one the Agent expects. Images still used by containers are
+// kept.
+func (e *Engine) CleanPauseImages(ctx context.Context) error {
+	images, err := e.pauseImages(ctx)
+	if err != nil {
+		return err
+	}
+	for _, image := range images.loaded {
+		if image == images.expected {
+			continue
+		}
+		err := e.docker.RemoveImage(ctx, image)
+		if err != nil {
+			log.Warnf("Could not remove the pause container image %s: %v", image, err)
+			continue
+		}
+		log.Infof("Removed the pause container image %s", image)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyPauseImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().ExpectedPauseImage(gomock.Any()).Return("amazon/amazon-ecs-pause:0.1.0", nil)
+	mockDocker.EXPECT().LoadedPauseImages(gomock.Any()).Return([]string{"amazon/amazon-ecs-pause:0.1.0"}, nil)
+
+	engine := &Engine{docker: mockDocker}
+	var out bytes.Buffer
+	err := engine.VerifyPauseImage(context.Background(), &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "Expected pause image: amazon/amazon-ecs-pause:0.1.0\n"+
+		"Loaded pause images: amazon/amazon-ecs-pause:0.1.0\n", out.String())
+}
+
+func TestVerifyPauseImageMismatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().ExpectedPauseImage(gomock.Any()).Return("amazon/amazon-ecs-pause:0.2.0", nil)
+	mockDocker.EXPECT().LoadedPauseImages(gomock.Any()).Return(nil, nil)
+
+	engine := &Engine{docker: mockDocker}
+	var out bytes.Buffer
+	err := engine.VerifyPauseImage(context.Background(), &out)
+	assert.True(t, errors.Is(err, ErrPauseImageMismatch))
+	assert.Contains(t, out.String(), "Loaded pause images: none\n")
+}
+
+func TestVerifyPauseImageNoAgentImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().ExpectedPauseImage(gomock.Any()).Return("", errors.New("no such image"))
+
+	engine := &Engine{docker: mockDocker}
+	err := engine.VerifyPauseImage(context.Background(), &bytes.Buffer{})
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrPauseImageMismatch))
+}
+
+func TestCleanPauseImages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().ExpectedPauseImage(gomock.Any()).Return("amazon/amazon-ecs-pause:0.2.0", nil)
+	mockDocker.EXPECT().LoadedPauseImages(gomock.Any()).Return([]string{
+		"amazon/amazon-ecs-pause:0.1.0",
+		"amazon/amazon-ecs-pause:0.1.1",
+		"amazon/amazon-ecs-pause:0.2.0",
+	}, nil)
+	mockDocker.EXPECT().RemoveImage(gomock.Any(), "amazon/amazon-ecs-pause:0.1.0").Return(errors.New("in use"))
+	mockDocker.EXPECT().RemoveImage(gomock.Any(), "amazon/amazon-ecs-pause:0.1.1").Return(nil)
+
+	engine := &Engine{docker: mockDocker}
+	assert.NoError(t, engine.CleanPauseImages(context.Background()))
+}
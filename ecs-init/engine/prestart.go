@@ -0,0 +1,665 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+	"github.com/aws/amazon-ecs-init/ecs-init/efa"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec/apparmor"
+	"github.com/aws/amazon-ecs-init/ecs-init/neuron"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	prestartRetryMinDelay   = time.Millisecond * 500
+	prestartRetryMaxDelay   = time.Second * 10
+	prestartRetryJitter     = 0.10
+	prestartRetryMultiplier = 2.0
+	// prestartNetworkRetries is how many times steps that call remote
+	// services or wait for devices are retried
+	prestartNetworkRetries = 2
+	// prestartPersistenceRetries is how many times starting the NVIDIA
+	// persistence daemon is retried, about 15s with the backoff of the
+	// retries, as it can take a while to open the GPUs of large instances on
+	// their first boot
+	prestartPersistenceRetries = 5
+	prestartMarkerPerm         = 0644
+	prestartMarkerDirPerm      = 0755
+)
+
+// neuronDevices detects the Neuron devices of the instance
+var neuronDevices = neuron.Devices
+
+// efaDevices detects the EFA devices of the instance
+var efaDevices = efa.Devices
+
+// appArmorEnabled detects if the kernel confines processes with AppArmor
+var appArmorEnabled = apparmor.Enabled
+
+// StepError is the error of the pre-start step that failed
+type StepError struct {
+	// Step is the name of the step
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("pre-start step %s failed: %s", e.Step, e.Err.Error())
+}
+
+// Unwrap returns the error of the step so that callers can check its class
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// prestartStep is a node of the pre-start dependency graph
+type prestartStep struct {
+	name string
+	// after names the steps that have to succeed before the step runs
+	after []string
+	// retries is how many times the step is retried before pre-start fails
+	retries int
+	// idempotent steps are marked once they succeed, so that they are not
+	// redone when pre-start is run again after a later step failed
+	idempotent bool
+	// network steps need network access, and fail in offline mode
+	network bool
+	run     func() error
+}
+
+// prestartSteps returns the steps preparing the instance for the Agent
+// configured with envVariables
+func (e *Engine) prestartSteps(ctx context.Context, envVariables map[string]string) []prestartStep {
+	var steps []prestartStep
+	if e.bootIDFile != "" {
+		steps = append(steps, prestartStep{
+			name: "boot",
+			run: func() error {
+				// the boots are tracked on a best effort basis
+				err := e.trackBoot()
+				if err != nil {
+					log.Warnf("Could not track the boot of the instance: %v", err)
+				}
+				return nil
+			},
+		})
+	}
+	if mode, ok := envVariables[config.UncleanShutdownCleanupEnvVar]; ok {
+		// the previous state must be read before this run records its own
+		steps = append(steps, prestartStep{
+			name:       "reconcile",
+			idempotent: true,
+			run: func() error {
+				err := e.reconcileUncleanShutdown(ctx, mode)
+				if err != nil {
+					return engineError("could not clean up after an unclean shutdown", err)
+				}
+				return nil
+			},
+		})
+	}
+	if envVariables[config.GPUSupportEnvVar] == "true" {
+		var gpuAfter []string
+		if e.nvidiaPersistence != nil {
+			// the GPUs of large instances are not initialized on their
+			// first boot until the persistence daemon opens them
+			steps = append(steps, prestartStep{
+				name:    "nvidia-persistenced",
+				retries: prestartPersistenceRetries,
+				run: func() error {
+					err := e.nvidiaPersistence.Ensure()
+					if err != nil {
+						return engineError("could not start the NVIDIA persistence daemon", err)
+					}
+					return nil
+				},
+			})
+			gpuAfter = []string{"nvidia-persistenced"}
+		}
+		steps = append(steps, prestartStep{
+			name:       "gpu",
+			after:      gpuAfter,
+			retries:    prestartNetworkRetries,
+			idempotent: true,
+			run: func() error {
+				err := e.nvidiaGPUManager.Setup()
+				if err != nil {
+					log.Errorf("Nvidia GPU Manager: %v", err)
+					return engineError("Nvidia GPU Manager", err)
+				}
+				return nil
+			},
+		})
+	}
+	if envVariables[config.NeuronSupportEnvVar] == "true" {
+		steps = append(steps, prestartStep{
+			name:       "neuron",
+			retries:    prestartNetworkRetries,
+			idempotent: true,
+			run: func() error {
+				// the devices are created once the driver is loaded
+				devices, err := neuronDevices()
+				if err != nil {
+					return engineError("could not detect the Neuron devices", err)
+				}
+				log.Infof("Neuron devices: %s", strings.Join(devices, ", "))
+				return nil
+			},
+		})
+	}
+	if envVariables[config.EFASupportEnvVar] == "true" {
+		steps = append(steps, prestartStep{
+			name:       "efa",
+			retries:    prestartNetworkRetries,
+			idempotent: true,
+			run: func() error {
+				// the devices are created once the driver is loaded
+				devices, err := efaDevices()
+				if err != nil {
+					return engineError("could not detect the EFA devices", err)
+				}
+				log.Infof("EFA devices: %s", strings.Join(devices, ", "))
+				return nil
+			},
+		})
+	}
+	if val, ok := envVariables[config.ReservedSystemMemoryEnvVar]; ok {
+		steps = append(steps, prestartStep{
+			name:       "memory-reservation",
+			idempotent: true,
+			run: func() error {
+				memoryMiB, err := strconv.ParseInt(val, 10, 64)
+				if err != nil {
+					return engineError("invalid memory reserved for system daemons", err)
+				}
+				err = e.hostReservation.Reserve(memoryMiB)
+				if err != nil {
+					return engineError("could not reserve memory for system daemons", err)
+				}
+				return nil
+			},
+		})
+	}
+	if envVariables[config.SysctlProfileEnvVar] == "true" {
+		steps = append(steps, prestartStep{
+			name:       "sysctls",
+			idempotent: true,
+			run: func() error {
+				err := e.sysctlProfile.Apply()
+				if err != nil {
+					return engineError("could not apply sysctl profile", err)
+				}
+				return nil
+			},
+		})
+	}
+	if mode, ok := envVariables[config.EFSUtilsEnvVar]; ok {
+		steps = append(steps, prestartStep{
+			name:       "efs-utils",
+			idempotent: true,
+			network:    mode == efsUtilsInstall,
+			run: func() error {
+				err := e.prepareEFSUtils(mode)
+				if err != nil {
+					return engineError("could not prepare the EFS mount helper", err)
+				}
+				return nil
+			},
+		})
+	}
+	if val, ok := envVariables[config.ReservedPortsEnvVar]; ok {
+		// ports are checked on every run as they can be taken at any time
+		steps = append(steps, prestartStep{
+			name: "reserved-ports",
+			run: func() error {
+				err := e.checkReservedPorts(val)
+				if err != nil {
+					return engineError("reserved host ports are in use", err)
+				}
+				return nil
+			},
+		})
+	}
+	if envVariables[config.EBSTaskAttachEnvVar] == "true" {
+		steps = append(steps, prestartStep{
+			name:       "ebs-task-attach",
+			idempotent: true,
+			run: func() error {
+				err := e.ebsTaskAttach.Prepare()
+				if err != nil {
+					return engineError("could not prepare the instance for EBS task attach", err)
+				}
+				return nil
+			},
+		})
+	}
+	if appArmorEnabled() && config.AppArmorProfile() == config.DefaultAppArmorProfile {
+		// the profile is reloaded on every run so that an updated ecs-init
+		// replaces the profile of the previous version
+		steps = append(steps, prestartStep{
+			name: "apparmor",
+			run: func() error {
+				err := e.appArmorProfile.Load()
+				if err != nil {
+					return engineError("could not load the AppArmor profile of the Agent container", err)
+				}
+				return nil
+			},
+		})
+	}
+	if envVariables[config.CreateClusterEnvVar] == "true" {
+		steps = append(steps, prestartStep{
+			name:       "cluster",
+			retries:    prestartNetworkRetries,
+			idempotent: true,
+			network:    true,
+			run: func() error {
+				err := e.ensureCluster(envVariables[config.ClusterEnvVar])
+				if err != nil {
+					return engineError("could not create the cluster", err)
+				}
+				return nil
+			},
+		})
+	}
+	if envVariables[config.FirelensPrerequisitesEnvVar] == "true" {
+		steps = append(steps, prestartStep{
+			name:       "firelens",
+			retries:    prestartNetworkRetries,
+			idempotent: true,
+			network:    true,
+			run: func() error {
+				err := e.prepareFirelens(ctx, envVariables)
+				if err != nil {
+					return engineError("could not prepare the instance for FireLens", err)
+				}
+				return nil
+			},
+		})
+	}
+	if envVariables[config.ExecPrerequisitesEnvVar] == "true" {
+		steps = append(steps, prestartStep{
+			name:       "exec",
+			retries:    prestartNetworkRetries,
+			idempotent: true,
+			network:    true,
+			run: func() error {
+				version := envVariables[config.ExecSSMAgentVersionEnvVar]
+				if version == "" {
+					version = config.DefaultExecSSMAgentVersion
+				}
+				region, err := e.downloader.Region()
+				if err != nil {
+					return engineError("could not prepare the instance for ECS Exec", err)
+				}
+				err = e.execPrerequisites.Prepare(ctx, region, version, e.offline)
+				if err != nil {
+					return engineError("could not prepare the instance for ECS Exec", err)
+				}
+				return nil
+			},
+		})
+	}
+	if network, _ := config.AgentNetwork(); network == config.AgentNetworkBridge {
+		steps = append(steps, prestartStep{
+			name: "agent-network",
+			run: func() error {
+				// the Agent sets up the network of awsvpc tasks from the
+				// network namespace of the host
+				if docker.TaskENIEnabled(envVariables) {
+					return fmt.Errorf("the Agent cannot run tasks in the awsvpc network mode on the %s network, "+
+						"set %s=false in the agent config or %s=%s", config.AgentNetworkBridge, config.TaskENIEnvVar,
+						config.AgentNetworkEnvVar, config.AgentNetworkHost)
+				}
+				return nil
+			},
+		})
+	}
+	if agentEgressRestricted() {
+		// the address ranges are read again on every run, as they change
+		// over time
+		steps = append(steps, prestartStep{
+			name:    "agent-egress",
+			retries: prestartNetworkRetries,
+			network: true,
+			run: func() error {
+				err := e.applyAgentEgress(ctx)
+				if err != nil {
+					return engineError("could not restrict the egress of the Agent", err)
+				}
+				return nil
+			},
+		})
+	}
+	// the credentials endpoint setup is undone by post-stop, which also runs
+	// after a failed pre-start, so it is never skipped
+	steps = append(steps, prestartStep{
+		name: "loopback-routing",
+		run: func() error {
+			// Enable use of loopback addresses for local routing purposes
+			err := e.loopbackRouting.Enable()
+			if err != nil {
+				return engineError("could not enable loopback routing", err)
+			}
+			return nil
+		},
+	}, prestartStep{
+		name:  "netrules",
+		after: []string{"loopback-routing"},
+		run: func() error {
+			// Add the rerouting netfilter rule for credentials endpoint
+			err := e.credentialsProxyRoute.Create()
+			if err != nil {
+				return engineError("could not create route to the credentials proxy", err)
+			}
+			return nil
+		},
+	})
+	return append(steps, e.agentImageSteps(ctx, envVariables)...)
+}
+
+// agentImageSteps returns the steps ensuring the desired Agent image is
+// cached and loaded into Docker
+func (e *Engine) agentImageSteps(ctx context.Context, envVariables map[string]string) []prestartStep {
+	if e.agentRegistry != "" {
+		return e.agentPullSteps(ctx, envVariables)
+	}
+	var download, reload, downloaded, streamed bool
+	return []prestartStep{
+		{
+			name: "cache",
+			run: func() error {
+				imageLoaded, err := e.docker.IsAgentImageLoaded(ctx)
+				if err != nil {
+					return engineError("could not check Docker for Agent image presence", err)
+				}
+				e.pinAgentVersion(envVariables)
+				e.pinCanaryAgent()
+				switch e.downloader.AgentCacheStatus() {
+				// Uncached, go get the Agent.
+				case cache.StatusUncached:
+					e.logReplacedAgent()
+					download = true
+				// The Agent is cached, and mandates a reload regardless of the
+				// already loaded image.
+				case cache.StatusReloadNeeded:
+					reload = true
+				// Agent is cached, respect the already loaded Agent.
+				case cache.StatusCached:
+					reload = !imageLoaded
+				// There shouldn't be unhandled cache states.
+				default:
+					return errors.New("could not handle cache state")
+				}
+				e.recordMilestone(milestoneCacheChecked)
+				return nil
+			},
+		},
+		{
+			// the downloader retries failed downloads following the
+			// download retry policy
+			name:  "download",
+			after: []string{"cache"},
+			run: func() error {
+				if !download || downloaded {
+					return nil
+				}
+				err := e.downloadPinnedAgent(ctx, &streamed)
+				if err != nil && e.abandonCanary(err) {
+					err = e.downloadPinnedAgent(ctx, &streamed)
+				}
+				if err != nil {
+					return err
+				}
+				downloaded = true
+				return nil
+			},
+		},
+		{
+			name:  "load",
+			after: []string{"download"},
+			run: func() error {
+				if streamed {
+					// the Agent was loaded while it was downloaded
+					return e.downloader.RecordCachedAgent()
+				}
+				if downloaded {
+					log.Info("Loading Amazon Elastic Container Service Agent into Docker")
+					err := e.load(ctx, e.downloader.LoadCachedAgent)
+					if err != nil {
+						return e.rollbackAgent(ctx, err)
+					}
+					return nil
+				}
+				if reload {
+					return e.load(ctx, e.downloader.LoadCachedAgent)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// downloadPinnedAgent downloads the pinned Agent, loading it into Docker
+// while it is downloaded with streaming loads, in which case streamed is set
+// to whether it was loaded
+func (e *Engine) downloadPinnedAgent(ctx context.Context, streamed *bool) error {
+	if e.streamingLoad {
+		loaded, err := e.streamAgent(ctx)
+		if err != nil {
+			return err
+		}
+		*streamed = loaded
+		return nil
+	}
+	return e.downloadAgent(ctx)
+}
+
+// logReplacedAgent logs the cached agent that is replaced by the agent to be
+// downloaded
+func (e *Engine) logReplacedAgent() {
+	cached := e.downloader.CachedAgent()
+	if cached.Version == "" {
+		return
+	}
+	if cached.Version == e.downloader.AgentVersion() {
+		log.Infof("Downloading cached agent %s again", cached)
+		return
+	}
+	log.Infof("Replacing cached agent %s with agent %s", cached, e.downloader.AgentVersion())
+}
+
+// runPrestartSteps runs steps in the order of their dependencies, stopping
+// at the first step that fails. Idempotent steps that succeeded in a previous
+// run with the same agent config, identified by fingerprint, are skipped.
+// The marks are cleared once all steps succeed. No step is started once ctx
+// is done.
+func (e *Engine) runPrestartSteps(ctx context.Context, steps []prestartStep, fingerprint string) error {
+	ordered, err := orderPrestartSteps(steps)
+	if err != nil {
+		return err
+	}
+	for _, step := range ordered {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if step.idempotent && e.prestartMarkers.done(step.name, fingerprint) {
+			log.Infof("Skipping pre-start step %s, it succeeded in a previous run", step.name)
+			continue
+		}
+		if step.network && e.offline {
+			err := fmt.Errorf("%w: pre-start step %s needs network access", cache.ErrOffline, step.name)
+			log.Errorf("Pre-start step %s failed: %v", step.name, err)
+			return &StepError{Step: step.name, Err: err}
+		}
+		err := runPrestartStep(ctx, step, e.clk())
+		if err != nil {
+			log.Errorf("Pre-start step %s failed: %v", step.name, err)
+			return &StepError{Step: step.name, Err: err}
+		}
+		if step.idempotent {
+			e.prestartMarkers.mark(step.name, fingerprint)
+		}
+	}
+	e.prestartMarkers.clear()
+	return nil
+}
+
+// runPrestartStep runs step until it succeeds, runs out of retries or ctx is
+// done
+func runPrestartStep(ctx context.Context, step prestartStep, clk clock.Clock) error {
+	retryBackoff := backoff.NewBackoff(prestartRetryMinDelay, prestartRetryMaxDelay,
+		prestartRetryJitter, prestartRetryMultiplier, step.retries)
+	for {
+		err := step.run()
+		// nothing changes in offline mode by retrying
+		if err == nil || errors.Is(err, cache.ErrOffline) || !retryBackoff.ShouldRetry() {
+			return err
+		}
+		d := retryBackoff.Duration()
+		log.Warnf("Pre-start step %s failed, retrying in %s: %v", step.name, d.String(), err)
+		if clock.SleepContext(ctx, clk, d) != nil {
+			return err
+		}
+	}
+}
+
+// orderPrestartSteps sorts steps so that each step comes after the steps it
+// depends on. Steps that do not depend on each other keep their order.
+func orderPrestartSteps(steps []prestartStep) ([]prestartStep, error) {
+	names := make(map[string]bool)
+	for _, step := range steps {
+		names[step.name] = true
+	}
+	for _, step := range steps {
+		for _, dependency := range step.after {
+			if !names[dependency] {
+				return nil, fmt.Errorf("pre-start step %s depends on unknown step %s", step.name, dependency)
+			}
+		}
+	}
+	ordered := make([]prestartStep, 0, len(steps))
+	placed := make(map[string]bool)
+	for len(ordered) < len(steps) {
+		progressed := false
+		for _, step := range steps {
+			if placed[step.name] || !dependenciesPlaced(step, placed) {
+				continue
+			}
+			ordered = append(ordered, step)
+			placed[step.name] = true
+			progressed = true
+			break
+		}
+		if !progressed {
+			return nil, errors.New("pre-start steps have a dependency cycle")
+		}
+	}
+	return ordered, nil
+}
+
+func dependenciesPlaced(step prestartStep, placed map[string]bool) bool {
+	for _, dependency := range step.after {
+		if !placed[dependency] {
+			return false
+		}
+	}
+	return true
+}
+
+// configFingerprint identifies the agent config pre-start steps ran with
+func configFingerprint(envVariables map[string]string) string {
+	keys := make([]string, 0, len(envVariables))
+	for key := range envVariables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%s\n", key, envVariables[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// stepMarkers records the pre-start steps that succeeded in files named
+// after the steps. The files are kept in a directory that does not survive
+// a reboot, as the steps have to be redone once the host restarts.
+type stepMarkers struct {
+	dir string
+	// dryRun logs the marks that would be written instead of writing them
+	dryRun bool
+}
+
+func newStepMarkers(dir string) *stepMarkers {
+	return &stepMarkers{dir: dir}
+}
+
+// done returns if the step succeeded with the agent config identified by
+// fingerprint
+func (m *stepMarkers) done(step, fingerprint string) bool {
+	if m == nil {
+		return false
+	}
+	data, err := ioutil.ReadFile(filepath.Join(m.dir, step))
+	return err == nil && string(data) == fingerprint
+}
+
+func (m *stepMarkers) mark(step, fingerprint string) {
+	if m == nil {
+		return
+	}
+	if m.dryRun {
+		log.Infof("Dry run: would mark pre-start step %s as done in %s", step, m.dir)
+		return
+	}
+	err := os.MkdirAll(m.dir, prestartMarkerDirPerm)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(m.dir, step), []byte(fingerprint), prestartMarkerPerm)
+	}
+	if err != nil {
+		log.Warnf("Could not mark pre-start step %s as done: %v", step, err)
+	}
+}
+
+func (m *stepMarkers) clear() {
+	if m == nil {
+		return
+	}
+	if m.dryRun {
+		log.Infof("Dry run: would clear the pre-start step marks in %s", m.dir)
+		return
+	}
+	err := os.RemoveAll(m.dir)
+	if err != nil {
+		log.Warnf("Could not clear the pre-start step marks: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFingerprint = "fingerprint"
+
+// recordingStep returns a step appending its name to run when it runs
+func recordingStep(name string, run *[]string, after ...string) prestartStep {
+	return prestartStep{
+		name:  name,
+		after: after,
+		run: func() error {
+			*run = append(*run, name)
+			return nil
+		},
+	}
+}
+
+func TestOrderPrestartSteps(t *testing.T) {
+	var run []string
+	steps := []prestartStep{
+		recordingStep("load", &run, "download"),
+		recordingStep("netrules", &run, "loopback-routing"),
+		recordingStep("download", &run, "cache"),
+		recordingStep("cache", &run),
+		recordingStep("loopback-routing", &run),
+	}
+	engine := &Engine{}
+	require.NoError(t, engine.runPrestartSteps(context.Background(), steps, testFingerprint))
+	assert.Equal(t, []string{"cache", "download", "load", "loopback-routing", "netrules"}, run)
+}
+
+func TestOrderPrestartStepsUnknownDependency(t *testing.T) {
+	_, err := orderPrestartSteps([]prestartStep{{name: "load", after: []string{"download"}}})
+	assert.Error(t, err)
+}
+
+func TestOrderPrestartStepsCycle(t *testing.T) {
+	_, err := orderPrestartSteps([]prestartStep{
+		{name: "cache", after: []string{"load"}},
+		{name: "load", after: []string{"cache"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestRunPrestartStepsReportsFailedStep(t *testing.T) {
+	var run []string
+	cause := errors.New("test error")
+	steps := []prestartStep{
+		recordingStep("gpu", &run),
+		{name: "cluster", run: func() error { return cause }},
+		recordingStep("netrules", &run),
+	}
+	engine := &Engine{}
+	err := engine.runPrestartSteps(context.Background(), steps, testFingerprint)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pre-start step cluster failed")
+	assert.True(t, errors.Is(err, cause))
+	var stepErr *StepError
+	require.True(t, errors.As(err, &stepErr))
+	assert.Equal(t, "cluster", stepErr.Step)
+	assert.Equal(t, []string{"gpu"}, run, "Expect no step to run after the failed step")
+}
+
+func TestRunPrestartStepRetries(t *testing.T) {
+	attempts := 0
+	step := prestartStep{
+		name:    "download",
+		retries: 1,
+		run: func() error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("test error")
+			}
+			return nil
+		},
+	}
+	fakeClock := clock.NewFake(time.Now())
+	result := make(chan error, 1)
+	go func() {
+		result <- runPrestartStep(context.Background(), step, fakeClock)
+	}()
+	// the retry waits for the backoff to elapse
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(prestartRetryMaxDelay)
+	assert.NoError(t, <-result)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestRunPrestartStepsOfflineFailsNetworkStep(t *testing.T) {
+	var run []string
+	steps := []prestartStep{
+		recordingStep("gpu", &run),
+		{name: "cluster", network: true, run: func() error {
+			t.Error("Expect no network step to run offline")
+			return nil
+		}},
+		recordingStep("netrules", &run),
+	}
+	engine := &Engine{offline: true}
+	err := engine.runPrestartSteps(context.Background(), steps, testFingerprint)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pre-start step cluster failed")
+	assert.True(t, errors.Is(err, cache.ErrOffline))
+	assert.Equal(t, []string{"gpu"}, run)
+}
+
+func TestRunPrestartStepOfflineNoRetry(t *testing.T) {
+	attempts := 0
+	step := prestartStep{
+		name:    "download",
+		retries: 1,
+		run: func() error {
+			attempts++
+			return fmt.Errorf("%w: test error", cache.ErrOffline)
+		},
+	}
+	err := runPrestartStep(context.Background(), step, clock.NewFake(time.Now()))
+	assert.True(t, errors.Is(err, cache.ErrOffline))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRunPrestartStepsSkipsMarkedSteps(t *testing.T) {
+	dir := t.TempDir()
+	markers := newStepMarkers(filepath.Join(dir, "prestart"))
+
+	var run []string
+	failing := true
+	steps := []prestartStep{
+		{name: "gpu", idempotent: true, run: func() error {
+			run = append(run, "gpu")
+			return nil
+		}},
+		recordingStep("loopback-routing", &run),
+		{name: "download", run: func() error {
+			run = append(run, "download")
+			if failing {
+				return errors.New("test error")
+			}
+			return nil
+		}},
+	}
+	engine := &Engine{prestartMarkers: markers}
+	assert.Error(t, engine.runPrestartSteps(context.Background(), steps, testFingerprint))
+	assert.True(t, markers.done("gpu", testFingerprint))
+
+	failing = false
+	run = nil
+	assert.NoError(t, engine.runPrestartSteps(context.Background(), steps, testFingerprint))
+	assert.Equal(t, []string{"loopback-routing", "download"}, run, "Expect the idempotent step not to be redone")
+	assert.False(t, markers.done("gpu", testFingerprint), "Expect marks to be cleared once pre-start succeeds")
+}
+
+func TestRunPrestartStepsRedoesStepsForChangedConfig(t *testing.T) {
+	dir := t.TempDir()
+	markers := newStepMarkers(dir)
+	markers.mark("gpu", configFingerprint(map[string]string{"ECS_ENABLE_GPU_SUPPORT": "true"}))
+
+	var run []string
+	steps := []prestartStep{{name: "gpu", idempotent: true, run: func() error {
+		run = append(run, "gpu")
+		return nil
+	}}}
+	engine := &Engine{prestartMarkers: markers}
+	fingerprint := configFingerprint(map[string]string{"ECS_ENABLE_GPU_SUPPORT": "true", "ECS_CLUSTER": "prod"})
+	assert.NoError(t, engine.runPrestartSteps(context.Background(), steps, fingerprint))
+	assert.Equal(t, []string{"gpu"}, run)
+}
+
+func TestRunPrestartStepsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	steps := []prestartStep{{
+		name: "step",
+		run: func() error {
+			t.Error("Expected no step to run once canceled")
+			return nil
+		},
+	}}
+	engine := &Engine{}
+	err := engine.runPrestartSteps(ctx, steps, testFingerprint)
+	assert.True(t, errors.Is(err, context.Canceled), "Expect the cancellation, got: %v", err)
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	uncleanShutdownReport = "report"
+	uncleanShutdownClean  = "clean"
+)
+
+// agentWasRunning returns if the engine was supervising the Agent when the
+// status file was last written. The state is Stopping once the Agent is
+// stopped cleanly.
+func agentWasRunning() bool {
+	previous, err := readStatus()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not read the previous engine status: %v", err)
+		}
+		return false
+	}
+	switch previous.State {
+	case StateStarting, StateHealthy, StateDegraded, StateUpgrading:
+		log.Warnf("The Agent did not stop cleanly, it was %s since %s", previous.State, previous.Since)
+		return true
+	}
+	return false
+}
+
+// reconcileUncleanShutdown finds what tasks left on the host when the Agent
+// did not stop cleanly. In the "report" mode leftovers are only logged, while
+// in the "clean" mode they are removed.
+func (e *Engine) reconcileUncleanShutdown(ctx context.Context, mode string) error {
+	if mode != uncleanShutdownReport && mode != uncleanShutdownClean {
+		return fmt.Errorf("unknown mode %q, expected %q or %q", mode, uncleanShutdownReport, uncleanShutdownClean)
+	}
+	if !agentWasRunning() {
+		return nil
+	}
+	return e.cleanupTaskLeftovers(ctx, mode == uncleanShutdownClean)
+}
+
+// cleanupTaskLeftovers reports, and removes when clean is set, the stopped
+// containers of tasks and the networking no task uses anymore. Running task
+// containers are left for the Agent to reconcile with its state. The IP
+// addresses allocated to awsvpc tasks are released once no task runs.
+func (e *Engine) cleanupTaskLeftovers(ctx context.Context, clean bool) error {
+	containers, err := e.docker.ListTaskContainers(ctx)
+	if err != nil {
+		return engineError("could not list task containers", err)
+	}
+	var failed []string
+	running := 0
+	for _, container := range containers {
+		if container.Running {
+			running++
+			continue
+		}
+		if !clean {
+			log.Warnf("Found stopped container %s of task %s", container.Name, container.TaskArn)
+			continue
+		}
+		log.Infof("Removing stopped container %s of task %s", container.Name, container.TaskArn)
+		err := e.docker.RemoveContainer(ctx, container.ID)
+		if err != nil {
+			log.Errorf("Could not remove container %s: %v", container.Name, err)
+			failed = append(failed, "container "+container.Name)
+		}
+	}
+	if running > 0 {
+		log.Infof("Leaving %d running task containers for the Agent to reconcile", running)
+	}
+
+	networkFailed, err := e.collectNetworkGarbage(ctx, clean)
+	if err != nil {
+		return engineError("could not find leaked task networking", err)
+	}
+	failed = append(failed, networkFailed...)
+
+	if running == 0 {
+		e.releaseTaskAddresses(clean)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not clean up %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// releaseTaskAddresses removes the allocations of the ecs-ipam CNI plugin,
+// which are stale when no task runs
+func (e *Engine) releaseTaskAddresses(clean bool) {
+	_, err := os.Stat(config.IPAMDatabase())
+	if err != nil {
+		return
+	}
+	if !clean {
+		log.Warnf("Found IP address allocations of tasks that are no longer running in %s", config.IPAMDatabase())
+		return
+	}
+	if e.dryRun {
+		log.Infof("Dry run: would remove %s", config.IPAMDatabase())
+		return
+	}
+	log.Infof("Removing IP address allocations of tasks that are no longer running from %s", config.IPAMDatabase())
+	err = os.Remove(config.IPAMDatabase())
+	if err != nil {
+		log.Errorf("Could not remove %s: %v", config.IPAMDatabase(), err)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func taskLeftovers() []docker.TaskContainer {
+	return []docker.TaskContainer{
+		{ID: "running", Name: "web", TaskArn: "task-1", Running: true},
+		{ID: "exited", Name: "worker", TaskArn: "task-2"},
+	}
+}
+
+func TestCleanupTaskLeftoversReport(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockNetwork := NewMockhostNetwork(mockCtrl)
+	mockDocker.EXPECT().ListTaskContainers(gomock.Any()).Return(taskLeftovers(), nil)
+	mockNetwork.EXPECT().LeakedNamespaces().Return([]string{"task-2"}, nil)
+	mockNetwork.EXPECT().LeakedVeths().Return(nil, nil)
+	mockNetwork.EXPECT().LeakedRules().Return(nil, nil)
+
+	engine := &Engine{
+		docker:      mockDocker,
+		hostNetwork: mockNetwork,
+	}
+	assert.NoError(t, engine.cleanupTaskLeftovers(context.Background(), false))
+}
+
+func TestCleanupTaskLeftoversClean(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockNetwork := NewMockhostNetwork(mockCtrl)
+	mockDocker.EXPECT().ListTaskContainers(gomock.Any()).Return(taskLeftovers(), nil)
+	mockDocker.EXPECT().RemoveContainer(gomock.Any(), "exited")
+	mockNetwork.EXPECT().LeakedNamespaces().Return([]string{"task-2"}, nil)
+	mockNetwork.EXPECT().DeleteNamespace("task-2")
+	mockNetwork.EXPECT().LeakedVeths().Return(nil, nil)
+	mockNetwork.EXPECT().LeakedRules().Return(nil, nil)
+
+	engine := &Engine{
+		docker:      mockDocker,
+		hostNetwork: mockNetwork,
+	}
+	assert.NoError(t, engine.cleanupTaskLeftovers(context.Background(), true))
+}
+
+func TestCleanupTaskLeftoversCleanErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockNetwork := NewMockhostNetwork(mockCtrl)
+	mockDocker.EXPECT().ListTaskContainers(gomock.Any()).Return(taskLeftovers(), nil)
+	mockDocker.EXPECT().RemoveContainer(gomock.Any(), "exited").Return(errors.New("test error"))
+	mockNetwork.EXPECT().LeakedNamespaces().Return([]string{"task-2", "task-3"}, nil)
+	mockNetwork.EXPECT().DeleteNamespace("task-2").Return(errors.New("test error"))
+	// a failure does not stop the rest of the cleanup
+	mockNetwork.EXPECT().DeleteNamespace("task-3")
+	mockNetwork.EXPECT().LeakedVeths().Return(nil, nil)
+	mockNetwork.EXPECT().LeakedRules().Return(nil, nil)
+
+	engine := &Engine{
+		docker:      mockDocker,
+		hostNetwork: mockNetwork,
+	}
+	err := engine.cleanupTaskLeftovers(context.Background(), true)
+	assert.EqualError(t, err, "could not clean up container worker, network namespace task-2")
+}
+
+func TestCleanupTaskLeftoversListError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().ListTaskContainers(gomock.Any()).Return(nil, errors.New("test error"))
+
+	engine := &Engine{docker: mockDocker}
+	assert.Error(t, engine.cleanupTaskLeftovers(context.Background(), true))
+}
+
+func TestReconcileUncleanShutdownInvalidMode(t *testing.T) {
+	engine := &Engine{}
+	assert.Error(t, engine.reconcileUncleanShutdown(context.Background(), "remove"))
+}
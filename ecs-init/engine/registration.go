@@ -0,0 +1,163 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsclient"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// defaultVerifyRegistrationTimeout is how long verify-registration waits
+	// for the registration when VerifyRegistrationEnvVar is not set
+	defaultVerifyRegistrationTimeout = 5 * time.Minute
+	registrationVerified             = "Verified"
+	registrationFailed               = "Failed"
+)
+
+// registrationPollInterval is how often the registration is checked until it
+// is verified
+var registrationPollInterval = 5 * time.Second
+
+// ErrNotRegistered is wrapped by errors returned when the Agent did not
+// register the instance into its cluster in time
+var ErrNotRegistered = errors.New("instance is not registered")
+
+// VerifyRegistration waits until the Agent has registered the instance into
+// the cluster named in the Agent config, and the Amazon ECS API reports the
+// instance as active and connected
+func (e *Engine) VerifyRegistration(ctx context.Context) error {
+	timeout, err := config.VerifyRegistrationTimeout()
+	if err != nil {
+		return err
+	}
+	if timeout == 0 {
+		timeout = defaultVerifyRegistrationTimeout
+	}
+	cluster := e.docker.LoadEnvVars()[config.ClusterEnvVar]
+	return e.verifyRegistration(ctx, cluster, timeout)
+}
+
+// startRegistrationCheck verifies the registration of the instance in the
+// background once the Agent is started, and records the outcome in the
+// status file. The registration of a clone of another instance, or of an
+// instance held by a launch lifecycle hook, is verified even when
+// verification is not enabled. The returned function cancels the
+// verification.
+func (e *Engine) startRegistrationCheck(ctx context.Context) func() {
+	timeout, err := config.VerifyRegistrationTimeout()
+	if err != nil {
+		log.Warnf("Not verifying the registration of the instance: %v", err)
+		return func() {}
+	}
+	if timeout == 0 {
+		if !e.cloneBoot() && config.LaunchLifecycleHook() == "" {
+			return func() {}
+		}
+		// an instance launched from an image of a registered host may
+		// have been taken for that host, and the launch lifecycle hook
+		// waits for the registration
+		timeout = defaultVerifyRegistrationTimeout
+	}
+	cluster := e.docker.LoadEnvVars()[config.ClusterEnvVar]
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := e.verifyRegistration(ctx, cluster, timeout)
+		switch {
+		case err == nil:
+			log.Info("Verified the registration of the instance")
+			e.recordRegistration(registrationVerified)
+			e.completeLaunchHook(ctx)
+		case errors.Is(err, ErrNotRegistered):
+			log.Errorf("%v", err)
+			e.recordRegistration(registrationFailed)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// verifyRegistration checks the registration until it is verified, timeout
+// elapses or ctx is done
+func (e *Engine) verifyRegistration(ctx context.Context, cluster string, timeout time.Duration) error {
+	if cluster == "" {
+		cluster = config.DefaultClusterName
+	}
+	deadline := e.clk().After(timeout)
+	ticker := e.clk().NewTicker(registrationPollInterval)
+	defer ticker.Stop()
+	for {
+		err := e.checkRegistration(cluster)
+		if err == nil {
+			return nil
+		}
+		log.Debugf("Registration not verified yet: %v", err)
+		select {
+		case <-ticker.C():
+		case <-deadline:
+			return fmt.Errorf("%w into cluster %s after %s: %v", ErrNotRegistered, cluster, timeout, err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// checkRegistration looks up the container instance registered by the Agent
+// in cluster
+func (e *Engine) checkRegistration(cluster string) error {
+	metadata, err := e.agentMetadata.Metadata()
+	if err != nil {
+		return err
+	}
+	if metadata.ContainerInstanceArn == "" {
+		return errors.New("the Agent has not registered the instance")
+	}
+	ecsAPI, err := e.ecsClient()
+	if err != nil {
+		return err
+	}
+	output, err := ecsAPI.DescribeContainerInstances(&ecsclient.DescribeContainerInstancesInput{
+		Cluster:            cluster,
+		ContainerInstances: []string{metadata.ContainerInstanceArn},
+	})
+	if err != nil {
+		return err
+	}
+	for _, instance := range output.ContainerInstances {
+		if instance.Status != ecsclient.ContainerInstanceStatusActive || !instance.AgentConnected {
+			return fmt.Errorf("container instance %s is %s and the Agent connected: %t",
+				instance.ContainerInstanceArn, instance.Status, instance.AgentConnected)
+		}
+		return nil
+	}
+	return fmt.Errorf("container instance %s is not registered", metadata.ContainerInstanceArn)
+}
+
+// recordRegistration records the outcome of the registration verification in
+// the status file
+func (e *Engine) recordRegistration(registration string) {
+	e.state.setRegistration(registration)
+	e.writeStatus()
+}
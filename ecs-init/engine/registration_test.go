@@ -0,0 +1,156 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/introspection"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func registeredMetadata() *introspection.Metadata {
+	return &introspection.Metadata{Cluster: "test", ContainerInstanceArn: "arn"}
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockAgentMetadata := NewMockagentMetadata(mockCtrl)
+	mockECSAPI := NewMockecsAPI(mockCtrl)
+	gomock.InOrder(
+		mockAgentMetadata.EXPECT().Metadata().Return(nil, errors.New("connection refused")),
+		mockAgentMetadata.EXPECT().Metadata().Return(&introspection.Metadata{}, nil),
+		mockAgentMetadata.EXPECT().Metadata().Return(registeredMetadata(), nil),
+		mockECSAPI.EXPECT().DescribeContainerInstances(&ecsclient.DescribeContainerInstancesInput{
+			Cluster:            "test",
+			ContainerInstances: []string{"arn"},
+		}).Return(&ecsclient.DescribeContainerInstancesOutput{
+			ContainerInstances: []ecsclient.ContainerInstance{{
+				ContainerInstanceArn: "arn",
+				AgentConnected:       true,
+				Status:               ecsclient.ContainerInstanceStatusActive,
+			}},
+		}, nil),
+	)
+
+	defer func(interval time.Duration) { registrationPollInterval = interval }(registrationPollInterval)
+	registrationPollInterval = time.Millisecond
+	engine := &Engine{
+		agentMetadata: mockAgentMetadata,
+		ecsAPI:        mockECSAPI,
+	}
+	assert.NoError(t, engine.verifyRegistration(context.Background(), "test", time.Minute))
+}
+
+func TestVerifyRegistrationTimeout(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockAgentMetadata := NewMockagentMetadata(mockCtrl)
+	mockECSAPI := NewMockecsAPI(mockCtrl)
+	mockAgentMetadata.EXPECT().Metadata().Return(registeredMetadata(), nil).MinTimes(1)
+	// the instance registered into another cluster
+	mockECSAPI.EXPECT().DescribeContainerInstances(gomock.Any()).Return(&ecsclient.DescribeContainerInstancesOutput{
+		Failures: []ecsclient.Failure{{Arn: "arn", Reason: "MISSING"}},
+	}, nil).MinTimes(1)
+
+	defer func(interval time.Duration) { registrationPollInterval = interval }(registrationPollInterval)
+	registrationPollInterval = time.Millisecond
+	engine := &Engine{
+		agentMetadata: mockAgentMetadata,
+		ecsAPI:        mockECSAPI,
+	}
+	err := engine.verifyRegistration(context.Background(), "", 10*time.Millisecond)
+	assert.True(t, errors.Is(err, ErrNotRegistered))
+	assert.Contains(t, err.Error(), config.DefaultClusterName)
+}
+
+func TestVerifyRegistrationStopped(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockAgentMetadata := NewMockagentMetadata(mockCtrl)
+	mockAgentMetadata.EXPECT().Metadata().Return(nil, errors.New("connection refused"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	engine := &Engine{agentMetadata: mockAgentMetadata}
+	err := engine.verifyRegistration(ctx, "test", time.Minute)
+	assert.True(t, errors.Is(err, context.Canceled), "Expect the cancellation, got: %v", err)
+}
+
+func TestCheckRegistrationDisconnected(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockAgentMetadata := NewMockagentMetadata(mockCtrl)
+	mockECSAPI := NewMockecsAPI(mockCtrl)
+	mockAgentMetadata.EXPECT().Metadata().Return(registeredMetadata(), nil)
+	mockECSAPI.EXPECT().DescribeContainerInstances(gomock.Any()).Return(&ecsclient.DescribeContainerInstancesOutput{
+		ContainerInstances: []ecsclient.ContainerInstance{{
+			ContainerInstanceArn: "arn",
+			Status:               ecsclient.ContainerInstanceStatusActive,
+		}},
+	}, nil)
+
+	engine := &Engine{
+		agentMetadata: mockAgentMetadata,
+		ecsAPI:        mockECSAPI,
+	}
+	assert.Error(t, engine.checkRegistration("test"))
+}
+
+func TestStartRegistrationCheckRecordsFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockAgentMetadata := NewMockagentMetadata(mockCtrl)
+	mockStatusWriter := NewMockstatusWriter(mockCtrl)
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{config.ClusterEnvVar: "test"})
+	mockAgentMetadata.EXPECT().Metadata().Return(&introspection.Metadata{}, nil).MinTimes(1)
+	recorded := make(chan []byte, 1)
+	mockStatusWriter.EXPECT().WriteFile(config.EngineStatusFile(), gomock.Any(), os.FileMode(statusFilePerm)).Do(
+		func(filename string, data []byte, perm os.FileMode) {
+			recorded <- data
+		})
+
+	os.Setenv(config.VerifyRegistrationEnvVar, "10ms")
+	defer os.Unsetenv(config.VerifyRegistrationEnvVar)
+	defer func(interval time.Duration) { registrationPollInterval = interval }(registrationPollInterval)
+	registrationPollInterval = time.Millisecond
+	engine := &Engine{
+		docker:        mockDocker,
+		agentMetadata: mockAgentMetadata,
+		statusWriter:  mockStatusWriter,
+	}
+	stop := engine.startRegistrationCheck(context.Background())
+	assert.Contains(t, string(<-recorded), `"registration":"Failed"`)
+	stop()
+}
+
+func TestStartRegistrationCheckDisabled(t *testing.T) {
+	engine := &Engine{}
+	engine.startRegistrationCheck(context.Background())()
+}
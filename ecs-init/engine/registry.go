@@ -0,0 +1,88 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecrclient"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// agentPullSteps returns the step pulling the Agent image from its registry,
+// which replaces downloading, caching and loading the Agent tarball
+func (e *Engine) agentPullSteps(ctx context.Context, envVariables map[string]string) []prestartStep {
+	return []prestartStep{
+		{
+			name:    "pull",
+			retries: prestartNetworkRetries,
+			network: true,
+			run: func() error {
+				e.pinAgentVersion(envVariables)
+				return e.pullAgent(ctx)
+			},
+		},
+	}
+}
+
+// pullAgent pulls the pinned version of the Agent from its registry
+func (e *Engine) pullAgent(ctx context.Context) error {
+	image := config.AgentRegistryImage(e.agentRegistry, e.downloader.AgentVersion())
+	e.transition(StateDownloading)
+	log.Infof("Pulling Amazon Elastic Container Service Agent image %s", image)
+	auth, err := e.registryAuth(image)
+	if err != nil {
+		return engineError("could not authorize pulling the Amazon Elastic Container Service Agent", err)
+	}
+	e.recordMilestone(milestoneDownloadStarted)
+	err = e.docker.PullAgentImage(ctx, image, auth)
+	if err != nil {
+		return engineError("could not pull the Amazon Elastic Container Service Agent", err)
+	}
+	// the pulled image is loaded into Docker already
+	e.recordMilestone(milestoneDownloaded)
+	e.recordMilestone(milestoneImageLoaded)
+	return nil
+}
+
+// registryAuth returns the authorization to pull image from an Amazon ECR
+// private registry, such as a pull through cache, with the credentials of
+// the instance. Other registries are pulled from anonymously.
+func (e *Engine) registryAuth(image string) (docker.RegistryAuth, error) {
+	registryID, region, ok := ecrclient.ParseRegistry(strings.SplitN(image, "/", 2)[0])
+	if !ok {
+		return docker.RegistryAuth{}, nil
+	}
+	if e.registryAuthorizer == nil {
+		client, err := ecrclient.New(region)
+		if err != nil {
+			return docker.RegistryAuth{}, errors.Wrap(err, "could not create ECR client")
+		}
+		e.registryAuthorizer = client
+	}
+	authorization, err := e.registryAuthorizer.GetAuthorization(registryID)
+	if err != nil {
+		return docker.RegistryAuth{}, errors.Wrapf(err, "could not get the authorization of registry %s", registryID)
+	}
+	return docker.RegistryAuth{
+		Username:      authorization.Username,
+		Password:      authorization.Password,
+		ServerAddress: authorization.Endpoint,
+	}, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecrclient"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMirror = "123456789012.dkr.ecr.us-west-2.amazonaws.com/ecr-public/ecs/amazon-ecs-agent"
+
+func TestPreStartPullsAgentFromRegistry(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	mockDocker.EXPECT().LoadEnvVars().Return(map[string]string{config.AgentVersionEnvVar: "v1.40.0"})
+	gomock.InOrder(
+		mockDownloader.EXPECT().PinAgentVersion("v1.40.0"),
+		mockDownloader.EXPECT().AgentVersion().Return("v1.40.0"),
+		mockDocker.EXPECT().PullAgentImage(gomock.Any(), config.DefaultAgentRegistry+":v1.40.0", docker.RegistryAuth{}),
+	)
+	// the tarball is neither cached nor loaded
+	mockDownloader.EXPECT().AgentCacheStatus().Times(0)
+	mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any()).Times(0)
+
+	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
+	mockLoopbackRouting.EXPECT().Enable().Return(nil)
+	mockRoute := NewMockcredentialsProxyRoute(mockCtrl)
+	mockRoute.EXPECT().Create().Return(nil)
+
+	engine := &Engine{
+		docker:                mockDocker,
+		downloader:            mockDownloader,
+		loopbackRouting:       mockLoopbackRouting,
+		credentialsProxyRoute: mockRoute,
+		agentRegistry:         config.DefaultAgentRegistry,
+	}
+	assert.NoError(t, engine.PreStart(context.Background()))
+	assert.Equal(t, StateDownloading, engine.State())
+}
+
+func TestPreStartPullFailsOffline(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().WaitReady(gomock.Any(), gomock.Any()).Return(nil)
+	mockDocker.EXPECT().LoadEnvVars().Return(nil)
+	mockDocker.EXPECT().PullAgentImage(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	mockLoopbackRouting := NewMockloopbackRouting(mockCtrl)
+	mockLoopbackRouting.EXPECT().Enable().Return(nil)
+	mockRoute := NewMockcredentialsProxyRoute(mockCtrl)
+	mockRoute.EXPECT().Create().Return(nil)
+
+	engine := &Engine{
+		docker:                mockDocker,
+		downloader:            NewMockdownloader(mockCtrl),
+		loopbackRouting:       mockLoopbackRouting,
+		credentialsProxyRoute: mockRoute,
+		agentRegistry:         config.DefaultAgentRegistry,
+		offline:               true,
+	}
+	err := engine.PreStart(context.Background())
+	assert.True(t, errors.Is(err, cache.ErrOffline))
+}
+
+func TestReloadCachePullsAgentFromRegistry(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker.EXPECT().LoadEnvVars().Return(nil)
+	mockDownloader.EXPECT().AgentVersion().Return("v1.40.0")
+	mockDownloader.EXPECT().IsAgentCached().Times(0)
+	mockDocker.EXPECT().PullAgentImage(gomock.Any(), "registry.example.com/ecs-agent:v1.40.0", docker.RegistryAuth{})
+
+	engine := &Engine{
+		docker:        mockDocker,
+		downloader:    mockDownloader,
+		agentRegistry: "registry.example.com/ecs-agent",
+	}
+	assert.NoError(t, engine.ReloadCache(context.Background()))
+}
+
+func TestPullAgentFromECRPrivateRegistry(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockAuthorizer := NewMockregistryAuthorizer(mockCtrl)
+	mockDownloader.EXPECT().AgentVersion().Return("v1.40.0")
+	mockAuthorizer.EXPECT().GetAuthorization("123456789012").Return(ecrclient.Authorization{
+		Username: "AWS",
+		Password: "password",
+		Endpoint: "https://123456789012.dkr.ecr.us-west-2.amazonaws.com",
+	}, nil)
+	mockDocker.EXPECT().PullAgentImage(gomock.Any(), testMirror+":v1.40.0", docker.RegistryAuth{
+		Username:      "AWS",
+		Password:      "password",
+		ServerAddress: "https://123456789012.dkr.ecr.us-west-2.amazonaws.com",
+	})
+
+	engine := &Engine{
+		docker:             mockDocker,
+		downloader:         mockDownloader,
+		registryAuthorizer: mockAuthorizer,
+		agentRegistry:      testMirror,
+	}
+	assert.NoError(t, engine.pullAgent(context.Background()))
+}
+
+func TestPullAgentAuthorizationError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockAuthorizer := NewMockregistryAuthorizer(mockCtrl)
+	mockDownloader.EXPECT().AgentVersion().Return("v1.40.0")
+	mockAuthorizer.EXPECT().GetAuthorization("123456789012").Return(ecrclient.Authorization{}, errors.New("test error"))
+	mockDocker.EXPECT().PullAgentImage(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	engine := &Engine{
+		docker:             mockDocker,
+		downloader:         mockDownloader,
+		registryAuthorizer: mockAuthorizer,
+		agentRegistry:      testMirror,
+	}
+	err := engine.pullAgent(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not authorize pulling")
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"sync"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/autoscalingclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// scaleInProtection records the instance protected from scale in by the
+// engine, to be released once the upgraded Agent is healthy. Protection the
+// instance had already, such as the managed termination protection of a
+// capacity provider, is left alone.
+type scaleInProtection struct {
+	lock       sync.Mutex
+	group      string
+	instanceID string
+}
+
+// protectUpgradeFromScaleIn protects the instance from scale in before the
+// Agent is restarted to upgrade it, so that its Auto Scaling group does not
+// pick the instance while the Agent cannot report its tasks. It returns
+// false if the instance is already leaving its group, in which case the
+// Agent is not upgraded. Failing to reach Auto Scaling does not hold the
+// upgrade back.
+func (e *Engine) protectUpgradeFromScaleIn() bool {
+	if !config.UpgradeScaleInProtection() || e.offline {
+		return true
+	}
+	instanceID, err := e.downloader.InstanceID()
+	if err != nil {
+		log.Warnf("Not protecting the instance from scale in: %v", err)
+		return true
+	}
+	instance, err := e.describeAutoScalingInstance(instanceID)
+	if err != nil {
+		log.Warnf("Not protecting the instance from scale in: %v", err)
+		return true
+	}
+	if instance == nil {
+		log.Debugf("Instance %s is not in an Auto Scaling group", instanceID)
+		return true
+	}
+	if instance.LifecycleState != autoscalingclient.LifecycleStateInService {
+		log.Infof("Not upgrading the Agent while the instance is %s in Auto Scaling group %s",
+			instance.LifecycleState, instance.AutoScalingGroupName)
+		return false
+	}
+	if instance.ProtectedFromScaleIn {
+		return true
+	}
+	err = e.autoScaling.SetInstanceProtection(instance.AutoScalingGroupName, instanceID, true)
+	if err != nil {
+		log.Warnf("Could not protect the instance from scale in: %v", err)
+		return true
+	}
+	log.Infof("Protected the instance from scale in by Auto Scaling group %s while the Agent is upgraded",
+		instance.AutoScalingGroupName)
+	e.scaleInProtection.lock.Lock()
+	defer e.scaleInProtection.lock.Unlock()
+	e.scaleInProtection.group = instance.AutoScalingGroupName
+	e.scaleInProtection.instanceID = instanceID
+	return true
+}
+
+// describeAutoScalingInstance describes the instance in its Auto Scaling
+// group, creating the client for the region of the instance on first use
+func (e *Engine) describeAutoScalingInstance(instanceID string) (*autoscalingclient.Instance, error) {
+	if e.autoScaling == nil {
+		region, err := e.downloader.Region()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create Auto Scaling client")
+		}
+		client, err := autoscalingclient.New(region)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create Auto Scaling client")
+		}
+		e.autoScaling = client
+		e.dryRunAWSClients()
+	}
+	instance, err := e.autoScaling.DescribeInstance(instanceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not describe the Auto Scaling instance")
+	}
+	return instance, nil
+}
+
+// releaseScaleInProtection removes the protection from scale in set by
+// protectUpgradeFromScaleIn, if any
+func (e *Engine) releaseScaleInProtection() {
+	e.scaleInProtection.lock.Lock()
+	defer e.scaleInProtection.lock.Unlock()
+	if e.scaleInProtection.instanceID == "" {
+		return
+	}
+	err := e.autoScaling.SetInstanceProtection(e.scaleInProtection.group, e.scaleInProtection.instanceID, false)
+	if err != nil {
+		log.Warnf("Could not remove the protection of the instance from scale in: %v", err)
+		return
+	}
+	log.Infof("Removed the protection of the instance from scale in by Auto Scaling group %s", e.scaleInProtection.group)
+	e.scaleInProtection.group = ""
+	e.scaleInProtection.instanceID = ""
+}
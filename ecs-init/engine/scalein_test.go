@@ -0,0 +1,175 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/autoscalingclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func setUpgradeScaleInProtection(t *testing.T) {
+	t.Setenv(config.UpgradeScaleInProtectionEnvVar, "true")
+}
+
+func newScaleInTestEngine(mockCtrl *gomock.Controller) (*Engine, *MockautoScalingAPI) {
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().InstanceID().Return("i-1234", nil).AnyTimes()
+	mockAutoScaling := NewMockautoScalingAPI(mockCtrl)
+	return &Engine{
+		downloader:  mockDownloader,
+		autoScaling: mockAutoScaling,
+	}, mockAutoScaling
+}
+
+func TestProtectUpgradeFromScaleInDisabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Unsetenv(config.UpgradeScaleInProtectionEnvVar)
+	engine, mockAutoScaling := newScaleInTestEngine(mockCtrl)
+	mockAutoScaling.EXPECT().DescribeInstance(gomock.Any()).Times(0)
+
+	assert.True(t, engine.protectUpgradeFromScaleIn())
+}
+
+func TestProtectUpgradeFromScaleIn(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setUpgradeScaleInProtection(t)
+	engine, mockAutoScaling := newScaleInTestEngine(mockCtrl)
+	gomock.InOrder(
+		mockAutoScaling.EXPECT().DescribeInstance("i-1234").Return(&autoscalingclient.Instance{
+			InstanceID:           "i-1234",
+			AutoScalingGroupName: "ecs-asg",
+			LifecycleState:       autoscalingclient.LifecycleStateInService,
+		}, nil),
+		mockAutoScaling.EXPECT().SetInstanceProtection("ecs-asg", "i-1234", true),
+		mockAutoScaling.EXPECT().SetInstanceProtection("ecs-asg", "i-1234", false),
+	)
+
+	assert.True(t, engine.protectUpgradeFromScaleIn())
+	engine.releaseScaleInProtection()
+	// the protection is released once
+	engine.releaseScaleInProtection()
+}
+
+func TestProtectUpgradeFromScaleInAlreadyProtected(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setUpgradeScaleInProtection(t)
+	engine, mockAutoScaling := newScaleInTestEngine(mockCtrl)
+	mockAutoScaling.EXPECT().DescribeInstance("i-1234").Return(&autoscalingclient.Instance{
+		InstanceID:           "i-1234",
+		AutoScalingGroupName: "ecs-asg",
+		LifecycleState:       autoscalingclient.LifecycleStateInService,
+		ProtectedFromScaleIn: true,
+	}, nil)
+	// protection set by the capacity provider is left alone
+	mockAutoScaling.EXPECT().SetInstanceProtection(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	assert.True(t, engine.protectUpgradeFromScaleIn())
+	engine.releaseScaleInProtection()
+}
+
+func TestProtectUpgradeFromScaleInLeavingGroup(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setUpgradeScaleInProtection(t)
+	engine, mockAutoScaling := newScaleInTestEngine(mockCtrl)
+	mockAutoScaling.EXPECT().DescribeInstance("i-1234").Return(&autoscalingclient.Instance{
+		InstanceID:           "i-1234",
+		AutoScalingGroupName: "ecs-asg",
+		LifecycleState:       "Terminating:Wait",
+	}, nil)
+
+	assert.False(t, engine.protectUpgradeFromScaleIn())
+}
+
+func TestProtectUpgradeFromScaleInNotInGroup(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setUpgradeScaleInProtection(t)
+	engine, mockAutoScaling := newScaleInTestEngine(mockCtrl)
+	mockAutoScaling.EXPECT().DescribeInstance("i-1234").Return(nil, nil)
+
+	assert.True(t, engine.protectUpgradeFromScaleIn())
+}
+
+func TestProtectUpgradeFromScaleInAutoScalingUnavailable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setUpgradeScaleInProtection(t)
+	engine, mockAutoScaling := newScaleInTestEngine(mockCtrl)
+	mockAutoScaling.EXPECT().DescribeInstance("i-1234").Return(nil, errors.New("test error"))
+
+	assert.True(t, engine.protectUpgradeFromScaleIn(), "Expect the upgrade not to be held back")
+}
+
+func TestApplyPendingUpgradeWhileLeavingGroup(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setUpgradeScaleInProtection(t)
+	os.Unsetenv(config.MaintenanceWindowsEnvVar)
+	engine, mockAutoScaling := newScaleInTestEngine(mockCtrl)
+	mockAutoScaling.EXPECT().DescribeInstance("i-1234").Return(&autoscalingclient.Instance{
+		InstanceID:           "i-1234",
+		AutoScalingGroupName: "ecs-asg",
+		LifecycleState:       "Terminating:Wait",
+	}, nil)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().StopAgent(gomock.Any()).Times(0)
+	engine.docker = mockDocker
+	engine.upgradePending = true
+
+	assert.False(t, engine.applyPendingUpgrade(context.Background()))
+	assert.False(t, engine.takeDueUpgrade())
+}
+
+func TestApplyPendingUpgradeReleasesProtectionWhenStopFails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setUpgradeScaleInProtection(t)
+	os.Unsetenv(config.MaintenanceWindowsEnvVar)
+	engine, mockAutoScaling := newScaleInTestEngine(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	gomock.InOrder(
+		mockAutoScaling.EXPECT().DescribeInstance("i-1234").Return(&autoscalingclient.Instance{
+			InstanceID:           "i-1234",
+			AutoScalingGroupName: "ecs-asg",
+			LifecycleState:       autoscalingclient.LifecycleStateInService,
+		}, nil),
+		mockAutoScaling.EXPECT().SetInstanceProtection("ecs-asg", "i-1234", true),
+		mockDocker.EXPECT().StopAgent(gomock.Any()).Return(errors.New("test error")),
+		mockAutoScaling.EXPECT().SetInstanceProtection("ecs-asg", "i-1234", false),
+	)
+	engine.docker = mockDocker
+	engine.upgradePending = true
+
+	assert.False(t, engine.applyPendingUpgrade(context.Background()))
+}
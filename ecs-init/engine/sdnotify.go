@@ -0,0 +1,67 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"github.com/aws/amazon-ecs-init/ecs-init/sdnotify"
+
+	log "github.com/cihub/seelog"
+)
+
+// notify tells systemd about the state of the service, when ecs-init runs as
+// a systemd service of Type=notify
+func (e *Engine) notify(state string) {
+	if e.notifier == nil {
+		return
+	}
+	err := e.notifier.Notify(state)
+	if err != nil {
+		log.Warnf("Could not notify systemd: %v", err)
+	}
+}
+
+// startWatchdog keeps the systemd watchdog from restarting the service while
+// the engine responds, pinging it at half its timeout. A pinging engine reads
+// its state first, so that a hung engine stops pinging and is restarted. The
+// returned function stops the pings.
+func (e *Engine) startWatchdog() func() {
+	if e.notifier == nil {
+		return func() {}
+	}
+	interval := e.notifier.WatchdogInterval()
+	if interval == 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := e.clk().NewTicker(interval / 2)
+		defer ticker.Stop()
+		e.notify(sdnotify.Watchdog)
+		for {
+			select {
+			case <-ticker.C():
+				e.State()
+				e.notify(sdnotify.Watchdog)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
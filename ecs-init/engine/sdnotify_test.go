@@ -0,0 +1,79 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/sdnotify"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestMarkHealthyAfterNotifiesReady(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ready := make(chan struct{})
+	mockNotifier := NewMockserviceNotifier(mockCtrl)
+	mockNotifier.EXPECT().Notify(sdnotify.Ready).Do(func(string) { close(ready) }).Return(nil)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{clock: fakeClock, notifier: mockNotifier}
+	engine.transition(StateStarting)
+	cancel := engine.markHealthyAfter(context.Background())
+	defer cancel()
+	fakeClock.Advance(agentHealthyAfter)
+	<-ready
+}
+
+func TestStartWatchdogDisabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockNotifier := NewMockserviceNotifier(mockCtrl)
+	mockNotifier.EXPECT().WatchdogInterval().Return(time.Duration(0))
+	mockNotifier.EXPECT().Notify(gomock.Any()).Times(0)
+
+	engine := &Engine{notifier: mockNotifier}
+	engine.startWatchdog()()
+}
+
+func TestStartWatchdog(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	pinged := make(chan struct{}, 3)
+	mockNotifier := NewMockserviceNotifier(mockCtrl)
+	mockNotifier.EXPECT().WatchdogInterval().Return(time.Minute)
+	mockNotifier.EXPECT().Notify(sdnotify.Watchdog).Do(func(string) { pinged <- struct{}{} }).Return(nil)
+	mockNotifier.EXPECT().Notify(sdnotify.Watchdog).Do(func(string) { pinged <- struct{}{} }).
+		Return(errors.New("test error")).Times(2)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{clock: fakeClock, notifier: mockNotifier}
+	stop := engine.startWatchdog()
+	// systemd is pinged right away, then at half the watchdog timeout
+	<-pinged
+	for i := 0; i < 2; i++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(30 * time.Second)
+		<-pinged
+	}
+	stop()
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// selfTestPollInterval is how often the self-test checks that the Agent is
+// running
+const selfTestPollInterval = time.Second
+
+// agentExit is how the Agent container exited
+type agentExit struct {
+	code int
+	err  error
+}
+
+// SelfTest runs the Agent through one download, load, start and stop cycle
+// outside of supervision, to qualify a host. The Agent is always downloaded,
+// and has to be running within startTimeout.
+func (e *Engine) SelfTest(ctx context.Context, startTimeout time.Duration) error {
+	log.Info("Self-test: downloading the Agent")
+	err := e.downloadAgent(ctx)
+	if err != nil {
+		return err
+	}
+	log.Info("Self-test: loading the Agent into Docker")
+	err = e.load(ctx, e.downloader.LoadCachedAgent)
+	if err != nil {
+		return err
+	}
+	loaded, err := e.docker.IsAgentImageLoaded(ctx)
+	if err != nil {
+		return engineError("could not check Docker for Agent image presence", err)
+	}
+	if !loaded {
+		return errors.New("the Agent image was not loaded into Docker")
+	}
+
+	log.Info("Self-test: starting the Agent")
+	err = e.docker.RemoveExistingAgentContainer(ctx)
+	if err != nil {
+		return engineError("could not remove existing Agent container", err)
+	}
+	exited := make(chan agentExit, 1)
+	go func() {
+		code, err := e.docker.StartAgent(ctx)
+		exited <- agentExit{code: code, err: err}
+	}()
+	err = e.waitForAgentRunning(ctx, startTimeout, exited)
+	if err != nil {
+		// the Agent may have been created and still be starting, and is
+		// stopped even once ctx is done
+		e.docker.StopAgent(context.Background())
+		return err
+	}
+
+	log.Info("Self-test: stopping the Agent")
+	err = e.docker.StopAgent(ctx)
+	if err != nil {
+		return engineError("could not stop Amazon Elastic Container Service Agent", err)
+	}
+	exit := <-exited
+	if exit.err != nil {
+		return engineError("could not start Agent", exit.err)
+	}
+	log.Infof("Self-test: the Agent exited with code %d once stopped", exit.code)
+	return nil
+}
+
+// waitForAgentRunning waits for the Agent container to be running, failing if
+// it exits first, is not running within timeout or ctx is done
+func (e *Engine) waitForAgentRunning(ctx context.Context, timeout time.Duration, exited <-chan agentExit) error {
+	deadline := e.clk().After(timeout)
+	ticker := e.clk().NewTicker(selfTestPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case exit := <-exited:
+			if exit.err != nil {
+				return engineError("could not start Agent", exit.err)
+			}
+			log.Info(e.docker.GetContainerLogTail(ctx, failedContainerLogWindowSize))
+			return errors.Errorf("the Agent exited with code %d before it was seen running", exit.code)
+		case <-deadline:
+			return errors.Errorf("the Agent was not running within %s", timeout.String())
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+			running, err := e.docker.IsAgentRunning(ctx)
+			if err != nil {
+				log.Warnf("Could not check whether the Agent is running: %v", err)
+				continue
+			}
+			if running {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfTest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cachedAgentBuffer := ioutil.NopCloser(&bytes.Buffer{})
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	stopped := make(chan struct{})
+	gomock.InOrder(
+		mockDownloader.EXPECT().DownloadAgent(gomock.Any()),
+		mockDownloader.EXPECT().LoadCachedAgent().Return(cachedAgentBuffer, nil),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), cachedAgentBuffer),
+		mockDownloader.EXPECT().RecordCachedAgent(),
+		mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(true, nil),
+		mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any()),
+	)
+	mockDocker.EXPECT().StartAgent(gomock.Any()).DoAndReturn(func(context.Context) (int, error) {
+		<-stopped
+		return 0, nil
+	})
+	mockDocker.EXPECT().IsAgentRunning(gomock.Any()).Return(true, nil)
+	mockDocker.EXPECT().StopAgent(gomock.Any()).Do(func(context.Context) { close(stopped) })
+
+	engine := &Engine{
+		docker:     mockDocker,
+		downloader: mockDownloader,
+	}
+	assert.NoError(t, engine.SelfTest(context.Background(), 5*time.Second))
+}
+
+func TestSelfTestAgentExitsBeforeRunning(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cachedAgentBuffer := ioutil.NopCloser(&bytes.Buffer{})
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	mockDownloader.EXPECT().DownloadAgent(gomock.Any())
+	mockDownloader.EXPECT().LoadCachedAgent().Return(cachedAgentBuffer, nil)
+	mockDocker.EXPECT().LoadImage(gomock.Any(), cachedAgentBuffer)
+	mockDownloader.EXPECT().RecordCachedAgent()
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(true, nil)
+	mockDocker.EXPECT().RemoveExistingAgentContainer(gomock.Any())
+	mockDocker.EXPECT().StartAgent(gomock.Any()).Return(1, nil)
+	mockDocker.EXPECT().IsAgentRunning(gomock.Any()).Return(false, nil).AnyTimes()
+	mockDocker.EXPECT().GetContainerLogTail(gomock.Any(), gomock.Any())
+	mockDocker.EXPECT().StopAgent(gomock.Any())
+
+	engine := &Engine{
+		docker:     mockDocker,
+		downloader: mockDownloader,
+	}
+	err := engine.SelfTest(context.Background(), 5*time.Second)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exited with code 1")
+}
+
+func TestSelfTestImageNotLoaded(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cachedAgentBuffer := ioutil.NopCloser(&bytes.Buffer{})
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	mockDownloader.EXPECT().DownloadAgent(gomock.Any())
+	mockDownloader.EXPECT().LoadCachedAgent().Return(cachedAgentBuffer, nil)
+	mockDocker.EXPECT().LoadImage(gomock.Any(), cachedAgentBuffer)
+	mockDownloader.EXPECT().RecordCachedAgent()
+	mockDocker.EXPECT().IsAgentImageLoaded(gomock.Any()).Return(false, nil)
+
+	engine := &Engine{
+		docker:     mockDocker,
+		downloader: mockDownloader,
+	}
+	assert.Error(t, engine.SelfTest(context.Background(), 5*time.Second))
+}
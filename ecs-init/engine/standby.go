@@ -0,0 +1,111 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+// standbyPreloadInterval is how often the standby image locator file is
+// checked for a new Agent image while the Agent is running
+const standbyPreloadInterval = time.Minute
+
+// startStandbyPreload preloads the Agent image described by the standby image
+// locator file in the background while the Agent is running, so that an
+// upgrade only needs to restart the Agent container. The returned function
+// stops the preloading and waits for an in-progress load to complete.
+func (e *Engine) startStandbyPreload(ctx context.Context) func() {
+	if !config.StandbyPreloadEnabled() {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := e.clk().NewTicker(standbyPreloadInterval)
+		defer ticker.Stop()
+		for {
+			e.preloadStandbyAgent(ctx)
+			select {
+			case <-ticker.C():
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+func (e *Engine) preloadStandbyAgent(ctx context.Context) {
+	standbyImage, err := e.downloader.StandbyAgentFile()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Could not read standby Agent image location: %v", err)
+		}
+		return
+	}
+	if standbyImage == e.standbyImage {
+		return
+	}
+	image, err := e.downloader.LoadAgentFile(standbyImage)
+	if err != nil {
+		log.Warnf("Could not open standby Agent image %s: %v", standbyImage, err)
+		return
+	}
+	defer image.Close()
+	log.Infof("Preloading standby Amazon Elastic Container Service Agent from %s", standbyImage)
+	err = e.docker.PreloadImage(ctx, image)
+	if err != nil {
+		log.Warnf("Could not preload standby Agent image %s: %v", standbyImage, err)
+		return
+	}
+	e.standbyImage = standbyImage
+}
+
+// promoteStandbyAgent switches to the preloaded standby image when it is the
+// desired image of the upgrade, returning false if the desired image still
+// needs to be loaded
+func (e *Engine) promoteStandbyAgent(ctx context.Context) bool {
+	if e.standbyImage == "" {
+		return false
+	}
+	standbyImage := e.standbyImage
+	e.standbyImage = ""
+	desiredImage, err := e.downloader.DesiredAgentFile()
+	if err != nil || desiredImage != standbyImage {
+		return false
+	}
+	log.Info("Switching to preloaded standby Amazon Elastic Container Service Agent")
+	err = e.docker.PromoteStandbyImage(ctx)
+	if err != nil {
+		log.Warnf("Could not switch to standby Agent image, loading desired image instead: %v", err)
+		return false
+	}
+	err = e.downloader.RecordCachedAgent()
+	if err != nil {
+		log.Warnf("Could not record cached Agent: %v", err)
+	}
+	return true
+}
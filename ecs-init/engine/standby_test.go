@@ -0,0 +1,115 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const standbyImageFile = "/var/cache/ecs/ecs-agent-v1.37.0.tar"
+
+func TestPreloadStandbyAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	standbyAgentBuffer := ioutil.NopCloser(&bytes.Buffer{})
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	gomock.InOrder(
+		mockDownloader.EXPECT().StandbyAgentFile().Return(standbyImageFile, nil),
+		mockDownloader.EXPECT().LoadAgentFile(standbyImageFile).Return(standbyAgentBuffer, nil),
+		mockDocker.EXPECT().PreloadImage(gomock.Any(), standbyAgentBuffer),
+		// the same image is not preloaded twice
+		mockDownloader.EXPECT().StandbyAgentFile().Return(standbyImageFile, nil),
+	)
+
+	engine := &Engine{
+		docker:     mockDocker,
+		downloader: mockDownloader,
+	}
+	engine.preloadStandbyAgent(context.Background())
+	engine.preloadStandbyAgent(context.Background())
+	assert.Equal(t, standbyImageFile, engine.standbyImage)
+}
+
+func TestPreloadStandbyAgentNoStandbyImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().StandbyAgentFile().Return("", os.ErrNotExist)
+
+	engine := &Engine{
+		downloader: mockDownloader,
+	}
+	engine.preloadStandbyAgent(context.Background())
+	assert.Empty(t, engine.standbyImage)
+}
+
+func TestUpgradeAgentPromotesStandbyAgent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	gomock.InOrder(
+		mockDownloader.EXPECT().DesiredAgentFile().Return(standbyImageFile, nil),
+		mockDocker.EXPECT().PromoteStandbyImage(gomock.Any()),
+		mockDownloader.EXPECT().RecordCachedAgent(),
+	)
+
+	engine := &Engine{
+		docker:       mockDocker,
+		downloader:   mockDownloader,
+		standbyImage: standbyImageFile,
+	}
+	err := engine.upgradeAgent(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, engine.standbyImage)
+}
+
+func TestUpgradeAgentStandbyAgentNotDesired(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	desiredAgentBuffer := ioutil.NopCloser(&bytes.Buffer{})
+
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+
+	gomock.InOrder(
+		mockDownloader.EXPECT().DesiredAgentFile().Return("/var/cache/ecs/ecs-agent-v1.38.0.tar", nil),
+		mockDownloader.EXPECT().LoadDesiredAgent().Return(desiredAgentBuffer, nil),
+		mockDocker.EXPECT().LoadImage(gomock.Any(), desiredAgentBuffer),
+		mockDownloader.EXPECT().RecordCachedAgent(),
+	)
+
+	engine := &Engine{
+		docker:       mockDocker,
+		downloader:   mockDownloader,
+		standbyImage: standbyImageFile,
+	}
+	err := engine.upgradeAgent(context.Background())
+	assert.NoError(t, err)
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/sdnotify"
+
+	log "github.com/cihub/seelog"
+)
+
+// startGatePollInterval is how often the start gates are checked while the
+// start of the Agent waits for them
+const startGatePollInterval = 10 * time.Second
+
+// startGateTimeoutExtension is how long systemd is asked to wait for the
+// service to start each time the start gates are checked while closed. It
+// matches TimeoutStartSec of ecs.service, so that the Agent has as long to
+// start once the gates open as it has without gates.
+const startGateTimeoutExtension = 10 * time.Minute
+
+// startGates are the conditions that have to hold before the Agent is
+// started, so that the instance registers into its cluster only once the
+// rest of the instance is provisioned
+type startGates struct {
+	file           string
+	command        string
+	parameterName  string
+	parameterValue string
+}
+
+// WaitForStartGates waits until the configured start gates are open: the
+// start gate file exists, the start gate command succeeds and the start gate
+// SSM parameter holds the expected value. It returns an error if they are
+// not open within the start gate timeout, when one is set, or once ctx is
+// done. While it waits, it extends the start timeout of the systemd service
+// ecs-init runs as, so that closed gates do not make systemd give up on it.
+func (e *Engine) WaitForStartGates(ctx context.Context) error {
+	gates := startGates{
+		file:    config.StartGateFile(),
+		command: config.StartGateCommand(),
+	}
+	var err error
+	gates.parameterName, gates.parameterValue, err = config.StartGateParameter()
+	if err != nil {
+		return err
+	}
+	timeout, err := config.StartGateTimeout()
+	if err != nil {
+		return err
+	}
+	if gates.file == "" && gates.command == "" && gates.parameterName == "" {
+		return nil
+	}
+	if gates.parameterName != "" && e.offline {
+		return errors.New("the SSM parameter start gate cannot be checked in offline mode")
+	}
+
+	if e.dryRun {
+		reason := e.closedStartGate(gates)
+		if reason != "" {
+			log.Infof("Dry run: would wait to start the Agent: %s", reason)
+		}
+		return nil
+	}
+
+	stopWatchdog := e.startWatchdog()
+	defer stopWatchdog()
+	start := e.clk().Now()
+	lastReason := ""
+	for {
+		reason := e.closedStartGate(gates)
+		if reason == "" {
+			if lastReason != "" {
+				log.Infof("Start gates opened after %s", e.clk().Since(start))
+			}
+			return nil
+		}
+		if timeout > 0 && e.clk().Since(start) >= timeout {
+			return engineError(fmt.Sprintf("start gates did not open within %s", timeout), errors.New(reason))
+		}
+		if reason != lastReason {
+			log.Infof("Waiting to start the Agent: %s", reason)
+			lastReason = reason
+		}
+		e.notify(sdnotify.ExtendTimeout(startGateTimeoutExtension))
+		err := clock.SleepContext(ctx, e.clk(), startGatePollInterval)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// closedStartGate returns why the first closed start gate is closed, or an
+// empty string when all of them are open
+func (e *Engine) closedStartGate(gates startGates) string {
+	if gates.file != "" {
+		if err := e.startGate.FileExists(gates.file); err != nil {
+			return fmt.Sprintf("file %s does not exist", gates.file)
+		}
+	}
+	if gates.command != "" {
+		if err := e.startGate.CommandSucceeds(gates.command); err != nil {
+			return fmt.Sprintf("command did not succeed: %v", err)
+		}
+	}
+	if gates.parameterName != "" {
+		value, err := e.parameterValue(gates.parameterName)
+		if err != nil {
+			return err.Error()
+		}
+		if value != gates.parameterValue {
+			return fmt.Sprintf("SSM parameter %s is %q instead of %q", gates.parameterName, value,
+				gates.parameterValue)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/sdnotify"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForStartGatesNone(t *testing.T) {
+	engine := &Engine{}
+	assert.NoError(t, engine.WaitForStartGates(context.Background()))
+}
+
+func TestWaitForStartGatesOpen(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.StartGateFileEnvVar, "/var/run/provisioned")
+	defer os.Unsetenv(config.StartGateFileEnvVar)
+	os.Setenv(config.StartGateCommandEnvVar, "systemctl is-active falcon-sensor")
+	defer os.Unsetenv(config.StartGateCommandEnvVar)
+	os.Setenv(config.StartGateParameterEnvVar, "/provisioning/status=done")
+	defer os.Unsetenv(config.StartGateParameterEnvVar)
+
+	mockStartGate := NewMockstartGate(mockCtrl)
+	mockParameterStore := NewMockparameterStore(mockCtrl)
+	gomock.InOrder(
+		mockStartGate.EXPECT().FileExists("/var/run/provisioned").Return(nil),
+		mockStartGate.EXPECT().CommandSucceeds("systemctl is-active falcon-sensor").Return(nil),
+		mockParameterStore.EXPECT().GetParameterValue("/provisioning/status").Return("done", nil),
+	)
+
+	engine := &Engine{startGate: mockStartGate, parameterStore: mockParameterStore}
+	assert.NoError(t, engine.WaitForStartGates(context.Background()))
+}
+
+func TestWaitForStartGatesWaits(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.StartGateParameterEnvVar, "/provisioning/status=done")
+	defer os.Unsetenv(config.StartGateParameterEnvVar)
+
+	mockParameterStore := NewMockparameterStore(mockCtrl)
+	gomock.InOrder(
+		mockParameterStore.EXPECT().GetParameterValue("/provisioning/status").Return("", errors.New("test error")),
+		mockParameterStore.EXPECT().GetParameterValue("/provisioning/status").Return("running", nil),
+		mockParameterStore.EXPECT().GetParameterValue("/provisioning/status").Return("done", nil),
+	)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{parameterStore: mockParameterStore, clock: fakeClock}
+	done := make(chan error)
+	go func() {
+		done <- engine.WaitForStartGates(context.Background())
+	}()
+	for i := 0; i < 2; i++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(startGatePollInterval)
+	}
+	assert.NoError(t, <-done)
+}
+
+func TestWaitForStartGatesExtendsStartTimeout(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.StartGateFileEnvVar, "/var/run/provisioned")
+	defer os.Unsetenv(config.StartGateFileEnvVar)
+
+	mockStartGate := NewMockstartGate(mockCtrl)
+	mockNotifier := NewMockserviceNotifier(mockCtrl)
+	mockNotifier.EXPECT().WatchdogInterval().Return(time.Duration(0))
+	gomock.InOrder(
+		mockStartGate.EXPECT().FileExists("/var/run/provisioned").Return(errors.New("test error")),
+		mockNotifier.EXPECT().Notify(sdnotify.ExtendTimeout(startGateTimeoutExtension)).Return(nil),
+		mockStartGate.EXPECT().FileExists("/var/run/provisioned").Return(errors.New("test error")),
+		mockNotifier.EXPECT().Notify(sdnotify.ExtendTimeout(startGateTimeoutExtension)).
+			Return(errors.New("test error")),
+		mockStartGate.EXPECT().FileExists("/var/run/provisioned").Return(nil),
+	)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{startGate: mockStartGate, notifier: mockNotifier, clock: fakeClock}
+	done := make(chan error)
+	go func() {
+		done <- engine.WaitForStartGates(context.Background())
+	}()
+	for i := 0; i < 2; i++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(startGatePollInterval)
+	}
+	assert.NoError(t, <-done)
+}
+
+func TestWaitForStartGatesTimeout(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.StartGateCommandEnvVar, "test -b /dev/xvdb")
+	defer os.Unsetenv(config.StartGateCommandEnvVar)
+	os.Setenv(config.StartGateTimeoutEnvVar, "15s")
+	defer os.Unsetenv(config.StartGateTimeoutEnvVar)
+
+	mockStartGate := NewMockstartGate(mockCtrl)
+	mockStartGate.EXPECT().CommandSucceeds("test -b /dev/xvdb").Return(errors.New("test error")).Times(3)
+
+	fakeClock := clock.NewFake(time.Now())
+	engine := &Engine{startGate: mockStartGate, clock: fakeClock}
+	done := make(chan error)
+	go func() {
+		done <- engine.WaitForStartGates(context.Background())
+	}()
+	for i := 0; i < 2; i++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(startGatePollInterval)
+	}
+	assert.Error(t, <-done)
+}
+
+func TestWaitForStartGatesParameterOffline(t *testing.T) {
+	os.Setenv(config.StartGateParameterEnvVar, "/provisioning/status=done")
+	defer os.Unsetenv(config.StartGateParameterEnvVar)
+
+	engine := &Engine{offline: true}
+	assert.Error(t, engine.WaitForStartGates(context.Background()))
+}
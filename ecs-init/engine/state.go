@@ -0,0 +1,281 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/metrics"
+	"github.com/aws/amazon-ecs-init/ecs-init/sdnotify"
+
+	log "github.com/cihub/seelog"
+)
+
+// State is a stage in the lifecycle of the Agent managed by the engine
+type State int
+
+const (
+	// StateInitializing is the state of the engine before it acts on the Agent
+	StateInitializing State = iota
+	// StateDownloading is the state of the engine while the Agent image is downloaded
+	StateDownloading
+	// StateLoading is the state of the engine while the Agent image is loaded into Docker
+	StateLoading
+	// StateStarting is the state of the engine while the Agent container is started
+	StateStarting
+	// StateHealthy is the state of the engine once the Agent container has kept running
+	StateHealthy
+	// StateDegraded is the state of the engine after the Agent failed, until it is restarted
+	StateDegraded
+	// StateUpgrading is the state of the engine while the Agent is switched to its desired image
+	StateUpgrading
+	// StateStopping is the state of the engine once the Agent is stopped for good
+	StateStopping
+)
+
+var stateNames = map[State]string{
+	StateInitializing: "Initializing",
+	StateDownloading:  "Downloading",
+	StateLoading:      "Loading",
+	StateStarting:     "Starting",
+	StateHealthy:      "Healthy",
+	StateDegraded:     "Degraded",
+	StateUpgrading:    "Upgrading",
+	StateStopping:     "Stopping",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// MarshalText encodes the state by name
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes the state from its name
+func (s *State) UnmarshalText(text []byte) error {
+	for state, name := range stateNames {
+		if name == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown engine state %q", text)
+}
+
+// stateTransitions lists the states that may be entered from each state. A
+// starting or healthy Agent may be restarted to apply a changed config, and a
+// previous Agent image may be loaded when loading a new one failed.
+var stateTransitions = map[State][]State{
+	StateInitializing: {StateDownloading, StateLoading, StateStarting, StateStopping},
+	StateDownloading:  {StateLoading, StateDegraded, StateStopping},
+	StateLoading:      {StateLoading, StateStarting, StateDegraded, StateStopping},
+	StateStarting:     {StateStarting, StateHealthy, StateDegraded, StateUpgrading, StateStopping},
+	StateHealthy:      {StateStarting, StateDegraded, StateUpgrading, StateStopping},
+	StateDegraded:     {StateDownloading, StateLoading, StateStarting, StateStopping},
+	StateUpgrading:    {StateLoading, StateStarting, StateDegraded, StateStopping},
+	StateStopping:     {},
+}
+
+const (
+	// agentHealthyAfter is how long the Agent container has to keep
+	// running for the engine to consider it healthy
+	agentHealthyAfter = 30 * time.Second
+	// statusFilePerm allows the status file to be read by other users
+	statusFilePerm = 0644
+)
+
+// stateMachine tracks the state of the engine. Its zero value is in
+// StateInitializing.
+type stateMachine struct {
+	lock         sync.RWMutex
+	state        State
+	since        time.Time
+	registration string
+	taskMetadata string
+	configDrift  bool
+}
+
+// status is the state of the engine as written to the status file
+type status struct {
+	State State     `json:"state"`
+	Since time.Time `json:"since"`
+	// Registration is the outcome of verifying that the Agent registered
+	// the instance, if it was verified
+	Registration string `json:"registration,omitempty"`
+	// TaskMetadata is the outcome of requesting the task metadata endpoint
+	// from a task network namespace, if it was checked
+	TaskMetadata string `json:"taskMetadata,omitempty"`
+	// ConfigDriftPendingRestart is set when the agent config file changed
+	// after the Agent was started with it
+	ConfigDriftPendingRestart bool `json:"configDriftPendingRestart,omitempty"`
+}
+
+func (m *stateMachine) current() status {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return status{
+		State:                     m.state,
+		Since:                     m.since,
+		Registration:              m.registration,
+		TaskMetadata:              m.taskMetadata,
+		ConfigDriftPendingRestart: m.configDrift,
+	}
+}
+
+// setRegistration records the outcome of the registration verification
+func (m *stateMachine) setRegistration(registration string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.registration = registration
+}
+
+// setTaskMetadata records the outcome of the task metadata endpoint check
+func (m *stateMachine) setTaskMetadata(taskMetadata string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.taskMetadata = taskMetadata
+}
+
+// setConfigDrift records if the agent config changed since the Agent was
+// started and returns true if that changed the status
+func (m *stateMachine) setConfigDrift(drift bool) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	changed := m.configDrift != drift
+	m.configDrift = drift
+	return changed
+}
+
+// transition moves to state to if it may be entered from the current state
+// and returns the previous state
+func (m *stateMachine) transition(to State, now time.Time) (State, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	from := m.state
+	if !canTransition(from, to) {
+		return from, false
+	}
+	m.state = to
+	m.since = now
+	return from, true
+}
+
+// transitionFrom moves to state to only if the current state is from
+func (m *stateMachine) transitionFrom(from, to State, now time.Time) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.state != from || !canTransition(from, to) {
+		return false
+	}
+	m.state = to
+	m.since = now
+	return true
+}
+
+func canTransition(from, to State) bool {
+	for _, state := range stateTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// State returns the current state of the engine
+func (e *Engine) State() State {
+	return e.state.current().State
+}
+
+// transition moves the engine to state to, logging the transition and
+// recording it in the status file
+func (e *Engine) transition(to State) {
+	from, ok := e.state.transition(to, e.clk().Now())
+	if !ok {
+		log.Warnf("Ignoring invalid engine state transition from %s to %s", from, to)
+		return
+	}
+	log.Infof("Engine state changed from %s to %s", from, to)
+	metrics.SupervisionState.Set(to.String())
+	e.writeStatus()
+}
+
+// markHealthyAfter moves the engine from StateStarting to StateHealthy once
+// the Agent has kept running for agentHealthyAfter. The first time, the work
+// left for after the start of the Agent is started under ctx once systemd is
+// told the service is ready. The returned function cancels the transition.
+func (e *Engine) markHealthyAfter(ctx context.Context) func() {
+	timer := e.clk().AfterFunc(agentHealthyAfter, func() {
+		if e.state.transitionFrom(StateStarting, StateHealthy, e.clk().Now()) {
+			log.Infof("Engine state changed from %s to %s", StateStarting, StateHealthy)
+			metrics.SupervisionState.Set(StateHealthy.String())
+			ready := false
+			e.readyOnce.Do(func() {
+				metrics.AgentReadySeconds.Set(e.clk().Since(e.supervisedAt).Seconds())
+				e.completeBootstrap()
+				ready = true
+			})
+			e.writeStatus()
+			// systemd ignores READY=1 once the service started
+			e.notify(sdnotify.Ready)
+			e.releaseScaleInProtection()
+			if ready {
+				e.startPostStart(ctx)
+			}
+		}
+	})
+	return func() {
+		timer.Stop()
+	}
+}
+
+func (e *Engine) writeStatus() {
+	if e.statusWriter == nil {
+		return
+	}
+	data, err := json.Marshal(e.state.current())
+	if err != nil {
+		log.Warnf("Could not encode engine status: %v", err)
+		return
+	}
+	err = e.statusWriter.WriteFile(config.EngineStatusFile(), data, statusFilePerm)
+	if err != nil {
+		log.Warnf("Could not write engine status: %v", err)
+	}
+}
+
+// readStatus reads the status file written by the engine supervising the
+// Agent, which may be another ecs-init process
+func readStatus() (*status, error) {
+	data, err := ioutil.ReadFile(config.EngineStatusFile())
+	if err != nil {
+		return nil, err
+	}
+	var recorded status
+	err = json.Unmarshal(data, &recorded)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the engine status: %w", err)
+	}
+	return &recorded, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateString(t *testing.T) {
+	assert.Equal(t, "Initializing", StateInitializing.String())
+	assert.Equal(t, "Healthy", StateHealthy.String())
+	assert.Equal(t, "Unknown", State(-1).String())
+}
+
+func TestStateUnmarshalText(t *testing.T) {
+	var s State
+	assert.NoError(t, s.UnmarshalText([]byte("Degraded")))
+	assert.Equal(t, StateDegraded, s)
+	assert.Error(t, s.UnmarshalText([]byte("Unknown")))
+}
+
+func TestStateMachineTransition(t *testing.T) {
+	m := stateMachine{}
+	assert.Equal(t, StateInitializing, m.current().State)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	from, ok := m.transition(StateDownloading, now)
+	assert.True(t, ok)
+	assert.Equal(t, StateInitializing, from)
+	assert.Equal(t, StateDownloading, m.current().State)
+	assert.Equal(t, now, m.current().Since)
+
+	from, ok = m.transition(StateHealthy, now.Add(time.Second))
+	assert.False(t, ok, "Downloading cannot move to Healthy")
+	assert.Equal(t, StateDownloading, from)
+	assert.Equal(t, StateDownloading, m.current().State)
+}
+
+func TestStateMachineStoppingIsFinal(t *testing.T) {
+	m := stateMachine{}
+	_, ok := m.transition(StateStopping, time.Now())
+	assert.True(t, ok)
+	for state := range stateNames {
+		_, ok = m.transition(state, time.Now())
+		assert.False(t, ok, "Stopping cannot move to %s", state)
+	}
+}
+
+func TestStateMachineTransitionFrom(t *testing.T) {
+	m := stateMachine{}
+	assert.False(t, m.transitionFrom(StateStarting, StateHealthy, time.Now()))
+	assert.Equal(t, StateInitializing, m.current().State)
+
+	m.transition(StateStarting, time.Now())
+	assert.True(t, m.transitionFrom(StateStarting, StateHealthy, time.Now()))
+	assert.Equal(t, StateHealthy, m.current().State)
+}
+
+func TestEngineTransitionWritesStatus(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockStatusWriter := NewMockstatusWriter(mockCtrl)
+	mockStatusWriter.EXPECT().WriteFile(config.EngineStatusFile(), gomock.Any(), os.FileMode(statusFilePerm)).Do(
+		func(filename string, data []byte, perm os.FileMode) {
+			var s map[string]interface{}
+			assert.NoError(t, json.Unmarshal(data, &s))
+			assert.Equal(t, "Starting", s["state"])
+		}).Return(nil)
+
+	engine := &Engine{
+		statusWriter: mockStatusWriter,
+	}
+	engine.transition(StateStarting)
+	assert.Equal(t, StateStarting, engine.State())
+
+	// invalid transitions are not recorded
+	engine.transition(StateLoading)
+	assert.Equal(t, StateStarting, engine.State())
+}
+
+func TestEngineTransitionStatusWriteError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockStatusWriter := NewMockstatusWriter(mockCtrl)
+	mockStatusWriter.EXPECT().WriteFile(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("test error"))
+
+	engine := &Engine{
+		statusWriter: mockStatusWriter,
+	}
+	engine.transition(StateDownloading)
+	assert.Equal(t, StateDownloading, engine.State())
+}
+
+func TestMarkHealthyAfterCancelled(t *testing.T) {
+	engine := &Engine{}
+	engine.transition(StateStarting)
+	cancel := engine.markHealthyAfter(context.Background())
+	cancel()
+	assert.Equal(t, StateStarting, engine.State())
+}
+
+func TestMarkHealthyAfter(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	engine := &Engine{clock: fakeClock}
+	engine.transition(StateStarting)
+	cancel := engine.markHealthyAfter(context.Background())
+	defer cancel()
+
+	fakeClock.Advance(agentHealthyAfter - time.Second)
+	assert.Equal(t, StateStarting, engine.State())
+	fakeClock.Advance(time.Second)
+	for engine.State() != StateHealthy {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, fakeClock.Now(), engine.state.current().Since)
+}
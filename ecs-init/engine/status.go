@@ -0,0 +1,332 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/cgroup"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// timeSyncAddress is the address of the Amazon Time Sync Service, reached
+// through the link-local address of the instance
+const timeSyncAddress = "169.254.169.123:123"
+
+// statusDockerTimeout is how long status waits for the Docker daemon to
+// respond before reporting it as unreachable
+const statusDockerTimeout = 5 * time.Second
+
+var cgroupHierarchy = cgroup.Detect
+
+// endpointCheck is an endpoint whose connectivity is reported by status
+type endpointCheck struct {
+	name    string
+	address string
+	ntp     bool
+}
+
+// endpointConnectivity is the outcome of probing an endpoint
+type endpointConnectivity struct {
+	Endpoint  string        `json:"endpoint"`
+	Address   string        `json:"address"`
+	Reachable bool          `json:"reachable"`
+	Latency   time.Duration `json:"latency"`
+	// How is how the endpoint was reached, directly, through a proxy or
+	// over NTP
+	How   string `json:"how"`
+	Error string `json:"error,omitempty"`
+}
+
+// agentStatus is the state of the Agent container
+type agentStatus struct {
+	Running     bool   `json:"running"`
+	ContainerID string `json:"containerId,omitempty"`
+	// Version is the version reported by the running Agent
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// dockerStatus is the connectivity of the Docker daemon
+type dockerStatus struct {
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// statusReport is what status reports about the host
+type statusReport struct {
+	// Engine is the state recorded by the engine supervising the Agent,
+	// if any
+	Engine      *status            `json:"engine,omitempty"`
+	Boot        *bootRecord        `json:"boot,omitempty"`
+	Region      string             `json:"region"`
+	RegionError string             `json:"regionError,omitempty"`
+	CachedAgent *cache.CachedAgent `json:"cachedAgent,omitempty"`
+	Agent       agentStatus        `json:"agent"`
+	Docker      dockerStatus       `json:"docker"`
+	Cgroup      cgroup.Hierarchy   `json:"cgroup,omitempty"`
+	LastUpdate  *updateAttempt     `json:"lastUpdate,omitempty"`
+	// Connectivity is the connectivity of the endpoints the Agent depends
+	// on, which are probed on each call
+	Connectivity []endpointConnectivity `json:"connectivity,omitempty"`
+}
+
+// Status writes the state recorded by the engine supervising the Agent to w,
+// followed by the cached and running Agent, the connectivity of Docker, the
+// cgroup hierarchy of the host, the last attempt to update the Agent and the
+// connectivity of the endpoints the Agent depends on, as text or as JSON for
+// fleet tooling
+func (e *Engine) Status(ctx context.Context, w io.Writer, asJSON bool) error {
+	report, err := e.statusReport(ctx)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	if report.Engine == nil {
+		fmt.Fprintf(w, "State:\tunknown, no status in %s\n", config.EngineStatusFile())
+	} else {
+		fmt.Fprintf(w, "State:\t%s since %s\n", report.Engine.State, report.Engine.Since.Format(time.RFC3339))
+		if report.Engine.Registration != "" {
+			fmt.Fprintf(w, "Registration:\t%s\n", report.Engine.Registration)
+		}
+		if report.Engine.TaskMetadata != "" {
+			fmt.Fprintf(w, "Task metadata:\t%s\n", report.Engine.TaskMetadata)
+		}
+		if report.Engine.ConfigDriftPendingRestart {
+			fmt.Fprintf(w, "Config drift:\tpending restart\n")
+		}
+	}
+	if boot := report.Boot; boot != nil {
+		fmt.Fprintf(w, "Boot:\t%d, %s", boot.Boots, boot.Kind)
+		if boot.ClonedFrom != "" {
+			fmt.Fprintf(w, " of %s", boot.ClonedFrom)
+		}
+		fmt.Fprintln(w)
+	}
+	if report.RegionError != "" {
+		fmt.Fprintf(w, "Region:\tunknown, %s\n", report.RegionError)
+	} else {
+		fmt.Fprintf(w, "Region:\t%s\n", report.Region)
+	}
+	if report.CachedAgent != nil {
+		fmt.Fprintf(w, "Cached agent:\t%s\n", report.CachedAgent)
+	} else {
+		fmt.Fprintf(w, "Cached agent:\tnone\n")
+	}
+	switch agent := report.Agent; {
+	case agent.Running && agent.Version != "":
+		fmt.Fprintf(w, "Agent:\trunning in container %s, %s\n", shortContainerID(agent.ContainerID), agent.Version)
+	case agent.Running:
+		fmt.Fprintf(w, "Agent:\trunning in container %s, version unknown: %s\n", shortContainerID(agent.ContainerID), agent.Error)
+	case agent.Error != "":
+		fmt.Fprintf(w, "Agent:\tunknown: %s\n", agent.Error)
+	default:
+		fmt.Fprintf(w, "Agent:\tnot running\n")
+	}
+	if report.Docker.Reachable {
+		fmt.Fprintf(w, "Docker:\treachable\n")
+	} else {
+		fmt.Fprintf(w, "Docker:\tunreachable: %s\n", report.Docker.Error)
+	}
+	if report.Cgroup != "" {
+		fmt.Fprintf(w, "Cgroups:\t%s\n", report.Cgroup)
+	}
+	if update := report.LastUpdate; update != nil {
+		fmt.Fprintf(w, "Last update:\t%s %s at %s", update.Outcome, update.Version, update.At.Format(time.RFC3339))
+		if update.Error != "" {
+			fmt.Fprintf(w, ": %s", update.Error)
+		}
+		fmt.Fprintln(w)
+	}
+	if e.prober == nil {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENDPOINT\tADDRESS\tREACHABLE\tLATENCY\tHOW\tERROR")
+	for _, c := range report.Connectivity {
+		reachable, latency := "no", "-"
+		if c.Reachable {
+			reachable, latency = "yes", c.Latency.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Endpoint, c.Address, reachable, latency, c.How, c.Error)
+	}
+	return tw.Flush()
+}
+
+// statusReport collects the status of the host. Only a status file that
+// cannot be read fails it, the state of the Agent and Docker are reported
+// with their errors instead.
+func (e *Engine) statusReport(ctx context.Context) (*statusReport, error) {
+	report := &statusReport{}
+	recorded, err := readStatus()
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, engineError("could not read the engine status", err)
+	default:
+		report.Engine = recorded
+	}
+	if boot, err := readBootRecord(); err == nil {
+		report.Boot = boot
+	}
+	if attempt, err := readUpdateAttempt(); err == nil {
+		report.LastUpdate = attempt
+	}
+	report.Region, err = e.downloader.Region()
+	if err != nil {
+		report.RegionError = err.Error()
+	}
+	if cached := e.downloader.CachedAgent(); cached.Version != "" {
+		report.CachedAgent = &cached
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, statusDockerTimeout)
+	err = e.docker.Ping(pingCtx)
+	cancel()
+	if err != nil {
+		report.Docker.Error = err.Error()
+		report.Agent.Error = "Docker is unreachable"
+	} else {
+		report.Docker.Reachable = true
+		report.Agent = e.runningAgentStatus(ctx)
+	}
+	if hierarchy, err := cgroupHierarchy(); err == nil {
+		report.Cgroup = hierarchy
+	}
+	if e.prober != nil {
+		report.Connectivity = e.checkConnectivity()
+	}
+	return report, nil
+}
+
+// runningAgentStatus returns the state of the Agent container, asking the
+// running Agent for its version
+func (e *Engine) runningAgentStatus(ctx context.Context) agentStatus {
+	var agent agentStatus
+	id, err := e.docker.RunningAgentContainerID(ctx)
+	if err != nil {
+		agent.Error = err.Error()
+		return agent
+	}
+	if id == "" {
+		return agent
+	}
+	agent.Running = true
+	agent.ContainerID = id
+	metadata, err := e.agentMetadata.Metadata()
+	if err != nil {
+		agent.Error = err.Error()
+		return agent
+	}
+	agent.Version = metadata.Version
+	return agent
+}
+
+// shortContainerID returns the ID of a container as Docker shows it
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// connectivityChecks returns the endpoints reached by ecs-init and the Agent:
+// instance metadata, the Amazon Time Sync Service, and the endpoints of the
+// region of the ECS control plane, ECR, S3 and CloudWatch Logs
+func (e *Engine) connectivityChecks() []endpointCheck {
+	checks := []endpointCheck{
+		{name: "imds", address: config.IMDSEndpoint()},
+		{name: "ntp", address: timeSyncAddress, ntp: true},
+	}
+	// the endpoints of an unknown region are reported as missing
+	region, _ := e.downloader.Region()
+	for _, service := range []struct{ name, id string }{
+		{"ecs", "ecs"},
+		{"ecr", "api.ecr"},
+		{"s3", "s3"},
+		{"logs", "logs"},
+	} {
+		address := ""
+		if service.name == "s3" {
+			address = config.S3Endpoint()
+		}
+		if address == "" {
+			resolved, err := endpoints.DefaultResolver().EndpointFor(service.id, region)
+			if err == nil {
+				address = resolved.URL
+			}
+		}
+		checks = append(checks, endpointCheck{name: service.name, address: address})
+	}
+	return checks
+}
+
+// checkConnectivity probes the endpoints of connectivityChecks concurrently
+func (e *Engine) checkConnectivity() []endpointConnectivity {
+	checks := e.connectivityChecks()
+	results := make([]endpointConnectivity, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check endpointCheck) {
+			defer wg.Done()
+			results[i] = e.probeEndpoint(check)
+		}(i, check)
+	}
+	wg.Wait()
+	return results
+}
+
+func (e *Engine) probeEndpoint(check endpointCheck) endpointConnectivity {
+	result := endpointConnectivity{
+		Endpoint: check.name,
+		Address:  check.address,
+	}
+	if check.address == "" {
+		result.Error = "no endpoint in the region of the instance"
+		return result
+	}
+	start := e.clk().Now()
+	var err error
+	if check.ntp {
+		result.How = "ntp"
+		err = e.prober.ProbeNTP(check.address)
+	} else {
+		result.How, err = e.prober.ProbeHTTP(check.address)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Reachable = true
+	result.Latency = e.clk().Now().Sub(start)
+	return result
+}
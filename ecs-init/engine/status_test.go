@@ -0,0 +1,213 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/cgroup"
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/introspection"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckConnectivity(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockProber := NewMockendpointProber(mockCtrl)
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil)
+	mockProber.EXPECT().ProbeHTTP(config.IMDSEndpoint()).Return("direct", nil)
+	mockProber.EXPECT().ProbeNTP(timeSyncAddress).Return(nil)
+	mockProber.EXPECT().ProbeHTTP("https://ecs.us-west-2.amazonaws.com").Return("proxy proxy:3128", nil)
+	mockProber.EXPECT().ProbeHTTP("https://api.ecr.us-west-2.amazonaws.com").Return("proxy proxy:3128", errors.New("test error"))
+	mockProber.EXPECT().ProbeHTTP("https://s3.us-west-2.amazonaws.com").Return("direct", nil)
+	mockProber.EXPECT().ProbeHTTP("https://logs.us-west-2.amazonaws.com").Return("proxy proxy:3128", nil)
+
+	engine := &Engine{
+		downloader: mockDownloader,
+		prober:     mockProber,
+		clock:      clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	results := engine.checkConnectivity()
+	assert.Len(t, results, 6)
+	assert.Equal(t, endpointConnectivity{Endpoint: "imds", Address: config.IMDSEndpoint(), Reachable: true, How: "direct"}, results[0])
+	assert.Equal(t, "ntp", results[1].How)
+	assert.True(t, results[1].Reachable)
+	assert.Equal(t, "ecr", results[3].Endpoint)
+	assert.False(t, results[3].Reachable)
+	assert.Equal(t, "proxy proxy:3128", results[3].How)
+	assert.Equal(t, "test error", results[3].Error)
+}
+
+func TestCheckConnectivityS3Endpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.S3EndpointEnvVar, "https://bucket.vpce-0123.s3.us-west-2.vpce.amazonaws.com")
+	defer os.Unsetenv(config.S3EndpointEnvVar)
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil)
+	engine := &Engine{downloader: mockDownloader}
+	checks := engine.connectivityChecks()
+	assert.Equal(t, endpointCheck{name: "s3", address: "https://bucket.vpce-0123.s3.us-west-2.vpce.amazonaws.com"}, checks[4])
+}
+
+func TestProbeEndpointWithoutAddress(t *testing.T) {
+	engine := &Engine{}
+	result := engine.probeEndpoint(endpointCheck{name: "logs"})
+	assert.False(t, result.Reachable)
+	assert.NotEmpty(t, result.Error)
+}
+
+func TestStatusConnectivityMatrix(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockProber := NewMockendpointProber(mockCtrl)
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil).Times(2)
+	mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{})
+	mockDocker.EXPECT().Ping(gomock.Any()).Return(nil)
+	mockDocker.EXPECT().RunningAgentContainerID(gomock.Any()).Return("", nil)
+	mockProber.EXPECT().ProbeHTTP(gomock.Any()).Return("direct", nil).Times(5)
+	mockProber.EXPECT().ProbeNTP(timeSyncAddress).Return(errors.New("i/o timeout"))
+
+	engine := &Engine{
+		downloader: mockDownloader,
+		docker:     mockDocker,
+		prober:     mockProber,
+		clock:      clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	var out bytes.Buffer
+	assert.NoError(t, engine.Status(context.Background(), &out, false))
+	assert.Contains(t, out.String(), "Cached agent:\tnone\n")
+	assert.Contains(t, out.String(), "Agent:\tnot running\n")
+	assert.Regexp(t, `(?m)^ENDPOINT +ADDRESS +REACHABLE +LATENCY +HOW +ERROR$`, out.String())
+	assert.Regexp(t, `(?m)^ecs +https://ecs.us-west-2.amazonaws.com +yes +0s +direct`, out.String())
+	assert.Regexp(t, `(?m)^ntp +169.254.169.123:123 +no +- +ntp +i/o timeout$`, out.String())
+}
+
+func TestStatusJSON(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cached := cache.CachedAgent{Version: "v1.40.0", SHA256: "abcdef"}
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockMetadata := NewMockagentMetadata(mockCtrl)
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil)
+	mockDownloader.EXPECT().CachedAgent().Return(cached)
+	mockDocker.EXPECT().Ping(gomock.Any()).Return(nil)
+	mockDocker.EXPECT().RunningAgentContainerID(gomock.Any()).Return("0123456789abcdef", nil)
+	mockMetadata.EXPECT().Metadata().Return(&introspection.Metadata{Version: "Amazon ECS Agent - v1.40.0 (abcdef)"}, nil)
+
+	defer func() { cgroupHierarchy = cgroup.Detect }()
+	cgroupHierarchy = func() (cgroup.Hierarchy, error) { return cgroup.Unified, nil }
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker, agentMetadata: mockMetadata}
+	var out bytes.Buffer
+	assert.NoError(t, engine.Status(context.Background(), &out, true))
+	var report statusReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, "us-west-2", report.Region)
+	assert.Equal(t, &cached, report.CachedAgent)
+	assert.Equal(t, agentStatus{
+		Running:     true,
+		ContainerID: "0123456789abcdef",
+		Version:     "Amazon ECS Agent - v1.40.0 (abcdef)",
+	}, report.Agent)
+	assert.True(t, report.Docker.Reachable)
+	assert.Equal(t, cgroup.Unified, report.Cgroup)
+	assert.Empty(t, report.Connectivity)
+
+	var text bytes.Buffer
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil)
+	mockDownloader.EXPECT().CachedAgent().Return(cached)
+	mockDocker.EXPECT().Ping(gomock.Any()).Return(nil)
+	mockDocker.EXPECT().RunningAgentContainerID(gomock.Any()).Return("0123456789abcdef", nil)
+	mockMetadata.EXPECT().Metadata().Return(nil, errors.New("connection refused"))
+	assert.NoError(t, engine.Status(context.Background(), &text, false))
+	assert.Contains(t, text.String(), "Agent:\trunning in container 0123456789ab, version unknown: connection refused\n")
+	assert.Contains(t, text.String(), "Cgroups:\tv2\n")
+}
+
+func TestStatusDockerUnreachable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil)
+	mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{})
+	mockDocker.EXPECT().Ping(gomock.Any()).Return(errors.New("no such file or directory"))
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker}
+	report, err := engine.statusReport(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, dockerStatus{Error: "no such file or directory"}, report.Docker)
+	assert.False(t, report.Agent.Running)
+	assert.NotEmpty(t, report.Agent.Error)
+}
+
+func TestStatusDockerUnresponsive(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader.EXPECT().Region().Return("us-west-2", nil)
+	mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{})
+	mockDocker.EXPECT().Ping(gomock.Any()).DoAndReturn(func(ctx context.Context) error {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok, "Expect the ping to have a deadline")
+		assert.WithinDuration(t, time.Now().Add(statusDockerTimeout), deadline, time.Second)
+		return context.DeadlineExceeded
+	})
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker}
+	report, err := engine.statusReport(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, report.Docker.Reachable)
+}
+
+func TestStatusRegionUnavailable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader.EXPECT().Region().Return("", fmt.Errorf("%w: test error", config.ErrRegionUnavailable))
+	mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{})
+	mockDocker.EXPECT().Ping(gomock.Any()).Return(errors.New("no such file or directory"))
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker}
+	var out bytes.Buffer
+	assert.NoError(t, engine.Status(context.Background(), &out, false))
+	assert.Contains(t, out.String(), "Region:\tunknown, region unavailable: test error\n")
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/ec2client"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/introspection"
+	"github.com/aws/amazon-ecs-init/ecs-init/version"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	agentVersionTag   = "ecs-init:agent-version"
+	ecsInitVersionTag = "ecs-init:version"
+	bootstrapTimeTag  = "ecs-init:bootstrap-time"
+)
+
+// registrationTargets are the resources tagged once the Agent registered the
+// instance
+type registrationTargets struct {
+	ec2Instance       bool
+	containerInstance bool
+}
+
+// startRegistrationTagging tags the EC2 instance and the container instance
+// with the versions of the Agent and ecs-init once the Agent registered the
+// instance, as set in the environment. The returned function stops waiting
+// for the registration.
+func (e *Engine) startRegistrationTagging(ctx context.Context) func() {
+	var targets registrationTargets
+	var err error
+	targets.ec2Instance, targets.containerInstance, err = config.RegistrationTagging()
+	if err != nil {
+		log.Warnf("Not tagging the instance: %v", err)
+		return func() {}
+	}
+	if !targets.ec2Instance && !targets.containerInstance {
+		return func() {}
+	}
+	if e.offline {
+		log.Warnf("Not tagging the instance in offline mode")
+		return func() {}
+	}
+	if targets.containerInstance {
+		if _, err := e.ecsClient(); err != nil {
+			log.Warnf("Not tagging the container instance: %v", err)
+			targets.containerInstance = false
+		}
+	}
+	if targets.ec2Instance {
+		if _, err := e.ec2Client(); err != nil {
+			log.Warnf("Not tagging the EC2 instance: %v", err)
+			targets.ec2Instance = false
+		}
+	}
+	started := e.clk().Now()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := e.clk().NewTicker(registrationPollInterval)
+		defer ticker.Stop()
+		for {
+			metadata, err := e.agentMetadata.Metadata()
+			if err == nil && metadata.ContainerInstanceArn != "" {
+				e.tagRegistration(targets, metadata, registrationTags(metadata, started))
+				return
+			}
+			select {
+			case <-ticker.C():
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// registrationTags returns the tags of the instance registered by the Agent
+// started at started
+func registrationTags(metadata *introspection.Metadata, started time.Time) map[string]string {
+	return map[string]string{
+		agentVersionTag:   metadata.Version,
+		ecsInitVersionTag: version.Version,
+		bootstrapTimeTag:  started.UTC().Format(time.RFC3339),
+	}
+}
+
+// tagRegistration tags the targets with tags. Failures are logged, as the
+// tags are informational.
+func (e *Engine) tagRegistration(targets registrationTargets, metadata *introspection.Metadata, tags map[string]string) {
+	if targets.ec2Instance {
+		err := e.tagEC2Instance(tags)
+		if err != nil {
+			log.Warnf("Could not tag the EC2 instance: %v", err)
+		} else {
+			log.Info("Tagged the EC2 instance")
+		}
+	}
+	if targets.containerInstance {
+		input := &ecsclient.TagResourceInput{ResourceArn: metadata.ContainerInstanceArn}
+		for key, value := range tags {
+			input.Tags = append(input.Tags, ecsclient.Tag{Key: key, Value: value})
+		}
+		sort.Slice(input.Tags, func(i, j int) bool {
+			return input.Tags[i].Key < input.Tags[j].Key
+		})
+		_, err := e.ecsAPI.TagResource(input)
+		if err != nil {
+			log.Warnf("Could not tag the container instance %s: %v", metadata.ContainerInstanceArn, err)
+		} else {
+			log.Infof("Tagged the container instance %s", metadata.ContainerInstanceArn)
+		}
+	}
+}
+
+func (e *Engine) tagEC2Instance(tags map[string]string) error {
+	instanceID, err := e.downloader.InstanceID()
+	if err != nil {
+		return errors.Wrap(err, "could not get the instance ID")
+	}
+	return e.ec2API.CreateTags(instanceID, tags)
+}
+
+// ec2Client returns the client of the Amazon EC2 API, creating it for the
+// region of the instance on first use
+func (e *Engine) ec2Client() (ec2API, error) {
+	if e.ec2API == nil {
+		region, err := e.downloader.Region()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create EC2 client")
+		}
+		client, err := ec2client.New(region)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create EC2 client")
+		}
+		e.ec2API = client
+		e.dryRunAWSClients()
+	}
+	return e.ec2API, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/ecsclient"
+	"github.com/aws/amazon-ecs-init/ecs-init/introspection"
+	"github.com/aws/amazon-ecs-init/ecs-init/version"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestStartRegistrationTaggingDisabled(t *testing.T) {
+	os.Unsetenv(config.RegistrationTaggingEnvVar)
+	engine := &Engine{}
+	engine.startRegistrationTagging(context.Background())()
+}
+
+func TestStartRegistrationTagging(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.RegistrationTaggingEnvVar, "ec2-instance,container-instance")
+	defer os.Unsetenv(config.RegistrationTaggingEnvVar)
+
+	started := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	tags := map[string]string{
+		agentVersionTag:   "Amazon ECS Agent - v1.40.0 (abcdef)",
+		ecsInitVersionTag: version.Version,
+		bootstrapTimeTag:  "2020-06-01T12:00:00Z",
+	}
+	mockMetadata := NewMockagentMetadata(mockCtrl)
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockEC2 := NewMockec2API(mockCtrl)
+	mockECS := NewMockecsAPI(mockCtrl)
+	tagged := make(chan struct{})
+	gomock.InOrder(
+		mockMetadata.EXPECT().Metadata().Return(nil, errors.New("test error")),
+		mockMetadata.EXPECT().Metadata().Return(&introspection.Metadata{Version: tags[agentVersionTag]}, nil),
+		mockMetadata.EXPECT().Metadata().Return(&introspection.Metadata{
+			ContainerInstanceArn: "arn:aws:ecs:us-west-2:123456789012:container-instance/default/1234",
+			Version:              tags[agentVersionTag],
+		}, nil),
+		mockDownloader.EXPECT().InstanceID().Return("i-1234", nil),
+		mockEC2.EXPECT().CreateTags("i-1234", tags).Return(nil),
+		mockECS.EXPECT().TagResource(&ecsclient.TagResourceInput{
+			ResourceArn: "arn:aws:ecs:us-west-2:123456789012:container-instance/default/1234",
+			Tags: []ecsclient.Tag{
+				{Key: agentVersionTag, Value: tags[agentVersionTag]},
+				{Key: bootstrapTimeTag, Value: tags[bootstrapTimeTag]},
+				{Key: ecsInitVersionTag, Value: version.Version},
+			},
+		}).Do(func(*ecsclient.TagResourceInput) { close(tagged) }).Return(&ecsclient.TagResourceOutput{}, nil),
+	)
+
+	fakeClock := clock.NewFake(started)
+	engine := &Engine{
+		agentMetadata: mockMetadata,
+		downloader:    mockDownloader,
+		ec2API:        mockEC2,
+		ecsAPI:        mockECS,
+		clock:         fakeClock,
+	}
+	stop := engine.startRegistrationTagging(context.Background())
+	for i := 0; i < 2; i++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(registrationPollInterval)
+	}
+	<-tagged
+	stop()
+}
+
+func TestTagRegistrationFailures(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockECS := NewMockecsAPI(mockCtrl)
+	mockDownloader.EXPECT().InstanceID().Return("", errors.New("test error"))
+	mockECS.EXPECT().TagResource(gomock.Any()).Return(nil, errors.New("test error"))
+
+	engine := &Engine{downloader: mockDownloader, ecsAPI: mockECS}
+	engine.tagRegistration(registrationTargets{ec2Instance: true, containerInstance: true},
+		&introspection.Metadata{ContainerInstanceArn: "arn"}, map[string]string{"team": "payments"})
+}
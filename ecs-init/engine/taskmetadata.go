@@ -0,0 +1,104 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	taskMetadataResponding = "Responding"
+	taskMetadataFailed     = "Failed"
+	// taskMetadataAttempts is how many times the task metadata endpoint is
+	// requested before the check fails
+	taskMetadataAttempts = 3
+)
+
+// taskMetadataPollInterval is how often the engine is checked for a healthy
+// Agent before the task metadata endpoint is requested, and how long is
+// waited between requests
+var taskMetadataPollInterval = 5 * time.Second
+
+// startTaskMetadataCheck requests the task metadata endpoint from a scratch
+// network namespace in the background once the Agent is healthy, and records
+// the outcome in the status file, so that broken task networking is caught
+// before tasks are placed on the instance. The returned function cancels the
+// check.
+func (e *Engine) startTaskMetadataCheck(ctx context.Context) func() {
+	if !config.TaskMetadataCheck() || e.taskMetadataProbe == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := e.checkTaskMetadata(ctx)
+		switch {
+		case err == nil:
+			e.recordTaskMetadata(taskMetadataResponding)
+		case ctx.Err() == nil:
+			log.Errorf("Task metadata endpoint is not reachable by tasks: %v", err)
+			e.recordTaskMetadata(taskMetadataFailed)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// checkTaskMetadata waits for the Agent to be healthy and requests the task
+// metadata endpoint until it answers, taskMetadataAttempts requests fail or
+// ctx is done
+func (e *Engine) checkTaskMetadata(ctx context.Context) error {
+	ticker := e.clk().NewTicker(taskMetadataPollInterval)
+	defer ticker.Stop()
+	for e.State() != StateHealthy {
+		select {
+		case <-ticker.C():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		var status int
+		status, err = e.taskMetadataProbe.Probe()
+		if err == nil {
+			log.Infof("Task metadata endpoint answered a request from a task network namespace with status %d", status)
+			return nil
+		}
+		if attempt == taskMetadataAttempts {
+			return err
+		}
+		log.Debugf("Task metadata endpoint check failed (%d/%d): %v", attempt, taskMetadataAttempts, err)
+		select {
+		case <-ticker.C():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// recordTaskMetadata records the outcome of the task metadata endpoint check
+// in the status file
+func (e *Engine) recordTaskMetadata(taskMetadata string) {
+	e.state.setTaskMetadata(taskMetadata)
+	e.writeStatus()
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// healthyEngine returns an engine supervising a healthy Agent
+func healthyEngine(probe taskMetadataProbe) *Engine {
+	engine := &Engine{taskMetadataProbe: probe}
+	engine.state.transition(StateStarting, time.Now())
+	engine.state.transition(StateHealthy, time.Now())
+	return engine
+}
+
+func TestCheckTaskMetadata(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockProbe := NewMocktaskMetadataProbe(mockCtrl)
+	gomock.InOrder(
+		mockProbe.EXPECT().Probe().Return(0, errors.New("no response")),
+		mockProbe.EXPECT().Probe().Return(400, nil),
+	)
+
+	defer func(interval time.Duration) { taskMetadataPollInterval = interval }(taskMetadataPollInterval)
+	taskMetadataPollInterval = time.Millisecond
+	engine := healthyEngine(mockProbe)
+	assert.NoError(t, engine.checkTaskMetadata(context.Background()))
+}
+
+func TestCheckTaskMetadataFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockProbe := NewMocktaskMetadataProbe(mockCtrl)
+	mockProbe.EXPECT().Probe().Return(0, errors.New("no response")).Times(taskMetadataAttempts)
+
+	defer func(interval time.Duration) { taskMetadataPollInterval = interval }(taskMetadataPollInterval)
+	taskMetadataPollInterval = time.Millisecond
+	engine := healthyEngine(mockProbe)
+	assert.Error(t, engine.checkTaskMetadata(context.Background()))
+}
+
+func TestCheckTaskMetadataWaitsForHealthy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	// the Agent never becomes healthy, so the endpoint is not requested
+	mockProbe := NewMocktaskMetadataProbe(mockCtrl)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	defer func(interval time.Duration) { taskMetadataPollInterval = interval }(taskMetadataPollInterval)
+	taskMetadataPollInterval = time.Millisecond
+	engine := &Engine{taskMetadataProbe: mockProbe}
+	err := engine.checkTaskMetadata(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "Expect the deadline, got: %v", err)
+}
+
+func TestStartTaskMetadataCheckRecordsOutcome(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.TaskMetadataCheckEnvVar, "true")
+	defer os.Unsetenv(config.TaskMetadataCheckEnvVar)
+	mockProbe := NewMocktaskMetadataProbe(mockCtrl)
+	probed := make(chan struct{})
+	mockProbe.EXPECT().Probe().Do(func() { close(probed) }).Return(400, nil)
+
+	engine := healthyEngine(mockProbe)
+	stop := engine.startTaskMetadataCheck(context.Background())
+	<-probed
+	stop()
+	assert.Equal(t, taskMetadataResponding, engine.state.current().TaskMetadata)
+}
+
+func TestStartTaskMetadataCheckDisabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	engine := healthyEngine(NewMocktaskMetadataProbe(mockCtrl))
+	stop := engine.startTaskMetadataCheck(context.Background())
+	stop()
+	assert.Empty(t, engine.state.current().TaskMetadata)
+}
@@ -0,0 +1,244 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+	"github.com/aws/amazon-ecs-init/ecs-init/history"
+	"github.com/aws/amazon-ecs-init/ecs-init/maintenance"
+
+	log "github.com/cihub/seelog"
+)
+
+// agentLoadThroughput is the rate at which Docker is assumed to load an
+// Agent image, to estimate how long the Agent is down while it is updated
+const agentLoadThroughput = 50 * 1024 * 1024
+
+// agentStateFiles are the files the Agent saves the state of its tasks to in
+// its data directory
+var agentStateFiles = []string{"agent.db", "ecs_agent_data.json"}
+
+// updatePlan is what updating the Agent to the published Agent would do
+type updatePlan struct {
+	CurrentVersion string
+	CurrentSHA256  string
+	TargetVersion  string
+	UpToDate       bool
+	// DownloadSize is the size of the published tarball, or -1 if unknown
+	DownloadSize int64
+	// TaskState describes whether the target Agent can read the state of
+	// the tasks saved by the current Agent
+	TaskState           string
+	TaskStateCompatible bool
+	ExpectedDowntime    time.Duration
+	// Blockers are the reasons the update would not happen now
+	Blockers []string
+}
+
+// PlanAgentUpdate writes to w what updating the Agent to the published Agent
+// would do, without changing anything
+func (e *Engine) PlanAgentUpdate(ctx context.Context, w io.Writer) error {
+	plan := e.planAgentUpdate(ctx)
+	current := plan.CurrentVersion
+	if current == "" {
+		current = "none"
+	} else if plan.CurrentSHA256 != "" {
+		current += " (sha256 " + plan.CurrentSHA256 + ")"
+	}
+	fmt.Fprintf(w, "Current version:\t%s\n", current)
+	fmt.Fprintf(w, "Target version:\t%s\n", plan.TargetVersion)
+	if plan.UpToDate {
+		fmt.Fprintf(w, "Up to date:\tyes\n")
+	} else {
+		fmt.Fprintf(w, "Up to date:\tno\n")
+	}
+	if plan.DownloadSize >= 0 {
+		fmt.Fprintf(w, "Download size:\t%d bytes\n", plan.DownloadSize)
+	} else {
+		fmt.Fprintf(w, "Download size:\tunknown\n")
+	}
+	fmt.Fprintf(w, "Task state:\t%s\n", plan.TaskState)
+	fmt.Fprintf(w, "Expected downtime:\tabout %s\n", plan.ExpectedDowntime)
+	if len(plan.Blockers) == 0 {
+		fmt.Fprintf(w, "Blockers:\tnone\n")
+	}
+	for _, blocker := range plan.Blockers {
+		fmt.Fprintf(w, "Blocker:\t%s\n", blocker)
+	}
+	return nil
+}
+
+// planAgentUpdate gathers what updating the Agent would do. Failing checks
+// are reported as blockers rather than failing the plan.
+func (e *Engine) planAgentUpdate(ctx context.Context) updatePlan {
+	cached := e.downloader.CachedAgent()
+	plan := updatePlan{
+		CurrentVersion: cached.Version,
+		CurrentSHA256:  cached.SHA256,
+		TargetVersion:  e.downloader.AgentVersion(),
+		DownloadSize:   -1,
+	}
+	plan.TaskStateCompatible, plan.TaskState = taskStateCompatibility(plan.CurrentVersion, plan.TargetVersion,
+		agentStateSaved())
+	if !plan.TaskStateCompatible {
+		plan.Blockers = append(plan.Blockers, "the target Agent cannot read the state of the tasks")
+	}
+
+	switch {
+	case e.offline:
+		plan.Blockers = append(plan.Blockers, "offline mode, the Agent is updated by pre-seeding it in the cache")
+	case e.agentRegistry != "":
+		plan.Blockers = append(plan.Blockers,
+			fmt.Sprintf("the Agent is pulled from %s, update it by changing %s", e.agentRegistry, config.AgentVersionEnvVar))
+	default:
+		outdated, err := e.downloader.IsAgentOutdated(ctx)
+		if err != nil {
+			plan.Blockers = append(plan.Blockers, fmt.Sprintf("could not check the published Agent: %v", err))
+		}
+		plan.UpToDate = err == nil && !outdated
+		size, err := e.downloader.PublishedAgentSize(ctx)
+		if err != nil {
+			log.Debugf("Could not get the size of the published Agent: %v", err)
+		} else {
+			plan.DownloadSize = size
+		}
+		if _, err := os.Stat(config.AgentSigningKeyFile()); err != nil && !os.IsNotExist(err) {
+			plan.Blockers = append(plan.Blockers, fmt.Sprintf("the Agent cannot be verified: %v", err))
+		}
+	}
+
+	if err := e.docker.Ping(ctx); err != nil {
+		plan.Blockers = append(plan.Blockers, fmt.Sprintf("docker is unavailable: %v", err))
+	}
+	now := e.clk().Now()
+	if !e.maintenanceWindowOpen(now) {
+		blocker := "outside of the maintenance windows"
+		schedule, _ := maintenance.ParseSchedule(config.MaintenanceWindows())
+		if next, ok := schedule.Next(now); ok {
+			blocker += ", the next one starts at " + next.Format(time.RFC3339)
+		}
+		plan.Blockers = append(plan.Blockers, blocker)
+	}
+
+	// the Agent is down from when it is asked to stop until the new image is
+	// loaded and the Agent is started again
+	plan.ExpectedDowntime = docker.AgentStopTimeout
+	if plan.DownloadSize > 0 {
+		plan.ExpectedDowntime += time.Duration(plan.DownloadSize) * time.Second / agentLoadThroughput
+	}
+	return plan
+}
+
+// taskStateCompatibility returns whether the Agent of version target can
+// read the task state saved by the Agent of version current, if stateSaved.
+// The Agent does not read state saved by a newer Agent, so downgrading an
+// Agent with saved state loses track of its tasks.
+func taskStateCompatibility(current, target string, stateSaved bool) (bool, string) {
+	if !stateSaved {
+		return true, "compatible, no task state is saved"
+	}
+	if newer, ok := isNewerAgentVersion(current, target); ok && newer {
+		return false, fmt.Sprintf("incompatible, the task state saved by %s cannot be read by %s", current, target)
+	}
+	return true, "compatible"
+}
+
+// agentStateSaved returns true if the Agent saved the state of its tasks
+func agentStateSaved() bool {
+	for _, name := range agentStateFiles {
+		if _, err := os.Stat(filepath.Join(config.AgentDataDirectory(), name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isNewerAgentVersion returns whether Agent version a is newer than b. ok is
+// false when either is not a release version like v1.40.0, e.g. latest.
+func isNewerAgentVersion(a, b string) (newer bool, ok bool) {
+	av, aok := parseAgentVersion(a)
+	bv, bok := parseAgentVersion(b)
+	if !aok || !bok {
+		return false, false
+	}
+	for i := range av {
+		if av[i] != bv[i] {
+			return av[i] > bv[i], true
+		}
+	}
+	return false, true
+}
+
+// parseAgentVersion parses a release version like v1.40.0
+func parseAgentVersion(version string) ([3]int, bool) {
+	var parsed [3]int
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) != len(parsed) {
+		return parsed, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
+
+// UpdateAgent downloads the published Agent when it differs from the cached
+// Agent and loads it into Docker. The Agent must be stopped, as the running
+// Agent is updated by the engine supervising it instead.
+func (e *Engine) UpdateAgent(ctx context.Context) error {
+	running, err := e.docker.IsAgentRunning(ctx)
+	if err != nil {
+		return engineError("could not check if the Agent is running", err)
+	}
+	if running {
+		return fmt.Errorf("the Agent must be stopped to update it, or updated while it runs by setting %s",
+			config.AutoUpdateIntervalEnvVar)
+	}
+	if e.offline || e.agentRegistry != "" {
+		return errors.New("the Agent is not downloaded from S3, use reload-cache instead")
+	}
+	outdated, err := e.downloader.IsAgentOutdated(ctx)
+	if err != nil {
+		e.recordUpdateAttempt(updateFailed, err)
+		return engineError("could not check the published Agent", err)
+	}
+	if !outdated {
+		log.Infof("Agent %s is up to date", e.downloader.AgentVersion())
+		e.recordUpdateAttempt(updateUpToDate, nil)
+		return nil
+	}
+	err = e.downloadAndLoadCache(ctx)
+	if err != nil {
+		e.recordUpdateAttempt(updateFailed, err)
+		return err
+	}
+	e.recordUpdateAttempt(updateDownloaded, nil)
+	e.recordAgentEvent(history.KindUpgrade)
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cache"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/docker"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsNewerAgentVersion(t *testing.T) {
+	cases := []struct {
+		a, b  string
+		newer bool
+		ok    bool
+	}{
+		{"v1.40.0", "v1.39.9", true, true},
+		{"v1.40.0", "v1.40.0", false, true},
+		{"v1.9.0", "v1.10.0", false, true},
+		{"v2.0.0", "v1.99.99", true, true},
+		{"v1.40.0", "latest", false, false},
+		{"", "v1.40.0", false, false},
+	}
+	for _, c := range cases {
+		newer, ok := isNewerAgentVersion(c.a, c.b)
+		assert.Equal(t, c.newer, newer, "%s newer than %s", c.a, c.b)
+		assert.Equal(t, c.ok, ok, "%s compared to %s", c.a, c.b)
+	}
+}
+
+func TestTaskStateCompatibility(t *testing.T) {
+	compatible, _ := taskStateCompatibility("v1.40.0", "v1.39.0", false)
+	assert.True(t, compatible, "Expect a downgrade without saved state to be compatible")
+	compatible, _ = taskStateCompatibility("v1.40.0", "v1.39.0", true)
+	assert.False(t, compatible, "Expect a downgrade with saved state to be incompatible")
+	compatible, _ = taskStateCompatibility("v1.39.0", "v1.40.0", true)
+	assert.True(t, compatible)
+	compatible, _ = taskStateCompatibility("v1.40.0", "latest", true)
+	assert.True(t, compatible)
+}
+
+func TestPlanAgentUpdate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{Version: "v1.40.0", SHA256: "abc"})
+	mockDownloader.EXPECT().AgentVersion().Return("latest")
+	mockDownloader.EXPECT().IsAgentOutdated(gomock.Any()).Return(true, nil)
+	mockDownloader.EXPECT().PublishedAgentSize(gomock.Any()).Return(int64(100*1024*1024), nil)
+	mockDocker.EXPECT().Ping(gomock.Any()).Return(nil)
+	mockDocker.EXPECT().LoadImage(gomock.Any(), gomock.Any()).Times(0)
+	mockDocker.EXPECT().StopAgent(gomock.Any()).Times(0)
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker}
+	plan := engine.planAgentUpdate(context.Background())
+	assert.Equal(t, "v1.40.0", plan.CurrentVersion)
+	assert.Equal(t, "latest", plan.TargetVersion)
+	assert.False(t, plan.UpToDate)
+	assert.Equal(t, int64(100*1024*1024), plan.DownloadSize)
+	assert.True(t, plan.TaskStateCompatible)
+	assert.Equal(t, docker.AgentStopTimeout+2*time.Second, plan.ExpectedDowntime)
+}
+
+func TestPlanAgentUpdateBlockers(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.MaintenanceWindowsEnvVar, neverOpenWindow)
+	defer os.Unsetenv(config.MaintenanceWindowsEnvVar)
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDownloader.EXPECT().CachedAgent().Return(cache.CachedAgent{Version: "v1.40.0"})
+	mockDownloader.EXPECT().AgentVersion().Return("v1.40.0")
+	mockDownloader.EXPECT().IsAgentOutdated(gomock.Any()).Times(0)
+	mockDocker.EXPECT().Ping(gomock.Any()).Return(errors.New("test error"))
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker, offline: true}
+	var out bytes.Buffer
+	assert.NoError(t, engine.PlanAgentUpdate(context.Background(), &out))
+	assert.Contains(t, out.String(), "Download size:\tunknown\n")
+	assert.Contains(t, out.String(), "Blocker:\toffline mode")
+	assert.Contains(t, out.String(), "Blocker:\tdocker is unavailable: test error\n")
+	assert.Contains(t, out.String(), "Blocker:\toutside of the maintenance windows")
+}
+
+func TestUpdateAgentRunning(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().IsAgentRunning(gomock.Any()).Return(true, nil)
+	mockDownloader.EXPECT().DownloadAgent(gomock.Any()).Times(0)
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker}
+	assert.Error(t, engine.UpdateAgent(context.Background()))
+}
+
+func TestUpdateAgentUpToDate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDownloader := NewMockdownloader(mockCtrl)
+	mockDocker := NewMockdockerClient(mockCtrl)
+	mockDocker.EXPECT().IsAgentRunning(gomock.Any()).Return(false, nil)
+	mockDownloader.EXPECT().IsAgentOutdated(gomock.Any()).Return(false, nil)
+	mockDownloader.EXPECT().AgentVersion().Return("latest")
+	mockDownloader.EXPECT().DownloadAgent(gomock.Any()).Times(0)
+
+	engine := &Engine{downloader: mockDownloader, docker: mockDocker}
+	assert.NoError(t, engine.UpdateAgent(context.Background()))
+}
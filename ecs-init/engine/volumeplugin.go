@@ -0,0 +1,54 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+// startVolumePlugin starts supervising the volume plugin for as long as the
+// Agent is supervised. The returned function stops the volume plugin.
+func (e *Engine) startVolumePlugin() func() {
+	if !config.VolumePluginEnabled() {
+		return func() {}
+	}
+	log.Info("Starting Amazon Elastic Container Service volume plugin")
+	err := e.volumePlugin.Start()
+	if err != nil {
+		// tasks that do not use the local volume driver can still run
+		log.Errorf("Could not start volume plugin: %v", err)
+		return func() {}
+	}
+	return func() {
+		log.Info("Stopping Amazon Elastic Container Service volume plugin")
+		err := e.volumePlugin.Stop()
+		if err != nil {
+			log.Warnf("Could not stop volume plugin: %v", err)
+		}
+	}
+}
+
+// restartUpdatedVolumePlugin restarts the volume plugin after an Agent
+// upgrade replaced it, so that it stays in step with the Agent
+func (e *Engine) restartUpdatedVolumePlugin() {
+	if !config.VolumePluginEnabled() {
+		return
+	}
+	err := e.volumePlugin.RestartIfUpdated()
+	if err != nil {
+		log.Warnf("Could not restart updated volume plugin: %v", err)
+	}
+}
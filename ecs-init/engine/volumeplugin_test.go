@@ -0,0 +1,70 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestStartVolumePlugin(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.VolumePluginEnvVar, "true")
+	defer os.Unsetenv(config.VolumePluginEnvVar)
+
+	mockVolumePlugin := NewMockvolumePlugin(mockCtrl)
+	gomock.InOrder(
+		mockVolumePlugin.EXPECT().Start(),
+		mockVolumePlugin.EXPECT().RestartIfUpdated(),
+		mockVolumePlugin.EXPECT().Stop(),
+	)
+
+	engine := &Engine{
+		volumePlugin: mockVolumePlugin,
+	}
+	stop := engine.startVolumePlugin()
+	engine.restartUpdatedVolumePlugin()
+	stop()
+}
+
+func TestStartVolumePluginNotInstalled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	os.Setenv(config.VolumePluginEnvVar, "true")
+	defer os.Unsetenv(config.VolumePluginEnvVar)
+
+	mockVolumePlugin := NewMockvolumePlugin(mockCtrl)
+	mockVolumePlugin.EXPECT().Start().Return(errors.New("not installed"))
+
+	engine := &Engine{
+		volumePlugin: mockVolumePlugin,
+	}
+	stop := engine.startVolumePlugin()
+	stop()
+}
+
+func TestStartVolumePluginDisabled(t *testing.T) {
+	engine := &Engine{}
+	stop := engine.startVolumePlugin()
+	engine.restartUpdatedVolumePlugin()
+	stop()
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package apparmor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	apparmorParserExecutable = "apparmor_parser"
+	// ProfileFile is where the profile of the Agent container is installed,
+	// so that it is also loaded at boot by the AppArmor service
+	ProfileFile = "/etc/apparmor.d/ecs-agent-default"
+	profilePerm = 0644
+)
+
+// enabledFile reports 'Y' when the AppArmor module of the kernel is enabled
+var enabledFile = "/sys/module/apparmor/parameters/enabled"
+
+// Enabled returns if the kernel confines processes with AppArmor, as it does
+// by default on Ubuntu and Debian
+func Enabled() bool {
+	data, err := ioutil.ReadFile(enabledFile)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(data)) == "Y"
+}
+
+// ProfileLoader implements the engine.appArmorProfile interface by
+// installing the profile of the Agent container and loading it with the
+// external 'apparmor_parser' command
+type ProfileLoader struct {
+	cmdExec     exec.Exec
+	profileFile string
+}
+
+// NewProfileLoader creates a new ProfileLoader object
+func NewProfileLoader(cmdExec exec.Exec) *ProfileLoader {
+	return &ProfileLoader{
+		cmdExec:     cmdExec,
+		profileFile: ProfileFile,
+	}
+}
+
+// Load installs the profile of the Agent container, unless it is installed
+// already, and loads it into the kernel, replacing the profile loaded by a
+// previous version of ecs-init
+func (l *ProfileLoader) Load() error {
+	_, err := l.cmdExec.LookPath(apparmorParserExecutable)
+	if err != nil {
+		return errors.Wrapf(err, "could not find '%s' executable", apparmorParserExecutable)
+	}
+	err = l.install()
+	if err != nil {
+		return err
+	}
+	out, err := l.cmdExec.Command(apparmorParserExecutable, "--replace", "--write-cache", l.profileFile).CombinedOutput()
+	if err != nil {
+		log.Errorf("Error loading the AppArmor profile %s %v; raw output: %s", l.profileFile, err, out)
+		return errors.Wrapf(err, "could not load the AppArmor profile %s", l.profileFile)
+	}
+	return nil
+}
+
+// install writes the profile unless the file already holds it
+func (l *ProfileLoader) install() error {
+	existing, err := ioutil.ReadFile(l.profileFile)
+	if err == nil && bytes.Equal(existing, []byte(profile)) {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "could not read the AppArmor profile %s", l.profileFile)
+	}
+	err = ioutil.WriteFile(l.profileFile, []byte(profile), profilePerm)
+	if err != nil {
+		return errors.Wrapf(err, "could not install the AppArmor profile %s", l.profileFile)
+	}
+	hostmanifest.RecordFile(l.profileFile, []byte(profile))
+	log.Infof("Installed the AppArmor profile of the Agent container in %s", l.profileFile)
+	return nil
+}
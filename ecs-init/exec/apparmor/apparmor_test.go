@@ -0,0 +1,114 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package apparmor
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProfileLoader(t *testing.T, mockExec *MockExec) *ProfileLoader {
+	return &ProfileLoader{
+		cmdExec:     mockExec,
+		profileFile: filepath.Join(t.TempDir(), config.DefaultAppArmorProfile),
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	defer func() { enabledFile = "/sys/module/apparmor/parameters/enabled" }()
+
+	enabledFile = filepath.Join(t.TempDir(), "enabled")
+	assert.False(t, Enabled())
+	require.NoError(t, ioutil.WriteFile(enabledFile, []byte("N\n"), 0644))
+	assert.False(t, Enabled())
+	require.NoError(t, ioutil.WriteFile(enabledFile, []byte("Y\n"), 0644))
+	assert.True(t, Enabled())
+}
+
+func TestProfileName(t *testing.T) {
+	assert.Contains(t, profile, "profile "+config.DefaultAppArmorProfile+" ")
+}
+
+func TestLoad(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	loader := newTestProfileLoader(t, mockExec)
+	mockParser := NewMockCmd(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(apparmorParserExecutable).Return("/sbin/apparmor_parser", nil),
+		mockExec.EXPECT().Command(apparmorParserExecutable, "--replace", "--write-cache", loader.profileFile).Return(mockParser),
+		mockParser.EXPECT().CombinedOutput().Return(nil, nil),
+	)
+
+	assert.NoError(t, loader.Load())
+	installed, err := ioutil.ReadFile(loader.profileFile)
+	require.NoError(t, err)
+	assert.Equal(t, profile, string(installed))
+}
+
+func TestLoadOverwritesChangedProfile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	loader := newTestProfileLoader(t, mockExec)
+	require.NoError(t, ioutil.WriteFile(loader.profileFile, []byte("profile ecs-agent-default {}\n"), 0644))
+	mockParser := NewMockCmd(ctrl)
+	mockExec.EXPECT().LookPath(apparmorParserExecutable).Return("/sbin/apparmor_parser", nil)
+	mockExec.EXPECT().Command(apparmorParserExecutable, "--replace", "--write-cache", loader.profileFile).Return(mockParser)
+	mockParser.EXPECT().CombinedOutput().Return(nil, nil)
+
+	assert.NoError(t, loader.Load())
+	installed, err := ioutil.ReadFile(loader.profileFile)
+	require.NoError(t, err)
+	assert.Equal(t, profile, string(installed))
+}
+
+func TestLoadNoParser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	loader := newTestProfileLoader(t, mockExec)
+	mockExec.EXPECT().LookPath(apparmorParserExecutable).Return("", errors.New("not found"))
+
+	assert.Error(t, loader.Load())
+	_, err := os.Stat(loader.profileFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLoadParserError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	loader := newTestProfileLoader(t, mockExec)
+	mockParser := NewMockCmd(ctrl)
+	mockExec.EXPECT().LookPath(apparmorParserExecutable).Return("/sbin/apparmor_parser", nil)
+	mockExec.EXPECT().Command(apparmorParserExecutable, "--replace", "--write-cache", loader.profileFile).Return(mockParser)
+	mockParser.EXPECT().CombinedOutput().Return([]byte("syntax error"), errors.New("exit status 1"))
+
+	assert.Error(t, loader.Load())
+}
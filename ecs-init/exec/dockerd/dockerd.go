@@ -0,0 +1,76 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerd
+
+import (
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	systemctlExecutable = "systemctl"
+	// Unit is the systemd unit of the Docker daemon
+	Unit = "docker.service"
+	// activeStateProperty is the unit property holding its state, such as
+	// 'active', 'failed' or 'activating'
+	activeStateProperty = "ActiveState"
+)
+
+// Daemon implements the engine.dockerDaemon interface by running the
+// external 'systemctl' command
+type Daemon struct {
+	cmdExec exec.Exec
+}
+
+// NewDaemon creates a new Daemon object
+func NewDaemon(cmdExec exec.Exec) *Daemon {
+	return &Daemon{
+		cmdExec: cmdExec,
+	}
+}
+
+// UnitState returns the active state of the systemd unit of the Docker
+// daemon
+func (d *Daemon) UnitState() (string, error) {
+	_, err := d.cmdExec.LookPath(systemctlExecutable)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not find '%s' executable", systemctlExecutable)
+	}
+	// 'systemctl is-active' exits non-zero for every state but active and
+	// '--value' is too recent for some hosts, so the property is parsed
+	out, err := d.cmdExec.Command(systemctlExecutable, "show", "--property="+activeStateProperty, Unit).Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "could not read the state of %s", Unit)
+	}
+	state := strings.TrimPrefix(strings.TrimSpace(string(out)), activeStateProperty+"=")
+	if state == "" {
+		return "", errors.Errorf("no state reported for %s", Unit)
+	}
+	return state, nil
+}
+
+// Restart restarts the systemd unit of the Docker daemon
+func (d *Daemon) Restart() error {
+	cmd := d.cmdExec.Command(systemctlExecutable, "restart", Unit)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Errorf("Error restarting %s %v; raw output: %s", Unit, err, out)
+		return errors.Wrapf(err, "systemctl restart %s failed", Unit)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitState(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockShow := NewMockCmd(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil),
+		mockExec.EXPECT().Command(systemctlExecutable, "show", "--property=ActiveState", Unit).Return(mockShow),
+		mockShow.EXPECT().Output().Return([]byte("ActiveState=failed\n"), nil),
+	)
+
+	state, err := NewDaemon(mockExec).UnitState()
+	assert.NoError(t, err)
+	assert.Equal(t, "failed", state)
+}
+
+func TestUnitStateNoSystemctl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockExec.EXPECT().LookPath(systemctlExecutable).Return("", errors.New("not found"))
+
+	_, err := NewDaemon(mockExec).UnitState()
+	assert.Error(t, err)
+}
+
+func TestUnitStateEmpty(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockShow := NewMockCmd(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil),
+		mockExec.EXPECT().Command(systemctlExecutable, "show", "--property=ActiveState", Unit).Return(mockShow),
+		mockShow.EXPECT().Output().Return([]byte("ActiveState=\n"), nil),
+	)
+
+	_, err := NewDaemon(mockExec).UnitState()
+	assert.Error(t, err)
+}
+
+func TestRestart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockRestart := NewMockCmd(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().Command(systemctlExecutable, "restart", Unit).Return(mockRestart),
+		mockRestart.EXPECT().CombinedOutput().Return(nil, nil),
+	)
+
+	assert.NoError(t, NewDaemon(mockExec).Restart())
+}
+
+func TestRestartFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockRestart := NewMockCmd(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().Command(systemctlExecutable, "restart", Unit).Return(mockRestart),
+		mockRestart.EXPECT().CombinedOutput().Return([]byte("Job failed"), errors.New("exit status 1")),
+	)
+
+	assert.Error(t, NewDaemon(mockExec).Restart())
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ebs
+
+import (
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// nvmeExecutable is used by the Agent to find the EBS volume behind
+	// an NVMe device
+	nvmeExecutable = "nvme"
+	// mountDirectoryPerm only allows root to access the volumes attached
+	// to tasks
+	mountDirectoryPerm = 0700
+)
+
+// TaskAttach implements the engine.ebsTaskAttach interface by checking for
+// the tools the Agent relies on to attach EBS volumes to tasks
+type TaskAttach struct {
+	cmdExec exec.Exec
+	fs      fileSystem
+}
+
+// NewTaskAttach creates a new TaskAttach object
+func NewTaskAttach(cmdExec exec.Exec) *TaskAttach {
+	return &TaskAttach{
+		cmdExec: cmdExec,
+		fs:      standardFS,
+	}
+}
+
+// Prepare creates the directory EBS volumes are mounted under and returns an
+// error listing every missing prerequisite, so that they can be fixed at once
+// instead of failing tasks one by one
+func (a *TaskAttach) Prepare() error {
+	var missing []string
+	_, err := a.cmdExec.LookPath(nvmeExecutable)
+	if err != nil {
+		missing = append(missing, "nvme-cli is not installed")
+	}
+	_, err = a.fs.Stat(config.EBSUdevRulesFile())
+	if err != nil {
+		missing = append(missing, "udev rules naming EBS NVMe devices are missing from "+config.EBSUdevRulesFile())
+	}
+	err = a.fs.MkdirAll(config.EBSMountDirectory(), mountDirectoryPerm)
+	if err != nil {
+		missing = append(missing, "could not create "+config.EBSMountDirectory()+": "+err.Error())
+	} else {
+		hostmanifest.Record(hostmanifest.KindFile, config.EBSMountDirectory(), hostmanifest.Directory)
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("EBS task attach prerequisites not met: %s", strings.Join(missing, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ebs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrepare(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockFS := NewMockfileSystem(ctrl)
+	mockExec.EXPECT().LookPath(nvmeExecutable).Return("/usr/sbin/nvme", nil)
+	mockFS.EXPECT().Stat(config.EBSUdevRulesFile()).Return(nil, nil)
+	mockFS.EXPECT().MkdirAll(config.EBSMountDirectory(), os.FileMode(mountDirectoryPerm))
+
+	attach := &TaskAttach{
+		cmdExec: mockExec,
+		fs:      mockFS,
+	}
+	assert.NoError(t, attach.Prepare())
+}
+
+func TestPrepareReportsEveryMissingPrerequisite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockFS := NewMockfileSystem(ctrl)
+	mockExec.EXPECT().LookPath(nvmeExecutable).Return("", errors.New("not found"))
+	mockFS.EXPECT().Stat(config.EBSUdevRulesFile()).Return(nil, os.ErrNotExist)
+	mockFS.EXPECT().MkdirAll(config.EBSMountDirectory(), os.FileMode(mountDirectoryPerm))
+
+	attach := &TaskAttach{
+		cmdExec: mockExec,
+		fs:      mockFS,
+	}
+	err := attach.Prepare()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "nvme-cli")
+	assert.Contains(t, err.Error(), "udev rules")
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package efsutils
+
+import (
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	mountHelperExecutable = "mount.efs"
+	stunnelExecutable     = "stunnel"
+	yumExecutable         = "yum"
+	systemctlExecutable   = "systemctl"
+	efsUtilsPackage       = "amazon-efs-utils"
+	// watchdogService restarts the stunnel processes of TLS mounts that
+	// stopped
+	watchdogService = "amazon-efs-mount-watchdog"
+)
+
+// Checker implements the engine.efsUtils interface by running the external
+// commands installed by amazon-efs-utils
+type Checker struct {
+	cmdExec exec.Exec
+}
+
+// NewChecker creates a new Checker object
+func NewChecker(cmdExec exec.Exec) *Checker {
+	return &Checker{
+		cmdExec: cmdExec,
+	}
+}
+
+// Check returns an error if the EFS mount helper or stunnel, which it uses for
+// mounts encrypted in transit, are not installed or cannot run
+func (c *Checker) Check() error {
+	for _, executable := range []string{mountHelperExecutable, stunnelExecutable} {
+		_, err := c.cmdExec.LookPath(executable)
+		if err != nil {
+			return errors.Wrapf(err, "could not find '%s' executable", executable)
+		}
+	}
+	return c.run(mountHelperExecutable, "--version")
+}
+
+// Install installs amazon-efs-utils and enables its watchdog service
+func (c *Checker) Install() error {
+	_, err := c.cmdExec.LookPath(yumExecutable)
+	if err != nil {
+		return errors.Wrapf(err, "could not find '%s' executable to install %s", yumExecutable, efsUtilsPackage)
+	}
+	log.Infof("Installing %s", efsUtilsPackage)
+	err = c.run(yumExecutable, "install", "-y", efsUtilsPackage)
+	if err != nil {
+		return err
+	}
+	_, err = c.cmdExec.LookPath(systemctlExecutable)
+	if err != nil {
+		// the watchdog is started by the mount helper on hosts without systemd
+		return nil
+	}
+	return c.run(systemctlExecutable, "enable", "--now", watchdogService)
+}
+
+func (c *Checker) run(name string, arg ...string) error {
+	out, err := c.cmdExec.Command(name, arg...).CombinedOutput()
+	if err != nil {
+		log.Errorf("Error running %s %s %v; raw output: %s", name, strings.Join(arg, " "), err, out)
+		return errors.Wrapf(err, "%s %s failed", name, strings.Join(arg, " "))
+	}
+	return nil
+}
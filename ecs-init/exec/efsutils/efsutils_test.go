@@ -0,0 +1,109 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package efsutils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockCmd := NewMockCmd(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(mountHelperExecutable).Return("/sbin/mount.efs", nil),
+		mockExec.EXPECT().LookPath(stunnelExecutable).Return("/bin/stunnel", nil),
+		mockExec.EXPECT().Command(mountHelperExecutable, "--version").Return(mockCmd),
+		mockCmd.EXPECT().CombinedOutput().Return([]byte("/sbin/mount.efs Version: 1.25.3"), nil),
+	)
+
+	assert.NoError(t, NewChecker(mockExec).Check())
+}
+
+func TestCheckNoStunnel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(mountHelperExecutable).Return("/sbin/mount.efs", nil),
+		mockExec.EXPECT().LookPath(stunnelExecutable).Return("", errors.New("not found")),
+	)
+
+	assert.Error(t, NewChecker(mockExec).Check())
+}
+
+func TestCheckMountHelperFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockCmd := NewMockCmd(ctrl)
+	mockExec.EXPECT().LookPath(gomock.Any()).Return("", nil).Times(2)
+	mockExec.EXPECT().Command(mountHelperExecutable, "--version").Return(mockCmd)
+	mockCmd.EXPECT().CombinedOutput().Return([]byte("No module named botocore"), errors.New("exit status 1"))
+
+	assert.Error(t, NewChecker(mockExec).Check())
+}
+
+func TestInstall(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockInstall := NewMockCmd(ctrl)
+	mockEnable := NewMockCmd(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(yumExecutable).Return("/bin/yum", nil),
+		mockExec.EXPECT().Command(yumExecutable, "install", "-y", efsUtilsPackage).Return(mockInstall),
+		mockInstall.EXPECT().CombinedOutput(),
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("/bin/systemctl", nil),
+		mockExec.EXPECT().Command(systemctlExecutable, "enable", "--now", watchdogService).Return(mockEnable),
+		mockEnable.EXPECT().CombinedOutput(),
+	)
+
+	assert.NoError(t, NewChecker(mockExec).Install())
+}
+
+func TestInstallNoSystemd(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockInstall := NewMockCmd(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(yumExecutable).Return("/bin/yum", nil),
+		mockExec.EXPECT().Command(yumExecutable, "install", "-y", efsUtilsPackage).Return(mockInstall),
+		mockInstall.EXPECT().CombinedOutput(),
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("", errors.New("not found")),
+	)
+
+	assert.NoError(t, NewChecker(mockExec).Install())
+}
+
+func TestInstallNoYum(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockExec.EXPECT().LookPath(yumExecutable).Return("", errors.New("not found"))
+
+	assert.Error(t, NewChecker(mockExec).Install())
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package egress restricts the connections the Agent container makes from
+// its bridge with netfilter rules in a chain of their own, jumped to from the
+// DOCKER-USER chain Docker traverses before its own rules
+package egress
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	iptablesExecutable        = "iptables"
+	iptablesRestoreExecutable = "iptables-restore"
+	// chain holds the rules of the policy
+	chain = "ECS-INIT-AGENT-EGRESS"
+	// dockerUserChain is the chain of the forwarded traffic of containers
+	// Docker leaves to users
+	dockerUserChain = "DOCKER-USER"
+	dnsPort         = "53"
+	httpsPort       = "443"
+	// instanceMetadataAddress is the address of the EC2 Instance Metadata
+	// Service, which the Agent reads its credentials from
+	instanceMetadataAddress = "169.254.169.254"
+)
+
+// Policy restricts the egress of the Agent container by running the external
+// 'iptables' command
+type Policy struct {
+	cmdExec exec.Exec
+}
+
+// NewPolicy creates a new Policy
+func NewPolicy(cmdExec exec.Exec) *Policy {
+	return &Policy{cmdExec: cmdExec}
+}
+
+// Apply restricts the connections made from the bridge iface to DNS, the
+// instance metadata service and HTTPS to destinations, which are addresses
+// or CIDR blocks. The rules applied before are replaced in a single
+// iptables-restore transaction, so that the connections are never left
+// unrestricted while they are replaced, and are kept when it fails.
+func (p *Policy) Apply(iface string, destinations []string) error {
+	jump := jumpRule(iface)
+	jumped := p.iptables(append([]string{"-C"}, jump...)...) == nil
+	file, err := ioutil.TempFile("", "ecs-init-egress")
+	if err != nil {
+		return errors.Wrap(err, "could not write the egress rules")
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(restoreInput(jump, destinations, jumped))
+	file.Close()
+	if err != nil {
+		return errors.Wrap(err, "could not write the egress rules")
+	}
+	output, err := p.cmdExec.Command(iptablesRestoreExecutable, "--noflush", file.Name()).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "%s failed: %s", iptablesRestoreExecutable, strings.TrimSpace(string(output)))
+	}
+	if !jumped {
+		hostmanifest.Record(hostmanifest.KindRule, strings.Join(jump, " "), hostmanifest.Added)
+	}
+	return nil
+}
+
+// restoreInput returns the input of iptables-restore replacing the rules of
+// the chain with those allowing destinations, and inserting the jump to the
+// chain unless it is jumped to already
+func restoreInput(jump []string, destinations []string, jumped bool) string {
+	var input strings.Builder
+	input.WriteString("*filter\n")
+	// with --noflush, a declared chain is created or, when it exists, flushed
+	fmt.Fprintf(&input, ":%s - [0:0]\n", chain)
+	for _, rule := range rules(destinations) {
+		fmt.Fprintf(&input, "-A %s %s\n", chain, strings.Join(rule, " "))
+	}
+	if !jumped {
+		fmt.Fprintf(&input, "-I %s\n", strings.Join(jump, " "))
+	}
+	input.WriteString("COMMIT\n")
+	return input.String()
+}
+
+// Remove removes the rules restricting the connections made from the bridge
+// iface. An error is returned when there were no rules to remove.
+func (p *Policy) Remove(iface string) error {
+	jump := jumpRule(iface)
+	jumpErr := p.iptables(append([]string{"-D"}, jump...)...)
+	if jumpErr == nil {
+		hostmanifest.Record(hostmanifest.KindRule, strings.Join(jump, " "), hostmanifest.Removed)
+	}
+	p.iptables("-F", chain)
+	err := p.iptables("-X", chain)
+	if err != nil {
+		return err
+	}
+	return jumpErr
+}
+
+// rules returns the rules of the chain, which return the connections allowed
+// to the DOCKER-USER chain and reject the others
+func rules(destinations []string) [][]string {
+	rules := [][]string{
+		{"-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN"},
+		{"-p", "udp", "--dport", dnsPort, "-j", "RETURN"},
+		{"-p", "tcp", "--dport", dnsPort, "-j", "RETURN"},
+		{"-d", instanceMetadataAddress, "-j", "RETURN"},
+	}
+	for _, destination := range destinations {
+		rules = append(rules, []string{"-d", destination, "-p", "tcp", "--dport", httpsPort, "-j", "RETURN"})
+	}
+	return append(rules, []string{"-j", "REJECT"})
+}
+
+// jumpRule returns the rule of the DOCKER-USER chain jumping to the chain of
+// the policy for the connections made from the bridge iface
+func jumpRule(iface string) []string {
+	return []string{dockerUserChain, "-i", iface, "-j", chain}
+}
+
+// iptables runs iptables on the filter table
+func (p *Policy) iptables(args ...string) error {
+	output, err := p.cmdExec.Command(iptablesExecutable, args...).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "%s %s failed: %s", iptablesExecutable, strings.Join(args, " "), strings.TrimSpace(string(output)))
+	}
+	return nil
+}
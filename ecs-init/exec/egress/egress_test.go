@@ -0,0 +1,139 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package egress
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/cmd"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// expectCommand expects a command to be run and answered with output and err
+func expectCommand(ctrl *gomock.Controller, mockExec *MockExec, output string, err error, command string) *gomock.Call {
+	fields := strings.Fields(command)
+	args := make([]interface{}, 0, len(fields)-1)
+	for _, field := range fields[1:] {
+		args = append(args, field)
+	}
+	mockCmd := NewMockCmd(ctrl)
+	mockCmd.EXPECT().CombinedOutput().Return([]byte(output), err)
+	return mockExec.EXPECT().Command(fields[0], args...).Return(mockCmd)
+}
+
+// expectRestore expects iptables-restore to be run, answered with output and
+// err, and returns the rules it was given
+func expectRestore(ctrl *gomock.Controller, mockExec *MockExec, output string, err error) (*gomock.Call, *string) {
+	var input string
+	mockCmd := NewMockCmd(ctrl)
+	mockCmd.EXPECT().CombinedOutput().Return([]byte(output), err)
+	call := mockExec.EXPECT().Command("iptables-restore", "--noflush", gomock.Any()).DoAndReturn(
+		func(name string, args ...string) cmd.Cmd {
+			data, _ := ioutil.ReadFile(args[1])
+			input = string(data)
+			return mockCmd
+		})
+	return call, &input
+}
+
+func TestApply(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	restore, input := expectRestore(ctrl, mockExec, "", nil)
+	gomock.InOrder(
+		expectCommand(ctrl, mockExec, "Bad rule", errors.New("exit status 1"), "iptables -C DOCKER-USER -i ecs-agent0 -j ECS-INIT-AGENT-EGRESS"),
+		restore,
+	)
+
+	assert.NoError(t, NewPolicy(mockExec).Apply("ecs-agent0", []string{"52.94.0.1", "10.0.0.0/16"}))
+	assert.Equal(t, `*filter
+:ECS-INIT-AGENT-EGRESS - [0:0]
+-A ECS-INIT-AGENT-EGRESS -m conntrack --ctstate ESTABLISHED,RELATED -j RETURN
+-A ECS-INIT-AGENT-EGRESS -p udp --dport 53 -j RETURN
+-A ECS-INIT-AGENT-EGRESS -p tcp --dport 53 -j RETURN
+-A ECS-INIT-AGENT-EGRESS -d 169.254.169.254 -j RETURN
+-A ECS-INIT-AGENT-EGRESS -d 52.94.0.1 -p tcp --dport 443 -j RETURN
+-A ECS-INIT-AGENT-EGRESS -d 10.0.0.0/16 -p tcp --dport 443 -j RETURN
+-A ECS-INIT-AGENT-EGRESS -j REJECT
+-I DOCKER-USER -i ecs-agent0 -j ECS-INIT-AGENT-EGRESS
+COMMIT
+`, *input)
+}
+
+func TestApplyAgain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	restore, input := expectRestore(ctrl, mockExec, "", nil)
+	gomock.InOrder(
+		expectCommand(ctrl, mockExec, "", nil, "iptables -C DOCKER-USER -i ecs-agent0 -j ECS-INIT-AGENT-EGRESS"),
+		restore,
+	)
+
+	assert.NoError(t, NewPolicy(mockExec).Apply("ecs-agent0", []string{"52.94.0.2"}))
+	assert.Contains(t, *input, "-A ECS-INIT-AGENT-EGRESS -d 52.94.0.2 -p tcp --dport 443 -j RETURN\n")
+	assert.NotContains(t, *input, "DOCKER-USER", "Expect the existing jump to be kept")
+}
+
+func TestApplyError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	restore, _ := expectRestore(ctrl, mockExec, "iptables-restore: line 7 failed", errors.New("exit status 1"))
+	gomock.InOrder(
+		expectCommand(ctrl, mockExec, "", nil, "iptables -C DOCKER-USER -i ecs-agent0 -j ECS-INIT-AGENT-EGRESS"),
+		restore,
+	)
+
+	err := NewPolicy(mockExec).Apply("ecs-agent0", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 7 failed")
+}
+
+func TestRemove(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	gomock.InOrder(
+		expectCommand(ctrl, mockExec, "", nil, "iptables -D DOCKER-USER -i ecs-agent0 -j ECS-INIT-AGENT-EGRESS"),
+		expectCommand(ctrl, mockExec, "", nil, "iptables -F ECS-INIT-AGENT-EGRESS"),
+		expectCommand(ctrl, mockExec, "", nil, "iptables -X ECS-INIT-AGENT-EGRESS"),
+	)
+
+	assert.NoError(t, NewPolicy(mockExec).Remove("ecs-agent0"))
+}
+
+func TestRemoveNothing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	gomock.InOrder(
+		expectCommand(ctrl, mockExec, "Bad rule", errors.New("exit status 1"), "iptables -D DOCKER-USER -i ecs-agent0 -j ECS-INIT-AGENT-EGRESS"),
+		expectCommand(ctrl, mockExec, "No chain", errors.New("exit status 1"), "iptables -F ECS-INIT-AGENT-EGRESS"),
+		expectCommand(ctrl, mockExec, "No chain", errors.New("exit status 1"), "iptables -X ECS-INIT-AGENT-EGRESS"),
+	)
+
+	assert.Error(t, NewPolicy(mockExec).Remove("ecs-agent0"))
+}
@@ -14,6 +14,7 @@
 package exec
 
 import (
+	"context"
 	osexec "os/exec"
 
 	"github.com/aws/amazon-ecs-init/ecs-init/cmd"
@@ -21,12 +22,25 @@ import (
 
 //go:generate mockgen.sh sysctl $GOFILE sysctl
 //go:generate mockgen.sh iptables $GOFILE iptables
+//go:generate mockgen.sh reservation $GOFILE reservation
+//go:generate mockgen.sh efsutils $GOFILE efsutils
+//go:generate mockgen.sh ebs $GOFILE ebs
+//go:generate mockgen.sh netns $GOFILE netns
+//go:generate mockgen.sh dockerd $GOFILE dockerd
+//go:generate mockgen.sh apparmor $GOFILE apparmor
+//go:generate mockgen.sh containerd $GOFILE ../containerd
+//go:generate mockgen.sh startgate $GOFILE startgate
+//go:generate mockgen.sh taskmetadata $GOFILE taskmetadata
+//go:generate mockgen.sh egress $GOFILE egress
+//go:generate mockgen.sh persistenced $GOFILE persistenced
+//go:generate mockgen.sh blueprint $GOFILE ../blueprint
 
 // Exec defines common methods from exec package that are used to run external
 // commands
 type Exec interface {
 	LookPath(file string) (string, error)
 	Command(name string, arg ...string) cmd.Cmd
+	CommandContext(ctx context.Context, name string, arg ...string) cmd.Cmd
 }
 
 type _exec struct{}
@@ -42,3 +56,7 @@ func (*_exec) LookPath(file string) (string, error) {
 func (*_exec) Command(name string, arg ...string) cmd.Cmd {
 	return osexec.Command(name, arg...)
 }
+
+func (*_exec) CommandContext(ctx context.Context, name string, arg ...string) cmd.Cmd {
+	return osexec.CommandContext(ctx, name, arg...)
+}
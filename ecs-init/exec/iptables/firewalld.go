@@ -0,0 +1,120 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package iptables
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	firewallCmdExecutable = "firewall-cmd"
+	// firewalldRunningState is what 'firewall-cmd --state' prints when
+	// firewalld is running
+	firewalldRunningState = "running"
+	// firewalldAddRule enumerates the 'add' action of direct rules
+	firewalldAddRule = "--add-rule"
+	// firewalldRemoveRule enumerates the 'remove' action of direct rules
+	firewalldRemoveRule = "--remove-rule"
+	// firewalldPriority is the priority of the direct rules among the
+	// direct rules of their chain
+	firewalldPriority = "0"
+)
+
+// firewalldConfigs are the configurations of firewalld the direct rules are
+// changed in: the runtime one, in effect now, and the permanent one, which
+// firewalld reloads
+var firewalldConfigs = [][]string{nil, {"--permanent"}}
+
+// FirewalldRunning returns true when firewalld manages the netfilter tables
+// of the host, and would wipe the rules added by iptables when reloaded
+func FirewalldRunning(cmdExec exec.Exec) bool {
+	_, err := cmdExec.LookPath(firewallCmdExecutable)
+	if err != nil {
+		return false
+	}
+	// 'firewall-cmd --state' exits non-zero when firewalld is not running
+	out, err := cmdExec.Command(firewallCmdExecutable, "--state").CombinedOutput()
+	return err == nil && strings.TrimSpace(string(out)) == firewalldRunningState
+}
+
+// FirewalldRoute implements the engine.credentialsProxyRoute interface by
+// adding the route as direct rules of firewalld, with the external
+// 'firewall-cmd' command, so that firewalld reloads keep the route and do
+// not fight over the netfilter tables with the policies of its zones
+type FirewalldRoute struct {
+	cmdExec exec.Exec
+}
+
+// NewFirewalldRoute creates a new FirewalldRoute object
+func NewFirewalldRoute(cmdExec exec.Exec) *FirewalldRoute {
+	return &FirewalldRoute{
+		cmdExec: cmdExec,
+	}
+}
+
+// Create adds the credentials proxy endpoint route to the runtime and
+// permanent configurations of firewalld. Rules added already are left alone.
+func (route *FirewalldRoute) Create() error {
+	err := route.modifyDirectRule(firewalldAddRule, getPreroutingChainArgs)
+	if err != nil {
+		return err
+	}
+	return route.modifyDirectRule(firewalldAddRule, getOutputChainArgs)
+}
+
+// Remove removes the credentials proxy endpoint route from the runtime and
+// permanent configurations of firewalld
+func (route *FirewalldRoute) Remove() error {
+	preroutingErr := route.modifyDirectRule(firewalldRemoveRule, getPreroutingChainArgs)
+	if preroutingErr != nil {
+		preroutingErr = fmt.Errorf("Error removing prerouting direct rule: %w", preroutingErr)
+	}
+	outputErr := route.modifyDirectRule(firewalldRemoveRule, getOutputChainArgs)
+	if outputErr != nil {
+		if preroutingErr != nil {
+			return fmt.Errorf("%w; Error removing output direct rule: %v", preroutingErr, outputErr)
+		}
+		return fmt.Errorf("Error removing output direct rule: %w", outputErr)
+	}
+	return preroutingErr
+}
+
+// modifyDirectRule adds or removes the direct rule of a chain of the nat
+// table, in the runtime configuration first. firewalld only warns about
+// rules added or removed already.
+func (route *FirewalldRoute) modifyDirectRule(action string, getNetfilterChainArgs getNetfilterChainArgsFunc) error {
+	chainArgs := getNetfilterChainArgs()
+	rule := append([]string{"--direct", action, "ipv4", "nat", chainArgs[0], firewalldPriority}, chainArgs[1:]...)
+	for _, config := range firewalldConfigs {
+		args := append(append([]string{}, config...), rule...)
+		out, err := route.cmdExec.Command(firewallCmdExecutable, args...).CombinedOutput()
+		if err != nil {
+			log.Errorf("Error performing action '%s' for credentials proxy endpoint direct rule: %v; raw output: %s", action, err, out)
+			return &iptablesError{err: err}
+		}
+	}
+
+	recorded := strings.Join(append(getNatTableArgs(), chainArgs...), " ")
+	if action == firewalldAddRule {
+		hostmanifest.Record(hostmanifest.KindRule, recorded, hostmanifest.Added)
+	} else {
+		hostmanifest.Record(hostmanifest.KindRule, recorded, hostmanifest.Removed)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package iptables
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// directRule returns the arguments of firewall-cmd changing the direct rule
+// of a chain, in the permanent configuration when permanent is set
+func directRule(permanent bool, action string, chainArgs []string) []interface{} {
+	var args []interface{}
+	if permanent {
+		args = append(args, "--permanent")
+	}
+	args = append(args, "--direct", action, "ipv4", "nat", chainArgs[0], firewalldPriority)
+	for _, arg := range chainArgs[1:] {
+		args = append(args, arg)
+	}
+	return args
+}
+
+// expectDirectRule expects the direct rule of a chain to be changed in the
+// runtime and the permanent configuration
+func expectDirectRule(ctrl *gomock.Controller, mockExec *MockExec, action string, chainArgs []string) []*gomock.Call {
+	var calls []*gomock.Call
+	for _, permanent := range []bool{false, true} {
+		mockCmd := NewMockCmd(ctrl)
+		calls = append(calls,
+			mockExec.EXPECT().Command(firewallCmdExecutable, directRule(permanent, action, chainArgs)...).Return(mockCmd),
+			mockCmd.EXPECT().CombinedOutput().Return([]byte("success\n"), nil))
+	}
+	return calls
+}
+
+func TestFirewalldRunning(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockState := NewMockCmd(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(firewallCmdExecutable).Return("/usr/bin/firewall-cmd", nil),
+		mockExec.EXPECT().Command(firewallCmdExecutable, "--state").Return(mockState),
+		mockState.EXPECT().CombinedOutput().Return([]byte("running\n"), nil),
+	)
+	assert.True(t, FirewalldRunning(mockExec))
+}
+
+func TestFirewalldNotRunning(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockState := NewMockCmd(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(firewallCmdExecutable).Return("/usr/bin/firewall-cmd", nil),
+		mockExec.EXPECT().Command(firewallCmdExecutable, "--state").Return(mockState),
+		mockState.EXPECT().CombinedOutput().Return([]byte("not running\n"), errors.New("exit status 252")),
+	)
+	assert.False(t, FirewalldRunning(mockExec))
+}
+
+func TestFirewalldNotInstalled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockExec.EXPECT().LookPath(firewallCmdExecutable).Return("", errors.New("not found"))
+	assert.False(t, FirewalldRunning(mockExec))
+}
+
+func TestFirewalldCreate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	calls := expectDirectRule(ctrl, mockExec, firewalldAddRule, getPreroutingChainArgs())
+	calls = append(calls, expectDirectRule(ctrl, mockExec, firewalldAddRule, getOutputChainArgs())...)
+	gomock.InOrder(calls...)
+
+	assert.NoError(t, NewFirewalldRoute(mockExec).Create())
+}
+
+func TestFirewalldCreateError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockCmd := NewMockCmd(ctrl)
+	mockExec.EXPECT().Command(firewallCmdExecutable, directRule(false, firewalldAddRule, getPreroutingChainArgs())...).Return(mockCmd)
+	mockCmd.EXPECT().CombinedOutput().Return([]byte("Error: INVALID_RULE"), errors.New("exit status 1"))
+
+	err := NewFirewalldRoute(mockExec).Create()
+	assert.True(t, errors.Is(err, ErrIptablesFailed))
+}
+
+func TestFirewalldRemove(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	calls := expectDirectRule(ctrl, mockExec, firewalldRemoveRule, getPreroutingChainArgs())
+	calls = append(calls, expectDirectRule(ctrl, mockExec, firewalldRemoveRule, getOutputChainArgs())...)
+	gomock.InOrder(calls...)
+
+	assert.NoError(t, NewFirewalldRoute(mockExec).Remove())
+}
+
+func TestFirewalldRemoveContinuesOnPreroutingError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockCmd := NewMockCmd(ctrl)
+	mockExec.EXPECT().Command(firewallCmdExecutable, directRule(false, firewalldRemoveRule, getPreroutingChainArgs())...).Return(mockCmd)
+	mockCmd.EXPECT().CombinedOutput().Return(nil, errors.New("exit status 1"))
+	expectDirectRule(ctrl, mockExec, firewalldRemoveRule, getOutputChainArgs())
+
+	err := NewFirewalldRoute(mockExec).Remove()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "prerouting")
+}
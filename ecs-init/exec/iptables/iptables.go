@@ -14,12 +14,37 @@
 package iptables
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
 	log "github.com/cihub/seelog"
 )
 
+// ErrIptablesFailed is wrapped by errors returned when an iptables command
+// fails to modify the netfilter table
+var ErrIptablesFailed = errors.New("iptables command failed")
+
+// iptablesError is the error of a command modifying the netfilter table. It
+// is ErrIptablesFailed to errors.Is and unwraps to the error of the command.
+type iptablesError struct {
+	err error
+}
+
+func (e *iptablesError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrIptablesFailed, e.err)
+}
+
+func (e *iptablesError) Unwrap() error {
+	return e.err
+}
+
+func (e *iptablesError) Is(target error) bool {
+	return target == ErrIptablesFailed
+}
+
 // iptablesAction enumerates different actions for the iptables command
 type iptablesAction string
 
@@ -74,16 +99,16 @@ func (route *NetfilterRoute) Remove() error {
 	preroutingErr := route.modifyNetfilterEntry(iptablesDelete, getPreroutingChainArgs)
 	if preroutingErr != nil {
 		// Add more context for error in modifying the prerouting chain
-		preroutingErr = fmt.Errorf("Error removing prerouting chain entry: %v", preroutingErr)
+		preroutingErr = fmt.Errorf("Error removing prerouting chain entry: %w", preroutingErr)
 	}
 	outputErr := route.modifyNetfilterEntry(iptablesDelete, getOutputChainArgs)
 	if outputErr != nil {
 		if preroutingErr != nil {
 			// return a combined error message for prerouting and output chains
-			return fmt.Errorf("%v; Error removing output chain entry: %v", preroutingErr, outputErr)
+			return fmt.Errorf("%w; Error removing output chain entry: %v", preroutingErr, outputErr)
 		}
 		// Add more context for error in modifying the output chain
-		return fmt.Errorf("Error removing output chain entry: %v", outputErr)
+		return fmt.Errorf("Error removing output chain entry: %w", outputErr)
 	}
 	return preroutingErr
 }
@@ -98,9 +123,16 @@ func (route *NetfilterRoute) modifyNetfilterEntry(action iptablesAction, getNetf
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Errorf("Error performing action '%s' for credentials proxy endpoint route: %v; raw output: %s", getActionName(action), err, out)
+		return &iptablesError{err: err}
 	}
 
-	return err
+	rule := strings.Join(append(getNatTableArgs(), getNetfilterChainArgs()...), " ")
+	if action == iptablesAppend {
+		hostmanifest.Record(hostmanifest.KindRule, rule, hostmanifest.Added)
+	} else {
+		hostmanifest.Record(hostmanifest.KindRule, rule, hostmanifest.Removed)
+	}
+	return nil
 }
 
 func getNatTableArgs() []string {
@@ -14,6 +14,7 @@
 package iptables
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -101,8 +102,8 @@ func TestCreateErrorOnPreRoutingCommandError(t *testing.T) {
 	}
 
 	err = route.Create()
-	if err == nil {
-		t.Error("Expected error creating route")
+	if !errors.Is(err, ErrIptablesFailed) {
+		t.Errorf("Expected iptables error creating route, got: %v", err)
 	}
 }
 
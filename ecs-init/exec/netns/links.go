@@ -0,0 +1,159 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package netns
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// taskBridge is the bridge the ecs-bridge CNI plugin connects awsvpc
+	// tasks to
+	taskBridge = "ecs-bridge"
+	// linkNetnsID is the attribute of a veth interface whose peer is in
+	// another network namespace
+	linkNetnsID = "link-netnsid"
+)
+
+// Rule is a routing policy rule
+type Rule struct {
+	Priority int
+	Selector string
+	Table    int
+}
+
+func (r Rule) String() string {
+	return strconv.Itoa(r.Priority) + ": " + r.Selector + " lookup " + strconv.Itoa(r.Table)
+}
+
+// LeakedVeths returns the veth interfaces of the task bridge whose peer is in
+// the host network namespace. The ecs-bridge CNI plugin moves the peer into
+// the namespace of the task, so such a pair was left behind by a task whose
+// network setup did not complete.
+func (n *Network) LeakedVeths() ([]string, error) {
+	output, err := n.ip("-o", "link", "show", "type", "veth")
+	if err != nil {
+		return nil, err
+	}
+	var leaked []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !hasAttribute(fields, "master", taskBridge) {
+			continue
+		}
+		if hasAttribute(fields, linkNetnsID, "") {
+			continue
+		}
+		name := strings.TrimSuffix(fields[1], ":")
+		if i := strings.Index(name, "@"); i >= 0 {
+			name = name[:i]
+		}
+		leaked = append(leaked, name)
+	}
+	return leaked, scanner.Err()
+}
+
+// hasAttribute returns if fields contain the attribute key with the given
+// value, or with any value if value is empty
+func hasAttribute(fields []string, key, value string) bool {
+	for i := 0; i < len(fields)-1; i++ {
+		if fields[i] == key && (value == "" || fields[i+1] == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteVeth deletes the veth interface and its peer
+func (n *Network) DeleteVeth(name string) error {
+	_, err := n.ip("link", "delete", name, "type", "veth")
+	return err
+}
+
+// LeakedRules returns the IPv4 routing rules that look up an empty numbered
+// routing table. The routes of a task are removed with its interfaces, which
+// leaves the rules directing its traffic to them pointing nowhere.
+func (n *Network) LeakedRules() ([]Rule, error) {
+	output, err := n.ip("-4", "rule", "show")
+	if err != nil {
+		return nil, err
+	}
+	var leaked []Rule
+	empty := make(map[int]bool)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		rule, ok := parseRule(scanner.Text())
+		if !ok {
+			continue
+		}
+		isEmpty, checked := empty[rule.Table]
+		if !checked {
+			routes, err := n.ip("-4", "route", "show", "table", strconv.Itoa(rule.Table))
+			if err != nil {
+				return nil, err
+			}
+			isEmpty = strings.TrimSpace(routes) == ""
+			empty[rule.Table] = isEmpty
+		}
+		if isEmpty {
+			leaked = append(leaked, rule)
+		}
+	}
+	return leaked, scanner.Err()
+}
+
+// parseRule parses a line of 'ip rule show', such as
+// "100:	from 10.0.1.5 lookup 101". Rules that do not look up a numbered
+// table, such as those of the local, main and default tables, are skipped.
+func parseRule(line string) (Rule, bool) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return Rule{}, false
+	}
+	priority, err := strconv.Atoi(strings.TrimSpace(line[:i]))
+	if err != nil {
+		return Rule{}, false
+	}
+	fields := strings.Fields(line[i+1:])
+	for j := 0; j < len(fields)-1; j++ {
+		if fields[j] != "lookup" {
+			continue
+		}
+		table, err := strconv.Atoi(fields[j+1])
+		if err != nil {
+			return Rule{}, false
+		}
+		return Rule{
+			Priority: priority,
+			Selector: strings.Join(fields[:j], " "),
+			Table:    table,
+		}, true
+	}
+	return Rule{}, false
+}
+
+// DeleteRule deletes the routing rule
+func (n *Network) DeleteRule(rule Rule) error {
+	if rule.Table <= 0 {
+		return errors.Errorf("invalid routing rule %s", rule)
+	}
+	_, err := n.ip("-4", "rule", "delete", "priority", strconv.Itoa(rule.Priority),
+		"table", strconv.Itoa(rule.Table))
+	return err
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package netns
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const vethLinks = `7: veth8d1c2e3f@if3: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue master ecs-bridge state UP mode DEFAULT group default \    link/ether 5a:0b:9c:3d:2e:1f brd ff:ff:ff:ff:ff:ff link-netnsid 0
+8: vethe1f2a3b4@vethe1f2a3b5: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue master ecs-bridge state UP mode DEFAULT group default \    link/ether 5a:0b:9c:3d:2e:20 brd ff:ff:ff:ff:ff:ff
+9: vethe1f2a3b5@vethe1f2a3b4: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue state UP mode DEFAULT group default \    link/ether 5a:0b:9c:3d:2e:21 brd ff:ff:ff:ff:ff:ff
+10: veth0a1b2c3@veth0a1b2c4: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue master docker0 state UP mode DEFAULT group default \    link/ether 5a:0b:9c:3d:2e:22 brd ff:ff:ff:ff:ff:ff
+`
+
+const rules = `0:	from all lookup local
+100:	from 10.0.1.5 lookup 101
+101:	from 10.0.1.6 lookup 102
+102:	from 10.0.1.7 lookup 101
+200:	from all fwmark 0x1 lookup custom
+32766:	from all lookup main
+32767:	from all lookup default
+`
+
+func newTestNetwork(ctrl *gomock.Controller) (*Network, *MockExec) {
+	mockExec := NewMockExec(ctrl)
+	return &Network{cmdExec: mockExec}, mockExec
+}
+
+// expectIP expects the 'ip' command to be run with args and output output
+func expectIP(ctrl *gomock.Controller, mockExec *MockExec, output string, args ...string) *gomock.Call {
+	mockCmd := NewMockCmd(ctrl)
+	mockCmd.EXPECT().CombinedOutput().Return([]byte(output), nil)
+	var ipArgs []interface{}
+	for _, arg := range args {
+		ipArgs = append(ipArgs, arg)
+	}
+	return mockExec.EXPECT().Command(ipExecutable, ipArgs...).Return(mockCmd)
+}
+
+func TestLeakedVeths(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	network, mockExec := newTestNetwork(ctrl)
+	expectIP(ctrl, mockExec, vethLinks, "-o", "link", "show", "type", "veth")
+
+	leaked, err := network.LeakedVeths()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vethe1f2a3b4"}, leaked)
+}
+
+func TestDeleteVeth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	network, mockExec := newTestNetwork(ctrl)
+	expectIP(ctrl, mockExec, "", "link", "delete", "vethe1f2a3b4", "type", "veth")
+
+	assert.NoError(t, network.DeleteVeth("vethe1f2a3b4"))
+}
+
+func TestLeakedRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	network, mockExec := newTestNetwork(ctrl)
+	gomock.InOrder(
+		expectIP(ctrl, mockExec, rules, "-4", "rule", "show"),
+		expectIP(ctrl, mockExec, "", "-4", "route", "show", "table", "101"),
+		expectIP(ctrl, mockExec, "default via 10.0.1.1 dev eth1\n", "-4", "route", "show", "table", "102"),
+	)
+
+	leaked, err := network.LeakedRules()
+	assert.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Priority: 100, Selector: "from 10.0.1.5", Table: 101},
+		{Priority: 102, Selector: "from 10.0.1.7", Table: 101},
+	}, leaked)
+	assert.Equal(t, "100: from 10.0.1.5 lookup 101", leaked[0].String())
+}
+
+func TestDeleteRule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	network, mockExec := newTestNetwork(ctrl)
+	expectIP(ctrl, mockExec, "", "-4", "rule", "delete", "priority", "100", "table", "101")
+
+	assert.NoError(t, network.DeleteRule(Rule{Priority: 100, Selector: "from 10.0.1.5", Table: 101}))
+	assert.Error(t, network.DeleteRule(Rule{Priority: 0, Selector: "from all"}))
+}
+
+func TestParseRule(t *testing.T) {
+	rule, ok := parseRule("100:	from 10.0.1.5 lookup 101")
+	assert.True(t, ok)
+	assert.Equal(t, Rule{Priority: 100, Selector: "from 10.0.1.5", Table: 101}, rule)
+
+	for _, line := range []string{
+		"0:	from all lookup local",
+		"200:	from all fwmark 0x1 lookup custom",
+		"300:	from all unreachable",
+		"not a rule",
+	} {
+		_, ok := parseRule(line)
+		assert.False(t, ok, line)
+	}
+}
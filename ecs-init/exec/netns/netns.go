@@ -0,0 +1,115 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package netns finds and deletes the network namespaces, veth interfaces and
+// routing rules left behind by tasks
+package netns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+
+	"github.com/pkg/errors"
+)
+
+const ipExecutable = "ip"
+
+// Network implements the engine.hostNetwork interface by reading procfs and
+// running the external 'ip' command
+type Network struct {
+	cmdExec  exec.Exec
+	procDir  string
+	netnsDir string
+}
+
+// NewNetwork creates a new Network object
+func NewNetwork(cmdExec exec.Exec) *Network {
+	return &Network{
+		cmdExec:  cmdExec,
+		procDir:  config.ProcFS,
+		netnsDir: config.NetnsDirectory(),
+	}
+}
+
+// LeakedNamespaces returns the names of the named network namespaces that no process is
+// in. A namespace only kept alive by its name belongs to no running task.
+func (n *Network) LeakedNamespaces() ([]string, error) {
+	entries, err := ioutil.ReadDir(n.netnsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "could not read %s", n.netnsDir)
+	}
+	var leaked []string
+	var inUse map[uint64]bool
+	for _, entry := range entries {
+		var stat syscall.Stat_t
+		err := syscall.Stat(filepath.Join(n.netnsDir, entry.Name()), &stat)
+		if err != nil {
+			continue
+		}
+		if inUse == nil {
+			inUse = n.namespacesInUse()
+		}
+		if !inUse[stat.Ino] {
+			leaked = append(leaked, entry.Name())
+		}
+	}
+	return leaked, nil
+}
+
+// namespacesInUse returns the inodes of the network namespaces of every
+// process
+func (n *Network) namespacesInUse() map[uint64]bool {
+	inUse := make(map[uint64]bool)
+	links, _ := filepath.Glob(filepath.Join(n.procDir, "[0-9]*", "ns", "net"))
+	for _, link := range links {
+		target, err := os.Readlink(link)
+		if err != nil {
+			// the process exited or is not ours to inspect
+			continue
+		}
+		var inode uint64
+		_, err = fmt.Sscanf(target, "net:[%d]", &inode)
+		if err == nil {
+			inUse[inode] = true
+		}
+	}
+	return inUse
+}
+
+// DeleteNamespace deletes the named network namespace
+func (n *Network) DeleteNamespace(name string) error {
+	if strings.ContainsRune(name, '/') {
+		return errors.Errorf("invalid network namespace %q", name)
+	}
+	_, err := n.ip("netns", "delete", name)
+	return err
+}
+
+// ip runs the 'ip' command with args and returns its output
+func (n *Network) ip(args ...string) (string, error) {
+	output, err := n.cmdExec.Command(ipExecutable, args...).CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "ip %s failed: %s", strings.Join(args, " "), strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package netns
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestNamespaces creates the named namespaces as files, and a process in
+// each namespace of inUse
+func newTestNamespaces(t *testing.T, names []string, inUse []string) *Network {
+	dir := t.TempDir()
+	netnsDir := filepath.Join(dir, "netns")
+	procDir := filepath.Join(dir, "proc")
+	require.NoError(t, os.MkdirAll(netnsDir, 0755))
+	for _, name := range names {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(netnsDir, name), nil, 0644))
+	}
+	for pid, name := range inUse {
+		var stat syscall.Stat_t
+		require.NoError(t, syscall.Stat(filepath.Join(netnsDir, name), &stat))
+		nsDir := filepath.Join(procDir, fmt.Sprint(pid+1), "ns")
+		require.NoError(t, os.MkdirAll(nsDir, 0755))
+		require.NoError(t, os.Symlink(fmt.Sprintf("net:[%d]", stat.Ino), filepath.Join(nsDir, "net")))
+	}
+	return &Network{
+		procDir:  procDir,
+		netnsDir: netnsDir,
+	}
+}
+
+func TestLeakedNamespaces(t *testing.T) {
+	namespaces := newTestNamespaces(t, []string{"task-1", "task-2", "task-3"}, []string{"task-2"})
+
+	leaked, err := namespaces.LeakedNamespaces()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"task-1", "task-3"}, leaked)
+}
+
+func TestLeakedNamespacesNoDirectory(t *testing.T) {
+	namespaces := &Network{
+		procDir:  "/nonexistent/proc",
+		netnsDir: "/nonexistent/netns",
+	}
+	leaked, err := namespaces.LeakedNamespaces()
+	assert.NoError(t, err)
+	assert.Empty(t, leaked)
+}
+
+func TestDeleteNamespace(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockCmd := NewMockCmd(ctrl)
+	mockExec.EXPECT().Command(ipExecutable, "netns", "delete", "task-1").Return(mockCmd)
+	mockCmd.EXPECT().CombinedOutput()
+
+	namespaces := &Network{cmdExec: mockExec}
+	assert.NoError(t, namespaces.DeleteNamespace("task-1"))
+}
+
+func TestDeleteNamespaceError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockCmd := NewMockCmd(ctrl)
+	mockExec.EXPECT().Command(ipExecutable, "netns", "delete", "task-1").Return(mockCmd)
+	mockCmd.EXPECT().CombinedOutput().Return([]byte("Device or resource busy"), errors.New("exit status 1"))
+
+	namespaces := &Network{cmdExec: mockExec}
+	err := namespaces.DeleteNamespace("task-1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Device or resource busy")
+}
+
+func TestDeleteNamespaceInvalidName(t *testing.T) {
+	namespaces := &Network{}
+	assert.Error(t, namespaces.DeleteNamespace("../task-1"))
+}
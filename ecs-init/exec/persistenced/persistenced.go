@@ -0,0 +1,119 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package persistenced
+
+import (
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	systemctlExecutable = "systemctl"
+	// Unit is the systemd unit of the NVIDIA persistence daemon, which keeps
+	// the GPUs initialized while no process uses them
+	Unit = "nvidia-persistenced.service"
+	// loadStateProperty is the unit property holding if its unit file was
+	// found, 'not-found' when the daemon is not installed
+	loadStateProperty = "LoadState"
+	// activeStateProperty is the unit property holding its state, such as
+	// 'active', 'failed' or 'activating'
+	activeStateProperty = "ActiveState"
+	unitNotFound        = "not-found"
+	unitActive          = "active"
+)
+
+// Daemon implements the engine.persistenceDaemon interface by running the
+// external 'systemctl' command
+type Daemon struct {
+	cmdExec exec.Exec
+}
+
+// NewDaemon creates a new Daemon object
+func NewDaemon(cmdExec exec.Exec) *Daemon {
+	return &Daemon{
+		cmdExec: cmdExec,
+	}
+}
+
+// Ensure enables and starts the NVIDIA persistence daemon when it is installed
+// and not running. The GPUs are not initialized on the first boot of large
+// GPU instances until the daemon or another process opens them, so the daemon
+// has to run before they are detected.
+func (d *Daemon) Ensure() error {
+	_, err := d.cmdExec.LookPath(systemctlExecutable)
+	if err != nil {
+		log.Warnf("Not managing %s: could not find '%s' executable", Unit, systemctlExecutable)
+		return nil
+	}
+	loadState, activeState, err := d.unitState()
+	if err != nil {
+		return err
+	}
+	if loadState == unitNotFound {
+		log.Infof("%s is not installed", Unit)
+		return nil
+	}
+	if activeState == unitActive {
+		return nil
+	}
+
+	log.Infof("Starting %s: state=%s", Unit, activeState)
+	// the daemon is enabled so that it starts before ecs-init on the next
+	// boots, and is started even when it cannot be
+	out, err := d.cmdExec.Command(systemctlExecutable, "enable", Unit).CombinedOutput()
+	if err != nil {
+		log.Warnf("Could not enable %s: %v; raw output: %s", Unit, err, out)
+	} else {
+		hostmanifest.Record(hostmanifest.KindUnit, Unit, hostmanifest.Enabled)
+	}
+	out, err = d.cmdExec.Command(systemctlExecutable, "start", Unit).CombinedOutput()
+	if err != nil {
+		log.Errorf("Error starting %s %v; raw output: %s", Unit, err, out)
+		return errors.Wrapf(err, "systemctl start %s failed", Unit)
+	}
+	_, activeState, err = d.unitState()
+	if err != nil {
+		return err
+	}
+	if activeState != unitActive {
+		return errors.Errorf("%s is %s after it was started", Unit, activeState)
+	}
+	return nil
+}
+
+// unitState returns the load and active states of the unit of the daemon
+func (d *Daemon) unitState() (string, string, error) {
+	out, err := d.cmdExec.Command(systemctlExecutable, "show",
+		"--property="+loadStateProperty, "--property="+activeStateProperty, Unit).Output()
+	if err != nil {
+		return "", "", errors.Wrapf(err, "could not read the state of %s", Unit)
+	}
+	properties := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			properties[parts[0]] = parts[1]
+		}
+	}
+	loadState, activeState := properties[loadStateProperty], properties[activeStateProperty]
+	if loadState == "" || activeState == "" {
+		return "", "", errors.Errorf("no state reported for %s", Unit)
+	}
+	return loadState, activeState, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package persistenced
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// expectShow expects the state of the unit to be read and returns output
+func expectShow(ctrl *gomock.Controller, mockExec *MockExec, output string) *gomock.Call {
+	mockShow := NewMockCmd(ctrl)
+	mockShow.EXPECT().Output().Return([]byte(output), nil)
+	return mockExec.EXPECT().Command(systemctlExecutable, "show",
+		"--property=LoadState", "--property=ActiveState", Unit).Return(mockShow)
+}
+
+// expectSystemctl expects 'systemctl verb' to be run on the unit
+func expectSystemctl(ctrl *gomock.Controller, mockExec *MockExec, verb string, err error) *gomock.Call {
+	mockCmd := NewMockCmd(ctrl)
+	mockCmd.EXPECT().CombinedOutput().Return(nil, err)
+	return mockExec.EXPECT().Command(systemctlExecutable, verb, Unit).Return(mockCmd)
+}
+
+func TestEnsureActive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil),
+		expectShow(ctrl, mockExec, "LoadState=loaded\nActiveState=active\n"),
+	)
+
+	assert.NoError(t, NewDaemon(mockExec).Ensure())
+}
+
+func TestEnsureNotInstalled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil),
+		expectShow(ctrl, mockExec, "LoadState=not-found\nActiveState=inactive\n"),
+	)
+
+	assert.NoError(t, NewDaemon(mockExec).Ensure())
+}
+
+func TestEnsureNoSystemctl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockExec.EXPECT().LookPath(systemctlExecutable).Return("", errors.New("not found"))
+
+	assert.NoError(t, NewDaemon(mockExec).Ensure())
+}
+
+func TestEnsureStarts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil),
+		expectShow(ctrl, mockExec, "LoadState=loaded\nActiveState=inactive\n"),
+		// the daemon is started even when it cannot be enabled
+		expectSystemctl(ctrl, mockExec, "enable", errors.New("exit status 1")),
+		expectSystemctl(ctrl, mockExec, "start", nil),
+		expectShow(ctrl, mockExec, "LoadState=loaded\nActiveState=active\n"),
+	)
+
+	hostmanifest.Take()
+	assert.NoError(t, NewDaemon(mockExec).Ensure())
+	// the unit is not recorded as enabled when it could not be
+	assert.Empty(t, hostmanifest.Take())
+}
+
+func TestEnsureRecordsEnabledUnit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil),
+		expectShow(ctrl, mockExec, "LoadState=loaded\nActiveState=inactive\n"),
+		expectSystemctl(ctrl, mockExec, "enable", nil),
+		expectSystemctl(ctrl, mockExec, "start", nil),
+		expectShow(ctrl, mockExec, "LoadState=loaded\nActiveState=active\n"),
+	)
+
+	hostmanifest.Take()
+	assert.NoError(t, NewDaemon(mockExec).Ensure())
+	mutations := hostmanifest.Take()
+	if assert.Len(t, mutations, 1) {
+		assert.Equal(t, hostmanifest.KindUnit, mutations[0].Kind)
+		assert.Equal(t, Unit, mutations[0].Target)
+		assert.Equal(t, hostmanifest.Enabled, mutations[0].Value)
+	}
+}
+
+func TestEnsureStartFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil),
+		expectShow(ctrl, mockExec, "LoadState=loaded\nActiveState=failed\n"),
+		expectSystemctl(ctrl, mockExec, "enable", nil),
+		expectSystemctl(ctrl, mockExec, "start", errors.New("exit status 1")),
+	)
+
+	assert.Error(t, NewDaemon(mockExec).Ensure())
+}
+
+func TestEnsureNotActiveAfterStart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil),
+		expectShow(ctrl, mockExec, "LoadState=loaded\nActiveState=inactive\n"),
+		expectSystemctl(ctrl, mockExec, "enable", nil),
+		expectSystemctl(ctrl, mockExec, "start", nil),
+		expectShow(ctrl, mockExec, "LoadState=loaded\nActiveState=failed\n"),
+	)
+
+	err := NewDaemon(mockExec).Ensure()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed after it was started")
+}
+
+func TestEnsureNoState(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil),
+		expectShow(ctrl, mockExec, "LoadState=loaded\n"),
+	)
+
+	assert.Error(t, NewDaemon(mockExec).Ensure())
+}
@@ -0,0 +1,216 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package reservation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	systemctlExecutable = "systemctl"
+	// systemSliceDropIn pins the memory reserved for system daemons to the
+	// slice systemd starts them in
+	systemSliceDropIn = "system.slice.d/50-ecs-reserved.conf"
+	// TasksSlice is the slice whose memory is capped to what is left for
+	// task containers
+	TasksSlice = "ecs-tasks.slice"
+	// cgroupParentKey is the Docker daemon setting of the cgroup parent of
+	// the containers that do not set their own
+	cgroupParentKey = "cgroup-parent"
+	// reservedMemoryEnvVar is the Agent setting for memory it must not
+	// allocate to tasks
+	reservedMemoryEnvVar = "ECS_RESERVED_MEMORY"
+	unitFilePerm         = 0644
+	unitDirPerm          = 0755
+	instanceConfigPerm   = 0644
+)
+
+// Reserver implements the engine.hostReservation interface by writing systemd
+// units and running the external 'systemctl' command
+type Reserver struct {
+	cmdExec exec.Exec
+	fs      fileSystem
+}
+
+// NewReserver creates a new Reserver object
+func NewReserver(cmdExec exec.Exec) *Reserver {
+	return &Reserver{
+		cmdExec: cmdExec,
+		fs:      standardFS,
+	}
+}
+
+// Reserve sets memoryMiB of the instance memory aside for system daemons. The
+// memory is protected in the system slice, the rest is the limit of the tasks
+// slice, and the Agent is configured not to allocate the memory to tasks.
+// Docker is checked to start containers in the tasks slice, which is left to
+// the operator as it takes a restart of the daemon.
+func (r *Reserver) Reserve(memoryMiB int64) error {
+	_, err := r.cmdExec.LookPath(systemctlExecutable)
+	if err != nil {
+		return errors.Wrapf(err, "could not find '%s' executable", systemctlExecutable)
+	}
+	totalMiB, err := r.totalMemory()
+	if err != nil {
+		return err
+	}
+	if memoryMiB <= 0 || memoryMiB >= totalMiB {
+		return errors.Errorf("reserved memory must be between 0 and %dMiB, got %dMiB", totalMiB, memoryMiB)
+	}
+	log.Infof("Reserving %dMiB of %dMiB of memory for system daemons", memoryMiB, totalMiB)
+
+	err = r.writeUnit(systemSliceDropIn, fmt.Sprintf("[Slice]\nMemoryLow=%dM\n", memoryMiB))
+	if err != nil {
+		return err
+	}
+	err = r.writeUnit(TasksSlice, fmt.Sprintf(
+		"[Unit]\nDescription=Amazon Elastic Container Service tasks\nBefore=slices.target\n\n[Slice]\nMemoryLimit=%dM\nMemoryMax=%dM\n",
+		totalMiB-memoryMiB, totalMiB-memoryMiB))
+	if err != nil {
+		return err
+	}
+	err = r.systemctl("daemon-reload")
+	if err != nil {
+		return err
+	}
+	err = r.systemctl("start", TasksSlice)
+	if err != nil {
+		return err
+	}
+	err = r.checkDockerCgroupParent()
+	if err != nil {
+		return err
+	}
+	return r.setInstanceConfig(reservedMemoryEnvVar, strconv.FormatInt(memoryMiB, 10))
+}
+
+// totalMemory returns the memory of the instance in MiB
+func (r *Reserver) totalMemory() (int64, error) {
+	meminfo, err := r.fs.ReadFile(config.ProcFS + "/meminfo")
+	if err != nil {
+		return 0, errors.Wrap(err, "could not read memory information")
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(meminfo))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kib, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, errors.Wrap(err, "could not parse total memory")
+		}
+		return kib / 1024, nil
+	}
+	return 0, errors.New("total memory not found in memory information")
+}
+
+func (r *Reserver) writeUnit(name string, content string) error {
+	filename := config.SystemdUnitDirectory() + "/" + name
+	err := r.fs.MkdirAll(filepath.Dir(filename), unitDirPerm)
+	if err != nil {
+		return errors.Wrapf(err, "could not create directory for %s", name)
+	}
+	err = r.fs.WriteFile(filename, []byte(content), unitFilePerm)
+	if err != nil {
+		return errors.Wrapf(err, "could not write %s", name)
+	}
+	hostmanifest.RecordFile(filename, []byte(content))
+	return nil
+}
+
+func (r *Reserver) systemctl(arg ...string) error {
+	cmd := r.cmdExec.Command(systemctlExecutable, arg...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Errorf("Error running systemctl %s %v; raw output: %s", strings.Join(arg, " "), err, out)
+		return errors.Wrapf(err, "systemctl %s failed", strings.Join(arg, " "))
+	}
+	return nil
+}
+
+// checkDockerCgroupParent checks that the tasks slice is the cgroup parent of
+// the containers Docker starts, so that task containers are limited by the
+// slice and leave the system slice. The daemon config is not changed, as the
+// daemon only reads it when it starts and restarting it stops the running
+// tasks: the missing setting is logged for the operator to make, and another
+// cgroup parent is an error.
+func (r *Reserver) checkDockerCgroupParent() error {
+	filename := config.DockerDaemonConfigFile()
+	settings := make(map[string]interface{})
+	existing, err := r.fs.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "could not read Docker daemon config")
+	}
+	if len(bytes.TrimSpace(existing)) > 0 {
+		err = json.Unmarshal(existing, &settings)
+		if err != nil {
+			return errors.Wrap(err, "could not parse Docker daemon config")
+		}
+	}
+	parent, ok := settings[cgroupParentKey]
+	if !ok {
+		log.Warnf("Task containers are not limited by %s: set \"%s\": \"%s\" in %s and restart Docker",
+			TasksSlice, cgroupParentKey, TasksSlice, filename)
+		return nil
+	}
+	if parent != TasksSlice {
+		return errors.Errorf("the Docker daemon already sets %s %v, task containers cannot be moved to %s",
+			cgroupParentKey, parent, TasksSlice)
+	}
+	return nil
+}
+
+// setInstanceConfig sets key in the instance config file, keeping the other
+// variables recorded in it
+func (r *Reserver) setInstanceConfig(key string, value string) error {
+	existing, err := r.fs.ReadFile(config.InstanceConfigFile())
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "could not read instance config")
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(existing)), "\n") {
+		if line == "" || strings.HasPrefix(strings.TrimSpace(line), key+"=") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, key+"="+value)
+
+	err = r.fs.MkdirAll(config.InstanceConfigDirectory(), unitDirPerm)
+	if err != nil {
+		return errors.Wrap(err, "could not create instance config directory")
+	}
+	content := []byte(strings.Join(lines, "\n") + "\n")
+	err = r.fs.WriteFile(config.InstanceConfigFile(), content, instanceConfigPerm)
+	if err != nil {
+		return errors.Wrap(err, "could not write instance config")
+	}
+	hostmanifest.RecordFile(config.InstanceConfigFile(), content)
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package reservation
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const meminfo = `MemTotal:        8388608 kB
+MemFree:         6291456 kB
+`
+
+func newTestReserver(ctrl *gomock.Controller) (*Reserver, *MockExec, *MockfileSystem) {
+	mockExec := NewMockExec(ctrl)
+	mockFS := NewMockfileSystem(ctrl)
+	return &Reserver{
+		cmdExec: mockExec,
+		fs:      mockFS,
+	}, mockExec, mockFS
+}
+
+func TestReserve(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reserver, mockExec, mockFS := newTestReserver(ctrl)
+	mockReload := NewMockCmd(ctrl)
+	mockStart := NewMockCmd(ctrl)
+
+	gomock.InOrder(
+		mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil),
+		mockFS.EXPECT().ReadFile(config.ProcFS+"/meminfo").Return([]byte(meminfo), nil),
+		mockFS.EXPECT().MkdirAll(config.SystemdUnitDirectory()+"/system.slice.d", os.FileMode(unitDirPerm)),
+		mockFS.EXPECT().WriteFile(config.SystemdUnitDirectory()+"/"+systemSliceDropIn,
+			[]byte("[Slice]\nMemoryLow=512M\n"), os.FileMode(unitFilePerm)),
+		mockFS.EXPECT().MkdirAll(config.SystemdUnitDirectory(), os.FileMode(unitDirPerm)),
+		mockFS.EXPECT().WriteFile(config.SystemdUnitDirectory()+"/"+TasksSlice, gomock.Any(), os.FileMode(unitFilePerm)).Do(
+			func(filename string, data []byte, perm os.FileMode) {
+				assert.Contains(t, string(data), "MemoryMax=7680M\n")
+			}),
+		mockExec.EXPECT().Command(systemctlExecutable, "daemon-reload").Return(mockReload),
+		mockReload.EXPECT().CombinedOutput(),
+		mockExec.EXPECT().Command(systemctlExecutable, "start", TasksSlice).Return(mockStart),
+		mockStart.EXPECT().CombinedOutput(),
+		mockFS.EXPECT().ReadFile(config.DockerDaemonConfigFile()).Return(
+			[]byte(`{"cgroup-parent": "ecs-tasks.slice"}`), nil),
+		mockFS.EXPECT().ReadFile(config.InstanceConfigFile()).Return(
+			[]byte("ECS_ENABLE_GPU_SUPPORT=true\nECS_RESERVED_MEMORY=256\n"), nil),
+		mockFS.EXPECT().MkdirAll(config.InstanceConfigDirectory(), os.FileMode(unitDirPerm)),
+		mockFS.EXPECT().WriteFile(config.InstanceConfigFile(),
+			[]byte("ECS_ENABLE_GPU_SUPPORT=true\nECS_RESERVED_MEMORY=512\n"), os.FileMode(instanceConfigPerm)),
+	)
+
+	err := reserver.Reserve(512)
+	assert.NoError(t, err)
+}
+
+func TestReserveNoSystemctl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reserver, mockExec, _ := newTestReserver(ctrl)
+	mockExec.EXPECT().LookPath(systemctlExecutable).Return("", errors.New("not found"))
+
+	err := reserver.Reserve(512)
+	assert.Error(t, err)
+}
+
+func TestReserveMoreThanTotalMemory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reserver, mockExec, mockFS := newTestReserver(ctrl)
+	mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil)
+	mockFS.EXPECT().ReadFile(config.ProcFS+"/meminfo").Return([]byte(meminfo), nil)
+
+	err := reserver.Reserve(8192)
+	assert.Error(t, err)
+}
+
+func TestReserveSystemctlError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reserver, mockExec, mockFS := newTestReserver(ctrl)
+	mockReload := NewMockCmd(ctrl)
+	mockExec.EXPECT().LookPath(systemctlExecutable).Return("/usr/bin/systemctl", nil)
+	mockFS.EXPECT().ReadFile(config.ProcFS+"/meminfo").Return([]byte(meminfo), nil)
+	mockFS.EXPECT().MkdirAll(gomock.Any(), gomock.Any()).Times(2)
+	mockFS.EXPECT().WriteFile(gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+	mockExec.EXPECT().Command(systemctlExecutable, "daemon-reload").Return(mockReload)
+	mockReload.EXPECT().CombinedOutput().Return([]byte("failed"), errors.New("exit status 1"))
+
+	err := reserver.Reserve(512)
+	assert.Error(t, err)
+}
+
+func TestCheckDockerCgroupParentNotSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Docker is neither reconfigured nor restarted
+	reserver, _, mockFS := newTestReserver(ctrl)
+	mockFS.EXPECT().ReadFile(config.DockerDaemonConfigFile()).Return([]byte(`{"live-restore": true}`), nil)
+
+	assert.NoError(t, reserver.checkDockerCgroupParent())
+}
+
+func TestCheckDockerCgroupParentNoConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reserver, _, mockFS := newTestReserver(ctrl)
+	mockFS.EXPECT().ReadFile(config.DockerDaemonConfigFile()).Return(nil, os.ErrNotExist)
+
+	assert.NoError(t, reserver.checkDockerCgroupParent())
+}
+
+func TestCheckDockerCgroupParentConflict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reserver, _, mockFS := newTestReserver(ctrl)
+	mockFS.EXPECT().ReadFile(config.DockerDaemonConfigFile()).Return([]byte(`{"cgroup-parent": "custom.slice"}`), nil)
+
+	assert.Error(t, reserver.checkDockerCgroupParent())
+}
+
+func TestTotalMemoryMissing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reserver, _, mockFS := newTestReserver(ctrl)
+	mockFS.EXPECT().ReadFile(config.ProcFS+"/meminfo").Return([]byte("MemFree: 1024 kB\n"), nil)
+
+	_, err := reserver.totalMemory()
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package startgate
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const shell = "/bin/sh"
+
+// Checker implements the engine.startGate interface by looking at the file
+// system and running shell commands
+type Checker struct {
+	cmdExec exec.Exec
+}
+
+// NewChecker creates a new Checker object
+func NewChecker(cmdExec exec.Exec) *Checker {
+	return &Checker{
+		cmdExec: cmdExec,
+	}
+}
+
+// FileExists returns an error if there is no file at path
+func (c *Checker) FileExists(path string) error {
+	_, err := os.Stat(path)
+	return err
+}
+
+// CommandSucceeds runs command with the shell and returns an error if it
+// exits with a non-zero code
+func (c *Checker) CommandSucceeds(command string) error {
+	out, err := c.cmdExec.Command(shell, "-c", command).CombinedOutput()
+	if err != nil {
+		log.Debugf("Start gate command %q failed: %v; raw output: %s", command, err, out)
+		return errors.Wrapf(err, "%q failed: %s", command, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package startgate
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileExists(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "provisioned")
+	checker := NewChecker(nil)
+	assert.Error(t, checker.FileExists(path))
+	assert.NoError(t, ioutil.WriteFile(path, nil, 0644))
+	assert.NoError(t, checker.FileExists(path))
+}
+
+func TestCommandSucceeds(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockCmd := NewMockCmd(ctrl)
+	gomock.InOrder(
+		mockExec.EXPECT().Command(shell, "-c", "systemctl is-active falcon-sensor").Return(mockCmd),
+		mockCmd.EXPECT().CombinedOutput().Return([]byte("active\n"), nil),
+	)
+
+	assert.NoError(t, NewChecker(mockExec).CommandSucceeds("systemctl is-active falcon-sensor"))
+}
+
+func TestCommandFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockCmd := NewMockCmd(ctrl)
+	mockExec.EXPECT().Command(shell, "-c", "test -b /dev/xvdb").Return(mockCmd)
+	mockCmd.EXPECT().CombinedOutput().Return(nil, errors.New("exit status 1"))
+
+	assert.Error(t, NewChecker(mockExec).CommandSucceeds("test -b /dev/xvdb"))
+}
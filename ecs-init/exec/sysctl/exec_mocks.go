@@ -18,6 +18,7 @@
 package sysctl
 
 import (
+	context "context"
 	reflect "reflect"
 
 	cmd "github.com/aws/amazon-ecs-init/ecs-init/cmd"
@@ -80,3 +81,22 @@ func (mr *MockExecMockRecorder) Command(name interface{}, arg ...interface{}) *g
 	varargs := append([]interface{}{name}, arg...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Command", reflect.TypeOf((*MockExec)(nil).Command), varargs...)
 }
+
+// CommandContext mocks base method
+func (m *MockExec) CommandContext(ctx context.Context, name string, arg ...string) cmd.Cmd {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, name}
+	for _, a := range arg {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "CommandContext", varargs...)
+	ret0, _ := ret[0].(cmd.Cmd)
+	return ret0
+}
+
+// CommandContext indicates an expected call of CommandContext
+func (mr *MockExecMockRecorder) CommandContext(ctx, name interface{}, arg ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, name}, arg...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommandContext", reflect.TypeOf((*MockExec)(nil).CommandContext), varargs...)
+}
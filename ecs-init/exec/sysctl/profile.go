@@ -0,0 +1,215 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sysctl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+	log "github.com/cihub/seelog"
+)
+
+// Profile is a set of kernel parameters and the values they should have.
+// Parameters prefixed with optionalPrefix are optional.
+type Profile map[string]string
+
+// optionalPrefix marks the parameters that are skipped when the kernel does
+// not have them, as in sysctl.d
+const optionalPrefix = "-"
+
+// DefaultProfile is the profile applied to instances running tasks. Its
+// values may be overridden, and parameters added, by the profile file. The
+// conntrack parameters only exist once the nf_conntrack module is loaded.
+var DefaultProfile = Profile{
+	"net.ipv4.ip_forward":             "1",
+	"-net.netfilter.nf_conntrack_max": "262144",
+	"fs.inotify.max_user_watches":     "524288",
+	"net.core.somaxconn":              "4096",
+}
+
+// procSysDirectory is where the kernel exposes its parameters
+var procSysDirectory = config.ProcFS + "/sys"
+
+// ProfileManager applies a sysctl profile by running the external 'sysctl'
+// command
+type ProfileManager struct {
+	cmdExec     exec.Exec
+	profileFile string
+	procSys     string
+}
+
+// NewProfileManager creates a new ProfileManager object
+func NewProfileManager(cmdExec exec.Exec) *ProfileManager {
+	return &ProfileManager{
+		cmdExec:     cmdExec,
+		profileFile: config.SysctlProfileFile(),
+		procSys:     procSysDirectory,
+	}
+}
+
+// Apply sets the kernel parameters of the profile, reporting the ones that
+// drifted from it, and verifies that the values took effect
+func (m *ProfileManager) Apply() error {
+	profile, err := m.load()
+	if err != nil {
+		return err
+	}
+	return m.apply(profile)
+}
+
+// apply sets the kernel parameters of profile. Optional parameters the kernel
+// does not have, such as the conntrack parameters while the nf_conntrack
+// module is not loaded, are skipped. Other ones are an error, so that a typo
+// in the profile is not taken for a parameter that was applied.
+func (m *ProfileManager) apply(profile Profile) error {
+	for _, entry := range profile.keys() {
+		desired := profile[entry]
+		key, optional := parameterName(entry)
+		current, err := m.get(key)
+		if err == nil && current == desired {
+			continue
+		}
+		if err != nil && !m.exists(key) {
+			if !optional {
+				return fmt.Errorf("kernel parameter %s does not exist, prefix it with '%s' in %s if it is optional",
+					key, optionalPrefix, m.profileFile)
+			}
+			log.Warnf("Skipping optional kernel parameter %s, not supported by the kernel", key)
+			continue
+		}
+		if err == nil {
+			log.Warnf("Kernel parameter %s drifted from profile: %s, expected %s", key, current, desired)
+		}
+		err = m.set(key, desired)
+		if err != nil {
+			return err
+		}
+		current, err = m.get(key)
+		if err != nil {
+			return err
+		}
+		if current != desired {
+			return fmt.Errorf("kernel parameter %s is %s after setting it to %s", key, current, desired)
+		}
+		log.Infof("Set kernel parameter %s to %s", key, desired)
+	}
+	return nil
+}
+
+// load returns the default profile merged with the profile file
+func (m *ProfileManager) load() (Profile, error) {
+	profile := Profile{}
+	for key, value := range DefaultProfile {
+		profile[key] = value
+	}
+	data, err := ioutil.ReadFile(m.profileFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return profile, nil
+		}
+		return nil, err
+	}
+	overrides, err := parseProfile(data)
+	if err != nil {
+		return nil, err
+	}
+	for entry, value := range overrides {
+		// the profile file decides whether a default parameter is optional
+		key, _ := parameterName(entry)
+		delete(profile, key)
+		delete(profile, optionalPrefix+key)
+		profile[entry] = value
+	}
+	return profile, nil
+}
+
+// parameterName returns the name of the parameter of a profile entry, and
+// whether it is optional
+func parameterName(entry string) (string, bool) {
+	key := strings.TrimPrefix(entry, optionalPrefix)
+	return key, key != entry
+}
+
+// exists returns if the kernel has the parameter key
+func (m *ProfileManager) exists(key string) bool {
+	_, err := os.Stat(filepath.Join(m.procSys, strings.Replace(key, ".", "/", -1)))
+	return err == nil
+}
+
+func (m *ProfileManager) get(key string) (string, error) {
+	out, err := m.cmdExec.Command(sysctlExecutable, "-n", key).Output()
+	if err != nil {
+		log.Errorf("Error reading %s %v; raw output: %s", key, err, out)
+		return "", err
+	}
+	return normalize(string(out)), nil
+}
+
+func (m *ProfileManager) set(key string, value string) error {
+	out, err := m.cmdExec.Command(sysctlExecutable, "-w", fmt.Sprintf("%s=%s", key, value)).CombinedOutput()
+	if err != nil {
+		log.Errorf("Error setting %s %v; raw output: %s", key, err, out)
+		return err
+	}
+	hostmanifest.Record(hostmanifest.KindSysctl, key, value)
+	return nil
+}
+
+// parseProfile parses a profile in the format of sysctl.conf, where a key
+// prefixed with '-' is optional as in sysctl.d
+func parseProfile(data []byte) (Profile, error) {
+	profile := Profile{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid sysctl profile line %q", line)
+		}
+		profile[strings.TrimSpace(parts[0])] = normalize(parts[1])
+	}
+	return profile, scanner.Err()
+}
+
+// normalize collapses the whitespace separating the fields of a value, such
+// as net.ipv4.ip_local_port_range, so that values can be compared
+func normalize(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// keys returns the entries of the profile in the order of their parameters
+func (p Profile) keys() []string {
+	keys := make([]string, 0, len(p))
+	for key := range p {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, _ := parameterName(keys[i])
+		b, _ := parameterName(keys[j])
+		return a < b
+	})
+	return keys
+}
@@ -0,0 +1,225 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sysctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProfileManager(t *testing.T, mockExec *MockExec, profile string) *ProfileManager {
+	dir := t.TempDir()
+	profileFile := filepath.Join(dir, "sysctl.conf")
+	if profile != "" {
+		require.NoError(t, ioutil.WriteFile(profileFile, []byte(profile), 0644))
+	}
+	return &ProfileManager{
+		cmdExec:     mockExec,
+		profileFile: profileFile,
+		procSys:     filepath.Join(dir, "sys"),
+	}
+}
+
+// expectGet expects the value of key to be read and returns value
+func expectGet(ctrl *gomock.Controller, mockExec *MockExec, key string, value string) *gomock.Call {
+	mockCmd := NewMockCmd(ctrl)
+	mockCmd.EXPECT().Output().Return([]byte(value+"\n"), nil)
+	return mockExec.EXPECT().Command(sysctlExecutable, "-n", key).Return(mockCmd)
+}
+
+func TestApplyProfileNoDrift(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	for entry, value := range DefaultProfile {
+		key, _ := parameterName(entry)
+		expectGet(ctrl, mockExec, key, value)
+	}
+	manager := newTestProfileManager(t, mockExec, "")
+
+	assert.NoError(t, manager.Apply())
+}
+
+func TestApplyProfileDrift(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	for entry, value := range DefaultProfile {
+		key, _ := parameterName(entry)
+		if key != "net.core.somaxconn" {
+			expectGet(ctrl, mockExec, key, value)
+		}
+	}
+	mockSet := NewMockCmd(ctrl)
+	mockSet.EXPECT().CombinedOutput().Return(nil, nil)
+	gomock.InOrder(
+		expectGet(ctrl, mockExec, "net.core.somaxconn", "128"),
+		mockExec.EXPECT().Command(sysctlExecutable, "-w", "net.core.somaxconn=4096").Return(mockSet),
+		expectGet(ctrl, mockExec, "net.core.somaxconn", "4096"),
+	)
+	manager := newTestProfileManager(t, mockExec, "")
+
+	assert.NoError(t, manager.Apply())
+}
+
+func TestApplyProfileVerifyFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockSet := NewMockCmd(ctrl)
+	mockSet.EXPECT().CombinedOutput().Return(nil, nil)
+	gomock.InOrder(
+		expectGet(ctrl, mockExec, "fs.inotify.max_user_watches", "8192"),
+		mockExec.EXPECT().Command(sysctlExecutable, "-w", "fs.inotify.max_user_watches=524288").Return(mockSet),
+		expectGet(ctrl, mockExec, "fs.inotify.max_user_watches", "8192"),
+	)
+	manager := newTestProfileManager(t, mockExec, "")
+
+	assert.Error(t, manager.Apply())
+}
+
+func TestApplyProfileSetFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	mockSet := NewMockCmd(ctrl)
+	mockSet.EXPECT().CombinedOutput().Return([]byte("permission denied"), fmt.Errorf("exit status 255"))
+	gomock.InOrder(
+		expectGet(ctrl, mockExec, "fs.inotify.max_user_watches", "8192"),
+		mockExec.EXPECT().Command(sysctlExecutable, "-w", "fs.inotify.max_user_watches=524288").Return(mockSet),
+	)
+	manager := newTestProfileManager(t, mockExec, "")
+
+	assert.Error(t, manager.Apply())
+}
+
+// expectGetFails expects the value of key to be read and fails
+func expectGetFails(ctrl *gomock.Controller, mockExec *MockExec, key string) *gomock.Call {
+	mockCmd := NewMockCmd(ctrl)
+	mockCmd.EXPECT().Output().Return(nil, fmt.Errorf("exit status 255"))
+	return mockExec.EXPECT().Command(sysctlExecutable, "-n", key).Return(mockCmd)
+}
+
+func TestApplyProfileSkipsMissingParameter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	for entry, value := range DefaultProfile {
+		key, _ := parameterName(entry)
+		if key != "net.netfilter.nf_conntrack_max" {
+			expectGet(ctrl, mockExec, key, value)
+		}
+	}
+	// nf_conntrack is not loaded, so the parameter is not set
+	expectGetFails(ctrl, mockExec, "net.netfilter.nf_conntrack_max")
+	manager := newTestProfileManager(t, mockExec, "")
+
+	assert.NoError(t, manager.Apply())
+}
+
+func TestApplyProfileUnreadableParameter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	for entry, value := range DefaultProfile {
+		key, _ := parameterName(entry)
+		if key != "net.core.somaxconn" {
+			expectGet(ctrl, mockExec, key, value)
+		}
+	}
+	mockSet := NewMockCmd(ctrl)
+	mockSet.EXPECT().CombinedOutput().Return(nil, nil)
+	gomock.InOrder(
+		expectGetFails(ctrl, mockExec, "net.core.somaxconn"),
+		mockExec.EXPECT().Command(sysctlExecutable, "-w", "net.core.somaxconn=4096").Return(mockSet),
+		expectGet(ctrl, mockExec, "net.core.somaxconn", "4096"),
+	)
+	manager := newTestProfileManager(t, mockExec, "")
+	parameter := filepath.Join(manager.procSys, "net", "core", "somaxconn")
+	require.NoError(t, os.MkdirAll(filepath.Dir(parameter), 0755))
+	require.NoError(t, ioutil.WriteFile(parameter, []byte("128\n"), 0644))
+
+	assert.NoError(t, manager.Apply())
+}
+
+func TestApplyProfileUnknownParameter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	// a typo of net.core.somaxconn is not skipped
+	expectGetFails(ctrl, mockExec, "net.core.somaxcon")
+	manager := newTestProfileManager(t, mockExec, "")
+
+	err := manager.apply(Profile{"net.core.somaxcon": "1024"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "kernel parameter net.core.somaxcon does not exist")
+}
+
+func TestApplyProfileSkipsOptionalParameter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	expectGetFails(ctrl, mockExec, "net.ipv4.tcp_fastopen_key")
+	manager := newTestProfileManager(t, mockExec, "")
+
+	assert.NoError(t, manager.apply(Profile{"-net.ipv4.tcp_fastopen_key": "0"}))
+}
+
+func TestLoadProfileOverrides(t *testing.T) {
+	manager := newTestProfileManager(t, nil, `# fleet overrides
+net.core.somaxconn = 1024
+; port range
+net.ipv4.ip_local_port_range = 32768	60999
+`)
+
+	profile, err := manager.load()
+	assert.NoError(t, err)
+	assert.Equal(t, "1024", profile["net.core.somaxconn"])
+	assert.Equal(t, "32768 60999", profile["net.ipv4.ip_local_port_range"])
+	assert.Equal(t, DefaultProfile["net.ipv4.ip_forward"], profile["net.ipv4.ip_forward"])
+	assert.Equal(t, "4096", DefaultProfile["net.core.somaxconn"], "the default profile is not modified")
+}
+
+func TestLoadProfileOverridesOptional(t *testing.T) {
+	manager := newTestProfileManager(t, nil, `net.netfilter.nf_conntrack_max = 524288
+-net.core.somaxconn = 1024
+`)
+
+	profile, err := manager.load()
+	assert.NoError(t, err)
+	assert.Equal(t, "524288", profile["net.netfilter.nf_conntrack_max"])
+	assert.NotContains(t, profile, "-net.netfilter.nf_conntrack_max")
+	assert.Equal(t, "1024", profile["-net.core.somaxconn"])
+	assert.NotContains(t, profile, "net.core.somaxconn")
+}
+
+func TestParseProfileInvalidLine(t *testing.T) {
+	_, err := parseProfile([]byte("net.core.somaxconn\n"))
+	assert.Error(t, err)
+}
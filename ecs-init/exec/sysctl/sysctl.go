@@ -19,6 +19,7 @@ import (
 	"strings"
 
 	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
 	log "github.com/cihub/seelog"
 )
 
@@ -47,14 +48,14 @@ func NewIpv4RouteLocalNet(cmdExec exec.Exec) (*Ipv4RouteLocalnet, error) {
 	}, nil
 }
 
-// Enable enables routing to loopback addresses
+// Enable enables routing to loopback addresses. The parameter is applied as
+// a profile, so that its drift is reported and its value verified.
 func (ipv4RouteLocalnet *Ipv4RouteLocalnet) Enable() error {
-	cmd := ipv4RouteLocalnet.cmdExec.Command(sysctlExecutable, "-w", fmt.Sprintf("%s=1", allIpv4RouteLocalnetConfigKey))
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Errorf("Error enabling route_localnet %v; raw output: %s", err, out)
+	manager := &ProfileManager{
+		cmdExec: ipv4RouteLocalnet.cmdExec,
+		procSys: procSysDirectory,
 	}
-	return err
+	return manager.apply(Profile{allIpv4RouteLocalnetConfigKey: "1"})
 }
 
 // Restore restores the default value for loopback addresses
@@ -74,8 +75,10 @@ func (ipv4RouteLocalnet *Ipv4RouteLocalnet) RestoreDefault() error {
 	out, err = cmd.Output()
 	if err != nil {
 		log.Errorf("Error restoring all route_localnet %v; raw output: %s", err, out)
+		return err
 	}
-	return err
+	hostmanifest.Record(hostmanifest.KindSysctl, allIpv4RouteLocalnetConfigKey, strconv.FormatInt(defaultVal, 10))
+	return nil
 }
 
 // parse parses the default route_localnet value from the output of
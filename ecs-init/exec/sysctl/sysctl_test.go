@@ -41,7 +41,11 @@ func TestEnable(t *testing.T) {
 	mockCmd.EXPECT().CombinedOutput().Return([]byte{0}, nil)
 	mockExec := NewMockExec(ctrl)
 	mockExec.EXPECT().LookPath(sysctlExecutable).Return("", nil)
-	mockExec.EXPECT().Command(sysctlExecutable, "-w", "net.ipv4.conf.all.route_localnet=1").Return(mockCmd)
+	gomock.InOrder(
+		expectGet(ctrl, mockExec, "net.ipv4.conf.all.route_localnet", "0"),
+		mockExec.EXPECT().Command(sysctlExecutable, "-w", "net.ipv4.conf.all.route_localnet=1").Return(mockCmd),
+		expectGet(ctrl, mockExec, "net.ipv4.conf.all.route_localnet", "1"),
+	)
 	routeLocalNet, err := NewIpv4RouteLocalNet(mockExec)
 	if err != nil {
 		t.Fatalf("Error creating Ipv4RouteLocalNet object: %v", err)
@@ -61,7 +65,10 @@ func TestEnableReturnsErrorOnCommandError(t *testing.T) {
 	mockCmd.EXPECT().CombinedOutput().Return([]byte{0}, fmt.Errorf("its all in vain"))
 	mockExec := NewMockExec(ctrl)
 	mockExec.EXPECT().LookPath(sysctlExecutable).Return("", nil)
-	mockExec.EXPECT().Command(sysctlExecutable, "-w", "net.ipv4.conf.all.route_localnet=1").Return(mockCmd)
+	gomock.InOrder(
+		expectGet(ctrl, mockExec, "net.ipv4.conf.all.route_localnet", "0"),
+		mockExec.EXPECT().Command(sysctlExecutable, "-w", "net.ipv4.conf.all.route_localnet=1").Return(mockCmd),
+	)
 	routeLocalNet, err := NewIpv4RouteLocalNet(mockExec)
 	if err != nil {
 		t.Fatalf("Error creating Ipv4RouteLocalNet object: %v", err)
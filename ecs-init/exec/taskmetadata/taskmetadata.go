@@ -0,0 +1,132 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package taskmetadata checks that the task metadata endpoint answers
+// requests made from a network namespace of their own, as those of tasks are,
+// through the netfilter rules routing the endpoint to the Agent
+package taskmetadata
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/exec"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	ipExecutable   = "ip"
+	curlExecutable = "curl"
+	// namespace is the scratch network namespace requests are made from
+	namespace = "ecs-init-tmde"
+	// hostVeth and namespaceVeth are the ends of the veth pair connecting
+	// the scratch namespace to the host
+	hostVeth      = "ecs-init-tmde0"
+	namespaceVeth = "ecs-init-tmde1"
+	// hostAddress and namespaceAddress are the link-local addresses of the
+	// veth pair, outside of the ranges of the endpoint and of awsvpc tasks
+	hostAddress      = "169.254.171.253"
+	namespaceAddress = "169.254.171.254"
+	prefixLength     = "/30"
+	// endpoint is a task metadata v4 endpoint. No task has the ID in its
+	// path, so the Agent answers it with an error, which still proves that
+	// the request reached it.
+	endpoint = "http://169.254.170.2/v4/ecs-init-probe/task"
+	// requestTimeout bounds the request in seconds
+	requestTimeout = "5"
+	// noResponse is the status curl writes when no response was received
+	noResponse = "000"
+)
+
+// Prober requests the task metadata endpoint from a scratch network
+// namespace by running the external 'ip' and 'curl' commands
+type Prober struct {
+	cmdExec exec.Exec
+}
+
+// NewProber creates a new Prober
+func NewProber(cmdExec exec.Exec) *Prober {
+	return &Prober{cmdExec: cmdExec}
+}
+
+// Probe requests the task metadata endpoint from a scratch network namespace
+// and returns the HTTP status it was answered with. The namespace is removed
+// before returning.
+func (p *Prober) Probe() (int, error) {
+	// a probe interrupted by a crash may have left the namespace behind
+	p.removeNamespace()
+	defer p.removeNamespace()
+	err := p.createNamespace()
+	if err != nil {
+		return 0, err
+	}
+	output, err := p.run(ipExecutable, "netns", "exec", namespace, curlExecutable,
+		"--silent", "--output", "/dev/null", "--write-out", "%{http_code}",
+		"--max-time", requestTimeout, endpoint)
+	status := strings.TrimSpace(output)
+	if err != nil || status == noResponse {
+		return 0, errors.Errorf("no response from %s in a task network namespace: %v", endpoint, err)
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return 0, errors.Errorf("unexpected status %q from %s", status, endpoint)
+	}
+	return code, nil
+}
+
+// createNamespace creates the scratch namespace, connected to the host by a
+// veth pair and routing through it
+func (p *Prober) createNamespace() error {
+	for _, args := range [][]string{
+		{"netns", "add", namespace},
+		{"link", "add", hostVeth, "type", "veth", "peer", "name", namespaceVeth, "netns", namespace},
+		{"addr", "add", hostAddress + prefixLength, "dev", hostVeth},
+		{"link", "set", hostVeth, "up"},
+		{"-n", namespace, "addr", "add", namespaceAddress + prefixLength, "dev", namespaceVeth},
+		{"-n", namespace, "link", "set", namespaceVeth, "up"},
+		{"-n", namespace, "link", "set", "lo", "up"},
+		{"-n", namespace, "route", "add", "default", "via", hostAddress},
+	} {
+		_, err := p.run(ipExecutable, args...)
+		if err != nil {
+			return errors.Wrap(err, "could not create a task network namespace")
+		}
+	}
+	return nil
+}
+
+// removeNamespace removes the scratch namespace, which removes the veth pair
+// along with it, and the host end of the pair in case the namespace was not
+// created
+func (p *Prober) removeNamespace() {
+	_, err := p.run(ipExecutable, "netns", "delete", namespace)
+	if err == nil {
+		return
+	}
+	log.Debugf("Could not delete network namespace %s: %v", namespace, err)
+	_, err = p.run(ipExecutable, "link", "delete", hostVeth)
+	if err != nil {
+		log.Debugf("Could not delete veth %s: %v", hostVeth, err)
+	}
+}
+
+// run runs an external command and returns its output
+func (p *Prober) run(name string, args ...string) (string, error) {
+	output, err := p.cmdExec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return string(output), errors.Wrapf(err, "%s %s failed: %s", name, strings.Join(args, " "), strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package taskmetadata
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// expectCommand expects a command to be run and answered with output and err
+func expectCommand(ctrl *gomock.Controller, mockExec *MockExec, output string, err error, command string) *gomock.Call {
+	fields := strings.Fields(command)
+	args := make([]interface{}, 0, len(fields)-1)
+	for _, field := range fields[1:] {
+		args = append(args, field)
+	}
+	mockCmd := NewMockCmd(ctrl)
+	mockCmd.EXPECT().CombinedOutput().Return([]byte(output), err)
+	return mockExec.EXPECT().Command(fields[0], args...).Return(mockCmd)
+}
+
+// expectNamespace expects the scratch namespace to be created
+func expectNamespace(ctrl *gomock.Controller, mockExec *MockExec) []*gomock.Call {
+	var calls []*gomock.Call
+	for _, command := range []string{
+		"ip netns add ecs-init-tmde",
+		"ip link add ecs-init-tmde0 type veth peer name ecs-init-tmde1 netns ecs-init-tmde",
+		"ip addr add 169.254.171.253/30 dev ecs-init-tmde0",
+		"ip link set ecs-init-tmde0 up",
+		"ip -n ecs-init-tmde addr add 169.254.171.254/30 dev ecs-init-tmde1",
+		"ip -n ecs-init-tmde link set ecs-init-tmde1 up",
+		"ip -n ecs-init-tmde link set lo up",
+		"ip -n ecs-init-tmde route add default via 169.254.171.253",
+	} {
+		calls = append(calls, expectCommand(ctrl, mockExec, "", nil, command))
+	}
+	return calls
+}
+
+const curlCommand = "ip netns exec ecs-init-tmde curl --silent --output /dev/null --write-out %{http_code} " +
+	"--max-time 5 http://169.254.170.2/v4/ecs-init-probe/task"
+
+func TestProbe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	calls := []*gomock.Call{
+		expectCommand(ctrl, mockExec, "Cannot remove namespace", errors.New("exit status 1"), "ip netns delete ecs-init-tmde"),
+		expectCommand(ctrl, mockExec, "Cannot find device", errors.New("exit status 1"), "ip link delete ecs-init-tmde0"),
+	}
+	calls = append(calls, expectNamespace(ctrl, mockExec)...)
+	calls = append(calls,
+		expectCommand(ctrl, mockExec, "400", nil, curlCommand),
+		expectCommand(ctrl, mockExec, "", nil, "ip netns delete ecs-init-tmde"),
+	)
+	gomock.InOrder(calls...)
+
+	status, err := NewProber(mockExec).Probe()
+	assert.NoError(t, err)
+	assert.Equal(t, 400, status)
+}
+
+func TestProbeNoResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	calls := []*gomock.Call{
+		expectCommand(ctrl, mockExec, "", nil, "ip netns delete ecs-init-tmde"),
+	}
+	calls = append(calls, expectNamespace(ctrl, mockExec)...)
+	calls = append(calls,
+		expectCommand(ctrl, mockExec, "000", errors.New("exit status 28"), curlCommand),
+		expectCommand(ctrl, mockExec, "", nil, "ip netns delete ecs-init-tmde"),
+	)
+	gomock.InOrder(calls...)
+
+	_, err := NewProber(mockExec).Probe()
+	assert.Error(t, err)
+}
+
+func TestProbeNamespaceFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExec := NewMockExec(ctrl)
+	gomock.InOrder(
+		expectCommand(ctrl, mockExec, "", nil, "ip netns delete ecs-init-tmde"),
+		expectCommand(ctrl, mockExec, "", nil, "ip netns add ecs-init-tmde"),
+		expectCommand(ctrl, mockExec, "RTNETLINK answers: File exists", errors.New("exit status 2"),
+			"ip link add ecs-init-tmde0 type veth peer name ecs-init-tmde1 netns ecs-init-tmde"),
+		expectCommand(ctrl, mockExec, "", nil, "ip netns delete ecs-init-tmde"),
+	)
+
+	_, err := NewProber(mockExec).Probe()
+	assert.Error(t, err)
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package failurereport writes a machine-readable report of the failure that
+// stopped ecs-init from bootstrapping the Agent, so that automation such as
+// SSM documents or Auto Scaling replacement scripts can collect it and act
+// on it without parsing the log.
+package failurereport
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	reportPerm    = 0644
+	reportDirPerm = 0755
+)
+
+// Report is a failure of ecs-init as written to the report file
+type Report struct {
+	Time time.Time `json:"time"`
+	// Version is the version of ecs-init
+	Version string `json:"version"`
+	// Action is the action of ecs-init that failed, e.g. pre-start
+	Action string `json:"action"`
+	// Phase is the part of the action that failed, e.g. the pre-start step,
+	// or the action itself
+	Phase string `json:"phase"`
+	// Class is the failure class, e.g. docker-unavailable
+	Class string `json:"class"`
+	Error string `json:"error"`
+	// Remediation is a hint at how the failure can be fixed
+	Remediation string `json:"remediation"`
+	// LogLines are the last messages logged before the failure, oldest
+	// first
+	LogLines []string `json:"logLines"`
+}
+
+// Write writes report to file, replacing the report of a previous failure
+// at once so that collectors never read a partial report
+func Write(file string, report Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not encode the failure report")
+	}
+	err = os.MkdirAll(filepath.Dir(file), reportDirPerm)
+	if err != nil {
+		return errors.Wrap(err, "could not create the directory of the failure report")
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file))
+	if err != nil {
+		return errors.Wrap(err, "could not write the failure report")
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(append(data, '\n'))
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), reportPerm)
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not write the failure report")
+	}
+	return os.Rename(temp.Name(), file)
+}
+
+// Read reads the report in file
+func Read(file string) (*Report, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	err = json.Unmarshal(data, report)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode the failure report")
+	}
+	return report, nil
+}
+
+// Remove removes the report of a previous failure, if any, once the action
+// it failed succeeds
+func Remove(file string) error {
+	err := os.Remove(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
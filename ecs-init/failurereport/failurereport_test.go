@@ -0,0 +1,69 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package failurereport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRead(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "ecs", "failure.json")
+	report := Report{
+		Time:        time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC),
+		Version:     "1.42.0",
+		Action:      "pre-start",
+		Phase:       "download",
+		Class:       "checksum-mismatch",
+		Error:       "pre-start step download failed: checksum mismatch",
+		Remediation: "remove the cached Agent",
+		LogLines:    []string{"2020-06-01T12:00:00Z [ERROR] checksum mismatch"},
+	}
+	require.NoError(t, Write(file, report))
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(reportPerm), info.Mode().Perm())
+
+	read, err := Read(file)
+	require.NoError(t, err)
+	assert.Equal(t, report, *read)
+
+	report.Class = "docker-unavailable"
+	require.NoError(t, Write(file, report))
+	read, err = Read(file)
+	require.NoError(t, err)
+	assert.Equal(t, "docker-unavailable", read.Class)
+	files, err := ioutil.ReadDir(filepath.Dir(file))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "Expect no temporary file to be left behind")
+}
+
+func TestRemove(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "failure.json")
+	assert.NoError(t, Remove(file), "Expect a missing report to be ignored")
+	require.NoError(t, Write(file, Report{Action: "start"}))
+	assert.NoError(t, Remove(file))
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+}
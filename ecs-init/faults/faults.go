@@ -0,0 +1,203 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package faults injects faults into the calls ecs-init makes to Docker, S3
+// and the EC2 Instance Metadata Service, to exercise error paths in tests and
+// to validate alarms. Faults are only injected by binaries built with the
+// faultinjection build tag, and are set with ECS_INIT_FAULTS, e.g.
+// "docker-fail-call=3,corrupt-download,imds-delay=10s".
+package faults
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+)
+
+// ErrInjected is wrapped by errors returned by injected faults
+var ErrInjected = errors.New("injected fault")
+
+const (
+	dockerFailCallFault  = "docker-fail-call"
+	corruptDownloadFault = "corrupt-download"
+	imdsDelayFault       = "imds-delay"
+
+	// corruptedSuffix is the suffix of the objects corrupted when downloaded,
+	// so that the agent tarball fails its checksum while the checksum and
+	// signature files are intact
+	corruptedSuffix = ".tar"
+)
+
+// Faults are the faults to inject
+type Faults struct {
+	// DockerFailCall is the number of the Docker call that fails, counting
+	// from 1, or 0 for none
+	DockerFailCall int64
+	// CorruptDownload flips the first byte of downloaded agent tarballs
+	CorruptDownload bool
+	// IMDSDelay delays every request to the EC2 Instance Metadata Service
+	IMDSDelay time.Duration
+}
+
+var (
+	configured     Faults
+	configuredOnce sync.Once
+	dockerCalls    int64
+)
+
+// Parse parses comma separated faults
+func Parse(value string) (Faults, error) {
+	var faults Faults
+	for _, fault := range strings.Split(value, ",") {
+		fault = strings.TrimSpace(fault)
+		if fault == "" {
+			continue
+		}
+		name, arg := fault, ""
+		if i := strings.Index(fault, "="); i >= 0 {
+			name, arg = fault[:i], fault[i+1:]
+		}
+		var err error
+		switch name {
+		case dockerFailCallFault:
+			faults.DockerFailCall, err = strconv.ParseInt(arg, 10, 64)
+			if err == nil && faults.DockerFailCall < 1 {
+				err = errors.New("expected a call number from 1")
+			}
+		case corruptDownloadFault:
+			faults.CorruptDownload = true
+		case imdsDelayFault:
+			faults.IMDSDelay, err = time.ParseDuration(arg)
+		default:
+			err = errors.New("unknown fault")
+		}
+		if err != nil {
+			return Faults{}, fmt.Errorf("invalid fault %q: %v", fault, err)
+		}
+	}
+	return faults, nil
+}
+
+// Configured returns the faults set in the environment, which are none
+// unless the binary was built with the faultinjection build tag
+func Configured() Faults {
+	configuredOnce.Do(func() {
+		value := config.Faults()
+		if !Enabled || value == "" {
+			return
+		}
+		faults, err := Parse(value)
+		if err != nil {
+			log.Errorf("Not injecting faults: %v", err)
+			return
+		}
+		log.Warnf("Injecting faults: %s", value)
+		configured = faults
+	})
+	return configured
+}
+
+// Docker is called before each call to Docker and returns the injected
+// error the call fails with, if any
+func Docker(call string) error {
+	return Configured().docker(atomic.AddInt64(&dockerCalls, 1), call)
+}
+
+func (f Faults) docker(n int64, call string) error {
+	if f.DockerFailCall == 0 || n != f.DockerFailCall {
+		return nil
+	}
+	log.Warnf("Injecting a failure of Docker call %d (%s)", n, call)
+	return fmt.Errorf("%w: Docker call %d (%s)", ErrInjected, n, call)
+}
+
+// DownloadTransport wraps the transport used to download the agent
+func DownloadTransport(transport http.RoundTripper) http.RoundTripper {
+	return Configured().downloadTransport(transport)
+}
+
+func (f Faults) downloadTransport(transport http.RoundTripper) http.RoundTripper {
+	if !f.CorruptDownload {
+		return transport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := transport.RoundTrip(req)
+		if err != nil || !strings.HasSuffix(req.URL.Path, corruptedSuffix) {
+			return resp, err
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			return resp, nil
+		}
+		log.Warnf("Injecting corrupted bytes into the download of %s", req.URL.Path)
+		resp.Body = corruptedBody(resp.Body)
+		return resp, nil
+	})
+}
+
+// IMDSTransport wraps the transport used to call the EC2 Instance Metadata
+// Service
+func IMDSTransport(transport http.RoundTripper) http.RoundTripper {
+	return Configured().imdsTransport(transport)
+}
+
+func (f Faults) imdsTransport(transport http.RoundTripper) http.RoundTripper {
+	if f.IMDSDelay == 0 {
+		return transport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		log.Warnf("Injecting a delay of %s into %s", f.IMDSDelay.String(), req.URL.Path)
+		select {
+		case <-time.After(f.IMDSDelay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		return transport.RoundTrip(req)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// corruptedBody returns body with its first byte flipped
+func corruptedBody(body io.ReadCloser) io.ReadCloser {
+	first := make([]byte, 1)
+	n, _ := io.ReadFull(body, first)
+	if n == 0 {
+		return body
+	}
+	first[0] ^= 0xff
+	return &readCloser{Reader: io.MultiReader(bytes.NewReader(first), body), closer: body}
+}
+
+type readCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r *readCloser) Close() error {
+	return r.closer.Close()
+}
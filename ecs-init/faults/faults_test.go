@@ -0,0 +1,92 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package faults
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	faults, err := Parse("docker-fail-call=3, corrupt-download,imds-delay=10s")
+	require.NoError(t, err)
+	assert.Equal(t, Faults{DockerFailCall: 3, CorruptDownload: true, IMDSDelay: 10 * time.Second}, faults)
+
+	faults, err = Parse("")
+	require.NoError(t, err)
+	assert.Equal(t, Faults{}, faults)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, value := range []string{"docker-fail-call=0", "docker-fail-call", "imds-delay=soon", "disk-full"} {
+		_, err := Parse(value)
+		assert.Error(t, err, "Expect %q to be invalid", value)
+	}
+}
+
+func TestConfiguredWithoutBuildTag(t *testing.T) {
+	if Enabled {
+		t.Skip("faults are injected by this build")
+	}
+	assert.Equal(t, Faults{}, Configured())
+	assert.NoError(t, Docker("Ping"))
+}
+
+func TestDockerFailsNthCall(t *testing.T) {
+	faults := Faults{DockerFailCall: 2}
+	assert.NoError(t, faults.docker(1, "Ping"))
+	err := faults.docker(2, "LoadImage")
+	assert.True(t, errors.Is(err, ErrInjected))
+	assert.NoError(t, faults.docker(3, "LoadImage"), "Expect the call to fail once")
+}
+
+func TestDownloadTransportCorruptsTarball(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("contents"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: Faults{CorruptDownload: true}.downloadTransport(http.DefaultTransport)}
+	get := func(path string) string {
+		resp, err := client.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	tarball := get("/ecs-agent-v1.37.0.tar")
+	assert.NotEqual(t, "contents", tarball)
+	assert.Equal(t, "ontents", tarball[1:], "Expect only the first byte to be corrupted")
+	assert.Equal(t, "contents", get("/ecs-agent-v1.37.0.tar.sha256"), "Expect the checksum to be intact")
+}
+
+func TestIMDSTransportDelaysRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: Faults{IMDSDelay: 100 * time.Millisecond}.imdsTransport(http.DefaultTransport),
+		Timeout:   50 * time.Millisecond,
+	}
+	_, err := client.Get(server.URL + "/latest/api/token")
+	assert.Error(t, err, "Expect the delayed request to time out")
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package filewatch reports changes to files using inotify. The directory of
+// a file is watched rather than the file itself, so that files replaced by
+// renaming a new file over them, as configuration management tools do, keep
+// being watched.
+package filewatch
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// watchMask selects the events of a file that are done changing it
+	watchMask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_DELETE
+	// eventBufferSize fits a batch of events with file names of up to
+	// NAME_MAX bytes
+	eventBufferSize = 64 * (unix.SizeofInotifyEvent + unix.NAME_MAX + 1)
+)
+
+// Watcher reports changes to a file
+type Watcher struct {
+	lock   sync.Mutex
+	file   *os.File
+	closed bool
+}
+
+// NewWatcher returns a Watcher that is not watching a file yet
+func NewWatcher() *Watcher {
+	return &Watcher{}
+}
+
+// Watch starts watching file. A value is sent on the returned channel after
+// the file was written, replaced or removed; changes made before the value
+// is received are coalesced into it. The channel is closed when the Watcher
+// is closed.
+func (w *Watcher) Watch(file string) (<-chan struct{}, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file != nil || w.closed {
+		return nil, errors.New("watcher is already in use")
+	}
+	// a non-blocking descriptor is read through the runtime poller, which
+	// lets Close interrupt a pending read
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize inotify")
+	}
+	_, err = unix.InotifyAddWatch(fd, filepath.Dir(file), watchMask)
+	if err != nil {
+		unix.Close(fd)
+		return nil, errors.Wrapf(err, "could not watch %s", filepath.Dir(file))
+	}
+	w.file = os.NewFile(uintptr(fd), "inotify")
+	changes := make(chan struct{}, 1)
+	go w.read(w.file, filepath.Base(file), changes)
+	return changes, nil
+}
+
+// Close stops watching the file
+func (w *Watcher) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
+
+func (w *Watcher) isClosed() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.closed
+}
+
+// read reads events until the inotify file is closed and reports the events
+// of the file named name
+func (w *Watcher) read(file *os.File, name string, changes chan<- struct{}) {
+	defer close(changes)
+	buf := make([]byte, eventBufferSize)
+	for {
+		n, err := file.Read(buf)
+		if err != nil {
+			if !w.isClosed() {
+				log.Warnf("Stopped watching %s: %v", name, err)
+			}
+			return
+		}
+		if changed(buf[:n], name) {
+			select {
+			case changes <- struct{}{}:
+			default:
+				// a change is already pending
+			}
+		}
+	}
+}
+
+// changed returns true if the events in buf include an event of the file
+// named name, or an overflow of the event queue that may have dropped one
+func changed(buf []byte, name string) bool {
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + unix.SizeofInotifyEvent
+		nameEnd := nameStart + int(event.Len)
+		if nameEnd > len(buf) {
+			return false
+		}
+		if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+			return true
+		}
+		if string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00")) == name {
+			return true
+		}
+		offset = nameEnd
+	}
+	return false
+}
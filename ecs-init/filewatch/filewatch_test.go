@@ -0,0 +1,98 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package filewatch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const changeTimeout = 5 * time.Second
+
+func expectChange(t *testing.T, changes <-chan struct{}) {
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok, "Expect change to be reported")
+	case <-time.After(changeTimeout):
+		t.Fatal("Expect change to be reported")
+	}
+}
+
+func expectNoChange(t *testing.T, changes <-chan struct{}) {
+	select {
+	case <-changes:
+		t.Fatal("Expect no change to be reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func newTestWatcher(t *testing.T) (*Watcher, <-chan struct{}, string) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "ecs.config")
+	require.NoError(t, ioutil.WriteFile(file, []byte("ECS_CLUSTER=default\n"), 0644))
+	watcher := NewWatcher()
+	changes, err := watcher.Watch(file)
+	require.NoError(t, err)
+	return watcher, changes, file
+}
+
+func TestWatchWrite(t *testing.T) {
+	watcher, changes, file := newTestWatcher(t)
+	defer watcher.Close()
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("ECS_CLUSTER=prod\n"), 0644))
+	expectChange(t, changes)
+}
+
+func TestWatchRename(t *testing.T) {
+	watcher, changes, file := newTestWatcher(t)
+	defer watcher.Close()
+
+	tempFile := file + ".tmp"
+	require.NoError(t, ioutil.WriteFile(tempFile, []byte("ECS_CLUSTER=prod\n"), 0644))
+	require.NoError(t, os.Rename(tempFile, file))
+	expectChange(t, changes)
+
+	// the replaced file keeps being watched
+	require.NoError(t, ioutil.WriteFile(file, []byte("ECS_CLUSTER=staging\n"), 0644))
+	expectChange(t, changes)
+}
+
+func TestWatchIgnoresOtherFiles(t *testing.T) {
+	watcher, changes, file := newTestWatcher(t)
+	defer watcher.Close()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(filepath.Dir(file), "ecs.config.bak"), nil, 0644))
+	expectNoChange(t, changes)
+}
+
+func TestWatchClose(t *testing.T) {
+	watcher, changes, file := newTestWatcher(t)
+
+	assert.NoError(t, watcher.Close())
+	select {
+	case _, ok := <-changes:
+		assert.False(t, ok, "Expect changes to be closed")
+	case <-time.After(changeTimeout):
+		t.Fatal("Expect changes to be closed")
+	}
+	_, err := watcher.Watch(file)
+	assert.Error(t, err, "Expect a closed watcher to not be reused")
+}
@@ -19,6 +19,8 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/aws/amazon-ecs-init/ecs-init/hostmanifest"
+
 	"github.com/NVIDIA/gpu-monitoring-tools/bindings/go/nvml"
 	"github.com/cihub/seelog"
 	"github.com/pkg/errors"
@@ -219,5 +221,10 @@ func WriteToFile(filename string, data []byte, perm os.FileMode) error {
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(filename, data, perm)
+	err = ioutil.WriteFile(filename, data, perm)
+	if err != nil {
+		return err
+	}
+	hostmanifest.RecordFile(filename, data)
+	return nil
 }
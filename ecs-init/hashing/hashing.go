@@ -0,0 +1,126 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package hashing selects the implementation of the SHA-256 digests that
+// verify downloads, and pipelines hashing with the writes feeding a digest so
+// that large artifacts are hashed while they are downloaded.
+package hashing
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io/ioutil"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Auto selects the fastest available backend
+	Auto = "auto"
+	// Go is the backend of the Go standard library, which uses the SHA
+	// extensions of x86 (SHA-NI) and the ARMv8 cryptography extensions when
+	// the CPU has them
+	Go = "go"
+)
+
+// cpuInfoPath is where the CPU flags are read from
+var cpuInfoPath = "/proc/cpuinfo"
+
+// Backend computes SHA-256 digests
+type Backend struct {
+	// Name is the name the backend is selected with
+	Name string
+	// New creates a digest
+	New func() hash.Hash
+	// Accelerated returns true when the backend uses hardware acceleration
+	// on this host
+	Accelerated func() bool
+}
+
+var (
+	backendsLock sync.RWMutex
+	backends     = map[string]Backend{
+		Go: {Name: Go, New: sha256.New, Accelerated: cpuHasSHAExtensions},
+	}
+)
+
+// RegisterSHA256 registers a SHA-256 backend, such as one offloading to a
+// crypto library, replacing the backend of the same name if any
+func RegisterSHA256(backend Backend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	backends[strings.ToLower(backend.Name)] = backend
+}
+
+// SHA256 returns the backend named name. The Auto backend, or an empty name,
+// is the first accelerated backend in name order, preferring registered
+// backends over the Go backend, and else the Go backend.
+func SHA256(name string) (Backend, error) {
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+	name = strings.ToLower(name)
+	if name != "" && name != Auto {
+		backend, ok := backends[name]
+		if !ok {
+			return backends[Go], errors.Errorf("unknown SHA-256 backend %q", name)
+		}
+		return backend, nil
+	}
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		if name != Go {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if backends[name].Accelerated() {
+			return backends[name], nil
+		}
+	}
+	return backends[Go], nil
+}
+
+// cpuHasSHAExtensions returns true when the CPU has the instructions the Go
+// backend accelerates SHA-256 with
+func cpuHasSHAExtensions() bool {
+	data, err := ioutil.ReadFile(cpuInfoPath)
+	if err != nil {
+		return false
+	}
+	flag := "sha_ni"
+	if runtime.GOARCH == "arm64" {
+		flag = "sha2"
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		// x86 lists the CPU flags as flags, arm64 as Features
+		key := strings.TrimSpace(fields[0])
+		if key != "flags" && key != "Features" {
+			continue
+		}
+		for _, field := range strings.Fields(fields[1]) {
+			if field == flag {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package hashing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"hash"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setCPUInfo points the CPU flags at a file holding contents
+func setCPUInfo(t *testing.T, contents string) {
+	path := filepath.Join(t.TempDir(), "cpuinfo")
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	previous := cpuInfoPath
+	cpuInfoPath = path
+	t.Cleanup(func() { cpuInfoPath = previous })
+}
+
+func TestCPUHasSHAExtensions(t *testing.T) {
+	flag := "sha_ni"
+	if runtime.GOARCH == "arm64" {
+		flag = "sha2"
+	}
+	setCPUInfo(t, "processor\t: 0\nflags\t\t: fpu sse2 avx2 "+flag+"\nFeatures\t: fp asimd "+flag+"\n\n")
+	assert.True(t, cpuHasSHAExtensions())
+
+	setCPUInfo(t, "processor\t: 0\nflags\t\t: fpu sse2 avx2\nFeatures\t: fp asimd\n")
+	assert.False(t, cpuHasSHAExtensions())
+}
+
+func TestSHA256Backend(t *testing.T) {
+	accelerated := true
+	RegisterSHA256(Backend{Name: "Offload", New: sha256.New, Accelerated: func() bool { return accelerated }})
+	defer func() {
+		backendsLock.Lock()
+		delete(backends, "offload")
+		backendsLock.Unlock()
+	}()
+
+	backend, err := SHA256(Auto)
+	require.NoError(t, err)
+	assert.Equal(t, "Offload", backend.Name, "Expect an accelerated registered backend to be preferred")
+
+	accelerated = false
+	backend, err = SHA256("")
+	require.NoError(t, err)
+	assert.Equal(t, Go, backend.Name)
+
+	backend, err = SHA256("offload")
+	require.NoError(t, err)
+	assert.Equal(t, "Offload", backend.Name)
+
+	backend, err = SHA256("missing")
+	assert.Error(t, err)
+	assert.Equal(t, Go, backend.Name)
+}
+
+func TestPipelined(t *testing.T) {
+	data := bytes.Repeat([]byte("tarball contents"), 100000)
+	expected := sha256.Sum256(data)
+
+	digest := NewPipelined(sha256.New())
+	for offset := 0; offset < len(data); offset += 4096 {
+		end := offset + 4096
+		if end > len(data) {
+			end = len(data)
+		}
+		digest.Write(data[offset:end])
+	}
+	assert.Equal(t, expected[:], digest.Sum(nil))
+	assert.Equal(t, sha256.Size, digest.Size())
+
+	digest.Reset()
+	digest.Write(data)
+	assert.Equal(t, expected[:], digest.Sum(nil), "Expect the digest to be reusable once reset")
+}
+
+func TestPipelinedMarshalsState(t *testing.T) {
+	digest := NewPipelined(sha256.New())
+	digest.Write([]byte("tarball "))
+	state, err := digest.(encoding.BinaryMarshaler).MarshalBinary()
+	require.NoError(t, err)
+
+	resumed := NewPipelined(sha256.New())
+	require.NoError(t, resumed.(encoding.BinaryUnmarshaler).UnmarshalBinary(state))
+	resumed.Write([]byte("contents"))
+	expected := sha256.Sum256([]byte("tarball contents"))
+	assert.Equal(t, expected[:], resumed.Sum(nil))
+
+	var plain hash.Hash = NewPipelined(struct{ hash.Hash }{sha256.New()})
+	_, err = plain.(encoding.BinaryMarshaler).MarshalBinary()
+	assert.Error(t, err)
+}
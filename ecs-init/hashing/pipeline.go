@@ -0,0 +1,133 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package hashing
+
+import (
+	"encoding"
+	"hash"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// pipelineDepth is how many writes can be queued for the worker before Write
+// blocks, bounding the memory held by a pipelined digest
+const pipelineDepth = 8
+
+// pipelined is a digest that hashes the bytes written to it on a worker, so
+// that the writer, e.g. a download, does not wait for the hashing. The worker
+// only runs while writes are queued.
+type pipelined struct {
+	hash   hash.Hash
+	blocks chan []byte
+	free   sync.Pool
+
+	lock    sync.Mutex
+	drained *sync.Cond
+	queued  int
+	running bool
+}
+
+// NewPipelined returns a digest hashing with h on a worker. Like any digest,
+// it must not be written to concurrently with Sum or Reset.
+func NewPipelined(h hash.Hash) hash.Hash {
+	p := &pipelined{
+		hash:   h,
+		blocks: make(chan []byte, pipelineDepth),
+	}
+	p.drained = sync.NewCond(&p.lock)
+	return p
+}
+
+func (p *pipelined) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	block, _ := p.free.Get().([]byte)
+	block = append(block[:0], b...)
+	p.lock.Lock()
+	p.queued++
+	if !p.running {
+		p.running = true
+		go p.work()
+	}
+	p.lock.Unlock()
+	p.blocks <- block
+	return len(b), nil
+}
+
+// work hashes the queued writes, stopping once the queue is empty
+func (p *pipelined) work() {
+	for block := range p.blocks {
+		p.hash.Write(block)
+		p.free.Put(block[:0])
+		p.lock.Lock()
+		p.queued--
+		if p.queued == 0 {
+			p.running = false
+			p.drained.Broadcast()
+			p.lock.Unlock()
+			return
+		}
+		p.lock.Unlock()
+	}
+}
+
+// wait waits for the queued writes to be hashed
+func (p *pipelined) wait() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for p.queued > 0 {
+		p.drained.Wait()
+	}
+}
+
+func (p *pipelined) Sum(b []byte) []byte {
+	p.wait()
+	return p.hash.Sum(b)
+}
+
+func (p *pipelined) Reset() {
+	p.wait()
+	p.hash.Reset()
+}
+
+func (p *pipelined) Size() int {
+	return p.hash.Size()
+}
+
+func (p *pipelined) BlockSize() int {
+	return p.hash.BlockSize()
+}
+
+// MarshalBinary marshals the state of the digest once the queued writes are
+// hashed, so that a pipelined digest can be checkpointed like the digest it
+// wraps
+func (p *pipelined) MarshalBinary() ([]byte, error) {
+	p.wait()
+	marshaler, ok := p.hash.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, errors.New("digest does not support marshaling its state")
+	}
+	return marshaler.MarshalBinary()
+}
+
+func (p *pipelined) UnmarshalBinary(state []byte) error {
+	p.wait()
+	unmarshaler, ok := p.hash.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return errors.New("digest does not support unmarshaling its state")
+	}
+	return unmarshaler.UnmarshalBinary(state)
+}
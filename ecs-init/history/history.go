@@ -0,0 +1,209 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package history keeps a rolling log of the lifecycle events of the Agent on
+// the host, such as its starts, stops, upgrades and the failures of ecs-init,
+// so that what happened on the host can be told without going through the
+// rotated logs. The events are appended to a file as lines of JSON, and the
+// oldest events are dropped once the file grows beyond MaxSize.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// KindPrestart is the kind of the events of the host prepared for the
+	// Agent
+	KindPrestart = "prestart"
+	// KindStart is the kind of the events of the Agent started
+	KindStart = "start"
+	// KindExit is the kind of the events of the Agent exited
+	KindExit = "exit"
+	// KindStop is the kind of the events of the Agent stopped
+	KindStop = "stop"
+	// KindUpgrade is the kind of the events of the Agent upgraded
+	KindUpgrade = "upgrade"
+	// KindFailure is the kind of the events of an action of ecs-init failed
+	KindFailure = "failure"
+
+	// MaxSize is the size the history file is trimmed below
+	MaxSize = 512 * 1024
+	// trimmedSize is the size of the history file once trimmed, so that it is
+	// not rewritten on every event
+	trimmedSize = MaxSize / 2
+
+	historyPerm    = 0644
+	historyDirPerm = 0755
+)
+
+// Event is a lifecycle event, encoded with short keys to keep the history
+// compact
+type Event struct {
+	Time time.Time `json:"t"`
+	Kind string    `json:"k"`
+	// Detail describes the event, e.g. the exit code of the Agent
+	Detail string `json:"d,omitempty"`
+}
+
+// Log appends events to a history file
+type Log struct {
+	file string
+	lock sync.Mutex
+}
+
+// NewLog creates a Log appending to file
+func NewLog(file string) *Log {
+	return &Log{file: file}
+}
+
+// Append appends event to the history, dropping the oldest events when the
+// history grows beyond MaxSize
+func (l *Log) Append(event Event) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	line, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "could not encode the event")
+	}
+	err = os.MkdirAll(filepath.Dir(l.file), historyDirPerm)
+	if err != nil {
+		return errors.Wrap(err, "could not create the directory of the history")
+	}
+	file, err := os.OpenFile(l.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, historyPerm)
+	if err != nil {
+		return errors.Wrap(err, "could not open the history")
+	}
+	_, err = file.Write(append(line, '\n'))
+	var size int64
+	if info, statErr := file.Stat(); statErr == nil {
+		size = info.Size()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not append to the history")
+	}
+	if size <= MaxSize {
+		return nil
+	}
+	return l.trim()
+}
+
+// trim rewrites the history with its newest lines that fit in trimmedSize,
+// replacing it at once so that readers never see a partial history
+func (l *Log) trim() error {
+	data, err := ioutil.ReadFile(l.file)
+	if err != nil {
+		return errors.Wrap(err, "could not read the history")
+	}
+	if len(data) > trimmedSize {
+		data = data[len(data)-trimmedSize:]
+		// drop the line cut in the middle
+		if newline := bytes.IndexByte(data, '\n'); newline != -1 {
+			data = data[newline+1:]
+		}
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(l.file), filepath.Base(l.file))
+	if err != nil {
+		return errors.Wrap(err, "could not trim the history")
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), historyPerm)
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not trim the history")
+	}
+	return os.Rename(temp.Name(), l.file)
+}
+
+// Read returns the events in the history file, oldest first. Lines that
+// cannot be decoded, such as a line cut short by a crash, are skipped.
+func Read(file string) ([]Event, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read the history")
+	}
+	defer f.Close()
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		if json.Unmarshal(scanner.Bytes(), &event) == nil && event.Kind != "" {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not read the history")
+	}
+	return events, nil
+}
+
+// Filter returns the events at or after since, of the given kinds, or of all
+// kinds if none are given
+func Filter(events []Event, since time.Time, kinds ...string) []Event {
+	wanted := make(map[string]bool)
+	for _, kind := range kinds {
+		wanted[kind] = true
+	}
+	var filtered []Event
+	for _, event := range events {
+		if event.Time.Before(since) {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[event.Kind] {
+			continue
+		}
+		filtered = append(filtered, event)
+	}
+	return filtered
+}
+
+// Write writes events as a table, or as a JSON array if asJSON is set
+func Write(w io.Writer, events []Event, asJSON bool) error {
+	if asJSON {
+		if events == nil {
+			events = []Event{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(events)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tEVENT\tDETAIL")
+	for _, event := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", event.Time.Local().Format(time.RFC3339), event.Kind, event.Detail)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package history
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLog(t *testing.T) *Log {
+	return NewLog(filepath.Join(t.TempDir(), "ecs", "history"))
+}
+
+func TestAppendRead(t *testing.T) {
+	log := newTestLog(t)
+
+	events := []Event{
+		{Time: time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC), Kind: KindStart, Detail: "Agent 1.42.0"},
+		{Time: time.Date(2020, 6, 1, 13, 0, 0, 0, time.UTC), Kind: KindExit, Detail: "exit code 5"},
+	}
+	for _, event := range events {
+		require.NoError(t, log.Append(event))
+	}
+	read, err := Read(log.file)
+	require.NoError(t, err)
+	assert.Equal(t, events, read)
+}
+
+func TestReadMissing(t *testing.T) {
+	events, err := Read(filepath.Join(os.TempDir(), "missing-history"))
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestReadSkipsTruncatedLine(t *testing.T) {
+	log := newTestLog(t)
+
+	require.NoError(t, log.Append(Event{Time: time.Now().UTC(), Kind: KindStop}))
+	file, err := os.OpenFile(log.file, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	file.WriteString(`{"t":"2020-06-01T12:00:00Z","k":"sta`)
+	file.Close()
+
+	events, err := Read(log.file)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestAppendTrimsOldestEvents(t *testing.T) {
+	log := newTestLog(t)
+
+	detail := strings.Repeat("x", 1000)
+	start := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	count := MaxSize/1000 + 10
+	for i := 0; i < count; i++ {
+		require.NoError(t, log.Append(Event{Time: start.Add(time.Duration(i) * time.Minute), Kind: KindExit, Detail: detail}))
+	}
+	info, err := os.Stat(log.file)
+	require.NoError(t, err)
+	assert.True(t, info.Size() <= MaxSize)
+
+	events, err := Read(log.file)
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	assert.True(t, len(events) < count)
+	assert.Equal(t, start.Add(time.Duration(count-1)*time.Minute), events[len(events)-1].Time)
+}
+
+func TestFilter(t *testing.T) {
+	start := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Time: start, Kind: KindStart},
+		{Time: start.Add(time.Hour), Kind: KindFailure},
+		{Time: start.Add(2 * time.Hour), Kind: KindStart},
+	}
+	assert.Equal(t, events[1:], Filter(events, start.Add(time.Hour)))
+	assert.Equal(t, []Event{events[0], events[2]}, Filter(events, time.Time{}, KindStart))
+	assert.Empty(t, Filter(events, start.Add(3*time.Hour)))
+}
+
+func TestWrite(t *testing.T) {
+	events := []Event{{Time: time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC), Kind: KindUpgrade, Detail: "Agent 1.43.0"}}
+
+	var table bytes.Buffer
+	require.NoError(t, Write(&table, events, false))
+	assert.Contains(t, table.String(), "EVENT")
+	assert.Contains(t, table.String(), "Agent 1.43.0")
+
+	var js bytes.Buffer
+	require.NoError(t, Write(&js, nil, true))
+	assert.Equal(t, "[]\n", js.String())
+}
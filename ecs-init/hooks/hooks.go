@@ -0,0 +1,227 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package hooks runs the scripts operators drop in the directory of a stage of
+// the Agent, such as pre-start.d, so that hosts can be customized without
+// changing ecs-init. The executable files of the directory are run in the
+// lexical order of their names, each within a timeout, and their output is
+// logged line by line.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PreStart is the stage of the hooks run once the host is prepared for
+	// the Agent, before its container is started
+	PreStart = "pre-start"
+	// PostStart is the stage of the hooks run once the started Agent is
+	// healthy
+	PostStart = "post-start"
+
+	// StageEnvVar is the environment variable naming the stage of the hook
+	StageEnvVar = "ECS_INIT_HOOK_STAGE"
+
+	// stageDirectorySuffix is the suffix of the directory of the hooks of
+	// a stage
+	stageDirectorySuffix = ".d"
+	// waitDelay bounds how long the output of a killed hook is waited for,
+	// in case it left processes behind holding it open
+	waitDelay = 5 * time.Second
+	// rootUID is the owner hooks and their directories need, as hooks run as
+	// root
+	rootUID = 0
+	// othersWritable are the permissions letting users other than the owner
+	// replace a hook
+	othersWritable = 0022
+)
+
+// Runner runs the hooks of the stages of the Agent
+type Runner struct {
+	dir     string
+	timeout time.Duration
+	owner   uint32
+}
+
+// NewRunner creates a Runner of the hooks in the stage directories of dir,
+// killing each hook that runs longer than timeout
+func NewRunner(dir string, timeout time.Duration) *Runner {
+	return &Runner{dir: dir, timeout: timeout, owner: rootUID}
+}
+
+// StageDirectory returns the directory of the hooks of stage in dir
+func StageDirectory(dir, stage string) string {
+	return filepath.Join(dir, stage+stageDirectorySuffix)
+}
+
+// Run runs the hooks of stage in order, and stops at the first hook that
+// fails. There are no hooks to run when the directory of the stage is
+// missing.
+func (r *Runner) Run(ctx context.Context, stage string) error {
+	hooks, err := r.hooks(stage)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		err := r.run(ctx, stage, hook)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hooks returns the executable files of the directory of stage, sorted by
+// name. Hidden files, directories and files that are not executable are
+// skipped, as are the hooks that users other than root could have changed:
+// all of them when the hooks directory or the directory of stage is not
+// owned by root or is writable by others, or a hook that is.
+func (r *Runner) hooks(stage string) ([]string, error) {
+	dir := StageDirectory(r.dir, stage)
+	for _, path := range []string{r.dir, dir} {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list the %s hooks", stage)
+		}
+		if reason := r.untrusted(info); reason != "" {
+			log.Warnf("Skipping the %s hooks: %s %s", stage, path, reason)
+			return nil, nil
+		}
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list the %s hooks", stage)
+	}
+	var hooks []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		// the hook a link points at is run
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Warnf("Skipping %s hook %s: %v", stage, name, err)
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+		if info.Mode()&0111 == 0 {
+			log.Warnf("Skipping %s hook %s: it is not executable", stage, name)
+			continue
+		}
+		if reason := r.untrusted(info); reason != "" {
+			log.Warnf("Skipping %s hook %s: it %s", stage, name, reason)
+			continue
+		}
+		hooks = append(hooks, path)
+	}
+	return hooks, nil
+}
+
+// untrusted returns why a hook or hook directory could have been changed by
+// users other than root, such as 'is not owned by root', or an empty string
+// when it could not
+func (r *Runner) untrusted(info os.FileInfo) string {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Uid != r.owner {
+		return "is not owned by root"
+	}
+	if info.Mode().Perm()&othersWritable != 0 {
+		return "can be written by group or other users"
+	}
+	return ""
+}
+
+// run runs hook, killing it along with the processes it started when it runs
+// longer than the timeout
+func (r *Runner) run(ctx context.Context, stage, hook string) error {
+	name := filepath.Base(hook)
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	output := &lineLogger{stage: stage, hook: name}
+	cmd := osexec.CommandContext(ctx, hook)
+	cmd.Env = append(os.Environ(), StageEnvVar+"="+stage)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = waitDelay
+
+	log.Infof("Running %s hook %s", stage, name)
+	start := time.Now()
+	err := cmd.Run()
+	output.flush()
+	duration := time.Since(start).Round(time.Millisecond)
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Errorf("The %s hook %s did not finish within %s", stage, name, r.timeout)
+		return errors.Errorf("%s hook %s did not finish within %s", stage, name, r.timeout)
+	}
+	if err != nil {
+		log.Errorf("The %s hook %s failed after %s: %v", stage, name, duration, err)
+		return errors.Wrapf(err, "%s hook %s failed", stage, name)
+	}
+	log.Infof("The %s hook %s succeeded after %s", stage, name, duration)
+	return nil
+}
+
+// lineLogger logs the output of a hook line by line
+type lineLogger struct {
+	stage   string
+	hook    string
+	partial bytes.Buffer
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.partial.Write(p)
+	for {
+		line, err := l.partial.ReadString('\n')
+		if err != nil {
+			// the line is logged once it is complete
+			l.partial.WriteString(line)
+			return len(p), nil
+		}
+		l.log(strings.TrimSuffix(line, "\n"))
+	}
+}
+
+// flush logs the last line of the output when it did not end with a newline
+func (l *lineLogger) flush() {
+	if l.partial.Len() > 0 {
+		l.log(l.partial.String())
+		l.partial.Reset()
+	}
+}
+
+func (l *lineLogger) log(line string) {
+	log.Infof("Output of %s hook %s: %s", l.stage, l.hook, line)
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package hooks
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRunner creates a Runner trusting the hooks of the user running the
+// tests
+func newTestRunner(dir string, timeout time.Duration) *Runner {
+	runner := NewRunner(dir, timeout)
+	runner.owner = uint32(os.Getuid())
+	return runner
+}
+
+// writeHook writes a shell script hook named name for stage
+func writeHook(t *testing.T, dir, stage, name, script string, mode os.FileMode) {
+	stageDir := filepath.Join(dir, stage+stageDirectorySuffix)
+	require.NoError(t, os.MkdirAll(stageDir, 0755))
+	path := filepath.Join(stageDir, name)
+	err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), mode)
+	require.NoError(t, err)
+	// the permissions of the hooks are not left to the umask
+	require.NoError(t, os.Chmod(stageDir, 0755))
+	require.NoError(t, os.Chmod(path, mode))
+}
+
+func readLines(t *testing.T, path string) []string {
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Fields(string(data))
+}
+
+func TestRunMissingDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	runner := NewRunner(filepath.Join(dir, "missing"), time.Second)
+	assert.NoError(t, runner.Run(context.Background(), PreStart))
+}
+
+func TestRunInOrder(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+
+	writeHook(t, dir, PreStart, "20-second", "echo second-$"+StageEnvVar+" >> "+out, 0755)
+	writeHook(t, dir, PreStart, "10-first", "echo first-$"+StageEnvVar+" >> "+out, 0755)
+	writeHook(t, dir, PreStart, "15-disabled", "echo disabled >> "+out, 0644)
+	writeHook(t, dir, PreStart, ".hidden", "echo hidden >> "+out, 0755)
+	writeHook(t, dir, PostStart, "10-post", "echo post >> "+out, 0755)
+
+	runner := newTestRunner(dir, time.Second)
+	assert.NoError(t, runner.Run(context.Background(), PreStart))
+	assert.Equal(t, []string{"first-pre-start", "second-pre-start"}, readLines(t, out))
+}
+
+func TestRunSkipsUntrusted(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+
+	writeHook(t, dir, PreStart, "10-trusted", "echo trusted >> "+out, 0755)
+	writeHook(t, dir, PreStart, "20-writable", "echo writable >> "+out, 0757)
+
+	runner := newTestRunner(dir, time.Second)
+	assert.NoError(t, runner.Run(context.Background(), PreStart))
+	assert.Equal(t, []string{"trusted"}, readLines(t, out))
+
+	// hooks owned by another user are not run
+	runner.owner++
+	assert.NoError(t, runner.Run(context.Background(), PreStart))
+	assert.Equal(t, []string{"trusted"}, readLines(t, out))
+
+	// nor are the hooks of a directory others can write to
+	runner.owner--
+	require.NoError(t, os.Chmod(filepath.Join(dir, PreStart+stageDirectorySuffix), 0775))
+	assert.NoError(t, runner.Run(context.Background(), PreStart))
+	assert.Equal(t, []string{"trusted"}, readLines(t, out))
+}
+
+func TestRunStopsAtFailure(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+
+	writeHook(t, dir, PostStart, "10-fail", "echo failing\nexit 3", 0755)
+	writeHook(t, dir, PostStart, "20-skipped", "echo skipped >> "+out, 0755)
+
+	runner := newTestRunner(dir, time.Second)
+	err := runner.Run(context.Background(), PostStart)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "10-fail")
+	_, err = os.Stat(out)
+	assert.True(t, os.IsNotExist(err), "hooks after the failed hook should not run")
+}
+
+func TestRunTimeout(t *testing.T) {
+	dir := t.TempDir()
+
+	// the sleep runs in a child process of the hook, which is killed along
+	// with it
+	writeHook(t, dir, PreStart, "10-slow", "sleep 30 &\nwait", 0755)
+
+	runner := newTestRunner(dir, 100*time.Millisecond)
+	start := time.Now()
+	err := runner.Run(context.Background(), PreStart)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "did not finish within 100ms")
+	assert.True(t, time.Since(start) < waitDelay, "the hook should be killed at its timeout")
+}
+
+func TestLineLogger(t *testing.T) {
+	logger := &lineLogger{stage: PreStart, hook: "10-hook"}
+	n, err := logger.Write([]byte("first\nsec"))
+	assert.NoError(t, err)
+	assert.Equal(t, 9, n)
+	assert.Equal(t, "sec", logger.partial.String())
+
+	logger.Write([]byte("ond\n"))
+	assert.Equal(t, 0, logger.partial.Len())
+
+	logger.Write([]byte("last"))
+	logger.flush()
+	assert.Equal(t, 0, logger.partial.Len())
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package hostmanifest records the mutations ecs-init makes to the host, such
+// as the files it writes, the netfilter rules it adds, the kernel parameters
+// it sets and the systemd units it enables. The mutations of a boot are kept
+// in a manifest, so that the host a boot left behind can be compared with the
+// previous boot when behavior regressed after an update.
+package hostmanifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// KindFile is the kind of the files and directories written
+	KindFile = "file"
+	// KindRule is the kind of the netfilter rules added and removed
+	KindRule = "rule"
+	// KindSysctl is the kind of the kernel parameters set
+	KindSysctl = "sysctl"
+	// KindUnit is the kind of the systemd units enabled
+	KindUnit = "unit"
+
+	// Added is the value of a rule that was added
+	Added = "added"
+	// Removed is the value of a file or rule that was removed
+	Removed = "removed"
+	// Directory is the value of a directory that was created
+	Directory = "directory"
+	// Enabled is the value of a unit that was enabled
+	Enabled = "enabled"
+)
+
+// Mutation is a change made to the host
+type Mutation struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	// Value is what the target was changed to, such as the value of a
+	// kernel parameter or the digest of the content of a file
+	Value string    `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+var (
+	lock     sync.Mutex
+	recorded []Mutation
+)
+
+// Record records that target of kind was changed to value
+func Record(kind, target, value string) {
+	lock.Lock()
+	defer lock.Unlock()
+	recorded = append(recorded, Mutation{
+		Kind:   kind,
+		Target: target,
+		Value:  value,
+		Time:   time.Now(),
+	})
+}
+
+// RecordFile records that file was written with data
+func RecordFile(file string, data []byte) {
+	digest := sha256.Sum256(data)
+	Record(KindFile, file, "sha256:"+hex.EncodeToString(digest[:]))
+}
+
+// Take returns the mutations recorded since it was last called
+func Take() []Mutation {
+	lock.Lock()
+	defer lock.Unlock()
+	mutations := recorded
+	recorded = nil
+	return mutations
+}
+
+// Manifest is the last mutation of each target changed in a boot
+type Manifest struct {
+	BootID    string     `json:"bootId"`
+	Mutations []Mutation `json:"mutations"`
+}
+
+// Add adds mutations to the manifest, replacing the earlier mutations of
+// their targets
+func (m *Manifest) Add(mutations []Mutation) {
+	for _, mutation := range mutations {
+		replaced := false
+		for i, existing := range m.Mutations {
+			if existing.Kind == mutation.Kind && existing.Target == mutation.Target {
+				m.Mutations[i] = mutation
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			m.Mutations = append(m.Mutations, mutation)
+		}
+	}
+}
+
+// Change is a target whose last mutation differs between two boots.
+// Previous or Current is empty when the target was not changed in that boot.
+type Change struct {
+	Kind     string `json:"kind"`
+	Target   string `json:"target"`
+	Previous string `json:"previous,omitempty"`
+	Current  string `json:"current,omitempty"`
+}
+
+// Diff returns the targets whose last mutation differs from the previous
+// manifest to the current one, sorted by kind and target
+func Diff(previous, current *Manifest) []Change {
+	type key struct{ kind, target string }
+	changes := make(map[key]*Change)
+	for _, mutation := range previous.Mutations {
+		changes[key{mutation.Kind, mutation.Target}] = &Change{
+			Kind:     mutation.Kind,
+			Target:   mutation.Target,
+			Previous: mutation.Value,
+		}
+	}
+	for _, mutation := range current.Mutations {
+		k := key{mutation.Kind, mutation.Target}
+		change, ok := changes[k]
+		if !ok {
+			change = &Change{Kind: mutation.Kind, Target: mutation.Target}
+			changes[k] = change
+		}
+		change.Current = mutation.Value
+	}
+	var diff []Change
+	for _, change := range changes {
+		if change.Previous != change.Current {
+			diff = append(diff, *change)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		if diff[i].Kind != diff[j].Kind {
+			return diff[i].Kind < diff[j].Kind
+		}
+		return diff[i].Target < diff[j].Target
+	})
+	return diff
+}
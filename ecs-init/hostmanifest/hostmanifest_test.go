@@ -0,0 +1,69 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package hostmanifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndTake(t *testing.T) {
+	Take()
+	Record(KindSysctl, "net.core.somaxconn", "4096")
+	RecordFile("/etc/ecs/ecs.config", []byte("ECS_CLUSTER=test\n"))
+
+	mutations := Take()
+	if assert.Len(t, mutations, 2) {
+		assert.Equal(t, KindSysctl, mutations[0].Kind)
+		assert.Equal(t, "4096", mutations[0].Value)
+		assert.Equal(t, "/etc/ecs/ecs.config", mutations[1].Target)
+		assert.Regexp(t, "^sha256:[0-9a-f]{64}$", mutations[1].Value)
+	}
+	assert.Empty(t, Take())
+}
+
+func TestManifestAdd(t *testing.T) {
+	manifest := &Manifest{BootID: "b"}
+	manifest.Add([]Mutation{
+		{Kind: KindRule, Target: "-t nat PREROUTING", Value: Added},
+		{Kind: KindSysctl, Target: "net.ipv4.conf.all.route_localnet", Value: "1"},
+	})
+	manifest.Add([]Mutation{{Kind: KindRule, Target: "-t nat PREROUTING", Value: Removed}})
+
+	assert.Equal(t, []Mutation{
+		{Kind: KindRule, Target: "-t nat PREROUTING", Value: Removed},
+		{Kind: KindSysctl, Target: "net.ipv4.conf.all.route_localnet", Value: "1"},
+	}, manifest.Mutations)
+}
+
+func TestDiff(t *testing.T) {
+	previous := &Manifest{BootID: "a", Mutations: []Mutation{
+		{Kind: KindSysctl, Target: "net.core.somaxconn", Value: "4096"},
+		{Kind: KindSysctl, Target: "net.ipv4.ip_forward", Value: "1"},
+		{Kind: KindFile, Target: "/etc/ecs/ecs.config", Value: "sha256:aa"},
+	}}
+	current := &Manifest{BootID: "b", Mutations: []Mutation{
+		{Kind: KindSysctl, Target: "net.ipv4.ip_forward", Value: "1"},
+		{Kind: KindSysctl, Target: "net.core.somaxconn", Value: "8192"},
+		{Kind: KindRule, Target: "-t nat OUTPUT", Value: Added},
+	}}
+
+	assert.Equal(t, []Change{
+		{Kind: KindFile, Target: "/etc/ecs/ecs.config", Previous: "sha256:aa"},
+		{Kind: KindRule, Target: "-t nat OUTPUT", Current: Added},
+		{Kind: KindSysctl, Target: "net.core.somaxconn", Previous: "4096", Current: "8192"},
+	}, Diff(previous, current))
+	assert.Empty(t, Diff(current, current))
+}
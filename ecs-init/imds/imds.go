@@ -0,0 +1,316 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package imds provides the client of the EC2 Instance Metadata Service that
+// is shared by the modules of ecs-init
+package imds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/faults"
+
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	tokenPath            = "/latest/api/token"
+	identityDocumentPath = "/latest/dynamic/instance-identity/document"
+	tokenHeader          = "X-aws-ec2-metadata-token"
+	tokenTTLHeader       = "X-aws-ec2-metadata-token-ttl-seconds"
+	// tokenTTL is how long a session token is requested for
+	tokenTTL = 6 * time.Hour
+	// tokenRenewBefore renews a session token ahead of its expiry so that it
+	// does not expire while a request is in flight
+	tokenRenewBefore = time.Minute
+	// requestTimeout is short because the metadata service is local, so that
+	// region discovery fails fast off EC2
+	requestTimeout = 5 * time.Second
+	// requestInterval spaces the requests sent to the metadata service,
+	// which throttles the requests of the instance by dropping them, so that
+	// ecs-init leaves room for the requests of tasks on busy hosts
+	requestInterval = 50 * time.Millisecond
+	// requestBurst is how many requests are sent without spacing them after
+	// the client was idle
+	requestBurst = 5
+
+	retryMinBackoff = 200 * time.Millisecond
+	retryMaxBackoff = 2 * time.Second
+	retryJitter     = 0.2
+	retryMultiplier = 2
+)
+
+// Error is returned when the metadata service responds with an error
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status %d", e.Method, e.Path, e.StatusCode)
+}
+
+// Client reads instance metadata with explicit IMDSv2 session token
+// handling. The token is requested with a PUT, which is not answered when
+// the response would exceed the hop limit of the instance, so the SDK client
+// would silently fall back to IMDSv1 and fail on instances that enforce
+// IMDSv2. The token is reused by all the modules sharing the client, and
+// requests are spaced by a rate limiter. Responses that do not change while
+// the instance runs, like the identity document, are cached.
+type Client struct {
+	endpoint string
+	client   *http.Client
+	v2Only   bool
+	retries  int
+	clk      clock.Clock
+	limiter  *limiter
+
+	// tokenLock is held while a token is requested, so that concurrent
+	// requests wait for one token instead of requesting one each
+	tokenLock   sync.Mutex
+	token       string
+	tokenExpiry time.Time
+
+	cacheLock sync.Mutex
+	cache     map[string]cachedResponse
+}
+
+// cachedResponse is the body of a response kept until it expires
+type cachedResponse struct {
+	body   []byte
+	expiry time.Time
+}
+
+var (
+	shared     *Client
+	sharedOnce sync.Once
+)
+
+// Shared returns the client configured from the environment that is shared
+// by the modules of ecs-init
+func Shared() *Client {
+	sharedOnce.Do(func() {
+		retries, err := config.IMDSRetries()
+		if err != nil {
+			log.Warnf("Using %d instance metadata retries: %v", retries, err)
+		}
+		shared = New(config.IMDSv2Only(), retries)
+	})
+	return shared
+}
+
+// New returns a client of the metadata service at the configured endpoint
+// that retries network and server errors up to retries times, and does not
+// fall back to IMDSv1 when v2Only is set
+func New(v2Only bool, retries int) *Client {
+	return &Client{
+		endpoint: config.IMDSEndpoint(),
+		client:   &http.Client{Timeout: requestTimeout, Transport: faults.IMDSTransport(http.DefaultTransport)},
+		v2Only:   v2Only,
+		retries:  retries,
+		clk:      clock.OrReal(nil),
+		limiter:  &limiter{interval: requestInterval, burst: requestBurst},
+		cache:    make(map[string]cachedResponse),
+	}
+}
+
+// GetInstanceIdentityDocument retrieves the identity document of the
+// instance, which is requested once
+func (c *Client) GetInstanceIdentityDocument() (ec2metadata.EC2InstanceIdentityDocument, error) {
+	var document ec2metadata.EC2InstanceIdentityDocument
+	body, err := c.GetCached(identityDocumentPath, 0)
+	if err != nil {
+		return document, err
+	}
+	err = json.Unmarshal(body, &document)
+	if err != nil {
+		return document, errors.Wrap(err, "could not decode instance identity document")
+	}
+	return document, nil
+}
+
+// GetCached reads path like Get, reusing a response read less than maxAge
+// ago. A response is reused for as long as the client is used when maxAge is
+// zero. Failed requests are not cached.
+func (c *Client) GetCached(path string, maxAge time.Duration) ([]byte, error) {
+	c.cacheLock.Lock()
+	cached, ok := c.cache[path]
+	c.cacheLock.Unlock()
+	if ok && (cached.expiry.IsZero() || c.clk.Now().Before(cached.expiry)) {
+		return cached.body, nil
+	}
+	body, err := c.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	cached = cachedResponse{body: body}
+	if maxAge > 0 {
+		cached.expiry = c.clk.Now().Add(maxAge)
+	}
+	c.cacheLock.Lock()
+	c.cache[path] = cached
+	c.cacheLock.Unlock()
+	return body, nil
+}
+
+// Get reads path with a session token. Without a token it falls back to
+// IMDSv1 unless IMDSv2 is required.
+func (c *Client) Get(path string) ([]byte, error) {
+	token, err := c.sessionToken()
+	if err != nil {
+		if c.v2Only {
+			return nil, errors.Wrap(err, "could not get IMDSv2 session token")
+		}
+		log.Warnf("Could not get IMDSv2 session token, falling back to IMDSv1: %v", err)
+	}
+	body, err := c.request(http.MethodGet, path, token)
+	if IsStatus(err, http.StatusUnauthorized) && token != "" {
+		// the token was rejected before its expiry, get a new one unless
+		// another request already did
+		log.Debugf("IMDSv2 session token was rejected, renewing it")
+		c.revokeToken(token)
+		token, err = c.sessionToken()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not renew IMDSv2 session token")
+		}
+		body, err = c.request(http.MethodGet, path, token)
+	}
+	return body, err
+}
+
+// sessionToken returns the current session token, requesting a new one when
+// it is about to expire
+func (c *Client) sessionToken() (string, error) {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+	if c.token != "" && c.clk.Now().Before(c.tokenExpiry.Add(-tokenRenewBefore)) {
+		return c.token, nil
+	}
+	requested := c.clk.Now()
+	body, err := c.request(http.MethodPut, tokenPath, "")
+	if err != nil {
+		return "", err
+	}
+	c.token = string(body)
+	c.tokenExpiry = requested.Add(tokenTTL)
+	return c.token, nil
+}
+
+// revokeToken forgets token if it is still the current session token
+func (c *Client) revokeToken(token string) {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+// request sends a request to the metadata service, retrying network errors
+// and server errors up to the configured number of retries
+func (c *Client) request(method, path, token string) ([]byte, error) {
+	retryBackoff := backoff.NewBackoff(retryMinBackoff, retryMaxBackoff,
+		retryJitter, retryMultiplier, c.retries)
+	for {
+		body, err := c.send(method, path, token)
+		if err == nil || !isRetryable(err) {
+			return body, err
+		}
+		if !retryBackoff.ShouldRetry() {
+			return nil, errors.Wrapf(err, "instance metadata unavailable after %d retries", c.retries)
+		}
+		d := retryBackoff.Duration()
+		log.Debugf("Request to instance metadata failed, retrying in %s: %v", d, err)
+		c.clk.Sleep(d)
+	}
+}
+
+func (c *Client) send(method, path, token string) ([]byte, error) {
+	req, err := http.NewRequest(method, c.endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPut {
+		req.Header.Set(tokenTTLHeader, strconv.Itoa(int(tokenTTL.Seconds())))
+	}
+	if token != "" {
+		req.Header.Set(tokenHeader, token)
+	}
+	if delay := c.limiter.reserve(c.clk.Now()); delay > 0 {
+		c.clk.Sleep(delay)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &Error{Method: method, Path: path, StatusCode: resp.StatusCode}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// isRetryable returns true for network errors, throttling and server errors
+func isRetryable(err error) bool {
+	imdsErr, ok := err.(*Error)
+	if !ok {
+		return true
+	}
+	return imdsErr.StatusCode == http.StatusTooManyRequests || imdsErr.StatusCode >= http.StatusInternalServerError
+}
+
+// IsStatus returns true if err is the metadata service responding with
+// statusCode
+func IsStatus(err error, statusCode int) bool {
+	imdsErr, ok := errors.Cause(err).(*Error)
+	return ok && imdsErr.StatusCode == statusCode
+}
+
+// limiter spaces requests by interval, letting burst requests through
+// without delay after it was idle
+type limiter struct {
+	lock     sync.Mutex
+	interval time.Duration
+	burst    int
+	// next is when the next request may be sent once the burst is used up
+	next time.Time
+}
+
+// reserve reserves the next slot for a request at now, and returns how long
+// to wait for it
+func (l *limiter) reserve(now time.Time) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	// an idle limiter accumulates up to burst slots
+	earliest := now.Add(-time.Duration(l.burst-1) * l.interval)
+	if l.next.Before(earliest) {
+		l.next = earliest
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
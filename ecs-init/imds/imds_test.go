@@ -0,0 +1,224 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package imds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIdentityDocument = `{"region":"eu-west-1","instanceId":"i-1234"}`
+
+// testIMDS serves an identity document that requires a session token when
+// v2Only is set, and counts the requests it receives
+type testIMDS struct {
+	v2Only        bool
+	tokenStatus   int
+	tokens        int
+	documents     int
+	validToken    string
+	documentFails int
+}
+
+func (s *testIMDS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPut && r.URL.Path == tokenPath:
+		s.tokens++
+		if r.Header.Get(tokenTTLHeader) != "21600" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if s.tokenStatus != 0 {
+			w.WriteHeader(s.tokenStatus)
+			return
+		}
+		w.Write([]byte(s.validToken))
+	case r.Method == http.MethodGet && r.URL.Path == identityDocumentPath:
+		s.documents++
+		if s.documentFails > 0 {
+			s.documentFails--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		token := r.Header.Get(tokenHeader)
+		if (token == "" && s.v2Only) || (token != "" && token != s.validToken) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(testIdentityDocument))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestIMDSClient(server *httptest.Server, v2Only bool, retries int) *Client {
+	client := New(v2Only, retries)
+	client.endpoint = server.URL
+	return client
+}
+
+func TestIdentityDocumentWithToken(t *testing.T) {
+	metadata := &testIMDS{v2Only: true, validToken: "token"}
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	client := newTestIMDSClient(server, true, 0)
+	for i := 0; i < 2; i++ {
+		document, err := client.GetInstanceIdentityDocument()
+		require.NoError(t, err)
+		assert.Equal(t, "eu-west-1", document.Region)
+		assert.Equal(t, "i-1234", document.InstanceID)
+	}
+	assert.Equal(t, 1, metadata.tokens, "Expect the session token to be reused")
+}
+
+func TestIdentityDocumentRenewsRejectedToken(t *testing.T) {
+	metadata := &testIMDS{v2Only: true, validToken: "token"}
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	client := newTestIMDSClient(server, true, 0)
+	client.token = "revoked"
+	client.tokenExpiry = time.Now().Add(time.Hour)
+
+	document, err := client.GetInstanceIdentityDocument()
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", document.Region)
+	assert.Equal(t, 1, metadata.tokens)
+	assert.Equal(t, 2, metadata.documents)
+}
+
+func TestIdentityDocumentRenewsExpiringToken(t *testing.T) {
+	metadata := &testIMDS{validToken: "token"}
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	client := newTestIMDSClient(server, false, 0)
+	client.token = "expiring"
+	client.tokenExpiry = time.Now().Add(tokenRenewBefore / 2)
+
+	_, err := client.GetInstanceIdentityDocument()
+	require.NoError(t, err)
+	assert.Equal(t, "token", client.token)
+}
+
+func TestIdentityDocumentFallsBackToV1(t *testing.T) {
+	metadata := &testIMDS{tokenStatus: http.StatusForbidden}
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	document, err := newTestIMDSClient(server, false, 0).GetInstanceIdentityDocument()
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", document.Region)
+}
+
+func TestIdentityDocumentV2Only(t *testing.T) {
+	metadata := &testIMDS{v2Only: true, tokenStatus: http.StatusForbidden}
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	_, err := newTestIMDSClient(server, true, 0).GetInstanceIdentityDocument()
+	assert.Error(t, err)
+	assert.Equal(t, 0, metadata.documents, "Expect no request without a token")
+}
+
+func TestIdentityDocumentRetriesServerErrors(t *testing.T) {
+	metadata := &testIMDS{validToken: "token", documentFails: 1}
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	document, err := newTestIMDSClient(server, false, 1).GetInstanceIdentityDocument()
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", document.Region)
+	assert.Equal(t, 2, metadata.documents)
+}
+
+func TestIdentityDocumentRetriesExhausted(t *testing.T) {
+	metadata := &testIMDS{validToken: "token", documentFails: 2}
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	_, err := newTestIMDSClient(server, false, 1).GetInstanceIdentityDocument()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unavailable after 1 retries")
+	assert.True(t, IsStatus(err, http.StatusInternalServerError))
+	assert.Equal(t, 2, metadata.documents)
+}
+
+func TestNoRetryOfClientErrors(t *testing.T) {
+	metadata := &testIMDS{tokenStatus: http.StatusBadRequest}
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	_, err := newTestIMDSClient(server, true, 3).sessionToken()
+	assert.Error(t, err)
+	assert.Equal(t, 1, metadata.tokens)
+}
+
+func TestGetCachedReusesResponse(t *testing.T) {
+	metadata := &testIMDS{validToken: "token"}
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	client := newTestIMDSClient(server, false, 0)
+	for i := 0; i < 3; i++ {
+		_, err := client.GetInstanceIdentityDocument()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, metadata.documents)
+}
+
+func TestGetCachedExpires(t *testing.T) {
+	metadata := &testIMDS{validToken: "token"}
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	client := newTestIMDSClient(server, false, 0)
+	fake := clock.NewFake(time.Now())
+	client.clk = fake
+	client.limiter.burst = 10
+
+	_, err := client.GetCached(identityDocumentPath, time.Minute)
+	require.NoError(t, err)
+	_, err = client.GetCached(identityDocumentPath, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, metadata.documents)
+
+	fake.Advance(time.Minute)
+	_, err = client.GetCached(identityDocumentPath, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, metadata.documents)
+}
+
+func TestLimiterSpacesRequestsAfterBurst(t *testing.T) {
+	l := &limiter{interval: time.Second, burst: 2}
+	now := time.Now()
+	assert.Equal(t, time.Duration(0), l.reserve(now))
+	assert.Equal(t, time.Duration(0), l.reserve(now))
+	assert.Equal(t, time.Second, l.reserve(now))
+	assert.Equal(t, 2*time.Second, l.reserve(now))
+
+	// an idle limiter lets a burst through again
+	later := now.Add(time.Minute)
+	assert.Equal(t, time.Duration(0), l.reserve(later))
+	assert.Equal(t, time.Duration(0), l.reserve(later))
+	assert.Equal(t, time.Second, l.reserve(later))
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package introspection reads the state of the running Agent from its
+// introspection API
+package introspection
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	metadataPath = "/v1/metadata"
+	// requestTimeout bounds a request to the Agent, which answers locally
+	requestTimeout = 5 * time.Second
+)
+
+// Metadata is the registration of the instance as reported by the Agent
+type Metadata struct {
+	Cluster              string `json:"Cluster"`
+	ContainerInstanceArn string `json:"ContainerInstanceArn"`
+	Version              string `json:"Version"`
+}
+
+// Client calls the introspection API of the Agent
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+// NewClient creates a Client of the introspection API of the local Agent
+func NewClient() *Client {
+	return &Client{
+		endpoint:   config.AgentIntrospectionEndpoint,
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Metadata returns the metadata of the Agent. The container instance ARN is
+// empty until the Agent has registered the instance.
+func (c *Client) Metadata() (*Metadata, error) {
+	resp, err := c.httpClient.Get(c.endpoint + metadataPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not reach the Agent introspection API")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status from the Agent introspection API: %s", resp.Status)
+	}
+	metadata := &Metadata{}
+	err = json.NewDecoder(resp.Body).Decode(metadata)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode Agent metadata")
+	}
+	return metadata, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package introspection
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(server *httptest.Server) *Client {
+	return &Client{
+		endpoint:   server.URL,
+		httpClient: server.Client(),
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, metadataPath, r.URL.Path)
+		w.Write([]byte(`{"Cluster":"test","ContainerInstanceArn":"arn","Version":"Amazon ECS Agent - v1.40.0"}`))
+	}))
+	defer server.Close()
+
+	metadata, err := newTestClient(server).Metadata()
+	assert.NoError(t, err)
+	assert.Equal(t, &Metadata{
+		Cluster:              "test",
+		ContainerInstanceArn: "arn",
+		Version:              "Amazon ECS Agent - v1.40.0",
+	}, metadata)
+}
+
+func TestMetadataReusesConnection(t *testing.T) {
+	requests := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 5 {
+			// the Agent is still starting
+			http.Error(w, "Agent not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"Cluster":"test","ContainerInstanceArn":"arn","Version":"v1.40.0"}` + "\n"))
+	}))
+	connections := 0
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections++
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := newTestClient(server)
+	for i := 0; i < 10; i++ {
+		client.Metadata()
+	}
+	assert.Equal(t, 1, connections, "Expect the health checks to reuse the connection to the Agent")
+}
+
+func TestMetadataErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, err := newTestClient(server).Metadata()
+	assert.Error(t, err)
+}
+
+func TestMetadataInvalidBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+
+	_, err := newTestClient(server).Metadata()
+	assert.Error(t, err)
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package introspection
+
+import (
+	"context"
+	"crypto/subtle"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// socketPerm allows only root to connect to the socket, socketGroupPerm
+	// also the group of the socket
+	socketPerm      = 0600
+	socketGroupPerm = 0660
+	socketDirPerm   = 0755
+	bearerPrefix    = "Bearer "
+	// shutdownTimeout bounds how long requests in flight are waited for
+	// once the proxy is stopped
+	shutdownTimeout = 5 * time.Second
+)
+
+// SocketProxy serves the introspection API of the Agent on a unix socket, so
+// that host tooling can query it without reaching the TCP port of the Agent.
+// Only GET requests are proxied, and requests must present the bearer token
+// when one is configured.
+type SocketProxy struct {
+	path      string
+	group     string
+	tokenFile string
+	target    *url.URL
+	server    *http.Server
+	done      chan struct{}
+}
+
+// NewSocketProxy creates a SocketProxy of the local Agent configured by the
+// environment
+func NewSocketProxy() (*SocketProxy, error) {
+	target, err := url.Parse(config.AgentIntrospectionEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &SocketProxy{
+		path:      config.IntrospectionSocket(),
+		group:     config.IntrospectionSocketGroup(),
+		tokenFile: config.IntrospectionTokenFile(),
+		target:    target,
+	}, nil
+}
+
+// Start listens on the socket and serves requests until Stop is called
+func (p *SocketProxy) Start() error {
+	var token []byte
+	if p.tokenFile != "" {
+		data, err := ioutil.ReadFile(p.tokenFile)
+		if err != nil {
+			return errors.Wrap(err, "could not read the introspection token")
+		}
+		token = []byte(strings.TrimSpace(string(data)))
+		if len(token) == 0 {
+			return errors.Errorf("the introspection token file %s is empty", p.tokenFile)
+		}
+	}
+	listener, err := p.listen()
+	if err != nil {
+		return err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(p.target)
+	p.server = &http.Server{Handler: authorize(token, proxy)}
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		err := p.server.Serve(listener)
+		if err != http.ErrServerClosed {
+			log.Errorf("Introspection socket stopped serving: %v", err)
+		}
+	}()
+	return nil
+}
+
+// listen creates the socket, replacing the one left behind by a previous
+// run, and restricts who can connect to it
+func (p *SocketProxy) listen() (net.Listener, error) {
+	err := os.MkdirAll(filepath.Dir(p.path), socketDirPerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create the directory of the introspection socket")
+	}
+	err = os.Remove(p.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "could not remove the previous introspection socket")
+	}
+	listener, err := net.Listen("unix", p.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not listen on the introspection socket")
+	}
+	err = p.restrict()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// restrict lets only root, and the members of the group if one is set,
+// connect to the socket
+func (p *SocketProxy) restrict() error {
+	if p.group == "" {
+		return errors.Wrap(os.Chmod(p.path, socketPerm), "could not restrict the introspection socket")
+	}
+	group, err := user.LookupGroup(p.group)
+	if err != nil {
+		return errors.Wrap(err, "could not find the group of the introspection socket")
+	}
+	gid, err := strconv.Atoi(group.Gid)
+	if err != nil {
+		return errors.Wrapf(err, "invalid gid of group %s", p.group)
+	}
+	err = os.Chown(p.path, -1, gid)
+	if err != nil {
+		return errors.Wrap(err, "could not set the group of the introspection socket")
+	}
+	return errors.Wrap(os.Chmod(p.path, socketGroupPerm), "could not restrict the introspection socket")
+}
+
+// Stop stops serving and removes the socket
+func (p *SocketProxy) Stop() error {
+	if p.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := p.server.Shutdown(ctx)
+	<-p.done
+	os.Remove(p.path)
+	return err
+}
+
+// authorize passes the GET requests presenting token, if it is not empty, to
+// next
+func authorize(token []byte, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "the introspection API is read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		if len(token) > 0 {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, bearerPrefix) ||
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, bearerPrefix)), token) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			// the token of the socket is not passed on to the Agent
+			r.Header.Del("Authorization")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package introspection
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestSocketProxy serves the introspection API of agent on a socket in
+// a temp directory, which is removed by the returned function
+func startTestSocketProxy(t *testing.T, agent *httptest.Server, token string) (*SocketProxy, *http.Client) {
+	dir := t.TempDir()
+	target, err := url.Parse(agent.URL)
+	require.NoError(t, err)
+	proxy := &SocketProxy{
+		path:   filepath.Join(dir, "run", "introspection.sock"),
+		target: target,
+	}
+	if token != "" {
+		proxy.tokenFile = filepath.Join(dir, "token")
+		require.NoError(t, ioutil.WriteFile(proxy.tokenFile, []byte(token+"\n"), 0600))
+	}
+	require.NoError(t, proxy.Start())
+	t.Cleanup(func() { proxy.Stop() })
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", proxy.path)
+			},
+		},
+	}
+	return proxy, client
+}
+
+func newTestAgent(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		w.Write([]byte(r.URL.Path))
+	}))
+}
+
+func TestSocketProxy(t *testing.T) {
+	agent := newTestAgent(t)
+	defer agent.Close()
+	proxy, client := startTestSocketProxy(t, agent, "")
+
+	info, err := os.Stat(proxy.path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(socketPerm), info.Mode().Perm())
+
+	resp, err := client.Get("http://introspection" + metadataPath)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, metadataPath, string(body))
+
+	resp, err = client.Post("http://introspection"+metadataPath, "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestSocketProxyToken(t *testing.T) {
+	agent := newTestAgent(t)
+	defer agent.Close()
+	_, client := startTestSocketProxy(t, agent, "secret")
+
+	for header, status := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		req, err := http.NewRequest(http.MethodGet, "http://introspection/v1/tasks", nil)
+		require.NoError(t, err)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, "Authorization: %s", header)
+	}
+}
+
+func TestSocketProxyStopRemovesSocket(t *testing.T) {
+	agent := newTestAgent(t)
+	defer agent.Close()
+	proxy, _ := startTestSocketProxy(t, agent, "")
+
+	assert.NoError(t, proxy.Stop())
+	_, err := os.Stat(proxy.path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSocketProxyEmptyToken(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("\n"), 0600))
+
+	proxy := &SocketProxy{path: filepath.Join(dir, "introspection.sock"), tokenFile: tokenFile}
+	assert.Error(t, proxy.Start())
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package ipranges reads the IP address ranges AWS publishes for its
+// services, which the endpoints of the services rotate through, see
+// https://docs.aws.amazon.com/general/latest/gr/aws-ip-ranges.html
+package ipranges
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// serviceAmazon is the service of all the ranges of AWS
+	serviceAmazon = "AMAZON"
+	// serviceEC2 is the service of the ranges of EC2 instances, which are
+	// listed as ranges of serviceAmazon as well
+	serviceEC2 = "EC2"
+	// requestTimeout bounds downloading the ranges, which are a few MB
+	requestTimeout = time.Minute
+)
+
+// prefix is an IPv4 range of a service in a region
+type prefix struct {
+	IPPrefix string `json:"ip_prefix"`
+	Region   string `json:"region"`
+	Service  string `json:"service"`
+}
+
+// ranges is the document AWS publishes the ranges in
+type ranges struct {
+	Prefixes []prefix `json:"prefixes"`
+}
+
+// Source reads the published ranges from a URL. The ranges are only
+// downloaded again once they changed.
+type Source struct {
+	url    string
+	client *http.Client
+
+	lock   sync.Mutex
+	etag   string
+	ranges *ranges
+}
+
+// NewSource returns a Source of the ranges published at url
+func NewSource(url string) *Source {
+	return &Source{
+		url:    url,
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// ServicePrefixes returns the IPv4 CIDR blocks of the AWS services in region:
+// the ranges of AWS that are not ranges of EC2 instances. An error is
+// returned when none are published for region.
+func (s *Source) ServicePrefixes(ctx context.Context, region string) ([]string, error) {
+	ranges, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	instances := make(map[string]bool)
+	for _, prefix := range ranges.Prefixes {
+		if prefix.Region == region && prefix.Service == serviceEC2 {
+			instances[prefix.IPPrefix] = true
+		}
+	}
+	seen := make(map[string]bool)
+	var prefixes []string
+	for _, prefix := range ranges.Prefixes {
+		if prefix.Region != region || prefix.Service != serviceAmazon {
+			continue
+		}
+		if instances[prefix.IPPrefix] || seen[prefix.IPPrefix] {
+			continue
+		}
+		seen[prefix.IPPrefix] = true
+		prefixes = append(prefixes, prefix.IPPrefix)
+	}
+	if len(prefixes) == 0 {
+		return nil, errors.Errorf("%s publishes no address ranges of AWS services in %s", s.url, region)
+	}
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+// fetch returns the ranges, downloading them unless they did not change
+// since they were downloaded
+func (s *Source) fetch(ctx context.Context) (*ranges, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not download the AWS IP address ranges")
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if s.ranges != nil {
+			return s.ranges, nil
+		}
+	case http.StatusOK:
+		var downloaded ranges
+		err = json.NewDecoder(resp.Body).Decode(&downloaded)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid AWS IP address ranges at %s", s.url)
+		}
+		s.etag = resp.Header.Get("ETag")
+		s.ranges = &downloaded
+		return s.ranges, nil
+	}
+	return nil, errors.Errorf("could not download the AWS IP address ranges: GET %s: unexpected status %d", s.url, resp.StatusCode)
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipranges
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRanges = `{
+  "syncToken": "1589917992",
+  "createDate": "2020-05-19-19-53-12",
+  "prefixes": [
+    {"ip_prefix": "52.94.0.0/22", "region": "us-west-2", "service": "AMAZON", "network_border_group": "us-west-2"},
+    {"ip_prefix": "52.218.128.0/17", "region": "us-west-2", "service": "AMAZON", "network_border_group": "us-west-2"},
+    {"ip_prefix": "52.218.128.0/17", "region": "us-west-2", "service": "S3", "network_border_group": "us-west-2"},
+    {"ip_prefix": "54.68.0.0/14", "region": "us-west-2", "service": "AMAZON", "network_border_group": "us-west-2"},
+    {"ip_prefix": "54.68.0.0/14", "region": "us-west-2", "service": "EC2", "network_border_group": "us-west-2"},
+    {"ip_prefix": "52.94.4.0/24", "region": "us-east-1", "service": "AMAZON", "network_border_group": "us-east-1"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2600:1f14::/35", "region": "us-west-2", "service": "AMAZON", "network_border_group": "us-west-2"}
+  ]
+}`
+
+func TestServicePrefixes(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"1589917992"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"1589917992"`)
+		w.Write([]byte(testRanges))
+	}))
+	defer server.Close()
+
+	source := NewSource(server.URL)
+	prefixes, err := source.ServicePrefixes(context.Background(), "us-west-2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"52.218.128.0/17", "52.94.0.0/22"}, prefixes, "Expect the ranges of EC2 instances to be left out")
+
+	prefixes, err = source.ServicePrefixes(context.Background(), "us-east-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"52.94.4.0/24"}, prefixes)
+	assert.Equal(t, 2, requests)
+}
+
+func TestServicePrefixesUnknownRegion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRanges))
+	}))
+	defer server.Close()
+
+	_, err := NewSource(server.URL).ServicePrefixes(context.Background(), "eu-west-3")
+	assert.Error(t, err)
+}
+
+func TestServicePrefixesDownloadFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := NewSource(server.URL).ServicePrefixes(context.Background(), "us-west-2")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected status 403")
+}
+
+func TestServicePrefixesInvalid(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>"))
+	}))
+	defer server.Close()
+
+	_, err := NewSource(server.URL).ServicePrefixes(context.Background(), "us-west-2")
+	assert.Error(t, err)
+}
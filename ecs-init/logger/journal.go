@@ -0,0 +1,124 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"strings"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// journalReceiverName is the name of the seelog receiver writing to
+	// the journal
+	journalReceiverName = "journal"
+	// syslogIdentifier identifies the messages of ecs-init in the journal
+	syslogIdentifier = "ecs-init"
+)
+
+// journalSocket is the socket journald receives native messages on
+var journalSocket = "/run/systemd/journal/socket"
+
+// journalPriorities maps the seelog levels to syslog priorities
+var journalPriorities = map[log.LogLevel]string{
+	log.TraceLvl:    "7",
+	log.DebugLvl:    "7",
+	log.InfoLvl:     "6",
+	log.WarnLvl:     "4",
+	log.ErrorLvl:    "3",
+	log.CriticalLvl: "2",
+}
+
+// journalFields are the structured fields the receiver adds to messages,
+// set from the data- attributes of its seelog configuration
+var journalFields = map[string]string{
+	"action":        "ACTION",
+	"agent-version": "AGENT_VERSION",
+	"version":       "ECS_INIT_VERSION",
+}
+
+// journalReceiver sends messages to journald following its native protocol,
+// with the priority of their level and the structured fields of ecs-init,
+// so that they can be queried with journalctl, e.g. journalctl ACTION=start
+type journalReceiver struct {
+	conn   *net.UnixConn
+	fields [][2]string
+}
+
+// journalAvailable returns true when journald listens for native messages
+func journalAvailable() bool {
+	_, err := os.Stat(journalSocket)
+	return err == nil
+}
+
+// AfterParse connects to journald
+func (r *journalReceiver) AfterParse(args log.CustomReceiverInitArgs) error {
+	r.fields = [][2]string{{"SYSLOG_IDENTIFIER", syslogIdentifier}}
+	for attr, field := range journalFields {
+		if value := args.XmlCustomAttrs[attr]; value != "" {
+			r.fields = append(r.fields, [2]string{field, value})
+		}
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return errors.Wrap(err, "could not connect to journald")
+	}
+	r.conn = conn
+	return nil
+}
+
+// ReceiveMessage sends a message to journald
+func (r *journalReceiver) ReceiveMessage(message string, level log.LogLevel, context log.LogContextInterface) error {
+	var buffer bytes.Buffer
+	writeJournalField(&buffer, "MESSAGE", strings.TrimSuffix(message, "\n"))
+	writeJournalField(&buffer, "PRIORITY", journalPriorities[level])
+	for _, field := range r.fields {
+		writeJournalField(&buffer, field[0], field[1])
+	}
+	_, err := r.conn.Write(buffer.Bytes())
+	return err
+}
+
+// Flush does nothing, as messages are sent as they are received
+func (r *journalReceiver) Flush() {}
+
+// Close disconnects from journald
+func (r *journalReceiver) Close() error {
+	if r.conn == nil {
+		return nil
+	}
+	return r.conn.Close()
+}
+
+// writeJournalField writes a field in the native journal protocol, where
+// values holding newlines are written with their length instead of as
+// NAME=value
+func writeJournalField(buffer *bytes.Buffer, name string, value string) {
+	if !strings.Contains(value, "\n") {
+		buffer.WriteString(name + "=" + value + "\n")
+		return
+	}
+	buffer.WriteString(name + "\n")
+	binary.Write(buffer, binary.LittleEndian, uint64(len(value)))
+	buffer.WriteString(value + "\n")
+}
+
+func init() {
+	log.RegisterReceiver(journalReceiverName, &journalReceiver{})
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenJournal listens on a socket standing in for journald
+func listenJournal(t *testing.T) *net.UnixConn {
+	socket := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	previous := journalSocket
+	journalSocket = socket
+	t.Cleanup(func() {
+		journalSocket = previous
+		conn.Close()
+	})
+	return conn
+}
+
+func TestJournalReceiver(t *testing.T) {
+	conn := listenJournal(t)
+
+	settings := testSettings("/var/log/ecs/ecs-init.log")
+	settings.Output = config.LogOutputJournal
+	settings.Level = "info"
+	settings.Action = "start"
+	settings.AgentVersion = "v1.40.0"
+	logger, err := log.LoggerFromConfigAsString(SeelogConfig(settings))
+	require.NoError(t, err)
+	logger.Warn("first line\nsecond line")
+	logger.Flush()
+	logger.Close()
+
+	buffer := make([]byte, 4096)
+	n, err := conn.Read(buffer)
+	require.NoError(t, err)
+	var message bytes.Buffer
+	message.WriteString("MESSAGE\n")
+	binary.Write(&message, binary.LittleEndian, uint64(len("first line\nsecond line")))
+	message.WriteString("first line\nsecond line\n")
+	datagram := string(buffer[:n])
+	assert.Contains(t, datagram, message.String())
+	assert.Contains(t, datagram, "PRIORITY=4\n")
+	assert.Contains(t, datagram, "SYSLOG_IDENTIFIER=ecs-init\n")
+	assert.Contains(t, datagram, "ACTION=start\n")
+	assert.Contains(t, datagram, "AGENT_VERSION=v1.40.0\n")
+}
+
+func TestSettingsFromEnvJournalUnavailable(t *testing.T) {
+	previous := journalSocket
+	journalSocket = "/nonexistent/socket"
+	defer func() { journalSocket = previous }()
+	os.Setenv(config.LogOutputEnvVar, config.LogOutputJournal)
+	defer os.Unsetenv(config.LogOutputEnvVar)
+
+	settings, errs := SettingsFromEnv("start")
+	assert.Len(t, errs, 1)
+	assert.Equal(t, config.LogOutputAll, settings.Output)
+}
+
+func TestSettingsFromEnvJournal(t *testing.T) {
+	listenJournal(t)
+	os.Setenv(config.LogOutputEnvVar, config.LogOutputJournal)
+	defer os.Unsetenv(config.LogOutputEnvVar)
+
+	settings, errs := SettingsFromEnv("start")
+	assert.Empty(t, errs)
+	assert.Equal(t, config.LogOutputJournal, settings.Output)
+}
+
+func TestWriteJournalField(t *testing.T) {
+	var buffer bytes.Buffer
+	writeJournalField(&buffer, "ACTION", "start")
+	assert.Equal(t, "ACTION=start\n", buffer.String())
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package logger configures the seelog logger of ecs-init from the
+// environment: the lowest level logged, whether messages are logged as text
+// or as JSON objects that CloudWatch and Fluent Bit ingest without custom
+// parsing, where they are written, how the log file is rotated and how long
+// rotated log files are kept.
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"text/template"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/version"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// jsonFormatter is the name of the seelog formatter writing a message as a
+// JSON object
+const jsonFormatter = "EcsInitJSON"
+
+// Settings configure the logger
+type Settings struct {
+	// Level is the lowest level logged, see config.LogLevel
+	Level string
+	// Format is config.LogFormatText or config.LogFormatJSON
+	Format string
+	// Output is where the log is written, see config.LogOutput
+	Output string
+	// Rollover is when the log file is rotated, see config.LogRollover
+	Rollover string
+	// FileSize is the size in bytes the log file is rotated at when it is
+	// rotated by size
+	FileSize int64
+	// FileNum is how many rotated log files are kept
+	FileNum int
+	// MaxAge is how long rotated log files are kept, or zero to keep them
+	// regardless of their age
+	MaxAge time.Duration
+	// File is the log file
+	File string
+	// Action is the action ecs-init runs, sent to journald as ACTION
+	Action string
+	// AgentVersion is the version of the Agent, sent to journald as
+	// AGENT_VERSION
+	AgentVersion string
+}
+
+// SettingsFromEnv returns the settings configured in the environment for
+// action, along with the errors of the settings that were invalid and
+// replaced by their defaults
+func SettingsFromEnv(action string) (Settings, []error) {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	settings := Settings{
+		File:         config.InitLogFile(),
+		Action:       action,
+		AgentVersion: config.AgentVersion(),
+	}
+	var err error
+	settings.Level, err = config.LogLevel()
+	check(err)
+	settings.Format, err = config.LogFormat()
+	check(err)
+	settings.Output, err = config.LogOutput()
+	check(err)
+	settings.Rollover, err = config.LogRollover()
+	check(err)
+	settings.FileSize, err = config.LogFileSize()
+	check(err)
+	settings.FileNum, err = config.LogFileNum()
+	check(err)
+	settings.MaxAge, err = config.LogMaxAge()
+	check(err)
+	if settings.Output == config.LogOutputJournal && !journalAvailable() {
+		check(errors.Errorf("journald does not listen on %s, logging to %s", journalSocket, config.LogOutputAll))
+		settings.Output = config.LogOutputAll
+	}
+	return settings, errs
+}
+
+// seelogLevels maps the levels of ecs-init to those of seelog
+var seelogLevels = map[string]string{
+	"debug": "debug",
+	"info":  "info",
+	"warn":  "warn",
+	"error": "error",
+	"crit":  "critical",
+}
+
+var seelogTemplate = template.Must(template.New("seelog").Parse(`
+<seelog type="asyncloop" minlevel="{{.Level}}">
+	<outputs formatid="{{.FileFormat}}">
+		<custom name="` + tailReceiverName + `" formatid="main" />
+{{- if .Journal}}
+		<custom name="` + journalReceiverName + `" formatid="message"
+			data-action="{{.Action}}" data-agent-version="{{.AgentVersion}}" data-version="{{.Version}}" />
+{{- end}}
+{{- if .Console}}
+		<console formatid="{{.ConsoleFormat}}" />
+{{- end}}
+{{- if .File}}
+{{- if .BySize}}
+		<rollingfile filename="{{.File}}" type="size"
+			 maxsize="{{.FileSize}}" archivetype="zip" maxrolls="{{.FileNum}}" />
+{{- else}}
+		<rollingfile filename="{{.File}}" type="date"
+			 datepattern="2006-01-02-15" archivetype="zip" maxrolls="{{.FileNum}}" />
+{{- end}}
+{{- end}}
+	</outputs>
+	<formats>
+		<format id="main" format="%UTCDate(2006-01-02T15:04:05Z07:00) [%LEVEL] %Msg%n" />
+		<format id="console" format="%UTCDate(2006-01-02T15:04:05Z07:00) %EscM(46)[%LEVEL]%EscM(49) %Msg%n%EscM(0)" />
+		<format id="json" format="%` + jsonFormatter + `%n" />
+		<format id="message" format="%Msg" />
+	</formats>
+</seelog>
+`))
+
+// SeelogConfig returns the seelog configuration of settings
+func SeelogConfig(settings Settings) string {
+	level, ok := seelogLevels[settings.Level]
+	if !ok {
+		level = seelogLevels[config.DefaultLogLevel]
+	}
+	fileFormat, consoleFormat := "main", "console"
+	if settings.Format == config.LogFormatJSON {
+		fileFormat, consoleFormat = "json", "json"
+	}
+	journal := settings.Output == config.LogOutputJournal
+	var file string
+	if settings.Output == config.LogOutputFile || settings.Output == config.LogOutputAll {
+		file = settings.File
+	}
+	var buffer bytes.Buffer
+	// the template only fails on write errors, which a buffer does not have
+	_ = seelogTemplate.Execute(&buffer, struct {
+		Level         string
+		FileFormat    string
+		ConsoleFormat string
+		Journal       bool
+		Action        string
+		AgentVersion  string
+		Version       string
+		Console       bool
+		File          string
+		BySize        bool
+		FileSize      int64
+		FileNum       int
+	}{
+		Level:         level,
+		FileFormat:    fileFormat,
+		ConsoleFormat: consoleFormat,
+		Journal:       journal,
+		Action:        html.EscapeString(settings.Action),
+		AgentVersion:  html.EscapeString(settings.AgentVersion),
+		Version:       html.EscapeString(version.Version),
+		Console:       settings.Output == config.LogOutputConsole || settings.Output == config.LogOutputAll,
+		File:          file,
+		BySize:        settings.Rollover == config.LogRolloverSize,
+		FileSize:      settings.FileSize,
+		FileNum:       settings.FileNum,
+	})
+	return buffer.String()
+}
+
+// Init replaces the seelog logger with one configured from the environment
+// for action. Invalid settings are logged once the logger is replaced.
+func Init(action string) error {
+	settings, errs := SettingsFromEnv(action)
+	logger, err := log.LoggerFromConfigAsString(SeelogConfig(settings))
+	if err != nil {
+		return err
+	}
+	log.ReplaceLogger(logger)
+	for _, err := range errs {
+		log.Warnf("Using the default log setting: %v", err)
+	}
+	writesFile := settings.Output == config.LogOutputFile || settings.Output == config.LogOutputAll
+	if writesFile && settings.MaxAge > 0 {
+		startRetention(settings.File, settings.MaxAge)
+	}
+	return nil
+}
+
+// jsonRecord is a message logged as JSON
+type jsonRecord struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+}
+
+// formatJSON formats a message as a JSON object
+func formatJSON(message string, level log.LogLevel, context log.LogContextInterface) interface{} {
+	record := jsonRecord{
+		Time:    context.CallTime().UTC().Format(time.RFC3339),
+		Level:   level.String(),
+		Message: message,
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		// strings always marshal
+		return message
+	}
+	return string(data)
+}
+
+func init() {
+	err := log.RegisterCustomFormatter(jsonFormatter, func(string) log.FormatterFunc {
+		return formatJSON
+	})
+	if err != nil {
+		panic(err)
+	}
+}
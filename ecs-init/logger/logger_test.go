@@ -0,0 +1,138 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSettings(file string) Settings {
+	return Settings{
+		Level:    config.DefaultLogLevel,
+		Format:   config.LogFormatText,
+		Output:   config.LogOutputAll,
+		Rollover: config.LogRolloverHourly,
+		FileSize: config.DefaultLogFileSize * 1024 * 1024,
+		FileNum:  config.DefaultLogFileNum,
+		File:     file,
+	}
+}
+
+// logTo logs a message with a logger configured by settings and returns
+// what it wrote to the log file
+func logTo(t *testing.T, settings Settings, message string) string {
+	logger, err := log.LoggerFromConfigAsString(SeelogConfig(settings))
+	require.NoError(t, err)
+	logger.Info(message)
+	logger.Debug("debug message")
+	logger.Close()
+	data, err := ioutil.ReadFile(settings.File)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestSettingsFromEnvDefaults(t *testing.T) {
+	settings, errs := SettingsFromEnv("start")
+	assert.Empty(t, errs)
+	expected := testSettings(config.InitLogFile())
+	expected.Action = "start"
+	expected.AgentVersion = config.AgentVersion()
+	assert.Equal(t, expected, settings)
+}
+
+func TestSettingsFromEnvInvalid(t *testing.T) {
+	os.Setenv(config.LogLevelEnvVar, "verbose")
+	defer os.Unsetenv(config.LogLevelEnvVar)
+	os.Setenv(config.LogFormatEnvVar, config.LogFormatJSON)
+	defer os.Unsetenv(config.LogFormatEnvVar)
+	os.Setenv(config.LogFileNumEnvVar, "none")
+	defer os.Unsetenv(config.LogFileNumEnvVar)
+
+	settings, errs := SettingsFromEnv("start")
+	assert.Len(t, errs, 2)
+	assert.Equal(t, config.DefaultLogLevel, settings.Level)
+	assert.Equal(t, config.LogFormatJSON, settings.Format)
+	assert.Equal(t, config.DefaultLogFileNum, settings.FileNum)
+}
+
+func TestSeelogConfigText(t *testing.T) {
+	dir := t.TempDir()
+
+	settings := testSettings(filepath.Join(dir, "ecs-init.log"))
+	settings.Output = config.LogOutputFile
+	written := logTo(t, settings, "text message")
+	assert.Contains(t, written, "[INFO] text message\n")
+	assert.Contains(t, written, "[DEBUG] debug message\n")
+}
+
+func TestSeelogConfigJSON(t *testing.T) {
+	dir := t.TempDir()
+
+	settings := testSettings(filepath.Join(dir, "ecs-init.log"))
+	settings.Format = config.LogFormatJSON
+	settings.Output = config.LogOutputFile
+	settings.Level = "info"
+	written := logTo(t, settings, `quoted "message"`)
+	lines := strings.Split(strings.TrimSpace(written), "\n")
+	require.Len(t, lines, 1)
+	var record map[string]string
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "info", record["level"])
+	assert.Equal(t, `quoted "message"`, record["msg"])
+	assert.NotEmpty(t, record["time"])
+}
+
+func TestSeelogConfigSizeRollover(t *testing.T) {
+	settings := testSettings("/var/log/ecs/ecs-init.log")
+	settings.Rollover = config.LogRolloverSize
+	settings.FileSize = 1024
+	settings.FileNum = 3
+	seelogConfig := SeelogConfig(settings)
+	assert.Contains(t, seelogConfig, `type="size"`)
+	assert.Contains(t, seelogConfig, `maxsize="1024"`)
+	assert.Contains(t, seelogConfig, `maxrolls="3"`)
+	_, err := log.LoggerFromConfigAsString(seelogConfig)
+	assert.NoError(t, err)
+}
+
+func TestSeelogConfigConsole(t *testing.T) {
+	dir := t.TempDir()
+
+	settings := testSettings(filepath.Join(dir, "ecs-init.log"))
+	settings.Output = config.LogOutputConsole
+	assert.Empty(t, logTo(t, settings, "console message"))
+}
+
+func TestSeelogConfigLevels(t *testing.T) {
+	for _, level := range []string{"debug", "info", "warn", "error", "crit"} {
+		settings := testSettings("/var/log/ecs/ecs-init.log")
+		settings.Level = level
+		_, err := log.LoggerFromConfigAsString(SeelogConfig(settings))
+		assert.NoError(t, err, level)
+	}
+}
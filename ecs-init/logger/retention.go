@@ -0,0 +1,78 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// retentionInterval is how often rotated log files are checked for their age
+var retentionInterval = time.Hour
+
+// startRetention removes the rotated log files of file older than maxAge, at
+// once and then every retentionInterval for the life of the process
+func startRetention(file string, maxAge time.Duration) {
+	removeExpiredLogs(file, maxAge)
+	go func() {
+		ticker := time.NewTicker(retentionInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			removeExpiredLogs(file, maxAge)
+		}
+	}()
+}
+
+// removeExpiredLogs removes and logs the rotated log files of file older
+// than maxAge
+func removeExpiredLogs(file string, maxAge time.Duration) {
+	removed, err := removeExpired(file, time.Now().Add(-maxAge))
+	for _, rotated := range removed {
+		log.Infof("Removed %s, rotated more than %s ago", rotated, maxAge)
+	}
+	if err != nil {
+		log.Warnf("Could not remove the expired log files: %v", err)
+	}
+}
+
+// removeExpired removes the rotated log files of file last written before
+// cutoff and returns those it removed. Rotated log files are named after
+// file, followed by a dot and the name of the roll.
+func removeExpired(file string, cutoff time.Time) ([]string, error) {
+	dir := filepath.Dir(file)
+	prefix := filepath.Base(file) + "."
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list %s", dir)
+	}
+	var removed []string
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || !strings.HasPrefix(info.Name(), prefix) || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		rotated := filepath.Join(dir, info.Name())
+		err = os.Remove(rotated)
+		if err != nil && !os.IsNotExist(err) {
+			return removed, errors.Wrapf(err, "could not remove %s", rotated)
+		}
+		removed = append(removed, rotated)
+	}
+	return removed, nil
+}
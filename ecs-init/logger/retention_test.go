@@ -0,0 +1,60 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveExpired(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	files := map[string]time.Time{
+		"ecs-init.log":               old,
+		"ecs-init.log.2020-01-01-00": old,
+		"ecs-init.log.1":             old,
+		"ecs-init.log.2":             now,
+		"audit.log.1":                old,
+	}
+	for name, modified := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte("log"), 0644))
+		require.NoError(t, os.Chtimes(path, modified, modified))
+	}
+
+	removed, err := removeExpired(filepath.Join(dir, "ecs-init.log"), now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "ecs-init.log.1"),
+		filepath.Join(dir, "ecs-init.log.2020-01-01-00"),
+	}, removed)
+	for _, kept := range []string{"ecs-init.log", "ecs-init.log.2", "audit.log.1"} {
+		_, err := os.Stat(filepath.Join(dir, kept))
+		assert.NoError(t, err, "Expected %s to be kept", kept)
+	}
+}
+
+func TestRemoveExpiredMissingDirectory(t *testing.T) {
+	_, err := removeExpired("/nonexistent/ecs-init.log", time.Now())
+	assert.Error(t, err)
+}
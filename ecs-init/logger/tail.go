@@ -0,0 +1,76 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"strings"
+	"sync"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// tailReceiverName is the name of the seelog receiver keeping the last
+	// messages logged
+	tailReceiverName = "tail"
+	// TailLines is how many of the last messages logged are kept
+	TailLines = 50
+)
+
+var (
+	tailLock sync.Mutex
+	tail     []string
+)
+
+// tailReceiver keeps the last messages logged in memory, whatever the output
+// of the log, so that they can be reported when ecs-init fails
+type tailReceiver struct{}
+
+// AfterParse does nothing, as the messages are kept by the package
+func (r *tailReceiver) AfterParse(args log.CustomReceiverInitArgs) error {
+	return nil
+}
+
+// ReceiveMessage keeps a message, dropping the oldest one kept once
+// TailLines are
+func (r *tailReceiver) ReceiveMessage(message string, level log.LogLevel, context log.LogContextInterface) error {
+	tailLock.Lock()
+	defer tailLock.Unlock()
+	if len(tail) == TailLines {
+		tail = append(tail[:0], tail[1:]...)
+	}
+	tail = append(tail, strings.TrimSuffix(message, "\n"))
+	return nil
+}
+
+// Flush does nothing, as messages are kept as they are received
+func (r *tailReceiver) Flush() {}
+
+// Close does nothing, so that the messages are kept when the logger is
+// replaced
+func (r *tailReceiver) Close() error {
+	return nil
+}
+
+// Tail returns the last messages logged, oldest first. Messages still queued
+// by the logger are only returned once it is flushed.
+func Tail() []string {
+	tailLock.Lock()
+	defer tailLock.Unlock()
+	return append([]string(nil), tail...)
+}
+
+func init() {
+	log.RegisterReceiver(tailReceiverName, &tailReceiver{})
+}
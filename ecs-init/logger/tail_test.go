@@ -0,0 +1,46 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTail(t *testing.T) {
+	dir := t.TempDir()
+
+	settings := testSettings(filepath.Join(dir, "ecs-init.log"))
+	settings.Output = config.LogOutputFile
+	settings.Level = "info"
+	logger, err := log.LoggerFromConfigAsString(SeelogConfig(settings))
+	require.NoError(t, err)
+	for i := 0; i < TailLines+10; i++ {
+		logger.Infof("message %d", i)
+	}
+	logger.Debug("debug message")
+	logger.Close()
+
+	lines := Tail()
+	require.Len(t, lines, TailLines)
+	assert.Contains(t, lines[0], "[INFO] message 10")
+	assert.Contains(t, lines[TailLines-1], fmt.Sprintf("[INFO] message %d", TailLines+9))
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package logvolume measures the logs of ecs-init and of the Agent, and the
+// volume they are written to, and finds the rotated logs to remove so that
+// the logs cannot fill the volume.
+package logvolume
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Usage is the space taken by the logs
+type Usage struct {
+	// LogBytes is the size of the files in the log directory and of the
+	// log files of the Agent container
+	LogBytes int64
+	// VolumeUsed is the fraction of the volume holding the log directory
+	// that is in use
+	VolumeUsed float64
+}
+
+// Volume measures the logs in a log directory and in the log files of the
+// Agent container
+type Volume struct {
+	directory string
+	statfs    func(path string, stat *unix.Statfs_t) error
+}
+
+// logFile is a file counted as a log
+type logFile struct {
+	path    string
+	size    int64
+	modTime int64
+	rotated bool
+}
+
+// New creates a Volume measuring the logs in directory
+func New(directory string) *Volume {
+	return &Volume{
+		directory: directory,
+		statfs:    unix.Statfs,
+	}
+}
+
+// Usage returns the space taken by the logs. agentLog is the log file of the
+// Agent container, whose rotated files are counted along with it, or an empty
+// string when it is not known.
+func (v *Volume) Usage(agentLog string) (Usage, error) {
+	files, err := v.logFiles(agentLog)
+	if err != nil {
+		return Usage{}, err
+	}
+	var usage Usage
+	for _, file := range files {
+		usage.LogBytes += file.size
+	}
+	var stat unix.Statfs_t
+	err = v.statfs(v.directory, &stat)
+	if err != nil {
+		return Usage{}, errors.Wrapf(err, "could not measure the volume of %s", v.directory)
+	}
+	// like df, the blocks reserved for root count as neither used nor free
+	used := stat.Blocks - stat.Bfree
+	if used+stat.Bavail > 0 {
+		usage.VolumeUsed = float64(used) / float64(used+stat.Bavail)
+	}
+	return usage, nil
+}
+
+// Excess returns the rotated logs to remove, oldest first, for the logs to
+// take at most maxBytes. Logs that are still written to are never returned,
+// so the logs may take more than maxBytes once the excess is removed.
+func (v *Volume) Excess(agentLog string, maxBytes int64) ([]string, error) {
+	files, err := v.logFiles(agentLog)
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	var rotated []logFile
+	for _, file := range files {
+		total += file.size
+		if file.rotated {
+			rotated = append(rotated, file)
+		}
+	}
+	sort.SliceStable(rotated, func(i, j int) bool {
+		return rotated[i].modTime < rotated[j].modTime
+	})
+	var excess []string
+	for _, file := range rotated {
+		if total <= maxBytes {
+			break
+		}
+		excess = append(excess, file.path)
+		total -= file.size
+	}
+	return excess, nil
+}
+
+// Remove removes a log returned by Excess
+func (v *Volume) Remove(file string) error {
+	err := os.Remove(file)
+	if os.IsNotExist(err) {
+		// rotated away in the meantime
+		return nil
+	}
+	return err
+}
+
+// logFiles returns the files in the log directory and the log files of the
+// Agent container
+func (v *Volume) logFiles(agentLog string) ([]logFile, error) {
+	var files []logFile
+	err := filepath.Walk(v.directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, newLogFile(path, info))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list the logs in %s", v.directory)
+	}
+	if agentLog == "" {
+		return files, nil
+	}
+	// Docker rotates the log file of a container to numbered files next to
+	// it, e.g. ID-json.log.1
+	paths, err := filepath.Glob(agentLog + ".*")
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list the rotated logs of %s", agentLog)
+	}
+	for _, path := range append([]string{agentLog}, paths...) {
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.Wrap(err, "could not measure the logs of the Agent container")
+		}
+		files = append(files, newLogFile(path, info))
+	}
+	return files, nil
+}
+
+func newLogFile(path string, info os.FileInfo) logFile {
+	return logFile{
+		path:    path,
+		size:    info.Size(),
+		modTime: info.ModTime().UnixNano(),
+		rotated: isRotated(filepath.Base(path)),
+	}
+}
+
+// isRotated returns true for logs that were rotated away from the file they
+// were written to, e.g. ecs-agent.log.2020-06-01-10 or ID-json.log.1, which
+// are no longer written to. Files that are not logs are never rotated.
+func isRotated(name string) bool {
+	index := strings.Index(name, ".log.")
+	return index > 0 && index+len(".log.") < len(name)
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logvolume
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// writeLog writes a log of size bytes last modified age ago
+func writeLog(t *testing.T, path string, size int, age time.Duration) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Repeat("x", size)), 0600))
+	modTime := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func statfs(blocks, free, available uint64) func(string, *unix.Statfs_t) error {
+	return func(path string, stat *unix.Statfs_t) error {
+		stat.Blocks = blocks
+		stat.Bfree = free
+		stat.Bavail = available
+		return nil
+	}
+}
+
+func TestUsage(t *testing.T) {
+	root := t.TempDir()
+	logDir := filepath.Join(root, "log")
+	agentLog := filepath.Join(root, "containers", "id", "id-json.log")
+	writeLog(t, filepath.Join(logDir, "ecs-init.log"), 10, 0)
+	writeLog(t, filepath.Join(logDir, "ecs-agent.log.2020-06-01-10"), 20, time.Hour)
+	writeLog(t, filepath.Join(logDir, "exec", "task.log"), 30, 0)
+	writeLog(t, agentLog, 40, 0)
+	writeLog(t, agentLog+".1", 50, time.Hour)
+	writeLog(t, filepath.Join(root, "containers", "id", "config.v2.json"), 60, 0)
+
+	volume := New(logDir)
+	// 100 blocks, 30 used, 10 reserved for root
+	volume.statfs = statfs(100, 70, 60)
+	usage, err := volume.Usage(agentLog)
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), usage.LogBytes)
+	assert.InDelta(t, 1.0/3, usage.VolumeUsed, 0.0001)
+
+	usage, err = volume.Usage("")
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), usage.LogBytes)
+}
+
+func TestUsageMissingDirectory(t *testing.T) {
+	root := t.TempDir()
+
+	volume := New(filepath.Join(root, "log"))
+	volume.statfs = statfs(100, 100, 100)
+	usage, err := volume.Usage(filepath.Join(root, "id-json.log"))
+	require.NoError(t, err)
+	assert.Equal(t, Usage{}, usage)
+}
+
+func TestUsageStatfsError(t *testing.T) {
+	root := t.TempDir()
+
+	volume := New(root)
+	volume.statfs = func(string, *unix.Statfs_t) error {
+		return errors.New("test error")
+	}
+	_, err := volume.Usage("")
+	assert.Error(t, err)
+}
+
+func TestUsageOfVolume(t *testing.T) {
+	root := t.TempDir()
+
+	usage, err := New(root).Usage("")
+	require.NoError(t, err)
+	assert.True(t, usage.VolumeUsed > 0 && usage.VolumeUsed <= 1, "volume used %f", usage.VolumeUsed)
+}
+
+func TestExcess(t *testing.T) {
+	root := t.TempDir()
+	logDir := filepath.Join(root, "log")
+	agentLog := filepath.Join(root, "containers", "id", "id-json.log")
+	writeLog(t, filepath.Join(logDir, "ecs-init.log"), 100, 0)
+	writeLog(t, filepath.Join(logDir, "ecs-agent.log"), 100, 0)
+	writeLog(t, filepath.Join(logDir, "ecs-agent.log.2020-06-01-10"), 100, 3*time.Hour)
+	writeLog(t, filepath.Join(logDir, "ecs-agent.log.2020-06-01-11"), 100, 2*time.Hour)
+	writeLog(t, filepath.Join(logDir, "notes.txt"), 100, 5*time.Hour)
+	writeLog(t, agentLog, 100, 0)
+	writeLog(t, agentLog+".1", 100, 4*time.Hour)
+
+	volume := New(logDir)
+	excess, err := volume.Excess(agentLog, 500)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		agentLog + ".1",
+		filepath.Join(logDir, "ecs-agent.log.2020-06-01-10"),
+	}, excess)
+
+	excess, err = volume.Excess(agentLog, 700)
+	require.NoError(t, err)
+	assert.Empty(t, excess)
+
+	// logs still written to are kept even when over the limit
+	excess, err = volume.Excess(agentLog, 0)
+	require.NoError(t, err)
+	assert.Len(t, excess, 3)
+}
+
+func TestRemove(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "ecs-agent.log.2020-06-01-10")
+	writeLog(t, file, 10, 0)
+
+	volume := New(root)
+	require.NoError(t, volume.Remove(file))
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	// removing a log rotated away in the meantime is not an error
+	assert.NoError(t, volume.Remove(file))
+}
+
+func TestIsRotated(t *testing.T) {
+	for name, rotated := range map[string]bool{
+		"ecs-agent.log":               false,
+		"ecs-agent.log.2020-06-01-10": true,
+		"ecs-init.log.2020-06-01-10":  true,
+		"id-json.log":                 false,
+		"id-json.log.1":               true,
+		"audit.log":                   false,
+		"ecs-agent.log.":              false,
+		".log.1":                      false,
+		"notes.txt":                   false,
+	} {
+		assert.Equal(t, rotated, isRotated(name), name)
+	}
+}
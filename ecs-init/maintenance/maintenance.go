@@ -0,0 +1,277 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package maintenance decides when disruptive actions on the Agent, such as
+// restarting it to upgrade, are allowed
+package maintenance
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxWindowDuration bounds how long a window lasts, so that finding
+	// the window around a time stays cheap
+	maxWindowDuration = 7 * 24 * time.Hour
+	// nextWindowHorizon is how far ahead the next window is looked for
+	nextWindowHorizon = 366 * 24 * time.Hour
+)
+
+// field is the set of values matched by a field of a window, as a bitmask
+type field struct {
+	values uint64
+	// any is set when the field is '*', which matters for the days of a
+	// window as in cron
+	any bool
+}
+
+func (f field) matches(value int) bool {
+	return f.values&(1<<uint(value)) != 0
+}
+
+// bounds of the cron fields of a window
+var fieldBounds = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Window recurs every time its cron fields match and lasts for Duration
+type Window struct {
+	minute     field
+	hour       field
+	dayOfMonth field
+	month      field
+	dayOfWeek  field
+	// Duration is how long the window lasts from the start of each
+	// occurrence
+	Duration time.Duration
+	spec     string
+}
+
+// ParseWindow parses a window from five cron fields, minute, hour, day of
+// month, month and day of week, followed by the duration of the window,
+// e.g. '0 2 * * 0 3h' for Sundays from 2am to 5am. Fields are '*', numbers,
+// ranges and lists, optionally with steps, as in crontab.
+func ParseWindow(spec string) (Window, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(fieldBounds)+1 {
+		return Window{}, errors.Errorf("invalid maintenance window %q, expected 5 cron fields and a duration", spec)
+	}
+	fields := make([]field, len(fieldBounds))
+	for i, bounds := range fieldBounds {
+		f, err := parseField(parts[i], bounds.min, bounds.max)
+		if err != nil {
+			return Window{}, errors.Wrapf(err, "invalid %s in maintenance window %q", bounds.name, spec)
+		}
+		fields[i] = f
+	}
+	duration, err := time.ParseDuration(parts[len(fieldBounds)])
+	if err != nil {
+		return Window{}, errors.Wrapf(err, "invalid duration in maintenance window %q", spec)
+	}
+	if duration < time.Minute || duration > maxWindowDuration {
+		return Window{}, errors.Errorf("duration of maintenance window %q must be between 1m and %s", spec, maxWindowDuration)
+	}
+	// Sunday is both 0 and 7
+	if fields[4].matches(7) {
+		fields[4].values |= 1
+	}
+	return Window{
+		minute:     fields[0],
+		hour:       fields[1],
+		dayOfMonth: fields[2],
+		month:      fields[3],
+		dayOfWeek:  fields[4],
+		Duration:   duration,
+		spec:       spec,
+	}, nil
+}
+
+func parseField(spec string, min, max int) (field, error) {
+	var f field
+	for _, item := range strings.Split(spec, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step < 1 {
+				return field{}, errors.Errorf("invalid step in %q", item)
+			}
+			item = item[:i]
+		}
+		low, high := min, max
+		switch {
+		case item == "*":
+			f.any = step == 1
+		case strings.Contains(item, "-"):
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return field{}, errors.Errorf("invalid range %q", item)
+			}
+			if high, err = strconv.Atoi(bounds[1]); err != nil {
+				return field{}, errors.Errorf("invalid range %q", item)
+			}
+		default:
+			value, err := strconv.Atoi(item)
+			if err != nil {
+				return field{}, errors.Errorf("invalid value %q", item)
+			}
+			low, high = value, value
+		}
+		if low < min || high > max || low > high {
+			return field{}, errors.Errorf("%q is out of range %d-%d", item, min, max)
+		}
+		for value := low; value <= high; value += step {
+			f.values |= 1 << uint(value)
+		}
+	}
+	return f, nil
+}
+
+// startsAt returns if an occurrence of the window starts at the minute of t
+func (w Window) startsAt(t time.Time) bool {
+	if !w.minute.matches(t.Minute()) || !w.hour.matches(t.Hour()) || !w.month.matches(int(t.Month())) {
+		return false
+	}
+	dayOfMonth := w.dayOfMonth.matches(t.Day())
+	dayOfWeek := w.dayOfWeek.matches(int(t.Weekday()))
+	// as in cron, a day matches either restricted day field
+	switch {
+	case w.dayOfMonth.any && w.dayOfWeek.any:
+		return true
+	case w.dayOfMonth.any:
+		return dayOfWeek
+	case w.dayOfWeek.any:
+		return dayOfMonth
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// current returns the start of the occurrence of the window that covers t
+func (w Window) current(t time.Time) (time.Time, bool) {
+	minute := t.Truncate(time.Minute)
+	for start := minute; t.Sub(start) < w.Duration; start = start.Add(-time.Minute) {
+		if w.startsAt(start) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (w Window) String() string {
+	return w.spec
+}
+
+// Schedule is a set of maintenance windows. An empty schedule allows
+// disruptive actions at any time.
+type Schedule []Window
+
+// ParseSchedule parses windows separated by semicolons, see ParseWindow
+func ParseSchedule(spec string) (Schedule, error) {
+	var schedule Schedule
+	for _, windowSpec := range strings.Split(spec, ";") {
+		if strings.TrimSpace(windowSpec) == "" {
+			continue
+		}
+		window, err := ParseWindow(windowSpec)
+		if err != nil {
+			return nil, err
+		}
+		schedule = append(schedule, window)
+	}
+	return schedule, nil
+}
+
+// Current returns the start and end of the window occurrence covering t
+// that ends last, if t is in a window
+func (s Schedule) Current(t time.Time) (time.Time, time.Time, bool) {
+	var start, end time.Time
+	found := false
+	for _, window := range s {
+		windowStart, ok := window.current(t)
+		if !ok {
+			continue
+		}
+		windowEnd := windowStart.Add(window.Duration)
+		if !found || windowEnd.After(end) {
+			start, end, found = windowStart, windowEnd, true
+		}
+	}
+	return start, end, found
+}
+
+// Next returns the start of the first window occurrence after t, if there
+// is one within a year
+func (s Schedule) Next(t time.Time) (time.Time, bool) {
+	if len(s) == 0 {
+		return time.Time{}, false
+	}
+	horizon := t.Add(nextWindowHorizon)
+	for start := t.Truncate(time.Minute).Add(time.Minute); start.Before(horizon); start = start.Add(time.Minute) {
+		for _, window := range s {
+			if window.startsAt(start) {
+				return start, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Open returns if disruptive actions are allowed at t
+func (s Schedule) Open(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+	_, _, ok := s.Current(t)
+	return ok
+}
+
+// OpenFor returns if the host identified by key may act at t when at most
+// percent of the hosts sharing the schedule should act at once. Each window
+// occurrence is split into as many slots as it takes for each to hold
+// percent of the hosts, and each host is assigned a slot by its key, so
+// that hosts are staggered without coordinating with each other.
+func (s Schedule) OpenFor(t time.Time, key string, percent int) bool {
+	if len(s) == 0 {
+		return true
+	}
+	start, end, ok := s.Current(t)
+	if !ok {
+		return false
+	}
+	if percent <= 0 || percent >= 100 {
+		return true
+	}
+	slots := (100 + percent - 1) / percent
+	slotStart := start.Add(end.Sub(start) * time.Duration(slot(key, slots)) / time.Duration(slots))
+	return !t.Before(slotStart)
+}
+
+// slot assigns key to one of slots
+func slot(key string, slots int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(slots))
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package maintenance
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(day, hour, minute int) time.Time {
+	// 2020-03-01 is a Sunday
+	return time.Date(2020, time.March, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseWindowInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"0 2 * * 0",
+		"0 2 * * 0 3h extra",
+		"60 2 * * 0 3h",
+		"0 24 * * 0 3h",
+		"0 2 0 * * 3h",
+		"0 2 * 13 * 3h",
+		"0 2 * * 8 3h",
+		"0 5-2 * * * 3h",
+		"0 */0 * * * 3h",
+		"0 two * * * 3h",
+		"0 2 * * 0 forever",
+		"0 2 * * 0 30s",
+		"0 2 * * 0 200h",
+	} {
+		_, err := ParseWindow(spec)
+		assert.Error(t, err, "Expect %q to be invalid", spec)
+	}
+}
+
+func TestScheduleOpen(t *testing.T) {
+	schedule, err := ParseSchedule("0 2 * * 0 3h; 30 22 15 * * 1h")
+	require.NoError(t, err)
+
+	cases := []struct {
+		time time.Time
+		open bool
+	}{
+		{date(1, 1, 59), false},
+		{date(1, 2, 0), true},
+		{date(1, 4, 59), true},
+		{date(1, 5, 0), false},
+		// Monday
+		{date(2, 3, 0), false},
+		{date(8, 2, 30), true},
+		{date(15, 22, 29), false},
+		{date(15, 23, 29), true},
+		{date(15, 23, 30), false},
+	}
+	for _, test := range cases {
+		assert.Equal(t, test.open, schedule.Open(test.time), "Unexpected window state at %s", test.time)
+	}
+}
+
+func TestScheduleOpenAcrossMidnight(t *testing.T) {
+	schedule, err := ParseSchedule("0 23 * * 6 2h")
+	require.NoError(t, err)
+
+	// Saturday 2020-02-29 at 23:00 until Sunday at 01:00
+	assert.True(t, schedule.Open(date(1, 0, 30)))
+	assert.False(t, schedule.Open(date(1, 1, 0)))
+}
+
+func TestScheduleDaysMatchEither(t *testing.T) {
+	schedule, err := ParseSchedule("0 2 1 * 3 1h")
+	require.NoError(t, err)
+
+	// the 1st is a Sunday and the 4th a Wednesday
+	assert.True(t, schedule.Open(date(1, 2, 0)))
+	assert.True(t, schedule.Open(date(4, 2, 0)))
+	assert.False(t, schedule.Open(date(5, 2, 0)))
+}
+
+func TestScheduleSundayAsSeven(t *testing.T) {
+	schedule, err := ParseSchedule("0 2 * * 7 1h")
+	require.NoError(t, err)
+	assert.True(t, schedule.Open(date(1, 2, 0)))
+}
+
+func TestScheduleListsRangesAndSteps(t *testing.T) {
+	schedule, err := ParseSchedule("*/15 1-3,5 * * 1-5 5m")
+	require.NoError(t, err)
+
+	assert.True(t, schedule.Open(date(2, 1, 15)))
+	assert.True(t, schedule.Open(date(2, 5, 49)))
+	assert.False(t, schedule.Open(date(2, 5, 50)))
+	assert.False(t, schedule.Open(date(2, 4, 0)))
+	assert.False(t, schedule.Open(date(1, 1, 15)), "Expect no window on Sundays")
+}
+
+func TestEmptyScheduleIsAlwaysOpen(t *testing.T) {
+	schedule, err := ParseSchedule(" ; ")
+	require.NoError(t, err)
+	assert.Empty(t, schedule)
+	assert.True(t, schedule.Open(date(1, 12, 0)))
+	assert.True(t, schedule.OpenFor(date(1, 12, 0), "host", 10))
+	_, ok := schedule.Next(date(1, 12, 0))
+	assert.False(t, ok)
+}
+
+func TestScheduleCurrentPrefersLongestWindow(t *testing.T) {
+	schedule, err := ParseSchedule("0 2 * * * 1h; 30 1 * * 0 4h")
+	require.NoError(t, err)
+
+	start, end, ok := schedule.Current(date(1, 2, 15))
+	require.True(t, ok)
+	assert.Equal(t, date(1, 1, 30), start)
+	assert.Equal(t, date(1, 5, 30), end)
+}
+
+func TestScheduleNext(t *testing.T) {
+	schedule, err := ParseSchedule("0 2 * * 0 3h")
+	require.NoError(t, err)
+
+	next, ok := schedule.Next(date(1, 3, 0))
+	require.True(t, ok)
+	assert.Equal(t, date(8, 2, 0), next)
+}
+
+func TestScheduleOpenForStaggersHosts(t *testing.T) {
+	schedule, err := ParseSchedule("0 0 * * 0 4h")
+	require.NoError(t, err)
+
+	slots := make(map[int]int)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("ip-10-0-0-%d", i)
+		// a quarter of the hosts per hour of the window
+		for hour := 0; hour < 4; hour++ {
+			if schedule.OpenFor(date(1, hour, 59), key, 25) {
+				slots[hour]++
+				break
+			}
+		}
+		assert.True(t, schedule.OpenFor(date(1, 3, 59), key, 25), "Expect %s to act in the window", key)
+		assert.False(t, schedule.OpenFor(date(1, 4, 0), key, 25), "Expect %s not to act after the window", key)
+	}
+	assert.Len(t, slots, 4, "Expect hosts to be spread over the window")
+	assert.True(t, schedule.OpenFor(date(1, 0, 0), "any", 100))
+}
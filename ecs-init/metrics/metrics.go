@@ -0,0 +1,233 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package metrics keeps the counters and gauges of ecs-init and writes them
+// in the Prometheus text exposition format, so that scrapers such as the
+// node exporter can monitor the bootstrap of the Agent. The metrics count
+// from the start of the ecs-init process serving them.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// AgentDownloads counts the attempts to download the Agent
+	AgentDownloads = NewCounter("ecs_init_agent_downloads_total",
+		"Attempts to download the Agent.")
+	// AgentDownloadFailures counts the attempts to download the Agent that
+	// failed, after retries
+	AgentDownloadFailures = NewCounter("ecs_init_agent_download_failures_total",
+		"Attempts to download the Agent that failed.")
+	// DownloadedBytes counts the bytes of the Agent and of the files
+	// published next to it that were downloaded
+	DownloadedBytes = NewCounter("ecs_init_downloaded_bytes_total",
+		"Bytes of the Agent and its published files downloaded.")
+	// AgentRestarts counts the restarts of the supervised Agent
+	AgentRestarts = NewCounter("ecs_init_agent_restarts_total",
+		"Restarts of the supervised Agent.")
+	// SupervisionState is 1 for the state the Agent is supervised in and 0
+	// for the states it was in before
+	SupervisionState = NewStateGauge("ecs_init_supervision_state",
+		"State of the supervised Agent.", "state")
+	// AgentReadySeconds is how long the Agent took to become healthy once
+	// supervised
+	AgentReadySeconds = NewGauge("ecs_init_agent_ready_seconds",
+		"Seconds from the start of supervision until the Agent was first healthy.")
+	// LogBytes is the size of the logs of ecs-init and of the Agent
+	// container
+	LogBytes = NewGauge("ecs_init_log_bytes",
+		"Bytes taken by the logs of ecs-init and of the Agent.")
+	// LogVolumeUsage is the fraction of the volume holding the logs in use
+	LogVolumeUsage = NewGauge("ecs_init_log_volume_usage_ratio",
+		"Fraction of the volume holding the logs in use.")
+	// LogVolumeAlerts counts the times the usage of the volume holding the
+	// logs crossed its threshold
+	LogVolumeAlerts = NewCounter("ecs_init_log_volume_alerts_total",
+		"Times the volume holding the logs was used beyond its threshold.")
+	// LogFilesRemoved counts the rotated logs removed to trim the logs
+	LogFilesRemoved = NewCounter("ecs_init_log_files_removed_total",
+		"Rotated logs removed to keep the logs under their maximum size.")
+)
+
+// metric is a metric written by the registry
+type metric interface {
+	// write writes the samples of the metric
+	write(w io.Writer)
+}
+
+var (
+	registryLock sync.Mutex
+	registry     []metric
+)
+
+// register adds m to the metrics written by Write
+func register(m metric) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry = append(registry, m)
+}
+
+// Write writes the metrics in the Prometheus text exposition format
+func Write(w io.Writer) error {
+	registryLock.Lock()
+	metrics := append([]metric(nil), registry...)
+	registryLock.Unlock()
+	buffered := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(buffered)
+	}
+	return buffered.Flush()
+}
+
+// writeHeader writes the help and type lines of a metric
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// formatValue formats a sample value like Prometheus clients do
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Counter is a metric that only goes up
+type Counter struct {
+	name  string
+	help  string
+	value uint64
+}
+
+// NewCounter creates and registers a counter
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds n to the counter
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+// Value returns the count
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.Value())
+}
+
+// Gauge is a metric that is set to its current value
+type Gauge struct {
+	name string
+	help string
+	bits uint64
+}
+
+// NewGauge creates and registers a gauge
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	register(g)
+	return g
+}
+
+// Set sets the gauge to value
+func (g *Gauge) Set(value float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(value))
+}
+
+// Value returns the value of the gauge
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.Value()))
+}
+
+// StateGauge is a gauge labeled with states, which is 1 for the current
+// state and 0 for the states set before it
+type StateGauge struct {
+	name    string
+	help    string
+	label   string
+	lock    sync.Mutex
+	states  map[string]bool
+	current string
+}
+
+// NewStateGauge creates and registers a state gauge, labeling the states
+// with label
+func NewStateGauge(name, help, label string) *StateGauge {
+	g := &StateGauge{name: name, help: help, label: label, states: make(map[string]bool)}
+	register(g)
+	return g
+}
+
+// Set makes state the current state
+func (g *StateGauge) Set(state string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.states[state] = true
+	g.current = state
+}
+
+// Current returns the current state, or an empty string if none was set
+func (g *StateGauge) Current() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.current
+}
+
+func (g *StateGauge) write(w io.Writer) {
+	g.lock.Lock()
+	states := make([]string, 0, len(g.states))
+	for state := range g.states {
+		states = append(states, state)
+	}
+	current := g.current
+	g.lock.Unlock()
+	sort.Strings(states)
+
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, state := range states {
+		value := 0
+		if state == current {
+			value = 1
+		}
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", g.name, g.label, state, value)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounter(t *testing.T) {
+	counter := &Counter{name: "test_total", help: "Test counter."}
+	counter.Inc()
+	counter.Add(41)
+	var buf bytes.Buffer
+	counter.write(&buf)
+	assert.Equal(t, "# HELP test_total Test counter.\n# TYPE test_total counter\ntest_total 42\n", buf.String())
+}
+
+func TestGauge(t *testing.T) {
+	gauge := &Gauge{name: "test_seconds", help: "Test gauge."}
+	gauge.Set(1.5)
+	var buf bytes.Buffer
+	gauge.write(&buf)
+	assert.Equal(t, "# HELP test_seconds Test gauge.\n# TYPE test_seconds gauge\ntest_seconds 1.5\n", buf.String())
+	assert.Equal(t, "+Inf", formatValue(math.Inf(1)))
+	assert.Equal(t, "NaN", formatValue(math.NaN()))
+}
+
+func TestStateGauge(t *testing.T) {
+	gauge := &StateGauge{name: "test_state", help: "Test state.", label: "state", states: make(map[string]bool)}
+	var buf bytes.Buffer
+	gauge.write(&buf)
+	assert.Equal(t, "# HELP test_state Test state.\n# TYPE test_state gauge\n", buf.String(),
+		"Expect no samples before a state is set")
+
+	gauge.Set("Starting")
+	gauge.Set("Healthy")
+	buf.Reset()
+	gauge.write(&buf)
+	assert.Equal(t, "# HELP test_state Test state.\n# TYPE test_state gauge\n"+
+		"test_state{state=\"Healthy\"} 1\ntest_state{state=\"Starting\"} 0\n", buf.String())
+	assert.Equal(t, "Healthy", gauge.Current())
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf))
+	for _, name := range []string{
+		"ecs_init_agent_downloads_total",
+		"ecs_init_agent_download_failures_total",
+		"ecs_init_downloaded_bytes_total",
+		"ecs_init_agent_restarts_total",
+		"ecs_init_supervision_state",
+		"ecs_init_agent_ready_seconds",
+	} {
+		assert.True(t, strings.Contains(buf.String(), "# TYPE "+name+" "), "Expect metric %s to be written", name)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Path is the path the metrics are served on
+	Path = "/metrics"
+	// contentType is the content type of the text exposition format
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+	// shutdownTimeout bounds how long scrapes in flight are waited for once
+	// the server is stopped
+	shutdownTimeout = 5 * time.Second
+)
+
+// Server serves the metrics over HTTP
+type Server struct {
+	addr     string
+	listener net.Listener
+	server   *http.Server
+	done     chan struct{}
+}
+
+// NewServer creates a Server listening on addr
+func NewServer(addr string) *Server {
+	return &Server{addr: addr}
+}
+
+// Start listens on the address and serves scrapes until Stop is called
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return errors.Wrapf(err, "could not listen on %s", s.addr)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(Path, Handler())
+	s.listener = listener
+	s.server = &http.Server{Handler: mux}
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		err := s.server.Serve(listener)
+		if err != http.ErrServerClosed {
+			log.Errorf("Metrics endpoint stopped serving: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on once started
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Stop stops serving
+func (s *Server) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	<-s.done
+	return err
+}
+
+// Handler returns the handler writing the metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "metrics are read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		err := Write(w)
+		if err != nil {
+			log.Debugf("Could not write metrics: %v", err)
+		}
+	})
+}
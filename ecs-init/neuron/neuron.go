@@ -0,0 +1,65 @@
+// Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package neuron detects the AWS Neuron devices of Inferentia and Trainium
+// instances, so that they can be mapped into the Agent container
+package neuron
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DeviceFilePattern is the pattern of Neuron device files on the instance
+	DeviceFilePattern = "/dev/neuron*"
+	// RuntimeSocketPath is the unix socket the Neuron runtime daemon listens
+	// on, when it is installed
+	RuntimeSocketPath = "/run/neuron.sock"
+)
+
+// ErrNoDeviceFound is returned when the instance has no Neuron devices
+var ErrNoDeviceFound = errors.New("no Neuron device files found on the instance")
+
+// Devices returns the Neuron device files of the instance, such as
+// /dev/neuron0, or ErrNoDeviceFound if there are none
+func Devices() ([]string, error) {
+	return devices(DeviceFilePattern)
+}
+
+func devices(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not detect the Neuron devices")
+	}
+	var devices []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			continue
+		}
+		devices = append(devices, match)
+	}
+	if len(devices) == 0 {
+		return nil, ErrNoDeviceFound
+	}
+	return devices, nil
+}
+
+// RuntimeSocketPresent returns whether the Neuron runtime daemon socket
+// exists on the instance
+func RuntimeSocketPresent() bool {
+	_, err := os.Stat(RuntimeSocketPath)
+	return err == nil
+}
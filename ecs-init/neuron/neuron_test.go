@@ -0,0 +1,43 @@
+// Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package neuron
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevices(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"neuron0", "neuron1"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "neuron-tools"), 0700))
+
+	found, err := devices(filepath.Join(dir, "neuron*"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "neuron0"), filepath.Join(dir, "neuron1")}, found)
+}
+
+func TestDevicesNotFound(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := devices(filepath.Join(dir, "neuron*"))
+	assert.Equal(t, ErrNoDeviceFound, err)
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package ports finds the processes listening on host ports reserved for the
+// Agent
+package ports
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// tcpListen is the state of listening sockets in /proc/net/tcp
+	tcpListen = "0A"
+	// unknownPID is reported when the process listening on a port cannot
+	// be found, such as when it belongs to another PID namespace
+	unknownPID = -1
+)
+
+// Conflict is a reserved port that a process already listens on
+type Conflict struct {
+	Port    uint16
+	PID     int
+	Command string
+}
+
+func (c Conflict) String() string {
+	if c.PID == unknownPID {
+		return fmt.Sprintf("port %d is in use by an unknown process", c.Port)
+	}
+	return fmt.Sprintf("port %d is in use by %s (pid %d)", c.Port, c.Command, c.PID)
+}
+
+// Checker reads the sockets and processes of the host from procfs
+type Checker struct {
+	procDir string
+}
+
+// NewChecker creates a new Checker object
+func NewChecker() *Checker {
+	return &Checker{
+		procDir: config.ProcFS,
+	}
+}
+
+// ParsePorts parses a comma separated list of ports
+func ParsePorts(value string) ([]uint16, error) {
+	var ports []uint16
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		port, err := strconv.ParseUint(field, 10, 16)
+		if err != nil || port == 0 {
+			return nil, errors.Errorf("invalid port %q", field)
+		}
+		ports = append(ports, uint16(port))
+	}
+	return ports, nil
+}
+
+// Check returns the ports of reserved that a process listens on over TCP
+func (c *Checker) Check(reserved []uint16) ([]Conflict, error) {
+	listening := make(map[uint16]string)
+	for _, table := range []string{"net/tcp", "net/tcp6"} {
+		err := c.readListeningSockets(filepath.Join(c.procDir, table), listening)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var conflicts []Conflict
+	var owners map[string]int
+	for _, port := range reserved {
+		inode, ok := listening[port]
+		if !ok {
+			continue
+		}
+		if owners == nil {
+			owners = c.socketOwners()
+		}
+		conflict := Conflict{Port: port, PID: unknownPID}
+		if pid, ok := owners[inode]; ok {
+			conflict.PID = pid
+			conflict.Command = c.command(pid)
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts, nil
+}
+
+// readListeningSockets records the inode of the sockets listening in table
+// by port
+func (c *Checker) readListeningSockets(table string, listening map[uint16]string) error {
+	file, err := os.Open(table)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// IPv6 is disabled
+			return nil
+		}
+		return errors.Wrapf(err, "could not read %s", table)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	// skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		address := strings.Split(fields[1], ":")
+		port, err := strconv.ParseUint(address[len(address)-1], 16, 16)
+		if err != nil {
+			continue
+		}
+		listening[uint16(port)] = fields[9]
+	}
+	return scanner.Err()
+}
+
+// socketOwners returns the PID of the processes holding each socket inode
+func (c *Checker) socketOwners() map[string]int {
+	owners := make(map[string]int)
+	fdDirs, _ := filepath.Glob(filepath.Join(c.procDir, "[0-9]*", "fd"))
+	for _, fdDir := range fdDirs {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(fdDir)))
+		if err != nil {
+			continue
+		}
+		fds, err := ioutil.ReadDir(fdDir)
+		if err != nil {
+			// the process exited or is not ours to inspect
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			owners[strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")] = pid
+		}
+	}
+	return owners
+}
+
+func (c *Checker) command(pid int) string {
+	comm, err := ioutil.ReadFile(filepath.Join(c.procDir, strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(comm))
+}
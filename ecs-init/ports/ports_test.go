@@ -0,0 +1,95 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ports
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 51678 (0xC9DE) is listened on by inode 1001 owned by pid 42, 51679
+// (0xC9DF) is connected but not listened on, and 51680 (0xC9E0) is listened
+// on over IPv6 by an inode no process is known to hold
+const (
+	procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:C9DE 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:C9DF 0100007F:D431 01 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 20 4 30 10 -1
+`
+	procNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:C9E0 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1003 1 0000000000000000 100 0 0 10 0
+`
+)
+
+func newTestProcDir(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "net"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "net", "tcp"), []byte(procNetTCP), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "net", "tcp6"), []byte(procNetTCP6), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "42", "fd"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "42", "comm"), []byte("nginx\n"), 0644))
+	require.NoError(t, os.Symlink("socket:[1001]", filepath.Join(dir, "42", "fd", "3")))
+	require.NoError(t, os.Symlink("/dev/null", filepath.Join(dir, "42", "fd", "0")))
+	return dir
+}
+
+func TestCheck(t *testing.T) {
+	procDir := newTestProcDir(t)
+
+	checker := &Checker{procDir: procDir}
+	conflicts, err := checker.Check([]uint16{51678, 51679, 51680, 51681})
+	require.NoError(t, err)
+	assert.Equal(t, []Conflict{
+		{Port: 51678, PID: 42, Command: "nginx"},
+		{Port: 51680, PID: unknownPID},
+	}, conflicts)
+	assert.Equal(t, "port 51678 is in use by nginx (pid 42)", conflicts[0].String())
+	assert.Equal(t, "port 51680 is in use by an unknown process", conflicts[1].String())
+}
+
+func TestCheckNoConflicts(t *testing.T) {
+	procDir := newTestProcDir(t)
+
+	checker := &Checker{procDir: procDir}
+	conflicts, err := checker.Check([]uint16{51679})
+	require.NoError(t, err)
+	assert.Empty(t, conflicts)
+}
+
+func TestCheckNoIPv6(t *testing.T) {
+	procDir := newTestProcDir(t)
+	require.NoError(t, os.Remove(filepath.Join(procDir, "net", "tcp6")))
+
+	checker := &Checker{procDir: procDir}
+	conflicts, err := checker.Check([]uint16{51680})
+	require.NoError(t, err)
+	assert.Empty(t, conflicts)
+}
+
+func TestParsePorts(t *testing.T) {
+	ports, err := ParsePorts("51678, 51679,,51680")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{51678, 51679, 51680}, ports)
+
+	_, err = ParsePorts("51678,http")
+	assert.Error(t, err)
+	_, err = ParsePorts("70000")
+	assert.Error(t, err)
+	_, err = ParsePorts("0")
+	assert.Error(t, err)
+}
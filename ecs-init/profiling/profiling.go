@@ -0,0 +1,133 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package profiling provides optional CPU and heap profiling of ecs-init
+// actions, used to diagnose the time it takes to bootstrap the ECS Agent.
+package profiling
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	profileFilePerm = 0600
+	profileDirPerm  = 0700
+)
+
+// Profiler records a CPU profile while an action runs and a heap profile
+// when the action completes
+type Profiler struct {
+	cpuFile  *os.File
+	heapPath string
+}
+
+// Start starts CPU profiling of action, writing the profiles into dir
+func Start(dir, action string) (*Profiler, error) {
+	err := os.MkdirAll(dir, os.ModeDir|profileDirPerm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create profile directory %s", dir)
+	}
+	prefix := filepath.Join(dir, fmt.Sprintf("ecs-init-%s-%d", action, time.Now().Unix()))
+	cpuFile, err := os.OpenFile(prefix+".cpu.pprof", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, profileFilePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create cpu profile")
+	}
+	err = runtimepprof.StartCPUProfile(cpuFile)
+	if err != nil {
+		cpuFile.Close()
+		return nil, errors.Wrap(err, "could not start cpu profile")
+	}
+	log.Infof("Writing cpu profile to %s", cpuFile.Name())
+	return &Profiler{
+		cpuFile:  cpuFile,
+		heapPath: prefix + ".heap.pprof",
+	}, nil
+}
+
+// Stop stops CPU profiling and writes the heap profile
+func (p *Profiler) Stop() error {
+	runtimepprof.StopCPUProfile()
+	err := p.cpuFile.Close()
+	if err != nil {
+		return errors.Wrap(err, "could not write cpu profile")
+	}
+
+	heapFile, err := os.OpenFile(p.heapPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, profileFilePerm)
+	if err != nil {
+		return errors.Wrap(err, "could not create heap profile")
+	}
+	defer heapFile.Close()
+	// collect garbage to get up-to-date statistics of live objects
+	runtime.GC()
+	err = runtimepprof.WriteHeapProfile(heapFile)
+	if err != nil {
+		return errors.Wrap(err, "could not write heap profile")
+	}
+	log.Infof("Wrote heap profile to %s", p.heapPath)
+	return nil
+}
+
+// ServeDebug serves the pprof endpoints on addr in the background. Only
+// loopback addresses are accepted as the endpoints are unauthenticated.
+func ServeDebug(addr string) error {
+	err := validateLoopback(addr)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "could not listen on %s", addr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	log.Infof("Serving pprof endpoints on http://%s/debug/pprof/", listener.Addr())
+	go func() {
+		err := http.Serve(listener, mux)
+		if err != nil {
+			log.Warnf("pprof endpoint stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+func validateLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return errors.Wrapf(err, "invalid pprof address %q", addr)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return errors.Errorf("pprof address %q is not a loopback address", addr)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package profiling
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLoopback(t *testing.T) {
+	testcases := []struct {
+		addr        string
+		shouldError bool
+	}{
+		{addr: "127.0.0.1:6060"},
+		{addr: "[::1]:6060"},
+		{addr: "localhost:6060"},
+		{addr: "0.0.0.0:6060", shouldError: true},
+		{addr: "10.0.0.1:6060", shouldError: true},
+		{addr: ":6060", shouldError: true},
+		{addr: "127.0.0.1", shouldError: true},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.addr, func(t *testing.T) {
+			err := validateLoopback(test.addr)
+			if test.shouldError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	dir := t.TempDir()
+
+	profiler, err := Start(dir, "pre-start")
+	require.NoError(t, err)
+	require.NoError(t, profiler.Stop())
+
+	cpuProfiles, _ := filepath.Glob(filepath.Join(dir, "ecs-init-pre-start-*.cpu.pprof"))
+	heapProfiles, _ := filepath.Glob(filepath.Join(dir, "ecs-init-pre-start-*.heap.pprof"))
+	assert.Len(t, cpuProfiles, 1, "Expect a cpu profile to be written")
+	assert.Len(t, heapProfiles, 1, "Expect a heap profile to be written")
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package sdnotify notifies systemd of the state of the service ecs-init runs
+// as, following the sd_notify protocol
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Ready tells systemd that the service finished starting up
+	Ready = "READY=1"
+	// Stopping tells systemd that the service is stopping
+	Stopping = "STOPPING=1"
+	// Watchdog tells systemd that the service is alive
+	Watchdog = "WATCHDOG=1"
+
+	extendTimeoutPrefix = "EXTEND_TIMEOUT_USEC="
+
+	notifySocketEnvVar = "NOTIFY_SOCKET"
+	watchdogUsecEnvVar = "WATCHDOG_USEC"
+	watchdogPIDEnvVar  = "WATCHDOG_PID"
+)
+
+// Notifier sends notifications to the socket systemd passes to services of
+// Type=notify. Notifications are dropped when ecs-init is not run by systemd.
+type Notifier struct {
+	socket           string
+	watchdogInterval time.Duration
+}
+
+// NewNotifier creates a Notifier for the socket and watchdog set by systemd
+// in the environment
+func NewNotifier() *Notifier {
+	return &Notifier{
+		socket:           os.Getenv(notifySocketEnvVar),
+		watchdogInterval: watchdogInterval(),
+	}
+}
+
+// Notify sends state, such as Ready, to systemd
+func (n *Notifier) Notify(state string) error {
+	if n.socket == "" {
+		return nil
+	}
+	// a leading @ names an abstract socket, which net translates
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: n.socket, Net: "unixgram"})
+	if err != nil {
+		return errors.Wrap(err, "could not connect to the systemd notification socket")
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return errors.Wrapf(err, "could not notify systemd of %s", state)
+	}
+	return nil
+}
+
+// ExtendTimeout tells systemd, from version 236 on, that the service needs
+// up to timeout from now to finish its current step, such as starting up,
+// even when that goes past the timeout of the step set in the unit
+func ExtendTimeout(timeout time.Duration) string {
+	return extendTimeoutPrefix + strconv.FormatInt(int64(timeout/time.Microsecond), 10)
+}
+
+// WatchdogInterval returns the watchdog timeout set with WatchdogSec, within
+// which systemd has to be sent Watchdog, or zero when there is no watchdog
+func (n *Notifier) WatchdogInterval() time.Duration {
+	return n.watchdogInterval
+}
+
+// watchdogInterval reads the watchdog timeout systemd sets for the main
+// process of the service
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv(watchdogUsecEnvVar), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv(watchdogPIDEnvVar); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		// the watchdog is meant for another process of the service
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotify(t *testing.T) {
+	dir := t.TempDir()
+
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	os.Setenv(notifySocketEnvVar, socket)
+	defer os.Unsetenv(notifySocketEnvVar)
+	assert.NoError(t, NewNotifier().Notify(Ready))
+
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, Ready, string(buf[:n]))
+}
+
+func TestNotifyWithoutSystemd(t *testing.T) {
+	os.Unsetenv(notifySocketEnvVar)
+	assert.NoError(t, NewNotifier().Notify(Ready))
+}
+
+func TestExtendTimeout(t *testing.T) {
+	assert.Equal(t, "EXTEND_TIMEOUT_USEC=600000000", ExtendTimeout(10*time.Minute))
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv(watchdogUsecEnvVar)
+	defer os.Unsetenv(watchdogPIDEnvVar)
+
+	os.Unsetenv(watchdogUsecEnvVar)
+	assert.Equal(t, time.Duration(0), NewNotifier().WatchdogInterval())
+
+	os.Setenv(watchdogUsecEnvVar, "30000000")
+	assert.Equal(t, 30*time.Second, NewNotifier().WatchdogInterval())
+
+	os.Setenv(watchdogPIDEnvVar, strconv.Itoa(os.Getpid()))
+	assert.Equal(t, 30*time.Second, NewNotifier().WatchdogInterval())
+
+	os.Setenv(watchdogPIDEnvVar, strconv.Itoa(os.Getpid()+1))
+	assert.Equal(t, time.Duration(0), NewNotifier().WatchdogInterval(), "Expect the watchdog of another process to be ignored")
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package selftest exercises the download, load, start and stop cycle of the
+// ECS Agent on a real host, against a disposable Docker daemon and a mock of
+// the EC2 Instance Metadata Service and of the S3 bucket of the Agent. It is
+// meant for qualifying new OS versions, not for instances serving tasks.
+package selftest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+	"github.com/aws/amazon-ecs-init/ecs-init/engine"
+	"github.com/aws/amazon-ecs-init/ecs-init/singleton"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// mockRegion is the region of the instance reported by the mock EC2
+	// Instance Metadata Service
+	mockRegion = "us-west-2"
+	// mockBucket is the bucket the Agent is downloaded from
+	mockBucket = "ecs-init-selftest"
+)
+
+// Options configure the self-test
+type Options struct {
+	// AgentTarball is an Agent image tarball published with its checksum and
+	// signature files, named after it with the .md5 and .asc extensions
+	AgentTarball string
+	// DockerHost is the unix socket of the disposable Docker daemon, e.g. of
+	// a Docker-in-Docker container
+	DockerHost string
+	// StartTimeout is how long the Agent has to be running once started
+	StartTimeout time.Duration
+}
+
+// Run runs the self-test. The Agent is cached and its state recorded in the
+// usual directories of the host, so no other ecs-init instance may run. The
+// self-test stops once ctx is done.
+func Run(ctx context.Context, options Options) error {
+	if !strings.HasPrefix(options.DockerHost, config.UnixSocketPrefix) {
+		return errors.Errorf("the Docker daemon must be given as %s/path/to/docker.sock, got %q",
+			config.UnixSocketPrefix, options.DockerHost)
+	}
+	artifacts, err := readAgentArtifacts(options.AgentTarball)
+	if err != nil {
+		return err
+	}
+	lock, err := singleton.Acquire(config.SupervisorLockFile())
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	server := newMockServer(mockRegion, mockBucket, artifacts)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	log.Infof("Self-test: serving the Agent and instance metadata at %s", httpServer.URL)
+	err = setEnvironment(options.DockerHost, httpServer.URL)
+	if err != nil {
+		return err
+	}
+
+	init, err := engine.New()
+	if err != nil {
+		return err
+	}
+	err = init.SelfTest(ctx, options.StartTimeout)
+	if flushErr := init.Flush(); flushErr != nil {
+		log.Warnf("Failed to persist state: %v", flushErr)
+	}
+	if err != nil {
+		return err
+	}
+	if server.requestCount(http.MethodGet, imdsIdentityDocumentPath) == 0 {
+		return errors.New("the region was not read from the mock instance metadata service")
+	}
+	log.Info("Self-test passed")
+	return nil
+}
+
+// readAgentArtifacts reads the tarball along with its checksum and signature
+func readAgentArtifacts(tarball string) (agentArtifacts, error) {
+	var artifacts agentArtifacts
+	if tarball == "" {
+		return artifacts, errors.New("no Agent tarball to test with")
+	}
+	files := []struct {
+		name string
+		data *[]byte
+	}{
+		{tarball, &artifacts.tarball},
+		{tarball + ".md5", &artifacts.checksum},
+		{tarball + ".asc", &artifacts.signature},
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file.name)
+		if err != nil {
+			return artifacts, errors.Wrap(err, "could not read published Agent file")
+		}
+		*file.data = data
+	}
+	return artifacts, nil
+}
+
+// setEnvironment points the engine at the disposable Docker daemon and at the
+// mock server, and clears the settings that would bypass the mock server
+func setEnvironment(dockerHost, serverURL string) error {
+	set := map[string]string{
+		config.DockerHostEnvVar:      dockerHost,
+		config.IMDSEndpointEnvVar:    serverURL,
+		config.S3EndpointEnvVar:      serverURL,
+		config.AgentBucketEnvVar:     mockBucket,
+		config.IMDSv2OnlyEnvVar:      "true",
+		config.StreamingLoadEnvVar:   "false",
+		config.S3AuthenticatedEnvVar: "false",
+	}
+	for name, value := range set {
+		err := os.Setenv(name, value)
+		if err != nil {
+			return errors.Wrapf(err, "could not set %s", name)
+		}
+	}
+	return os.Unsetenv(config.RegionOverrideEnvVar)
+}
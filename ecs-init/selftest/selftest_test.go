@@ -0,0 +1,55 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package selftest
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunRequiresUnixDockerHost(t *testing.T) {
+	for _, host := range []string{"", "tcp://127.0.0.1:2375"} {
+		err := Run(context.Background(), Options{AgentTarball: "agent.tar", DockerHost: host})
+		assert.Error(t, err, "Expect %q to be rejected", host)
+	}
+}
+
+func TestReadAgentArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	tarball := filepath.Join(dir, "agent.tar")
+	require.NoError(t, ioutil.WriteFile(tarball, []byte("tarball"), 0600))
+	require.NoError(t, ioutil.WriteFile(tarball+".md5", []byte("checksum"), 0600))
+
+	_, err := readAgentArtifacts(tarball)
+	assert.Error(t, err, "Expect the signature to be required")
+
+	require.NoError(t, ioutil.WriteFile(tarball+".asc", []byte("signature"), 0600))
+	artifacts, err := readAgentArtifacts(tarball)
+	require.NoError(t, err)
+	assert.Equal(t, agentArtifacts{
+		tarball:   []byte("tarball"),
+		checksum:  []byte("checksum"),
+		signature: []byte("signature"),
+	}, artifacts)
+}
+
+func TestReadAgentArtifactsNoTarball(t *testing.T) {
+	_, err := readAgentArtifacts("")
+	assert.Error(t, err)
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package selftest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	imdsTokenPath            = "/latest/api/token"
+	imdsIdentityDocumentPath = "/latest/dynamic/instance-identity/document"
+	imdsTokenHeader          = "X-aws-ec2-metadata-token"
+	mockIMDSToken            = "selftest-token"
+)
+
+// agentArtifacts are the published files of an Agent
+type agentArtifacts struct {
+	tarball   []byte
+	checksum  []byte
+	signature []byte
+}
+
+// mockServer serves the instance identity document from a mock EC2 Instance
+// Metadata Service and the Agent artifacts from a mock S3 bucket, answering
+// any object key by its extension so that the Agent version does not matter
+type mockServer struct {
+	region    string
+	bucket    string
+	artifacts agentArtifacts
+
+	lock     sync.Mutex
+	requests map[string]int
+}
+
+func newMockServer(region, bucket string, artifacts agentArtifacts) *mockServer {
+	return &mockServer{
+		region:    region,
+		bucket:    bucket,
+		artifacts: artifacts,
+		requests:  make(map[string]int),
+	}
+}
+
+func (s *mockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	s.requests[r.Method+" "+r.URL.Path]++
+	s.lock.Unlock()
+
+	switch r.URL.Path {
+	case imdsTokenPath:
+		s.serveIMDSToken(w, r)
+		return
+	case imdsIdentityDocumentPath:
+		s.serveIdentityDocument(w, r)
+		return
+	}
+	prefix := "/" + s.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+	var object []byte
+	switch {
+	case strings.HasSuffix(key, ".tar"):
+		object = s.artifacts.tarball
+	case strings.HasSuffix(key, ".tar.md5"):
+		object = s.artifacts.checksum
+	case strings.HasSuffix(key, ".tar.asc"):
+		object = s.artifacts.signature
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	// ServeContent answers the byte-range requests of resumed and
+	// concurrent downloads
+	http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(object))
+}
+
+func (s *mockServer) serveIMDSToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Write([]byte(mockIMDSToken))
+}
+
+func (s *mockServer) serveIdentityDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(imdsTokenHeader) != mockIMDSToken {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"region": s.region})
+}
+
+// requestCount returns how many requests were made for path with method
+func (s *mockServer) requestCount(method, path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests[method+" "+path]
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package selftest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer() (*mockServer, *httptest.Server) {
+	server := newMockServer("us-west-2", "bucket", agentArtifacts{
+		tarball:   []byte("tarball"),
+		checksum:  []byte("checksum"),
+		signature: []byte("signature"),
+	})
+	return server, httptest.NewServer(server)
+}
+
+func get(t *testing.T, url string, header http.Header) (int, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestMockServerIdentityDocument(t *testing.T) {
+	server, httpServer := newTestServer()
+	defer httpServer.Close()
+
+	status, _ := get(t, httpServer.URL+imdsIdentityDocumentPath, nil)
+	assert.Equal(t, http.StatusUnauthorized, status, "Expect a session token to be required")
+
+	req, err := http.NewRequest(http.MethodPut, httpServer.URL+imdsTokenPath, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	token, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	status, body := get(t, httpServer.URL+imdsIdentityDocumentPath, http.Header{imdsTokenHeader: {string(token)}})
+	require.Equal(t, http.StatusOK, status)
+	var document struct {
+		Region string `json:"region"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &document))
+	assert.Equal(t, "us-west-2", document.Region)
+	assert.Equal(t, 2, server.requestCount(http.MethodGet, imdsIdentityDocumentPath))
+}
+
+func TestMockServerAgentArtifacts(t *testing.T) {
+	_, httpServer := newTestServer()
+	defer httpServer.Close()
+
+	cases := []struct {
+		path     string
+		status   int
+		expected string
+	}{
+		{"/bucket/ecs-agent-v1.0.0.tar", http.StatusOK, "tarball"},
+		{"/bucket/ecs-agent-v1.0.0.tar.md5", http.StatusOK, "checksum"},
+		{"/bucket/ecs-agent-v1.0.0.tar.asc", http.StatusOK, "signature"},
+		{"/bucket/ecs-agent-v1.0.0.tar.sha256", http.StatusNotFound, ""},
+		{"/other-bucket/ecs-agent-v1.0.0.tar", http.StatusNotFound, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			status, body := get(t, httpServer.URL+c.path, nil)
+			assert.Equal(t, c.status, status)
+			if c.status == http.StatusOK {
+				assert.Equal(t, c.expected, body)
+			}
+		})
+	}
+}
+
+func TestMockServerByteRange(t *testing.T) {
+	_, httpServer := newTestServer()
+	defer httpServer.Close()
+
+	status, body := get(t, httpServer.URL+"/bucket/agent.tar", http.Header{"Range": {"bytes=3-"}})
+	assert.Equal(t, http.StatusPartialContent, status)
+	assert.Equal(t, "ball", body)
+}
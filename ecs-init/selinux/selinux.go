@@ -0,0 +1,60 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package selinux detects whether SELinux enforces its policy on the host, so
+// that the mounts of the Agent container can be labeled for it
+package selinux
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Mode is the SELinux mode of the host
+type Mode string
+
+const (
+	// Disabled is a host without SELinux
+	Disabled Mode = "disabled"
+	// Permissive is a host that logs the denials of the SELinux policy
+	// without enforcing them
+	Permissive Mode = "permissive"
+	// Enforcing is a host that enforces the SELinux policy
+	Enforcing Mode = "enforcing"
+)
+
+// enforceFile is the file of the selinuxfs that holds 1 when SELinux enforces
+// its policy and 0 when it is permissive
+var enforceFile = "/sys/fs/selinux/enforce"
+
+// CurrentMode returns the SELinux mode of the host, which is Disabled when the
+// selinuxfs is not mounted
+func CurrentMode() (Mode, error) {
+	data, err := ioutil.ReadFile(enforceFile)
+	if os.IsNotExist(err) {
+		return Disabled, nil
+	}
+	if err != nil {
+		return Disabled, errors.Wrap(err, "could not read the SELinux mode")
+	}
+	switch strings.TrimSpace(string(data)) {
+	case "1":
+		return Enforcing, nil
+	case "0":
+		return Permissive, nil
+	}
+	return Disabled, errors.Errorf("unexpected SELinux mode %q in %s", strings.TrimSpace(string(data)), enforceFile)
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package selinux
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrentMode(t *testing.T) {
+	dir := t.TempDir()
+	defer func(previous string) { enforceFile = previous }(enforceFile)
+	enforceFile = filepath.Join(dir, "enforce")
+
+	mode, err := CurrentMode()
+	assert.NoError(t, err)
+	assert.Equal(t, Disabled, mode, "Expect SELinux to be disabled without selinuxfs")
+
+	cases := []struct {
+		contents string
+		expected Mode
+		isErr    bool
+	}{
+		{"1", Enforcing, false},
+		{"0\n", Permissive, false},
+		{"2", Disabled, true},
+	}
+	for _, test := range cases {
+		require.NoError(t, ioutil.WriteFile(enforceFile, []byte(test.contents), 0644))
+		mode, err := CurrentMode()
+		assert.Equal(t, test.isErr, err != nil, "Unexpected error for %q: %v", test.contents, err)
+		assert.Equal(t, test.expected, mode)
+	}
+}
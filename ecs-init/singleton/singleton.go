@@ -0,0 +1,147 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package singleton ensures only one ecs-init instance supervises the ECS
+// Agent on a host at a time.
+package singleton
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+	pkgerrors "github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// ErrLocked is wrapped by errors returned when another ecs-init instance
+// already holds the supervisor lock
+var ErrLocked = errors.New("another ecs-init instance is already running")
+
+const (
+	lockFilePerm = 0644
+	lockDirPerm  = 0755
+
+	takeoverPollInterval = 100 * time.Millisecond
+)
+
+// Lock is an exclusive lock on a pidfile, held for as long as the file stays
+// open. The kernel releases it when the holding process exits, so a crashed
+// instance never leaves a stale lock behind.
+type Lock struct {
+	file *os.File
+}
+
+// Acquire locks path and records the pid of the current process in it
+func Acquire(path string) (*Lock, error) {
+	lock, pid, err := tryLock(path)
+	if err == ErrLocked {
+		return nil, lockedError(pid)
+	}
+	return lock, err
+}
+
+// Takeover acquires the lock on path, asking the instance holding it to stop
+// and waiting up to timeout for it to exit
+func Takeover(path string, timeout time.Duration) (*Lock, error) {
+	lock, pid, err := tryLock(path)
+	if err != ErrLocked {
+		return lock, err
+	}
+	if pid <= 0 {
+		return nil, fmt.Errorf("%w: could not read its pid from %s", ErrLocked, path)
+	}
+	log.Warnf("Taking over from ecs-init instance with pid %d", pid)
+	err = unix.Kill(pid, unix.SIGTERM)
+	if err != nil && err != unix.ESRCH {
+		return nil, pkgerrors.Wrapf(err, "could not stop ecs-init instance with pid %d", pid)
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(takeoverPollInterval)
+		lock, _, err = tryLock(path)
+		if err != ErrLocked {
+			return lock, err
+		}
+	}
+	return nil, fmt.Errorf("%w: pid %d did not stop within %s", ErrLocked, pid, timeout)
+}
+
+// Release unlocks the pidfile. The file itself is left in place as removing
+// it would let two instances lock different files at the same path.
+func (lock *Lock) Release() error {
+	return lock.file.Close()
+}
+
+// tryLock attempts to lock path without blocking. ErrLocked is returned
+// unwrapped along with the pid of the holder when the lock is taken.
+func tryLock(path string) (*Lock, int, error) {
+	err := os.MkdirAll(filepath.Dir(path), lockDirPerm)
+	if err != nil {
+		return nil, 0, pkgerrors.Wrapf(err, "could not create lock directory for %s", path)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, lockFilePerm)
+	if err != nil {
+		return nil, 0, pkgerrors.Wrapf(err, "could not open lock file %s", path)
+	}
+	err = unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if err == unix.EWOULDBLOCK {
+		pid := readPID(file)
+		file.Close()
+		return nil, pid, ErrLocked
+	}
+	if err != nil {
+		file.Close()
+		return nil, 0, pkgerrors.Wrapf(err, "could not lock %s", path)
+	}
+	err = writePID(file)
+	if err != nil {
+		file.Close()
+		return nil, 0, pkgerrors.Wrapf(err, "could not record pid in %s", path)
+	}
+	return &Lock{file: file}, 0, nil
+}
+
+func lockedError(pid int) error {
+	if pid <= 0 {
+		return ErrLocked
+	}
+	return fmt.Errorf("%w with pid %d", ErrLocked, pid)
+}
+
+func readPID(file *os.File) int {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+func writePID(file *os.File) error {
+	err := file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return err
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package singleton
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLockPath(t *testing.T) string {
+	dir := t.TempDir()
+	return filepath.Join(dir, "run", "ecs-init.pid")
+}
+
+func TestAcquireRecordsPID(t *testing.T) {
+	path := newTestLockPath(t)
+
+	lock, err := Acquire(path)
+	require.NoError(t, err)
+	defer lock.Release()
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(data))
+}
+
+func TestAcquireConflict(t *testing.T) {
+	path := newTestLockPath(t)
+
+	lock, err := Acquire(path)
+	require.NoError(t, err)
+
+	_, err = Acquire(path)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrLocked))
+	assert.Contains(t, err.Error(), "pid "+strconv.Itoa(os.Getpid()))
+
+	require.NoError(t, lock.Release())
+	lock, err = Acquire(path)
+	require.NoError(t, err, "Expect the lock to be acquired once released")
+	lock.Release()
+}
+
+func TestTakeover(t *testing.T) {
+	path := newTestLockPath(t)
+
+	holder, err := Acquire(path)
+	require.NoError(t, err)
+	// the holder releases the lock once the process it names is stopped
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	require.NoError(t, ioutil.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)), lockFilePerm))
+	go func() {
+		cmd.Wait()
+		holder.Release()
+	}()
+
+	lock, err := Takeover(path, 5*time.Second)
+	require.NoError(t, err)
+	defer lock.Release()
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(data))
+}
+
+func TestTakeoverTimeout(t *testing.T) {
+	path := newTestLockPath(t)
+
+	holder, err := Acquire(path)
+	require.NoError(t, err)
+	defer holder.Release()
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	defer cmd.Wait()
+	require.NoError(t, ioutil.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)), lockFilePerm))
+
+	_, err = Takeover(path, 200*time.Millisecond)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrLocked))
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package ssmclient is a client for the AWS Systems Manager Parameter Store
+// APIs used to coordinate the Agent across instances, and for the Inventory
+// APIs used to report on it
+package ssmclient
+
+import (
+	"github.com/aws/amazon-ecs-init/ecs-init/awsjson"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+var service = awsjson.Service{
+	Name:         "ssm",
+	ID:           "SSM",
+	APIVersion:   "2014-11-06",
+	TargetPrefix: "AmazonSSM",
+}
+
+// Client calls the AWS Systems Manager APIs of a region
+type Client struct {
+	*awsjson.Client
+}
+
+// New creates a Client of the Parameter Store and Inventory APIs of region
+func New(region string) (*Client, error) {
+	client, err := awsjson.NewForRegion(region, service)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+func newClient(cfg *aws.Config) (*Client, error) {
+	client, err := awsjson.New(cfg, service)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+// Parameter is the subset of a parameter used by ecs-init
+type Parameter struct {
+	Name    string `json:"Name,omitempty"`
+	Value   string `json:"Value,omitempty"`
+	Version int64  `json:"Version,omitempty"`
+}
+
+type getParameterInput struct {
+	Name           string `json:"Name"`
+	WithDecryption bool   `json:"WithDecryption"`
+}
+
+type getParameterOutput struct {
+	Parameter Parameter `json:"Parameter"`
+}
+
+// GetParameterValue returns the value of the parameter name, decrypting
+// secure strings
+func (c *Client) GetParameterValue(name string) (string, error) {
+	output := &getParameterOutput{}
+	err := c.Call("GetParameter", &getParameterInput{Name: name, WithDecryption: true}, output)
+	if err != nil {
+		return "", err
+	}
+	return output.Parameter.Value, nil
+}
+
+// InventoryTimeFormat is the format of the capture time of inventory items
+const InventoryTimeFormat = "2006-01-02T15:04:05Z"
+
+// InventoryItem is an inventory type reported for an instance, such as a
+// custom type named "Custom:Name"
+type InventoryItem struct {
+	TypeName      string              `json:"TypeName"`
+	SchemaVersion string              `json:"SchemaVersion"`
+	CaptureTime   string              `json:"CaptureTime"`
+	Content       []map[string]string `json:"Content"`
+}
+
+type putInventoryInput struct {
+	InstanceID string          `json:"InstanceId"`
+	Items      []InventoryItem `json:"Items"`
+}
+
+// PutInventory reports the inventory items of the instance instanceID,
+// replacing the items of the same types reported before
+func (c *Client) PutInventory(instanceID string, items ...InventoryItem) error {
+	return c.Call("PutInventory", &putInventoryInput{InstanceID: instanceID, Items: items}, &struct{}{})
+}
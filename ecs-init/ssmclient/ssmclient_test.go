@@ -0,0 +1,72 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ssmclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/awstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetParameterValue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AmazonSSM.GetParameter", r.Header.Get("X-Amz-Target"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-west-2/ssm/aws4_request")
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{"Name":"/ecs/maintenance","WithDecryption":true}`, string(body))
+		w.Write([]byte(`{"Parameter":{"Name":"/ecs/maintenance","Value":"25","Version":3}}`))
+	}))
+	defer server.Close()
+
+	value, err := awstest.NewClient(t, server, newClient).GetParameterValue("/ecs/maintenance")
+	require.NoError(t, err)
+	assert.Equal(t, "25", value)
+}
+
+func TestGetParameterValueNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"ParameterNotFound","message":""}`))
+	}))
+	defer server.Close()
+
+	_, err := awstest.NewClient(t, server, newClient).GetParameterValue("/ecs/missing")
+	assert.Error(t, err)
+}
+
+func TestPutInventory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AmazonSSM.PutInventory", r.Header.Get("X-Amz-Target"))
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{"InstanceId":"i-1234","Items":[{"TypeName":"Custom:Test","SchemaVersion":"1.0",`+
+			`"CaptureTime":"2020-01-02T03:04:05Z","Content":[{"Version":"v1.40.0"}]}]}`, string(body))
+		w.Write([]byte(`{"Message":""}`))
+	}))
+	defer server.Close()
+
+	err := awstest.NewClient(t, server, newClient).PutInventory("i-1234", InventoryItem{
+		TypeName:      "Custom:Test",
+		SchemaVersion: "1.0",
+		CaptureTime:   time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC).Format(InventoryTimeFormat),
+		Content:       []map[string]string{{"Version": "v1.40.0"}},
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package volumeplugin
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+)
+
+//go:generate mockgen.sh $GOPACKAGE $GOFILE
+
+type process interface {
+	Start() error
+	Wait() error
+	Signal(sig os.Signal) error
+}
+
+type processFactory interface {
+	New(name string, arg ...string) process
+}
+
+type fileSystem interface {
+	Stat(name string) (os.FileInfo, error)
+	Remove(name string) error
+	MkdirAll(path string, perm os.FileMode) error
+	WriteFile(filename string, data []byte, perm os.FileMode) error
+}
+
+type _osProcessFactory struct{}
+
+func (*_osProcessFactory) New(name string, arg ...string) process {
+	return &_osProcess{osexec.Command(name, arg...)}
+}
+
+type _osProcess struct {
+	*osexec.Cmd
+}
+
+func (p *_osProcess) Signal(sig os.Signal) error {
+	if p.Process == nil {
+		return os.ErrInvalid
+	}
+	return p.Process.Signal(sig)
+}
+
+type _standardFS struct{}
+
+var standardFS = &_standardFS{}
+
+func (s *_standardFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (s *_standardFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (s *_standardFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (s *_standardFS) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	return ioutil.WriteFile(filename, data, perm)
+}
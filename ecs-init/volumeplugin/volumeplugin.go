@@ -0,0 +1,278 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package volumeplugin runs the Amazon ECS volume plugin, which provides
+// the local volume driver of tasks, next to the Agent
+package volumeplugin
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	restartMinRetryTime     = time.Millisecond * 500
+	restartMaxRetryTime     = time.Second * 15
+	restartRetryJitter      = 0.10
+	restartRetryMultiplier  = 2.0
+	pluginDirectoryPerm     = 0755
+	specFilePerm            = 0644
+	pluginStopTimeout       = 30 * time.Second
+	pluginSocketWaitTimeout = 10 * time.Second
+	pluginSocketPollTime    = 100 * time.Millisecond
+	// pluginStableAfter is how long the plugin runs before its exit is no
+	// longer considered part of a crash loop, and the restart backoff is reset
+	pluginStableAfter = 10 * time.Minute
+	// defaultMaxRestarts is how many times in a row the plugin is restarted
+	// after failing when ECS_INIT_AGENT_MAX_RESTARTS is unset
+	defaultMaxRestarts = 10
+)
+
+// Supervisor registers the volume plugin with Docker and keeps it running,
+// restarting it with a backoff whenever it exits, until it is stopped or has
+// failed more times in a row than the Agent may
+type Supervisor struct {
+	processFactory processFactory
+	fs             fileSystem
+	newBackoff     func(maxRestarts int) backoff.Backoff
+	socketTimeout  time.Duration
+	stableAfter    time.Duration
+	// clock tells the time and waits for it to pass, see clk
+	clock       clock.Clock
+	maxRestarts int
+
+	lock    sync.Mutex
+	current process
+	modTime time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewSupervisor creates a new Supervisor object
+func NewSupervisor() *Supervisor {
+	return &Supervisor{
+		processFactory: &_osProcessFactory{},
+		fs:             standardFS,
+		newBackoff:     newRestartBackoff,
+		socketTimeout:  pluginSocketWaitTimeout,
+		stableAfter:    pluginStableAfter,
+		clock:          clock.Real,
+	}
+}
+
+// newRestartBackoff returns the backoff between the restarts of the failed
+// plugin, which allows maxRestarts restarts
+func newRestartBackoff(maxRestarts int) backoff.Backoff {
+	return backoff.NewBackoff(restartMinRetryTime, restartMaxRetryTime,
+		restartRetryJitter, restartRetryMultiplier, maxRestarts)
+}
+
+// clk returns the clock of the supervisor, which is the real clock unless the
+// supervisor was given another one
+func (s *Supervisor) clk() clock.Clock {
+	return clock.OrReal(s.clock)
+}
+
+// Start registers the volume plugin with Docker and starts supervising it
+func (s *Supervisor) Start() error {
+	info, err := s.fs.Stat(config.VolumePluginExecutable())
+	if err != nil {
+		return errors.Wrap(err, "volume plugin is not installed")
+	}
+	s.modTime = info.ModTime()
+	// the plugin is given up on after as many failures in a row as the Agent
+	maxRestarts, err := config.AgentMaxRestarts()
+	if err != nil {
+		log.Warnf("Restarting the volume plugin up to %d times in a row: %v", defaultMaxRestarts, err)
+	}
+	if maxRestarts == 0 {
+		maxRestarts = defaultMaxRestarts
+	}
+	s.maxRestarts = maxRestarts
+	err = s.fs.MkdirAll(filepath.Dir(config.VolumePluginSpecFile()), pluginDirectoryPerm)
+	if err != nil {
+		return errors.Wrap(err, "could not create the Docker plugin directory")
+	}
+	err = s.fs.WriteFile(config.VolumePluginSpecFile(),
+		[]byte(config.UnixSocketPrefix+config.VolumePluginSocket()+"\n"), specFilePerm)
+	if err != nil {
+		return errors.Wrap(err, "could not register the volume plugin with Docker")
+	}
+	s.lock.Lock()
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.supervise(s.stop, s.done)
+	s.lock.Unlock()
+	return nil
+}
+
+// Stop terminates the volume plugin and unregisters it from Docker. Stopping
+// a supervisor that is not started does nothing.
+func (s *Supervisor) Stop() error {
+	s.lock.Lock()
+	stop, done := s.stop, s.done
+	s.stop = nil
+	s.lock.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	<-done
+	s.removeSocket()
+	err := s.fs.Remove(config.VolumePluginSpecFile())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RestartIfUpdated restarts the volume plugin if its executable was replaced
+// since it was started, such as by an upgrade
+func (s *Supervisor) RestartIfUpdated() error {
+	info, err := s.fs.Stat(config.VolumePluginExecutable())
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if info.ModTime().Equal(s.modTime) || s.current == nil {
+		return nil
+	}
+	log.Info("Volume plugin was updated, restarting it")
+	s.modTime = info.ModTime()
+	return s.current.Signal(syscall.SIGTERM)
+}
+
+func (s *Supervisor) supervise(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	retryBackoff := s.newBackoff(s.maxRestarts)
+	restarts := 0
+	for {
+		started := s.clk().Now()
+		exited := s.run()
+		select {
+		case <-stop:
+			s.terminate(exited)
+			return
+		case err := <-exited:
+			log.Warnf("Volume plugin exited: %v", err)
+		}
+		if s.clk().Since(started) >= s.stableAfter {
+			// a plugin exiting after running for long is not crash looping
+			restarts = 0
+			retryBackoff = s.newBackoff(s.maxRestarts)
+		}
+		if !retryBackoff.ShouldRetry() {
+			log.Errorf("Volume plugin failed %d times in a row, giving up after %d restarts", restarts+1, restarts)
+			// Docker is no longer pointed at a plugin that will not come back
+			err := s.fs.Remove(config.VolumePluginSpecFile())
+			if err != nil && !os.IsNotExist(err) {
+				log.Warnf("Could not unregister the volume plugin from Docker: %v", err)
+			}
+			return
+		}
+		restarts++
+		d := retryBackoff.Duration()
+		log.Infof("Restarting volume plugin in %s", d)
+		select {
+		case <-stop:
+			return
+		case <-s.clk().After(d):
+		}
+	}
+}
+
+// run starts the volume plugin and returns a channel that receives its exit
+func (s *Supervisor) run() <-chan error {
+	exited := make(chan error, 1)
+	s.lock.Lock()
+	s.current = nil
+	s.lock.Unlock()
+	// a socket left behind by the previous plugin would make Docker
+	// report the plugin as available before it listens
+	s.removeSocket()
+	plugin := s.processFactory.New(config.VolumePluginExecutable())
+	err := plugin.Start()
+	if err != nil {
+		exited <- err
+		return exited
+	}
+	s.lock.Lock()
+	s.current = plugin
+	s.lock.Unlock()
+	waited := make(chan struct{})
+	go func() {
+		exited <- plugin.Wait()
+		close(waited)
+	}()
+	go s.checkSocket(plugin, waited)
+	return exited
+}
+
+// checkSocket terminates plugin if it does not create its socket in time
+func (s *Supervisor) checkSocket(plugin process, waited <-chan struct{}) {
+	timeout := s.clk().After(s.socketTimeout)
+	ticker := s.clk().NewTicker(pluginSocketPollTime)
+	defer ticker.Stop()
+	for {
+		if _, err := s.fs.Stat(config.VolumePluginSocket()); err == nil {
+			return
+		}
+		select {
+		case <-waited:
+			return
+		case <-ticker.C():
+		case <-timeout:
+			log.Warnf("Volume plugin did not create %s within %s, restarting it",
+				config.VolumePluginSocket(), s.socketTimeout)
+			plugin.Signal(syscall.SIGTERM)
+			return
+		}
+	}
+}
+
+// terminate stops the running plugin, killing it if it does not exit in time
+func (s *Supervisor) terminate(exited <-chan error) {
+	s.lock.Lock()
+	plugin := s.current
+	s.current = nil
+	s.lock.Unlock()
+	if plugin == nil {
+		return
+	}
+	plugin.Signal(syscall.SIGTERM)
+	select {
+	case <-exited:
+	case <-s.clk().After(pluginStopTimeout):
+		log.Warn("Volume plugin did not stop, killing it")
+		plugin.Signal(syscall.SIGKILL)
+		<-exited
+	}
+}
+
+func (s *Supervisor) removeSocket() {
+	err := s.fs.Remove(config.VolumePluginSocket())
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("Could not remove volume plugin socket: %v", err)
+	}
+}
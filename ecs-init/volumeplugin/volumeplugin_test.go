@@ -0,0 +1,275 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package volumeplugin
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-init/ecs-init/backoff"
+	"github.com/aws/amazon-ecs-init/ecs-init/clock"
+	"github.com/aws/amazon-ecs-init/ecs-init/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeFileInfo struct {
+	os.FileInfo
+	modTime time.Time
+}
+
+func (f fakeFileInfo) ModTime() time.Time {
+	return f.modTime
+}
+
+func newTestSupervisor(factory processFactory, fs fileSystem) *Supervisor {
+	return &Supervisor{
+		processFactory: factory,
+		fs:             fs,
+		newBackoff: func(maxRestarts int) backoff.Backoff {
+			return backoff.NewBackoff(time.Millisecond, time.Millisecond, 0, 1, maxRestarts)
+		},
+		socketTimeout: time.Second,
+		stableAfter:   time.Hour,
+	}
+}
+
+// expectRunning sets up plugin to run until it receives a signal
+func expectRunning(plugin *Mockprocess) {
+	signaled := make(chan struct{})
+	plugin.EXPECT().Start()
+	plugin.EXPECT().Wait().DoAndReturn(func() error {
+		<-signaled
+		return errors.New("signal: terminated")
+	})
+	plugin.EXPECT().Signal(syscall.SIGTERM).DoAndReturn(func(os.Signal) error {
+		close(signaled)
+		return nil
+	})
+}
+
+func expectRegistered(mockFS *MockfileSystem, installed time.Time) {
+	mockFS.EXPECT().Stat(config.VolumePluginExecutable()).Return(fakeFileInfo{modTime: installed}, nil)
+	mockFS.EXPECT().MkdirAll(gomock.Any(), os.FileMode(pluginDirectoryPerm))
+	mockFS.EXPECT().WriteFile(config.VolumePluginSpecFile(),
+		[]byte("unix://"+config.VolumePluginSocket()+"\n"), os.FileMode(specFilePerm))
+}
+
+func TestStartStop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockFactory := NewMockprocessFactory(ctrl)
+	mockFS := NewMockfileSystem(ctrl)
+	plugin := NewMockprocess(ctrl)
+
+	expectRegistered(mockFS, time.Now())
+	mockFS.EXPECT().Remove(config.VolumePluginSocket()).Return(os.ErrNotExist).Times(2)
+	mockFS.EXPECT().Stat(config.VolumePluginSocket()).Return(fakeFileInfo{}, nil).AnyTimes()
+	mockFactory.EXPECT().New(config.VolumePluginExecutable()).Return(plugin)
+	expectRunning(plugin)
+	mockFS.EXPECT().Remove(config.VolumePluginSpecFile())
+
+	supervisor := newTestSupervisor(mockFactory, mockFS)
+	assert.NoError(t, supervisor.Start())
+	assert.NoError(t, supervisor.Stop())
+}
+
+func TestRestartsExitedPlugin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockFactory := NewMockprocessFactory(ctrl)
+	mockFS := NewMockfileSystem(ctrl)
+	crashed := NewMockprocess(ctrl)
+	restarted := NewMockprocess(ctrl)
+
+	expectRegistered(mockFS, time.Now())
+	mockFS.EXPECT().Remove(config.VolumePluginSocket()).Return(os.ErrNotExist).AnyTimes()
+	mockFS.EXPECT().Stat(config.VolumePluginSocket()).Return(fakeFileInfo{}, nil).AnyTimes()
+	running := make(chan struct{})
+	gomock.InOrder(
+		mockFactory.EXPECT().New(config.VolumePluginExecutable()).Return(crashed),
+		mockFactory.EXPECT().New(config.VolumePluginExecutable()).DoAndReturn(func(string, ...string) process {
+			close(running)
+			return restarted
+		}),
+	)
+	crashed.EXPECT().Start()
+	crashed.EXPECT().Wait().Return(errors.New("exit status 1"))
+	expectRunning(restarted)
+	mockFS.EXPECT().Remove(config.VolumePluginSpecFile())
+
+	supervisor := newTestSupervisor(mockFactory, mockFS)
+	assert.NoError(t, supervisor.Start())
+	<-running
+	assert.NoError(t, supervisor.Stop())
+}
+
+func TestRestartResetsBackoffAfterStableRun(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		stableAfter time.Duration
+		backoffs    int
+	}{
+		{"crash loop", time.Hour, 1},
+		{"stable run", 0, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockFactory := NewMockprocessFactory(ctrl)
+			mockFS := NewMockfileSystem(ctrl)
+			crashed := NewMockprocess(ctrl)
+			restarted := NewMockprocess(ctrl)
+
+			expectRegistered(mockFS, time.Now())
+			mockFS.EXPECT().Remove(config.VolumePluginSocket()).Return(os.ErrNotExist).AnyTimes()
+			mockFS.EXPECT().Stat(config.VolumePluginSocket()).Return(fakeFileInfo{}, nil).AnyTimes()
+			running := make(chan struct{})
+			gomock.InOrder(
+				mockFactory.EXPECT().New(config.VolumePluginExecutable()).Return(crashed),
+				mockFactory.EXPECT().New(config.VolumePluginExecutable()).DoAndReturn(func(string, ...string) process {
+					close(running)
+					return restarted
+				}),
+			)
+			crashed.EXPECT().Start()
+			crashed.EXPECT().Wait().Return(errors.New("exit status 1"))
+			expectRunning(restarted)
+			mockFS.EXPECT().Remove(config.VolumePluginSpecFile())
+
+			supervisor := newTestSupervisor(mockFactory, mockFS)
+			supervisor.stableAfter = test.stableAfter
+			backoffs := 0
+			supervisor.newBackoff = func(maxRestarts int) backoff.Backoff {
+				backoffs++
+				return backoff.NewBackoff(time.Millisecond, time.Millisecond, 0, 1, maxRestarts)
+			}
+			assert.NoError(t, supervisor.Start())
+			<-running
+			assert.NoError(t, supervisor.Stop())
+			assert.Equal(t, test.backoffs, backoffs)
+		})
+	}
+}
+
+func TestGivesUpAfterMaxRestarts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	os.Setenv(config.AgentMaxRestartsEnvVar, "1")
+	defer os.Unsetenv(config.AgentMaxRestartsEnvVar)
+
+	mockFactory := NewMockprocessFactory(ctrl)
+	mockFS := NewMockfileSystem(ctrl)
+	crashed := NewMockprocess(ctrl)
+	restarted := NewMockprocess(ctrl)
+
+	expectRegistered(mockFS, time.Now())
+	mockFS.EXPECT().Remove(config.VolumePluginSocket()).Return(os.ErrNotExist).AnyTimes()
+	gomock.InOrder(
+		mockFactory.EXPECT().New(config.VolumePluginExecutable()).Return(crashed),
+		mockFactory.EXPECT().New(config.VolumePluginExecutable()).Return(restarted),
+	)
+	crashed.EXPECT().Start().Return(errors.New("exec format error"))
+	restarted.EXPECT().Start().Return(errors.New("exec format error"))
+	unregistered := make(chan struct{})
+	gomock.InOrder(
+		mockFS.EXPECT().Remove(config.VolumePluginSpecFile()).DoAndReturn(func(string) error {
+			close(unregistered)
+			return nil
+		}),
+		mockFS.EXPECT().Remove(config.VolumePluginSpecFile()).Return(os.ErrNotExist),
+	)
+
+	fakeClock := clock.NewFake(time.Now())
+	supervisor := newTestSupervisor(mockFactory, mockFS)
+	supervisor.clock = fakeClock
+	assert.NoError(t, supervisor.Start())
+	// the first failure is followed by a restart
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Millisecond)
+	// the second one is not
+	<-unregistered
+	assert.NoError(t, supervisor.Stop())
+}
+
+func TestStopTwice(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockFactory := NewMockprocessFactory(ctrl)
+	mockFS := NewMockfileSystem(ctrl)
+	plugin := NewMockprocess(ctrl)
+
+	expectRegistered(mockFS, time.Now())
+	mockFS.EXPECT().Remove(config.VolumePluginSocket()).Return(os.ErrNotExist).Times(2)
+	mockFS.EXPECT().Stat(config.VolumePluginSocket()).Return(fakeFileInfo{}, nil).AnyTimes()
+	mockFactory.EXPECT().New(config.VolumePluginExecutable()).Return(plugin)
+	expectRunning(plugin)
+	mockFS.EXPECT().Remove(config.VolumePluginSpecFile())
+
+	supervisor := newTestSupervisor(mockFactory, mockFS)
+	assert.NoError(t, supervisor.Start())
+	assert.NoError(t, supervisor.Stop())
+	assert.NoError(t, supervisor.Stop())
+}
+
+func TestStopNotStarted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	supervisor := newTestSupervisor(NewMockprocessFactory(ctrl), NewMockfileSystem(ctrl))
+	assert.NoError(t, supervisor.Stop())
+}
+
+func TestStartNotInstalled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockFS := NewMockfileSystem(ctrl)
+	mockFS.EXPECT().Stat(config.VolumePluginExecutable()).Return(nil, os.ErrNotExist)
+
+	supervisor := newTestSupervisor(NewMockprocessFactory(ctrl), mockFS)
+	assert.Error(t, supervisor.Start())
+}
+
+func TestRestartIfUpdated(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockFS := NewMockfileSystem(ctrl)
+	plugin := NewMockprocess(ctrl)
+	installed := time.Now()
+
+	gomock.InOrder(
+		mockFS.EXPECT().Stat(config.VolumePluginExecutable()).Return(fakeFileInfo{modTime: installed}, nil),
+		mockFS.EXPECT().Stat(config.VolumePluginExecutable()).Return(fakeFileInfo{modTime: installed.Add(time.Hour)}, nil),
+		plugin.EXPECT().Signal(syscall.SIGTERM),
+	)
+
+	supervisor := newTestSupervisor(NewMockprocessFactory(ctrl), mockFS)
+	supervisor.modTime = installed
+	supervisor.current = plugin
+	// not updated
+	assert.NoError(t, supervisor.RestartIfUpdated())
+	// updated
+	assert.NoError(t, supervisor.RestartIfUpdated())
+	assert.Equal(t, installed.Add(time.Hour), supervisor.modTime)
+}
@@ -46,7 +46,7 @@ Source3:        https://s3.amazonaws.com/amazon-ecs-agent/ecs-agent-v%{bundled_a
 # aarch64 Container agent docker image
 Source4:        https://s3.amazonaws.com/amazon-ecs-agent/ecs-agent-arm64-v%{bundled_agent_version}.tar
 
-BuildRequires:  golang >= 1.7
+BuildRequires:  golang >= 1.20
 %if %{with systemd}
 BuildRequires:  systemd
 Requires:       systemd
@@ -25,7 +25,7 @@ Group:          System Environment/Base
 Url:            https://github.com/aws/amazon-ecs-init
 Source0:        %{name}-%{version}.tar.gz
 Source1:        %{short_name}.service
-BuildRequires:  go
+BuildRequires:  go >= 1.20
 BuildRequires:  systemd
 Requires:       docker >= 1.6.0
 Requires:       systemd